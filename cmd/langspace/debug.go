@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/runtime"
+)
+
+const debugHelp = `Commands:
+  c, continue          Run until the next breakpoint
+  n, step              Run this step and pause before the next
+  skip [value]         Skip this step, with the value (JSON or text) as its output
+  b, break [step...]   Pause at steps; list breakpoints without steps
+  clear [step...]      Stop pausing at steps, or at any without steps
+  p, print [name]      Print the step's input, the variables, and step outputs,
+                       or one variable or step output
+  set name=value       Set a variable (the value is parsed as JSON if it is valid JSON)
+  output step=value    Set a step's output
+  history              List the steps run so far
+  frame N              Print the state before the Nth step run
+  q, stop              Stop the execution
+  h, help              Show this help`
+
+// debugConsole drives a debug session from a terminal: it prints where the
+// execution paused and reads commands until one resumes it. At the end of
+// the input, it runs the execution to the end.
+type debugConsole struct {
+	session *runtime.DebugSession
+	in      *bufio.Scanner
+	out     io.Writer
+	eof     bool
+}
+
+// run handles pauses until the session is closed.
+func (c *debugConsole) run() {
+	for frame := range c.session.Paused() {
+		c.printFrame(frame)
+		c.session.Resume(c.prompt(frame))
+	}
+}
+
+// prompt reads commands until one resumes the execution.
+func (c *debugConsole) prompt(frame *runtime.DebugFrame) runtime.DebugAction {
+	for {
+		if c.eof {
+			return runtime.DebugContinue
+		}
+		checkPrint(fmt.Fprint(c.out, "(debug) "))
+		if !c.in.Scan() {
+			checkPrint(fmt.Fprintln(c.out))
+			c.eof = true
+			c.session.SetBreakpoints()
+			continue
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(c.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch cmd {
+		case "":
+		case "c", "continue":
+			return runtime.DebugContinue
+		case "n", "step":
+			return runtime.DebugStep
+		case "skip":
+			if arg != "" {
+				if err := frame.SetStepOutput(frame.Step, parseParamValue(arg)); err != nil {
+					checkPrint(fmt.Fprintln(c.out, err))
+					continue
+				}
+			}
+			return runtime.DebugSkip
+		case "q", "stop":
+			return runtime.DebugStop
+		case "b", "break":
+			if arg != "" {
+				c.session.SetBreakpoints(append(c.session.Breakpoints(), strings.Fields(arg)...)...)
+			}
+			checkPrint(fmt.Fprintf(c.out, "Breakpoints: %s\n", strings.Join(c.session.Breakpoints(), ", ")))
+		case "clear":
+			var keep []string
+			if arg != "" {
+				cleared := strings.Fields(arg)
+				for _, step := range c.session.Breakpoints() {
+					if !slices.Contains(cleared, step) {
+						keep = append(keep, step)
+					}
+				}
+			}
+			c.session.SetBreakpoints(keep...)
+		case "p", "print":
+			c.print(frame, arg)
+		case "set", "output":
+			name, value, ok := strings.Cut(arg, "=")
+			if name = strings.TrimSpace(name); !ok || name == "" {
+				checkPrint(fmt.Fprintf(c.out, "usage: %s name=value\n", cmd))
+				continue
+			}
+			set := frame.SetVariable
+			if cmd == "output" {
+				set = frame.SetStepOutput
+			}
+			if err := set(name, parseParamValue(strings.TrimSpace(value))); err != nil {
+				checkPrint(fmt.Fprintln(c.out, err))
+			}
+		case "history":
+			for i, f := range c.session.History() {
+				checkPrint(fmt.Fprintf(c.out, "%3d  %s\n", i+1, f.Step))
+			}
+		case "frame":
+			history := c.session.History()
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(history) {
+				checkPrint(fmt.Fprintf(c.out, "usage: frame N, with N from 1 to %d\n", len(history)))
+				continue
+			}
+			c.printFrame(history[n-1])
+			c.print(history[n-1], "")
+		case "h", "help":
+			checkPrint(fmt.Fprintln(c.out, debugHelp))
+		default:
+			checkPrint(fmt.Fprintf(c.out, "unknown command %q (try help)\n", cmd))
+		}
+	}
+}
+
+func (c *debugConsole) printFrame(frame *runtime.DebugFrame) {
+	checkPrint(fmt.Fprintf(c.out, "\nPaused before step %q (%d/%d) of pipeline %q", frame.Step, frame.Index, frame.Total, frame.Pipeline))
+	if frame.Line > 0 {
+		checkPrint(fmt.Fprintf(c.out, " at line %d", frame.Line))
+	}
+	checkPrint(fmt.Fprintln(c.out))
+}
+
+// print prints a variable or step output, or without a name, all of them
+// and the step's input.
+func (c *debugConsole) print(frame *runtime.DebugFrame, name string) {
+	if name != "" {
+		if v, ok := frame.Snapshot.Variables[name]; ok {
+			checkPrint(fmt.Fprintln(c.out, formatOutput(v)))
+		} else if v, ok := frame.Snapshot.StepOutputs[name]; ok {
+			checkPrint(fmt.Fprintln(c.out, formatOutput(v)))
+		} else {
+			checkPrint(fmt.Fprintf(c.out, "no variable or step output %q\n", name))
+		}
+		return
+	}
+
+	switch {
+	case frame.InputError != "":
+		checkPrint(fmt.Fprintf(c.out, "Input: (error: %s)\n", frame.InputError))
+	case frame.Input != nil:
+		checkPrint(fmt.Fprintf(c.out, "Input: %s\n", formatOutput(frame.Input)))
+	}
+	printValues(c.out, "Variables", frame.Snapshot.Variables)
+	outputs := make(map[string]interface{})
+	for k, v := range frame.Snapshot.StepOutputs {
+		if !strings.HasSuffix(k, ".output") {
+			outputs[k] = v
+		}
+	}
+	printValues(c.out, "Step outputs", outputs)
+}
+
+func printValues(w io.Writer, title string, values map[string]interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	checkPrint(fmt.Fprintf(w, "%s:\n", title))
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checkPrint(fmt.Fprintf(w, "  %s = %s\n", name, formatOutput(values[name])))
+	}
+}
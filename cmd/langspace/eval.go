@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// runEval handles the eval command: it runs the cases of eval entities
+// against their targets and reports how many runs passed, or fails if an
+// eval's pass rate is below its threshold.
+func runEval(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file with eval entities")
+	name := fs.String("name", "", "Eval to run (default: every eval in the file)")
+	runs := fs.Int("runs", 0, "Times to run each case (default: the eval's runs, or 1)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Timeout of each run")
+	jsonOut := fs.Bool("json", false, "Write the reports as JSON instead of a table")
+	output := fs.String("output", "", "Also write the reports as JSON to this file")
+	versionsDir := fs.String("versions", defaultVersionsDir, "Directory of published versions that targets pin with @version (see publish)")
+	record := fs.String("record", "", "Record the model calls of every run to this cassette file")
+	replay := fs.String("replay", "", "Answer model calls from this cassette file, without calling providers")
+	var logLevel slog.Level
+	fs.TextVar(&logLevel, "log-level", slog.LevelWarn, "Least severe log entries to write to stderr: debug, info, warn, or error")
+	profile := fs.String("profile", os.Getenv("LANGSPACE_PROFILE"), "Profile whose overlays to apply, e.g. prod (default: $LANGSPACE_PROFILE)")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	if *runs < 0 {
+		return fmt.Errorf("-runs must not be negative")
+	}
+
+	ws := workspace.New()
+	l := workspace.NewLoader(ws).WithProfile(*profile)
+	if err := l.Load(*inputFile); err != nil {
+		return err
+	}
+	if !workspace.IsBundle(*inputFile) {
+		if err := workspace.NewVersionStore(*versionsDir).LoadInto(ws); err != nil {
+			return fmt.Errorf("loading published versions: %w", err)
+		}
+	}
+
+	var names []string
+	if *name != "" {
+		names = []string{*name}
+	} else {
+		for _, e := range ws.GetEntitiesByType("eval") {
+			names = append(names, e.Name())
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no eval entities in %s", *inputFile)
+		}
+	}
+
+	rtOpts := []runtime.Option{
+		runtime.WithConfig(&runtime.Config{
+			DefaultModel:    runtime.DefaultModel,
+			DefaultProvider: "anthropic",
+			Timeout:         *timeout,
+			LogLevel:        logLevel,
+		}),
+		runtime.WithLogger(runtime.NewLogger(stderr, logLevel)),
+	}
+	cassette, err := openCassette(*record, *replay)
+	if err != nil {
+		return err
+	}
+	if cassette != nil {
+		defer saveCassette(cassette, stderr)
+		rtOpts = append(rtOpts, runtime.WithCassette(cassette))
+	}
+
+	rt := runtime.New(ws, rtOpts...)
+	defer rt.Close()
+
+	rt.RegisterProvider("anthropic", runtime.NewAnthropicProvider())
+	rt.RegisterProvider("openai", runtime.NewOpenAIProvider())
+	rt.RegisterProvider("gemini", runtime.NewGeminiProvider())
+	rt.RegisterProvider("bedrock", runtime.NewBedrockProvider())
+	if err := rt.ConfigureProviders(); err != nil {
+		return fmt.Errorf("configuring providers: %w", err)
+	}
+	if err := checkAgents(rt); err != nil {
+		return err
+	}
+
+	opts := []runtime.EvalOption{runtime.WithEvalExecuteOptions(runtime.WithTimeout(*timeout))}
+	if *runs > 0 {
+		opts = append(opts, runtime.WithEvalRuns(*runs))
+	}
+
+	var reports []*runtime.EvalReport
+	var failed []string
+	for _, n := range names {
+		report, err := rt.Eval(context.Background(), n, opts...)
+		if err != nil {
+			return fmt.Errorf("eval %q: %w", n, err)
+		}
+		reports = append(reports, report)
+		if !report.OK() {
+			failed = append(failed, n)
+		}
+		if !*jsonOut {
+			printEvalReport(stdout, report)
+		}
+	}
+
+	if *jsonOut || *output != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding reports: %w", err)
+		}
+		if *jsonOut {
+			checkPrint(fmt.Fprintln(stdout, string(data)))
+		}
+		if *output != "" {
+			if err := os.WriteFile(*output, append(data, '\n'), 0o644); err != nil {
+				return fmt.Errorf("writing report: %w", err)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d evals below their pass rate: %v", len(failed), len(reports), failed)
+	}
+	return nil
+}
+
+// printEvalReport prints an eval's cases as a table, then why each failed
+// run failed.
+func printEvalReport(w io.Writer, report *runtime.EvalReport) {
+	checkPrint(fmt.Fprintf(w, "=== %s (%s, %d runs per case) ===\n", report.Eval, report.Target, report.Runs))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	checkPrint(fmt.Fprintln(tw, "CASE\tPASSED\tRATE\tLATENCY\tMAX\tTOKENS\tCOST"))
+	for _, c := range report.Cases {
+		checkPrint(fmt.Fprintf(tw, "%s\t%d/%d\t%.0f%%\t%s\t%s\t%d\t$%.4f\n",
+			c.Name, c.Passed, len(c.Runs), c.PassRate*100,
+			c.Latency.Round(time.Millisecond), c.MaxLatency.Round(time.Millisecond),
+			c.TokensUsed.TotalTokens, c.Cost))
+	}
+	checkPrint(0, tw.Flush())
+
+	for _, c := range report.Cases {
+		for i, run := range c.Runs {
+			if run.Passed {
+				continue
+			}
+			checkPrint(fmt.Fprintf(w, "  %s, run %d:\n", c.Name, i+1))
+			if run.Error != "" {
+				checkPrint(fmt.Fprintf(w, "    error: %s\n", run.Error))
+			}
+			for _, f := range run.Failures {
+				checkPrint(fmt.Fprintf(w, "    %s\n", f))
+			}
+		}
+	}
+
+	status := "ok"
+	if !report.OK() {
+		status = "FAILED"
+	}
+	checkPrint(fmt.Fprintf(w, "--- %s: %d of %d runs passed (%.0f%%, threshold %.0f%%), %d tokens, $%.4f ---\n\n",
+		status, report.Passed, report.Total, report.PassRate*100, report.Threshold*100,
+		report.TokensUsed.TotalTokens, report.Cost))
+}
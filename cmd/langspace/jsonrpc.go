@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+
+	// rpcExecutionError is for an execution that could not start, such as
+	// one of an unknown entity
+	rpcExecutionError = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcExecuteParams are the params of an execute request.
+type rpcExecuteParams struct {
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type,omitempty"`
+	Input    interface{}            `json:"input,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Metadata map[string]string      `json:"metadata,omitempty"`
+
+	// Timeout is a duration such as "30s"; it defaults to the -timeout
+	// flag
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// rpcExecuteResult is the result of an execute request.
+type rpcExecuteResult struct {
+	Success    bool               `json:"success"`
+	Output     interface{}        `json:"output,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	DurationMS int64              `json:"duration_ms"`
+	TokensUsed runtime.TokenUsage `json:"tokens_used"`
+	Metadata   map[string]string  `json:"metadata,omitempty"`
+	RunID      string             `json:"run_id,omitempty"`
+	Steps      []rpcStepResult    `json:"steps,omitempty"`
+}
+
+type rpcStepResult struct {
+	Name       string             `json:"name"`
+	Success    bool               `json:"success"`
+	Status     string             `json:"status,omitempty"`
+	Output     interface{}        `json:"output,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	DurationMS int64              `json:"duration_ms"`
+	Model      string             `json:"model,omitempty"`
+	TokensUsed runtime.TokenUsage `json:"tokens_used"`
+}
+
+// jsonRPCRunner serves execution requests as JSON-RPC 2.0 messages, one per
+// line, for editors and other processes that embed LangSpace. Requests run
+// concurrently; while one runs, its chunks and progress are sent as
+// "execute/chunk" and "execute/progress" notifications carrying its id.
+type jsonRPCRunner struct {
+	rt      *runtime.Runtime
+	ws      *workspace.Workspace
+	timeout time.Duration
+	stream  bool
+
+	// mu guards out, so messages are never interleaved
+	mu  sync.Mutex
+	out io.Writer
+
+	runsMu sync.Mutex
+	runs   map[string]context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// serve reads requests from in until it ends, then waits for the running
+// executions to finish.
+func (s *jsonRPCRunner) serve(ctx context.Context, in io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.runs = make(map[string]context.CancelFunc)
+
+	r := bufio.NewReader(in)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			s.handle(ctx, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.wg.Wait()
+			return fmt.Errorf("reading requests: %w", err)
+		}
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *jsonRPCRunner) handle(ctx context.Context, line []byte) {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.writeError(nil, rpcParseError, "parse error: %v", err)
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.writeError(req.ID, rpcInvalidRequest, "invalid request")
+		return
+	}
+
+	switch req.Method {
+	case "execute":
+		var params rpcExecuteParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Name == "" {
+			s.writeError(req.ID, rpcInvalidParams, "execute requires params with a name")
+			return
+		}
+		timeout := s.timeout
+		if params.Timeout != "" {
+			d, err := time.ParseDuration(params.Timeout)
+			if err != nil || d <= 0 {
+				s.writeError(req.ID, rpcInvalidParams, "invalid timeout %q", params.Timeout)
+				return
+			}
+			timeout = d
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		if !s.track(req.ID, cancel) {
+			cancel()
+			s.writeError(req.ID, rpcInvalidRequest, "request %s is already running", req.ID)
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(req.ID)
+			s.execute(runCtx, req.ID, params, timeout)
+		}()
+	case "cancel":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ID) == 0 {
+			s.writeError(req.ID, rpcInvalidParams, "cancel requires params with the id of a request")
+			return
+		}
+		s.runsMu.Lock()
+		cancel, ok := s.runs[string(params.ID)]
+		s.runsMu.Unlock()
+		if ok {
+			cancel()
+		}
+		s.writeResult(req.ID, map[string]bool{"canceled": ok})
+	default:
+		s.writeError(req.ID, rpcMethodNotFound, "method not found: %s", req.Method)
+	}
+}
+
+// track records the cancel func of a running request, unless a request
+// with its id is already running. Requests without ids are not tracked.
+func (s *jsonRPCRunner) track(id json.RawMessage, cancel context.CancelFunc) bool {
+	if len(id) == 0 {
+		return true
+	}
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	if _, ok := s.runs[string(id)]; ok {
+		return false
+	}
+	s.runs[string(id)] = cancel
+	return true
+}
+
+func (s *jsonRPCRunner) untrack(id json.RawMessage) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	if cancel, ok := s.runs[string(id)]; ok {
+		cancel()
+		delete(s.runs, string(id))
+	}
+}
+
+func (s *jsonRPCRunner) execute(ctx context.Context, id json.RawMessage, params rpcExecuteParams, timeout time.Duration) {
+	typ := params.Type
+	if typ == "" {
+		if typ = detectEntityType(s.ws, params.Name); typ == "" {
+			s.writeError(id, rpcExecutionError, "entity %q not found", params.Name)
+			return
+		}
+	}
+
+	opts := []runtime.ExecuteOption{runtime.WithTimeout(timeout)}
+	if params.Input != nil {
+		opts = append(opts, runtime.WithInput(params.Input))
+	}
+	if params.Params != nil {
+		opts = append(opts, runtime.WithParams(params.Params))
+	}
+	for key, value := range params.Metadata {
+		opts = append(opts, runtime.WithMetadata(key, value))
+	}
+	if s.stream {
+		opts = append(opts, runtime.WithStreamHandler(&rpcStreamHandler{runner: s, id: id}))
+	}
+
+	result, err := s.rt.ExecuteByName(ctx, typ, params.Name, opts...)
+	if result == nil {
+		if err == nil {
+			err = errors.New("execution returned no result")
+		}
+		s.writeError(id, rpcExecutionError, "%v", err)
+		return
+	}
+	s.writeResult(id, newRPCExecuteResult(result, err))
+}
+
+// newRPCExecuteResult converts the result of an execution that ran, with
+// its steps in the order they started.
+func newRPCExecuteResult(result *runtime.ExecutionResult, err error) *rpcExecuteResult {
+	res := &rpcExecuteResult{
+		Success:    result.Success && err == nil,
+		Output:     result.Output,
+		DurationMS: result.Duration.Milliseconds(),
+		TokensUsed: result.TokensUsed,
+		Metadata:   result.Metadata,
+		RunID:      result.RunID,
+	}
+	if err == nil {
+		err = result.Error
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	steps := make([]*runtime.StepResult, 0, len(result.StepResults))
+	for _, step := range result.StepResults {
+		steps = append(steps, step)
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		if !steps[i].StartTime.Equal(steps[j].StartTime) {
+			return steps[i].StartTime.Before(steps[j].StartTime)
+		}
+		return steps[i].Name < steps[j].Name
+	})
+	for _, step := range steps {
+		sr := rpcStepResult{
+			Name:       step.Name,
+			Success:    step.Success,
+			Status:     string(step.Status),
+			Output:     step.Output,
+			DurationMS: step.Duration.Milliseconds(),
+			Model:      step.Model,
+			TokensUsed: step.TokensUsed,
+		}
+		if step.Error != nil {
+			sr.Error = step.Error.Error()
+		}
+		res.Steps = append(res.Steps, sr)
+	}
+	return res
+}
+
+func (s *jsonRPCRunner) writeResult(id json.RawMessage, result interface{}) {
+	if len(id) == 0 {
+		return // A notification gets no response
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *jsonRPCRunner) writeError(id json.RawMessage, code int, format string, args ...interface{}) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}})
+}
+
+func (s *jsonRPCRunner) notify(method string, params interface{}) {
+	s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *jsonRPCRunner) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcExecutionError, Message: err.Error()}})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkPrint(s.out.Write(append(data, '\n')))
+}
+
+// rpcStreamHandler sends the chunks and progress of a request as
+// notifications. Parallel steps call it concurrently.
+type rpcStreamHandler struct {
+	runner *jsonRPCRunner
+	id     json.RawMessage
+}
+
+func (h *rpcStreamHandler) OnChunk(chunk runtime.StreamChunk) {
+	h.runner.notify("execute/chunk", struct {
+		ID json.RawMessage `json:"id"`
+		runtime.StreamChunk
+	}{h.id, chunk})
+}
+
+func (h *rpcStreamHandler) OnProgress(event runtime.ProgressEvent) {
+	h.runner.notify("execute/progress", struct {
+		ID json.RawMessage `json:"id"`
+		runtime.ProgressEvent
+	}{h.id, event})
+}
+
+func (h *rpcStreamHandler) OnComplete(*runtime.CompletionResponse) {}
+
+func (h *rpcStreamHandler) OnError(error) {}
@@ -3,21 +3,38 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/shellkjell/langspace/pkg/ast"
 	"github.com/shellkjell/langspace/pkg/compile"
+	"github.com/shellkjell/langspace/pkg/compile/docker"
 	_ "github.com/shellkjell/langspace/pkg/compile/python"     // Register Python compiler
 	_ "github.com/shellkjell/langspace/pkg/compile/typescript" // Register TypeScript compiler
+	"github.com/shellkjell/langspace/pkg/dap"
+	"github.com/shellkjell/langspace/pkg/doc"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/lsp"
 	"github.com/shellkjell/langspace/pkg/parser"
 	"github.com/shellkjell/langspace/pkg/runtime"
+	grpcapi "github.com/shellkjell/langspace/pkg/server/grpc"
 	"github.com/shellkjell/langspace/pkg/workspace"
 )
 
@@ -49,8 +66,32 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		err = runServe(commandArgs, stdin, stdout, stderr)
 	case "lsp":
 		err = runLSP(commandArgs, stdin, stdout, stderr)
+	case "dap":
+		err = runDAP(commandArgs, stdin, stdout)
 	case "validate":
 		err = runValidate(commandArgs, stdin, stdout)
+	case "analyze":
+		err = runAnalyze(commandArgs, stdout)
+	case "diff":
+		err = runDiff(commandArgs, stdout)
+	case "explain":
+		err = runExplain(commandArgs, stdout)
+	case "rename":
+		err = runRename(commandArgs, stdout)
+	case "prune":
+		err = runPrune(commandArgs, stdout)
+	case "graph":
+		err = runGraph(commandArgs, stdout)
+	case "doc":
+		err = runDoc(commandArgs, stdout)
+	case "publish":
+		err = runPublish(commandArgs, stdout)
+	case "package":
+		err = runPackage(commandArgs, stdout)
+	case "eval":
+		err = runEval(commandArgs, stdout, stderr)
+	case "install":
+		err = runInstall(commandArgs, stdout)
 	case "help", "-h", "--help":
 		return showHelp(stdout)
 	case "version":
@@ -60,7 +101,7 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	}
 
 	if err != nil {
-		checkPrint(fmt.Fprintf(stderr, "Error: %v\n", err))
+		checkPrint(fmt.Fprintf(stderr, "Error: %s\n", i18n.Localize(err, i18n.FromEnv())))
 		return err
 	}
 	return nil
@@ -75,9 +116,22 @@ Usage:
 Commands:
   parse     Parse a LangSpace file and display entities
   run       Execute an intent or pipeline
-  compile   Compile to target language (python, typescript)
+  compile   Compile to target language (python, typescript, docker)
   validate  Validate a LangSpace file without executing
+  eval      Run eval cases against an intent or pipeline and report pass rates
+  analyze   Report likely duplicate agents with merge suggestions
+  diff      Show how execution plans change between two versions of a file
+  explain   Explain why a recorded run failed
+  rename    Rename an entity or step and every reference to it
+  prune     Remove entities that no pipeline, intent, or trigger uses
+  graph     Export pipelines and entities as a DOT or Mermaid diagram
+  doc       Generate Markdown or HTML documentation of agents, tools, and pipelines
+  publish   Publish a named version of a pipeline or intent for triggers to pin,
+            or a package of a file to a registry
+  install   Install packages from a registry
+  package   Bundle a file, its imports, and pinned versions into one .lsbundle
   serve     Start trigger server
+  dap       Debug pipelines from an editor over the Debug Adapter Protocol
 
 Options:
   -h, --help     Show this help message
@@ -85,9 +139,29 @@ Options:
 
 Examples:
   langspace parse -file workflow.ls
+  langspace parse -file workflow.ls -tag code
   langspace run -file workflow.ls -name my-intent
   langspace run -file workflow.ls -name my-pipeline -input "Review this code"
+  langspace run -file workflow.ls -name review-module -param module=pkg/parser
+  langspace run -file workflow.ls -name my-pipeline -profile prod
+  langspace run -file workflow.ls -tag nightly
+  langspace run -file workflow.ls -json-rpc
+  langspace run -file workflow.ls -name my-pipeline -input "draft" -debug -break write
   langspace validate -file workflow.ls
+  langspace validate -file workflow.ls -rules company-policy
+  langspace eval -file evals.ls -runs 5 -output report.json
+  langspace eval -file evals.ls -replay testdata/evals.json
+  langspace analyze -file workflow.ls -embed openai
+  langspace diff -old main.ls -new branch.ls -input "Review this code"
+  langspace explain -run 20250101T120000-1a2b3c4d
+  langspace rename -file workflow.ls -type agent -from writer -to author -write
+  langspace prune -file workflow.ls -dry-run
+  langspace graph -file workflow.ls -format mermaid
+  langspace doc -file workflow.ls -format html -output docs.html
+  langspace publish -file triggers.ls -name review -version v3
+  langspace package -file triggers.ls -output triggers.lsbundle
+  langspace publish acme/review@1.2.0 -file review.ls -registry https://registry.example.com
+  langspace install acme/review@^1.2.0
 
 For more information, visit: https://github.com/shellkjell/langspace
 `
@@ -96,7 +170,7 @@ For more information, visit: https://github.com/shellkjell/langspace
 }
 
 func showVersion(w io.Writer) error {
-	checkPrint(fmt.Fprintln(w, "langspace version 0.1.0"))
+	checkPrint(fmt.Fprintln(w, "langspace version", workspace.Version))
 	return nil
 }
 
@@ -105,6 +179,7 @@ func runParse(args []string, stdin io.Reader, stdout io.Writer) error {
 	fs := flag.NewFlagSet("parse", flag.ContinueOnError)
 	inputFile := fs.String("file", "", "Input file to parse")
 	showJSON := fs.Bool("json", false, "Output as JSON")
+	tag := fs.String("tag", "", "Only include entities with this tag")
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
@@ -140,6 +215,11 @@ func runParse(args []string, stdin io.Reader, stdout io.Writer) error {
 				return fmt.Errorf("failed to add entity %q: %w", entity.Name(), err)
 			}
 		}
+		if *tag != "" {
+			if ws, err = taggedWorkspace(ws, *tag); err != nil {
+				return err
+			}
+		}
 
 		if *showJSON {
 			return outputJSON(stdout, ws)
@@ -153,6 +233,12 @@ func runParse(args []string, stdin io.Reader, stdout io.Writer) error {
 	if err := l.Load(*inputFile); err != nil {
 		return fmt.Errorf("reading input: %w", err)
 	}
+	if *tag != "" {
+		var err error
+		if ws, err = taggedWorkspace(ws, *tag); err != nil {
+			return err
+		}
+	}
 
 	if *showJSON {
 		return outputJSON(stdout, ws)
@@ -163,6 +249,18 @@ func runParse(args []string, stdin io.Reader, stdout io.Writer) error {
 	return nil
 }
 
+// taggedWorkspace returns a workspace of the entities of ws with a tag,
+// without relationships.
+func taggedWorkspace(ws *workspace.Workspace, tag string) (*workspace.Workspace, error) {
+	tagged := workspace.New()
+	for _, entity := range ws.GetEntitiesByTag(tag) {
+		if err := tagged.AddEntity(entity); err != nil {
+			return nil, fmt.Errorf("failed to add entity %q: %w", entity.Name(), err)
+		}
+	}
+	return tagged, nil
+}
+
 // runExecute handles the run command
 func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	fs := flag.NewFlagSet("run", flag.ContinueOnError)
@@ -174,6 +272,44 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 	timeout := fs.Duration("timeout", 5*time.Minute, "Execution timeout")
 	noStream := fs.Bool("no-stream", false, "Disable streaming output")
 	verbose := fs.Bool("verbose", false, "Show verbose output")
+	noCache := fs.Bool("no-cache", false, "Run every step, ignoring cached step results")
+	deterministic := fs.Bool("deterministic", false, "Run at temperature 0 with a fixed seed where supported, and report what may still vary")
+	contextStrategy := fs.String("context-strategy", "", "Fit file() inputs too large for the model's context window: head, tail, or summarize (default: send them whole)")
+	summaryAgent := fs.String("summary-agent", "", "Agent that summarizes file() inputs with -context-strategy summarize (default: the agent of the intent or step)")
+	noMatrix := fs.Bool("no-matrix", false, "Run a pipeline with a matrix once, ignoring the matrix")
+	debug := fs.Bool("debug", false, "Pause before each step of the pipeline to inspect and edit its state, step, or skip (runs a matrix pipeline once, with no timeout unless -timeout is set)")
+	var breakpoints []string
+	fs.Func("break", "Step to pause at with -debug, repeatable (default: the first step)", func(s string) error {
+		breakpoints = append(breakpoints, s)
+		return nil
+	})
+	tag := fs.String("tag", "", "Run every intent and pipeline with this tag, one after another, instead of -name")
+	jsonRPC := fs.Bool("json-rpc", false, "Read execute requests as JSON-RPC from stdin and write results and stream events to stdout, instead of running -name")
+	cacheDir := fs.String("cache-dir", "", "Directory for cached step results (default: user cache directory)")
+	snapshotDir := fs.String("snapshot-dir", "", "Directory to save step snapshots of pipelines that set snapshot: true")
+	noHistory := fs.Bool("no-history", false, "Do not record the run for langspace explain")
+	historyDir := fs.String("history-dir", "", "Directory for recorded runs (default: user cache directory)")
+	locale := fs.String("locale", "", "Locale for dates, numbers, and translate() (overrides the config entity, e.g. de-DE)")
+	workdirRoot := fs.String("workdir-root", "", "Directory to create the run's working directory in (default: system temp directory)")
+	keepWorkdir := fs.String("keep-workdir", "never", "Keep the run's working directory: never, on_failure, or always")
+	otlpEndpoint := fs.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export traces to (e.g. http://localhost:4318)")
+	record := fs.String("record", "", "Record the run's model calls to this cassette file")
+	replay := fs.String("replay", "", "Answer the run's model calls from this cassette file, without calling providers")
+	var logLevel slog.Level
+	fs.TextVar(&logLevel, "log-level", slog.LevelInfo, "Least severe log entries to write to stderr: debug, info, warn, or error")
+	profile := fs.String("profile", os.Getenv("LANGSPACE_PROFILE"), "Profile whose overlays to apply, e.g. prod (default: $LANGSPACE_PROFILE)")
+	var params map[string]interface{}
+	fs.Func("param", "Parameter as name=value, repeatable; the value is parsed as JSON if it is valid JSON", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("expected name=value, got %q", s)
+		}
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+		params[name] = parseParamValue(value)
+		return nil
+	})
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
@@ -183,20 +319,23 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 		return fmt.Errorf("required flag -file not provided")
 	}
 
-	if *entityName == "" {
+	if *entityName == "" && !*jsonRPC && *tag == "" {
 		return fmt.Errorf("required flag -name not provided")
 	}
+	if *tag != "" && (*entityName != "" || *jsonRPC || *debug) {
+		return fmt.Errorf("-tag cannot be combined with -name, -json-rpc, or -debug")
+	}
 
 	// Load file and its imports
 
 	ws := workspace.New()
-	l := workspace.NewLoader(ws)
+	l := workspace.NewLoader(ws).WithProfile(*profile)
 	if err := l.Load(*inputFile); err != nil {
 		return err
 	}
 
 	// Determine entity type if not specified
-	if *entityType == "" {
+	if *entityType == "" && !*jsonRPC && *tag == "" {
 		*entityType = detectEntityType(ws, *entityName)
 		if *entityType == "" {
 			return fmt.Errorf("entity %q not found. Specify -type to search by type", *entityName)
@@ -215,17 +354,143 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 		input = string(data)
 	}
 
+	retain, err := runtime.ParseWorkDirRetention(*keepWorkdir)
+	if err != nil {
+		return err
+	}
+
 	// Create runtime
-	rt := runtime.New(ws, runtime.WithConfig(&runtime.Config{
+	rtOpts := []runtime.Option{runtime.WithConfig(&runtime.Config{
 		DefaultModel:    "claude-sonnet-4-20250514",
 		DefaultProvider: "anthropic",
 		Timeout:         *timeout,
 		EnableStreaming: !*noStream,
-	}))
+		Locale:          *locale,
+		WorkDirRoot:     *workdirRoot,
+		RetainWorkDir:   retain,
+		LogLevel:        logLevel,
+	}), runtime.WithLogger(runtime.NewLogger(stderr, logLevel))}
+
+	if *locale != "" {
+		if _, err := runtime.LookupLocale(*locale); err != nil {
+			return err
+		}
+	}
+
+	if *otlpEndpoint != "" {
+		tp := runtime.NewOTLPTracerProvider(*otlpEndpoint)
+		defer shutdownTracing(tp, stderr)
+		rtOpts = append(rtOpts, runtime.WithTracerProvider(tp))
+	}
+
+	// Steps with a `cache` property reuse results from earlier runs
+	if !*noCache {
+		dir := *cacheDir
+		if dir == "" {
+			var err error
+			if dir, err = runtime.DefaultStepCacheDir(); err != nil {
+				return err
+			}
+		}
+		cache, err := runtime.NewDiskStepCache(dir)
+		if err != nil {
+			return err
+		}
+		rtOpts = append(rtOpts, runtime.WithStepCache(cache))
+	}
+
+	if *deterministic {
+		rtOpts = append(rtOpts, runtime.WithDeterministic())
+	}
+
+	switch strategy := runtime.ContextStrategy(*contextStrategy); strategy {
+	case "":
+	case runtime.ContextHead, runtime.ContextTail, runtime.ContextSummarize:
+		rtOpts = append(rtOpts, runtime.WithContextWindow(runtime.ContextWindowConfig{Strategy: strategy, SummaryAgent: *summaryAgent}))
+	default:
+		return fmt.Errorf("invalid -context-strategy %q: expected head, tail, or summarize", *contextStrategy)
+	}
+
+	if *snapshotDir != "" {
+		store, err := runtime.NewDiskSnapshotStore(*snapshotDir)
+		if err != nil {
+			return err
+		}
+		rtOpts = append(rtOpts, runtime.WithSnapshotStore(store))
+	}
+
+	cassette, err := openCassette(*record, *replay)
+	if err != nil {
+		return err
+	}
+	if cassette != nil {
+		defer saveCassette(cassette, stderr)
+		rtOpts = append(rtOpts, runtime.WithCassette(cassette))
+	}
+
+	// Record the run so a failure can be explained later
+	if !*noHistory {
+		history, err := openRunHistory(*historyDir)
+		if err != nil {
+			return err
+		}
+		rtOpts = append(rtOpts, runtime.WithRunHistory(history))
+	}
+
+	rt := runtime.New(ws, rtOpts...)
+	defer rt.Close()
 
 	// Register providers
 	rt.RegisterProvider("anthropic", runtime.NewAnthropicProvider())
 	rt.RegisterProvider("openai", runtime.NewOpenAIProvider())
+	rt.RegisterProvider("gemini", runtime.NewGeminiProvider())
+	rt.RegisterProvider("bedrock", runtime.NewBedrockProvider())
+	if err := rt.ConfigureProviders(); err != nil {
+		return fmt.Errorf("configuring providers: %w", err)
+	}
+	if err := checkAgents(rt); err != nil {
+		return err
+	}
+
+	if *jsonRPC {
+		runner := &jsonRPCRunner{rt: rt, ws: ws, timeout: *timeout, stream: !*noStream, out: stdout}
+		return runner.serve(context.Background(), stdin)
+	}
+
+	if *tag != "" {
+		var opts []runtime.ExecuteOption
+		if input != nil {
+			opts = append(opts, runtime.WithInput(input))
+		}
+		if params != nil {
+			opts = append(opts, runtime.WithParams(params))
+		}
+		opts = append(opts, runtime.WithTimeout(*timeout))
+		return runTagged(context.Background(), rt, ws, *tag, *entityType, stdout, *verbose, opts...)
+	}
+
+	// A pipeline with a matrix runs once per combination
+	if pipeline, ok := ws.GetEntityByName("pipeline", *entityName); ok && *entityType == "pipeline" && !*noMatrix && !*debug {
+		if _, hasMatrix := pipeline.GetProperty("matrix"); hasMatrix {
+			var opts []runtime.ExecuteOption
+			if input != nil {
+				opts = append(opts, runtime.WithInput(input))
+			}
+			if params != nil {
+				opts = append(opts, runtime.WithParams(params))
+			}
+			opts = append(opts, runtime.WithTimeout(*timeout))
+			result, err := rt.ExecuteMatrix(context.Background(), pipeline, opts...)
+			if err != nil {
+				return fmt.Errorf("execution failed: %w", err)
+			}
+			printMatrixResult(stdout, result, *verbose)
+			if failed := len(result.Runs) - result.Succeeded(); failed > 0 {
+				return fmt.Errorf("%d of %d matrix runs failed", failed, len(result.Runs))
+			}
+			return nil
+		}
+	}
 
 	// Create stream handler for output
 	var handler runtime.StreamHandler
@@ -243,12 +508,44 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 	if input != nil {
 		opts = append(opts, runtime.WithInput(input))
 	}
+	if params != nil {
+		opts = append(opts, runtime.WithParams(params))
+	}
 	if handler != nil {
 		opts = append(opts, runtime.WithStreamHandler(handler))
 	}
+	if *debug {
+		// Time spent paused counts toward the timeout, so there is none
+		// unless asked for
+		timeoutSet := false
+		fs.Visit(func(f *flag.Flag) {
+			timeoutSet = timeoutSet || f.Name == "timeout"
+		})
+		if !timeoutSet {
+			*timeout = 0
+		}
+		session := runtime.NewDebugSession(breakpoints...)
+		if len(breakpoints) == 0 {
+			session.Pause()
+		}
+		console := &debugConsole{session: session, in: bufio.NewScanner(stdin), out: stdout}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			console.run()
+		}()
+		defer func() {
+			session.Close()
+			<-done
+		}()
+		opts = append(opts, runtime.WithDebugger(session))
+	}
 	opts = append(opts, runtime.WithTimeout(*timeout))
 
 	result, err := rt.ExecuteByName(ctx, *entityType, *entityName, opts...)
+	if result != nil && !result.Success && result.RunID != "" {
+		checkPrint(fmt.Fprintf(stderr, "Run ID: %s (see: langspace explain -run %s)\n", result.RunID, result.RunID))
+	}
 	if err != nil {
 		return fmt.Errorf("execution failed: %w", err)
 	}
@@ -263,7 +560,7 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 	} else if result.Output != nil && !*noStream {
 		// If not streaming, print the output now
 	} else if result.Output != nil {
-		checkPrint(fmt.Fprintf(stdout, "%v\n", result.Output))
+		checkPrint(fmt.Fprintln(stdout, formatOutput(result.Output)))
 	}
 
 	if !result.Success {
@@ -273,12 +570,168 @@ func runExecute(args []string, stdin io.Reader, stdout, stderr io.Writer) error
 	return nil
 }
 
+// runTagged runs every intent and pipeline with a tag, or only those of
+// entityType if it is set, and reports each and how many succeeded.
+func runTagged(ctx context.Context, rt *runtime.Runtime, ws *workspace.Workspace, tag, entityType string, w io.Writer, verbose bool, opts ...runtime.ExecuteOption) error {
+	var entities []ast.Entity
+	for _, entity := range ws.GetEntitiesByTag(tag) {
+		if entity.Type() == "intent" || entity.Type() == "pipeline" {
+			if entityType == "" || entity.Type() == entityType {
+				entities = append(entities, entity)
+			}
+		}
+	}
+	if len(entities) == 0 {
+		return fmt.Errorf("no intent or pipeline has tag %q", tag)
+	}
+
+	results := make([]*runtime.ExecutionResult, len(entities))
+	failed := 0
+	for i, entity := range entities {
+		checkPrint(fmt.Fprintf(w, "=== %s %q ===\n", entity.Type(), entity.Name()))
+		result, err := rt.Execute(ctx, entity, opts...)
+		if err != nil && result == nil {
+			result = &runtime.ExecutionResult{Error: err}
+		}
+		results[i] = result
+		if !result.Success {
+			failed++
+		}
+		switch {
+		case verbose || !result.Success:
+			printExecutionResult(w, result)
+		case result.Output != nil:
+			checkPrint(fmt.Fprintln(w, formatOutput(result.Output)))
+		}
+		checkPrint(fmt.Fprintln(w))
+	}
+
+	checkPrint(fmt.Fprintf(w, "--- Tag %q: %d of %d runs succeeded ---\n", tag, len(entities)-failed, len(entities)))
+	for i, entity := range entities {
+		status := "ok"
+		if !results[i].Success {
+			status = "failed"
+		}
+		checkPrint(fmt.Fprintf(w, "  %-6s %s %q (%s)\n", status, entity.Type(), entity.Name(), results[i].Duration))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tagged runs failed", failed, len(entities))
+	}
+	return nil
+}
+
+// openRunHistory opens the run history in dir, or in the default directory
+// if dir is empty.
+func openRunHistory(dir string) (*runtime.DiskRunHistory, error) {
+	if dir == "" {
+		var err error
+		if dir, err = runtime.DefaultRunHistoryDir(); err != nil {
+			return nil, err
+		}
+	}
+	return runtime.NewDiskRunHistory(dir)
+}
+
+// runExplain handles the explain command
+func runExplain(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	runID := fs.String("run", "", "ID of the run to explain (printed when a run fails)")
+	historyDir := fs.String("history-dir", "", "Directory for recorded runs (default: user cache directory)")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *runID == "" {
+		return fmt.Errorf("required flag -run not provided")
+	}
+
+	history, err := openRunHistory(*historyDir)
+	if err != nil {
+		return err
+	}
+	run, err := history.Get(*runID)
+	if err != nil {
+		return err
+	}
+
+	printExplanation(stdout, run)
+	return nil
+}
+
+// printExplanation prints why a recorded run failed.
+func printExplanation(w io.Writer, run *runtime.RunRecord) {
+	checkPrint(fmt.Fprintf(w, "Run %s: %s %q at %s (%s)\n",
+		run.ID, run.EntityType, run.EntityName, run.Time.Local().Format(time.RFC3339), run.Duration.Round(time.Millisecond)))
+
+	e := runtime.Explain(run)
+	if e == nil {
+		checkPrint(fmt.Fprintln(w, "The run succeeded; there is no failure to explain."))
+		return
+	}
+
+	if e.Step != nil {
+		checkPrint(fmt.Fprintf(w, "\nFailed at step %q", e.Step.Name))
+		if e.Step.Model != "" {
+			checkPrint(fmt.Fprintf(w, " (model %s)", e.Step.Model))
+		}
+		checkPrint(fmt.Fprintln(w))
+	} else {
+		checkPrint(fmt.Fprintln(w, "\nFailed before any step ran"))
+	}
+
+	checkPrint(fmt.Fprintf(w, "\nError: %s\n", e.Error))
+	if e.StatusCode != 0 {
+		checkPrint(fmt.Fprintf(w, "Provider status: %d\n", e.StatusCode))
+	}
+	if e.ErrorClass != "" {
+		checkPrint(fmt.Fprintf(w, "Error class: %s\n", e.ErrorClass))
+	}
+	if e.Step != nil {
+		if e.Retries > 0 {
+			checkPrint(fmt.Fprintf(w, "Retries: %d\n", e.Retries))
+		} else {
+			checkPrint(fmt.Fprintln(w, "Retries: none"))
+		}
+	}
+
+	if len(run.Steps) > 0 {
+		checkPrint(fmt.Fprintln(w, "\nSteps:"))
+		for _, step := range run.Steps {
+			status := "ok"
+			switch {
+			case step.Cached:
+				status = "ok (cached)"
+			case !step.Success:
+				status = "failed"
+			}
+			checkPrint(fmt.Fprintf(w, "  %s: %s, %s\n", step.Name, status, step.Duration.Round(time.Millisecond)))
+		}
+	}
+
+	if e.Step != nil && e.Step.Input != "" {
+		checkPrint(fmt.Fprintf(w, "\nResolved input to %q:\n", e.Step.Name))
+		for _, line := range strings.Split(strings.TrimRight(e.Step.Input, "\n"), "\n") {
+			checkPrint(fmt.Fprintf(w, "  | %s\n", line))
+		}
+	} else if run.Input != nil {
+		checkPrint(fmt.Fprintf(w, "\nInput: %v\n", run.Input))
+	}
+
+	checkPrint(fmt.Fprintln(w, "\nSuggestions:"))
+	for _, s := range e.Suggestions {
+		checkPrint(fmt.Fprintf(w, "  - %s\n", s))
+	}
+}
+
 // runCompile handles the compile command
 func runCompile(args []string, stdout io.Writer) error {
 	fs := flag.NewFlagSet("compile", flag.ContinueOnError)
 	inputFile := fs.String("file", "", "LangSpace file to compile")
-	target := fs.String("target", "python", "Target language (python, typescript)")
+	target := fs.String("target", "python", "Target language (python, typescript, docker)")
+	base := fs.String("base", "python", "What the docker target's image runs (python, typescript, langspace)")
 	outputDir := fs.String("output", ".", "Output directory for generated files")
+	profile := fs.String("profile", os.Getenv("LANGSPACE_PROFILE"), "Profile whose overlays to apply, e.g. prod (default: $LANGSPACE_PROFILE)")
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
@@ -290,15 +743,25 @@ func runCompile(args []string, stdout io.Writer) error {
 
 	// Load file and its imports
 	ws := workspace.New()
-	l := workspace.NewLoader(ws)
+	l := workspace.NewLoader(ws).WithProfile(*profile)
 	if err := l.Load(*inputFile); err != nil {
 		return err
 	}
 
 	// Get compiler for target
-	compiler, err := compile.Get(compile.Target(*target))
-	if err != nil {
-		return fmt.Errorf("getting compiler: %w", err)
+	var compiler compile.Compiler
+	if compile.Target(*target) == compile.TargetDocker {
+		gen, err := newDockerGenerator(compile.Target(*base), *inputFile, l.Files())
+		if err != nil {
+			return err
+		}
+		compiler = gen
+	} else {
+		var err error
+		compiler, err = compile.Get(compile.Target(*target))
+		if err != nil {
+			return fmt.Errorf("getting compiler: %w", err)
+		}
 	}
 
 	// Compile
@@ -313,7 +776,10 @@ func runCompile(args []string, stdout io.Writer) error {
 	}
 
 	for filename, content := range output.Files {
-		outPath := filepath.Join(*outputDir, filename)
+		outPath := filepath.Join(*outputDir, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
 		if err := os.WriteFile(outPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("writing %s: %w", filename, err)
 		}
@@ -324,10 +790,42 @@ func runCompile(args []string, stdout io.Writer) error {
 	return nil
 }
 
+// newDockerGenerator creates the docker compiler for base. An image that
+// runs langspace itself gets a copy of the input file and its imports, which
+// must be in the input file's directory or below it.
+func newDockerGenerator(base compile.Target, inputFile string, files []string) (*docker.Generator, error) {
+	gen := &docker.Generator{Base: base}
+	if base != docker.BaseLangSpace {
+		return gen, nil
+	}
+
+	absInput, err := filepath.Abs(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("getting absolute path for %s: %w", inputFile, err)
+	}
+	dir := filepath.Dir(absInput)
+	gen.Entry = filepath.Base(absInput)
+	gen.Sources = make(map[string]string, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("import %s is outside %s and cannot be copied into the image", file, dir)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		gen.Sources[filepath.ToSlash(rel)] = string(content)
+	}
+	return gen, nil
+}
+
 // runValidate handles the validate command
 func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
 	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
 	inputFile := fs.String("file", "", "LangSpace file to validate")
+	profile := fs.String("profile", os.Getenv("LANGSPACE_PROFILE"), "Profile whose overlays to apply, e.g. prod (default: $LANGSPACE_PROFILE)")
+	rules := fs.String("rules", "", "Comma-separated registered rule sets to check, e.g. company-policy")
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
@@ -337,23 +835,66 @@ func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
 		return fmt.Errorf("required flag -file not provided")
 	}
 
+	var ruleSets []string
+	for _, name := range strings.Split(*rules, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ruleSets = append(ruleSets, name)
+		}
+	}
+
 	ws := workspace.New()
-	l := workspace.NewLoader(ws)
+	l := workspace.NewLoader(ws).WithProfile(*profile)
 	if err := l.Load(*inputFile); err != nil {
 		return err
 	}
 
+	if _, err := runtime.ConfigFromWorkspace(ws); err != nil {
+		return err
+	}
+
 	// For validation, we might want to still show ParseWithRecovery errors from the main file,
 	// but Loader already parsed it. Let's just output success for now if Loader succeeds.
+	for _, w := range ws.ValidateToolUsage() {
+		if !l.Ignored(w.EntityType, w.EntityName, w.Line, w.Column, w.Code) {
+			checkPrint(fmt.Fprintf(stdout, "warning: %s\n", w))
+		}
+	}
+
+	var errs []i18n.Localizer
+	for _, e := range ws.ValidateSemantics() {
+		if !l.Ignored(e.EntityType, e.EntityName, e.Line, e.Column, e.Code) {
+			errs = append(errs, e)
+		}
+	}
+	if len(ruleSets) > 0 {
+		ruleErrs, err := ws.ValidateRules(ruleSets...)
+		if err != nil {
+			return err
+		}
+		for _, e := range ruleErrs {
+			if !l.Ignored(e.EntityType, e.EntityName, e.Line, e.Column, e.Code) {
+				errs = append(errs, e)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		lang := i18n.FromEnv()
+		for _, e := range errs {
+			checkPrint(fmt.Fprintf(stdout, "error: %s\n", e.Localize(lang)))
+		}
+		return fmt.Errorf("validation failed: %d errors", len(errs))
+	}
+
 	checkPrint(fmt.Fprintf(stdout, "Validation successful: %d entities loaded (including imports)\n", len(ws.GetEntities())))
 	return nil
 }
 
-// runServe handles the serve command
-func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
-	inputFile := fs.String("file", "", "LangSpace file to serve")
-	port := fs.Int("port", 8080, "Port to listen on")
+// runAnalyze handles the analyze command
+func runAnalyze(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to analyze")
+	threshold := fs.Float64("threshold", workspace.DefaultDuplicateThreshold, "Similarity (0-1) above which agents are reported as duplicates")
+	embed := fs.String("embed", "", "Embedding provider for instruction similarity (openai, local); word overlap if empty")
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
@@ -363,98 +904,1222 @@ func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		return fmt.Errorf("required flag -file not provided")
 	}
 
-	// Load file and its imports
 	ws := workspace.New()
 	l := workspace.NewLoader(ws)
 	if err := l.Load(*inputFile); err != nil {
 		return err
 	}
 
-	// Create runtime
-	rt := runtime.New(ws)
-	rt.RegisterProvider("anthropic", runtime.NewAnthropicProvider())
-	rt.RegisterProvider("openai", runtime.NewOpenAIProvider())
+	switch *embed {
+	case "":
+	case "openai":
+		ws.WithEmbedder(runtime.NewOpenAIProvider())
+	case "local":
+		ws.WithEmbedder(runtime.NewLocalProvider(""))
+	default:
+		return fmt.Errorf("unknown embedding provider %q (use openai or local)", *embed)
+	}
 
-	// Start trigger engine
-	engine := runtime.NewTriggerEngine(rt)
-	if err := engine.Start(context.Background()); err != nil {
-		return fmt.Errorf("failed to start trigger engine: %w", err)
+	groups, err := ws.FindDuplicateAgents(context.Background(), *threshold)
+	if err != nil {
+		return err
 	}
 
-	checkPrint(fmt.Fprintf(stdout, "LangSpace server listening on port %d...\n", *port))
-	checkPrint(fmt.Fprintf(stdout, "Trigger engine active with %d triggers\n", len(ws.GetEntitiesByType("trigger"))))
+	if len(groups) == 0 {
+		checkPrint(fmt.Fprintf(stdout, "No likely duplicate agents found (%d agents analyzed)\n", len(ws.GetEntitiesByType("agent"))))
+		return nil
+	}
 
-	// Keep running until interrupted
-	select {}
+	checkPrint(fmt.Fprintf(stdout, "Found %d group(s) of likely duplicate agents:\n", len(groups)))
+	for _, g := range groups {
+		checkPrint(fmt.Fprintf(stdout, "\n  %s (similarity %.2f)\n", strings.Join(g.Agents, ", "), g.Similarity))
+		checkPrint(fmt.Fprintf(stdout, "    suggestion: %s\n", g.Suggestion()))
+	}
+	return nil
 }
 
-// runLSP handles the lsp command
-func runLSP(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+// runRename handles the rename command: it renames an entity or step in a
+// file and the files it imports, printing the edits or, with -write, making
+// them.
+func runRename(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to refactor")
+	entityType := fs.String("type", "", "Type of the entity to rename (agent, tool, pipeline, step, ...)")
+	from := fs.String("from", "", "Current name")
+	to := fs.String("to", "", "New name")
+	write := fs.Bool("write", false, "Write the changes instead of printing them")
+
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parsing flags: %w", err)
 	}
 
-	server := lsp.NewServer()
-	return server.Start()
-}
-
-// detectEntityType tries to find an entity by name and returns its type
-func detectEntityType(ws *workspace.Workspace, name string) string {
-	// Try common types in order of likelihood
-	for _, typ := range []string{"intent", "pipeline", "agent", "tool"} {
-		if _, found := ws.GetEntityByName(typ, name); found {
-			return typ
+	for _, f := range []struct{ name, value string }{{"file", *inputFile}, {"type", *entityType}, {"from", *from}, {"to", *to}} {
+		if f.value == "" {
+			return fmt.Errorf("required flag -%s not provided", f.name)
 		}
 	}
-	return ""
-}
-
-// printStats outputs workspace statistics
-func printStats(w io.Writer, stats workspace.WorkspaceStats, entityCount int) {
-	checkPrint(fmt.Fprintln(w, "Workspace statistics:"))
-	checkPrint(fmt.Fprintf(w, "  Number of entities: %d\n", stats.TotalEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of file entities: %d\n", stats.FileEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of agent entities: %d\n", stats.AgentEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of tool entities: %d\n", stats.ToolEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of intent entities: %d\n", stats.IntentEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of pipeline entities: %d\n", stats.PipelineEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of script entities: %d\n", stats.ScriptEntities))
-	checkPrint(fmt.Fprintf(w, "  Number of relationships: %d\n", stats.TotalRelationships))
-	checkPrint(fmt.Fprintf(w, "  Number of hooks: %d\n", stats.TotalHooks))
-	checkPrint(fmt.Fprintf(w, "Successfully processed entities: %d\n", entityCount))
-}
 
-// outputJSON outputs the workspace as JSON
-func outputJSON(w io.Writer, ws *workspace.Workspace) error {
-	return ws.SaveTo(w)
-}
+	ws := workspace.New()
+	l := workspace.NewLoader(ws)
+	if err := l.Load(*inputFile); err != nil {
+		return err
+	}
+	// Renaming in the workspace checks that the entity exists and that the
+	// new name is free
+	if err := ws.RenameEntity(*entityType, *from, *to); err != nil {
+		return err
+	}
 
-// printExecutionResult prints detailed execution result
-func printExecutionResult(w io.Writer, result *runtime.ExecutionResult) {
-	checkPrint(fmt.Fprintln(w, "\n--- Execution Result ---"))
-	checkPrint(fmt.Fprintf(w, "Success: %v\n", result.Success))
-	checkPrint(fmt.Fprintf(w, "Duration: %s\n", result.Duration))
-	checkPrint(fmt.Fprintf(w, "Tokens Used: %d (input: %d, output: %d)\n",
-		result.TokensUsed.TotalTokens,
-		result.TokensUsed.InputTokens,
-		result.TokensUsed.OutputTokens))
+	total := 0
+	for _, path := range l.Files() {
+		// Imported packages are renamed by their authors
+		if workspace.IsBundle(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		edits := workspace.RenameEdits(string(data), *entityType, *from, *to)
+		if len(edits) == 0 {
+			continue
+		}
+		total += len(edits)
 
-	if len(result.StepResults) > 0 {
-		checkPrint(fmt.Fprintln(w, "\nStep Results:"))
-		for name, step := range result.StepResults {
-			checkPrint(fmt.Fprintf(w, "  %s: success=%v, duration=%s\n", name, step.Success, step.Duration))
+		if !*write {
+			for _, e := range edits {
+				checkPrint(fmt.Fprintf(stdout, "%s:%d:%d: %s -> %s\n", path, e.Line, e.Column, e.OldText, e.NewText))
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(workspace.ApplyEdits(string(data), edits)), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
 		}
+		checkPrint(fmt.Fprintf(stdout, "Updated %s (%d edit(s))\n", path, len(edits)))
 	}
 
-	if result.Error != nil {
-		checkPrint(fmt.Fprintf(w, "\nError: %v\n", result.Error))
+	if total == 0 {
+		checkPrint(fmt.Fprintf(stdout, "No references to %s %q found in source\n", *entityType, *from))
 	}
+	return nil
+}
 
-	if result.Output != nil {
-		checkPrint(fmt.Fprintln(w, "\n--- Output ---"))
-		checkPrint(fmt.Fprintf(w, "%v\n", result.Output))
+// runPrune handles the prune command: it removes the declarations of
+// orphaned entities (see Workspace.FindOrphans) from a file and the files
+// it imports or, with -dry-run, lists them.
+func runPrune(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to clean up")
+	dryRun := fs.Bool("dry-run", false, "List the orphaned entities instead of removing them")
+	roots := fs.String("roots", strings.Join(workspace.DefaultOrphanRoots, ","), "Comma-separated entity types to keep, with everything they reference")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+
+	ws := workspace.New()
+	l := workspace.NewLoader(ws)
+	if err := l.Load(*inputFile); err != nil {
+		return err
+	}
+	var rootTypes []string
+	for _, t := range strings.Split(*roots, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			rootTypes = append(rootTypes, t)
+		}
+	}
+	orphans := ws.FindOrphans(workspace.WithOrphanRoots(rootTypes...))
+	if len(orphans) == 0 {
+		checkPrint(fmt.Fprintln(stdout, "No orphaned entities found"))
+		return nil
+	}
+
+	removed := make(map[ast.Entity]bool)
+	for _, path := range l.Files() {
+		// Imported packages are cleaned up by their authors
+		if workspace.IsBundle(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		doc := parser.NewDocument(string(data))
+		var edits []parser.Edit
+		for _, e := range orphans {
+			// Entities of namespaced imports are declared under other names
+			if _, namespaced := e.GetMetadata("namespace"); namespaced || removed[e] {
+				continue
+			}
+			start, end, ok := doc.Declaration(e.Type(), e.Name())
+			if !ok {
+				continue
+			}
+			removed[e] = true
+			edits = append(edits, parser.Edit{Start: start, End: end})
+			if *dryRun {
+				checkPrint(fmt.Fprintf(stdout, "%s: %s %q\n", path, e.Type(), e.Name()))
+			}
+		}
+		if *dryRun || len(edits) == 0 {
+			continue
+		}
+
+		// Later declarations first, so earlier offsets stay valid
+		sort.Slice(edits, func(i, j int) bool { return edits[i].Start > edits[j].Start })
+		if err := doc.Apply(edits...); err != nil {
+			return fmt.Errorf("failed to edit %s: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(doc.Text()), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		checkPrint(fmt.Fprintf(stdout, "Updated %s (removed %d entity(s))\n", path, len(edits)))
+	}
+
+	for _, e := range orphans {
+		if !removed[e] {
+			checkPrint(fmt.Fprintf(stdout, "Skipped %s %q: declared in a bundle or namespaced import\n", e.Type(), e.Name()))
+		}
+	}
+	return nil
+}
+
+// runGraph handles the graph command: it prints the workspace's pipelines,
+// steps, and entity dependencies as a Graphviz DOT or Mermaid diagram.
+func runGraph(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to diagram")
+	format := fs.String("format", "dot", "Output format (dot, mermaid)")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	if *format != "dot" && *format != "mermaid" {
+		return fmt.Errorf("unknown format %q (want dot or mermaid)", *format)
+	}
+
+	ws := workspace.New()
+	if err := workspace.NewLoader(ws).Load(*inputFile); err != nil {
+		return err
+	}
+
+	graph := ws.Graph()
+	if *format == "mermaid" {
+		checkPrint(fmt.Fprint(stdout, graph.Mermaid()))
+		return nil
+	}
+	checkPrint(fmt.Fprint(stdout, graph.DOT()))
+	return nil
+}
+
+// runDoc handles the doc command: it documents the entities of a file and
+// its imports.
+func runDoc(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("doc", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to document")
+	format := fs.String("format", "markdown", "Output format (markdown, html)")
+	output := fs.String("output", "", "File to write the documentation to (default: stdout)")
+	title := fs.String("title", "", "Title of the documentation (default: the file name)")
+	types := fs.String("types", strings.Join(doc.DefaultTypes, ","), "Comma-separated entity types to document, in order")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	if *format != "markdown" && *format != "html" {
+		return fmt.Errorf("unknown format %q (want markdown or html)", *format)
+	}
+
+	ws := workspace.New()
+	if err := workspace.NewLoader(ws).Load(*inputFile); err != nil {
+		return err
+	}
+
+	if *title == "" {
+		*title = filepath.Base(*inputFile)
+	}
+	var typeList []string
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			typeList = append(typeList, t)
+		}
+	}
+	d := doc.Generate(ws, doc.WithTitle(*title), doc.WithTypes(typeList...))
+	out := d.Markdown()
+	if *format == "html" {
+		out = d.HTML()
+	}
+
+	if *output == "" {
+		checkPrint(fmt.Fprint(stdout, out))
+		return nil
+	}
+	if err := os.WriteFile(*output, []byte(out), 0o644); err != nil {
+		return fmt.Errorf("writing documentation: %w", err)
+	}
+	checkPrint(fmt.Fprintf(stdout, "Documented %d entities in %s\n", d.Len(), *output))
+	return nil
+}
+
+// defaultVersionsDir is where publish saves published versions, and serve
+// and package load them from.
+const defaultVersionsDir = ".langspace/versions"
+
+// runPublish handles the publish command: it saves the current definition
+// of an entity as a named version, for triggers to pin with @version, or
+// lists the published versions without -version. Given a package such as
+// acme/review@1.2.0, it publishes a bundle of the file to a registry
+// instead.
+func runPublish(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file defining the entity")
+	entityType := fs.String("type", "pipeline", "Type of the entity to publish")
+	entityName := fs.String("name", "", "Name of the entity to publish")
+	version := fs.String("version", "", "Version to publish it as, e.g. v3 (default: list published versions)")
+	dir := fs.String("dir", defaultVersionsDir, "Directory published versions are kept in")
+	registry := fs.String("registry", os.Getenv("LANGSPACE_REGISTRY"), "URL of the package registry to publish packages to (default: $LANGSPACE_REGISTRY)")
+
+	refs, err := parseInterspersed(fs, args)
+	if err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+	switch len(refs) {
+	case 0:
+	case 1:
+		return publishPackage(stdout, *registry, refs[0], *inputFile, *dir)
+	default:
+		return fmt.Errorf("publish takes one package, got %d", len(refs))
+	}
+
+	if *entityName == "" {
+		return fmt.Errorf("required flag -name not provided")
+	}
+	store := workspace.NewVersionStore(*dir)
+
+	if *version == "" {
+		versions, err := store.Versions(*entityType, *entityName)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			checkPrint(fmt.Fprintf(stdout, "No published versions of %s %q\n", *entityType, *entityName))
+		}
+		for _, v := range versions {
+			checkPrint(fmt.Fprintln(stdout, v))
+		}
+		return nil
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	l := workspace.NewLoader(workspace.New())
+	if err := l.Load(*inputFile); err != nil {
+		return err
+	}
+	// The entity may be defined in an imported file, but not an imported
+	// bundle, which vendors the versions it pins
+	for _, path := range l.Files() {
+		if workspace.IsBundle(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		err = store.Publish(string(data), *entityType, *entityName, *version)
+		if i18n.CodeOf(err) == i18n.EntityNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		checkPrint(fmt.Fprintf(stdout, "Published %s %q as %s; pin it with %s(%q)@%s\n", *entityType, *entityName, *version, *entityType, *entityName, *version))
+		return nil
+	}
+	return i18n.New(i18n.EntityNotFound, *entityType, *entityName)
+}
+
+// runPackage handles the package command: it writes a file, everything it
+// imports, and the published versions it pins to a bundle that run and
+// serve load like the file itself.
+func runPackage(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("package", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to package")
+	output := fs.String("output", "", "Bundle to write (default: the file name with "+workspace.BundleExtension+")")
+	dir := fs.String("versions", defaultVersionsDir, "Directory of the published versions to vendor")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(*inputFile, filepath.Ext(*inputFile)) + workspace.BundleExtension
+	}
+
+	var buf bytes.Buffer
+	m, err := workspace.Package(&buf, *inputFile,
+		workspace.WithBundleVersions(workspace.NewVersionStore(*dir)),
+		workspace.WithModelProviders(runtime.DefaultModel, runtime.ModelProvider))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+
+	versions := 0
+	for _, e := range m.Entities {
+		versions += len(e.Versions)
+	}
+	checkPrint(fmt.Fprintf(stdout, "Packaged %d files, %d entities, and %d published versions into %s\n", len(m.Files), len(m.Entities), versions, *output))
+	if len(m.Providers) > 0 {
+		checkPrint(fmt.Fprintf(stdout, "Providers: %s\n", strings.Join(m.Providers, ", ")))
+	}
+	if len(m.Secrets) > 0 {
+		checkPrint(fmt.Fprintf(stdout, "Secrets: %s\n", strings.Join(m.Secrets, ", ")))
+	}
+	checkPrint(fmt.Fprintf(stdout, "Requires: langspace >= %s\n", m.Requires.Version))
+	return nil
+}
+
+// runDiff handles the diff command: it dry-runs intents and pipelines from two
+// versions of a file and reports how their execution plans differ.
+func runDiff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	oldFile := fs.String("old", "", "Original LangSpace file")
+	newFile := fs.String("new", "", "Changed LangSpace file")
+	entityName := fs.String("name", "", "Only compare this intent or pipeline")
+	inputData := fs.String("input", "", "Sample input for the dry run")
+	inputFile := fs.String("input-file", "", "File containing sample input")
+	jsonOutput := fs.Bool("json", false, "Output as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *oldFile == "" || *newFile == "" {
+		return fmt.Errorf("required flags -old and -new not provided")
+	}
+
+	var input interface{}
+	if *inputData != "" {
+		input = *inputData
+	} else if *inputFile != "" {
+		data, err := os.ReadFile(*inputFile)
+		if err != nil {
+			return fmt.Errorf("reading input file: %w", err)
+		}
+		input = string(data)
+	}
+
+	oldPlans, err := planFile(*oldFile, *entityName, input)
+	if err != nil {
+		return err
+	}
+	newPlans, err := planFile(*newFile, *entityName, input)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]bool)
+	for key := range oldPlans {
+		keys[key] = true
+	}
+	for key := range newPlans {
+		keys[key] = true
+	}
+	if *entityName != "" && len(keys) == 0 {
+		return fmt.Errorf("entity %q not found in either file", *entityName)
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	type entityDiff struct {
+		Entity string            `json:"entity"`
+		Diff   *runtime.PlanDiff `json:"diff"`
+	}
+	var diffs []entityDiff
+	for _, key := range sorted {
+		diffs = append(diffs, entityDiff{Entity: key, Diff: runtime.DiffPlans(oldPlans[key], newPlans[key])})
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+
+	for _, d := range diffs {
+		switch {
+		case oldPlans[d.Entity] == nil:
+			checkPrint(fmt.Fprintf(stdout, "%s: added", d.Entity))
+		case newPlans[d.Entity] == nil:
+			checkPrint(fmt.Fprintf(stdout, "%s: removed", d.Entity))
+		case d.Diff.Empty():
+			checkPrint(fmt.Fprintf(stdout, "%s: no plan changes\n", d.Entity))
+			continue
+		default:
+			checkPrint(fmt.Fprintf(stdout, "%s: changed", d.Entity))
+		}
+		checkPrint(fmt.Fprintf(stdout, " (est. cost $%.4f -> $%.4f, %+.4f; tokens %+d)\n",
+			d.Diff.OldCost, d.Diff.NewCost, d.Diff.CostDelta, d.Diff.TokenDelta))
+
+		for _, step := range d.Diff.Added {
+			checkPrint(fmt.Fprintf(stdout, "  + step %q (agent %q, model %s)\n", step.Name, step.Agent, step.Model))
+		}
+		for _, step := range d.Diff.Removed {
+			checkPrint(fmt.Fprintf(stdout, "  - step %q (agent %q, model %s)\n", step.Name, step.Agent, step.Model))
+		}
+		for _, change := range d.Diff.Changed {
+			checkPrint(fmt.Fprintf(stdout, "  ~ step %q (est. cost %+.4f)\n", change.Name, change.CostDelta))
+			for _, c := range change.Changes {
+				checkPrint(fmt.Fprintf(stdout, "      %s\n", c))
+			}
+			for _, line := range change.SystemPromptDiff {
+				checkPrint(fmt.Fprintf(stdout, "      system %s\n", line))
+			}
+			for _, line := range change.PromptDiff {
+				checkPrint(fmt.Fprintf(stdout, "      prompt %s\n", line))
+			}
+		}
+	}
+	return nil
+}
+
+// planFile loads a file and dry-runs its intents and pipelines (or only the
+// named one), keyed by "type/name".
+func planFile(path, name string, input interface{}) (map[string]*runtime.ExecutionPlan, error) {
+	ws := workspace.New()
+	l := workspace.NewLoader(ws)
+	if err := l.Load(path); err != nil {
+		return nil, err
+	}
+
+	rt := runtime.New(ws)
+	plans := make(map[string]*runtime.ExecutionPlan)
+	for _, typ := range []string{"intent", "pipeline"} {
+		for _, entity := range ws.GetEntitiesByType(typ) {
+			if name != "" && entity.Name() != name {
+				continue
+			}
+			plan, err := rt.Plan(context.Background(), entity, input)
+			if err != nil {
+				return nil, fmt.Errorf("planning %s %q in %s: %w", typ, entity.Name(), path, err)
+			}
+			plans[typ+"/"+entity.Name()] = plan
+		}
+	}
+	return plans, nil
+}
+
+// runServe handles the serve command
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	inputFile := fs.String("file", "", "LangSpace file to serve")
+	port := fs.Int("port", 8080, "Port to listen on")
+	grpcPort := fs.Int("grpc-port", 0, "Port to serve the gRPC API on (default: no gRPC API)")
+	tokensFile := fs.String("tokens", "", "JSON file mapping API bearer tokens to the users and teams they act as, for entities with owners (default: callers act as no one)")
+	canaryFile := fs.String("canary", "", "New version of the file to roll out to a share of trigger firings")
+	canaryPercent := fs.Float64("canary-percent", 10, "Percentage (0-100) of trigger firings sent to the canary")
+	standbyFile := fs.String("standby", "", "New version of the file to load side by side with no traffic, for switching via /rollout/switch")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "How long to wait for running triggers on shutdown")
+	snapshotDir := fs.String("snapshot-dir", "", "Directory to save step snapshots of pipelines that set snapshot: true")
+	versionsDir := fs.String("versions", defaultVersionsDir, "Directory of published versions that triggers pin with @version (see publish)")
+	watch := fs.Bool("watch", false, "Reload the file when it or its imports change")
+	workdirRoot := fs.String("workdir-root", "", "Directory to create each run's working directory in (default: system temp directory)")
+	keepWorkdir := fs.String("keep-workdir", "never", "Keep runs' working directories: never, on_failure, or always")
+	heartbeat := fs.Duration("heartbeat", 0, "Log a heartbeat for each trigger run at this interval (e.g. 30s; default: never)")
+	stallTimeout := fs.Duration("stall-timeout", 0, "Report trigger runs that stream nothing for this long (e.g. 5m; default: never)")
+	stallAction := fs.String("stall-action", "warn", "What to do with stalled runs: warn or abort")
+	maxConcurrent := fs.Int("max-concurrent", 0, "Run at most this many triggers at once, highest priority first (default: no limit)")
+	responseCache := fs.Int("response-cache", 0, "Cache up to this many model responses, so identical prompts call the model once (default: no cache)")
+	responseCacheTTL := fs.Duration("response-cache-ttl", time.Hour, "How long cached model responses are used (0: until evicted)")
+	preempt := fs.String("preempt", "none", "What to do with lower-priority runs when a higher-priority one is waiting: none, pause, or abort")
+	otlpEndpoint := fs.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export traces to (e.g. http://localhost:4318)")
+	var logLevel slog.Level
+	fs.TextVar(&logLevel, "log-level", slog.LevelInfo, "Least severe log entries to write to stderr: debug, info, warn, or error")
+	profile := fs.String("profile", os.Getenv("LANGSPACE_PROFILE"), "Profile whose overlays to apply, e.g. prod (default: $LANGSPACE_PROFILE)")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+
+	retain, err := runtime.ParseWorkDirRetention(*keepWorkdir)
+	if err != nil {
+		return err
+	}
+	onStall, err := runtime.ParseStallAction(*stallAction)
+	if err != nil {
+		return err
+	}
+	preemption, err := runtime.ParsePreemption(*preempt)
+	if err != nil {
+		return err
+	}
+	cfg := runtime.DefaultConfig()
+	cfg.WorkDirRoot = *workdirRoot
+	cfg.RetainWorkDir = retain
+	cfg.HeartbeatInterval = *heartbeat
+	cfg.StallTimeout = *stallTimeout
+	cfg.StallAction = onStall
+	cfg.LogLevel = logLevel
+
+	// Every version the server loads counts into one registry
+	metrics := runtime.NewMetrics()
+	rtOpts := []runtime.Option{runtime.WithConfig(cfg), runtime.WithLogger(runtime.NewLogger(stderr, logLevel)), runtime.WithMetrics(metrics)}
+	if *otlpEndpoint != "" {
+		tp := runtime.NewOTLPTracerProvider(*otlpEndpoint)
+		defer shutdownTracing(tp, stderr)
+		rtOpts = append(rtOpts, runtime.WithTracerProvider(tp))
+	}
+	if *snapshotDir != "" {
+		store, err := runtime.NewDiskSnapshotStore(*snapshotDir)
+		if err != nil {
+			return err
+		}
+		rtOpts = append(rtOpts, runtime.WithSnapshotStore(store))
+	}
+	if *responseCache > 0 {
+		rtOpts = append(rtOpts, runtime.WithResponseCache(runtime.NewResponseCache(*responseCacheTTL, *responseCache)))
+	}
+	// One scheduler for every version, so canaries count against the limit
+	var sched *runtime.Scheduler
+	if *maxConcurrent > 0 {
+		sched = runtime.NewScheduler(*maxConcurrent, preemption)
+		rtOpts = append(rtOpts, runtime.WithScheduler(sched))
+	}
+
+	var tokens apiTokens
+	if *tokensFile != "" {
+		if tokens, err = loadAPITokens(*tokensFile); err != nil {
+			return err
+		}
+	}
+
+	versions := workspace.NewVersionStore(*versionsDir)
+	rt, files, err := loadServeRuntime(*inputFile, versions, *profile, rtOpts...)
+	if err != nil {
+		return err
+	}
+	rollout := runtime.NewRollout(rt)
+	defer func() {
+		_ = rollout.Stable().Close()
+		if canary := rollout.Canary(); canary != nil {
+			_ = canary.Close()
+		}
+	}()
+
+	if *canaryFile != "" && *standbyFile != "" {
+		return fmt.Errorf("flags -canary and -standby are mutually exclusive")
+	}
+	if *standbyFile != "" {
+		*canaryFile, *canaryPercent = *standbyFile, 0
+	}
+
+	if *canaryFile != "" {
+		canary, err := newServeRuntime(*canaryFile, versions, *profile, rtOpts...)
+		if err != nil {
+			return fmt.Errorf("loading canary: %w", err)
+		}
+		if err := rollout.StartCanary(canary, *canaryPercent); err != nil {
+			return err
+		}
+		if *standbyFile != "" {
+			checkPrint(fmt.Fprintf(stdout, "Loaded %s on standby\n", *standbyFile))
+		} else {
+			checkPrint(fmt.Fprintf(stdout, "Rolling out %s to %.0f%% of trigger firings\n", *canaryFile, *canaryPercent))
+		}
+	}
+
+	// Stop gracefully on interrupt, letting running triggers finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start trigger engine
+	engine := runtime.NewTriggerEngine(rt).WithRollout(rollout)
+	if err := engine.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start trigger engine: %w", err)
+	}
+
+	checkPrint(fmt.Fprintf(stdout, "LangSpace server listening on port %d...\n", *port))
+	checkPrint(fmt.Fprintf(stdout, "Trigger engine active with %d triggers\n", len(rt.Workspace().GetEntitiesByType("trigger"))))
+
+	if *watch {
+		reloader := runtime.NewReloader(rollout, func() (*runtime.Runtime, []string, error) {
+			return loadServeRuntime(*inputFile, versions, *profile, rtOpts...)
+		}, files).WithTriggerEngine(engine)
+		reloader.OnReload(func(e runtime.ReloadEvent) {
+			if e.Err != nil {
+				checkPrint(fmt.Fprintf(stderr, "Reload failed, still serving the previous version: %v\n", e.Err))
+				return
+			}
+			checkPrint(fmt.Fprintf(stdout, "Reloaded %s (changed: %s)\n", *inputFile, strings.Join(e.Files, ", ")))
+		})
+		go reloader.Run(ctx)
+		checkPrint(fmt.Fprintf(stdout, "Watching %d files for changes\n", len(files)))
+	}
+
+	mux := newServeMux(rollout, versions, *profile, tokens, rtOpts...)
+	handleTriggers(mux, engine, sched, tokens)
+	// GET /metrics serves the runtime's metrics to Prometheus
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 2)
+	go func() { serveErr <- server.ListenAndServe() }()
+
+	var grpcServer *http.Server
+	if *grpcPort != 0 {
+		grpcServer = grpcapi.NewHTTPServer(fmt.Sprintf(":%d", *grpcPort), grpcapi.NewServer(rollout, grpcapi.WithAuthenticator(tokens.authenticate)))
+		go func() { serveErr <- grpcServer.ListenAndServe() }()
+		checkPrint(fmt.Fprintf(stdout, "gRPC API listening on port %d\n", *grpcPort))
+	}
+
+	select {
+	case err := <-serveErr:
+		_ = engine.Stop()
+		return err
+	case <-ctx.Done():
+	}
+
+	checkPrint(fmt.Fprintln(stdout, "Shutting down, waiting for running triggers..."))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("shutting down gRPC server: %w", err)
+		}
+	}
+	if err := engine.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down trigger engine: %w", err)
+	}
+	return nil
+}
+
+// newServeRuntime loads a file and its imports into a runtime with the
+// default providers configured and profile, if not empty, applied.
+func newServeRuntime(path string, versions *workspace.VersionStore, profile string, opts ...runtime.Option) (*runtime.Runtime, error) {
+	rt, _, err := loadServeRuntime(path, versions, profile, opts...)
+	return rt, err
+}
+
+// loadServeRuntime is newServeRuntime that also returns the files the
+// workspace was loaded from, for watching.
+func loadServeRuntime(path string, versions *workspace.VersionStore, profile string, opts ...runtime.Option) (*runtime.Runtime, []string, error) {
+	ws := workspace.New()
+	l := workspace.NewLoader(ws).WithProfile(profile)
+	if err := l.Load(path); err != nil {
+		return nil, nil, err
+	}
+	// Bundles carry the versions they pin
+	if versions != nil && !workspace.IsBundle(path) {
+		if err := versions.LoadInto(ws); err != nil {
+			return nil, nil, fmt.Errorf("loading published versions: %w", err)
+		}
+	}
+
+	rt := runtime.New(ws, opts...)
+	rt.RegisterProvider("anthropic", runtime.NewAnthropicProvider())
+	rt.RegisterProvider("openai", runtime.NewOpenAIProvider())
+	rt.RegisterProvider("gemini", runtime.NewGeminiProvider())
+	rt.RegisterProvider("bedrock", runtime.NewBedrockProvider())
+	if err := rt.ConfigureProviders(); err != nil {
+		_ = rt.Close()
+		return nil, nil, fmt.Errorf("configuring providers: %w", err)
+	}
+	if err := checkAgents(rt); err != nil {
+		_ = rt.Close()
+		return nil, nil, err
+	}
+	return rt, l.Files(), nil
+}
+
+// checkAgents reports every agent whose provider or model is misconfigured
+// in a single error, before anything runs.
+func checkAgents(rt *runtime.Runtime) error {
+	errs := rt.CheckAgents()
+	if len(errs) == 0 {
+		return nil
+	}
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = "  " + e.Error()
+	}
+	return fmt.Errorf("%d agent configuration errors:\n%s", len(errs), strings.Join(lines, "\n"))
+}
+
+// openCassette returns the cassette to record model calls to or replay them
+// from, given the -record and -replay flags, or nil for neither.
+func openCassette(record, replay string) (*runtime.Cassette, error) {
+	switch {
+	case record != "" && replay != "":
+		return nil, fmt.Errorf("-record and -replay cannot be combined")
+	case record != "":
+		return runtime.NewCassette(record, runtime.CassetteRecord)
+	case replay != "":
+		return runtime.NewCassette(replay, runtime.CassetteReplay)
+	}
+	return nil, nil
+}
+
+// saveCassette writes the calls a cassette recorded.
+func saveCassette(cassette *runtime.Cassette, stderr io.Writer) {
+	if err := cassette.Save(); err != nil {
+		checkPrint(fmt.Fprintf(stderr, "Warning: saving cassette: %v\n", err))
+	}
+}
+
+// shutdownTracing exports any spans still pending.
+func shutdownTracing(tp *runtime.OTLPTracerProvider, stderr io.Writer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Shutdown(ctx); err != nil {
+		checkPrint(fmt.Fprintf(stderr, "Warning: exporting traces: %v\n", err))
+	}
+}
+
+// searchResult is the JSON form of a workspace search match.
+type searchResult struct {
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// newServeMux returns the HTTP API served by the serve command. versions,
+// which may be nil, profile, and opts apply to runtimes loaded through the
+// API. Callers act as the principals of their tokens: they see only the
+// private entities they own, and can only roll out versions that change
+// the owned entities they own.
+func newServeMux(rollout *runtime.Rollout, versions *workspace.VersionStore, profile string, tokens apiTokens, opts ...runtime.Option) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// GET /search?q=payment+webhook&limit=10
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		principals, err := tokens.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			http.Error(w, "missing query parameter q", http.StatusBadRequest)
+			return
+		}
+
+		var results []workspace.SearchResult
+		for _, res := range rollout.Stable().Workspace().Search(query) {
+			if workspace.CanView(res.Entity, principals) {
+				results = append(results, res)
+			}
+		}
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			limit, err := strconv.Atoi(limitParam)
+			if err != nil || limit < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			if limit < len(results) {
+				results = results[:limit]
+			}
+		}
+
+		out := make([]searchResult, len(results))
+		for i, res := range results {
+			out[i] = searchResult{Type: res.Entity.Type(), Name: res.Entity.Name(), Score: res.Score}
+		}
+
+		writeJSON(w, out)
+	})
+
+	// GET /rollout reports per-version error rates and cost
+	mux.HandleFunc("/rollout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, rollout.Status())
+	})
+
+	// POST /rollout/canary {"file": "new.ls", "percent": 10} starts a rollout
+	mux.HandleFunc("/rollout/canary", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			File    string  `json:"file"`
+			Percent float64 `json:"percent"`
+		}
+		principals, err := tokens.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.File == "" {
+			http.Error(w, "expected JSON body with file and percent", http.StatusBadRequest)
+			return
+		}
+		canary, err := newServeRuntime(req.File, versions, profile, opts...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := workspace.CheckChanges(rollout.Stable().Workspace(), canary.Workspace(), principals); err != nil {
+			_ = canary.Close()
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := rollout.StartCanary(canary, req.Percent); err != nil {
+			_ = canary.Close()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, rollout.Status())
+	})
+
+	// checkRollout authenticates a change to which version serves: callers
+	// must be allowed to make every change between the versions involved
+	checkRollout := func(w http.ResponseWriter, r *http.Request, rollback bool) bool {
+		principals, err := tokens.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return false
+		}
+		stable, canary := rollout.Stable(), rollout.Canary()
+		if canary == nil {
+			// The action itself reports that there is no rollout
+			return true
+		}
+		from, to := stable.Workspace(), canary.Workspace()
+		if rollback {
+			from, to = to, from
+		}
+		if err := workspace.CheckChanges(from, to, principals); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	// POST /rollout/percent?value=25 changes the canary share
+	mux.HandleFunc("/rollout/percent", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !checkRollout(w, r, false) {
+			return
+		}
+		percent, err := strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+		if err != nil {
+			http.Error(w, "invalid value", http.StatusBadRequest)
+			return
+		}
+		if err := rollout.SetPercent(percent); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSON(w, rollout.Status())
+	})
+
+	// POST /rollout/promote and POST /rollout/rollback end the rollout;
+	// POST /rollout/switch swaps the stable and standby versions
+	for path, action := range map[string]func() error{
+		"/rollout/promote":  rollout.Promote,
+		"/rollout/rollback": rollout.Rollback,
+		"/rollout/switch":   rollout.Switch,
+	} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if !checkRollout(w, r, path == "/rollout/rollback") {
+				return
+			}
+			if err := action(); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writeJSON(w, rollout.Status())
+		})
+	}
+
+	return mux
+}
+
+// handleTriggers adds the endpoints for firing triggers to mux. sched may be
+// nil. Callers act as the principals of their tokens, and may only fire
+// triggers that run what they own.
+func handleTriggers(mux *http.ServeMux, engine *runtime.TriggerEngine, sched *runtime.Scheduler, tokens apiTokens) {
+	// POST /trigger?name=deploy fires a trigger now, e.g. from a webhook. A
+	// JSON body, if any, replaces the trigger's input.
+	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		principals, err := tokens.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing query parameter name", http.StatusBadRequest)
+			return
+		}
+		var input interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := engine.FireAs(name, input, principals); err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, workspace.ErrForbidden) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// GET /scheduler counts running and waiting executions by priority
+	mux.HandleFunc("/scheduler", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if sched == nil {
+			http.Error(w, "no scheduler: serve with -max-concurrent", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, sched.Status())
+	})
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// runLSP handles the lsp command
+func runLSP(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	server := lsp.NewServer()
+	return server.Start()
+}
+
+// runDAP handles the dap command: a debug adapter an editor starts for a
+// debug session and talks to over stdin and stdout.
+func runDAP(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dap", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+
+	server := dap.NewServer(dap.WithRuntime(func(ws *workspace.Workspace) (*runtime.Runtime, error) {
+		rt := runtime.New(ws)
+		rt.RegisterProvider("anthropic", runtime.NewAnthropicProvider())
+		rt.RegisterProvider("openai", runtime.NewOpenAIProvider())
+		rt.RegisterProvider("gemini", runtime.NewGeminiProvider())
+		rt.RegisterProvider("bedrock", runtime.NewBedrockProvider())
+		if err := rt.ConfigureProviders(); err != nil {
+			_ = rt.Close()
+			return nil, fmt.Errorf("configuring providers: %w", err)
+		}
+		if err := checkAgents(rt); err != nil {
+			_ = rt.Close()
+			return nil, err
+		}
+		return rt, nil
+	}))
+	return server.Serve(stdin, stdout)
+}
+
+// detectEntityType tries to find an entity by name and returns its type
+func detectEntityType(ws *workspace.Workspace, name string) string {
+	// Try common types in order of likelihood
+	for _, typ := range []string{"intent", "pipeline", "agent", "tool"} {
+		if _, found := ws.GetEntityByName(typ, name); found {
+			return typ
+		}
+	}
+	return ""
+}
+
+// printStats outputs workspace statistics
+func printStats(w io.Writer, stats workspace.WorkspaceStats, entityCount int) {
+	checkPrint(fmt.Fprintln(w, "Workspace statistics:"))
+	checkPrint(fmt.Fprintf(w, "  Number of entities: %d\n", stats.TotalEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of file entities: %d\n", stats.FileEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of agent entities: %d\n", stats.AgentEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of tool entities: %d\n", stats.ToolEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of intent entities: %d\n", stats.IntentEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of pipeline entities: %d\n", stats.PipelineEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of script entities: %d\n", stats.ScriptEntities))
+	checkPrint(fmt.Fprintf(w, "  Number of relationships: %d\n", stats.TotalRelationships))
+	checkPrint(fmt.Fprintf(w, "  Number of hooks: %d\n", stats.TotalHooks))
+	checkPrint(fmt.Fprintf(w, "Successfully processed entities: %d\n", entityCount))
+}
+
+// outputJSON outputs the workspace as JSON
+func outputJSON(w io.Writer, ws *workspace.Workspace) error {
+	return ws.SaveTo(w)
+}
+
+// printMatrixResult prints each run of a matrix and its output
+func printMatrixResult(w io.Writer, result *runtime.MatrixResult, verbose bool) {
+	for _, run := range result.Runs {
+		checkPrint(fmt.Fprintf(w, "=== %s ===\n", run.Label()))
+		if verbose || !run.Result.Success {
+			printExecutionResult(w, run.Result)
+		} else if run.Result.Output != nil {
+			checkPrint(fmt.Fprintln(w, formatOutput(run.Result.Output)))
+		}
+		checkPrint(fmt.Fprintln(w))
+	}
+
+	checkPrint(fmt.Fprintf(w, "--- Matrix: %d of %d runs succeeded in %s ---\n", result.Succeeded(), len(result.Runs), result.Duration))
+	for _, run := range result.Runs {
+		status := "ok"
+		if !run.Result.Success {
+			status = "failed"
+		}
+		checkPrint(fmt.Fprintf(w, "  %-6s %s (%s, %d tokens)\n", status, run.Label(), run.Result.Duration, run.Result.TokensUsed.TotalTokens))
+	}
+}
+
+// printExecutionResult prints detailed execution result
+func printExecutionResult(w io.Writer, result *runtime.ExecutionResult) {
+	checkPrint(fmt.Fprintln(w, "\n--- Execution Result ---"))
+	checkPrint(fmt.Fprintf(w, "Success: %v\n", result.Success))
+	checkPrint(fmt.Fprintf(w, "Duration: %s\n", result.Duration))
+	checkPrint(fmt.Fprintf(w, "Tokens Used: %d (input: %d, output: %d)\n",
+		result.TokensUsed.TotalTokens,
+		result.TokensUsed.InputTokens,
+		result.TokensUsed.OutputTokens))
+
+	if len(result.StepResults) > 0 {
+		checkPrint(fmt.Fprintln(w, "\nStep Results:"))
+		for name, step := range result.StepResults {
+			if step.Cached {
+				checkPrint(fmt.Fprintf(w, "  %s: success=%v, cached\n", name, step.Success))
+				continue
+			}
+			if step.Status == runtime.StepTimedOut {
+				checkPrint(fmt.Fprintf(w, "  %s: success=false, timed out after %s\n", name, step.Duration))
+				continue
+			}
+			checkPrint(fmt.Fprintf(w, "  %s: success=%v, duration=%s\n", name, step.Success, step.Duration))
+		}
+	}
+
+	if len(result.ContextWarnings) > 0 {
+		checkPrint(fmt.Fprintln(w, "\nCut down to fit context windows:"))
+		for _, c := range result.ContextWarnings {
+			if c.Step != "" {
+				checkPrint(fmt.Fprintf(w, "  %s: %s, %d of %d tokens kept (%s)\n", c.Step, c.File, c.Kept, c.Tokens, c.Strategy))
+				continue
+			}
+			checkPrint(fmt.Fprintf(w, "  %s, %d of %d tokens kept (%s)\n", c.File, c.Kept, c.Tokens, c.Strategy))
+		}
+	}
+
+	if len(result.Nondeterminism) > 0 {
+		checkPrint(fmt.Fprintln(w, "\nMay vary between runs:"))
+		for _, n := range result.Nondeterminism {
+			if n.Step != "" {
+				checkPrint(fmt.Fprintf(w, "  %s: %s (%s)\n", n.Step, n.Detail, n.Source))
+				continue
+			}
+			checkPrint(fmt.Fprintf(w, "  %s (%s)\n", n.Detail, n.Source))
+		}
+	}
+
+	if result.Error != nil {
+		checkPrint(fmt.Fprintf(w, "\nError: %v\n", result.Error))
+	}
+
+	if result.Output != nil {
+		checkPrint(fmt.Fprintln(w, "\n--- Output ---"))
+		checkPrint(fmt.Fprintln(w, formatOutput(result.Output)))
+	}
+}
+
+// parseParamValue parses a -param value: JSON such as 3, true, or ["a", "b"]
+// is decoded, and anything else is a string.
+func parseParamValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// formatOutput formats an execution output for the terminal. Structured
+// output, such as an intent's schema-checked result, is printed as JSON.
+func formatOutput(output interface{}) string {
+	switch v := output.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err == nil {
+			return string(data)
+		}
 	}
+	return fmt.Sprintf("%v", output)
 }
 
 // CLIStreamHandler handles streaming output for the CLI
@@ -2,10 +2,23 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/validator"
+	"github.com/shellkjell/langspace/pkg/workspace"
 )
 
 func TestRun_WithStdin(t *testing.T) {
@@ -71,6 +84,31 @@ agent "analyzer" {
 	}
 }
 
+func TestRun_ParseTag(t *testing.T) {
+	input := `agent "reviewer" {
+	model: "gpt-4"
+	tags: ["code", "review"]
+}
+
+tool "linter" {
+	command: "golangci-lint run"
+	tags: ["code"]
+}
+
+agent "writer" {
+	model: "gpt-4"
+}`
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"parse", "-tag", "code"}, strings.NewReader(input), stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	output := stdout.String()
+	if !strings.Contains(output, "Number of entities: 2") || !strings.Contains(output, "Number of tool entities: 1") {
+		t.Errorf("expected only the tagged agent and tool, got: %s", output)
+	}
+}
+
 func TestRun_ParseError(t *testing.T) {
 	input := `agent "broken" {
 	invalid syntax here
@@ -222,3 +260,1685 @@ agent "test" {
 		t.Errorf("expected 1 entity, got: %s", output)
 	}
 }
+
+func TestServeMux_Search(t *testing.T) {
+	ws := workspace.New()
+	for _, name := range []string{"payment-webhook", "payment-refund", "reviewer"} {
+		if err := ws.AddEntity(ast.NewAgentEntity(name)); err != nil {
+			t.Fatalf("AddEntity() error = %v", err)
+		}
+	}
+	mux := newServeMux(runtime.NewRollout(runtime.New(ws)), nil, "", nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=payment+webhook&limit=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []searchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].Name != "payment-webhook" || results[0].Type != "agent" {
+		t.Errorf("expected top result payment-webhook, got %+v", results)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without query, got %d", rec.Code)
+	}
+}
+
+func TestServeMux_Owners(t *testing.T) {
+	source := `agent "helper" {
+	model: "gpt-4o"
+}
+
+intent "payroll" {
+	use: agent("helper")
+	owners: ["team-hr"]
+	visibility: "private"
+}
+
+intent "refund" {
+	use: agent("helper")
+	owners: ["team-payments"]
+}
+
+trigger "refund-requested" {
+	event: "refund"
+	run: intent("refund")
+}
+`
+	dir := t.TempDir()
+	stablePath := filepath.Join(dir, "stable.ls")
+	if err := os.WriteFile(stablePath, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tokensPath := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(tokensPath, []byte(`{"hr-token": ["team-hr"], "payments-token": ["alice", "team-payments"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := loadAPITokens(tokensPath)
+	if err != nil {
+		t.Fatalf("loadAPITokens() error = %v", err)
+	}
+
+	stable, err := newServeRuntime(stablePath, nil, "")
+	if err != nil {
+		t.Fatalf("newServeRuntime() error = %v", err)
+	}
+	rollout := runtime.NewRollout(stable)
+	engine := runtime.NewTriggerEngine(stable).WithRollout(rollout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = engine.Stop() }()
+	mux := newServeMux(rollout, nil, "", tokens)
+	handleTriggers(mux, engine, nil, tokens)
+
+	do := func(token, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Private entities are found only by their owners
+	for token, want := range map[string]int{"": 0, "payments-token": 0, "hr-token": 1} {
+		rec := do(token, http.MethodGet, "/search?q=payroll", "")
+		var results []searchResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("invalid response JSON: %v", err)
+		}
+		if len(results) != want {
+			t.Errorf("searching as %q found %+v, want %d results", token, results, want)
+		}
+	}
+	if rec := do("guess", http.MethodGet, "/search?q=payroll", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", rec.Code)
+	}
+
+	// Only the owners of what a trigger runs can fire it
+	if rec := do("hr-token", http.MethodPost, "/trigger?name=refund-requested", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 firing as a non-owner, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("payments-token", http.MethodPost, "/trigger?name=refund-requested", ""); rec.Code != http.StatusAccepted {
+		t.Errorf("expected 202 firing as an owner, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Only the owners of an entity can roll out a version that changes it
+	canaryPath := filepath.Join(dir, "canary.ls")
+	if err := os.WriteFile(canaryPath, []byte(strings.Replace(source, `owners: ["team-payments"]`, `owners: ["team-hr"]`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"file": "` + filepath.ToSlash(canaryPath) + `", "percent": 10}`
+	if rec := do("hr-token", http.MethodPost, "/rollout/canary", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 changing another team's entity, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("payments-token", http.MethodPost, "/rollout/canary", body); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 changing an owned entity, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// So are changing its traffic, promoting it, and rolling it back
+	for _, target := range []string{"/rollout/percent?value=50", "/rollout/promote", "/rollout/rollback"} {
+		if rec := do("", http.MethodPost, target, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for %s without a token, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+		if rec := do("guess", http.MethodPost, target, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 for %s with an unknown token, got %d", target, rec.Code)
+		}
+	}
+	if rec := do("hr-token", http.MethodPost, "/rollout/promote", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 promoting another team's changes, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// The canary's owners may roll it back
+	if rec := do("hr-token", http.MethodPost, "/rollout/rollback", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 rolling back as an owner, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// and switching to a standby version loaded at startup
+	standby, err := newServeRuntime(canaryPath, nil, "")
+	if err != nil {
+		t.Fatalf("newServeRuntime() error = %v", err)
+	}
+	if err := rollout.StartCanary(standby, 0); err != nil {
+		t.Fatalf("StartCanary() error = %v", err)
+	}
+	if rec := do("hr-token", http.MethodPost, "/rollout/switch", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 switching to another team's changes, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rollout.Stable() != stable {
+		t.Error("expected the stable version to keep serving after a forbidden switch")
+	}
+	if rec := do("payments-token", http.MethodPost, "/rollout/switch", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 switching as an owner, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRun_Analyze(t *testing.T) {
+	input := `
+agent "reviewer" {
+	model: "gpt-4o"
+	instruction: "Review the code for bugs and security issues"
+}
+
+agent "reviewer-copy" {
+	model: "gpt-4o"
+	instruction: "Review the code for bugs and security issues"
+}
+
+agent "translator" {
+	instruction: "Translate text into French"
+}
+`
+	path := filepath.Join(t.TempDir(), "agents.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"analyze", "-file", path}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	output := stdout.String()
+	if !strings.Contains(output, "Found 1 group(s)") || !strings.Contains(output, "reviewer, reviewer-copy") {
+		t.Errorf("expected duplicate reviewer group, got: %s", output)
+	}
+	if strings.Contains(output, "translator") {
+		t.Errorf("did not expect translator to be reported, got: %s", output)
+	}
+}
+
+func TestRun_ValidateSemantics(t *testing.T) {
+	t.Setenv("LANGSPACE_LANG", "en")
+	input := `
+agent "writer" {
+	model: "gpt-4o"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		input: step("polish").output
+	}
+
+	step "polish" {
+		use: agent("editor")
+	}
+}
+`
+	path := filepath.Join(t.TempDir(), "report.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := run([]string{"validate", "-file", path}, nil, stdout, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "2 errors") {
+		t.Fatalf("expected 2 validation errors, got %v", err)
+	}
+	output := stdout.String()
+	for _, want := range []string{
+		`error: 7:2: step "draft": references step "polish", which runs after it`,
+		`error: 12:2: step "polish": references undefined agent "editor"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestRun_ValidateIgnored(t *testing.T) {
+	t.Setenv("LANGSPACE_LANG", "en")
+	input := `
+tool "search" { # langspace:ignore LS2202 used by plugins
+	command: "grep"
+}
+
+pipeline "report" {
+	step "draft" { use: agent("editor") } # langspace:ignore LS2004
+}
+`
+	path := filepath.Join(t.TempDir(), "report.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"validate", "-file", path}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("expected ignored diagnostics to pass validation, got %v", err)
+	}
+	if output := stdout.String(); strings.Contains(output, "warning") || strings.Contains(output, "error") {
+		t.Errorf("expected no diagnostics, got: %s", output)
+	}
+}
+
+func TestRun_ValidateRules(t *testing.T) {
+	t.Setenv("LANGSPACE_LANG", "en")
+	validator.RegisterRuleSet("cli-test-policy", validator.Rule{
+		Code:    "ACME001",
+		Name:    "agent-owners",
+		DocsURL: "https://wiki.example.com/ACME001",
+		Types:   []string{"agent"},
+		Check: func(e ast.Entity) error {
+			if len(ast.Owners(e)) == 0 {
+				return errors.New("agents must declare an owner")
+			}
+			return nil
+		},
+	})
+	path := filepath.Join(t.TempDir(), "review.ls")
+	if err := os.WriteFile(path, []byte(`agent "reviewer" {
+	model: "gpt-4o"
+}
+
+agent "legacy" { # langspace:ignore ACME001 migrated next quarter
+	model: "gpt-4o"
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"validate", "-file", path}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("expected rule sets to run only when asked for, got %v", err)
+	}
+
+	stdout.Reset()
+	err := run([]string{"validate", "-file", path, "-rules", "cli-test-policy"}, nil, stdout, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "1 errors") {
+		t.Fatalf("expected 1 validation error, got %v", err)
+	}
+	want := `error: 1:1: agent "reviewer": agents must declare an owner [ACME001, see https://wiki.example.com/ACME001]`
+	if !strings.Contains(stdout.String(), want) {
+		t.Errorf("expected %q in output, got: %s", want, stdout.String())
+	}
+
+	err = run([]string{"validate", "-file", path, "-rules", "cli-test-policy,missing"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `unknown rule set "missing"`) {
+		t.Errorf("expected an unknown rule set error, got %v", err)
+	}
+}
+
+func TestRun_ValidateProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "review.ls")
+	if err := os.WriteFile(path, []byte(`agent "reviewer" {
+	model: "gpt-4o-mini"
+}
+
+profile "prod" {
+	config {
+		timeout: "10m"
+	}
+	agent "reviewer" {
+		model: "gpt-4o"
+	}
+}
+
+profile "staging" {
+	config {
+		timeout: "soon"
+	}
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"validate", "-file", path, "-profile", "prod"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Errorf("validate -profile prod failed: %v", err)
+	}
+	if err := run([]string{"validate", "-file", path, "-profile", "staging"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected the staging profile's invalid timeout to fail validation")
+	}
+	t.Setenv("LANGSPACE_PROFILE", "dev")
+	if err := run([]string{"validate", "-file", path}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), `profile "dev"`) {
+		t.Errorf("expected LANGSPACE_PROFILE to select the unknown profile dev, got %v", err)
+	}
+}
+
+func TestRun_ValidateLocalized(t *testing.T) {
+	t.Setenv("LANGSPACE_LANG", "de_DE.UTF-8")
+	path := filepath.Join(t.TempDir(), "report.ls")
+	if err := os.WriteFile(path, []byte(`pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"validate", "-file", path}, nil, stdout, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected a validation error")
+	}
+	if want := `error: 2:2: step "draft": verweist auf nicht definierte(s) agent "writer"`; !strings.Contains(stdout.String(), want) {
+		t.Errorf("expected %q in output, got: %s", want, stdout.String())
+	}
+
+	broken := filepath.Join(t.TempDir(), "broken.ls")
+	if err := os.WriteFile(broken, []byte(`agent "writer" {`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr := &bytes.Buffer{}
+	err := run([]string{"validate", "-file", broken}, nil, &bytes.Buffer{}, stderr)
+	if err == nil || !strings.Contains(err.Error(), "unclosed block") {
+		t.Fatalf("expected the error to stay in English, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "in Zeile 1, Spalte 1: nicht geschlossener Block") {
+		t.Errorf("expected a German parse error, got: %s", stderr.String())
+	}
+}
+
+func TestRun_CompileDocker(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"workflow.ls": `
+import "lib/agents.ls" as lib
+
+pipeline "report" {
+	step "draft" {
+		use: lib.writer
+		input: env("TOPIC")
+	}
+}
+`,
+		"lib/agents.ls": `
+agent "writer" {
+	model: "gpt-4o"
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(dir, "deploy")
+	args := []string{"compile", "-target", "docker", "-base", "langspace", "-file", filepath.Join(dir, "workflow.ls"), "-output", out}
+	if err := run(args, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(out, "workflow", filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("expected %s copied into the image context, got %q (%v)", name, got, err)
+		}
+	}
+	dockerfile, err := os.ReadFile(filepath.Join(out, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dockerfile), `CMD ["serve", "-file", "workflow.ls", "-port", "8080"]`) {
+		t.Errorf("expected Dockerfile to serve workflow.ls, got:\n%s", dockerfile)
+	}
+	compose, err := os.ReadFile(filepath.Join(out, "docker-compose.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"OPENAI_API_KEY: ${OPENAI_API_KEY:-}", "TOPIC: ${TOPIC:-}", `"8080:8080"`} {
+		if !strings.Contains(string(compose), want) {
+			t.Errorf("expected %q in docker-compose.yml, got:\n%s", want, compose)
+		}
+	}
+	if strings.Contains(string(compose), "ANTHROPIC_API_KEY") {
+		t.Errorf("expected only the keys of providers in use, got:\n%s", compose)
+	}
+}
+
+func TestRun_Explain(t *testing.T) {
+	dir := t.TempDir()
+	history, err := runtime.NewDiskRunHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := runtime.RunRecord{
+		ID:         "20250101T120000-1a2b3c4d",
+		EntityType: "pipeline",
+		EntityName: "report",
+		Error:      `step "draft" failed: API error (status 429): slow down`,
+		Steps: []runtime.StepRecord{
+			{Name: "outline", Success: true},
+			{Name: "draft", Model: "gpt-4o", Input: "## Input\n\n1. intro", Error: "API error (status 429): slow down", ErrorClass: "rate_limit", StatusCode: 429, Attempts: 3},
+		},
+	}
+	if err := history.Record(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"explain", "-history-dir", dir, "-run", rec.ID}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("explain failed: %v", err)
+	}
+	output := stdout.String()
+	for _, want := range []string{
+		`Failed at step "draft" (model gpt-4o)`,
+		"Provider status: 429",
+		"Retries: 2",
+		"  | 1. intro",
+		`on: ["rate_limit"]`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got: %s", want, output)
+		}
+	}
+
+	err = run([]string{"explain", "-history-dir", dir, "-run", "missing"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestRun_Rename(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"workflow.ls": `import "agents.ls"
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`,
+		"agents.ls": `agent "writer" {
+	model: "gpt-4o"
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry := filepath.Join(dir, "workflow.ls")
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"rename", "-file", entry, "-type", "agent", "-from", "writer", "-to", "author"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "workflow.ls:5:15: writer -> author") || !strings.Contains(stdout.String(), "agents.ls:1:8: writer -> author") {
+		t.Errorf("expected the edits in both files, got: %s", stdout.String())
+	}
+	if got, _ := os.ReadFile(entry); string(got) != files["workflow.ls"] {
+		t.Error("expected no changes without -write")
+	}
+
+	if err := run([]string{"rename", "-file", entry, "-type", "agent", "-from", "writer", "-to", "author", "-write"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("rename -write failed: %v", err)
+	}
+	for name, want := range map[string]string{"workflow.ls": `agent("author")`, "agents.ls": `agent "author" {`} {
+		if got, _ := os.ReadFile(filepath.Join(dir, name)); !strings.Contains(string(got), want) {
+			t.Errorf("expected %s in %s, got:\n%s", want, name, got)
+		}
+	}
+
+	err := run([]string{"rename", "-file", entry, "-type", "agent", "-from", "writer", "-to", "x"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error after the rename, got %v", err)
+	}
+}
+
+func TestRun_Prune(t *testing.T) {
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "workflow.ls")
+	src := `agent "writer" {
+	model: "gpt-4o"
+}
+
+# Left over from an old pipeline
+agent "drafter" {
+	model: "gpt-4o"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`
+	if err := os.WriteFile(entry, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"prune", "-file", entry, "-dry-run"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("prune -dry-run failed: %v", err)
+	}
+	if want := entry + ": agent \"drafter\"\n"; stdout.String() != want {
+		t.Errorf("prune -dry-run output = %q, want %q", stdout.String(), want)
+	}
+	if got, _ := os.ReadFile(entry); string(got) != src {
+		t.Error("expected no changes with -dry-run")
+	}
+
+	stdout.Reset()
+	if err := run([]string{"prune", "-file", entry}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "removed 1 entity(s)") {
+		t.Errorf("expected the file to be updated, got: %s", stdout.String())
+	}
+	got, _ := os.ReadFile(entry)
+	if strings.Contains(string(got), "drafter") || strings.Contains(string(got), "old pipeline") || !strings.Contains(string(got), `agent "writer"`) {
+		t.Errorf("expected only the orphan and its comment to be removed, got:\n%s", got)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"prune", "-file", entry, "-dry-run"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "No orphaned entities found") {
+		t.Errorf("expected no orphans after pruning, got: %s", stdout.String())
+	}
+}
+
+func TestRun_Publish(t *testing.T) {
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "workflow.ls")
+	if err := os.WriteFile(entry, []byte(`pipeline "review" {
+	step "read" {
+		input: "v1"
+	}
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versions := filepath.Join(dir, "versions")
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"publish", "-file", entry, "-name", "review", "-version", "v1", "-dir", versions}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), `pipeline("review")@v1`) {
+		t.Errorf("expected how to pin the version, got: %s", stdout.String())
+	}
+	if err := run([]string{"publish", "-file", entry, "-name", "review", "-version", "v1", "-dir", versions}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error publishing v1 again")
+	}
+
+	stdout.Reset()
+	if err := run([]string{"publish", "-name", "review", "-dir", versions}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("publish list failed: %v", err)
+	}
+	if stdout.String() != "v1\n" {
+		t.Errorf("expected the published versions, got: %q", stdout.String())
+	}
+}
+
+func TestRun_PublishInstall(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			files[r.URL.Path], _ = io.ReadAll(r.Body)
+			return
+		}
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+	t.Setenv("LANGSPACE_REGISTRY", server.URL)
+
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "review.ls")
+	if err := os.WriteFile(lib, []byte(`agent "reviewer" {
+	model: "gpt-4o"
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	args := []string{"publish", "acme/review@1.2.0", "-file", lib, "-dir", filepath.Join(dir, "versions")}
+	if err := run(args, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Published acme/review@1.2.0") {
+		t.Errorf("expected the published version, got: %s", stdout.String())
+	}
+	if err := run([]string{"publish", "acme/review", "-file", lib}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "no version given") {
+		t.Errorf("expected a missing version error, got: %v", err)
+	}
+
+	packages := filepath.Join(dir, "packages")
+	stdout.Reset()
+	if err := run([]string{"install", "-dir", packages, "acme/review@^1.0.0"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Installed acme/review@1.2.0") || !strings.Contains(stdout.String(), "as review") {
+		t.Errorf("expected the installed version and how to import it, got: %s", stdout.String())
+	}
+
+	// Reinstalling from the lock file
+	if err := os.RemoveAll(filepath.Join(packages, "acme")); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"install", "-dir", packages}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("install from the lock failed: %v", err)
+	}
+
+	app := filepath.Join(dir, "app.ls")
+	if err := os.WriteFile(app, []byte(`import "packages/acme/review.lsbundle" as review
+
+intent "check" {
+	use: review.reviewer
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if err := run([]string{"validate", "-file", app}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("validate failed: %v\n%s", err, stdout.String())
+	}
+}
+
+func TestRun_Package(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "looks good"},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/agents.ls": `agent "reviewer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+`,
+		"workflow.ls": `import "lib/agents.ls"
+
+provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+intent "review" {
+	use: agent("reviewer")
+	input: "Review this change"
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := filepath.Join(t.TempDir(), "review.lsbundle")
+
+	var stdout bytes.Buffer
+	args := []string{"package", "-file", filepath.Join(dir, "workflow.ls"), "-output", bundle, "-versions", filepath.Join(dir, "versions")}
+	if err := run(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("package failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Packaged 2 files, 3 entities, and 0 published versions") || !strings.Contains(stdout.String(), "Providers: local") || !strings.Contains(stdout.String(), "Requires: langspace >= 0.1.0") {
+		t.Errorf("expected a summary of the bundle, got: %s", stdout.String())
+	}
+
+	// The bundle runs on its own
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	args = []string{"run", "-file", bundle, "-name", "review", "-no-stream", "-no-cache", "-no-history", "-log-level", "error"}
+	if err := run(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run from the bundle failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "looks good") {
+		t.Errorf("expected the intent's output, got: %s", stdout.String())
+	}
+}
+
+func TestRun_Eval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		reply := "Your refund is on its way."
+		if strings.Contains(req.Messages[len(req.Messages)-1].Content, "charged twice") {
+			reply = "billing"
+		}
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": reply},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "evals.ls")
+	source := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "support" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+intent "reply" {
+	use: agent("support")
+	input: $input
+}
+
+eval "support" {
+	target: intent("reply")
+	pass_rate: 0.5
+
+	case "refund" {
+		input: "I want my money back"
+		expect: { contains: "refund" }
+	}
+
+	case "category" {
+		input: "My card was charged twice"
+		expect: { json_schema: { type: "object" } }
+	}
+}
+`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.json")
+
+	var stdout bytes.Buffer
+	args := []string{"eval", "-file", path, "-runs", "2", "-output", report, "-versions", filepath.Join(dir, "versions"), "-log-level", "error"}
+	if err := run(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("eval failed: %v\n%s", err, stdout.String())
+	}
+	for _, want := range []string{
+		`=== support (intent "reply", 2 runs per case) ===`,
+		"refund    2/2     100%",
+		"category  0/2     0%",
+		"category, run 2:\n    output does not match the JSON schema",
+		"--- ok: 2 of 4 runs passed (50%, threshold 50%), 60 tokens",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, stdout.String())
+		}
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []runtime.EvalReport
+	if err := json.Unmarshal(data, &reports); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Total != 4 || len(reports[0].Cases[1].Runs[0].Failures) != 1 {
+		t.Errorf("unexpected JSON report: %s", data)
+	}
+
+	// A stricter threshold fails the command
+	strict := strings.Replace(source, "pass_rate: 0.5", "pass_rate: 0.9", 1)
+	if err := os.WriteFile(path, []byte(strict), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	err = run([]string{"eval", "-file", path, "-json", "-versions", filepath.Join(dir, "versions")}, nil, &stdout, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 evals below their pass rate") {
+		t.Errorf("expected the eval to fail, got: %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "[") {
+		t.Errorf("expected a JSON report, got: %s", stdout.String())
+	}
+}
+
+func TestRun_RecordReplay(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "Recorded summary"},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "summarize.ls")
+	source := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+intent "summarize" {
+	use: agent("writer")
+	input: "Summarize the changelog"
+}
+`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cassette := filepath.Join(dir, "cassettes", "summarize.json")
+	args := []string{"run", "-file", path, "-name", "summarize", "-no-stream", "-no-history", "-no-cache", "-log-level", "error"}
+
+	var stdout bytes.Buffer
+	if err := run(append(args, "-record", cassette), nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("recording failed: %v", err)
+	}
+	if _, err := os.Stat(cassette); err != nil {
+		t.Fatalf("expected the cassette to be written: %v", err)
+	}
+
+	// The replay runs without the server
+	server.Close()
+	stdout.Reset()
+	if err := run(append(args, "-replay", cassette), nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Recorded summary") || calls != 1 {
+		t.Errorf("expected the recorded output from one call, got %d calls and:\n%s", calls, stdout.String())
+	}
+
+	if err := run(append(args, "-record", cassette, "-replay", cassette), nil, &stdout, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("expected -record and -replay to conflict, got %v", err)
+	}
+}
+
+func TestRun_Doc(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "workflow.ls")
+	source := `# Writes reports.
+agent "writer" {
+	model: "gpt-4o"
+}
+
+pipeline "report" {
+	params: {
+		topic: string required "What to report on"
+	}
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"doc", "-file", file}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("doc failed: %v", err)
+	}
+	for _, want := range []string{"# workflow.ls\n", "### writer\n\nWrites reports.\n", "| topic | string | yes |  | What to report on |"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, stdout.String())
+		}
+	}
+
+	output := filepath.Join(dir, "docs.html")
+	stdout.Reset()
+	if err := run([]string{"doc", "-file", file, "-format", "html", "-output", output, "-title", "Reports"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("doc -format html failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Documented 2 entities in "+output) {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !strings.Contains(string(data), "<title>Reports</title>") {
+		t.Errorf("expected an HTML page, got %v:\n%s", err, data)
+	}
+
+	err = run([]string{"doc", "-file", file, "-format", "pdf"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+}
+
+func TestRun_Graph(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "workflow.ls")
+	source := `agent "writer" {
+	model: "gpt-4o"
+}
+
+pipeline "report" {
+	step "outline" {
+		use: agent("writer")
+	}
+
+	step "draft" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+}
+`
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"graph", "-file", file}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("graph failed: %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "digraph langspace {") || !strings.Contains(stdout.String(), `n2 -> n3 [label="next"];`) {
+		t.Errorf("expected a DOT graph, got:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run([]string{"graph", "-file", file, "-format", "mermaid"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("graph -format mermaid failed: %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "flowchart LR") || !strings.Contains(stdout.String(), `n2 -->|"output"| n3`) {
+		t.Errorf("expected a Mermaid flowchart, got:\n%s", stdout.String())
+	}
+
+	err := run([]string{"graph", "-file", file, "-format", "svg"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+}
+
+func TestRun_Diff(t *testing.T) {
+	oldSource := `
+agent "reviewer" {
+	model: "gpt-4o-mini"
+	instruction: "Review the code"
+}
+
+pipeline "review" {
+	step "analyze" {
+		use: agent("reviewer")
+		input: $input
+	}
+	step "format" {
+		use: agent("reviewer")
+		input: step("analyze").output
+	}
+}
+`
+	newSource := `
+agent "reviewer" {
+	model: "gpt-4o"
+	instruction: "Review the code for security issues"
+}
+
+pipeline "review" {
+	step "analyze" {
+		use: agent("reviewer")
+		input: $input
+	}
+	step "summarize" {
+		use: agent("reviewer")
+		input: step("analyze").output
+	}
+}
+`
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.ls")
+	newPath := filepath.Join(dir, "new.ls")
+	if err := os.WriteFile(oldPath, []byte(oldSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(newSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"diff", "-old", oldPath, "-new", newPath, "-input", "func main() {}"}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	output := stdout.String()
+	for _, want := range []string{
+		"pipeline/review: changed",
+		`+ step "summarize"`,
+		`- step "format"`,
+		`~ step "analyze"`,
+		`model: "gpt-4o-mini" -> "gpt-4o"`,
+		"system + Review the code for security issues",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	stdout.Reset()
+	if err := run([]string{"diff", "-old", oldPath, "-new", oldPath}, nil, stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "pipeline/review: no plan changes") {
+		t.Errorf("expected no changes for identical files, got: %s", stdout.String())
+	}
+}
+
+func TestServeMux_Rollout(t *testing.T) {
+	rollout := runtime.NewRollout(runtime.New(workspace.New()))
+	mux := newServeMux(rollout, nil, "", nil)
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/rollout/promote"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 promoting without a canary, got %d", rec.Code)
+	}
+
+	canary := runtime.New(workspace.New())
+	if err := rollout.StartCanary(canary, 10); err != nil {
+		t.Fatalf("StartCanary() error = %v", err)
+	}
+
+	if rec := do(http.MethodPost, "/rollout/percent?value=25"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 setting percent, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, "/rollout")
+	var status runtime.RolloutStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if !status.Active || status.Percent != 25 {
+		t.Errorf("expected active rollout at 25%%, got %+v", status)
+	}
+
+	if rec := do(http.MethodPost, "/rollout/promote"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 promoting, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rollout.Stable() != canary {
+		t.Error("expected canary to be promoted to stable")
+	}
+	if rec := do(http.MethodPost, "/rollout/rollback"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 rolling back after promotion, got %d", rec.Code)
+	}
+
+	// Blue/green: load a standby version and switch back and forth
+	standby := runtime.New(workspace.New())
+	if err := rollout.StartCanary(standby, 0); err != nil {
+		t.Fatalf("StartCanary() error = %v", err)
+	}
+	if rec := do(http.MethodPost, "/rollout/switch"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 switching, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rollout.Stable() != standby {
+		t.Error("expected standby to serve after switching")
+	}
+	if rec := do(http.MethodPost, "/rollout/switch"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 switching back, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rollout.Stable() != canary {
+		t.Error("expected previous version to serve after switching back")
+	}
+}
+
+func TestRun_ExecuteChecksAgents(t *testing.T) {
+	input := `agent "writer" {
+	model: "gpt-4o"
+	provider: "vllm-internal"
+}
+
+agent "editor" {
+	model: "claude-sonnet-4-20250514"
+	provider: "openai"
+}
+
+intent "draft" {
+	use: agent("writer")
+	input: "hello"
+}
+`
+	path := filepath.Join(t.TempDir(), "draft.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := run([]string{"run", "-file", path, "-name", "draft", "-no-cache"}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("expected agent configuration errors")
+	}
+	for _, want := range []string{
+		"2 agent configuration errors",
+		`1:1: agent "writer": unknown provider "vllm-internal"`,
+		`6:1: agent "editor": model "claude-sonnet-4-20250514" is served by anthropic, but provider "openai" is openai`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got: %v", want, err)
+		}
+	}
+}
+
+func TestRun_ExecuteChecksParams(t *testing.T) {
+	input := `agent "writer" {
+	model: "gpt-4o"
+}
+
+intent "draft" {
+	params: {
+		topic: string required
+		words: number optional 200
+	}
+	use: agent("writer")
+	input: "Write {{params.words}} words about {{params.topic}}"
+}
+`
+	path := filepath.Join(t.TempDir(), "draft.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"run", "-file", path, "-name", "draft", "-no-cache", "-no-history", "-no-stream"}
+
+	err := run(append(args, "-param", `words="many"`), nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `invalid params for intent "draft": topic: required parameter not provided; words: expected number, got string`) {
+		t.Errorf("expected both param violations, got: %v", err)
+	}
+
+	err = run(append(args, "-param", "topic"), nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "expected name=value") {
+		t.Errorf("expected a flag error, got: %v", err)
+	}
+}
+
+func TestRun_ExecuteKeepWorkdir(t *testing.T) {
+	input := `script "scratch" {
+	language: "sh"
+	code: "echo done > out.txt"
+}
+`
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scratch.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "runs")
+	args := []string{"run", "-file", path, "-name", "scratch", "-type", "script", "-no-cache", "-no-history", "-workdir-root", root}
+
+	if err := run(append(args, "-keep-workdir", "always"), nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if kept, _ := filepath.Glob(filepath.Join(root, "*", "out.txt")); len(kept) != 1 {
+		t.Errorf("expected the workdir to be kept under %s, got %v", root, kept)
+	}
+
+	err := run(append(args, "-keep-workdir", "sometimes"), nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `unknown workdir retention "sometimes"`) {
+		t.Errorf("expected a retention error, got: %v", err)
+	}
+}
+
+func TestRun_ExecuteMatrix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model       string  `json:"model"`
+			Temperature float64 `json:"temperature"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": fmt.Sprintf("%s at %v", req.Model, req.Temperature)},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1", "qwen2.5"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+pipeline "compare" {
+	matrix {
+		model: ["llama3.1", "qwen2.5"]
+		temperature: [0, 0.5]
+	}
+	step "answer" {
+		use: agent("writer")
+		input: "hello"
+	}
+}
+`
+	path := filepath.Join(t.TempDir(), "compare.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"run", "-file", path, "-name", "compare", "-no-cache", "-no-history"}
+
+	var stdout bytes.Buffer
+	if err := run(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, want := range []string{
+		"=== model=llama3.1 temperature=0 ===\nllama3.1 at 0\n",
+		"=== model=qwen2.5 temperature=0.5 ===\nqwen2.5 at 0.5\n",
+		"--- Matrix: 4 of 4 runs succeeded",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if err := run(append(args, "-no-matrix", "-no-stream"), nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := stdout.String(); got != "llama3.1 at 0.7\n" {
+		t.Errorf("expected a single run with the agent's settings, got %q", got)
+	}
+}
+
+func TestRun_ContextStrategy(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "done"},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "build.log")
+	if err := os.WriteFile(logPath, []byte(strings.Repeat("step ok\n", 99)+"step failed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "triager" {
+	model: "llama3.1"
+	provider: "gateway"
+	context_window: 200
+}
+
+intent "triage" {
+	use: agent("triager")
+	input: file("` + filepath.ToSlash(logPath) + `")
+}
+`
+	path := filepath.Join(dir, "triage.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	args := []string{"run", "-file", path, "-name", "triage", "-context-strategy", "tail", "-verbose", "-no-stream", "-no-cache", "-no-history", "-log-level", "error"}
+	if err := run(args, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stdout.String())
+	}
+	if !strings.HasSuffix(prompt, "step failed\n") || strings.Count(prompt, "step ok") >= 99 {
+		t.Errorf("expected the end of the log, got %q", prompt)
+	}
+	if !strings.Contains(stdout.String(), "Cut down to fit context windows:") {
+		t.Errorf("expected the truncation to be reported:\n%s", stdout.String())
+	}
+
+	if err := run([]string{"run", "-file", path, "-name", "triage", "-context-strategy", "middle", "-no-history"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an invalid -context-strategy to fail")
+	}
+}
+
+func TestRun_ExecuteTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "answered " + strings.TrimPrefix(req.Messages[len(req.Messages)-1].Content, "## Input\n\n")},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+	tags: ["nightly"]
+}
+
+intent "report" {
+	use: agent("writer")
+	input: "report"
+	tags: ["nightly"]
+}
+
+intent "digest" {
+	use: agent("writer")
+	input: "digest"
+	tags: ["nightly", "weekly"]
+}
+
+intent "adhoc" {
+	use: agent("writer")
+	input: "adhoc"
+}
+`
+	path := filepath.Join(t.TempDir(), "nightly.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"run", "-file", path, "-tag", "nightly", "-no-cache", "-no-history"}, nil, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stdout.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"=== intent \"report\" ===\nanswered report\n",
+		"=== intent \"digest\" ===\nanswered digest\n",
+		"--- Tag \"nightly\": 2 of 2 runs succeeded ---",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "adhoc") {
+		t.Errorf("expected the untagged intent not to run:\n%s", out)
+	}
+
+	if err := run([]string{"run", "-file", path, "-tag", "missing", "-no-history"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "no intent or pipeline") {
+		t.Errorf("expected an error for a tag nothing runnable has, got %v", err)
+	}
+	if err := run([]string{"run", "-file", path, "-tag", "nightly", "-name", "report"}, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected -tag with -name to fail")
+	}
+}
+
+func TestRun_ExecuteJSONRPC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "Hello!"},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+pipeline "greet" {
+	step "hello" {
+		use: agent("writer")
+		input: $input
+	}
+}
+`
+	path := filepath.Join(t.TempDir(), "greet.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdin := strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "execute", "params": {"name": "greet", "input": "hi"}}
+{"jsonrpc": "2.0", "id": "missing", "method": "execute", "params": {"name": "missing"}}
+{"jsonrpc": "2.0", "id": 3, "method": "execute", "params": {}}
+{"jsonrpc": "2.0", "id": 4, "method": "explain"}
+{"jsonrpc": "2.0", "id": 5, "method": "cancel", "params": {"id": 99}}
+not json
+`)
+
+	var stdout bytes.Buffer
+	if err := run([]string{"run", "-file", path, "-json-rpc", "-no-cache", "-no-history"}, stdin, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	type message struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			ID      json.RawMessage `json:"id"`
+			Content string          `json:"content"`
+		} `json:"params"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	responses := make(map[string]message)
+	var chunks strings.Builder
+	var progress int
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var m message
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("expected one JSON message per line, got %q: %v", line, err)
+		}
+		switch m.Method {
+		case "execute/chunk":
+			if _, done := responses["1"]; done || string(m.Params.ID) != "1" {
+				t.Errorf("expected chunks of request 1 before its response, got %s", line)
+			}
+			chunks.WriteString(m.Params.Content)
+		case "execute/progress":
+			progress++
+		default:
+			responses[string(m.ID)] = m
+		}
+	}
+
+	var result rpcExecuteResult
+	if err := json.Unmarshal(responses["1"].Result, &result); err != nil {
+		t.Fatalf("expected a result for request 1, got %+v", responses["1"])
+	}
+	if !result.Success || result.Output != "Hello!" {
+		t.Errorf("expected a successful execution, got %+v", result)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Name != "hello" || result.Steps[0].Output != "Hello!" {
+		t.Errorf("expected the step's result, got %+v", result.Steps)
+	}
+	if chunks.String() != "Hello!" || progress == 0 {
+		t.Errorf("expected the output as chunks and progress events, got %q and %d", chunks.String(), progress)
+	}
+
+	for id, code := range map[string]int{`"missing"`: rpcExecutionError, "3": rpcInvalidParams, "4": rpcMethodNotFound, "null": rpcParseError} {
+		if e := responses[id].Error; e == nil || e.Code != code {
+			t.Errorf("expected error %d for request %s, got %+v", code, id, responses[id])
+		}
+	}
+	if got := string(responses["5"].Result); got != `{"canceled":false}` {
+		t.Errorf("expected cancelling an unknown request to report so, got %s", got)
+	}
+}
+
+func TestRun_ExecuteDebug(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil && len(req.Messages) > 0 {
+			prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		}
+		writeJSON(w, map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"message":       map[string]string{"role": "assistant", "content": "Done."},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "` + server.URL + `"
+	models: ["llama3.1"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+pipeline "greet" {
+	step "outline" {
+		use: agent("writer")
+		input: $input
+	}
+	step "hello" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+}
+`
+	path := filepath.Join(t.TempDir(), "greet.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdin := strings.NewReader(`print
+skip "my outline"
+p outline
+history
+c
+`)
+
+	var stdout bytes.Buffer
+	err := run([]string{"run", "-file", path, "-name", "greet", "-input", "hi", "-debug", "-no-stream", "-no-cache", "-no-history"}, stdin, &stdout, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stdout.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		`Paused before step "outline" (1/2) of pipeline "greet" at line 13`,
+		"Input: hi",
+		`Paused before step "hello" (2/2)`,
+		"my outline\n",
+		"  2  hello",
+		"Done.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "my outline") {
+		t.Errorf("expected only the second step to call the model, with the skipped step's output, got %q", prompts)
+	}
+}
+
+func TestRun_DAP(t *testing.T) {
+	input := `provider "gateway" {
+	type: "local"
+	base_url: "http://localhost:1"
+	models: ["llama3.1"]
+}
+
+agent "writer" {
+	model: "llama3.1"
+	provider: "gateway"
+}
+
+pipeline "greet" {
+	step "hello" {
+		use: agent("writer")
+		input: $input
+	}
+}
+`
+	path := filepath.Join(t.TempDir(), "greet.ls")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdin strings.Builder
+	for i, req := range []map[string]interface{}{
+		{"command": "initialize", "arguments": map[string]string{"adapterID": "langspace"}},
+		{"command": "launch", "arguments": map[string]string{"program": path}},
+		{"command": "setBreakpoints", "arguments": map[string]interface{}{
+			"source":      map[string]string{"path": path},
+			"breakpoints": []map[string]int{{"line": 15}},
+		}},
+		{"command": "disconnect"},
+	} {
+		req["seq"], req["type"] = i+1, "request"
+		data, _ := json.Marshal(req)
+		fmt.Fprintf(&stdin, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"dap"}, strings.NewReader(stdin.String()), &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		`"event":"initialized"`,
+		`"success":true,"command":"launch"`,
+		`"verified":true`,
+		`"success":true,"command":"disconnect"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
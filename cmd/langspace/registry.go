@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// defaultPackagesDir is where install saves packages from a registry.
+const defaultPackagesDir = ".langspace/packages"
+
+// newRegistryClient returns a client of the registry at url, authenticated
+// with $LANGSPACE_REGISTRY_TOKEN if it is set.
+func newRegistryClient(url string) (*workspace.RegistryClient, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no registry given: set -registry or $LANGSPACE_REGISTRY")
+	}
+	var opts []workspace.RegistryOption
+	if token := os.Getenv("LANGSPACE_REGISTRY_TOKEN"); token != "" {
+		opts = append(opts, workspace.WithRegistryToken(token))
+	}
+	return workspace.NewRegistryClient(url, opts...), nil
+}
+
+// parseInterspersed parses flags given before or after positional
+// arguments, e.g. install acme/review@^1.2 -dir deps, and returns the
+// positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// publishPackage packages a file into a bundle, with the published versions
+// in dir it pins, and publishes it to a registry as ref, e.g.
+// acme/review@1.2.0.
+func publishPackage(stdout io.Writer, registry, ref, file, dir string) error {
+	name, version, err := workspace.ParsePackageRef(ref)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		return fmt.Errorf("no version given: publish %s@<version>, e.g. %s@1.0.0", name, name)
+	}
+	if file == "" {
+		return fmt.Errorf("required flag -file not provided")
+	}
+	client, err := newRegistryClient(registry)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := workspace.Package(&buf, file,
+		workspace.WithBundleVersions(workspace.NewVersionStore(dir)),
+		workspace.WithModelProviders(runtime.DefaultModel, runtime.ModelProvider)); err != nil {
+		return err
+	}
+	pv, err := client.Publish(context.Background(), name, version, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	checkPrint(fmt.Fprintf(stdout, "Published %s@%s (%d bytes, %s); install it with langspace install %s@%s\n", name, pv.Version, pv.Size, pv.Digest, name, pv.Version))
+	return nil
+}
+
+// runInstall handles the install command: it installs packages from a
+// registry, or reinstalls the locked versions of every installed package
+// without arguments.
+func runInstall(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	registry := fs.String("registry", os.Getenv("LANGSPACE_REGISTRY"), "URL of the package registry (default: $LANGSPACE_REGISTRY)")
+	dir := fs.String("dir", defaultPackagesDir, "Directory to install packages in")
+
+	refs, err := parseInterspersed(fs, args)
+	if err != nil {
+		return fmt.Errorf("parsing flags: %w", err)
+	}
+	client, err := newRegistryClient(*registry)
+	if err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		lock, err := workspace.ReadPackageLock(*dir)
+		if err != nil {
+			return err
+		}
+		if len(lock.Packages) == 0 {
+			return fmt.Errorf("no packages to install: give one, e.g. langspace install acme/review@^1.2.0")
+		}
+		for name, locked := range lock.Packages {
+			refs = append(refs, name+"@"+locked.Version)
+		}
+		sort.Strings(refs)
+	}
+
+	for _, ref := range refs {
+		pv, err := client.Install(context.Background(), *dir, ref)
+		if err != nil {
+			return err
+		}
+		name, _, _ := workspace.ParsePackageRef(ref)
+		file := workspace.PackagePath(*dir, name)
+		checkPrint(fmt.Fprintf(stdout, "Installed %s@%s to %s; import it with import %q as %s\n", name, pv.Version, file, filepath.ToSlash(file), strings.ReplaceAll(path.Base(name), ".", "_")))
+	}
+	return nil
+}
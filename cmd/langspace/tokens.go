@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiTokens maps the bearer tokens of serve API callers to the principals,
+// the users and teams, they act as when entities declare owners:
+//
+//	{"9f2c...": ["alice", "team-payments"]}
+type apiTokens map[string][]string
+
+// loadAPITokens reads API tokens from a JSON file.
+func loadAPITokens(path string) (apiTokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API tokens: %w", err)
+	}
+	var tokens apiTokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing API tokens %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// authenticate returns the principals of a request's bearer token. A
+// request without one acts as no one.
+func (t apiTokens) authenticate(r *http.Request) ([]string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	principals, known := t[token]
+	if !ok || !known {
+		return nil, errors.New("invalid API token")
+	}
+	return principals, nil
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Package ast provides the Abstract Syntax Tree (AST) components for LangSpace.
@@ -40,6 +41,11 @@ type BoolValue struct {
 
 func (b BoolValue) isValue() {}
 
+// NullValue represents the null literal, which resolves to no value
+type NullValue struct{}
+
+func (n NullValue) isValue() {}
+
 // ArrayValue represents an array of values
 type ArrayValue struct {
 	Elements []Value
@@ -59,6 +65,15 @@ type ReferenceValue struct {
 	Type string // "agent", "file", "tool", "step", etc.
 	Name string
 	Path []string // For dot access, e.g., step("x").output
+
+	// Optional[i] is true if Path[i] is accessed with optional chaining,
+	// e.g. step("x")?.output: a missing value or property resolves to null.
+	// Nil if no access is optional.
+	Optional []bool
+
+	// Version pins the reference to a published version of the entity,
+	// e.g. pipeline("review")@v3. Empty for the current definition.
+	Version string
 }
 
 func (r ReferenceValue) isValue() {}
@@ -93,6 +108,10 @@ func (n NestedEntityValue) isValue() {}
 type PropertyAccessValue struct {
 	Base string   // The base identifier (e.g., "params")
 	Path []string // The property path (e.g., ["location"])
+
+	// Optional[i] is true if Path[i] is accessed with optional chaining
+	// (e.g., params?.location). Nil if no access is optional.
+	Optional []bool
 }
 
 func (p PropertyAccessValue) isValue() {}
@@ -103,6 +122,12 @@ type MethodCallValue struct {
 	Method     string  // The method name
 	Arguments  []Value // The arguments to the method
 	InlineBody Entity  // Optional inline block (for patterns like pipeline("name") { ... })
+	Version    string  // Published version pinned by an inline block's reference, e.g. pipeline("name")@v3 { ... }
+
+	// Optional is true for a property accessed with optional chaining, e.g.
+	// regex_extract(text, pattern)?.level: a null object or missing property
+	// resolves to null
+	Optional bool
 }
 
 func (m MethodCallValue) isValue() {}
@@ -124,6 +149,42 @@ type ComparisonValue struct {
 
 func (c ComparisonValue) isValue() {}
 
+// CoalesceValue represents the default operator: Left if it is not null,
+// otherwise Right (e.g., step("x")?.output ?? "none")
+type CoalesceValue struct {
+	Left  Value
+	Right Value
+}
+
+func (c CoalesceValue) isValue() {}
+
+// ArithmeticValue represents an arithmetic expression
+// (e.g., step("count").output * 2)
+type ArithmeticValue struct {
+	Left     Value  // Left operand
+	Operator string // "+", "-", "*", "/", "%"
+	Right    Value  // Right operand
+}
+
+func (a ArithmeticValue) isValue() {}
+
+// LogicalValue represents a logical expression
+// (e.g., $attempt > 3 || step("check").output.ok)
+type LogicalValue struct {
+	Left     Value  // Left operand
+	Operator string // "&&", "||"
+	Right    Value  // Right operand
+}
+
+func (l LogicalValue) isValue() {}
+
+// NotValue represents a logical negation (e.g., !step("check").output.ok)
+type NotValue struct {
+	Operand Value
+}
+
+func (n NotValue) isValue() {}
+
 // BranchValue represents a branch control flow construct
 // e.g., branch step("classify").output.type { "bug" => step "fix" { ... } }
 type BranchValue struct {
@@ -143,13 +204,73 @@ type LoopValue struct {
 
 func (l LoopValue) isValue() {}
 
+// RetryValue represents a retry policy block
+// e.g., retry { max: 3 backoff: "exponential" on: ["timeout", "rate_limit"] }
+type RetryValue struct {
+	MaxAttempts int      // Maximum number of retries after the first failure (from max: N)
+	Backoff     string   // "constant", "linear", or "exponential"
+	Delay       string   // Base delay between attempts as a duration string (e.g., "1s")
+	On          []string // Error classes that trigger a retry; empty means any error
+}
+
+func (r RetryValue) isValue() {}
+
+// FallbackValue represents the models an agent falls back to when a request
+// to its model fails
+// e.g., fallback { models: ["gpt-4o", "gemini-1.5-pro"] on: ["rate_limit"] }
+type FallbackValue struct {
+	Models []string // Models to try in order after the agent's model
+	On     []string // Error classes that trigger a fallback; empty means the default classes
+}
+
+func (f FallbackValue) isValue() {}
+
+// MatrixValue represents the combinations of settings a pipeline runs with,
+// once each
+// e.g., matrix { model: ["gpt-4o", "claude-sonnet"] temperature: [0, 0.7] }
+type MatrixValue struct {
+	Dimensions []MatrixDimension // Dimensions in declaration order
+}
+
+func (m MatrixValue) isValue() {}
+
+// MatrixDimension is a setting a matrix varies and the values it takes
+type MatrixDimension struct {
+	Name   string
+	Values []Value
+}
+
+// OpaqueValue holds a serialized value of a kind this version does not know,
+// so it can be written back out unchanged
+type OpaqueValue struct {
+	Kind string // The serialized value kind (e.g., "duration")
+	Data []byte // The raw serialized value
+}
+
+func (o OpaqueValue) isValue() {}
+
 // Import represents an import directive in a LangSpace file
+// e.g., import "lib/agents.ls" or import "lib/agents.ls" as agents
 type Import struct {
 	Path   string // The path to the file to import
+	Alias  string // Optional namespace for the imported entities (from "as name")
 	Line   int    // Source line
 	Column int    // Source column
 }
 
+// Directive is a comment addressed to tools rather than readers, e.g.,
+// # langspace:deprecated use "reviewer-v2" or # region tools
+type Directive struct {
+	Name   string // "region", "endregion", or what follows "langspace:", such as "ignore" or "deprecated"
+	Text   string // The rest of the comment, such as a reason or a region's label
+	Line   int    // Source line of the comment
+	Column int    // Source column of the comment
+
+	// Target is the line the directive applies to: its own after code,
+	// otherwise the next line with code, or 0 if there is none
+	Target int
+}
+
 // Entity represents a LangSpace entity, which is the fundamental building block
 // of the language. Each entity has a type and a set of properties that define
 // its behavior and characteristics.
@@ -196,6 +317,7 @@ type BaseEntity struct {
 	metadata   map[string]string
 	line       int
 	column     int
+	source     *Source
 }
 
 // NewBaseEntity creates a new BaseEntity
@@ -211,6 +333,9 @@ func NewBaseEntity(entityType, name string) *BaseEntity {
 func (e *BaseEntity) Type() string { return e.entityType }
 func (e *BaseEntity) Name() string { return e.name }
 
+// SetName renames the entity, e.g. to place it in an import namespace.
+func (e *BaseEntity) SetName(name string) { e.name = name }
+
 // Properties returns a copy of the entity's property map to prevent external mutation.
 func (e *BaseEntity) Properties() map[string]Value {
 	result := make(map[string]Value, len(e.properties))
@@ -224,6 +349,13 @@ func (e *BaseEntity) Column() int                       { return e.column }
 func (e *BaseEntity) SetLocation(line, column int)      { e.line = line; e.column = column }
 func (e *BaseEntity) SetProperty(key string, val Value) { e.properties[key] = val }
 
+// Source returns where the entity was written, or nil if it was not parsed
+// in source-fidelity mode.
+func (e *BaseEntity) Source() *Source { return e.source }
+
+// SetSource records where the entity was written.
+func (e *BaseEntity) SetSource(source *Source) { e.source = source }
+
 func (e *BaseEntity) GetProperty(key string) (Value, bool) {
 	v, ok := e.properties[key]
 	return v, ok
@@ -252,6 +384,95 @@ func (e *BaseEntity) AllMetadata() map[string]string {
 	return result
 }
 
+// TagsMetadataKey is the metadata key of an entity's tags, which the parser
+// sets from its `tags` property as a comma-separated list.
+const TagsMetadataKey = "tags"
+
+// Tags returns the tags of an entity, in the order they were declared.
+func Tags(e Entity) []string {
+	value, ok := e.GetMetadata(TagsMetadataKey)
+	if !ok {
+		return nil
+	}
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag reports whether an entity is tagged with tag.
+func HasTag(e Entity, tag string) bool {
+	for _, t := range Tags(e) {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags replaces the tags of an entity.
+func SetTags(e Entity, tags ...string) {
+	e.SetMetadata(TagsMetadataKey, strings.Join(tags, ","))
+}
+
+// DocMetadataKey is the metadata key of an entity's doc comment, which the
+// parser sets from the comment lines directly above its declaration.
+const DocMetadataKey = "doc"
+
+// Doc returns the doc comment of an entity, without the comment markers.
+func Doc(e Entity) string {
+	doc, _ := e.GetMetadata(DocMetadataKey)
+	return doc
+}
+
+// OwnersMetadataKey and VisibilityMetadataKey are the metadata keys of an
+// entity's owners, which the parser sets from its `owners` property as a
+// comma-separated list, and of its visibility.
+const (
+	OwnersMetadataKey     = "owners"
+	VisibilityMetadataKey = "visibility"
+)
+
+// Visibilities of an entity: who can see it, e.g. in entity listings. Only
+// its owners can modify or execute it either way.
+const (
+	VisibilityPublic  = "public"  // anyone (the default)
+	VisibilityPrivate = "private" // only its owners
+)
+
+// Owners returns the owners of an entity: the users or teams that may
+// modify and execute it. An entity without owners is not restricted.
+func Owners(e Entity) []string {
+	value, ok := e.GetMetadata(OwnersMetadataKey)
+	if !ok {
+		return nil
+	}
+	var owners []string
+	for _, owner := range strings.Split(value, ",") {
+		if owner = strings.TrimSpace(owner); owner != "" {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// SetOwners replaces the owners of an entity.
+func SetOwners(e Entity, owners ...string) {
+	e.SetMetadata(OwnersMetadataKey, strings.Join(owners, ","))
+}
+
+// Visibility returns the visibility of an entity, VisibilityPublic unless
+// it declares otherwise.
+func Visibility(e Entity) string {
+	if v, ok := e.GetMetadata(VisibilityMetadataKey); ok && v != "" {
+		return v
+	}
+	return VisibilityPublic
+}
+
 // FileEntity represents a file entity in LangSpace
 type FileEntity struct {
 	*BaseEntity
@@ -370,6 +591,63 @@ func NewMCPEntity(name string) *MCPEntity {
 	return &MCPEntity{BaseEntity: NewBaseEntity("mcp", name)}
 }
 
+// ProviderEntity declares an LLM provider the runtime constructs and
+// registers under the entity's name
+type ProviderEntity struct {
+	*BaseEntity
+}
+
+// NewProviderEntity creates a new provider entity
+func NewProviderEntity(name string) *ProviderEntity {
+	return &ProviderEntity{BaseEntity: NewBaseEntity("provider", name)}
+}
+
+// PromptEntity is a reusable fragment of prompt text, included in
+// instructions and other strings with {{include "name"}}
+type PromptEntity struct {
+	*BaseEntity
+}
+
+// NewPromptEntity creates a new prompt entity
+func NewPromptEntity(name string) *PromptEntity {
+	return &PromptEntity{BaseEntity: NewBaseEntity("prompt", name)}
+}
+
+// ProfileEntity holds per-environment overlays, e.g. for "prod": blocks
+// like agent "reviewer" { model: "gpt-4o" } whose properties replace those
+// of the named entity when the profile is applied.
+type ProfileEntity struct {
+	*BaseEntity
+	Overlays []Entity
+}
+
+// NewProfileEntity creates a new profile entity
+func NewProfileEntity(name string) *ProfileEntity {
+	return &ProfileEntity{BaseEntity: NewBaseEntity("profile", name)}
+}
+
+// EvalEntity is a suite of test cases run against an intent or pipeline:
+// each case gives an input and the assertions its output must pass.
+type EvalEntity struct {
+	*BaseEntity
+	Cases []*CaseEntity
+}
+
+// NewEvalEntity creates a new eval entity
+func NewEvalEntity(name string) *EvalEntity {
+	return &EvalEntity{BaseEntity: NewBaseEntity("eval", name)}
+}
+
+// CaseEntity is a test case of an eval
+type CaseEntity struct {
+	*BaseEntity
+}
+
+// NewCaseEntity creates a new case entity
+func NewCaseEntity(name string) *CaseEntity {
+	return &CaseEntity{BaseEntity: NewBaseEntity("case", name)}
+}
+
 // ScriptEntity represents a script entity in LangSpace.
 // Scripts enable code-first agent actions — a more efficient alternative to
 // multiple tool calls. Instead of loading full data into the context window
@@ -394,6 +672,17 @@ func NewScriptEntity(name string) *ScriptEntity {
 	return &ScriptEntity{BaseEntity: NewBaseEntity("script", name)}
 }
 
+// OpaqueEntity represents an entity of a type this version does not know.
+// It carries its properties and metadata so it can be written back out unchanged.
+type OpaqueEntity struct {
+	*BaseEntity
+}
+
+// NewOpaqueEntity creates a new opaque entity of the given type
+func NewOpaqueEntity(entityType, name string) *OpaqueEntity {
+	return &OpaqueEntity{BaseEntity: NewBaseEntity(entityType, name)}
+}
+
 // EntityFactory is a function that creates a new entity of a specific type
 type EntityFactory func(name string) Entity
 
@@ -410,7 +699,12 @@ var entityRegistry = map[string]EntityFactory{
 	"config":   func(name string) Entity { return NewConfigEntity() },
 	"mcp":      func(name string) Entity { return NewMCPEntity(name) },
 	"script":   func(name string) Entity { return NewScriptEntity(name) },
+	"provider": func(name string) Entity { return NewProviderEntity(name) },
 	"env":      func(name string) Entity { return NewBaseEntity("env", name) },
+	"profile":  func(name string) Entity { return NewProfileEntity(name) },
+	"prompt":   func(name string) Entity { return NewPromptEntity(name) },
+	"eval":     func(name string) Entity { return NewEvalEntity(name) },
+	"case":     func(name string) Entity { return NewCaseEntity(name) },
 }
 
 // RegisterEntityType registers a new entity type with its factory function.
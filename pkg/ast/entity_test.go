@@ -583,6 +583,43 @@ func TestEntity_Metadata(t *testing.T) {
 	}
 }
 
+func TestTags(t *testing.T) {
+	entity, _ := NewEntity("agent", "reviewer")
+	if tags := Tags(entity); tags != nil {
+		t.Errorf("Tags() of an untagged entity = %v, want nil", tags)
+	}
+
+	SetTags(entity, "code", "review")
+	if got, _ := entity.GetMetadata(TagsMetadataKey); got != "code,review" {
+		t.Errorf("tags metadata = %q, want code,review", got)
+	}
+	if tags := Tags(entity); len(tags) != 2 || tags[0] != "code" || tags[1] != "review" {
+		t.Errorf("Tags() = %v, want [code review]", tags)
+	}
+	if !HasTag(entity, "review") || HasTag(entity, "nightly") {
+		t.Error("HasTag() should report only the entity's tags")
+	}
+}
+
+func TestOwners(t *testing.T) {
+	entity, _ := NewEntity("intent", "refund")
+	if owners := Owners(entity); owners != nil {
+		t.Errorf("Owners() of an unowned entity = %v, want nil", owners)
+	}
+	if v := Visibility(entity); v != VisibilityPublic {
+		t.Errorf("Visibility() default = %q, want %q", v, VisibilityPublic)
+	}
+
+	SetOwners(entity, "team-payments", "alice")
+	if owners := Owners(entity); len(owners) != 2 || owners[0] != "team-payments" || owners[1] != "alice" {
+		t.Errorf("Owners() = %v, want [team-payments alice]", owners)
+	}
+	entity.SetMetadata(VisibilityMetadataKey, VisibilityPrivate)
+	if v := Visibility(entity); v != VisibilityPrivate {
+		t.Errorf("Visibility() = %q, want %q", v, VisibilityPrivate)
+	}
+}
+
 func TestEntity_Location(t *testing.T) {
 	entity, _ := NewEntity("agent", "test")
 
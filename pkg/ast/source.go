@@ -0,0 +1,71 @@
+package ast
+
+// Range is a span of source text.
+type Range struct {
+	Start int // Byte offset of the first character
+	End   int // Byte offset just past the last character
+
+	// Line and Column are the 1-based position of the first character;
+	// Column counts bytes
+	Line   int
+	Column int
+}
+
+// Comment is a comment in source, e.g. # Reviews pull requests.
+type Comment struct {
+	Text  string // The comment, including its # marker
+	Range Range
+}
+
+// Comments are the comments attached to a declaration or property.
+type Comments struct {
+	// Leading are the comments on the lines directly above, in order
+	Leading []Comment
+
+	// Trailing is the comment after the code on its last line, if any
+	Trailing *Comment
+}
+
+// Source records where an entity was written and the comments about it,
+// so that tools which edit source, such as formatters and refactorings,
+// can keep them. The parser records it in source-fidelity mode; entities
+// built any other way have none.
+type Source struct {
+	Range    Range // From the type keyword to the end of the declaration
+	Name     Range // The name, including its quotes; zero if it has none
+	Comments Comments
+
+	// Dangling are the comments inside the declaration that are attached to
+	// none of its properties or nested entities, such as one after the
+	// last property
+	Dangling []Comment
+
+	// Properties are where the properties set in the declaration were
+	// written, by key. Nested entities such as steps have their own Source.
+	Properties map[string]*PropertySource
+}
+
+// PropertySource records where a property was written and the comments
+// about it.
+type PropertySource struct {
+	Range    Range // From the key to the end of the value
+	Key      Range
+	Comments Comments
+}
+
+// SourceOf returns where an entity was written, or nil if it was not
+// parsed in source-fidelity mode.
+func SourceOf(e Entity) *Source {
+	if s, ok := e.(interface{ Source() *Source }); ok {
+		return s.Source()
+	}
+	return nil
+}
+
+// SetSource records where an entity was written. Entities that do not
+// embed BaseEntity are left unchanged.
+func SetSource(e Entity, source *Source) {
+	if s, ok := e.(interface{ SetSource(*Source) }); ok {
+		s.SetSource(source)
+	}
+}
@@ -14,6 +14,7 @@ type Target string
 const (
 	TargetPython     Target = "python"
 	TargetTypeScript Target = "typescript"
+	TargetDocker     Target = "docker"
 )
 
 // Output represents the result of compilation.
@@ -0,0 +1,408 @@
+// Package docker provides Dockerfile and Docker Compose generation for
+// LangSpace, so workflows can be deployed as containers.
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/compile"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// BaseLangSpace runs the workflow files with the langspace binary
+// (`langspace serve`) instead of compiling them to another language.
+const BaseLangSpace compile.Target = "langspace"
+
+// SourceDir is the directory of the output that holds the workflow files of
+// a BaseLangSpace image.
+const SourceDir = "workflow"
+
+func init() {
+	compile.Register(&Generator{})
+}
+
+// Generator generates a Dockerfile and docker-compose.yml that wrap the
+// output of a base target. Provider API keys and variables the workflow
+// reads with env() or secret() are passed through from the host
+// environment.
+type Generator struct {
+	// Base is the target the image runs: compile.TargetPython (the
+	// default), compile.TargetTypeScript, or BaseLangSpace
+	Base compile.Target
+
+	// Sources are the LangSpace files copied into a BaseLangSpace image,
+	// keyed by slash-separated path relative to Entry's directory
+	Sources map[string]string
+
+	// Entry is the file a BaseLangSpace image serves, a key of Sources
+	Entry string
+
+	// Version is the langspace version a BaseLangSpace image installs
+	// (default "latest")
+	Version string
+}
+
+// Target returns the compilation target.
+func (g *Generator) Target() compile.Target {
+	return compile.TargetDocker
+}
+
+// Compile generates the base target's files, a Dockerfile, and a
+// docker-compose.yml for the given workspace.
+func (g *Generator) Compile(ws *workspace.Workspace) (*compile.Output, error) {
+	output := &compile.Output{
+		Files: make(map[string]string),
+	}
+
+	base := g.Base
+	if base == "" {
+		base = compile.TargetPython
+	}
+
+	var image imageSpec
+	switch base {
+	case compile.TargetPython:
+		image = imageSpec{
+			Dockerfile: pythonDockerfile,
+			Env:        []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "LANGCHAIN_TRACING_V2", "LANGCHAIN_API_KEY"},
+		}
+	case compile.TargetTypeScript:
+		image = imageSpec{
+			Dockerfile: typescriptDockerfile,
+			Env:        []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY"},
+		}
+	case BaseLangSpace:
+		if g.Entry == "" || g.Sources[g.Entry] == "" {
+			return nil, fmt.Errorf("docker base %q needs the workflow files", base)
+		}
+		image = imageSpec{
+			Dockerfile: langspaceDockerfile,
+			Env:        providerEnv(ws),
+			Serve:      true,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported docker base: %s (use python, typescript, or langspace)", base)
+	}
+	image.Env = mergeEnv(image.Env, referencedEnv(ws))
+
+	// Include the base target's output
+	if base == BaseLangSpace {
+		for name, content := range g.Sources {
+			output.Files[path.Join(SourceDir, name)] = content
+		}
+	} else {
+		compiler, err := compile.Get(base)
+		if err != nil {
+			return nil, err
+		}
+		baseOutput, err := compiler.Compile(ws)
+		if err != nil {
+			return nil, fmt.Errorf("compiling %s: %w", base, err)
+		}
+		for name, content := range baseOutput.Files {
+			output.Files[name] = content
+		}
+	}
+
+	version := g.Version
+	if version == "" {
+		version = "latest"
+	}
+	data := map[string]interface{}{
+		"Entry":     g.Entry,
+		"SourceDir": SourceDir,
+		"Version":   version,
+		"Env":       image.Env,
+		"Serve":     image.Serve,
+	}
+
+	dockerfile, err := render("Dockerfile", image.Dockerfile, data)
+	if err != nil {
+		return nil, err
+	}
+	output.Files["Dockerfile"] = dockerfile
+
+	compose, err := render("docker-compose.yml", composeTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	output.Files["docker-compose.yml"] = compose
+
+	output.Files[".dockerignore"] = dockerignore
+	output.Files[".env.example"] = envExample(image.Env)
+
+	return output, nil
+}
+
+// imageSpec describes the image for a base target.
+type imageSpec struct {
+	Dockerfile string
+
+	// Env are the environment variables passed through from the host
+	Env []string
+
+	// Serve reports whether the container runs a server
+	Serve bool
+}
+
+// providerEnvVars are the variables each provider type reads its
+// credentials from.
+var providerEnvVars = map[string][]string{
+	"anthropic": {"ANTHROPIC_API_KEY"},
+	"openai":    {"OPENAI_API_KEY"},
+	"gemini":    {"GEMINI_API_KEY"},
+	"bedrock":   {"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION"},
+}
+
+// providerEnv returns the credential variables of the providers that serve
+// the workspace's agents and of its provider entities.
+func providerEnv(ws *workspace.Workspace) []string {
+	defaultModel := "claude"
+	for _, config := range ws.GetEntitiesByType("config") {
+		if model := stringProp(config, "default_model"); model != "" {
+			defaultModel = model
+		}
+	}
+
+	types := make(map[string]bool)
+	for _, agent := range ws.GetEntitiesByType("agent") {
+		model := stringProp(agent, "model")
+		if model == "" {
+			model = defaultModel
+		}
+		if t := modelProvider(model); t != "" {
+			types[t] = true
+		}
+	}
+	for _, provider := range ws.GetEntitiesByType("provider") {
+		// Keys set in the entity are picked up by referencedEnv
+		if _, ok := provider.GetProperty("api_key"); !ok {
+			types[stringProp(provider, "type")] = true
+		}
+	}
+
+	var env []string
+	for t := range types {
+		env = append(env, providerEnvVars[t]...)
+	}
+	return mergeEnv(env, nil)
+}
+
+// modelProvider returns the provider type of a model family in
+// runtime.DefaultModelCapabilities, or "" for unknown models.
+func modelProvider(model string) string {
+	best, provider := "", ""
+	for prefix, caps := range runtime.DefaultModelCapabilities {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, provider = prefix, caps.Provider
+		}
+	}
+	return provider
+}
+
+// templatePattern matches a {{...}} template in a string, and
+// templateEnvPattern an env('NAME') or secret('NAME') call in one.
+var (
+	templatePattern    = regexp.MustCompile(`\{\{.*?\}\}`)
+	templateEnvPattern = regexp.MustCompile(`\b(?:env|secret)\(\s*["']([^"']+)["']\s*\)`)
+)
+
+// referencedEnv returns the variables read with env("NAME") or
+// secret("NAME") anywhere in the workspace, including in string templates
+// such as "Bearer {{env('TOKEN')}}".
+func referencedEnv(ws *workspace.Workspace) []string {
+	seen := make(map[string]bool)
+	var visitEntity func(e ast.Entity)
+	var visitValue func(v ast.Value)
+	visitValue = func(v ast.Value) {
+		switch val := v.(type) {
+		case ast.StringValue:
+			for _, tmpl := range templatePattern.FindAllString(val.Value, -1) {
+				for _, m := range templateEnvPattern.FindAllStringSubmatch(tmpl, -1) {
+					seen[m[1]] = true
+				}
+			}
+		case ast.ReferenceValue:
+			if (val.Type == "env" || val.Type == "secret") && val.Name != "" {
+				seen[val.Name] = true
+			}
+		case ast.FunctionCallValue:
+			if (val.Function == "env" || val.Function == "secret") && len(val.Arguments) > 0 {
+				if name, ok := val.Arguments[0].(ast.StringValue); ok && name.Value != "" {
+					seen[name.Value] = true
+				}
+			}
+			for _, arg := range val.Arguments {
+				visitValue(arg)
+			}
+		case ast.ArrayValue:
+			for _, elem := range val.Elements {
+				visitValue(elem)
+			}
+		case ast.ObjectValue:
+			for _, prop := range val.Properties {
+				visitValue(prop)
+			}
+		case ast.NestedEntityValue:
+			if val.Entity != nil {
+				visitEntity(val.Entity)
+			}
+		case ast.MethodCallValue:
+			visitValue(val.Object)
+			for _, arg := range val.Arguments {
+				visitValue(arg)
+			}
+			if val.InlineBody != nil {
+				visitEntity(val.InlineBody)
+			}
+		case ast.ComparisonValue:
+			visitValue(val.Left)
+			visitValue(val.Right)
+		case ast.CoalesceValue:
+			visitValue(val.Left)
+			visitValue(val.Right)
+		case ast.ArithmeticValue:
+			visitValue(val.Left)
+			visitValue(val.Right)
+		case ast.LogicalValue:
+			visitValue(val.Left)
+			visitValue(val.Right)
+		case ast.NotValue:
+			visitValue(val.Operand)
+		case ast.BranchValue:
+			visitValue(val.Condition)
+			for _, c := range val.Cases {
+				visitValue(c)
+			}
+		}
+	}
+	visitEntity = func(e ast.Entity) {
+		for _, prop := range e.Properties() {
+			visitValue(prop)
+		}
+		if p, ok := e.(*ast.PipelineEntity); ok {
+			for _, step := range p.Steps {
+				visitEntity(step)
+			}
+		}
+	}
+	for _, e := range ws.GetEntities() {
+		visitEntity(e)
+	}
+
+	env := make([]string, 0, len(seen))
+	for name := range seen {
+		env = append(env, name)
+	}
+	return env
+}
+
+// mergeEnv returns the variables of a and b, sorted and without duplicates.
+func mergeEnv(a, b []string) []string {
+	seen := make(map[string]bool)
+	var env []string
+	for _, name := range append(append([]string(nil), a...), b...) {
+		if !seen[name] {
+			seen[name] = true
+			env = append(env, name)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+func envExample(env []string) string {
+	var buf strings.Builder
+	for _, name := range env {
+		fmt.Fprintf(&buf, "%s=\n", name)
+	}
+	return buf.String()
+}
+
+func render(name, text string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New(name).Parse(text))
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("generating %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func stringProp(entity ast.Entity, key string) string {
+	if val, exists := entity.GetProperty(key); exists {
+		if sv, ok := val.(ast.StringValue); ok {
+			return sv.Value
+		}
+	}
+	return ""
+}
+
+// Templates
+
+const pythonDockerfile = `# LangSpace Generated Dockerfile
+# Generated by: langspace compile --target docker --base python
+FROM python:3.12-slim
+
+WORKDIR /app
+COPY requirements.txt .
+RUN pip install --no-cache-dir -r requirements.txt
+COPY workflow.py .
+
+ENTRYPOINT ["python", "workflow.py"]
+`
+
+const typescriptDockerfile = `# LangSpace Generated Dockerfile
+# Generated by: langspace compile --target docker --base typescript
+FROM node:20-slim
+
+WORKDIR /app
+COPY package.json .
+RUN npm install
+COPY index.ts .
+
+ENTRYPOINT ["npx", "ts-node", "index.ts"]
+`
+
+const langspaceDockerfile = `# LangSpace Generated Dockerfile
+# Generated by: langspace compile --target docker --base langspace
+FROM golang:1.25 AS build
+RUN CGO_ENABLED=0 go install github.com/shellkjell/langspace/cmd/langspace@{{.Version}}
+
+FROM gcr.io/distroless/static-debian12
+COPY --from=build /go/bin/langspace /usr/local/bin/langspace
+WORKDIR /app
+COPY {{.SourceDir}}/ ./
+
+EXPOSE 8080
+ENTRYPOINT ["langspace"]
+CMD ["serve", "-file", "{{.Entry}}", "-port", "8080"]
+`
+
+const composeTemplate = `# LangSpace Generated Compose file
+# Variables are read from the host environment or a .env file
+services:
+  workflow:
+    build: .
+{{- if .Env}}
+    environment:
+{{- range .Env}}
+      {{.}}: ${{"{"}}{{.}}:-{{"}"}}
+{{- end}}
+{{- end}}
+{{- if .Serve}}
+    ports:
+      - "8080:8080"
+    restart: unless-stopped
+{{- end}}
+`
+
+const dockerignore = `.env
+`
@@ -0,0 +1,166 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/compile"
+	_ "github.com/shellkjell/langspace/pkg/compile/python"
+	_ "github.com/shellkjell/langspace/pkg/compile/typescript"
+	"github.com/shellkjell/langspace/pkg/workspace/testutil"
+)
+
+const testWorkflow = `
+mcp "database" {
+	command: "npx"
+	args: ["-y", "@modelcontextprotocol/server-postgres", env("DATABASE_URL")]
+}
+
+tool "search" {
+	command: "search --key {{env('SEARCH_KEY')}}"
+}
+
+agent "analyst" {
+	model: "gpt-4o"
+	tools: [tool("search"), database.query]
+	instruction: secret("ANALYST_PROMPT")
+}
+
+intent "analyze" {
+	use: agent("analyst")
+	input: "the sales table"
+}
+`
+
+func TestGenerator_Target(t *testing.T) {
+	if target := (&Generator{}).Target(); target != compile.TargetDocker {
+		t.Errorf("expected target %q, got %q", compile.TargetDocker, target)
+	}
+	if _, err := compile.Get(compile.TargetDocker); err != nil {
+		t.Errorf("expected the generator to be registered: %v", err)
+	}
+}
+
+func TestGenerator_Python(t *testing.T) {
+	output, err := (&Generator{}).Compile(testutil.WorkspaceFrom(t, testWorkflow))
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+
+	for _, name := range []string{"workflow.py", "requirements.txt", "Dockerfile", "docker-compose.yml", ".dockerignore", ".env.example"} {
+		if _, ok := output.Files[name]; !ok {
+			t.Errorf("expected %s in output", name)
+		}
+	}
+	dockerfile := output.Files["Dockerfile"]
+	for _, want := range []string{"FROM python:3.12-slim", "COPY workflow.py .", `ENTRYPOINT ["python", "workflow.py"]`} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("expected %q in Dockerfile, got:\n%s", want, dockerfile)
+		}
+	}
+
+	// The base's keys and the variables the workflow reads are passed through
+	compose := output.Files["docker-compose.yml"]
+	for _, name := range []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "DATABASE_URL", "SEARCH_KEY", "ANALYST_PROMPT"} {
+		if want := name + ": ${" + name + ":-}"; !strings.Contains(compose, want) {
+			t.Errorf("expected %q in docker-compose.yml, got:\n%s", want, compose)
+		}
+		if !strings.Contains(output.Files[".env.example"], name+"=\n") {
+			t.Errorf("expected %s in .env.example, got:\n%s", name, output.Files[".env.example"])
+		}
+	}
+	if strings.Contains(compose, "ports:") {
+		t.Errorf("expected no ports for a run-once image, got:\n%s", compose)
+	}
+}
+
+func TestGenerator_TypeScript(t *testing.T) {
+	output, err := (&Generator{Base: compile.TargetTypeScript}).Compile(testutil.WorkspaceFrom(t, testWorkflow))
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	if _, ok := output.Files["index.ts"]; !ok {
+		t.Error("expected index.ts in output")
+	}
+	if dockerfile := output.Files["Dockerfile"]; !strings.Contains(dockerfile, "FROM node:20-slim") || !strings.Contains(dockerfile, "COPY index.ts .") {
+		t.Errorf("expected a Node image, got:\n%s", dockerfile)
+	}
+	if strings.Contains(output.Files["docker-compose.yml"], "LANGCHAIN_API_KEY") {
+		t.Error("expected no LangChain variables for the typescript base")
+	}
+}
+
+func TestGenerator_LangSpace(t *testing.T) {
+	g := &Generator{
+		Base:    BaseLangSpace,
+		Sources: map[string]string{"workflow.ls": testWorkflow, "lib/shared.ls": "# shared"},
+		Entry:   "workflow.ls",
+		Version: "v1.2.0",
+	}
+	output, err := g.Compile(testutil.WorkspaceFrom(t, testWorkflow))
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+
+	if output.Files["workflow/workflow.ls"] != testWorkflow || output.Files["workflow/lib/shared.ls"] != "# shared" {
+		t.Errorf("expected the sources under %s/, got %v", SourceDir, output.Files)
+	}
+	dockerfile := output.Files["Dockerfile"]
+	for _, want := range []string{
+		"go install github.com/shellkjell/langspace/cmd/langspace@v1.2.0",
+		"COPY workflow/ ./",
+		`CMD ["serve", "-file", "workflow.ls", "-port", "8080"]`,
+	} {
+		if !strings.Contains(dockerfile, want) {
+			t.Errorf("expected %q in Dockerfile, got:\n%s", want, dockerfile)
+		}
+	}
+
+	// Only the key of the provider the agent uses is passed through
+	compose := output.Files["docker-compose.yml"]
+	if !strings.Contains(compose, "OPENAI_API_KEY") || strings.Contains(compose, "ANTHROPIC_API_KEY") {
+		t.Errorf("expected only the OpenAI key, got:\n%s", compose)
+	}
+	if !strings.Contains(compose, `- "8080:8080"`) || !strings.Contains(compose, "restart: unless-stopped") {
+		t.Errorf("expected a served port and restart policy, got:\n%s", compose)
+	}
+}
+
+func TestGenerator_Errors(t *testing.T) {
+	ws := testutil.WorkspaceFrom(t, testWorkflow)
+	if _, err := (&Generator{Base: BaseLangSpace}).Compile(ws); err == nil {
+		t.Error("expected an error for the langspace base without sources")
+	}
+	if _, err := (&Generator{Base: "rust"}).Compile(ws); err == nil {
+		t.Error("expected an error for an unsupported base")
+	}
+}
+
+func TestProviderEnv(t *testing.T) {
+	ws := testutil.WorkspaceFrom(t, `
+config {
+	default_model: "gemini-1.5-pro"
+}
+
+provider "aws" {
+	type: "bedrock"
+}
+
+provider "keyed" {
+	type: "anthropic"
+	api_key: env("TEAM_ANTHROPIC_KEY")
+}
+
+agent "defaulted" {
+	instruction: "Uses the default model"
+}
+`)
+	want := []string{"AWS_ACCESS_KEY_ID", "AWS_REGION", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "GEMINI_API_KEY"}
+	if got := providerEnv(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("providerEnv = %v, want %v", got, want)
+	}
+	if got := mergeEnv(referencedEnv(ws), nil); !reflect.DeepEqual(got, []string{"TEAM_ANTHROPIC_KEY"}) {
+		t.Errorf("referencedEnv = %v, want [TEAM_ANTHROPIC_KEY]", got)
+	}
+}
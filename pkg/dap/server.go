@@ -0,0 +1,869 @@
+// Package dap implements a Debug Adapter Protocol server for LangSpace
+// pipelines, so editors such as VS Code can set breakpoints on steps in .ls
+// files, inspect variables and step outputs, edit them, and continue or
+// step over. It drives a runtime.DebugSession.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// threadID is the id of the only thread: the pipeline's execution.
+const threadID = 1
+
+// RuntimeFunc creates the runtime that executes a launched workspace.
+type RuntimeFunc func(ws *workspace.Workspace) (*runtime.Runtime, error)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithRuntime sets how the server creates the runtime of a launched
+// workspace, e.g. to register providers. By default it is runtime.New with
+// no options.
+func WithRuntime(fn RuntimeFunc) Option {
+	return func(s *Server) {
+		s.newRuntime = fn
+	}
+}
+
+// Server handles DAP requests for one debug session: a launch of a
+// pipeline, then requests about it until the client disconnects.
+type Server struct {
+	newRuntime RuntimeFunc
+
+	out     io.Writer
+	writeMu sync.Mutex
+	seq     int
+
+	mu          sync.Mutex
+	launch      *launchArgs
+	ws          *workspace.Workspace
+	rt          *runtime.Runtime
+	pipeline    ast.Entity
+	breakpoints map[string][]string // source path -> steps
+	session     *runtime.DebugSession
+	cancel      context.CancelFunc
+	done        chan struct{}
+	stopping    bool
+
+	// frame is the pause the execution is in, if it is paused, and handles
+	// the values its variable references refer to
+	frame   *runtime.DebugFrame
+	handles []handle
+}
+
+// handle is a value the client can expand by its variable reference.
+type handle struct {
+	value interface{}
+
+	// frame and scope are set for a scope the client can edit: that of
+	// the variables or the step outputs of the current pause
+	frame *runtime.DebugFrame
+	scope string
+}
+
+// launchArgs are the arguments of a launch request, as set in the
+// client's launch configuration.
+type launchArgs struct {
+	// Program is the .ls file to load, with its imports
+	Program string `json:"program"`
+
+	// Pipeline is the name of the pipeline to debug; it may be left out if
+	// the file has only one
+	Pipeline string `json:"pipeline"`
+
+	Input  interface{}            `json:"input"`
+	Params map[string]interface{} `json:"params"`
+
+	// StopOnEntry pauses before the first step
+	StopOnEntry bool `json:"stopOnEntry"`
+}
+
+// NewServer creates a new DAP server.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		newRuntime: func(ws *workspace.Workspace) (*runtime.Runtime, error) {
+			return runtime.New(ws), nil
+		},
+		breakpoints: make(map[string][]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// message is a DAP request, response, or event.
+type message struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// Serve reads requests from in and writes responses and events to out
+// until the client disconnects or in ends. A running execution is stopped
+// before it returns.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	defer s.terminate()
+
+	r := textproto.NewReader(bufio.NewReader(in))
+	for {
+		req, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if s.handle(req) {
+			return nil
+		}
+	}
+}
+
+// readMessage reads a message framed by a Content-Length header.
+func readMessage(r *textproto.Reader) (*message, error) {
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.R, data); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("decoding message: %w", err)
+	}
+	return &msg, nil
+}
+
+// handle answers a request. It returns true when the client disconnects.
+func (s *Server) handle(req *message) bool {
+	var body interface{}
+	var err error
+
+	switch req.Command {
+	case "initialize":
+		body = map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsSetVariable":              true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}
+		s.respond(req, body, nil)
+		s.event("initialized", nil)
+		return false
+	case "launch":
+		err = s.handleLaunch(req.Arguments)
+	case "setBreakpoints":
+		body, err = s.handleSetBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		body = map[string]interface{}{}
+	case "configurationDone":
+		err = s.start()
+	case "threads":
+		body = s.handleThreads()
+	case "stackTrace":
+		body, err = s.handleStackTrace()
+	case "scopes":
+		body, err = s.handleScopes(req.Arguments)
+	case "variables":
+		body, err = s.handleVariables(req.Arguments)
+	case "setVariable":
+		body, err = s.handleSetVariable(req.Arguments)
+	case "evaluate":
+		body, err = s.handleEvaluate(req.Arguments)
+	case "continue":
+		body = map[string]bool{"allThreadsContinued": true}
+		err = s.resume(runtime.DebugContinue)
+	case "next", "stepIn", "stepOut":
+		err = s.resume(runtime.DebugStep)
+	case "skip":
+		// Not part of DAP: clients send it as a custom request
+		err = s.resume(runtime.DebugSkip)
+	case "pause":
+		err = s.pause()
+	case "terminate":
+		s.terminate()
+	case "disconnect":
+		s.terminate()
+		s.respond(req, nil, nil)
+		return true
+	default:
+		err = fmt.Errorf("unsupported request %q", req.Command)
+	}
+
+	s.respond(req, body, err)
+	return false
+}
+
+func (s *Server) handleLaunch(raw json.RawMessage) error {
+	var args launchArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return err
+	}
+	if args.Program == "" {
+		return fmt.Errorf("launch requires a program: the .ls file to debug")
+	}
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	args.Program = program
+
+	ws := workspace.New()
+	if err := workspace.NewLoader(ws).Load(program); err != nil {
+		return err
+	}
+	pipeline, err := findPipeline(ws, args.Pipeline)
+	if err != nil {
+		return err
+	}
+	rt, err := s.newRuntime(ws)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.launch != nil {
+		_ = rt.Close()
+		return fmt.Errorf("already launched")
+	}
+	s.launch, s.ws, s.rt, s.pipeline = &args, ws, rt, pipeline
+	return nil
+}
+
+// findPipeline returns the named pipeline, or without a name, the only one.
+func findPipeline(ws *workspace.Workspace, name string) (ast.Entity, error) {
+	if name != "" {
+		pipeline, ok := ws.GetEntityByName("pipeline", name)
+		if !ok {
+			return nil, fmt.Errorf("pipeline %q not found", name)
+		}
+		return pipeline, nil
+	}
+	pipelines := ws.GetEntitiesByType("pipeline")
+	if len(pipelines) != 1 {
+		return nil, fmt.Errorf("the program has %d pipelines; set pipeline in the launch configuration", len(pipelines))
+	}
+	return pipelines[0], nil
+}
+
+func (s *Server) handleSetBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]int, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		lines[i] = bp.Line
+	}
+	located, err := locateSteps(path, lines)
+
+	var steps []string
+	breakpoints := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		bp := map[string]interface{}{"verified": false, "line": line}
+		switch {
+		case err != nil:
+			bp["message"] = err.Error()
+		case located[i].step == "":
+			bp["message"] = "breakpoints must be on a step of a pipeline"
+		default:
+			bp["verified"] = true
+			bp["line"] = located[i].line
+			steps = append(steps, located[i].step)
+		}
+		breakpoints[i] = bp
+	}
+
+	s.mu.Lock()
+	s.breakpoints[path] = steps
+	session := s.session
+	all := s.allBreakpoints()
+	s.mu.Unlock()
+	if session != nil {
+		session.SetBreakpoints(all...)
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// allBreakpoints returns the steps with breakpoints in any source.
+func (s *Server) allBreakpoints() []string {
+	var steps []string
+	for _, st := range s.breakpoints {
+		steps = append(steps, st...)
+	}
+	return steps
+}
+
+// location is the step a line of a source belongs to, if any, and the
+// line the step starts on.
+type location struct {
+	step string
+	line int
+}
+
+// locateSteps finds the pipeline step each line of a file belongs to: the
+// step that starts on it or the closest one before it, unless another
+// entity starts in between.
+func locateSteps(path string, lines []int) ([]location, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entities, _, err := parser.New(string(data)).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []location
+	for _, e := range entities {
+		starts = append(starts, location{line: e.Line()})
+		if pipeline, ok := e.(*ast.PipelineEntity); ok {
+			for _, step := range pipeline.Steps {
+				starts = append(starts, location{step: step.Name(), line: step.Line()})
+			}
+		}
+	}
+	sort.SliceStable(starts, func(i, j int) bool { return starts[i].line < starts[j].line })
+
+	located := make([]location, len(lines))
+	for i, line := range lines {
+		n := sort.Search(len(starts), func(j int) bool { return starts[j].line > line })
+		if n > 0 {
+			located[i] = starts[n-1]
+		}
+	}
+	return located, nil
+}
+
+// start runs the launched pipeline under a debug session.
+func (s *Server) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.launch == nil {
+		return fmt.Errorf("nothing launched")
+	}
+	if s.session != nil {
+		return nil
+	}
+
+	session := runtime.NewDebugSession(s.allBreakpoints()...)
+	if s.launch.StopOnEntry {
+		session.Pause()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.session, s.cancel, s.done = session, cancel, make(chan struct{})
+
+	opts := []runtime.ExecuteOption{
+		runtime.WithDebugger(session),
+		runtime.WithStreamHandler(&outputHandler{server: s}),
+	}
+	if s.launch.Input != nil {
+		opts = append(opts, runtime.WithInput(s.launch.Input))
+	}
+	if s.launch.Params != nil {
+		opts = append(opts, runtime.WithParams(s.launch.Params))
+	}
+
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		for frame := range session.Paused() {
+			s.paused(frame)
+		}
+	}()
+	go func() {
+		defer close(s.done)
+		result, err := s.rt.Execute(ctx, s.pipeline, opts...)
+		session.Close()
+		<-watching
+		s.finished(result, err)
+	}()
+	return nil
+}
+
+// paused records a pause and tells the client, unless the session is
+// being stopped.
+func (s *Server) paused(frame *runtime.DebugFrame) {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		s.session.Resume(runtime.DebugStop)
+		return
+	}
+	s.frame, s.handles = frame, nil
+	reason := "step"
+	history := s.session.History()
+	switch {
+	case containsStep(s.allBreakpoints(), frame.Step):
+		reason = "breakpoint"
+	case len(history) == 1 && s.launch.StopOnEntry:
+		reason = "entry"
+	}
+	s.mu.Unlock()
+
+	s.event("stopped", map[string]interface{}{
+		"reason":            reason,
+		"description":       fmt.Sprintf("Paused before step %q", frame.Step),
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+}
+
+func containsStep(steps []string, step string) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// finished reports the end of the execution.
+func (s *Server) finished(result *runtime.ExecutionResult, err error) {
+	exitCode := 0
+	switch {
+	case err != nil:
+		exitCode = 1
+		s.output("stderr", fmt.Sprintf("Execution failed: %v\n", err))
+	case result != nil && result.Output != nil:
+		s.output("console", fmt.Sprintf("Output: %s\n", formatValue(result.Output)))
+	}
+	s.event("exited", map[string]int{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+// resume continues the paused execution.
+func (s *Server) resume(action runtime.DebugAction) error {
+	s.mu.Lock()
+	if s.frame == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("the execution is not paused")
+	}
+	s.frame, s.handles = nil, nil
+	session := s.session
+	s.mu.Unlock()
+	session.Resume(action)
+	return nil
+}
+
+// pause makes the running execution pause before its next step.
+func (s *Server) pause() error {
+	s.mu.Lock()
+	session := s.session
+	s.mu.Unlock()
+	if session == nil {
+		return fmt.Errorf("nothing is running")
+	}
+	session.Pause()
+	return nil
+}
+
+// terminate stops the execution, if it runs, and waits for it to end.
+func (s *Server) terminate() {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	s.stopping = true
+	paused := s.frame != nil
+	s.frame, s.handles = nil, nil
+	session, cancel, done, rt := s.session, s.cancel, s.done, s.rt
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if paused {
+		session.Resume(runtime.DebugStop)
+	}
+	if done != nil {
+		<-done
+	}
+	if rt != nil {
+		_ = rt.Close()
+	}
+}
+
+func (s *Server) handleThreads() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := "pipeline"
+	if s.pipeline != nil {
+		name = fmt.Sprintf("pipeline %q", s.pipeline.Name())
+	}
+	return map[string]interface{}{
+		"threads": []map[string]interface{}{{"id": threadID, "name": name}},
+	}
+}
+
+// handleStackTrace returns the paused step as the top frame and every
+// earlier step below it, so the state before each can be inspected.
+func (s *Server) handleStackTrace() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frame == nil {
+		return nil, fmt.Errorf("the execution is not paused")
+	}
+	source := map[string]string{
+		"name": filepath.Base(s.launch.Program),
+		"path": s.launch.Program,
+	}
+	history := s.session.History()
+	frames := make([]map[string]interface{}, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		f := history[i]
+		frame := map[string]interface{}{
+			"id":     i + 1,
+			"name":   fmt.Sprintf("step %q", f.Step),
+			"source": source,
+			"line":   f.Line,
+			"column": f.Column,
+		}
+		if f != s.frame {
+			frame["presentationHint"] = "subtle"
+		}
+		frames = append(frames, frame)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// historyFrame returns the frame of a stack frame id.
+func (s *Server) historyFrame(id int) (*runtime.DebugFrame, error) {
+	if s.frame == nil {
+		return nil, fmt.Errorf("the execution is not paused")
+	}
+	history := s.session.History()
+	if id == 0 {
+		return s.frame, nil
+	}
+	if id < 1 || id > len(history) {
+		return nil, fmt.Errorf("unknown frame %d", id)
+	}
+	return history[id-1], nil
+}
+
+func (s *Server) handleScopes(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame, err := s.historyFrame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	step := map[string]interface{}{"input": frame.Input}
+	if frame.InputError != "" {
+		step["input_error"] = frame.InputError
+	}
+	outputs := make(map[string]interface{})
+	for name, v := range frame.Snapshot.StepOutputs {
+		if !strings.HasSuffix(name, ".output") {
+			outputs[name] = v
+		}
+	}
+	editable := frame
+	if frame != s.frame {
+		editable = nil
+	}
+	return map[string]interface{}{
+		"scopes": []map[string]interface{}{
+			{"name": "Step", "variablesReference": s.newHandle(handle{value: step}), "presentationHint": "arguments"},
+			{"name": "Variables", "variablesReference": s.newHandle(handle{value: frame.Snapshot.Variables, frame: editable, scope: "variables"}), "presentationHint": "locals"},
+			{"name": "Step Outputs", "variablesReference": s.newHandle(handle{value: outputs, frame: editable, scope: "outputs"})},
+		},
+	}, nil
+}
+
+// newHandle returns a variable reference to h.
+func (s *Server) newHandle(h handle) int {
+	s.handles = append(s.handles, h)
+	return len(s.handles)
+}
+
+func (s *Server) handleVariables(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.lookup(args.VariablesReference)
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]map[string]interface{}, 0)
+	for _, c := range children(h.value) {
+		variables = append(variables, s.variable(c.name, c.value))
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// lookup returns the value of a variable reference.
+func (s *Server) lookup(ref int) (handle, error) {
+	if ref < 1 || ref > len(s.handles) {
+		return handle{}, fmt.Errorf("unknown variable reference %d", ref)
+	}
+	return s.handles[ref-1], nil
+}
+
+// variable describes a value for the client, with a reference to its
+// children if it has any.
+func (s *Server) variable(name string, value interface{}) map[string]interface{} {
+	v := map[string]interface{}{
+		"name":               name,
+		"value":              formatValue(value),
+		"variablesReference": 0,
+	}
+	if len(children(value)) > 0 {
+		v["variablesReference"] = s.newHandle(handle{value: value})
+	}
+	return v
+}
+
+func (s *Server) handleSetVariable(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.lookup(args.VariablesReference)
+	if err != nil {
+		return nil, err
+	}
+	if h.frame == nil || h.frame != s.frame {
+		return nil, fmt.Errorf("only the variables and step outputs of the paused step can be set")
+	}
+
+	value := parseValue(args.Value)
+	switch h.scope {
+	case "variables":
+		err = h.frame.SetVariable(args.Name, value)
+	case "outputs":
+		err = h.frame.SetStepOutput(args.Name, value)
+		h.value.(map[string]interface{})[args.Name] = value
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.variable(args.Name, value), nil
+}
+
+// handleEvaluate looks up a variable or step output by name, for hovers
+// and watches.
+func (s *Server) handleEvaluate(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame, err := s.historyFrame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(strings.TrimSpace(args.Expression), "$")
+	value, ok := frame.Snapshot.Variables[name]
+	if !ok {
+		value, ok = frame.Snapshot.StepOutputs[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no variable or step output %q", name)
+	}
+	v := s.variable(name, value)
+	return map[string]interface{}{"result": v["value"], "variablesReference": v["variablesReference"]}, nil
+}
+
+// child is a named part of a value.
+type child struct {
+	name  string
+	value interface{}
+}
+
+// children returns the entries of an object, sorted by key, or the
+// elements of a list.
+func children(value interface{}) []child {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		c := make([]child, len(keys))
+		for i, k := range keys {
+			c[i] = child{k, v[k]}
+		}
+		return c
+	case []interface{}:
+		c := make([]child, len(v))
+		for i, e := range v {
+			c[i] = child{strconv.Itoa(i), e}
+		}
+		return c
+	}
+	return nil
+}
+
+// formatValue shows a value the way it would be written in JSON, with
+// objects and lists summarized.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return fmt.Sprintf("object (%d)", len(v))
+	case []interface{}:
+		return fmt.Sprintf("list (%d)", len(v))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// parseValue parses a value the client set: JSON if it is valid JSON, and
+// text otherwise.
+func parseValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+func (s *Server) respond(req *message, body interface{}, err error) {
+	resp := response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+		resp.Body = nil
+	}
+	s.write(func(seq int) interface{} {
+		resp.Seq = seq
+		return resp
+	})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.write(func(seq int) interface{} {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// output sends text for the client's debug console.
+func (s *Server) output(category, text string) {
+	s.event("output", map[string]string{"category": category, "output": text})
+}
+
+// write sends a message, numbered in the order messages are sent.
+func (s *Server) write(msg func(seq int) interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	data, _ := json.Marshal(msg(s.seq))
+	_, _ = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// outputHandler sends the execution's streamed output to the client.
+type outputHandler struct {
+	server *Server
+}
+
+func (h *outputHandler) OnChunk(chunk runtime.StreamChunk) {
+	if chunk.Content != "" {
+		h.server.output("stdout", chunk.Content)
+	}
+}
+
+func (h *outputHandler) OnProgress(event runtime.ProgressEvent) {}
+
+func (h *outputHandler) OnComplete(*runtime.CompletionResponse) {}
+
+func (h *outputHandler) OnError(error) {}
@@ -0,0 +1,276 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const program = `agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "draft" {
+	step "outline" {
+		use: agent("writer")
+		input: $input
+	}
+
+	step "write" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+}
+`
+
+// client sends requests to a server and reads what it sends back.
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]interface{}
+	seq      int
+
+	// events are those read while waiting for a response
+	events []map[string]interface{}
+}
+
+func newClient(t *testing.T, s *Server) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(inR, outW)
+		_ = outW.Close()
+	}()
+	c := &client{t: t, in: inW, messages: make(chan map[string]interface{}, 100)}
+	go func() {
+		defer close(c.messages)
+		r := textproto.NewReader(bufio.NewReader(outR))
+		for {
+			header, err := r.ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r.R, data); err != nil {
+				return
+			}
+			var m map[string]interface{}
+			_ = json.Unmarshal(data, &m)
+			c.messages <- m
+		}
+	}()
+	t.Cleanup(func() {
+		_ = inW.Close()
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("Serve() error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("the server did not stop")
+		}
+	})
+	return c
+}
+
+func (c *client) read() map[string]interface{} {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server closed its output")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+		return nil
+	}
+}
+
+// request sends a request and returns the body of its response, failing
+// the test if it failed.
+func (c *client) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	resp := c.send(command, args)
+	if resp["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, resp["message"])
+	}
+	body, _ := resp["body"].(map[string]interface{})
+	return body
+}
+
+// send sends a request and returns its response.
+func (c *client) send(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if _, err := io.WriteString(c.in, "Content-Length: "+strconv.Itoa(len(data))+"\r\n\r\n"+string(data)); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		m := c.read()
+		if m["type"] == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m["request_seq"] != float64(c.seq) {
+			c.t.Fatalf("unexpected response %v", m)
+		}
+		return m
+	}
+}
+
+// waitEvent returns the next event of a kind, read or to read.
+func (c *client) waitEvent(name string) map[string]interface{} {
+	c.t.Helper()
+	for {
+		for i, e := range c.events {
+			if e["event"] == name {
+				c.events = append(c.events[:i], c.events[i+1:]...)
+				body, _ := e["body"].(map[string]interface{})
+				return body
+			}
+		}
+		c.events = append(c.events, c.read())
+	}
+}
+
+// variables returns the variables of a reference by name.
+func (c *client) variables(ref interface{}) map[string]map[string]interface{} {
+	c.t.Helper()
+	body := c.request("variables", map[string]interface{}{"variablesReference": ref})
+	vars := make(map[string]map[string]interface{})
+	for _, v := range body["variables"].([]interface{}) {
+		v := v.(map[string]interface{})
+		vars[v["name"].(string)] = v
+	}
+	return vars
+}
+
+func TestServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "draft.ls")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := runtime.NewMockProvider(runtime.WithMockResponses(
+		runtime.MockResponse{Content: "an outline"},
+		runtime.MockResponse{Content: "a draft"},
+	))
+	s := NewServer(WithRuntime(func(ws *workspace.Workspace) (*runtime.Runtime, error) {
+		return runtime.New(ws, runtime.WithProvider("mock", provider)), nil
+	}))
+	c := newClient(t, s)
+
+	if caps := c.request("initialize", map[string]string{"adapterID": "langspace"}); caps["supportsSetVariable"] != true {
+		t.Errorf("expected setVariable to be supported, got %v", caps)
+	}
+	c.waitEvent("initialized")
+	c.request("launch", map[string]interface{}{"program": path, "input": "topic"})
+
+	// Lines inside a step map to it; lines outside any step are unverified
+	body := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 13}, {"line": 2}},
+	})
+	bps := body["breakpoints"].([]interface{})
+	if bp := bps[0].(map[string]interface{}); bp["verified"] != true || bp["line"] != float64(11) {
+		t.Errorf("expected a breakpoint on step write at line 11, got %v", bp)
+	}
+	if bp := bps[1].(map[string]interface{}); bp["verified"] != false {
+		t.Errorf("expected a breakpoint outside steps to be unverified, got %v", bp)
+	}
+
+	if resp := c.send("continue", nil); resp["success"] != false {
+		t.Error("expected continue to fail before the execution pauses")
+	}
+	c.request("configurationDone", nil)
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "breakpoint" {
+		t.Errorf("expected a stop at the breakpoint, got %v", stopped)
+	}
+
+	frames := c.request("stackTrace", map[string]int{"threadId": 1})["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Fatalf("expected the paused step and the one before it, got %v", frames)
+	}
+	top := frames[0].(map[string]interface{})
+	if top["name"] != `step "write"` || top["line"] != float64(11) {
+		t.Errorf("unexpected top frame %v", top)
+	}
+
+	scopes := c.request("scopes", map[string]interface{}{"frameId": top["id"]})["scopes"].([]interface{})
+	refs := make(map[string]interface{})
+	for _, scope := range scopes {
+		scope := scope.(map[string]interface{})
+		refs[scope["name"].(string)] = scope["variablesReference"]
+	}
+	if input := c.variables(refs["Step"])["input"]; input["value"] != `"an outline"` {
+		t.Errorf("expected the step's input, got %v", input)
+	}
+	if outline := c.variables(refs["Step Outputs"])["outline"]; outline["value"] != `"an outline"` {
+		t.Errorf("expected the output of outline, got %v", outline)
+	}
+
+	// Editing a step output changes what the paused step sees
+	c.request("setVariable", map[string]interface{}{"variablesReference": refs["Step Outputs"], "name": "outline", "value": "a better outline"})
+	if result := c.request("evaluate", map[string]interface{}{"expression": "outline"}); result["result"] != `"a better outline"` {
+		t.Errorf("expected the edited output, got %v", result)
+	}
+	if resp := c.send("setVariable", map[string]interface{}{"variablesReference": 99, "name": "x", "value": "1"}); resp["success"] != false {
+		t.Error("expected an unknown variable reference to fail")
+	}
+
+	c.request("continue", map[string]int{"threadId": 1})
+	if exited := c.waitEvent("exited"); exited["exitCode"] != float64(0) {
+		t.Errorf("expected the execution to succeed, got %v", exited)
+	}
+	c.waitEvent("terminated")
+
+	requests := provider.GetRequests()
+	if len(requests) != 2 || requests[1].Messages[0].Content != "## Input\n\na better outline" {
+		t.Errorf("expected write to run on the edited outline, got %d requests", len(requests))
+	}
+	c.request("disconnect", nil)
+}
+
+func TestServerStopOnEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "draft.ls")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := runtime.NewMockProvider()
+	s := NewServer(WithRuntime(func(ws *workspace.Workspace) (*runtime.Runtime, error) {
+		return runtime.New(ws, runtime.WithProvider("mock", provider)), nil
+	}))
+	c := newClient(t, s)
+
+	c.request("initialize", nil)
+	if resp := c.send("launch", map[string]interface{}{"program": path, "pipeline": "missing"}); resp["success"] != false {
+		t.Error("expected launching a missing pipeline to fail")
+	}
+	c.request("launch", map[string]interface{}{"program": path, "pipeline": "draft", "input": "topic", "stopOnEntry": true})
+	c.request("configurationDone", nil)
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "entry" {
+		t.Errorf("expected a stop on entry, got %v", stopped)
+	}
+	c.request("next", map[string]int{"threadId": 1})
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "step" {
+		t.Errorf("expected a stop after stepping, got %v", stopped)
+	}
+
+	// Disconnecting stops the paused execution
+	c.request("disconnect", nil)
+	if n := len(provider.GetRequests()); n != 1 {
+		t.Errorf("expected only the first step to run, got %d requests", n)
+	}
+}
@@ -11,4 +11,7 @@
 //   - workspace: Workspace and relationship management
 //   - runtime: Execution engine and LLM integration
 //   - compile: Code generation for target languages
+//   - doc: Reference documentation of workspaces as Markdown or HTML
+//   - jsonpath: JSONPath queries over structured step outputs
+//   - i18n: Error codes and translated messages
 package pkg
@@ -0,0 +1,313 @@
+// Package doc generates reference documentation of the agents, tools,
+// scripts, intents, and pipelines of a workspace, as Markdown or HTML.
+//
+// An entity is documented by its `description` property and its doc
+// comment, the comment lines directly above its declaration:
+//
+//	# Reviews pull requests for style and correctness.
+//	agent "reviewer" {
+//	  description: "Code reviewer"
+//	  model: "claude-sonnet-4-20250514"
+//	}
+//
+// Typed parameters of `params` and `parameters` are listed in a table with
+// their types, defaults, and descriptions.
+package doc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// DefaultTypes are the entity types documented unless WithTypes says
+// otherwise, in the order of their sections.
+var DefaultTypes = []string{"agent", "tool", "script", "intent", "pipeline"}
+
+// sectionTitles are the headings of the sections of entity types.
+var sectionTitles = map[string]string{
+	"agent":    "Agents",
+	"tool":     "Tools",
+	"script":   "Scripts",
+	"intent":   "Intents",
+	"pipeline": "Pipelines",
+	"trigger":  "Triggers",
+	"mcp":      "MCP Servers",
+	"prompt":   "Prompts",
+	"eval":     "Evals",
+	"provider": "Providers",
+}
+
+// Document is the documentation of a workspace.
+type Document struct {
+	Title    string
+	Sections []Section
+}
+
+// Section documents the entities of a type, sorted by name.
+type Section struct {
+	Type     string
+	Title    string
+	Entities []Entity
+}
+
+// Entity documents an entity.
+type Entity struct {
+	Type string
+	Name string
+
+	// Description is the `description` property, and Doc the doc comment
+	Description string
+	Doc         string
+
+	// Deprecated is set for entities with a deprecated directive, with
+	// its reason in Deprecation
+	Deprecated  bool
+	Deprecation string
+
+	Tags       []string
+	Owners     []string
+	Visibility string
+
+	// Models and Tools are those of an agent
+	Models []string
+	Tools  []string
+
+	// Uses is what an intent uses, e.g. agent("reviewer")
+	Uses string
+
+	// Parameters are the `params` of an intent or pipeline, or the
+	// `parameters` of a tool or script
+	Parameters []Parameter
+
+	// Steps are those of a pipeline
+	Steps []Step
+
+	Line int
+}
+
+// Parameter documents a parameter.
+type Parameter struct {
+	Name        string
+	Type        string // empty for untyped parameters
+	Required    bool
+	Default     string
+	Description string
+	Enum        []string
+}
+
+// Step documents a pipeline step.
+type Step struct {
+	Name        string
+	Uses        string
+	Description string
+	Doc         string
+}
+
+// Len returns the number of entities documented.
+func (d *Document) Len() int {
+	n := 0
+	for _, s := range d.Sections {
+		n += len(s.Entities)
+	}
+	return n
+}
+
+// Option configures Generate.
+type Option func(*options)
+
+type options struct {
+	title string
+	types []string
+}
+
+// WithTitle sets the title of the document (default "LangSpace Workspace").
+func WithTitle(title string) Option {
+	return func(o *options) {
+		o.title = title
+	}
+}
+
+// WithTypes documents the entity types given, in that order, instead of
+// DefaultTypes.
+func WithTypes(types ...string) Option {
+	return func(o *options) {
+		o.types = types
+	}
+}
+
+// Generate documents the entities of ws. Types without entities get no
+// section.
+func Generate(ws *workspace.Workspace, opts ...Option) *Document {
+	o := options{title: "LangSpace Workspace", types: DefaultTypes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	d := &Document{Title: o.title}
+	for _, typ := range o.types {
+		entities := ws.GetEntitiesByType(typ)
+		if len(entities) == 0 {
+			continue
+		}
+		title, ok := sectionTitles[typ]
+		if !ok {
+			title = strings.ToUpper(typ[:1]) + typ[1:] + "s"
+		}
+		section := Section{Type: typ, Title: title}
+		for _, e := range entities {
+			section.Entities = append(section.Entities, documentEntity(e))
+		}
+		sort.Slice(section.Entities, func(i, j int) bool {
+			return section.Entities[i].Name < section.Entities[j].Name
+		})
+		d.Sections = append(d.Sections, section)
+	}
+	return d
+}
+
+// documentEntity returns the documentation of an entity.
+func documentEntity(e ast.Entity) Entity {
+	doc := Entity{
+		Type:        e.Type(),
+		Name:        e.Name(),
+		Description: stringProperty(e, "description"),
+		Doc:         ast.Doc(e),
+		Tags:        ast.Tags(e),
+		Owners:      ast.Owners(e),
+		Line:        e.Line(),
+	}
+	if v, ok := e.GetMetadata(ast.VisibilityMetadataKey); ok {
+		doc.Visibility = v
+	}
+	doc.Deprecation, doc.Deprecated = e.GetMetadata("deprecated")
+
+	switch e.Type() {
+	case "agent":
+		if v, ok := e.GetProperty("model"); ok {
+			doc.Models = models(v)
+		}
+		doc.Tools = validator.AgentToolNames(e)
+	case "tool", "script":
+		doc.Parameters = parameters(e, "parameters")
+	case "intent":
+		doc.Uses = useOf(e)
+		doc.Parameters = parameters(e, "params")
+	case "pipeline":
+		doc.Parameters = parameters(e, "params")
+	}
+
+	if p, ok := e.(*ast.PipelineEntity); ok {
+		for _, s := range p.Steps {
+			doc.Steps = append(doc.Steps, Step{
+				Name:        s.Name(),
+				Uses:        useOf(s),
+				Description: stringProperty(s, "description"),
+				Doc:         ast.Doc(s),
+			})
+		}
+	}
+	return doc
+}
+
+// stringProperty returns a string property of an entity, or "".
+func stringProperty(e ast.Entity, key string) string {
+	v, _ := e.GetProperty(key)
+	s, _ := v.(ast.StringValue)
+	return s.Value
+}
+
+// models returns the models named by an agent's `model` property.
+func models(v ast.Value) []string {
+	if arr, ok := v.(ast.ArrayValue); ok {
+		var names []string
+		for _, elem := range arr.Elements {
+			names = append(names, valueString(elem))
+		}
+		return names
+	}
+	return []string{valueString(v)}
+}
+
+// useOf returns what an intent or step uses, or "".
+func useOf(e ast.Entity) string {
+	if v, ok := e.GetProperty("use"); ok {
+		return valueString(v)
+	}
+	return ""
+}
+
+// parameters returns the parameters declared by an object property, sorted
+// by name.
+func parameters(e ast.Entity, key string) []Parameter {
+	v, _ := e.GetProperty(key)
+	obj, ok := v.(ast.ObjectValue)
+	if !ok {
+		return nil
+	}
+	params := make([]Parameter, 0, len(obj.Properties))
+	for name, v := range obj.Properties {
+		p := Parameter{Name: name}
+		if tp, ok := v.(ast.TypedParameterValue); ok {
+			p.Type = tp.ParamType
+			p.Required = tp.Required
+			p.Description = tp.Description
+			p.Enum = tp.EnumValues
+			if tp.Default != nil {
+				p.Default = valueString(tp.Default)
+			}
+		} else {
+			// A plain value is the default of an untyped parameter
+			p.Default = valueString(v)
+		}
+		params = append(params, p)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// valueString renders a value as it could be written in source, for the
+// values documentation shows: models, defaults, and references.
+func valueString(v ast.Value) string {
+	switch val := v.(type) {
+	case ast.StringValue:
+		return strconv.Quote(val.Value)
+	case ast.NumberValue:
+		return strconv.FormatFloat(val.Value, 'f', -1, 64)
+	case ast.BoolValue:
+		return strconv.FormatBool(val.Value)
+	case ast.NullValue:
+		return "null"
+	case ast.VariableValue:
+		return "$" + val.Name
+	case ast.ReferenceValue:
+		s := fmt.Sprintf("%s(%q)", val.Type, val.Name)
+		if val.Version != "" {
+			s += "@" + val.Version
+		}
+		return s
+	case ast.ArrayValue:
+		elems := make([]string, len(val.Elements))
+		for i, elem := range val.Elements {
+			elems[i] = valueString(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case ast.ObjectValue:
+		keys := make([]string, 0, len(val.Properties))
+		for k := range val.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			fields[i] = k + ": " + valueString(val.Properties[k])
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	}
+	return "…"
+}
@@ -0,0 +1,116 @@
+package doc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace/testutil"
+)
+
+const source = `# Reviews pull requests for style
+# and correctness.
+# langspace:deprecated use "reviewer-v2"
+agent "reviewer" {
+  description: "Code reviewer"
+  model: ["gpt-4o", "claude-sonnet-4-20250514"]
+  tools: [tool("search")]
+  owners: ["team-platform"]
+  tags: ["review"]
+}
+
+tool "search" {
+  description: "Searches the codebase"
+  parameters: {
+    query: string required "What to search for"
+    limit: number optional 10 "Most results | to return"
+  }
+}
+
+pipeline "review" {
+  params: {
+    mode: enum optional ["quick", "full"] "quick" "How thorough to be"
+    branch: "main"
+  }
+
+  # Reads the diff.
+  step "read" {
+    use: agent("reviewer")
+  }
+  step "write" {
+    use: agent("reviewer")
+    description: "Writes the review"
+  }
+}
+
+trigger "nightly" {}
+`
+
+func TestGenerate(t *testing.T) {
+	d := Generate(testutil.WorkspaceFrom(t, source), WithTitle("Review"))
+	if d.Title != "Review" || len(d.Sections) != 3 {
+		t.Fatalf("expected agents, tools, and pipelines, got %+v", d.Sections)
+	}
+
+	reviewer := d.Sections[0].Entities[0]
+	if reviewer.Description != "Code reviewer" || reviewer.Doc != "Reviews pull requests for style\nand correctness." {
+		t.Errorf("reviewer description %q, doc %q", reviewer.Description, reviewer.Doc)
+	}
+	if !reviewer.Deprecated || reviewer.Deprecation != `use "reviewer-v2"` {
+		t.Errorf("expected the reviewer deprecated, got %v %q", reviewer.Deprecated, reviewer.Deprecation)
+	}
+	if strings.Join(reviewer.Models, " ") != `"gpt-4o" "claude-sonnet-4-20250514"` || strings.Join(reviewer.Tools, " ") != "search" || strings.Join(reviewer.Owners, " ") != "team-platform" {
+		t.Errorf("unexpected reviewer: %+v", reviewer)
+	}
+
+	search := d.Sections[1].Entities[0]
+	want := []Parameter{
+		{Name: "limit", Type: "number", Default: "10", Description: "Most results | to return"},
+		{Name: "query", Type: "string", Required: true, Description: "What to search for"},
+	}
+	if !reflect.DeepEqual(search.Parameters, want) {
+		t.Errorf("search parameters = %+v, want %+v", search.Parameters, want)
+	}
+
+	review := d.Sections[2].Entities[0]
+	if len(review.Steps) != 2 || review.Steps[0].Doc != "Reads the diff." || review.Steps[1].Uses != `agent("reviewer")` {
+		t.Errorf("unexpected steps: %+v", review.Steps)
+	}
+	if p := review.Parameters; len(p) != 2 || p[0].Default != `"main"` || p[1].TypeString() != "enum (quick, full)" {
+		t.Errorf("unexpected pipeline parameters: %+v", p)
+	}
+
+	if d := Generate(testutil.WorkspaceFrom(t, source), WithTypes("trigger")); len(d.Sections) != 1 || d.Sections[0].Title != "Triggers" {
+		t.Errorf("expected only triggers, got %+v", d.Sections)
+	}
+}
+
+func TestDocument_Markdown(t *testing.T) {
+	md := Generate(testutil.WorkspaceFrom(t, source)).Markdown()
+	for _, want := range []string{
+		"# LangSpace Workspace\n\n## Agents\n\n### reviewer\n\n> **Deprecated**: use \"reviewer-v2\"\n\nCode reviewer\n\nReviews pull requests for style\nand correctness.\n",
+		"- **Owners:** team-platform",
+		"| limit | number | no | 10 | Most results \\| to return |",
+		"| query | string | yes |  | What to search for |",
+		"1. `read` uses `agent(\"reviewer\")`: Reads the diff.\n2. `write` uses `agent(\"reviewer\")`: Writes the review\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in:\n%s", want, md)
+		}
+	}
+}
+
+func TestDocument_HTML(t *testing.T) {
+	page := Generate(testutil.WorkspaceFrom(t, source)).HTML()
+	for _, want := range []string{
+		`<a href="#agent-reviewer">reviewer</a>`,
+		`<section id="tool-search">`,
+		`<p class="deprecated"><strong>Deprecated</strong>: use &#34;reviewer-v2&#34;</p>`,
+		`<tr><td><code>mode</code></td><td>enum (quick, full)</td><td>no</td><td><code>&#34;quick&#34;</code></td><td>How thorough to be</td></tr>`,
+		"</html>\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %q in:\n%s", want, page)
+		}
+	}
+}
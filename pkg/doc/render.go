@@ -0,0 +1,190 @@
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// Markdown renders the document as Markdown: a heading per section and
+// entity, with parameters in tables.
+func (d *Document) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", d.Title)
+	for _, s := range d.Sections {
+		fmt.Fprintf(&b, "\n## %s\n", s.Title)
+		for _, e := range s.Entities {
+			writeMarkdownEntity(&b, e)
+		}
+	}
+	return b.String()
+}
+
+func writeMarkdownEntity(b *strings.Builder, e Entity) {
+	fmt.Fprintf(b, "\n### %s\n", e.Name)
+	if e.Deprecated {
+		b.WriteString("\n> **Deprecated**")
+		if e.Deprecation != "" {
+			fmt.Fprintf(b, ": %s", e.Deprecation)
+		}
+		b.WriteString("\n")
+	}
+	for _, text := range []string{e.Description, e.Doc} {
+		if text != "" {
+			fmt.Fprintf(b, "\n%s\n", text)
+		}
+	}
+
+	var facts []string
+	fact := func(label string, values ...string) {
+		if len(values) > 0 && values[0] != "" {
+			facts = append(facts, fmt.Sprintf("- **%s:** %s", label, strings.Join(values, ", ")))
+		}
+	}
+	fact("Models", e.Models...)
+	fact("Tools", e.Tools...)
+	fact("Uses", e.Uses)
+	fact("Owners", e.Owners...)
+	fact("Visibility", e.Visibility)
+	fact("Tags", e.Tags...)
+	if len(facts) > 0 {
+		fmt.Fprintf(b, "\n%s\n", strings.Join(facts, "\n"))
+	}
+
+	if len(e.Parameters) > 0 {
+		b.WriteString("\n| Parameter | Type | Required | Default | Description |\n")
+		b.WriteString("|-----------|------|----------|---------|-------------|\n")
+		for _, p := range e.Parameters {
+			fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n",
+				markdownCell(p.Name), markdownCell(p.TypeString()), yesNo(p.Required),
+				markdownCell(p.Default), markdownCell(p.Description))
+		}
+	}
+
+	if len(e.Steps) > 0 {
+		b.WriteString("\n**Steps:**\n\n")
+		for i, s := range e.Steps {
+			fmt.Fprintf(b, "%d. `%s`", i+1, s.Name)
+			if s.Uses != "" {
+				fmt.Fprintf(b, " uses `%s`", s.Uses)
+			}
+			if text := s.Summary(); text != "" {
+				fmt.Fprintf(b, ": %s", strings.ReplaceAll(text, "\n", " "))
+			}
+			b.WriteString("\n")
+		}
+	}
+}
+
+// TypeString returns the type of a parameter, with the values of an enum.
+func (p Parameter) TypeString() string {
+	if len(p.Enum) > 0 {
+		return p.Type + " (" + strings.Join(p.Enum, ", ") + ")"
+	}
+	return p.Type
+}
+
+// Summary returns the description of a step, or else its doc comment.
+func (s Step) Summary() string {
+	if s.Description != "" {
+		return s.Description
+	}
+	return s.Doc
+}
+
+// markdownCell escapes text for a cell of a Markdown table.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// htmlTemplate renders a document as a standalone HTML page, with a table
+// of contents linking to each entity.
+var htmlTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
+	"anchor": func(e Entity) string { return e.Type + "-" + e.Name },
+	"yesNo":  yesNo,
+	"join":   strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+code { background: #f4f4f4; padding: 0 0.2em; }
+.deprecated { color: #a00; }
+.doc { white-space: pre-line; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<nav>
+<ul>
+{{- range .Sections}}
+<li>{{.Title}}<ul>{{range .Entities}}<li><a href="#{{anchor .}}">{{.Name}}</a></li>{{end}}</ul></li>
+{{- end}}
+</ul>
+</nav>
+{{- range .Sections}}
+<h2>{{.Title}}</h2>
+{{- range .Entities}}
+<section id="{{anchor .}}">
+<h3>{{.Name}}</h3>
+{{- if .Deprecated}}
+<p class="deprecated"><strong>Deprecated</strong>{{if .Deprecation}}: {{.Deprecation}}{{end}}</p>
+{{- end}}
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Doc}}
+<p class="doc">{{.Doc}}</p>
+{{- end}}
+{{- if or .Models .Tools .Uses .Owners .Visibility .Tags}}
+<ul>
+{{- if .Models}}<li><strong>Models:</strong> {{join .Models ", "}}</li>{{end}}
+{{- if .Tools}}<li><strong>Tools:</strong> {{join .Tools ", "}}</li>{{end}}
+{{- if .Uses}}<li><strong>Uses:</strong> <code>{{.Uses}}</code></li>{{end}}
+{{- if .Owners}}<li><strong>Owners:</strong> {{join .Owners ", "}}</li>{{end}}
+{{- if .Visibility}}<li><strong>Visibility:</strong> {{.Visibility}}</li>{{end}}
+{{- if .Tags}}<li><strong>Tags:</strong> {{join .Tags ", "}}</li>{{end}}
+</ul>
+{{- end}}
+{{- if .Parameters}}
+<table>
+<tr><th>Parameter</th><th>Type</th><th>Required</th><th>Default</th><th>Description</th></tr>
+{{- range .Parameters}}
+<tr><td><code>{{.Name}}</code></td><td>{{.TypeString}}</td><td>{{yesNo .Required}}</td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Steps}}
+<p><strong>Steps:</strong></p>
+<ol>
+{{- range .Steps}}
+<li><code>{{.Name}}</code>{{if .Uses}} uses <code>{{.Uses}}</code>{{end}}{{with .Summary}}: {{.}}{{end}}</li>
+{{- end}}
+</ol>
+{{- end}}
+</section>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML renders the document as a standalone HTML page.
+func (d *Document) HTML() string {
+	var buf bytes.Buffer
+	// Executing fails only on errors in the template, which tests catch
+	_ = htmlTemplate.Execute(&buf, d)
+	return buf.String()
+}
@@ -0,0 +1,150 @@
+// Package format formats LangSpace source in the style of the examples:
+// two-space indentation by nesting depth, no trailing whitespace, at most
+// one blank line in a row, a blank line between top-level declarations
+// that span lines, and a final newline. Everything else, including
+// comments and the contents of strings, is left as written.
+package format
+
+import (
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
+)
+
+// indent is one level of indentation.
+const indent = "  "
+
+// Source returns src formatted. Source that does not parse is returned
+// unchanged with the first parse error, so a half-typed file is never
+// reindented by a guess at its structure.
+func Source(src string) (string, error) {
+	result := parser.New(src, parser.WithSourceFidelity()).ParseWithRecovery()
+	if result.HasErrors() {
+		return src, result.Errors[0]
+	}
+	separate := separatedLines(src, result.Entities)
+
+	var out strings.Builder
+	var s scanner
+	blank := false
+	for i, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		// Lines continuing a string are part of its value
+		if s.inString() {
+			out.WriteString(line)
+			out.WriteByte('\n')
+			s.scan(line)
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank || separate[i+1] && out.Len() > 0 {
+			out.WriteByte('\n')
+			blank = false
+		}
+
+		depth := s.depth - leadingClosers(trimmed)
+		out.WriteString(strings.Repeat(indent, max(depth, 0)))
+		s.scan(trimmed)
+		if !s.inString() {
+			out.WriteString(trimmed)
+		} else {
+			// Keep trailing spaces inside a string that continues
+			out.WriteString(strings.TrimLeft(line, " \t"))
+		}
+		out.WriteByte('\n')
+	}
+	return out.String(), nil
+}
+
+// separatedLines returns the lines that start top-level declarations, or
+// the comments above them, which a blank line separates from the
+// declaration before. One-line declarations in a row stay together.
+func separatedLines(src string, entities []ast.Entity) map[int]bool {
+	lines := make(map[int]bool)
+	var prev *ast.Source
+	for _, e := range entities {
+		cur := ast.SourceOf(e)
+		if cur == nil {
+			continue
+		}
+		if prev != nil && (spansLines(src, prev.Range) || spansLines(src, cur.Range)) {
+			first := cur.Range.Line
+			if len(cur.Comments.Leading) > 0 {
+				first = cur.Comments.Leading[0].Range.Line
+			}
+			if first > prev.Range.Line+strings.Count(src[prev.Range.Start:prev.Range.End], "\n") {
+				lines[first] = true
+			}
+		}
+		prev = cur
+	}
+	return lines
+}
+
+// spansLines reports whether r covers more than one line of src.
+func spansLines(src string, r ast.Range) bool {
+	return strings.Contains(src[r.Start:r.End], "\n")
+}
+
+// leadingClosers counts the closing brackets a line starts with, which
+// belong at the depth of the lines they close.
+func leadingClosers(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case '}', ']', ')':
+			n++
+		case ' ', '\t':
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// scanner tracks bracket depth and open strings across lines.
+type scanner struct {
+	depth      int
+	inQuote    bool // inside "..."
+	inBacktick bool // inside ```...```
+}
+
+func (s *scanner) inString() bool {
+	return s.inQuote || s.inBacktick
+}
+
+// scan advances over a line.
+func (s *scanner) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		switch {
+		case s.inBacktick:
+			if strings.HasPrefix(line[i:], "```") {
+				s.inBacktick = false
+				i += 2
+			}
+		case s.inQuote:
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				s.inQuote = false
+			}
+		case strings.HasPrefix(line[i:], "```"):
+			s.inBacktick = true
+			i += 2
+		case line[i] == '"':
+			s.inQuote = true
+		case line[i] == '#':
+			return
+		case line[i] == '{' || line[i] == '[' || line[i] == '(':
+			s.depth++
+		case line[i] == '}' || line[i] == ']' || line[i] == ')':
+			s.depth = max(s.depth-1, 0)
+		}
+	}
+}
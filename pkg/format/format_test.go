@@ -0,0 +1,63 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "reindent",
+			input: "\n\nagent \"writer\" {\n\t\tmodel: \"gpt-4o\"   \n tools: [\n tool(\"search\"),\n]\n}",
+			want:  "agent \"writer\" {\n  model: \"gpt-4o\"\n  tools: [\n    tool(\"search\"),\n  ]\n}\n",
+		},
+		{
+			name:  "blank_lines",
+			input: "agent \"a\" {\n  model: \"m\"\n}\n\n\n\nagent \"b\" {\n  model: \"m\"\n}\n\n",
+			want:  "agent \"a\" {\n  model: \"m\"\n}\n\nagent \"b\" {\n  model: \"m\"\n}\n",
+		},
+		{
+			name:  "strings_and_comments",
+			input: "agent \"a\" {\n# braces { in a comment\n    instruction: ```\n        Keep { this }   \n  as written\n```\n    model: \"{\"\n}\n",
+			want:  "agent \"a\" {\n  # braces { in a comment\n  instruction: ```\n        Keep { this }   \n  as written\n```\n  model: \"{\"\n}\n",
+		},
+		{
+			name:  "separate_declarations",
+			input: "tool \"a\" {}\ntool \"b\" {}\nagent \"c\" {\n  model: \"m\"\n}\n# Writes drafts.\nagent \"d\" {\n  model: \"m\"\n} # done\ntool \"e\" {}\n",
+			want:  "tool \"a\" {}\ntool \"b\" {}\n\nagent \"c\" {\n  model: \"m\"\n}\n\n# Writes drafts.\nagent \"d\" {\n  model: \"m\"\n} # done\n\ntool \"e\" {}\n",
+		},
+		{
+			name:  "closers_on_one_line",
+			input: "pipeline \"p\" {\nstep \"s\" {\nuse: agent(\"a\")\n}}\n",
+			want:  "pipeline \"p\" {\n  step \"s\" {\n    use: agent(\"a\")\n}}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source(tt.input)
+			if err != nil {
+				t.Fatalf("Source failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Source() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if again, _ := Source(got); again != got {
+				t.Errorf("formatting is not idempotent:\n%q", again)
+			}
+		})
+	}
+}
+
+func TestSource_ParseError(t *testing.T) {
+	src := "agent \"a\" {\n      model: \n"
+	got, err := Source(src)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if got != src {
+		t.Errorf("expected source that does not parse to be returned unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,294 @@
+package i18n
+
+// Parser messages.
+const (
+	ExpectedToken        Code = "LS1001"
+	ExpectedTopLevel     Code = "LS1002"
+	ExpectedEntityName   Code = "LS1003"
+	ExpectedPropertyName Code = "LS1004"
+	ExpectedMemberName   Code = "LS1005"
+	UnexpectedValue      Code = "LS1006"
+	UnclosedBlock        Code = "LS1007"
+	UnclosedNestedBlock  Code = "LS1008"
+	UnclosedArray        Code = "LS1009"
+	UnclosedObject       Code = "LS1010"
+	UnclosedArguments    Code = "LS1011"
+	UnknownEntityType    Code = "LS1012"
+	ExpectedVersion      Code = "LS1013"
+)
+
+// Validator messages.
+const (
+	UndeclaredTool        Code = "LS2001"
+	InvalidPattern        Code = "LS2002"
+	InvalidQueryPath      Code = "LS2003"
+	UndefinedReference    Code = "LS2004"
+	UnknownStep           Code = "LS2005"
+	SelfReference         Code = "LS2006"
+	ParallelStepReference Code = "LS2007"
+	LaterStepReference    Code = "LS2008"
+	PipelineCycle         Code = "LS2009"
+	PromptCycle           Code = "LS2010"
+	MissingName           Code = "LS2101"
+	MissingProperty       Code = "LS2102"
+	MissingFileSource     Code = "LS2103"
+	MissingToolHandler    Code = "LS2104"
+	MissingIntentAgent    Code = "LS2105"
+	MissingTriggerSource  Code = "LS2106"
+	EmptyConfig           Code = "LS2107"
+	MissingScriptSource   Code = "LS2108"
+	UnknownConfigKey      Code = "LS2109"
+	InvalidConfigValue    Code = "LS2110"
+	MissingEvalCases      Code = "LS2111"
+	DuplicateEntity       Code = "LS2201"
+	UnusedTool            Code = "LS2202"
+	DeprecatedEntity      Code = "LS2203"
+)
+
+// Runtime messages.
+const (
+	InvalidParams  Code = "LS3001"
+	ParamRequired  Code = "LS3002"
+	ParamUnknown   Code = "LS3003"
+	EntityNotFound Code = "LS3004"
+)
+
+// AtPosition frames a parse error with its line and column. It is part of
+// the catalog so the frame is translated too, but is not a diagnostic.
+const AtPosition Code = "position"
+
+var english = map[Code]string{
+	AtPosition: "at line %d, col %d: %s",
+
+	ExpectedToken:        "expected %s, got %s",
+	ExpectedTopLevel:     "expected identifier at top level, got %s",
+	ExpectedEntityName:   "expected entity name",
+	ExpectedPropertyName: "expected property name, got %s",
+	ExpectedMemberName:   "expected property name after .",
+	UnexpectedValue:      "unexpected token in value: %s",
+	UnclosedBlock:        "unclosed block",
+	UnclosedNestedBlock:  "unclosed nested block",
+	UnclosedArray:        "unclosed array",
+	UnclosedObject:       "unclosed object",
+	UnclosedArguments:    "unclosed argument list",
+	UnknownEntityType:    "unknown entity type: %s",
+	ExpectedVersion:      "expected version after @",
+
+	UndeclaredTool:        "uses undeclared tool %q",
+	InvalidPattern:        "invalid pattern in %s(): %v",
+	InvalidQueryPath:      "%v",
+	UndefinedReference:    "references undefined %s %q",
+	UnknownStep:           "references unknown step %q",
+	SelfReference:         "references its own output",
+	ParallelStepReference: "references step %q, which runs in the same parallel block",
+	LaterStepReference:    "references step %q, which runs after it",
+	PipelineCycle:         "circular pipeline reference: %s",
+	PromptCycle:           "circular prompt include: %s",
+	MissingName:           "%s entity must have a name",
+	MissingProperty:       "%s entity must have '%s' property",
+	MissingFileSource:     "file entity must have either 'path' or 'contents' property",
+	MissingToolHandler:    "tool entity must have a 'command', 'function' or 'handler' property",
+	MissingIntentAgent:    "intent entity must have 'use' property referencing an agent",
+	MissingTriggerSource:  "trigger entity must have 'event' or 'schedule' property",
+	EmptyConfig:           "config entity must have at least one property",
+	MissingScriptSource:   "script entity must have 'code' or 'path' property",
+	UnknownConfigKey:      "unknown config key %q (did you mean %q?)",
+	InvalidConfigValue:    "config '%s' %v",
+	MissingEvalCases:      "eval entity must have at least one 'case' block",
+	DuplicateEntity:       "entity %s/%s already exists",
+	UnusedTool:            "tool is declared but not used by any agent",
+	DeprecatedEntity:      "%s %q is deprecated",
+
+	InvalidParams:  "invalid params for %s %q: %s",
+	ParamRequired:  "required parameter not provided",
+	ParamUnknown:   "unknown parameter",
+	EntityNotFound: "entity not found: %s %q",
+}
+
+var german = map[Code]string{
+	AtPosition: "in Zeile %d, Spalte %d: %s",
+
+	ExpectedToken:        "%s erwartet, %s gefunden",
+	ExpectedTopLevel:     "Bezeichner auf oberster Ebene erwartet, %s gefunden",
+	ExpectedEntityName:   "Name der Entität erwartet",
+	ExpectedPropertyName: "Eigenschaftsname erwartet, %s gefunden",
+	ExpectedMemberName:   "Eigenschaftsname nach . erwartet",
+	UnexpectedValue:      "unerwartetes Token im Wert: %s",
+	UnclosedBlock:        "nicht geschlossener Block",
+	UnclosedNestedBlock:  "nicht geschlossener verschachtelter Block",
+	UnclosedArray:        "nicht geschlossenes Array",
+	UnclosedObject:       "nicht geschlossenes Objekt",
+	UnclosedArguments:    "nicht geschlossene Argumentliste",
+	UnknownEntityType:    "unbekannter Entitätstyp: %s",
+	ExpectedVersion:      "Version nach @ erwartet",
+
+	UndeclaredTool:        "verwendet das nicht deklarierte Werkzeug %q",
+	InvalidPattern:        "ungültiges Muster in %s(): %v",
+	UndefinedReference:    "verweist auf nicht definierte(s) %s %q",
+	UnknownStep:           "verweist auf den unbekannten Schritt %q",
+	SelfReference:         "verweist auf seine eigene Ausgabe",
+	ParallelStepReference: "verweist auf den Schritt %q, der im selben parallelen Block läuft",
+	LaterStepReference:    "verweist auf den Schritt %q, der danach läuft",
+	PipelineCycle:         "zirkulärer Pipeline-Verweis: %s",
+	PromptCycle:           "zirkuläre Prompt-Einbindung: %s",
+	MissingName:           "Entität %s muss einen Namen haben",
+	MissingProperty:       "Entität %s muss die Eigenschaft '%s' haben",
+	MissingFileSource:     "Entität file muss die Eigenschaft 'path' oder 'contents' haben",
+	MissingToolHandler:    "Entität tool muss die Eigenschaft 'command', 'function' oder 'handler' haben",
+	MissingIntentAgent:    "Entität intent muss die Eigenschaft 'use' mit einem Verweis auf einen Agenten haben",
+	MissingTriggerSource:  "Entität trigger muss die Eigenschaft 'event' oder 'schedule' haben",
+	EmptyConfig:           "Entität config muss mindestens eine Eigenschaft haben",
+	MissingScriptSource:   "Entität script muss die Eigenschaft 'code' oder 'path' haben",
+	UnknownConfigKey:      "unbekannter Konfigurationsschlüssel %q (meinten Sie %q?)",
+	InvalidConfigValue:    "config '%s' %v",
+	MissingEvalCases:      "Entität eval muss mindestens einen 'case'-Block haben",
+	DuplicateEntity:       "Entität %s/%s existiert bereits",
+	UnusedTool:            "Werkzeug ist deklariert, wird aber von keinem Agenten verwendet",
+	DeprecatedEntity:      "%s %q ist veraltet",
+
+	InvalidParams:  "ungültige Parameter für %s %q: %s",
+	ParamRequired:  "erforderlicher Parameter fehlt",
+	ParamUnknown:   "unbekannter Parameter",
+	EntityNotFound: "Entität nicht gefunden: %s %q",
+}
+
+var french = map[Code]string{
+	AtPosition: "ligne %d, colonne %d : %s",
+
+	ExpectedToken:        "%s attendu, %s trouvé",
+	ExpectedTopLevel:     "identifiant attendu au niveau supérieur, %s trouvé",
+	ExpectedEntityName:   "nom d'entité attendu",
+	ExpectedPropertyName: "nom de propriété attendu, %s trouvé",
+	ExpectedMemberName:   "nom de propriété attendu après .",
+	UnexpectedValue:      "jeton inattendu dans la valeur : %s",
+	UnclosedBlock:        "bloc non fermé",
+	UnclosedNestedBlock:  "bloc imbriqué non fermé",
+	UnclosedArray:        "tableau non fermé",
+	UnclosedObject:       "objet non fermé",
+	UnclosedArguments:    "liste d'arguments non fermée",
+	UnknownEntityType:    "type d'entité inconnu : %s",
+	ExpectedVersion:      "version attendue après @",
+
+	UndeclaredTool:        "utilise l'outil non déclaré %q",
+	InvalidPattern:        "motif invalide dans %s() : %v",
+	UndefinedReference:    "fait référence à %s %q, qui n'est pas défini",
+	UnknownStep:           "fait référence à l'étape inconnue %q",
+	SelfReference:         "fait référence à sa propre sortie",
+	ParallelStepReference: "fait référence à l'étape %q, qui s'exécute dans le même bloc parallèle",
+	LaterStepReference:    "fait référence à l'étape %q, qui s'exécute après elle",
+	PipelineCycle:         "référence circulaire entre pipelines : %s",
+	PromptCycle:           "inclusion circulaire de prompts : %s",
+	MissingName:           "l'entité %s doit avoir un nom",
+	MissingProperty:       "l'entité %s doit avoir la propriété '%s'",
+	MissingFileSource:     "l'entité file doit avoir la propriété 'path' ou 'contents'",
+	MissingToolHandler:    "l'entité tool doit avoir la propriété 'command', 'function' ou 'handler'",
+	MissingIntentAgent:    "l'entité intent doit avoir la propriété 'use' faisant référence à un agent",
+	MissingTriggerSource:  "l'entité trigger doit avoir la propriété 'event' ou 'schedule'",
+	EmptyConfig:           "l'entité config doit avoir au moins une propriété",
+	MissingScriptSource:   "l'entité script doit avoir la propriété 'code' ou 'path'",
+	UnknownConfigKey:      "clé de configuration inconnue %q (vouliez-vous dire %q ?)",
+	InvalidConfigValue:    "config '%s' %v",
+	MissingEvalCases:      "l'entité eval doit avoir au moins un bloc 'case'",
+	DuplicateEntity:       "l'entité %s/%s existe déjà",
+	UnusedTool:            "l'outil est déclaré mais n'est utilisé par aucun agent",
+	DeprecatedEntity:      "%s %q est obsolète",
+
+	InvalidParams:  "paramètres invalides pour %s %q : %s",
+	ParamRequired:  "paramètre obligatoire non fourni",
+	ParamUnknown:   "paramètre inconnu",
+	EntityNotFound: "entité introuvable : %s %q",
+}
+
+var spanish = map[Code]string{
+	AtPosition: "en la línea %d, columna %d: %s",
+
+	ExpectedToken:        "se esperaba %s, se encontró %s",
+	ExpectedTopLevel:     "se esperaba un identificador en el nivel superior, se encontró %s",
+	ExpectedEntityName:   "se esperaba el nombre de la entidad",
+	ExpectedPropertyName: "se esperaba un nombre de propiedad, se encontró %s",
+	ExpectedMemberName:   "se esperaba un nombre de propiedad después de .",
+	UnexpectedValue:      "token inesperado en el valor: %s",
+	UnclosedBlock:        "bloque sin cerrar",
+	UnclosedNestedBlock:  "bloque anidado sin cerrar",
+	UnclosedArray:        "array sin cerrar",
+	UnclosedObject:       "objeto sin cerrar",
+	UnclosedArguments:    "lista de argumentos sin cerrar",
+	UnknownEntityType:    "tipo de entidad desconocido: %s",
+	ExpectedVersion:      "se esperaba una versión después de @",
+
+	UndeclaredTool:        "usa la herramienta no declarada %q",
+	InvalidPattern:        "patrón no válido en %s(): %v",
+	UndefinedReference:    "hace referencia a %s %q, que no está definido",
+	UnknownStep:           "hace referencia al paso desconocido %q",
+	SelfReference:         "hace referencia a su propia salida",
+	ParallelStepReference: "hace referencia al paso %q, que se ejecuta en el mismo bloque paralelo",
+	LaterStepReference:    "hace referencia al paso %q, que se ejecuta después",
+	PipelineCycle:         "referencia circular entre pipelines: %s",
+	PromptCycle:           "inclusión circular de prompts: %s",
+	MissingName:           "la entidad %s debe tener un nombre",
+	MissingProperty:       "la entidad %s debe tener la propiedad '%s'",
+	MissingFileSource:     "la entidad file debe tener la propiedad 'path' o 'contents'",
+	MissingToolHandler:    "la entidad tool debe tener la propiedad 'command', 'function' o 'handler'",
+	MissingIntentAgent:    "la entidad intent debe tener la propiedad 'use' que haga referencia a un agente",
+	MissingTriggerSource:  "la entidad trigger debe tener la propiedad 'event' o 'schedule'",
+	EmptyConfig:           "la entidad config debe tener al menos una propiedad",
+	MissingScriptSource:   "la entidad script debe tener la propiedad 'code' o 'path'",
+	UnknownConfigKey:      "clave de configuración desconocida %q (¿quiso decir %q?)",
+	InvalidConfigValue:    "config '%s' %v",
+	MissingEvalCases:      "la entidad eval debe tener al menos un bloque 'case'",
+	DuplicateEntity:       "la entidad %s/%s ya existe",
+	UnusedTool:            "la herramienta está declarada pero ningún agente la usa",
+	DeprecatedEntity:      "%s %q está obsoleto",
+
+	InvalidParams:  "parámetros no válidos para %s %q: %s",
+	ParamRequired:  "falta un parámetro obligatorio",
+	ParamUnknown:   "parámetro desconocido",
+	EntityNotFound: "entidad no encontrada: %s %q",
+}
+
+var swedish = map[Code]string{
+	AtPosition: "på rad %d, kolumn %d: %s",
+
+	ExpectedToken:        "förväntade %s, fick %s",
+	ExpectedTopLevel:     "förväntade en identifierare på toppnivå, fick %s",
+	ExpectedEntityName:   "förväntade ett entitetsnamn",
+	ExpectedPropertyName: "förväntade ett egenskapsnamn, fick %s",
+	ExpectedMemberName:   "förväntade ett egenskapsnamn efter .",
+	UnexpectedValue:      "oväntad token i värde: %s",
+	UnclosedBlock:        "oavslutat block",
+	UnclosedNestedBlock:  "oavslutat nästlat block",
+	UnclosedArray:        "oavslutad array",
+	UnclosedObject:       "oavslutat objekt",
+	UnclosedArguments:    "oavslutad argumentlista",
+	UnknownEntityType:    "okänd entitetstyp: %s",
+	ExpectedVersion:      "förväntade en version efter @",
+
+	UndeclaredTool:        "använder det odeklarerade verktyget %q",
+	InvalidPattern:        "ogiltigt mönster i %s(): %v",
+	UndefinedReference:    "refererar till odefinierad %s %q",
+	UnknownStep:           "refererar till det okända steget %q",
+	SelfReference:         "refererar till sin egen utdata",
+	ParallelStepReference: "refererar till steget %q, som körs i samma parallella block",
+	LaterStepReference:    "refererar till steget %q, som körs efter det",
+	PipelineCycle:         "cirkulär pipelinereferens: %s",
+	PromptCycle:           "cirkulär promptinkludering: %s",
+	MissingName:           "entiteten %s måste ha ett namn",
+	MissingProperty:       "entiteten %s måste ha egenskapen '%s'",
+	MissingFileSource:     "entiteten file måste ha egenskapen 'path' eller 'contents'",
+	MissingToolHandler:    "entiteten tool måste ha egenskapen 'command', 'function' eller 'handler'",
+	MissingIntentAgent:    "entiteten intent måste ha egenskapen 'use' som refererar till en agent",
+	MissingTriggerSource:  "entiteten trigger måste ha egenskapen 'event' eller 'schedule'",
+	EmptyConfig:           "entiteten config måste ha minst en egenskap",
+	MissingScriptSource:   "entiteten script måste ha egenskapen 'code' eller 'path'",
+	UnknownConfigKey:      "okänd konfigurationsnyckel %q (menade du %q?)",
+	InvalidConfigValue:    "config '%s' %v",
+	MissingEvalCases:      "entiteten eval måste ha minst ett 'case'-block",
+	DuplicateEntity:       "entiteten %s/%s finns redan",
+	UnusedTool:            "verktyget är deklarerat men används inte av någon agent",
+	DeprecatedEntity:      "%s %q är föråldrad",
+
+	InvalidParams:  "ogiltiga parametrar för %s %q: %s",
+	ParamRequired:  "obligatorisk parameter saknas",
+	ParamUnknown:   "okänd parameter",
+	EntityNotFound: "entiteten hittades inte: %s %q",
+}
@@ -0,0 +1,204 @@
+// Package i18n is the catalog of user-facing messages of the parser,
+// validator, and runtime. Each message has a stable code, such as LS1007,
+// and a template per language:
+//
+//	err := i18n.New(i18n.UnclosedBlock)
+//	err.Error()              // "unclosed block"
+//	err.Localize("de-DE")    // "nicht geschlossener Block"
+//
+// Error() is always English, so logs and error matching stay stable; the
+// CLI and the language server show Localize output to users. Templates use
+// fmt verbs, and translations may reorder arguments with explicit indexes
+// such as %[2]s. A message without a translation falls back to English.
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Code identifies a cataloged message. Codes never change meaning, so
+// tools can match on them whatever the language.
+type Code string
+
+// Message is a cataloged message with the arguments of its template. It
+// implements error with the English text.
+type Message struct {
+	Code Code
+	Args []interface{}
+}
+
+// New returns the message for code with the given template arguments.
+func New(code Code, args ...interface{}) Message {
+	return Message{Code: code, Args: args}
+}
+
+// Error returns the message in English.
+func (m Message) Error() string {
+	return Translate(English, m.Code, m.Args...)
+}
+
+// Localize returns the message in the language of tag.
+func (m Message) Localize(tag string) string {
+	return Translate(tag, m.Code, m.Args...)
+}
+
+// MessageCode returns the message's code.
+func (m Message) MessageCode() Code {
+	return m.Code
+}
+
+// Localizer is implemented by errors that can describe themselves in
+// another language.
+type Localizer interface {
+	Localize(tag string) string
+}
+
+// Localize returns the text of err in the language of tag. If err wraps a
+// Localizer, its part of the text is translated and the wrapping context is
+// kept as is.
+func Localize(err error, tag string) string {
+	text := err.Error()
+	var l Localizer
+	if !errors.As(err, &l) {
+		return text
+	}
+	inner, ok := l.(error)
+	if !ok {
+		return text
+	}
+	return strings.Replace(text, inner.Error(), l.Localize(tag), 1)
+}
+
+// CodeOf returns the code of the first cataloged message err wraps, or ""
+// if there is none. Errors carry a code by implementing MessageCode.
+func CodeOf(err error) Code {
+	var c interface{ MessageCode() Code }
+	if errors.As(err, &c) {
+		return c.MessageCode()
+	}
+	return ""
+}
+
+// Codes returns the codes of every diagnostic the parser, validator, and
+// runtime can report, sorted.
+func Codes() []Code {
+	codes := make([]Code, 0, len(english))
+	for code := range english {
+		if code != AtPosition {
+			codes = append(codes, code)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// IsCode reports whether s is shaped like a diagnostic code: capital
+// letters followed by digits, such as LS2004, or ACME001 for a rule
+// registered outside LangSpace.
+func IsCode(s string) bool {
+	digits := strings.TrimLeft(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	return len(digits) < len(s) && digits != "" && strings.Trim(digits, "0123456789") == ""
+}
+
+// English is the language of the built-in templates every translation
+// falls back to.
+const English = "en"
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]map[Code]string{
+		English: english,
+		"de":    german,
+		"fr":    french,
+		"es":    spanish,
+		"sv":    swedish,
+	}
+)
+
+// Register adds templates for a language tag such as "pt" or "pt-BR",
+// replacing any with the same codes. Region-specific templates take
+// precedence over those of the bare language.
+func Register(tag string, templates map[Code]string) {
+	key := Normalize(tag)
+	mu.Lock()
+	defer mu.Unlock()
+	if catalogs[key] == nil {
+		catalogs[key] = make(map[Code]string, len(templates))
+	}
+	for code, tmpl := range templates {
+		catalogs[key][code] = tmpl
+	}
+}
+
+// Languages returns the tags that have templates, sorted.
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	tags := make([]string, 0, len(catalogs))
+	for tag := range catalogs {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Translate formats the template for code in the language of tag, falling
+// back to the bare language and then English. An unknown code formats as
+// the code followed by its arguments.
+func Translate(tag string, code Code, args ...interface{}) string {
+	tmpl, ok := lookup(Normalize(tag), code)
+	if !ok {
+		if len(args) == 0 {
+			return string(code)
+		}
+		return string(code) + ": " + strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	}
+	if len(args) == 0 {
+		return tmpl
+	}
+	return fmt.Sprintf(tmpl, args...)
+}
+
+func lookup(key string, code Code) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	candidates := []string{key}
+	if lang, _, found := strings.Cut(key, "-"); found {
+		candidates = append(candidates, lang)
+	}
+	for _, c := range append(candidates, English) {
+		if tmpl, ok := catalogs[c][code]; ok {
+			return tmpl, true
+		}
+	}
+	return "", false
+}
+
+// Normalize turns a locale tag such as "de_DE.UTF-8", "de-DE", or "DE" into
+// the lowercase form catalogs are keyed by ("de-de", "de"). The POSIX "C"
+// locale and an empty tag are English.
+func Normalize(tag string) string {
+	tag, _, _ = strings.Cut(strings.TrimSpace(tag), ".")
+	tag, _, _ = strings.Cut(tag, "@")
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" || tag == "c" || tag == "posix" {
+		return English
+	}
+	return tag
+}
+
+// FromEnv returns the language requested by the environment: LANGSPACE_LANG,
+// or else the first of LC_ALL, LC_MESSAGES, and LANG that is set.
+func FromEnv() string {
+	for _, name := range []string{"LANGSPACE_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return Normalize(v)
+		}
+	}
+	return English
+}
@@ -0,0 +1,116 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"", `references undefined agent "writer"`},
+		{"en-GB", `references undefined agent "writer"`},
+		{"de", `verweist auf nicht definierte(s) agent "writer"`},
+		{"fr_CA.UTF-8", `fait référence à agent "writer", qui n'est pas défini`},
+		{"C", `references undefined agent "writer"`},
+		{"pt-BR", `references undefined agent "writer"`},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.tag, UndefinedReference, "agent", "writer"); got != tt.want {
+			t.Errorf("Translate(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+	if got := Translate("en", "LS9999", "x"); got != "LS9999: x" {
+		t.Errorf("expected an unknown code to format as the code, got %q", got)
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, lang := range []string{"de", "fr", "es", "sv"} {
+		for code, tmpl := range english {
+			translated, ok := catalogs[lang][code]
+			if !ok {
+				// Messages that are only their argument need no translation
+				if tmpl != "%v" {
+					t.Errorf("%s: no translation for %s", lang, code)
+				}
+				continue
+			}
+			if strings.Count(translated, "%") != strings.Count(tmpl, "%") {
+				t.Errorf("%s: %s = %q does not take the arguments of %q", lang, code, translated, tmpl)
+			}
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("pt-BR", map[Code]string{UnclosedBlock: "bloco não fechado"})
+	Register("pt", map[Code]string{UnclosedBlock: "bloco por fechar", UnclosedArray: "array não fechado"})
+	defer func() {
+		mu.Lock()
+		delete(catalogs, "pt-br")
+		delete(catalogs, "pt")
+		mu.Unlock()
+	}()
+
+	if got := New(UnclosedBlock).Localize("pt_BR"); got != "bloco não fechado" {
+		t.Errorf("expected the regional template, got %q", got)
+	}
+	if got := New(UnclosedArray).Localize("pt-BR"); got != "array não fechado" {
+		t.Errorf("expected the language template, got %q", got)
+	}
+	if got := New(UnclosedObject).Localize("pt-BR"); got != "unclosed object" {
+		t.Errorf("expected the English fallback, got %q", got)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	err := fmt.Errorf("loading report.ls: %w", New(UnknownStep, "draft"))
+	if got := Localize(err, "sv"); got != `loading report.ls: refererar till det okända steget "draft"` {
+		t.Errorf("unexpected localized error %q", got)
+	}
+	if err.Error() != `loading report.ls: references unknown step "draft"` {
+		t.Errorf("expected Error() to stay in English, got %q", err)
+	}
+	if code := CodeOf(err); code != UnknownStep {
+		t.Errorf("CodeOf = %q, want %q", code, UnknownStep)
+	}
+
+	plain := errors.New("boom")
+	if Localize(plain, "de") != "boom" || CodeOf(plain) != "" {
+		t.Error("expected uncataloged errors to pass through")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("LANGSPACE_LANG", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "sv_SE.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	if got := FromEnv(); got != "sv-se" {
+		t.Errorf("FromEnv() = %q, want sv-se", got)
+	}
+	t.Setenv("LANGSPACE_LANG", "fr")
+	if got := FromEnv(); got != "fr" {
+		t.Errorf("FromEnv() = %q, want fr", got)
+	}
+}
+
+func TestCodes(t *testing.T) {
+	codes := Codes()
+	if len(codes) != len(english)-1 {
+		t.Errorf("expected every code but the position frame, got %d", len(codes))
+	}
+	for i, code := range codes {
+		if !strings.HasPrefix(string(code), "LS") {
+			t.Errorf("unexpected code %q", code)
+		}
+		if i > 0 && codes[i-1] >= code {
+			t.Errorf("codes are not sorted: %q before %q", codes[i-1], code)
+		}
+	}
+}
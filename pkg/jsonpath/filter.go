@@ -0,0 +1,245 @@
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+)
+
+// filterExpr is a condition in a [?(...)] filter, tested against each
+// candidate element in turn.
+type filterExpr interface {
+	match(v interface{}) bool
+}
+
+type orExpr struct{ left, right filterExpr }
+
+func (e orExpr) match(v interface{}) bool { return e.left.match(v) || e.right.match(v) }
+
+type andExpr struct{ left, right filterExpr }
+
+func (e andExpr) match(v interface{}) bool { return e.left.match(v) && e.right.match(v) }
+
+type notExpr struct{ expr filterExpr }
+
+func (e notExpr) match(v interface{}) bool { return !e.expr.match(v) }
+
+// existsExpr is a bare operand: a path matches if it selects anything, a
+// literal if it is true.
+type existsExpr struct{ operand operand }
+
+func (e existsExpr) match(v interface{}) bool {
+	value, ok := e.operand.value(v)
+	if b, isBool := value.(bool); isBool && e.operand.path == nil {
+		return b
+	}
+	return ok
+}
+
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e compareExpr) match(v interface{}) bool {
+	left, lok := e.left.value(v)
+	right, rok := e.right.value(v)
+	if !lok || !rok {
+		// A missing member equals nothing, not even null
+		return e.op == "!=" && lok != rok
+	}
+	return compare(e.op, left, right)
+}
+
+// operand is a relative path (@.field) or a literal.
+type operand struct {
+	path    []segment
+	literal interface{}
+}
+
+// value returns the operand's value for the element v, and false if a path
+// selects nothing.
+func (o operand) value(v interface{}) (interface{}, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	results := evaluate(o.path, v)
+	if len(results) == 0 {
+		return nil, false
+	}
+	return results[0], true
+}
+
+// compare applies a comparison operator. Numbers compare numerically and
+// strings lexically; values of different types are never equal or ordered.
+func compare(op string, left, right interface{}) bool {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compareOrdered(op, l, r)
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compareOrdered(op, l, r)
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			return equality(op, l == r)
+		}
+	case nil:
+		return equality(op, right == nil)
+	}
+	return op == "!="
+}
+
+func compareOrdered[T float64 | string](op string, l, r T) bool {
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return equality(op, l == r)
+}
+
+func equality(op string, equal bool) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	}
+	return false
+}
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseOr parses a filter condition:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" or ")" | operand [ comparison operand ]
+func (p *parser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+}
+
+func (p *parser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (filterExpr, error) {
+	p.skipSpace()
+	if p.peek("!") && !p.peek("!=") {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range comparisonOperators {
+		if p.consume(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compareExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return existsExpr{left}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	p.skipSpace()
+	if p.pos >= len(p.expr) {
+		return operand{}, p.errorf("expected a value")
+	}
+
+	switch c := p.expr[p.pos]; {
+	case c == '@':
+		p.pos++
+		segments, err := p.parseSegments()
+		if err != nil {
+			return operand{}, err
+		}
+		// The element itself has an empty, but non-nil, path
+		if segments == nil {
+			segments = []segment{}
+		}
+		return operand{path: segments}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return operand{}, err
+		}
+		return operand{literal: s}, nil
+	}
+
+	for _, word := range []struct {
+		text  string
+		value interface{}
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		if p.consume(word.text) {
+			return operand{literal: word.value}, nil
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && strings.IndexByte("+-.0123456789eE", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	n, err := strconv.ParseFloat(p.expr[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return operand{}, p.errorf("expected a value")
+	}
+	return operand{literal: n}, nil
+}
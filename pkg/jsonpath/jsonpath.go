@@ -0,0 +1,471 @@
+// Package jsonpath evaluates JSONPath expressions over decoded JSON values
+// (maps, slices, and scalars as produced by encoding/json).
+//
+// Supported syntax:
+//
+//	$                  the root value
+//	.name ['name']     an object member; ['a','b'] selects several
+//	[0] [-1] [0,2]     array elements by index, negative from the end
+//	[1:3] [::2]        array slices, as in Python
+//	.* [*]             every member or element
+//	..name ..*         recursive descent
+//	[?(@.x == 'a')]    elements matching a filter
+//
+// Filters compare relative paths (@.field) and literals (strings in single
+// or double quotes, numbers, true, false, null) with ==, !=, <, <=, >, >=,
+// and combine them with &&, ||, ! and parentheses. A bare path, such as
+// [?(@.tags)], tests that the member exists.
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// segment applies a selector to the current values, or to them and all
+// their descendants if recursive.
+type segment struct {
+	sel       selector
+	recursive bool
+}
+
+// Compile parses a JSONPath expression.
+func Compile(expr string) (*Path, error) {
+	p := &parser{expr: expr}
+	p.skipSpace()
+	if !p.consume("$") {
+		return nil, p.errorf("path must start with $")
+	}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return nil, p.errorf("unexpected %q", p.expr[p.pos:])
+	}
+	return &Path{expr: expr, segments: segments}, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid.
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source expression.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Definite reports whether the path selects at most one value: it has no
+// wildcards, slices, filters, unions, or recursive descent.
+func (p *Path) Definite() bool {
+	for _, seg := range p.segments {
+		if seg.recursive {
+			return false
+		}
+		switch s := seg.sel.(type) {
+		case nameSelector:
+			if len(s) != 1 {
+				return false
+			}
+		case indexSelector:
+			if len(s) != 1 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the values the path selects from v, in document order
+// (object members in key order).
+func (p *Path) Get(v interface{}) []interface{} {
+	return evaluate(p.segments, v)
+}
+
+// Query compiles expr and returns the values it selects from v.
+func Query(v interface{}, expr string) ([]interface{}, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Get(v), nil
+}
+
+func evaluate(segments []segment, v interface{}) []interface{} {
+	current := []interface{}{v}
+	for _, seg := range segments {
+		var next []interface{}
+		for _, value := range current {
+			if seg.recursive {
+				descend(value, func(d interface{}) {
+					next = seg.sel.appendSelected(next, d)
+				})
+			} else {
+				next = seg.sel.appendSelected(next, value)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// descend calls fn for v and each of its descendants, parents first.
+func descend(v interface{}, fn func(interface{})) {
+	fn(v)
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			descend(val[k], fn)
+		}
+	case []interface{}:
+		for _, elem := range val {
+			descend(elem, fn)
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// selector selects children of a value.
+type selector interface {
+	appendSelected(out []interface{}, v interface{}) []interface{}
+}
+
+type nameSelector []string
+
+func (s nameSelector) appendSelected(out []interface{}, v interface{}) []interface{} {
+	if obj, ok := v.(map[string]interface{}); ok {
+		for _, name := range s {
+			if child, ok := obj[name]; ok {
+				out = append(out, child)
+			}
+		}
+	}
+	return out
+}
+
+type wildcardSelector struct{}
+
+func (wildcardSelector) appendSelected(out []interface{}, v interface{}) []interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			out = append(out, val[k])
+		}
+	case []interface{}:
+		out = append(out, val...)
+	}
+	return out
+}
+
+type indexSelector []int
+
+func (s indexSelector) appendSelected(out []interface{}, v interface{}) []interface{} {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return out
+	}
+	for _, i := range s {
+		if i < 0 {
+			i += len(arr)
+		}
+		if i >= 0 && i < len(arr) {
+			out = append(out, arr[i])
+		}
+	}
+	return out
+}
+
+// sliceSelector selects [start:end:step], where nil bounds are open.
+type sliceSelector struct {
+	start, end *int
+	step       int
+}
+
+func (s sliceSelector) appendSelected(out []interface{}, v interface{}) []interface{} {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return out
+	}
+	n := len(arr)
+	bound := func(b *int, def int) int {
+		if b == nil {
+			return def
+		}
+		i := *b
+		if i < 0 {
+			i += n
+		}
+		// Clamp to [-1, n] so that negative steps can reach index 0
+		return max(-1, min(i, n))
+	}
+
+	if s.step > 0 {
+		start, end := max(bound(s.start, 0), 0), bound(s.end, n)
+		for i := start; i < end; i += s.step {
+			out = append(out, arr[i])
+		}
+	} else {
+		start, end := min(bound(s.start, n-1), n-1), bound(s.end, -1)
+		for i := start; i > end; i += s.step {
+			out = append(out, arr[i])
+		}
+	}
+	return out
+}
+
+type filterSelector struct {
+	cond filterExpr
+}
+
+func (s filterSelector) appendSelected(out []interface{}, v interface{}) []interface{} {
+	switch val := v.(type) {
+	case []interface{}:
+		for _, elem := range val {
+			if s.cond.match(elem) {
+				out = append(out, elem)
+			}
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			if s.cond.match(val[k]) {
+				out = append(out, val[k])
+			}
+		}
+	}
+	return out
+}
+
+// parser parses JSONPath expressions.
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSONPath %q at offset %d: %s", p.expr, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(p.expr[p.pos:], s)
+}
+
+func (p *parser) consume(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// parseSegments parses segments for as long as they continue the path.
+func (p *parser) parseSegments() ([]segment, error) {
+	var segments []segment
+	for p.pos < len(p.expr) {
+		var seg segment
+		switch {
+		case p.consume(".."):
+			seg.recursive = true
+			if p.peek("[") {
+				sel, err := p.parseBracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.sel = sel
+				break
+			}
+			sel, err := p.parseDotted()
+			if err != nil {
+				return nil, err
+			}
+			seg.sel = sel
+		case p.consume("."):
+			sel, err := p.parseDotted()
+			if err != nil {
+				return nil, err
+			}
+			seg.sel = sel
+		case p.peek("["):
+			sel, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			seg.sel = sel
+		default:
+			return segments, nil
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// parseDotted parses the name or * after a dot.
+func (p *parser) parseDotted() (selector, error) {
+	if p.consume("*") {
+		return wildcardSelector{}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.expr) && !strings.ContainsRune(".[]()'\" \t=!<>&|,", rune(p.expr[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a member name")
+	}
+	return nameSelector{p.expr[start:p.pos]}, nil
+}
+
+// parseBracket parses a bracketed selector: names, indexes, a slice, a
+// wildcard, or a filter.
+func (p *parser) parseBracket() (selector, error) {
+	p.consume("[")
+	p.skipSpace()
+
+	var sel selector
+	switch {
+	case p.consume("*"):
+		sel = wildcardSelector{}
+
+	case p.consume("?"):
+		p.skipSpace()
+		if !p.consume("(") {
+			return nil, p.errorf("expected ( after ?")
+		}
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected ) to close the filter")
+		}
+		sel = filterSelector{cond: cond}
+
+	case p.peek("'") || p.peek(`"`):
+		var names nameSelector
+		for {
+			name, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+			p.skipSpace()
+			if !p.consume(",") {
+				break
+			}
+			p.skipSpace()
+		}
+		sel = names
+
+	default:
+		var err error
+		if sel, err = p.parseIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.skipSpace()
+	if !p.consume("]") {
+		return nil, p.errorf("expected ]")
+	}
+	return sel, nil
+}
+
+// parseIndexes parses [0], [0,2] or a slice such as [1:3] or [::-1].
+func (p *parser) parseIndexes() (selector, error) {
+	end := strings.IndexByte(p.expr[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("expected ]")
+	}
+	body := p.expr[p.pos : p.pos+end]
+
+	if strings.Contains(body, ":") {
+		parts := strings.Split(body, ":")
+		if len(parts) > 3 {
+			return nil, p.errorf("invalid slice %q", body)
+		}
+		s := sliceSelector{step: 1}
+		bounds := []**int{&s.start, &s.end}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, p.errorf("invalid slice %q", body)
+			}
+			if i == 2 {
+				if n == 0 {
+					return nil, p.errorf("slice step cannot be 0")
+				}
+				s.step = n
+				continue
+			}
+			*bounds[i] = &n
+		}
+		p.pos += end
+		return s, nil
+	}
+
+	var indexes indexSelector
+	for _, part := range strings.Split(body, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, p.errorf("invalid index %q", strings.TrimSpace(part))
+		}
+		indexes = append(indexes, n)
+	}
+	p.pos += end
+	return indexes, nil
+}
+
+// parseString parses a string in single or double quotes; a backslash
+// escapes the next character.
+func (p *parser) parseString() (string, error) {
+	quote := p.expr[p.pos]
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.expr) {
+		c := p.expr[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.expr):
+			sb.WriteByte(p.expr[p.pos])
+			p.pos++
+		case c == quote:
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,131 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const findings = `{
+	"summary": "2 issues",
+	"items": [
+		{"title": "SQL injection", "severity": "high", "score": 9.1, "tags": ["security"]},
+		{"title": "Unused import", "severity": "low", "score": 1},
+		{"title": "Race condition", "severity": "high", "score": 7.5, "fixed": true}
+	],
+	"meta": {"author": {"name": "reviewer"}, "version": 2}
+}`
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestQuery(t *testing.T) {
+	doc := decode(t, findings)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"root member", "$.summary", `["2 issues"]`},
+		{"bracket member", "$['meta']['author'].name", `["reviewer"]`},
+		{"index", "$.items[0].title", `["SQL injection"]`},
+		{"negative index", "$.items[-1].title", `["Race condition"]`},
+		{"union", "$.items[0,2].score", `[9.1, 7.5]`},
+		{"member union", "$.meta['version','missing']", `[2]`},
+		{"wildcard", "$.items[*].severity", `["high", "low", "high"]`},
+		{"object wildcard is key ordered", "$.meta.*", `[{"name": "reviewer"}, 2]`},
+		{"slice", "$.items[1:].title", `["Unused import", "Race condition"]`},
+		{"slice step", "$.items[::2].title", `["SQL injection", "Race condition"]`},
+		{"reverse slice", "$.items[::-1].score", `[7.5, 1, 9.1]`},
+		{"recursive descent", "$..name", `["reviewer"]`},
+		{"recursive wildcard index", "$..tags[0]", `["security"]`},
+		{"filter equality", "$.items[?(@.severity=='high')].title", `["SQL injection", "Race condition"]`},
+		{"filter double quotes", `$.items[?(@.severity == "low")].title`, `["Unused import"]`},
+		{"filter numeric", "$.items[?(@.score > 5 && @.score < 8)].title", `["Race condition"]`},
+		{"filter or", "$.items[?(@.score < 2 || @.fixed == true)].title", `["Unused import", "Race condition"]`},
+		{"filter exists", "$.items[?(@.tags)].title", `["SQL injection"]`},
+		{"filter not", "$.items[?(!@.fixed)].title", `["SQL injection", "Unused import"]`},
+		{"filter parentheses", "$.items[?(!(@.severity == 'high' && @.score > 8))].title", `["Unused import", "Race condition"]`},
+		{"filter not equal includes missing", "$.items[?(@.fixed != true)].title", `["SQL injection", "Unused import"]`},
+		{"filter mixed types", "$.items[?(@.score == '9.1')]", `[]`},
+		{"no match", "$.missing.field", `[]`},
+		{"index on object", "$.meta[0]", `[]`},
+		{"root", "$", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Query(doc, tt.path)
+			if err != nil {
+				t.Fatalf("Query(%q) error = %v", tt.path, err)
+			}
+			var want []interface{}
+			if tt.want == "" {
+				want = []interface{}{doc}
+			} else {
+				want = decode(t, tt.want).([]interface{})
+			}
+			if len(got) == 0 && len(want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Query(%q) = %v, want %v", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"items", "must start with $"},
+		{"$.", "expected a member name"},
+		{"$.items[", "expected ]"},
+		{"$.items[abc]", "invalid index"},
+		{"$.items[1:2:0]", "step cannot be 0"},
+		{"$.items[?(@.a == )]", "expected a value"},
+		{"$.items[?@.a]", "expected ( after ?"},
+		{"$.items[?(@.a == 'x']", "expected ) to close the filter"},
+		{"$['unterminated]", "unterminated string"},
+		{"$.a b", "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := Compile(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile(%q) error = %v, want %q", tt.path, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPath_Definite(t *testing.T) {
+	tests := map[string]bool{
+		"$":                true,
+		"$.a.b[0]":         true,
+		"$['a'][-1]":       true,
+		"$.a[*]":           false,
+		"$.a[0,1]":         false,
+		"$.a[1:]":          false,
+		"$..a":             false,
+		"$.a[?(@.b == 1)]": false,
+		"$['a','b']":       false,
+		"$.a.*":            false,
+	}
+	for path, want := range tests {
+		if got := MustCompile(path).Definite(); got != want {
+			t.Errorf("%s: Definite() = %v, want %v", path, got, want)
+		}
+	}
+}
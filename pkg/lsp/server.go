@@ -8,24 +8,36 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"unicode/utf16"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
 	"github.com/shellkjell/langspace/pkg/workspace"
 )
 
 // Server handles LSP requests.
 type Server struct {
 	workspace *workspace.Workspace
-	files     map[string]string
+	docs      map[string]*parser.Document
 	mu        sync.RWMutex
+
+	// locale is the language of diagnostic messages: the client's, or the
+	// environment's until the client says
+	locale string
+
+	out     io.Writer
+	writeMu sync.Mutex
 }
 
 // NewServer creates a new LSP server.
 func NewServer() *Server {
 	return &Server{
 		workspace: workspace.New(),
-		files:     make(map[string]string),
+		docs:      make(map[string]*parser.Document),
+		locale:    i18n.FromEnv(),
+		out:       os.Stdout,
 	}
 }
 
@@ -41,6 +53,11 @@ func (s *Server) Start() error {
 			}
 			return err
 		}
+		// Document changes are incremental, so they must apply in order
+		if strings.HasPrefix(req.Method, "textDocument/did") {
+			s.handleRequest(req)
+			continue
+		}
 		go s.handleRequest(req)
 	}
 	return nil
@@ -64,10 +81,21 @@ func (s *Server) handleRequest(req Request) {
 
 	switch req.Method {
 	case "initialize":
+		var p struct {
+			Locale string `json:"locale"`
+		}
+		if json.Unmarshal(req.Params, &p) == nil && p.Locale != "" {
+			s.mu.Lock()
+			s.locale = p.Locale
+			s.mu.Unlock()
+		}
 		result = map[string]interface{}{
 			"capabilities": map[string]interface{}{
-				"textDocumentSync":   1, // Full sync
-				"definitionProvider": true,
+				"textDocumentSync":        2, // Incremental sync
+				"definitionProvider":      true,
+				"workspaceSymbolProvider": true,
+				"renameProvider":          true,
+				"foldingRangeProvider":    true,
 			},
 		}
 	case "textDocument/didOpen":
@@ -76,6 +104,12 @@ func (s *Server) handleRequest(req Request) {
 		err = s.handleDidChange(req.Params)
 	case "textDocument/definition":
 		result, err = s.handleDefinition(req.Params)
+	case "workspace/symbol":
+		result, err = s.handleWorkspaceSymbol(req.Params)
+	case "textDocument/rename":
+		result, err = s.handleRename(req.Params)
+	case "textDocument/foldingRange":
+		result, err = s.handleFoldingRange(req.Params)
 	}
 
 	if req.ID != nil {
@@ -88,8 +122,19 @@ func (s *Server) sendResponse(id interface{}, result interface{}, err error) {
 	if err != nil {
 		resp.Error = map[string]string{"message": err.Error()}
 	}
-	data, _ := json.Marshal(resp)
-	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	s.write(resp)
+}
+
+// notify sends a notification to the client.
+func (s *Server) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *Server) write(msg interface{}) {
+	data, _ := json.Marshal(msg)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, _ = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
 }
 
 func (s *Server) handleDidOpen(params json.RawMessage) error {
@@ -103,17 +148,27 @@ func (s *Server) handleDidOpen(params json.RawMessage) error {
 		return err
 	}
 	s.mu.Lock()
-	s.files[p.TextDocument.URI] = p.TextDocument.Text
+	s.docs[p.TextDocument.URI] = parser.NewDocument(p.TextDocument.Text)
 	s.mu.Unlock()
-	return s.reindex()
+	if err := s.reindex(); err != nil {
+		return err
+	}
+	s.publishDiagnostics()
+	return nil
 }
 
+// handleDidChange applies the changes to a document, reparsing only the
+// parts they touch. A change without a range replaces the whole text.
 func (s *Server) handleDidChange(params json.RawMessage) error {
 	var p struct {
 		TextDocument struct {
 			URI string `json:"uri"`
 		} `json:"textDocument"`
 		ContentChanges []struct {
+			Range *struct {
+				Start position `json:"start"`
+				End   position `json:"end"`
+			} `json:"range"`
 			Text string `json:"text"`
 		} `json:"contentChanges"`
 	}
@@ -122,10 +177,31 @@ func (s *Server) handleDidChange(params json.RawMessage) error {
 	}
 	if len(p.ContentChanges) > 0 {
 		s.mu.Lock()
-		s.files[p.TextDocument.URI] = p.ContentChanges[0].Text
+		doc, ok := s.docs[p.TextDocument.URI]
+		for _, c := range p.ContentChanges {
+			if c.Range == nil {
+				doc, ok = parser.NewDocument(c.Text), true
+				continue
+			}
+			if !ok {
+				s.mu.Unlock()
+				return fmt.Errorf("file not found: %s", p.TextDocument.URI)
+			}
+			text := doc.Text()
+			edit := parser.Edit{Start: c.Range.Start.offset(text), End: c.Range.End.offset(text), Text: c.Text}
+			if err := doc.Apply(edit); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+		}
+		s.docs[p.TextDocument.URI] = doc
 		s.mu.Unlock()
 	}
-	return s.reindex()
+	if err := s.reindex(); err != nil {
+		return err
+	}
+	s.publishDiagnostics()
+	return nil
 }
 
 func (s *Server) reindex() error {
@@ -134,14 +210,13 @@ func (s *Server) reindex() error {
 	defer s.mu.RUnlock()
 
 	newWS := workspace.New()
-	for uri, content := range s.files {
-		p := parser.New(content)
-		entities, _, err := p.Parse()
-		if err != nil {
-			log.Printf("indexing error for %s: %v", uri, err)
+	for uri, doc := range s.docs {
+		result := doc.Result()
+		if result.HasErrors() {
+			log.Printf("indexing error for %s: %v", uri, result.Errors[0])
 			continue
 		}
-		for _, e := range entities {
+		for _, e := range result.Entities {
 			// Note: We need to store URI in metadata to allow "Go to Definition" to return correct file
 			e.SetMetadata("uri", uri)
 			if err := newWS.AddEntity(e); err != nil {
@@ -153,6 +228,156 @@ func (s *Server) reindex() error {
 	return nil
 }
 
+// publishDiagnostics sends the diagnostics of every open file, since an
+// edit to one file can fix or break references in the others.
+func (s *Server) publishDiagnostics() {
+	for uri, diags := range s.diagnostics() {
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": diags,
+		})
+	}
+}
+
+// entityKey identifies an entity by where it is declared.
+type entityKey struct {
+	entityType, name string
+	line, column     int
+}
+
+// diagnostics returns the parse and semantic errors of every open file,
+// with messages in the client's locale and their catalog codes.
+func (s *Server) diagnostics() map[string][]map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	diags := make(map[string][]map[string]interface{}, len(s.docs))
+	owners := make(map[entityKey]string)
+	ignored := make(map[string]parser.Suppressions, len(s.docs))
+	for uri, doc := range s.docs {
+		diags[uri] = []map[string]interface{}{}
+		ignored[uri] = parser.ParseSuppressions(doc.Text())
+		result := doc.Result()
+		for _, e := range result.Errors {
+			if ignored[uri].Suppressed(e.Line, e.Code) {
+				continue
+			}
+			diags[uri] = append(diags[uri], newDiagnostic(e.Line, e.Column, e.Code, e.LocalizeMessage(s.locale)))
+		}
+		for _, e := range result.Entities {
+			collectEntities(e, func(n ast.Entity) {
+				owners[entityKey{n.Type(), n.Name(), n.Line(), n.Column()}] = uri
+			})
+		}
+	}
+
+	for _, e := range s.workspace.ValidateSemantics() {
+		uri, ok := owners[entityKey{e.EntityType, e.EntityName, e.Line, e.Column}]
+		if !ok || ignored[uri].Suppressed(e.Line, e.Code) {
+			continue
+		}
+		msg := fmt.Sprintf("%s %q: %s", e.EntityType, e.EntityName, e.LocalizeMessage(s.locale))
+		diags[uri] = append(diags[uri], newDiagnostic(e.Line, e.Column, e.Code, msg))
+	}
+
+	// References to deprecated entities are hints that editors strike
+	// through
+	for _, e := range s.workspace.GetEntities() {
+		reason, ok := e.GetMetadata("deprecated")
+		if !ok {
+			continue
+		}
+		msg := i18n.Translate(s.locale, i18n.DeprecatedEntity, e.Type(), e.Name())
+		if reason != "" {
+			msg += ": " + reason
+		}
+		declared, _ := e.GetMetadata("uri")
+		for uri, doc := range s.docs {
+			for _, ref := range workspace.RenameEdits(doc.Text(), e.Type(), e.Name(), e.Name()) {
+				if ref.InComment || uri == declared && ref.Line == e.Line() || ignored[uri].Suppressed(ref.Line, i18n.DeprecatedEntity) {
+					continue
+				}
+				d := newDiagnostic(ref.Line, ref.Column, i18n.DeprecatedEntity, msg)
+				d["range"] = map[string]interface{}{
+					"start": map[string]int{"line": ref.Line - 1, "character": ref.Column - 1},
+					"end":   map[string]int{"line": ref.Line - 1, "character": ref.Column - 1 + len(ref.OldText)},
+				}
+				d["severity"] = 4    // Hint
+				d["tags"] = []int{2} // Deprecated
+				diags[uri] = append(diags[uri], d)
+			}
+		}
+	}
+	return diags
+}
+
+func newDiagnostic(line, column int, code i18n.Code, message string) map[string]interface{} {
+	start := map[string]int{"line": max(line-1, 0), "character": max(column-1, 0)}
+	d := map[string]interface{}{
+		"range":    map[string]interface{}{"start": start, "end": start},
+		"severity": 1, // Error
+		"source":   "langspace",
+		"message":  message,
+	}
+	if code != "" {
+		d["code"] = string(code)
+	}
+	return d
+}
+
+// collectEntities calls fn for an entity and every entity nested in it:
+// pipeline steps, eval cases, and the blocks of branches, loops, and inline
+// bodies.
+func collectEntities(e ast.Entity, fn func(ast.Entity)) {
+	fn(e)
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		for _, step := range ent.Steps {
+			collectEntities(step, fn)
+		}
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			collectEntities(step, fn)
+		}
+	case *ast.EvalEntity:
+		for _, c := range ent.Cases {
+			collectEntities(c, fn)
+		}
+	}
+	for _, v := range e.Properties() {
+		collectValueEntities(v, fn)
+	}
+}
+
+func collectValueEntities(v ast.Value, fn func(ast.Entity)) {
+	switch val := v.(type) {
+	case ast.NestedEntityValue:
+		if val.Entity != nil {
+			collectEntities(val.Entity, fn)
+		}
+	case ast.ArrayValue:
+		for _, elem := range val.Elements {
+			collectValueEntities(elem, fn)
+		}
+	case ast.ObjectValue:
+		for _, prop := range val.Properties {
+			collectValueEntities(prop, fn)
+		}
+	case ast.BranchValue:
+		for _, c := range val.Cases {
+			collectValueEntities(c, fn)
+		}
+	case ast.LoopValue:
+		for _, body := range val.Body {
+			collectValueEntities(body, fn)
+		}
+	case ast.MethodCallValue:
+		if val.InlineBody != nil {
+			collectEntities(val.InlineBody, fn)
+		}
+	}
+}
+
 func (s *Server) handleDefinition(params json.RawMessage) (interface{}, error) {
 	var p struct {
 		TextDocument struct {
@@ -167,14 +392,15 @@ func (s *Server) handleDefinition(params json.RawMessage) (interface{}, error) {
 		return nil, err
 	}
 
+	// Edits move the entities of open documents, so they are read under
+	// the lock
 	s.mu.RLock()
-	content, ok := s.files[p.TextDocument.URI]
-	ws := s.workspace
-	s.mu.RUnlock()
-
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[p.TextDocument.URI]
 	if !ok {
 		return nil, fmt.Errorf("file not found: %s", p.TextDocument.URI)
 	}
+	content, ws := doc.Text(), s.workspace
 
 	// Simple heuristic: find the word at the position
 	lines := strings.Split(content, "\n")
@@ -228,6 +454,252 @@ func (s *Server) handleDefinition(params json.RawMessage) (interface{}, error) {
 	}, nil
 }
 
+// symbolKinds maps entity types to LSP SymbolKind values.
+var symbolKinds = map[string]int{
+	"file":     1,  // File
+	"pipeline": 2,  // Module
+	"eval":     2,  // Module
+	"profile":  3,  // Namespace
+	"agent":    5,  // Class
+	"mcp":      11, // Interface
+	"provider": 11, // Interface
+	"prompt":   15, // String
+	"tool":     12, // Function
+	"script":   12, // Function
+	"intent":   24, // Event
+	"trigger":  24, // Event
+}
+
+// handleWorkspaceSymbol returns entities matching the query, ranked by the
+// workspace search index. An empty query lists every entity.
+func (s *Server) handleWorkspaceSymbol(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws := s.workspace
+
+	var entities []ast.Entity
+	if strings.TrimSpace(p.Query) == "" {
+		entities = ws.GetEntities()
+	} else {
+		for _, res := range ws.Search(p.Query) {
+			entities = append(entities, res.Entity)
+		}
+	}
+
+	symbols := make([]map[string]interface{}, 0, len(entities))
+	for _, e := range entities {
+		uri, _ := e.GetMetadata("uri")
+		if uri == "" || e.Name() == "" {
+			continue
+		}
+		kind, ok := symbolKinds[e.Type()]
+		if !ok {
+			kind = 19 // Object
+		}
+		symbols = append(symbols, map[string]interface{}{
+			"name":          e.Name(),
+			"kind":          kind,
+			"containerName": e.Type(),
+			"location": map[string]interface{}{
+				"uri": uri,
+				"range": map[string]interface{}{
+					"start": map[string]int{"line": e.Line() - 1, "character": e.Column() - 1},
+					"end":   map[string]int{"line": e.Line() - 1, "character": e.Column() - 1 + len(e.Type())},
+				},
+			},
+		})
+	}
+	return symbols, nil
+}
+
+// handleRename renames the entity or step named at the position, returning
+// the edits for every open file.
+func (s *Server) handleRename(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Position struct {
+			Line      int `json:"line"`
+			Character int `json:"character"`
+		} `json:"position"`
+		NewName string `json:"newName"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if p.NewName == "" {
+		return nil, fmt.Errorf("new name must not be empty")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", p.TextDocument.URI)
+	}
+	content := doc.Text()
+
+	lines := strings.Split(content, "\n")
+	if p.Position.Line >= len(lines) || p.Position.Character > len(lines[p.Position.Line]) {
+		return nil, nil
+	}
+	line := lines[p.Position.Line]
+
+	// Extract the name around the position; unlike definitions, a dot ends
+	// it, so step.name in an interpolation yields the step name
+	start := p.Position.Character
+	for start > 0 && isIdentChar(line[start-1]) && line[start-1] != '.' {
+		start--
+	}
+	end := p.Position.Character
+	for end < len(line) && isIdentChar(line[end]) && line[end] != '.' {
+		end++
+	}
+	symbol := line[start:end]
+	if symbol == "" {
+		return nil, nil
+	}
+
+	// The symbol's type is the one whose rename edits cover the position
+	candidates := []string{"step"}
+	for _, e := range s.workspace.GetEntities() {
+		if e.Name() == symbol {
+			candidates = append([]string{e.Type()}, candidates...)
+		}
+	}
+	var entityType string
+	for _, t := range candidates {
+		for _, edit := range workspace.RenameEdits(content, t, symbol, p.NewName) {
+			if edit.Line-1 == p.Position.Line && edit.Column-1 == start {
+				entityType = t
+				break
+			}
+		}
+		if entityType != "" {
+			break
+		}
+	}
+	if entityType == "" {
+		return nil, fmt.Errorf("no entity or step named %q at this position", symbol)
+	}
+	if _, exists := s.workspace.GetEntityByName(entityType, p.NewName); exists && entityType != "step" {
+		return nil, fmt.Errorf("entity %s/%s already exists", entityType, p.NewName)
+	}
+
+	changes := make(map[string][]map[string]interface{})
+	for uri, doc := range s.docs {
+		for _, edit := range workspace.RenameEdits(doc.Text(), entityType, symbol, p.NewName) {
+			changes[uri] = append(changes[uri], map[string]interface{}{
+				"range": map[string]interface{}{
+					"start": map[string]int{"line": edit.Line - 1, "character": edit.Column - 1},
+					"end":   map[string]int{"line": edit.Line - 1, "character": edit.Column - 1 + len(edit.OldText)},
+				},
+				"newText": edit.NewText,
+			})
+		}
+	}
+	return map[string]interface{}{"changes": changes}, nil
+}
+
+// handleFoldingRange returns the ranges of a document's blocks and arrays
+// that span lines, and of its # region and # endregion comments.
+func (s *Server) handleFoldingRange(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	doc, ok := s.docs[p.TextDocument.URI]
+	var text string
+	if ok {
+		text = doc.Text()
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", p.TextDocument.URI)
+	}
+
+	ranges := []map[string]interface{}{}
+	// fold adds the range of 1-based lines
+	fold := func(start, end int, kind string) {
+		if end <= start {
+			return
+		}
+		r := map[string]interface{}{"startLine": start - 1, "endLine": end - 1}
+		if kind != "" {
+			r["kind"] = kind
+		}
+		ranges = append(ranges, r)
+	}
+
+	// Blocks and arrays fold up to the line before their closing brace or
+	// bracket, which stays visible
+	var open []int
+	for _, t := range tokenizer.New().Tokenize(text) {
+		switch t.Type {
+		case tokenizer.TokenTypeLeftBrace, tokenizer.TokenTypeLeftBracket:
+			open = append(open, t.Line)
+		case tokenizer.TokenTypeRightBrace, tokenizer.TokenTypeRightBracket:
+			if len(open) > 0 {
+				fold(open[len(open)-1], t.Line-1, "")
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	var regions []int
+	for _, d := range parser.ParseDirectives(text) {
+		switch {
+		case d.Name == "region":
+			regions = append(regions, d.Line)
+		case d.Name == "endregion" && len(regions) > 0:
+			fold(regions[len(regions)-1], d.Line, "region")
+			regions = regions[:len(regions)-1]
+		}
+	}
+	return ranges, nil
+}
+
+// position is a position in a document: a 0-based line and a character
+// offset in UTF-16 code units.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// offset returns the byte offset of the position in text. Positions past
+// the end of a line or of the text are moved back to it.
+func (pos position) offset(text string) int {
+	start := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[start:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		start += i + 1
+	}
+	units := 0
+	for i, r := range text[start:] {
+		if r == '\n' || units >= pos.Character {
+			return start + i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(text)
+}
+
 func isIdentChar(c byte) bool {
 	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.'
 }
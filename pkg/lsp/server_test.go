@@ -1,8 +1,13 @@
 package lsp
 
 import (
+	"bytes"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/shellkjell/langspace/pkg/parser"
 )
 
 func TestServer_HandleDefinition(t *testing.T) {
@@ -12,7 +17,7 @@ func TestServer_HandleDefinition(t *testing.T) {
 pipeline "main" {
     step "search" { use: researcher }
 }`
-	s.files[uri] = content
+	s.docs[uri] = parser.NewDocument(content)
 
 	// Index
 	_ = s.reindex()
@@ -67,3 +72,289 @@ func TestIsIdentChar(t *testing.T) {
 		}
 	}
 }
+
+func TestServer_HandleWorkspaceSymbol(t *testing.T) {
+	s := NewServer()
+	uri := "file:///test.ls"
+	s.docs[uri] = parser.NewDocument(`agent "payment-webhook" { description: "Handles payment events" }
+agent "reviewer" { model: "gpt-4" }
+tool "refund" { description: "Refund a payment" }`)
+	_ = s.reindex()
+
+	params, _ := json.Marshal(map[string]string{"query": "payment webhook"})
+	result, err := s.handleWorkspaceSymbol(params)
+	if err != nil {
+		t.Fatalf("handleWorkspaceSymbol failed: %v", err)
+	}
+
+	symbols := result.([]map[string]interface{})
+	if len(symbols) != 2 {
+		t.Fatalf("expected 2 symbols, got %d", len(symbols))
+	}
+	if symbols[0]["name"] != "payment-webhook" || symbols[0]["kind"] != 5 {
+		t.Errorf("expected payment-webhook agent first, got %v", symbols[0])
+	}
+	location := symbols[0]["location"].(map[string]interface{})
+	if location["uri"] != uri {
+		t.Errorf("expected uri %s, got %v", uri, location["uri"])
+	}
+
+	params, _ = json.Marshal(map[string]string{"query": ""})
+	result, _ = s.handleWorkspaceSymbol(params)
+	if got := len(result.([]map[string]interface{})); got != 3 {
+		t.Errorf("expected all 3 symbols for empty query, got %d", got)
+	}
+}
+
+func TestServer_HandleRename(t *testing.T) {
+	s := NewServer()
+	uri := "file:///test.ls"
+	other := "file:///other.ls"
+	s.docs[uri] = parser.NewDocument(`agent "researcher" { model: "gpt-4" }
+pipeline "main" {
+    step "search" { use: researcher }
+    step "write" { input: "Use {{step.search.output}}" }
+}`)
+	s.docs[other] = parser.NewDocument(`pipeline "review" {
+    step "check" { use: agent("researcher") }
+}`)
+	_ = s.reindex()
+
+	rename := func(line, character int, newName string) (map[string][]map[string]interface{}, error) {
+		params, _ := json.Marshal(map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     map[string]int{"line": line, "character": character},
+			"newName":      newName,
+		})
+		result, err := s.handleRename(params)
+		if err != nil {
+			return nil, err
+		}
+		return result.(map[string]interface{})["changes"].(map[string][]map[string]interface{}), nil
+	}
+
+	// Rename the agent from its use in a step
+	changes, err := rename(2, 26, "scout")
+	if err != nil {
+		t.Fatalf("handleRename failed: %v", err)
+	}
+	if len(changes[uri]) != 2 || len(changes[other]) != 1 {
+		t.Fatalf("expected 2 edits in test.ls and 1 in other.ls, got %v", changes)
+	}
+	start := changes[uri][0]["range"].(map[string]interface{})["start"].(map[string]int)
+	if start["line"] != 0 || start["character"] != 7 || changes[uri][0]["newText"] != "scout" {
+		t.Errorf("expected the declaration renamed at 0:7, got %v", changes[uri][0])
+	}
+
+	// Rename the step from an interpolation
+	changes, err = rename(3, 40, "lookup")
+	if err != nil {
+		t.Fatalf("handleRename failed: %v", err)
+	}
+	if len(changes[uri]) != 2 || len(changes[other]) != 0 {
+		t.Errorf("expected the step declaration and interpolation, got %v", changes)
+	}
+
+	if _, err := rename(1, 2, "x"); err == nil {
+		t.Error("expected an error renaming a keyword")
+	}
+}
+
+func TestServer_PublishDiagnostics(t *testing.T) {
+	s := NewServer()
+	var out bytes.Buffer
+	s.out = &out
+	s.handleRequest(Request{ID: 1, Method: "initialize", Params: json.RawMessage(`{"locale": "fr"}`)})
+
+	s.docs["file:///lib.ls"] = parser.NewDocument(`agent "writer" {`)
+	open, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{
+			"uri":  "file:///main.ls",
+			"text": "pipeline \"report\" {\n    step \"draft\" { use: agent(\"editor\") }\n}",
+		},
+	})
+	out.Reset()
+	if err := s.handleDidOpen(open); err != nil {
+		t.Fatalf("handleDidOpen failed: %v", err)
+	}
+
+	published := make(map[string][]map[string]interface{})
+	for _, msg := range strings.Split(out.String(), "Content-Length: ")[1:] {
+		var n struct {
+			Method string `json:"method"`
+			Params struct {
+				URI         string                   `json:"uri"`
+				Diagnostics []map[string]interface{} `json:"diagnostics"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(msg[strings.Index(msg, "{"):]), &n); err != nil {
+			t.Fatalf("invalid message %q: %v", msg, err)
+		}
+		if n.Method == "textDocument/publishDiagnostics" {
+			published[n.Params.URI] = n.Params.Diagnostics
+		}
+	}
+
+	lib := published["file:///lib.ls"]
+	if len(lib) != 1 || lib[0]["code"] != "LS1007" || lib[0]["message"] != "bloc non fermé" {
+		t.Errorf("expected an unclosed block error in French, got %v", lib)
+	}
+	doc := published["file:///main.ls"]
+	if len(doc) != 1 || doc[0]["code"] != "LS2004" || doc[0]["message"] != `step "draft": fait référence à agent "editor", qui n'est pas défini` {
+		t.Errorf("expected an undefined agent error in French, got %v", doc)
+	}
+	start := doc[0]["range"].(map[string]interface{})["start"].(map[string]interface{})
+	if start["line"] != float64(1) || start["character"] != float64(4) {
+		t.Errorf("expected the error at the step, got %v", start)
+	}
+}
+
+func TestServer_Diagnostics_Ignored(t *testing.T) {
+	s := NewServer()
+	s.out = &bytes.Buffer{}
+	open, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{
+			"uri":  "file:///main.ls",
+			"text": "pipeline \"report\" {\n    # langspace:ignore LS2004 editor comes from a plugin\n    step \"draft\" { use: agent(\"editor\") }\n    step \"check\" { use: agent(\"checker\") }\n}",
+		},
+	})
+	if err := s.handleDidOpen(open); err != nil {
+		t.Fatalf("handleDidOpen failed: %v", err)
+	}
+
+	diags := s.diagnostics()["file:///main.ls"]
+	if len(diags) != 1 || !strings.Contains(diags[0]["message"].(string), `"checker"`) {
+		t.Errorf("expected only the unsuppressed error, got %v", diags)
+	}
+}
+
+func TestServer_HandleDidChange_Incremental(t *testing.T) {
+	s := NewServer()
+	s.out = &bytes.Buffer{}
+	uri := "file:///main.ls"
+	open, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{
+			"uri":  uri,
+			"text": "agent \"writer\" {\n  model: \"gpt-4o\"\n}\n\nagent \"reviewer\" {\n  model: \"gpt-4o\"\n}\n",
+		},
+	})
+	if err := s.handleDidOpen(open); err != nil {
+		t.Fatalf("handleDidOpen failed: %v", err)
+	}
+
+	change := func(changes ...map[string]interface{}) {
+		t.Helper()
+		params, _ := json.Marshal(map[string]interface{}{
+			"textDocument":   map[string]string{"uri": uri},
+			"contentChanges": changes,
+		})
+		if err := s.handleDidChange(params); err != nil {
+			t.Fatalf("handleDidChange failed: %v", err)
+		}
+	}
+	edit := func(line, start, end int, text string) map[string]interface{} {
+		return map[string]interface{}{
+			"range": map[string]interface{}{
+				"start": map[string]int{"line": line, "character": start},
+				"end":   map[string]int{"line": line, "character": end},
+			},
+			"text": text,
+		}
+	}
+
+	// Rename the writer, then add a line to it
+	change(edit(0, 7, 13, "author"), edit(1, 17, 17, "\n  temperature: 0.2"))
+	want := "agent \"author\" {\n  model: \"gpt-4o\"\n  temperature: 0.2\n}\n\nagent \"reviewer\" {\n  model: \"gpt-4o\"\n}\n"
+	if got := s.docs[uri].Text(); got != want {
+		t.Fatalf("text = %q, want %q", got, want)
+	}
+	if _, ok := s.workspace.GetEntityByName("agent", "author"); !ok {
+		t.Error("expected the renamed agent to be indexed")
+	}
+	if e, ok := s.workspace.GetEntityByName("agent", "reviewer"); !ok || e.Line() != 6 {
+		t.Errorf("expected the reviewer at line 6, got %v", e)
+	}
+
+	// A change without a range replaces the text
+	change(map[string]interface{}{"text": "agent \"solo\" {}"})
+	if entities := s.workspace.GetEntities(); len(entities) != 1 || entities[0].Name() != "solo" {
+		t.Errorf("expected only the solo agent, got %v", entities)
+	}
+}
+
+func TestPosition_Offset(t *testing.T) {
+	text := "a: \"é𝄞x\"\nb"
+	tests := []struct {
+		pos  position
+		want int
+	}{
+		{position{0, 0}, 0},
+		{position{0, 4}, 4},  // é
+		{position{0, 5}, 6},  // 𝄞, two UTF-16 units
+		{position{0, 7}, 10}, // x
+		{position{0, 99}, 12},
+		{position{1, 1}, 14},
+		{position{5, 0}, 14},
+	}
+	for _, tt := range tests {
+		if got := tt.pos.offset(text); got != tt.want {
+			t.Errorf("offset(%+v) = %d, want %d", tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestServer_HandleFoldingRange(t *testing.T) {
+	s := NewServer()
+	uri := "file:///main.ls"
+	s.docs[uri] = parser.NewDocument(`# region agents
+agent "writer" {
+  model: "gpt-4o"
+  tools: [
+    "search"
+  ]
+}
+agent "reviewer" { model: "gpt-4o" }
+# endregion
+`)
+
+	result, err := s.handleFoldingRange(json.RawMessage(`{"textDocument": {"uri": "file:///main.ls"}}`))
+	if err != nil {
+		t.Fatalf("handleFoldingRange failed: %v", err)
+	}
+	got, _ := json.Marshal(result)
+	want := `[{"endLine":4,"startLine":3},{"endLine":5,"startLine":1},{"endLine":8,"kind":"region","startLine":0}]`
+	if string(got) != want {
+		t.Errorf("folding ranges = %s, want %s", got, want)
+	}
+}
+
+func TestServer_Diagnostics_Deprecated(t *testing.T) {
+	s := NewServer()
+	s.out = &bytes.Buffer{}
+	s.locale = "en"
+	open, _ := json.Marshal(map[string]interface{}{
+		"textDocument": map[string]string{
+			"uri":  "file:///main.ls",
+			"text": "# langspace:deprecated use \"author\"\nagent \"writer\" {\n  model: \"gpt-4o\"\n}\n\npipeline \"report\" {\n  step \"draft\" { use: agent(\"writer\") }\n}\n",
+		},
+	})
+	if err := s.handleDidOpen(open); err != nil {
+		t.Fatalf("handleDidOpen failed: %v", err)
+	}
+
+	diags := s.diagnostics()["file:///main.ls"]
+	if len(diags) != 1 {
+		t.Fatalf("expected a hint at the one reference, got %v", diags)
+	}
+	d := diags[0]
+	if d["code"] != "LS2203" || d["severity"] != 4 || d["message"] != `agent "writer" is deprecated: use "author"` {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+	want := map[string]interface{}{
+		"start": map[string]int{"line": 6, "character": 29},
+		"end":   map[string]int{"line": 6, "character": 35},
+	}
+	if !reflect.DeepEqual(d["range"], want) {
+		t.Errorf("range = %v, want %v", d["range"], want)
+	}
+}
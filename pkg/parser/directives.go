@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
+)
+
+// directivePrefix starts the comments of directives other than regions.
+const directivePrefix = "langspace:"
+
+// ParseDirectives returns the directives in the comments of source, in
+// order:
+//
+//	# region agents
+//	# langspace:deprecated use "reviewer-v2"
+//	agent "reviewer" { ... }
+//	# endregion
+//
+// The parser records a deprecated directive on the entity declared on its
+// target line, as the "deprecated" metadata key with the reason as its
+// value.
+func ParseDirectives(source string) []ast.Directive {
+	var comments, tokens []tokenizer.Token
+	for _, t := range tokenizer.New().Tokenize(source) {
+		if t.Type == tokenizer.TokenTypeComment {
+			comments = append(comments, t)
+		} else {
+			tokens = append(tokens, t)
+		}
+	}
+	return directives(comments, tokens)
+}
+
+// directives returns the directives among comments. tokens are the other
+// tokens of the source, in order, which locate the code each applies to.
+func directives(comments, tokens []tokenizer.Token) []ast.Directive {
+	var result []ast.Directive
+	for _, c := range comments {
+		name, text, ok := parseDirective(c.Value)
+		if !ok {
+			continue
+		}
+		d := ast.Directive{Name: name, Text: text, Line: c.Line, Column: c.Column}
+		next := sort.Search(len(tokens), func(k int) bool { return tokens[k].Offset > c.Offset })
+		switch {
+		case next > 0 && tokens[next-1].Line == c.Line:
+			d.Target = c.Line
+		case next < len(tokens):
+			d.Target = tokens[next].Line
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// parseDirective returns the name and text of a directive comment, and
+// whether the comment is one.
+func parseDirective(comment string) (name, text string, ok bool) {
+	body := strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	rest, prefixed := strings.CutPrefix(body, directivePrefix)
+	if !prefixed {
+		rest = body
+	}
+	name, text = rest, ""
+	if k := strings.IndexAny(rest, " \t"); k >= 0 {
+		name, text = rest[:k], strings.TrimSpace(rest[k+1:])
+	}
+	if prefixed {
+		return name, text, name != ""
+	}
+	return name, text, name == "region" || name == "endregion"
+}
+
+// annotate records on an entity the comments about it: that it is
+// deprecated, if a deprecated directive applies to the line it is declared
+// on, and its doc comment.
+func (p *Parser) annotate(e ast.Entity) {
+	if len(p.comments) == 0 {
+		return
+	}
+	if p.deprecations == nil {
+		p.deprecations = make(map[int]string)
+		for _, d := range directives(p.comments, p.tokens) {
+			if d.Name == "deprecated" && d.Target > 0 {
+				p.deprecations[d.Target] = d.Text
+			}
+		}
+		p.docs = docComments(p.comments, p.tokens)
+	}
+	if reason, ok := p.deprecations[e.Line()]; ok {
+		e.SetMetadata("deprecated", reason)
+	}
+	if doc, ok := p.docs[e.Line()]; ok {
+		e.SetMetadata(ast.DocMetadataKey, doc)
+	}
+}
+
+// docComments returns the doc comments among comments by the line of the
+// code they document. A doc comment is a run of comments on lines of their
+// own that ends on the line before the code:
+//
+//	# Reviews pull requests for style and correctness.
+//	# Uses the team's review checklist.
+//	agent "reviewer" { ... }
+//
+// Directives in the run are left out of its text.
+func docComments(comments, tokens []tokenizer.Token) map[int]string {
+	code := make(map[int]bool, len(tokens))
+	for _, t := range tokens {
+		code[t.Line] = true
+	}
+	docs := make(map[int]string)
+	var lines []string
+	last := 0 // line of the last comment of the run
+	for _, c := range comments {
+		if code[c.Line] {
+			continue // after code on its line
+		}
+		if c.Line != last+1 {
+			lines = nil
+		}
+		last = c.Line
+		if _, _, ok := parseDirective(c.Value); !ok {
+			text := strings.TrimPrefix(c.Value, "#")
+			lines = append(lines, strings.TrimRight(strings.TrimPrefix(text, " "), " \t"))
+		}
+		if code[last+1] {
+			if doc := strings.Trim(strings.Join(lines, "\n"), "\n"); doc != "" {
+				docs[last+1] = doc
+			}
+			lines = nil
+		}
+	}
+	return docs
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+const directivesSource = `# region agents
+# langspace:deprecated use "reviewer-v2"
+agent "reviewer" {
+  model: "gpt-4o"
+}
+
+agent "writer" { model: "gpt-4o" } # langspace:deprecated
+
+pipeline "review" {
+  #langspace:deprecated
+  step "draft" { use: agent("writer") }
+}
+#endregion
+# regional settings
+`
+
+func TestParseDirectives(t *testing.T) {
+	want := []ast.Directive{
+		{Name: "region", Text: "agents", Line: 1, Column: 1, Target: 3},
+		{Name: "deprecated", Text: `use "reviewer-v2"`, Line: 2, Column: 1, Target: 3},
+		{Name: "deprecated", Line: 7, Column: 36, Target: 7},
+		{Name: "deprecated", Line: 10, Column: 3, Target: 11},
+		{Name: "endregion", Line: 13, Column: 1},
+	}
+	if got := ParseDirectives(directivesSource); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDirectives() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParser_Deprecated(t *testing.T) {
+	result := New(directivesSource).ParseWithRecovery()
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+
+	deprecated := func(e ast.Entity) string {
+		reason, ok := e.GetMetadata("deprecated")
+		if !ok {
+			return "<none>"
+		}
+		return reason
+	}
+	reviewer, writer := result.Entities[0], result.Entities[1]
+	if got := deprecated(reviewer); got != `use "reviewer-v2"` {
+		t.Errorf("reviewer deprecated = %q", got)
+	}
+	if got := deprecated(writer); got != "" {
+		t.Errorf("writer deprecated = %q, want an empty reason", got)
+	}
+	pipeline := result.Entities[2].(*ast.PipelineEntity)
+	if got := deprecated(pipeline); got != "<none>" {
+		t.Errorf("pipeline deprecated = %q, want none", got)
+	}
+	if got := deprecated(pipeline.Steps[0]); got != "" {
+		t.Errorf("step deprecated = %q, want an empty reason", got)
+	}
+}
+
+func TestParser_DocComments(t *testing.T) {
+	result := New(`# Project agents, not a doc comment
+
+# Reviews pull requests for style and correctness.
+#
+# Uses the team's checklist.
+# langspace:deprecated use "reviewer-v2"
+agent "reviewer" {
+  model: "gpt-4o" # not a doc comment
+}
+agent "writer" { model: "gpt-4o" }
+
+pipeline "review" {
+  # Drafts the review.
+  step "draft" { use: agent("writer") }
+}
+`).ParseWithRecovery()
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+
+	reviewer, writer := result.Entities[0], result.Entities[1]
+	if got, want := ast.Doc(reviewer), "Reviews pull requests for style and correctness.\n\nUses the team's checklist."; got != want {
+		t.Errorf("reviewer doc = %q, want %q", got, want)
+	}
+	if _, ok := reviewer.GetMetadata("deprecated"); !ok {
+		t.Error("expected the directive in the doc comment to apply")
+	}
+	if _, ok := writer.GetMetadata(ast.DocMetadataKey); ok {
+		t.Errorf("writer doc = %q, want none", ast.Doc(writer))
+	}
+	pipeline := result.Entities[2].(*ast.PipelineEntity)
+	if got := ast.Doc(pipeline.Steps[0]); got != "Drafts the review." {
+		t.Errorf("step doc = %q", got)
+	}
+}
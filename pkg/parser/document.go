@@ -0,0 +1,357 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
+)
+
+// Document is a source file that is parsed incrementally as it is edited:
+// an edit reparses only the top-level declarations it touches and reuses
+// the others, so editors can keep the AST and diagnostics of a large file
+// current on every keystroke.
+//
+// Declarations an edit does not touch keep their entities; when the edit
+// adds or removes lines, their positions are updated in place. A Document
+// is not safe for concurrent use.
+type Document struct {
+	text   string
+	blocks []block
+}
+
+// block is a top-level declaration, or a parse error and the tokens skipped
+// to recover from it. It spans from its first token, or the comments on the
+// lines before it, to the next block's start, or to the end of the text.
+type block struct {
+	start, end   int // byte offsets
+	line, column int
+
+	entity ast.Entity
+	imp    *ast.Import
+	err    *ParseError
+
+	// closed is true if parsing the block looked at no token after its
+	// last one, so text after it cannot change it
+	closed bool
+}
+
+// Edit replaces the text between two byte offsets of a document.
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// NewDocument parses text.
+func NewDocument(text string) *Document {
+	blocks, _ := parseBlocks(text, 0, len(text), 1, 1)
+	return &Document{text: text, blocks: blocks}
+}
+
+// Text returns the document's current text.
+func (d *Document) Text() string {
+	return d.text
+}
+
+// Result returns the entities, imports, and errors of the document, as
+// ParseWithRecovery returns them for its text.
+func (d *Document) Result() ParseResult {
+	result := ParseResult{
+		Entities: make([]ast.Entity, 0, len(d.blocks)),
+		Imports:  make([]ast.Import, 0),
+		Errors:   make([]ParseError, 0),
+	}
+	for _, b := range d.blocks {
+		switch {
+		case b.err != nil:
+			result.Errors = append(result.Errors, *b.err)
+		case b.entity != nil:
+			result.Entities = append(result.Entities, b.entity)
+		case b.imp != nil:
+			result.Imports = append(result.Imports, *b.imp)
+		}
+	}
+	return result
+}
+
+// Declaration returns the byte offsets of the top-level declaration of an
+// entity, from the comments on the lines before it to the start of the next
+// declaration or the end of the text, so removing them removes the entity.
+func (d *Document) Declaration(entityType, name string) (start, end int, ok bool) {
+	for _, b := range d.blocks {
+		if b.entity != nil && b.entity.Type() == entityType && b.entity.Name() == name {
+			return b.start, b.end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Apply applies edits in order, each to the text the previous one left,
+// and reparses what they changed.
+func (d *Document) Apply(edits ...Edit) error {
+	for _, e := range edits {
+		if e.Start < 0 || e.Start > e.End || e.End > len(d.text) {
+			return fmt.Errorf("edit %d-%d is outside the document (%d bytes)", e.Start, e.End, len(d.text))
+		}
+		d.apply(e)
+	}
+	return nil
+}
+
+func (d *Document) apply(e Edit) {
+	old := d.text
+	text := old[:e.Start] + e.Text + old[e.End:]
+	delta := len(e.Text) - (e.End - e.Start)
+	lines := strings.Count(e.Text, "\n") - strings.Count(old[e.Start:e.End], "\n")
+	n := len(d.blocks)
+
+	// Reparse from the first block the edit touches, or from an earlier one
+	// whose parse looked into it or that starts on the same line, since
+	// directives apply to lines
+	i := sort.Search(n, func(k int) bool { return d.blocks[k].end >= e.Start })
+	for i > 0 && (!d.blocks[i-1].closed || i < n && midLine(old, d.blocks[i].start)) {
+		i--
+	}
+	// The first block is reparsed from the start of the text, which may end
+	// in characters the edit joins to it
+	start, line, column := 0, 1, 1
+	if i > 0 {
+		start, line, column = d.blocks[i].start, d.blocks[i].line, d.blocks[i].column
+	}
+
+	// up to the last block it touches and the blocks that start on the line
+	// it ends on, since their columns move, or on the line of the last
+	j := sort.Search(n, func(k int) bool { return d.blocks[k].start > e.End }) - 1
+	for j+1 < n && (!strings.Contains(old[e.End:d.blocks[j+1].start], "\n") || midLine(old, d.blocks[j+1].start)) {
+		j++
+	}
+
+	var blocks []block
+	for {
+		end := len(old)
+		if j+1 < n {
+			end = d.blocks[j+1].start
+		}
+		var clean bool
+		blocks, clean = parseBlocks(text, start, end+delta, line, column)
+		if end == len(old) || clean && (len(blocks) == 0 || blocks[len(blocks)-1].closed) {
+			break
+		}
+		// The text or its last block may go on into the next blocks:
+		// reparse up to the next block that ended cleanly, and the rest of
+		// its line
+		for j++; j+1 < n && (!d.blocks[j].closed || midLine(old, d.blocks[j+1].start)); j++ {
+		}
+	}
+
+	rest := d.blocks[j+1:]
+	result := make([]block, 0, i+len(blocks)+len(rest))
+	result = append(result, d.blocks[:i]...)
+	result = append(result, blocks...)
+	for _, b := range rest {
+		b.start += delta
+		b.end += delta
+		if lines != 0 {
+			b.shift(lines)
+		}
+		result = append(result, b)
+	}
+	// The block before the reparsed ones runs up to the next
+	if i > 0 {
+		result[i-1].end = len(text)
+		if i < len(result) {
+			result[i-1].end = result[i].start
+		}
+	}
+	d.text, d.blocks = text, result
+}
+
+// parseBlocks parses text[start:end], which begins at line and column, into
+// blocks. It reports whether the text ends between blocks, rather than in a
+// token or comment that goes on past end, or in comments that lead the block
+// after it.
+func parseBlocks(text string, start, end, line, column int) ([]block, bool) {
+	// A byte past the end is tokenized too: if a token starts there, the
+	// text before it ends between tokens
+	src := text[start:min(end+1, len(text))]
+	p := New(src)
+	p.tokenize()
+	clean := end == len(text)
+	if n := len(p.tokens); n > 0 && p.tokens[n-1].Offset >= end-start {
+		clean = p.tokens[n-1].Offset == end-start
+		p.tokens = p.tokens[:n-1]
+	}
+	if n := len(p.comments); n > 0 && p.comments[n-1].Offset >= end-start {
+		clean = p.comments[n-1].Offset == end-start
+		p.comments = p.comments[:n-1]
+	}
+
+	lineStarts := []int{0}
+	for k := 0; k < len(src); k++ {
+		if src[k] == '\n' {
+			lineStarts = append(lineStarts, k+1)
+		}
+	}
+	// position returns the line and column of an offset into src
+	position := func(offset int) (int, int) {
+		k := sort.SearchInts(lineStarts, offset+1) - 1
+		if k == 0 {
+			return line, column + offset
+		}
+		return line + k, offset - lineStarts[k] + 1
+	}
+	for _, tokens := range [][]tokenizer.Token{p.tokens, p.comments} {
+		for k := range tokens {
+			t := &tokens[k]
+			// Columns on the first line follow the text before start
+			if len(lineStarts) == 1 || t.Offset < lineStarts[1] {
+				t.Column += column - 1
+			}
+			t.Line += line - 1
+		}
+	}
+
+	var blocks []block
+	comment := 0
+	for p.pos < len(p.tokens) {
+		// A block starts at the comments on the lines before it, so editing
+		// them, which may change directives, reparses it
+		offset := p.tokens[p.pos].Offset
+		for comment < len(p.comments) && p.comments[comment].Offset < offset &&
+			p.pos > 0 && p.comments[comment].Line <= p.tokens[p.pos-1].Line {
+			comment++
+		}
+		if comment < len(p.comments) && p.comments[comment].Offset < offset {
+			offset = p.comments[comment].Offset
+		}
+		b := block{start: start + offset}
+		b.line, b.column = position(offset)
+		p.seen = p.pos
+		entity, imp, err := p.parseTopLevel()
+		if err != nil {
+			b.err = err
+			p.skipToRecoveryPoint()
+		} else {
+			b.entity, b.imp = entity, imp
+		}
+		// Recovery stops after a closing brace or semicolon, or at the end
+		last := p.tokens[p.pos-1].Type
+		b.closed = p.seen < p.pos && (err == nil ||
+			last == tokenizer.TokenTypeRightBrace || last == tokenizer.TokenTypeSemicolon)
+		blocks = append(blocks, b)
+	}
+	// Comments on the lines after the last token lead the next block
+	if n := len(p.comments); n > 0 && (len(p.tokens) == 0 || p.comments[n-1].Line > p.tokens[len(p.tokens)-1].Line) {
+		clean = false
+	}
+	for k := range blocks {
+		blocks[k].end = end
+		if k+1 < len(blocks) {
+			blocks[k].end = blocks[k+1].start
+		}
+	}
+	return blocks, clean
+}
+
+// midLine reports whether text before offset on its line is not blank.
+func midLine(text string, offset int) bool {
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	return strings.TrimSpace(text[lineStart:offset]) != ""
+}
+
+// shift moves the block down by lines.
+func (b *block) shift(lines int) {
+	b.line += lines
+	if b.entity != nil {
+		shiftEntity(b.entity, lines)
+	}
+	if b.imp != nil {
+		b.imp.Line += lines
+	}
+	// Errors at the end of the input have no position
+	if b.err != nil && b.err.Line > 0 {
+		b.err.Line += lines
+	}
+}
+
+// shiftEntity moves an entity and the entities nested in it down by lines.
+func shiftEntity(e ast.Entity, lines int) {
+	e.SetLocation(e.Line()+lines, e.Column())
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		for _, step := range ent.Steps {
+			shiftEntity(step, lines)
+		}
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			shiftEntity(step, lines)
+		}
+	case *ast.ProfileEntity:
+		for _, overlay := range ent.Overlays {
+			shiftEntity(overlay, lines)
+		}
+	case *ast.EvalEntity:
+		for _, c := range ent.Cases {
+			shiftEntity(c, lines)
+		}
+	}
+	for _, v := range e.Properties() {
+		shiftValue(v, lines)
+	}
+}
+
+// shiftValue moves the entities nested in a value down by lines.
+func shiftValue(v ast.Value, lines int) {
+	switch val := v.(type) {
+	case ast.NestedEntityValue:
+		if val.Entity != nil {
+			shiftEntity(val.Entity, lines)
+		}
+	case ast.ArrayValue:
+		for _, elem := range val.Elements {
+			shiftValue(elem, lines)
+		}
+	case ast.ObjectValue:
+		for _, prop := range val.Properties {
+			shiftValue(prop, lines)
+		}
+	case ast.MethodCallValue:
+		shiftValue(val.Object, lines)
+		for _, arg := range val.Arguments {
+			shiftValue(arg, lines)
+		}
+		if val.InlineBody != nil {
+			shiftEntity(val.InlineBody, lines)
+		}
+	case ast.FunctionCallValue:
+		for _, arg := range val.Arguments {
+			shiftValue(arg, lines)
+		}
+	case ast.ComparisonValue:
+		shiftValue(val.Left, lines)
+		shiftValue(val.Right, lines)
+	case ast.CoalesceValue:
+		shiftValue(val.Left, lines)
+		shiftValue(val.Right, lines)
+	case ast.ArithmeticValue:
+		shiftValue(val.Left, lines)
+		shiftValue(val.Right, lines)
+	case ast.LogicalValue:
+		shiftValue(val.Left, lines)
+		shiftValue(val.Right, lines)
+	case ast.NotValue:
+		shiftValue(val.Operand, lines)
+	case ast.BranchValue:
+		shiftValue(val.Condition, lines)
+		for _, c := range val.Cases {
+			shiftValue(c, lines)
+		}
+	case ast.LoopValue:
+		for _, body := range val.Body {
+			shiftValue(body, lines)
+		}
+		shiftValue(val.BreakCondition, lines)
+	}
+}
@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+const documentSource = `import "lib/tools.ls" as tools
+
+agent "writer" {
+  model: "gpt-4o"
+  instruction: ` + "```" + `
+    Write { carefully }
+  ` + "```" + `
+}
+
+# a comment between blocks
+# langspace:deprecated use "publish"
+pipeline "review" {
+  step "draft" {
+    use: agent("writer")
+  }
+  step "check" {
+    use: agent("reviewer")
+    input: step("draft").output ?? "none"
+  }
+}
+
+file "notes.md" contents;
+
+agent "reviewer" { model: "gpt-4o" } # langspace:deprecated
+tool "search" {
+  command: "grep"
+}
+`
+
+// describe summarizes a parse result with the positions and deprecations of
+// every entity, nested ones included.
+func describe(r ParseResult) string {
+	var b strings.Builder
+	var entity func(e ast.Entity, depth int)
+	entity = func(e ast.Entity, depth int) {
+		fmt.Fprintf(&b, "%s%s %q %d:%d", strings.Repeat("  ", depth), e.Type(), e.Name(), e.Line(), e.Column())
+		if reason, ok := e.GetMetadata("deprecated"); ok {
+			fmt.Fprintf(&b, " deprecated %q", reason)
+		}
+		b.WriteString("\n")
+		if p, ok := e.(*ast.PipelineEntity); ok {
+			for _, step := range p.Steps {
+				entity(step, depth+1)
+			}
+		}
+	}
+	for _, e := range r.Entities {
+		entity(e, 0)
+	}
+	for _, imp := range r.Imports {
+		fmt.Fprintf(&b, "import %q as %q %d:%d\n", imp.Path, imp.Alias, imp.Line, imp.Column)
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(&b, "error %s %d:%d\n", err.Code, err.Line, err.Column)
+	}
+	return b.String()
+}
+
+func TestDocument_MatchesFullParse(t *testing.T) {
+	doc := NewDocument(documentSource)
+	if got, want := describe(doc.Result()), describe(New(documentSource).ParseWithRecovery()); got != want {
+		t.Fatalf("NewDocument:\n%s\nwant\n%s", got, want)
+	}
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{"rename", `agent "writer"`, `agent "author"`},
+		{"add_lines", `  model: "gpt-4o"` + "\n  instruction", "  model: \"gpt-4o\"\n\n\n  instruction"},
+		{"remove_lines", "}\n\n# a comment", "}# a comment"},
+		{"open_brace", `step "check" {`, `step "check" { {`},
+		{"close_brace", `use: agent("writer")`, `use: agent("writer") }`},
+		{"unclosed_string", `"none"`, `"none`},
+		{"unclosed_block", "  }\n}\n\nfile", "  }\n\nfile"},
+		{"same_line", `agent "reviewer" { model: "gpt-4o" }`, `agent "reviewer" { model: "gpt-4o" } agent "x" {}`},
+		{"import_alias", `as tools`, ``},
+		{"legacy", `contents;`, `contents`},
+		{"leading", `import`, "\n\nagent \"first\" {}\nimport"},
+		{"deprecate", "# a comment between blocks", "# langspace:deprecated"},
+		{"undeprecate", "# langspace:deprecated use", "# use"},
+		{"trailing", `} # langspace:deprecated`, `}`},
+		{"append", "command: \"grep\"\n}\n", "command: \"grep\"\n}\nagent \"last\" {"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := NewDocument(documentSource)
+			start := strings.Index(documentSource, tt.old)
+			if start < 0 {
+				t.Fatalf("%q is not in the source", tt.old)
+			}
+			if err := doc.Apply(Edit{Start: start, End: start + len(tt.old), Text: tt.new}); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			text := strings.Replace(documentSource, tt.old, tt.new, 1)
+			if doc.Text() != text {
+				t.Fatalf("Text() = %q, want %q", doc.Text(), text)
+			}
+			if got, want := describe(doc.Result()), describe(New(text).ParseWithRecovery()); got != want {
+				t.Errorf("Result():\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDocument_RandomEdits(t *testing.T) {
+	snippets := []string{"", "{", "}", "\"", "\n", ";", " ", "```", "# ", "agent \"x\" {", "step \"s\" { use: agent(\"a\") }\n", "import \"y\"", " as z", "model: 1\n", "\\", "\r\n", "a", "# langspace:deprecated\n", "#"}
+	rng := rand.New(rand.NewSource(1))
+	doc := NewDocument(documentSource)
+	text := documentSource
+	for k := 0; k < 2000; k++ {
+		start := rng.Intn(len(text) + 1)
+		end := min(start+rng.Intn(4), len(text))
+		if rng.Intn(3) == 0 {
+			end = start
+		}
+		e := Edit{Start: start, End: end, Text: snippets[rng.Intn(len(snippets))]}
+		if err := doc.Apply(e); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		text = text[:start] + e.Text + text[end:]
+		if got, want := describe(doc.Result()), describe(New(text).ParseWithRecovery()); got != want {
+			t.Fatalf("after edit %d %+v of\n%s\nResult():\n%s\nwant\n%s", k, e, text, got, want)
+		}
+		if len(text) > 4*len(documentSource) {
+			doc, text = NewDocument(documentSource), documentSource
+		}
+	}
+}
+
+func TestDocument_ReusesUntouchedEntities(t *testing.T) {
+	doc := NewDocument(documentSource)
+	before := doc.Result().Entities
+
+	start := strings.Index(documentSource, `"gpt-4o"`)
+	if err := doc.Apply(Edit{Start: start, End: start + len(`"gpt-4o"`), Text: "\"gpt-4o-mini\"\n  temperature: 0.2"}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	after := doc.Result().Entities
+	if len(after) != len(before) {
+		t.Fatalf("expected %d entities, got %d", len(before), len(after))
+	}
+	if after[0] == before[0] {
+		t.Error("expected the edited agent to be reparsed")
+	}
+	for k := 1; k < len(after); k++ {
+		if after[k] != before[k] {
+			t.Errorf("expected %s %q to be reused", after[k].Type(), after[k].Name())
+		}
+	}
+	// The reused pipeline and its steps moved down a line
+	pipeline := after[1].(*ast.PipelineEntity)
+	if pipeline.Line() != 13 || pipeline.Steps[0].Line() != 14 {
+		t.Errorf("expected the pipeline at line 13 and its first step at 14, got %d and %d", pipeline.Line(), pipeline.Steps[0].Line())
+	}
+}
+
+func TestDocument_ApplyOutOfRange(t *testing.T) {
+	doc := NewDocument("agent \"a\" {}")
+	for _, e := range []Edit{{Start: -1, End: 0}, {Start: 3, End: 2}, {Start: 0, End: 100}} {
+		if err := doc.Apply(e); err == nil {
+			t.Errorf("expected an error for %+v", e)
+		}
+	}
+	if doc.Text() != "agent \"a\" {}" {
+		t.Errorf("expected the text to be unchanged, got %q", doc.Text())
+	}
+}
+
+func TestDocument_Declaration(t *testing.T) {
+	text := "agent \"a\" {}\n\n# The reviewer.\nagent \"b\" {\n  model: \"gpt-4o\"\n}\n\ntool \"c\" {}\n"
+	doc := NewDocument(text)
+	start, end, ok := doc.Declaration("agent", "b")
+	if !ok {
+		t.Fatal("expected agent b to be found")
+	}
+	if got := text[start:end]; got != "# The reviewer.\nagent \"b\" {\n  model: \"gpt-4o\"\n}\n\n" {
+		t.Errorf("Declaration() = %q", got)
+	}
+	if err := doc.Apply(Edit{Start: start, End: end}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "agent \"a\" {}\n\ntool \"c\" {}\n"; doc.Text() != want {
+		t.Errorf("text = %q, want %q", doc.Text(), want)
+	}
+	if _, _, ok := doc.Declaration("tool", "b"); ok {
+		t.Error("expected no tool b")
+	}
+}
+
+func BenchmarkDocument_Apply(b *testing.B) {
+	var src strings.Builder
+	for k := 0; k < 2000; k++ {
+		fmt.Fprintf(&src, "agent \"agent-%d\" {\n  model: \"gpt-4o\"\n  instruction: \"Help.\"\n}\n\n", k)
+	}
+	text := src.String()
+	at := strings.Index(text, `"Help."`)
+
+	b.Run("incremental", func(b *testing.B) {
+		doc := NewDocument(text)
+		for i := 0; i < b.N; i++ {
+			_ = doc.Apply(Edit{Start: at, End: at, Text: "x"})
+			_ = doc.Apply(Edit{Start: at, End: at + 1})
+		}
+	})
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			New(text[:at] + "x" + text[at:]).ParseWithRecovery()
+			New(text).ParseWithRecovery()
+		}
+	})
+}
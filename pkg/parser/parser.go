@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/tokenizer"
 )
 
@@ -17,12 +19,49 @@ import (
 type ParseError struct {
 	Line    int    // Line number where the error occurred
 	Column  int    // Column number where the error occurred
-	Message string // Error message
+	Message string // Error message, in English
+
+	// Code and Args identify the message in the i18n catalog, if it is
+	// cataloged
+	Code i18n.Code
+	Args []interface{}
+}
+
+// newParseError returns a parse error with a cataloged message.
+func newParseError(line, col int, code i18n.Code, args ...interface{}) *ParseError {
+	return &ParseError{
+		Line:    line,
+		Column:  col,
+		Message: i18n.New(code, args...).Error(),
+		Code:    code,
+		Args:    args,
+	}
 }
 
 // Error implements the error interface
 func (e ParseError) Error() string {
-	return fmt.Sprintf("at line %d, col %d: %s", e.Line, e.Column, e.Message)
+	return i18n.Translate(i18n.English, i18n.AtPosition, e.Line, e.Column, e.Message)
+}
+
+// Localize returns the error in the language of tag. Messages that are not
+// cataloged stay in English.
+func (e ParseError) Localize(tag string) string {
+	return i18n.Translate(tag, i18n.AtPosition, e.Line, e.Column, e.LocalizeMessage(tag))
+}
+
+// LocalizeMessage returns the message alone, without the position, in the
+// language of tag.
+func (e ParseError) LocalizeMessage(tag string) string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return i18n.Translate(tag, e.Code, e.Args...)
+}
+
+// MessageCode returns the catalog code of the error, or "" if its message
+// is not cataloged.
+func (e ParseError) MessageCode() i18n.Code {
+	return e.Code
 }
 
 // ParseResult contains the result of parsing, including any recovered errors
@@ -30,6 +69,10 @@ type ParseResult struct {
 	Entities []ast.Entity // Successfully parsed entities
 	Imports  []ast.Import // Discovered import directives
 	Errors   []ParseError // Errors encountered during parsing
+
+	// Comments are every comment of the input, in order, when parsing with
+	// WithSourceFidelity
+	Comments []ast.Comment
 }
 
 // HasErrors returns true if there were any parsing errors
@@ -56,6 +99,22 @@ type Parser struct {
 	tokens        []tokenizer.Token
 	pos           int
 	errorRecovery bool
+
+	// seen is the index of the furthest token looked at, which may be past
+	// the end
+	seen int
+
+	// comments are the comment tokens; deprecations the reasons of the
+	// deprecated directives among them, and docs the doc comments, by
+	// target line, once looked up
+	comments     []tokenizer.Token
+	deprecations map[int]string
+	docs         map[int]string
+
+	// fidelity is true if entities record where they were written; attached
+	// are the offsets of the comments attached to them so far
+	fidelity bool
+	attached map[int]bool
 }
 
 // Option is a functional option for configuring the Parser
@@ -91,6 +150,7 @@ func (p *Parser) WithErrorRecovery() *Parser {
 
 // current returns the current token
 func (p *Parser) current() tokenizer.Token {
+	p.seen = max(p.seen, p.pos)
 	if p.pos >= len(p.tokens) {
 		return tokenizer.Token{Type: -1, Value: "", Line: 0, Column: 0}
 	}
@@ -100,6 +160,7 @@ func (p *Parser) current() tokenizer.Token {
 // peek returns a token at offset from current position
 func (p *Parser) peek(offset int) tokenizer.Token {
 	pos := p.pos + offset
+	p.seen = max(p.seen, pos)
 	if pos >= len(p.tokens) || pos < 0 {
 		return tokenizer.Token{Type: -1, Value: "", Line: 0, Column: 0}
 	}
@@ -115,11 +176,7 @@ func (p *Parser) advance() {
 func (p *Parser) expect(t tokenizer.TokenType) (tokenizer.Token, *ParseError) {
 	tok := p.current()
 	if tok.Type != t {
-		return tok, &ParseError{
-			Line:    tok.Line,
-			Column:  tok.Column,
-			Message: fmt.Sprintf("expected %s, got %s", t, tok.Type),
-		}
+		return tok, newParseError(tok.Line, tok.Column, i18n.ExpectedToken, t, tok.Type)
 	}
 	p.advance()
 	return tok, nil
@@ -133,24 +190,12 @@ func (p *Parser) ParseWithRecovery() ParseResult {
 		Errors:   make([]ParseError, 0),
 	}
 
-	allTokens := p.tokenizer.Tokenize(p.input)
-	if len(allTokens) == 0 {
-		return result
-	}
-
-	// Filter out comment tokens
-	p.tokens = make([]tokenizer.Token, 0, len(allTokens))
-	for _, t := range allTokens {
-		if t.Type != tokenizer.TokenTypeComment {
-			p.tokens = append(p.tokens, t)
+	p.tokenize()
+	if p.fidelity {
+		for _, c := range p.comments {
+			result.Comments = append(result.Comments, comment(c))
 		}
 	}
-
-	if len(p.tokens) == 0 {
-		return result
-	}
-
-	p.pos = 0
 	for p.pos < len(p.tokens) {
 		entity, imp, err := p.parseTopLevel()
 		if err != nil {
@@ -169,6 +214,24 @@ func (p *Parser) ParseWithRecovery() ParseResult {
 	return result
 }
 
+// tokenize splits the input into tokens, setting comments aside, and
+// rewinds.
+func (p *Parser) tokenize() {
+	allTokens := p.tokenizer.Tokenize(p.input)
+	p.tokens = make([]tokenizer.Token, 0, len(allTokens))
+	p.comments, p.deprecations, p.docs = nil, nil, nil
+	p.attached = make(map[int]bool)
+	for _, t := range allTokens {
+		if t.Type == tokenizer.TokenTypeComment {
+			p.comments = append(p.comments, t)
+		} else {
+			p.tokens = append(p.tokens, t)
+		}
+	}
+	p.pos = 0
+	p.seen = 0
+}
+
 // skipToRecoveryPoint advances past errors
 func (p *Parser) skipToRecoveryPoint() {
 	for p.pos < len(p.tokens) {
@@ -186,11 +249,7 @@ func (p *Parser) skipToRecoveryPoint() {
 func (p *Parser) parseTopLevel() (ast.Entity, *ast.Import, *ParseError) {
 	tok := p.current()
 	if tok.Type != tokenizer.TokenTypeIdentifier {
-		return nil, nil, &ParseError{
-			Line:    tok.Line,
-			Column:  tok.Column,
-			Message: fmt.Sprintf("expected identifier at top level, got %s", tok.Type),
-		}
+		return nil, nil, newParseError(tok.Line, tok.Column, i18n.ExpectedTopLevel, tok.Type)
 	}
 
 	// Check if this is an import
@@ -200,11 +259,23 @@ func (p *Parser) parseTopLevel() (ast.Entity, *ast.Import, *ParseError) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return nil, &ast.Import{
+		imp := &ast.Import{
 			Path:   pathTok.Value,
 			Line:   tok.Line,
 			Column: tok.Column,
-		}, nil
+		}
+
+		// Optional namespace: import "lib/agents.ls" as agents
+		if p.current().Type == tokenizer.TokenTypeIdentifier && p.current().Value == "as" {
+			p.advance()
+			aliasTok, err := p.expect(tokenizer.TokenTypeIdentifier)
+			if err != nil {
+				return nil, nil, err
+			}
+			imp.Alias = aliasTok.Value
+		}
+
+		return nil, imp, nil
 	}
 
 	entityType := tok.Value
@@ -228,11 +299,7 @@ func (p *Parser) parseTopLevel() (ast.Entity, *ast.Import, *ParseError) {
 	case tokenizer.TokenTypeIdentifier:
 		// stay on this token for now
 	default:
-		return nil, nil, &ParseError{
-			Line:    nameTok.Line,
-			Column:  nameTok.Column,
-			Message: "expected entity name",
-		}
+		return nil, nil, newParseError(nameTok.Line, nameTok.Column, i18n.ExpectedEntityName)
 	}
 
 	// Check for block syntax vs legacy
@@ -251,9 +318,11 @@ func (p *Parser) parseTopLevel() (ast.Entity, *ast.Import, *ParseError) {
 func (p *Parser) parseBlockEntity(entityType, name string, line, col int) (ast.Entity, *ParseError) {
 	entity, err := ast.NewEntity(entityType, name)
 	if err != nil {
-		return nil, &ParseError{Line: line, Column: col, Message: err.Error()}
+		return nil, newParseError(line, col, i18n.UnknownEntityType, entityType)
 	}
 	entity.SetLocation(line, col)
+	p.annotate(entity)
+	start := p.beginSource(entity)
 
 	// Expect opening brace
 	if _, err := p.expect(tokenizer.TokenTypeLeftBrace); err != nil {
@@ -263,22 +332,21 @@ func (p *Parser) parseBlockEntity(entityType, name string, line, col int) (ast.E
 	// Parse properties until closing brace
 	for p.current().Type != tokenizer.TokenTypeRightBrace {
 		if p.pos >= len(p.tokens) {
-			return nil, &ParseError{
-				Line:    line,
-				Column:  col,
-				Message: "unclosed block",
-			}
+			return nil, newParseError(line, col, i18n.UnclosedBlock)
 		}
 
+		propStart := p.pos
 		if err := p.parseProperty(entity); err != nil {
 			return nil, err
 		}
+		p.recordProperty(entity, propStart)
 	}
 
 	// Expect closing brace
 	if _, err := p.expect(tokenizer.TokenTypeRightBrace); err != nil {
 		return nil, err
 	}
+	p.endSource(entity, start)
 
 	return entity, nil
 }
@@ -286,15 +354,11 @@ func (p *Parser) parseBlockEntity(entityType, name string, line, col int) (ast.E
 // parseProperty parses a property assignment: key: value
 // This also handles typed parameters: key: type required/optional [default] ["description"]
 // And nested entity blocks: step "name" { ... }
-// And control flow: branch expr { ... }, loop max: N { ... }
+// And control flow: branch expr { ... }, loop max: N { ... }, retry { ... }
 func (p *Parser) parseProperty(entity ast.Entity) *ParseError {
 	keyTok := p.current()
 	if keyTok.Type != tokenizer.TokenTypeIdentifier {
-		return &ParseError{
-			Line:    keyTok.Line,
-			Column:  keyTok.Column,
-			Message: fmt.Sprintf("expected property name, got %s", keyTok.Type),
-		}
+		return newParseError(keyTok.Line, keyTok.Column, i18n.ExpectedPropertyName, keyTok.Type)
 	}
 	key := keyTok.Value
 	p.advance()
@@ -319,9 +383,62 @@ func (p *Parser) parseProperty(entity ast.Entity) *ParseError {
 		return nil
 	}
 
+	// Check for retry policy: retry { max: 3 backoff: "exponential" }
+	if key == "retry" && p.current().Type == tokenizer.TokenTypeLeftBrace {
+		retryValue, err := p.parseRetry(keyTok.Line, keyTok.Column)
+		if err != nil {
+			return err
+		}
+		entity.SetProperty(key, retryValue)
+		return nil
+	}
+
+	// Check for model fallbacks: fallback { models: ["gpt-4o"] on: ["rate_limit"] }
+	if key == "fallback" && p.current().Type == tokenizer.TokenTypeLeftBrace {
+		fallbackValue, err := p.parseFallback(keyTok.Line, keyTok.Column)
+		if err != nil {
+			return err
+		}
+		entity.SetProperty(key, fallbackValue)
+		return nil
+	}
+
+	// Check for matrix execution: matrix { model: ["gpt-4o", "claude-sonnet"] }
+	if key == "matrix" && p.current().Type == tokenizer.TokenTypeLeftBrace {
+		matrixValue, err := p.parseMatrix(keyTok.Line, keyTok.Column)
+		if err != nil {
+			return err
+		}
+		entity.SetProperty(key, matrixValue)
+		return nil
+	}
+
 	// Check for nested entity block: step "name" { or parallel { etc
 	// Only specific keywords trigger nested entity parsing
 	nextTok := p.current()
+
+	// Profiles hold overlays of other entities: agent "name" { ... } or config { ... }
+	if profile, ok := entity.(*ast.ProfileEntity); ok && p.isOverlayType(key) &&
+		(nextTok.Type == tokenizer.TokenTypeString || nextTok.Type == tokenizer.TokenTypeLeftBrace) {
+		nestedValue, err := p.parseNestedEntity(key, keyTok.Line, keyTok.Column)
+		if err != nil {
+			return err
+		}
+		profile.Overlays = append(profile.Overlays, nestedValue.Entity)
+		return nil
+	}
+
+	// Evals hold test cases: case "name" { input: ... expect: { ... } }
+	if eval, ok := entity.(*ast.EvalEntity); ok && key == "case" &&
+		(nextTok.Type == tokenizer.TokenTypeString || nextTok.Type == tokenizer.TokenTypeLeftBrace) {
+		nestedValue, err := p.parseNestedEntity(key, keyTok.Line, keyTok.Column)
+		if err != nil {
+			return err
+		}
+		eval.Cases = append(eval.Cases, nestedValue.Entity.(*ast.CaseEntity))
+		return nil
+	}
+
 	if p.isNestedEntityKeyword(key) && (nextTok.Type == tokenizer.TokenTypeString || nextTok.Type == tokenizer.TokenTypeLeftBrace) {
 		// This is a nested entity block (like step "analyze" { ... } or parallel { ... })
 		nestedValue, err := p.parseNestedEntity(key, keyTok.Line, keyTok.Column)
@@ -354,15 +471,55 @@ func (p *Parser) parseProperty(entity ast.Entity) *ParseError {
 	}
 
 	// Parse value
+	valueTok := p.current()
 	value, err := p.parseValue()
 	if err != nil {
 		return err
 	}
 
+	// Tags and access control are also kept as metadata, for selecting
+	// entities by tag and enforcing ownership
+	switch key {
+	case "tags", "owners":
+		names, ok := nameList(value)
+		if !ok {
+			return newParseError(valueTok.Line, valueTok.Column, i18n.ExpectedToken, "a list of "+key+" without commas", valueTok.Value)
+		}
+		if key == "tags" {
+			ast.SetTags(entity, names...)
+		} else {
+			ast.SetOwners(entity, names...)
+		}
+	case "visibility":
+		v, ok := value.(ast.StringValue)
+		if !ok || (v.Value != ast.VisibilityPublic && v.Value != ast.VisibilityPrivate) {
+			return newParseError(valueTok.Line, valueTok.Column, i18n.ExpectedToken, `"public" or "private"`, valueTok.Value)
+		}
+		entity.SetMetadata(ast.VisibilityMetadataKey, v.Value)
+	}
+
 	entity.SetProperty(key, value)
 	return nil
 }
 
+// nameList returns the names of a `tags` or `owners` property, and whether
+// it is a list of strings that can be names.
+func nameList(value ast.Value) ([]string, bool) {
+	arr, ok := value.(ast.ArrayValue)
+	if !ok {
+		return nil, false
+	}
+	tags := make([]string, 0, len(arr.Elements))
+	for _, elem := range arr.Elements {
+		tag, ok := elem.(ast.StringValue)
+		if !ok || tag.Value == "" || strings.Contains(tag.Value, ",") {
+			return nil, false
+		}
+		tags = append(tags, tag.Value)
+	}
+	return tags, true
+}
+
 // isNestedEntityKeyword checks if an identifier is a keyword that can start a nested entity block
 func (p *Parser) isNestedEntityKeyword(name string) bool {
 	switch name {
@@ -372,9 +529,80 @@ func (p *Parser) isNestedEntityKeyword(name string) bool {
 	return false
 }
 
-// parseValue parses a value with optional comparison operators
+// isOverlayType checks if an identifier is an entity type a profile can overlay
+func (p *Parser) isOverlayType(name string) bool {
+	switch name {
+	case "config", "agent", "tool", "intent", "pipeline", "trigger", "mcp", "provider", "script", "prompt":
+		return true
+	}
+	return false
+}
+
+// parseValue parses a value, which may be an expression. Operators bind,
+// from loosest to tightest: ??, ||, &&, comparisons, + and -, * / and %,
+// and unary !. Parentheses group subexpressions.
 func (p *Parser) parseValue() (ast.Value, *ParseError) {
-	left, err := p.parsePrimaryValue()
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for the default operator: left ?? right (right-associative)
+	if p.current().Type != tokenizer.TokenTypeDoubleQuestion {
+		return left, nil
+	}
+	p.advance()
+
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.CoalesceValue{Left: left, Right: right}, nil
+}
+
+// parseOr parses operands joined with ||
+func (p *Parser) parseOr() (ast.Value, *ParseError) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.current().Type == tokenizer.TokenTypeOr {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ast.LogicalValue{Left: left, Operator: "||", Right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses operands joined with &&
+func (p *Parser) parseAnd() (ast.Value, *ParseError) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.current().Type == tokenizer.TokenTypeAnd {
+		p.advance()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = ast.LogicalValue{Left: left, Operator: "&&", Right: right}
+	}
+
+	return left, nil
+}
+
+// parseComparison parses an arithmetic operand, optionally compared with
+// another
+func (p *Parser) parseComparison() (ast.Value, *ParseError) {
+	left, err := p.parseAdditive()
 	if err != nil {
 		return nil, err
 	}
@@ -402,7 +630,7 @@ func (p *Parser) parseValue() (ast.Value, *ParseError) {
 	// We have a comparison operator
 	p.advance()
 
-	right, err := p.parsePrimaryValue()
+	right, err := p.parseAdditive()
 	if err != nil {
 		return nil, err
 	}
@@ -414,6 +642,77 @@ func (p *Parser) parseValue() (ast.Value, *ParseError) {
 	}, nil
 }
 
+// parseAdditive parses operands joined with + and -, left to right
+func (p *Parser) parseAdditive() (ast.Value, *ParseError) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var operator string
+		switch p.current().Type {
+		case tokenizer.TokenTypePlus:
+			operator = "+"
+		case tokenizer.TokenTypeMinus:
+			operator = "-"
+		default:
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = ast.ArithmeticValue{Left: left, Operator: operator, Right: right}
+	}
+}
+
+// parseMultiplicative parses operands joined with *, / and %, left to right
+func (p *Parser) parseMultiplicative() (ast.Value, *ParseError) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var operator string
+		switch p.current().Type {
+		case tokenizer.TokenTypeStar:
+			operator = "*"
+		case tokenizer.TokenTypeSlash:
+			operator = "/"
+		case tokenizer.TokenTypePercent:
+			operator = "%"
+		default:
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = ast.ArithmeticValue{Left: left, Operator: operator, Right: right}
+	}
+}
+
+// parseUnary parses a primary value, optionally negated with !
+func (p *Parser) parseUnary() (ast.Value, *ParseError) {
+	if p.current().Type != tokenizer.TokenTypeNot {
+		return p.parsePrimaryValue()
+	}
+	p.advance()
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NotValue{Operand: operand}, nil
+}
+
 // parsePrimaryValue parses a primary value (string, number, bool, array, object, reference)
 func (p *Parser) parsePrimaryValue() (ast.Value, *ParseError) {
 	tok := p.current()
@@ -456,23 +755,21 @@ func (p *Parser) parsePrimaryValue() (ast.Value, *ParseError) {
 		p.advance()
 
 		// Check for property access: $name.property.subproperty
-		if p.current().Type == tokenizer.TokenTypeDot {
+		if p.isAccess() {
 			path := make([]string, 0)
-			for p.current().Type == tokenizer.TokenTypeDot {
+			var optional []bool
+			for p.isAccess() {
+				optional = append(optional, p.current().Type == tokenizer.TokenTypeQuestionDot)
 				p.advance() // consume dot
 				propTok := p.current()
 				if propTok.Type != tokenizer.TokenTypeIdentifier {
-					return nil, &ParseError{
-						Line:    propTok.Line,
-						Column:  propTok.Column,
-						Message: "expected property name after .",
-					}
+					return nil, newParseError(propTok.Line, propTok.Column, i18n.ExpectedMemberName)
 				}
 				path = append(path, propTok.Value)
 				p.advance()
 			}
 			// Return as PropertyAccessValue with $ prefix to indicate variable
-			return ast.PropertyAccessValue{Base: "$" + varName, Path: path}, nil
+			return ast.PropertyAccessValue{Base: "$" + varName, Path: path, Optional: optionalFlags(optional)}, nil
 		}
 
 		return ast.VariableValue{Name: varName}, nil
@@ -510,9 +807,13 @@ func (p *Parser) parsePrimaryValue() (ast.Value, *ParseError) {
 			return p.parseTypedBlock()
 		}
 		// Check for property access chain: identifier.property.property
-		if nextTok.Type == tokenizer.TokenTypeDot {
+		if nextTok.Type == tokenizer.TokenTypeDot || nextTok.Type == tokenizer.TokenTypeQuestionDot {
 			return p.parsePropertyAccess()
 		}
+		if tok.Value == "null" {
+			p.advance()
+			return ast.NullValue{}, nil
+		}
 		// Simple identifier as value (e.g., tool names in array)
 		p.advance()
 		return ast.StringValue{Value: tok.Value}, nil
@@ -523,12 +824,20 @@ func (p *Parser) parsePrimaryValue() (ast.Value, *ParseError) {
 	case tokenizer.TokenTypeLeftBrace:
 		return p.parseObject()
 
-	default:
-		return nil, &ParseError{
-			Line:    tok.Line,
-			Column:  tok.Column,
-			Message: fmt.Sprintf("unexpected token in value: %s", tok.Type),
+	case tokenizer.TokenTypeLeftParen:
+		// Parenthesized expression: (a + b) * c
+		p.advance()
+		inner, err := p.parseValue()
+		if err != nil {
+			return nil, err
 		}
+		if _, err := p.expect(tokenizer.TokenTypeRightParen); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	default:
+		return nil, newParseError(tok.Line, tok.Column, i18n.UnexpectedValue, tok.Type)
 	}
 }
 
@@ -566,16 +875,14 @@ func (p *Parser) parseFunctionCall() (ast.Value, *ParseError) {
 		Arguments: args,
 	}
 
-	// Check for property access after function call: func().property
-	if p.current().Type == tokenizer.TokenTypeDot {
+	// Check for property access after function call: func().property or
+	// func()?.property
+	if p.isAccess() {
+		optional := p.current().Type == tokenizer.TokenTypeQuestionDot
 		p.advance() // consume dot
 		propTok := p.current()
 		if propTok.Type != tokenizer.TokenTypeIdentifier {
-			return nil, &ParseError{
-				Line:    propTok.Line,
-				Column:  propTok.Column,
-				Message: "expected property name after .",
-			}
+			return nil, newParseError(propTok.Line, propTok.Column, i18n.ExpectedMemberName)
 		}
 		propName := propTok.Value
 		p.advance()
@@ -598,6 +905,7 @@ func (p *Parser) parseFunctionCall() (ast.Value, *ParseError) {
 			Object:    result,
 			Method:    propName,
 			Arguments: []ast.Value{},
+			Optional:  optional,
 		}, nil
 	}
 
@@ -777,15 +1085,13 @@ func (p *Parser) parsePropertyAccess() (ast.Value, *ParseError) {
 	result = ast.StringValue{Value: base}
 
 	// Parse the property/method chain
-	for p.current().Type == tokenizer.TokenTypeDot {
+	var flags []bool
+	for p.isAccess() {
+		optional := p.current().Type == tokenizer.TokenTypeQuestionDot
 		p.advance() // consume dot
 		propTok := p.current()
 		if propTok.Type != tokenizer.TokenTypeIdentifier {
-			return nil, &ParseError{
-				Line:    propTok.Line,
-				Column:  propTok.Column,
-				Message: "expected property name after .",
-			}
+			return nil, newParseError(propTok.Line, propTok.Column, i18n.ExpectedMemberName)
 		}
 		propName := propTok.Value
 		p.advance()
@@ -817,9 +1123,11 @@ func (p *Parser) parsePropertyAccess() (ast.Value, *ParseError) {
 			// Property access
 			if pa, ok := result.(ast.PropertyAccessValue); ok {
 				pa.Path = append(pa.Path, propName)
+				flags = append(flags, optional)
 				result = pa
 			} else if sv, ok := result.(ast.StringValue); ok && sv.Value == base {
 				result = ast.PropertyAccessValue{Base: base, Path: []string{propName}}
+				flags = []bool{optional}
 			} else {
 				// Chained property access after method call or other value
 				result = ast.MethodCallValue{
@@ -831,6 +1139,11 @@ func (p *Parser) parsePropertyAccess() (ast.Value, *ParseError) {
 		}
 	}
 
+	if pa, ok := result.(ast.PropertyAccessValue); ok {
+		pa.Optional = optionalFlags(flags)
+		result = pa
+	}
+
 	// Check for inline block after property access: github.pull_request { ... }
 	if p.current().Type == tokenizer.TokenTypeLeftBrace {
 		var typeName string
@@ -882,11 +1195,7 @@ func (p *Parser) parseArgumentList() ([]ast.Value, *ParseError) {
 
 	for p.current().Type != tokenizer.TokenTypeRightParen {
 		if p.pos >= len(p.tokens) {
-			return nil, &ParseError{
-				Line:    0,
-				Column:  0,
-				Message: "unclosed argument list",
-			}
+			return nil, newParseError(0, 0, i18n.UnclosedArguments)
 		}
 
 		arg, err := p.parseValue()
@@ -925,6 +1234,8 @@ func (p *Parser) parseNestedEntity(entityType string, line, col int) (ast.Nested
 		entity = ast.NewBaseEntity(entityType, name)
 	}
 	entity.SetLocation(line, col)
+	p.annotate(entity)
+	start := p.beginSource(entity)
 
 	// Expect opening brace
 	if _, astErr := p.expect(tokenizer.TokenTypeLeftBrace); astErr != nil {
@@ -934,22 +1245,21 @@ func (p *Parser) parseNestedEntity(entityType string, line, col int) (ast.Nested
 	// Parse properties until closing brace
 	for p.current().Type != tokenizer.TokenTypeRightBrace {
 		if p.pos >= len(p.tokens) {
-			return ast.NestedEntityValue{}, &ParseError{
-				Line:    line,
-				Column:  col,
-				Message: "unclosed nested block",
-			}
+			return ast.NestedEntityValue{}, newParseError(line, col, i18n.UnclosedNestedBlock)
 		}
 
+		propStart := p.pos
 		if propErr := p.parseProperty(entity); propErr != nil {
 			return ast.NestedEntityValue{}, propErr
 		}
+		p.recordProperty(entity, propStart)
 	}
 
 	// Expect closing brace
 	if _, astErr := p.expect(tokenizer.TokenTypeRightBrace); astErr != nil {
 		return ast.NestedEntityValue{}, astErr
 	}
+	p.endSource(entity, start)
 
 	return ast.NestedEntityValue{Entity: entity}, nil
 }
@@ -1130,6 +1440,305 @@ func (p *Parser) parseLoop(line, col int) (ast.Value, *ParseError) {
 	}, nil
 }
 
+// parseRetry parses a retry policy: retry { max: 3 backoff: "exponential" delay: "1s" on: ["timeout"] }
+func (p *Parser) parseRetry(line, col int) (ast.Value, *ParseError) {
+	if _, err := p.expect(tokenizer.TokenTypeLeftBrace); err != nil {
+		return nil, err
+	}
+
+	retry := ast.RetryValue{
+		MaxAttempts: 3,
+		Backoff:     "exponential",
+	}
+
+	for p.current().Type != tokenizer.TokenTypeRightBrace {
+		if p.pos >= len(p.tokens) {
+			return nil, &ParseError{
+				Line:    line,
+				Column:  col,
+				Message: "unclosed retry block",
+			}
+		}
+
+		keyTok := p.current()
+		if keyTok.Type != tokenizer.TokenTypeIdentifier {
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("expected retry option, got %s", keyTok.Type),
+			}
+		}
+		p.advance()
+		if _, err := p.expect(tokenizer.TokenTypeColon); err != nil {
+			return nil, err
+		}
+
+		valTok := p.current()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		switch keyTok.Value {
+		case "max":
+			nv, ok := value.(ast.NumberValue)
+			if !ok || nv.Value < 0 {
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: "retry max must be a non-negative number",
+				}
+			}
+			retry.MaxAttempts = int(nv.Value)
+		case "backoff":
+			sv, ok := value.(ast.StringValue)
+			if !ok {
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: "retry backoff must be a string",
+				}
+			}
+			switch sv.Value {
+			case "constant", "linear", "exponential":
+			default:
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: fmt.Sprintf("unknown retry backoff %q (expected constant, linear, or exponential)", sv.Value),
+				}
+			}
+			retry.Backoff = sv.Value
+		case "delay":
+			sv, ok := value.(ast.StringValue)
+			if !ok {
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: "retry delay must be a duration string",
+				}
+			}
+			if d, err := time.ParseDuration(sv.Value); err != nil || d <= 0 {
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: fmt.Sprintf("invalid retry delay %q (expected a positive duration such as \"500ms\" or \"2s\")", sv.Value),
+				}
+			}
+			retry.Delay = sv.Value
+		case "on":
+			on, err := stringList(value, valTok, "retry on")
+			if err != nil {
+				return nil, err
+			}
+			retry.On = on
+		default:
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("unknown retry option %q", keyTok.Value),
+			}
+		}
+
+		// Allow optional comma separators
+		if p.current().Type == tokenizer.TokenTypeComma {
+			p.advance()
+		}
+	}
+
+	if _, err := p.expect(tokenizer.TokenTypeRightBrace); err != nil {
+		return nil, err
+	}
+
+	return retry, nil
+}
+
+// parseFallback parses a fallback block like
+// fallback { models: ["gpt-4o", "gemini-1.5-pro"] on: ["rate_limit"] }
+func (p *Parser) parseFallback(line, col int) (ast.Value, *ParseError) {
+	if _, err := p.expect(tokenizer.TokenTypeLeftBrace); err != nil {
+		return nil, err
+	}
+
+	var fallback ast.FallbackValue
+	for p.current().Type != tokenizer.TokenTypeRightBrace {
+		if p.pos >= len(p.tokens) {
+			return nil, &ParseError{
+				Line:    line,
+				Column:  col,
+				Message: "unclosed fallback block",
+			}
+		}
+
+		keyTok := p.current()
+		if keyTok.Type != tokenizer.TokenTypeIdentifier {
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("expected fallback option, got %s", keyTok.Type),
+			}
+		}
+		p.advance()
+		if _, err := p.expect(tokenizer.TokenTypeColon); err != nil {
+			return nil, err
+		}
+
+		valTok := p.current()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		switch keyTok.Value {
+		case "models":
+			if fallback.Models, err = stringList(value, valTok, "fallback models"); err != nil {
+				return nil, err
+			}
+		case "on":
+			if fallback.On, err = stringList(value, valTok, "fallback on"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("unknown fallback option %q", keyTok.Value),
+			}
+		}
+
+		// Allow optional comma separators
+		if p.current().Type == tokenizer.TokenTypeComma {
+			p.advance()
+		}
+	}
+
+	if _, err := p.expect(tokenizer.TokenTypeRightBrace); err != nil {
+		return nil, err
+	}
+
+	if len(fallback.Models) == 0 {
+		return nil, &ParseError{
+			Line:    line,
+			Column:  col,
+			Message: "fallback block needs models",
+		}
+	}
+	return fallback, nil
+}
+
+// parseMatrix parses a matrix block: each dimension is a setting and the
+// list of literal values it takes.
+func (p *Parser) parseMatrix(line, col int) (ast.Value, *ParseError) {
+	if _, err := p.expect(tokenizer.TokenTypeLeftBrace); err != nil {
+		return nil, err
+	}
+
+	var matrix ast.MatrixValue
+	seen := make(map[string]bool)
+	for p.current().Type != tokenizer.TokenTypeRightBrace {
+		if p.pos >= len(p.tokens) {
+			return nil, &ParseError{
+				Line:    line,
+				Column:  col,
+				Message: "unclosed matrix block",
+			}
+		}
+
+		keyTok := p.current()
+		if keyTok.Type != tokenizer.TokenTypeIdentifier {
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("expected matrix dimension, got %s", keyTok.Type),
+			}
+		}
+		if seen[keyTok.Value] {
+			return nil, &ParseError{
+				Line:    keyTok.Line,
+				Column:  keyTok.Column,
+				Message: fmt.Sprintf("duplicate matrix dimension %q", keyTok.Value),
+			}
+		}
+		seen[keyTok.Value] = true
+		p.advance()
+		if _, err := p.expect(tokenizer.TokenTypeColon); err != nil {
+			return nil, err
+		}
+
+		valTok := p.current()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := value.(ast.ArrayValue)
+		if !ok || len(arr.Elements) == 0 {
+			return nil, &ParseError{
+				Line:    valTok.Line,
+				Column:  valTok.Column,
+				Message: fmt.Sprintf("matrix dimension %q must be a non-empty array", keyTok.Value),
+			}
+		}
+		for _, elem := range arr.Elements {
+			switch elem.(type) {
+			case ast.StringValue, ast.NumberValue, ast.BoolValue:
+			default:
+				return nil, &ParseError{
+					Line:    valTok.Line,
+					Column:  valTok.Column,
+					Message: fmt.Sprintf("matrix dimension %q must contain only strings, numbers, and booleans", keyTok.Value),
+				}
+			}
+		}
+		matrix.Dimensions = append(matrix.Dimensions, ast.MatrixDimension{Name: keyTok.Value, Values: arr.Elements})
+
+		// Allow optional comma separators
+		if p.current().Type == tokenizer.TokenTypeComma {
+			p.advance()
+		}
+	}
+
+	if _, err := p.expect(tokenizer.TokenTypeRightBrace); err != nil {
+		return nil, err
+	}
+
+	if len(matrix.Dimensions) == 0 {
+		return nil, &ParseError{
+			Line:    line,
+			Column:  col,
+			Message: "matrix block needs dimensions",
+		}
+	}
+	return matrix, nil
+}
+
+// stringList returns the strings of a block option that takes a string or
+// an array of strings, such as the error classes of `on`.
+func stringList(value ast.Value, tok tokenizer.Token, option string) ([]string, *ParseError) {
+	switch v := value.(type) {
+	case ast.StringValue:
+		return []string{v.Value}, nil
+	case ast.ArrayValue:
+		var list []string
+		for _, elem := range v.Elements {
+			sv, ok := elem.(ast.StringValue)
+			if !ok {
+				return nil, &ParseError{
+					Line:    tok.Line,
+					Column:  tok.Column,
+					Message: option + " must contain only strings",
+				}
+			}
+			list = append(list, sv.Value)
+		}
+		return list, nil
+	}
+	return nil, &ParseError{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: option + " must be a string or array of strings",
+	}
+}
+
 // parseReference parses a reference like agent("name") or step("x").output
 func (p *Parser) parseReference() (ast.Value, *ParseError) {
 	typeTok := p.current()
@@ -1159,20 +1768,32 @@ func (p *Parser) parseReference() (ast.Value, *ParseError) {
 		Path: []string{},
 	}
 
-	// Check for dot access: .output, .files, etc.
-	for p.current().Type == tokenizer.TokenTypeDot {
+	// Check for a version pin: pipeline("name")@v3
+	if p.current().Type == tokenizer.TokenTypeAt {
+		p.advance()
+		versionTok := p.current()
+		switch versionTok.Type {
+		case tokenizer.TokenTypeIdentifier, tokenizer.TokenTypeNumber, tokenizer.TokenTypeString:
+			ref.Version = versionTok.Value
+			p.advance()
+		default:
+			return nil, newParseError(versionTok.Line, versionTok.Column, i18n.ExpectedVersion)
+		}
+	}
+
+	// Check for dot access: .output, .files, etc., or optional ?.output
+	var optional []bool
+	for p.isAccess() {
+		optional = append(optional, p.current().Type == tokenizer.TokenTypeQuestionDot)
 		p.advance()
 		pathTok := p.current()
 		if pathTok.Type != tokenizer.TokenTypeIdentifier {
-			return nil, &ParseError{
-				Line:    pathTok.Line,
-				Column:  pathTok.Column,
-				Message: "expected property name after .",
-			}
+			return nil, newParseError(pathTok.Line, pathTok.Column, i18n.ExpectedMemberName)
 		}
 		ref.Path = append(ref.Path, pathTok.Value)
 		p.advance()
 	}
+	ref.Optional = optionalFlags(optional)
 
 	// Check for inline block: reference("name") { ... }
 	// Only allow inline blocks when there's no path (e.g., pipeline("name") { ... })
@@ -1188,12 +1809,30 @@ func (p *Parser) parseReference() (ast.Value, *ParseError) {
 			Method:     ref.Name,
 			Arguments:  []ast.Value{},
 			InlineBody: nested.Entity,
+			Version:    ref.Version,
 		}, nil
 	}
 
 	return ref, nil
 }
 
+// isAccess reports whether the current token accesses a property: . or ?.
+func (p *Parser) isAccess() bool {
+	t := p.current().Type
+	return t == tokenizer.TokenTypeDot || t == tokenizer.TokenTypeQuestionDot
+}
+
+// optionalFlags returns the optional chaining flags of a property path, or
+// nil if no access is optional.
+func optionalFlags(flags []bool) []bool {
+	for _, f := range flags {
+		if f {
+			return flags
+		}
+	}
+	return nil
+}
+
 // parseArray parses an array: [val1, val2, ...]
 func (p *Parser) parseArray() (ast.Value, *ParseError) {
 	if _, err := p.expect(tokenizer.TokenTypeLeftBracket); err != nil {
@@ -1204,11 +1843,7 @@ func (p *Parser) parseArray() (ast.Value, *ParseError) {
 
 	for p.current().Type != tokenizer.TokenTypeRightBracket {
 		if p.pos >= len(p.tokens) {
-			return nil, &ParseError{
-				Line:    0,
-				Column:  0,
-				Message: "unclosed array",
-			}
+			return nil, newParseError(0, 0, i18n.UnclosedArray)
 		}
 
 		val, err := p.parseValue()
@@ -1241,11 +1876,7 @@ func (p *Parser) parseObject() (ast.Value, *ParseError) {
 
 	for p.current().Type != tokenizer.TokenTypeRightBrace {
 		if p.pos >= len(p.tokens) {
-			return nil, &ParseError{
-				Line:    0,
-				Column:  0,
-				Message: "unclosed object",
-			}
+			return nil, newParseError(0, 0, i18n.UnclosedObject)
 		}
 
 		keyTok := p.current()
@@ -1305,9 +1936,11 @@ func (p *Parser) parseObject() (ast.Value, *ParseError) {
 func (p *Parser) parseLegacyEntity(entityType, name string, line, col int) (ast.Entity, *ParseError) {
 	entity, err := ast.NewEntity(entityType, name)
 	if err != nil {
-		return nil, &ParseError{Line: line, Column: col, Message: err.Error()}
+		return nil, newParseError(line, col, i18n.UnknownEntityType, entityType)
 	}
 	entity.SetLocation(line, col)
+	p.annotate(entity)
+	start := p.beginSource(entity)
 
 	// For legacy syntax, the name becomes a property
 	entity.SetProperty("name", ast.StringValue{Value: name})
@@ -1336,6 +1969,7 @@ func (p *Parser) parseLegacyEntity(entityType, name string, line, col int) (ast.
 	if p.current().Type == tokenizer.TokenTypeSemicolon {
 		p.advance()
 	}
+	p.endSource(entity, start)
 
 	return entity, nil
 }
@@ -1348,3 +1982,65 @@ func (p *Parser) Parse() ([]ast.Entity, []ast.Import, error) {
 	}
 	return result.Entities, result.Imports, nil
 }
+
+// ParseValue parses a single value, such as `"gpt-4o"`, `[1, 2]`, or
+// `step("draft").output ?? $input`, without wrapping it in an entity.
+func ParseValue(s string) (ast.Value, error) {
+	p := New(s)
+	p.tokenize()
+	if len(p.tokens) == 0 {
+		return nil, *newParseError(1, 1, i18n.UnexpectedValue, "end of input")
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, *err
+	}
+	if err := p.expectEnd(); err != nil {
+		return nil, *err
+	}
+	return value, nil
+}
+
+// ParseProperties parses the properties of an entity body, with or without
+// its braces:
+//
+//	model: "gpt-4o"
+//	temperature: 0.2
+//
+// Nested blocks such as `step "name" { ... }` are ast.NestedEntityValue
+// properties, keyed by their keyword.
+func ParseProperties(s string) (map[string]ast.Value, error) {
+	p := New(s)
+	p.tokenize()
+	open := p.current()
+	braced := open.Type == tokenizer.TokenTypeLeftBrace
+	if braced {
+		p.advance()
+	}
+
+	entity := ast.NewBaseEntity("properties", "")
+	for p.pos < len(p.tokens) && !(braced && p.current().Type == tokenizer.TokenTypeRightBrace) {
+		if err := p.parseProperty(entity); err != nil {
+			return nil, *err
+		}
+	}
+	if braced {
+		if p.pos >= len(p.tokens) {
+			return nil, *newParseError(open.Line, open.Column, i18n.UnclosedBlock)
+		}
+		p.advance()
+	}
+	if err := p.expectEnd(); err != nil {
+		return nil, *err
+	}
+	return entity.Properties(), nil
+}
+
+// expectEnd checks that every token has been parsed.
+func (p *Parser) expectEnd() *ParseError {
+	if p.pos < len(p.tokens) {
+		tok := p.current()
+		return newParseError(tok.Line, tok.Column, i18n.UnexpectedValue, tok.Type)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package parser
 
 import (
+	"errors"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 )
 
 // TestParser_Parse_BlockSyntax tests the new block-based syntax
@@ -297,6 +300,12 @@ func TestParser_Parse_Errors(t *testing.T) {
 			wantError:   true,
 			errContains: "unclosed block",
 		},
+		{
+			name:        "missing_version",
+			input:       `trigger "test" { run: pipeline("review")@ }`,
+			wantError:   true,
+			errContains: "expected version after @",
+		},
 		{
 			name:        "unclosed_array",
 			input:       `agent "test" { tools: [a, b }`,
@@ -893,6 +902,82 @@ func TestParser_NestedBlocks(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "step_with_retry_block",
+			input: `pipeline "flaky" {
+				step "call" {
+					use: agent("caller")
+					retry {
+						max: 5
+						backoff: "linear"
+						delay: "500ms"
+						on: ["timeout", "rate_limit"]
+					}
+				}
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				pipeline := e.(*ast.PipelineEntity)
+				if len(pipeline.Steps) != 1 {
+					t.Fatalf("got %d steps, want 1", len(pipeline.Steps))
+				}
+				prop, ok := pipeline.Steps[0].GetProperty("retry")
+				if !ok {
+					t.Fatal("expected retry property on step")
+				}
+				retry, ok := prop.(ast.RetryValue)
+				if !ok {
+					t.Fatalf("expected RetryValue, got %T", prop)
+				}
+				if retry.MaxAttempts != 5 || retry.Backoff != "linear" || retry.Delay != "500ms" {
+					t.Errorf("retry = %+v, want max 5, linear backoff, 500ms delay", retry)
+				}
+				if len(retry.On) != 2 || retry.On[0] != "timeout" || retry.On[1] != "rate_limit" {
+					t.Errorf("retry.On = %v, want [timeout rate_limit]", retry.On)
+				}
+			},
+		},
+		{
+			name: "agent_with_fallback",
+			input: `agent "writer" {
+				model: "claude-sonnet-4"
+				fallback {
+					models: ["gpt-4o", "gemini-1.5-pro"]
+					on: "rate_limit"
+				}
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				prop, _ := e.GetProperty("fallback")
+				want := ast.FallbackValue{Models: []string{"gpt-4o", "gemini-1.5-pro"}, On: []string{"rate_limit"}}
+				if !reflect.DeepEqual(prop, want) {
+					t.Errorf("fallback = %+v, want %+v", prop, want)
+				}
+			},
+		},
+		{
+			name: "pipeline_with_matrix",
+			input: `pipeline "compare" {
+				matrix {
+					model: ["gpt-4o", "claude-sonnet"]
+					temperature: [0, 0.7]
+				}
+				step "answer" {
+					use: agent("writer")
+				}
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				prop, _ := e.GetProperty("matrix")
+				want := ast.MatrixValue{Dimensions: []ast.MatrixDimension{
+					{Name: "model", Values: []ast.Value{ast.StringValue{Value: "gpt-4o"}, ast.StringValue{Value: "claude-sonnet"}}},
+					{Name: "temperature", Values: []ast.Value{ast.NumberValue{Value: 0}, ast.NumberValue{Value: 0.7}}},
+				}}
+				if !reflect.DeepEqual(prop, want) {
+					t.Errorf("matrix = %+v, want %+v", prop, want)
+				}
+				if steps := e.(*ast.PipelineEntity).Steps; len(steps) != 1 {
+					t.Errorf("expected 1 step, got %d", len(steps))
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -956,6 +1041,159 @@ func TestParser_PropertyAccess(t *testing.T) {
 				if access.Path[0] != "defaults" || access.Path[1] != "timeout" {
 					t.Errorf("Path = %v, want [defaults timeout]", access.Path)
 				}
+				if access.Optional != nil {
+					t.Errorf("Optional = %v, want nil", access.Optional)
+				}
+			},
+		},
+		{
+			name: "optional_chaining",
+			input: `step "test" {
+				input: step("x")?.output?.summary
+				query: params.filters?.region
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				input, _ := e.GetProperty("input")
+				ref := input.(ast.ReferenceValue)
+				if ref.Name != "x" || len(ref.Path) != 2 || !ref.Optional[0] || !ref.Optional[1] {
+					t.Errorf("got %+v, want step x with optional [output summary]", ref)
+				}
+				query, _ := e.GetProperty("query")
+				access := query.(ast.PropertyAccessValue)
+				if len(access.Optional) != 2 || access.Optional[0] || !access.Optional[1] {
+					t.Errorf("Optional = %v, want [false true]", access.Optional)
+				}
+			},
+		},
+		{
+			name: "version_pin",
+			input: `trigger "test" {
+				run: pipeline("review")@v3
+				use: pipeline("report")@"2025-01" {
+					input: "weekly"
+				}
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				run, _ := e.GetProperty("run")
+				if ref, ok := run.(ast.ReferenceValue); !ok || ref.Name != "review" || ref.Version != "v3" {
+					t.Errorf("got %+v, want pipeline review pinned to v3", run)
+				}
+				use, _ := e.GetProperty("use")
+				if call, ok := use.(ast.MethodCallValue); !ok || call.Method != "report" || call.Version != "2025-01" || call.InlineBody == nil {
+					t.Errorf("got %+v, want pipeline report pinned to 2025-01 with a body", use)
+				}
+			},
+		},
+		{
+			name: "profile_overlays",
+			input: `profile "prod" {
+				config {
+					timeout: "10m"
+				}
+				agent "reviewer" {
+					model: "gpt-4o"
+				}
+				pipeline "review" {
+					step "check" {
+						timeout: "1m"
+					}
+				}
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				profile, ok := e.(*ast.ProfileEntity)
+				if !ok || len(profile.Overlays) != 3 {
+					t.Fatalf("got %#v, want a profile with three overlays", e)
+				}
+				if o := profile.Overlays[1]; o.Type() != "agent" || o.Name() != "reviewer" {
+					t.Errorf("second overlay = %s %q, want agent reviewer", o.Type(), o.Name())
+				}
+				if p, ok := profile.Overlays[2].(*ast.PipelineEntity); !ok || len(p.Steps) != 1 {
+					t.Errorf("third overlay = %#v, want a pipeline with one step", profile.Overlays[2])
+				}
+			},
+		},
+		{
+			name: "default_operator",
+			input: `step "test" {
+				input: step("x")?.output ?? $fallback ?? null
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				input, _ := e.GetProperty("input")
+				outer, ok := input.(ast.CoalesceValue)
+				if !ok {
+					t.Fatalf("expected CoalesceValue, got %T", input)
+				}
+				if _, ok := outer.Left.(ast.ReferenceValue); !ok {
+					t.Errorf("Left = %T, want ReferenceValue", outer.Left)
+				}
+				inner, ok := outer.Right.(ast.CoalesceValue)
+				if !ok {
+					t.Fatalf("expected right-associative CoalesceValue, got %T", outer.Right)
+				}
+				if _, ok := inner.Right.(ast.NullValue); !ok {
+					t.Errorf("Right = %T, want NullValue", inner.Right)
+				}
+			},
+		},
+		{
+			name: "operator_precedence",
+			input: `step "test" {
+				break_when: !$done && $a + $b * 2 > 10 || ($c - 1) / 2 == 0
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				got, _ := e.GetProperty("break_when")
+				num := func(v float64) ast.Value { return ast.NumberValue{Value: v} }
+				want := ast.LogicalValue{
+					Left: ast.LogicalValue{
+						Left:     ast.NotValue{Operand: ast.VariableValue{Name: "done"}},
+						Operator: "&&",
+						Right: ast.ComparisonValue{
+							Left: ast.ArithmeticValue{
+								Left:     ast.VariableValue{Name: "a"},
+								Operator: "+",
+								Right:    ast.ArithmeticValue{Left: ast.VariableValue{Name: "b"}, Operator: "*", Right: num(2)},
+							},
+							Operator: ">",
+							Right:    num(10),
+						},
+					},
+					Operator: "||",
+					Right: ast.ComparisonValue{
+						Left: ast.ArithmeticValue{
+							Left:     ast.ArithmeticValue{Left: ast.VariableValue{Name: "c"}, Operator: "-", Right: num(1)},
+							Operator: "/",
+							Right:    num(2),
+						},
+						Operator: "==",
+						Right:    num(0),
+					},
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %+v\nwant %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "unspaced_subtraction",
+			input: `step "test" {
+				a: 5-3
+				b: $n -1
+				c: ($n)-1
+				d: -2
+			}`,
+			checkFirst: func(t *testing.T, e ast.Entity) {
+				num := func(v float64) ast.Value { return ast.NumberValue{Value: v} }
+				n := ast.VariableValue{Name: "n"}
+				for key, want := range map[string]ast.Value{
+					"a": ast.ArithmeticValue{Left: num(5), Operator: "-", Right: num(3)},
+					"b": ast.ArithmeticValue{Left: n, Operator: "-", Right: num(1)},
+					"c": ast.ArithmeticValue{Left: n, Operator: "-", Right: num(1)},
+					"d": num(-2),
+				} {
+					if got, _ := e.GetProperty(key); !reflect.DeepEqual(got, want) {
+						t.Errorf("%s = %+v, want %+v", key, got, want)
+					}
+				}
 			},
 		},
 	}
@@ -974,3 +1212,268 @@ func TestParser_PropertyAccess(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_RetryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown_option", `step "s" { retry { attempts: 3 } }`},
+		{"unknown_backoff", `step "s" { retry { backoff: "random" } }`},
+		{"non_numeric_max", `step "s" { retry { max: "three" } }`},
+		{"invalid_delay", `step "s" { retry { delay: "soon" } }`},
+		{"negative_delay", `step "s" { retry { delay: "-1s" } }`},
+		{"unclosed", `step "s" { retry { max: 3`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := New(tt.input).Parse(); err == nil {
+				t.Errorf("expected parse error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestParser_FallbackErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown_option", `agent "a" { fallback { model: "gpt-4o" } }`},
+		{"without_models", `agent "a" { fallback { on: ["timeout"] } }`},
+		{"non_string_model", `agent "a" { fallback { models: [4] } }`},
+		{"unclosed", `agent "a" { fallback { models: ["gpt-4o"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := New(tt.input).Parse(); err == nil {
+				t.Errorf("expected parse error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestParser_MatrixErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", `pipeline "p" { matrix { } }`},
+		{"not_an_array", `pipeline "p" { matrix { model: "gpt-4o" } }`},
+		{"empty_array", `pipeline "p" { matrix { model: [] } }`},
+		{"reference_value", `pipeline "p" { matrix { model: [agent("a")] } }`},
+		{"duplicate_dimension", `pipeline "p" { matrix { model: ["a"] model: ["b"] } }`},
+		{"unclosed", `pipeline "p" { matrix { model: ["gpt-4o"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := New(tt.input).Parse(); err == nil {
+				t.Errorf("expected parse error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestParseError_Localize(t *testing.T) {
+	_, _, err := New("agent \"writer\" {\n\tmodel: \"gpt-4o\"\n").Parse()
+	var perr ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if perr.Code != i18n.UnclosedBlock || perr.Error() != "at line 1, col 1: unclosed block" {
+		t.Fatalf("unexpected error %q (%s)", perr, perr.Code)
+	}
+	if got := perr.Localize("de-AT"); got != "in Zeile 1, Spalte 1: nicht geschlossener Block" {
+		t.Errorf("unexpected localized error %q", got)
+	}
+}
+
+func TestParser_ImportAlias(t *testing.T) {
+	input := `import "lib/agents.ls" as agents
+import "common.ls"`
+
+	_, imports, err := New(input).Parse()
+	if err != nil {
+		t.Fatalf("Parser.Parse() error = %v", err)
+	}
+	if len(imports) != 2 {
+		t.Fatalf("got %d imports, want 2", len(imports))
+	}
+	if imports[0].Path != "lib/agents.ls" || imports[0].Alias != "agents" {
+		t.Errorf("imports[0] = %+v, want lib/agents.ls as agents", imports[0])
+	}
+	if imports[1].Alias != "" {
+		t.Errorf("imports[1].Alias = %q, want empty", imports[1].Alias)
+	}
+}
+
+func TestParser_Tags(t *testing.T) {
+	input := `agent "reviewer" {
+	model: "gpt-4o"
+	tags: ["code", "review"]
+}
+
+intent "nightly-report" {
+	use: agent("reviewer")
+	tags: [nightly]
+}`
+
+	entities, _, err := New(input).Parse()
+	if err != nil {
+		t.Fatalf("Parser.Parse() error = %v", err)
+	}
+	if got, _ := entities[0].GetMetadata(ast.TagsMetadataKey); got != "code,review" {
+		t.Errorf("agent tags metadata = %q, want code,review", got)
+	}
+	if _, ok := entities[0].GetProperty("tags"); !ok {
+		t.Error("expected the tags property to be kept")
+	}
+	if !ast.HasTag(entities[1], "nightly") {
+		t.Errorf("expected the intent to be tagged nightly, got %v", ast.Tags(entities[1]))
+	}
+
+	for _, invalid := range []string{
+		`agent "a" { tags: "code" }`,
+		`agent "a" { tags: ["code", 1] }`,
+		`agent "a" { tags: ["a,b"] }`,
+		`agent "a" { tags: [""] }`,
+	} {
+		if _, _, err := New(invalid).Parse(); err == nil {
+			t.Errorf("expected parse error for %s", invalid)
+		}
+	}
+}
+
+func TestParser_Owners(t *testing.T) {
+	input := `intent "refund" {
+	owners: ["team-payments", "alice"]
+	visibility: "private"
+}`
+
+	entities, _, err := New(input).Parse()
+	if err != nil {
+		t.Fatalf("Parser.Parse() error = %v", err)
+	}
+	if owners := ast.Owners(entities[0]); len(owners) != 2 || owners[0] != "team-payments" || owners[1] != "alice" {
+		t.Errorf("Owners() = %v, want [team-payments alice]", owners)
+	}
+	if v := ast.Visibility(entities[0]); v != ast.VisibilityPrivate {
+		t.Errorf("Visibility() = %q, want private", v)
+	}
+
+	for _, invalid := range []string{
+		`intent "a" { owners: "team" }`,
+		`intent "a" { owners: ["a,b"] }`,
+		`intent "a" { visibility: "team" }`,
+		`intent "a" { visibility: 1 }`,
+	} {
+		if _, _, err := New(invalid).Parse(); err == nil {
+			t.Errorf("expected parse error for %s", invalid)
+		}
+	}
+}
+
+func TestParser_EvalCases(t *testing.T) {
+	input := `eval "refunds" {
+	target: intent("reply")
+	runs: 3
+
+	case "refund" {
+		input: "I want my money back"
+		expect: { contains: "refund" }
+	}
+
+	case "polite" {
+		expect: { graded: "The reply is polite" }
+	}
+}`
+
+	entities, _, err := New(input).Parse()
+	if err != nil {
+		t.Fatalf("Parser.Parse() error = %v", err)
+	}
+	eval, ok := entities[0].(*ast.EvalEntity)
+	if !ok {
+		t.Fatalf("expected *ast.EvalEntity, got %T", entities[0])
+	}
+	if len(eval.Cases) != 2 || eval.Cases[0].Name() != "refund" || eval.Cases[1].Name() != "polite" {
+		t.Fatalf("expected cases refund and polite, got %+v", eval.Cases)
+	}
+	if _, ok := eval.Cases[0].GetProperty("expect"); !ok {
+		t.Error("expected the case's expect property")
+	}
+	if _, ok := eval.GetProperty("case"); ok {
+		t.Error("expected cases not to be kept as properties")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ast.Value
+	}{
+		{`"gpt-4o"`, ast.StringValue{Value: "gpt-4o"}},
+		{`0.2`, ast.NumberValue{Value: 0.2}},
+		{`[1, 2] # a comment`, ast.ArrayValue{Elements: []ast.Value{ast.NumberValue{Value: 1}, ast.NumberValue{Value: 2}}}},
+		{`agent("writer")`, ast.ReferenceValue{Type: "agent", Name: "writer", Path: []string{}}},
+		{`{ retries: 3 }`, ast.ObjectValue{Properties: map[string]ast.Value{"retries": ast.NumberValue{Value: 3}}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.input)
+		if err != nil {
+			t.Errorf("ParseValue(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseValue(%q) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+
+	expr, err := ParseValue(`step("draft").output ?? $input`)
+	if err != nil {
+		t.Fatalf("ParseValue failed: %v", err)
+	}
+	if _, ok := expr.(ast.CoalesceValue); !ok {
+		t.Errorf("expected a coalesce expression, got %#v", expr)
+	}
+
+	for _, input := range []string{"", `"a" "b"`, `[1,`} {
+		if _, err := ParseValue(input); err == nil {
+			t.Errorf("ParseValue(%q): expected an error", input)
+		}
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	for _, input := range []string{
+		"model: \"gpt-4o\"\ntemperature: 0.2\nstep \"draft\" { use: agent(\"writer\") }",
+		"{\n  model: \"gpt-4o\"\n  temperature: 0.2\n  step \"draft\" { use: agent(\"writer\") }\n}",
+	} {
+		props, err := ParseProperties(input)
+		if err != nil {
+			t.Fatalf("ParseProperties(%q) failed: %v", input, err)
+		}
+		if props["model"] != (ast.StringValue{Value: "gpt-4o"}) || props["temperature"] != (ast.NumberValue{Value: 0.2}) {
+			t.Errorf("unexpected properties: %v", props)
+		}
+		if step, ok := props["step"].(ast.NestedEntityValue); !ok || step.Entity.Name() != "draft" {
+			t.Errorf("expected the nested step, got %#v", props["step"])
+		}
+	}
+
+	if props, err := ParseProperties(""); err != nil || len(props) != 0 {
+		t.Errorf("expected no properties, got %v, %v", props, err)
+	}
+
+	_, err := ParseProperties("{\n  model: \"gpt-4o\"")
+	var perr ParseError
+	if !errors.As(err, &perr) || perr.Code != i18n.UnclosedBlock || perr.Line != 1 {
+		t.Errorf("expected an unclosed block at line 1, got %v", err)
+	}
+	if _, err := ParseProperties("{ model: \"a\" } extra: 1"); err == nil {
+		t.Error("expected an error for properties after the closing brace")
+	}
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
+)
+
+// WithSourceFidelity makes the parser record where each entity and
+// property was written and the comments attached to them, as ast.Source,
+// and return every comment in ParseResult.Comments, so tools can edit
+// source without losing what the AST does not hold:
+//
+//	# Reviews pull requests.     <- leading comment of the agent
+//	agent "reviewer" {
+//	  # Cheap enough per PR.     <- leading comment of model
+//	  model: "gpt-4o-mini"  # pinned by the eval  <- trailing comment of model
+//	}
+//
+// A run of comments on their own lines is attached to the declaration or
+// property on the line after it; a comment after code, to the declaration
+// or property that ends on its line. Other comments inside a declaration
+// are its dangling comments.
+func WithSourceFidelity() Option {
+	return func(p *Parser) {
+		p.fidelity = true
+	}
+}
+
+// comment converts a comment token.
+func comment(t tokenizer.Token) ast.Comment {
+	return ast.Comment{
+		Text:  t.Value,
+		Range: ast.Range{Start: t.Offset, End: t.Offset + len(t.Value), Line: t.Line, Column: t.Column},
+	}
+}
+
+// tokenEnd returns the byte offset just past a token.
+func (p *Parser) tokenEnd(t tokenizer.Token) int {
+	switch t.Type {
+	case tokenizer.TokenTypeString:
+		return t.Offset + len(t.Value) + 2
+	case tokenizer.TokenTypeMultilineString:
+		// The value has Windows line endings replaced
+		if end := strings.Index(p.input[t.Offset+3:], "```"); end >= 0 {
+			return t.Offset + 3 + end + 3
+		}
+		return len(p.input)
+	}
+	return t.Offset + len(t.Value)
+}
+
+// tokenRange returns the range from the start of first to the end of last.
+func (p *Parser) tokenRange(first, last tokenizer.Token) ast.Range {
+	line := first.Line
+	if first.Type == tokenizer.TokenTypeString {
+		// Strings report the line they end on
+		line -= strings.Count(first.Value, "\n")
+	}
+	return ast.Range{Start: first.Offset, End: p.tokenEnd(last), Line: line, Column: first.Column}
+}
+
+// leadingComments returns, and attaches, the run of comments on their own
+// lines that ends on the line before code starting at r.
+func (p *Parser) leadingComments(r ast.Range) []ast.Comment {
+	i := sort.Search(len(p.comments), func(k int) bool { return p.comments[k].Offset >= r.Start })
+	var run []ast.Comment
+	line := r.Line
+	for i--; i >= 0; i-- {
+		c := p.comments[i]
+		if c.Line != line-1 || p.attached[c.Offset] || !p.ownLine(c) {
+			break
+		}
+		run = append(run, comment(c))
+		line = c.Line
+	}
+	for k, c := range run {
+		p.attached[c.Range.Start] = true
+		if j := len(run) - 1 - k; k < j {
+			run[k], run[j] = run[j], run[k]
+		}
+	}
+	return run
+}
+
+// trailingComment returns, and attaches, the comment after the token at
+// index last on its line, if no other token comes before it.
+func (p *Parser) trailingComment(last int) *ast.Comment {
+	end := p.tokenEnd(p.tokens[last])
+	i := sort.Search(len(p.comments), func(k int) bool { return p.comments[k].Offset >= end })
+	if i == len(p.comments) {
+		return nil
+	}
+	c := p.comments[i]
+	if p.attached[c.Offset] || strings.Contains(p.input[end:c.Offset], "\n") ||
+		last+1 < len(p.tokens) && p.tokens[last+1].Offset < c.Offset {
+		return nil
+	}
+	p.attached[c.Offset] = true
+	trailing := comment(c)
+	return &trailing
+}
+
+// ownLine reports whether a comment is the only thing on its line.
+func (p *Parser) ownLine(c tokenizer.Token) bool {
+	start := strings.LastIndexByte(p.input[:c.Offset], '\n') + 1
+	return strings.TrimSpace(p.input[start:c.Offset]) == ""
+}
+
+// beginSource starts recording where the entity e, whose name the parser
+// has just read, was written, and returns the index of its first token.
+func (p *Parser) beginSource(e ast.Entity) int {
+	if !p.fidelity || p.pos == 0 {
+		return -1
+	}
+	start := p.pos - 1
+	src := &ast.Source{Properties: make(map[string]*ast.PropertySource)}
+	if t := p.tokens[start]; t.Type == tokenizer.TokenTypeString && start > 0 {
+		src.Name = p.tokenRange(t, t)
+		start--
+	}
+	first := p.tokens[start]
+	src.Comments.Leading = p.leadingComments(p.tokenRange(first, first))
+	ast.SetSource(e, src)
+	return start
+}
+
+// endSource finishes recording where e was written, from the token at
+// index start to the last token read.
+func (p *Parser) endSource(e ast.Entity, start int) {
+	src := ast.SourceOf(e)
+	if src == nil || start < 0 || p.pos <= start {
+		return
+	}
+	src.Range = p.tokenRange(p.tokens[start], p.tokens[p.pos-1])
+	src.Comments.Trailing = p.trailingComment(p.pos - 1)
+
+	// Comments nested entities and properties did not take
+	i := sort.Search(len(p.comments), func(k int) bool { return p.comments[k].Offset >= src.Range.Start })
+	for ; i < len(p.comments) && p.comments[i].Offset < src.Range.End; i++ {
+		if c := p.comments[i]; !p.attached[c.Offset] {
+			p.attached[c.Offset] = true
+			src.Dangling = append(src.Dangling, comment(c))
+		}
+	}
+}
+
+// recordProperty records where the property starting at the token at
+// index start was written, if parsing it set a property of e rather than
+// adding a nested entity.
+func (p *Parser) recordProperty(e ast.Entity, start int) {
+	src := ast.SourceOf(e)
+	if src == nil || p.pos <= start {
+		return
+	}
+	key := p.tokens[start]
+	value, ok := e.GetProperty(key.Value)
+	if _, nested := value.(ast.NestedEntityValue); !ok || nested {
+		return
+	}
+	prop := &ast.PropertySource{
+		Range: p.tokenRange(key, p.tokens[p.pos-1]),
+		Key:   p.tokenRange(key, key),
+	}
+	prop.Comments.Leading = p.leadingComments(prop.Range)
+	prop.Comments.Trailing = p.trailingComment(p.pos - 1)
+	src.Properties[key.Value] = prop
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+const fidelitySource = `# Header, kept apart by a blank line
+
+# Reviews pull requests.
+# langspace:deprecated use "reviewer-v2"
+agent "reviewer" { # opening
+  # Cheap enough per PR.
+  model: "gpt-4o-mini"  # pinned by the eval
+  instruction: ` + "```" + `
+Be brief.
+` + "```" + `
+  # left over
+} # end of reviewer
+
+pipeline "review" {
+  # First pass
+  step "draft" {
+    use: agent("reviewer")
+  }
+}
+`
+
+func TestParser_SourceFidelity(t *testing.T) {
+	result := New(fidelitySource, WithSourceFidelity()).ParseWithRecovery()
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	if len(result.Comments) != 9 {
+		t.Errorf("got %d comments, want all 9", len(result.Comments))
+	}
+
+	text := func(r ast.Range) string { return fidelitySource[r.Start:r.End] }
+	texts := func(comments []ast.Comment) []string {
+		var s []string
+		for _, c := range comments {
+			s = append(s, c.Text)
+		}
+		return s
+	}
+
+	agent := ast.SourceOf(result.Entities[0])
+	if agent == nil {
+		t.Fatal("expected the agent to record its source")
+	}
+	if got := text(agent.Range); got[:len(`agent "reviewer" {`)] != `agent "reviewer" {` || got[len(got)-1] != '}' {
+		t.Errorf("agent range = %q", got)
+	}
+	if agent.Range.Line != 5 || agent.Range.Column != 1 || text(agent.Name) != `"reviewer"` {
+		t.Errorf("agent range at %d:%d, name %q", agent.Range.Line, agent.Range.Column, text(agent.Name))
+	}
+	if got := texts(agent.Comments.Leading); len(got) != 2 || got[0] != "# Reviews pull requests." {
+		t.Errorf("agent leading comments = %q", got)
+	}
+	if c := agent.Comments.Trailing; c == nil || c.Text != "# end of reviewer" || text(c.Range) != c.Text {
+		t.Errorf("agent trailing comment = %+v", c)
+	}
+	if got := texts(agent.Dangling); len(got) != 2 || got[0] != "# opening" || got[1] != "# left over" {
+		t.Errorf("agent dangling comments = %q", got)
+	}
+
+	model := agent.Properties["model"]
+	if model == nil || text(model.Range) != `model: "gpt-4o-mini"` || text(model.Key) != "model" || model.Range.Line != 7 {
+		t.Fatalf("model source = %+v", model)
+	}
+	if got := texts(model.Comments.Leading); len(got) != 1 || got[0] != "# Cheap enough per PR." {
+		t.Errorf("model leading comments = %q", got)
+	}
+	if c := model.Comments.Trailing; c == nil || c.Text != "# pinned by the eval" {
+		t.Errorf("model trailing comment = %+v", c)
+	}
+	if instruction := agent.Properties["instruction"]; instruction == nil || text(instruction.Range) != "instruction: ```\nBe brief.\n```" {
+		t.Errorf("instruction source = %+v", instruction)
+	}
+
+	pipeline := result.Entities[1].(*ast.PipelineEntity)
+	if src := ast.SourceOf(pipeline); src == nil || len(src.Comments.Leading) != 0 || len(src.Dangling) != 0 {
+		t.Errorf("pipeline source = %+v", src)
+	}
+	step := ast.SourceOf(pipeline.Steps[0])
+	if step == nil || text(step.Name) != `"draft"` || step.Range.Line != 16 {
+		t.Fatalf("step source = %+v", step)
+	}
+	if got := texts(step.Comments.Leading); len(got) != 1 || got[0] != "# First pass" {
+		t.Errorf("step leading comments = %q", got)
+	}
+	if _, ok := ast.SourceOf(pipeline).Properties["step"]; ok {
+		t.Error("expected steps to record their source on the step, not as a property")
+	}
+
+	plain := New(fidelitySource).ParseWithRecovery()
+	if ast.SourceOf(plain.Entities[0]) != nil || plain.Comments != nil {
+		t.Error("expected no source without WithSourceFidelity")
+	}
+}
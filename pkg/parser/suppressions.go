@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// ignoreDirective starts a comment that silences diagnostics.
+const ignoreDirective = directivePrefix + "ignore"
+
+// Suppressions maps lines to the codes of the diagnostics that ignore
+// comments silence on them. An empty list silences every diagnostic.
+type Suppressions map[int][]i18n.Code
+
+// ParseSuppressions returns the diagnostics the ignore comments of source
+// silence:
+//
+//	# langspace:ignore LS2004
+//	step "draft" { use: agent("editor") }
+//
+//	tool "search" {} # langspace:ignore LS2104, LS2202
+//
+// A comment after code applies to its own line, and one on a line of its
+// own to the next line with code. Without codes, it silences every
+// diagnostic; words after the codes are ignored, so the comment can say
+// why.
+func ParseSuppressions(source string) Suppressions {
+	if !strings.Contains(source, ignoreDirective) {
+		return nil
+	}
+
+	s := make(Suppressions)
+	for _, d := range ParseDirectives(source) {
+		if d.Name != "ignore" || d.Target == 0 {
+			continue
+		}
+		if all, ok := s[d.Target]; ok && len(all) == 0 {
+			continue
+		}
+		if codes := ignoredCodes(d.Text); len(codes) == 0 {
+			s[d.Target] = codes
+		} else {
+			s[d.Target] = append(s[d.Target], codes...)
+		}
+	}
+	return s
+}
+
+// Suppressed reports whether a diagnostic with code at line is silenced.
+func (s Suppressions) Suppressed(line int, code i18n.Code) bool {
+	codes, ok := s[line]
+	return ok && (len(codes) == 0 || slices.Contains(codes, code))
+}
+
+// ignoredCodes returns the codes an ignore directive lists, which are
+// empty for all codes.
+func ignoredCodes(text string) []i18n.Code {
+	codes := []i18n.Code{}
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' }) {
+		if !i18n.IsCode(field) {
+			break
+		}
+		codes = append(codes, i18n.Code(field))
+	}
+	return codes
+}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+func TestParseSuppressions(t *testing.T) {
+	source := `# langspace:ignore LS2004
+# langspace:ignore LS2008 -- drafts run first
+step "draft" { use: agent("editor") }
+
+tool "search" {} # langspace:ignore LS2104, LS2202, ACME001
+agent "a" { instruction: "# langspace:ignore" } # langspace:ignore
+
+# langspace:ignorable LS2004
+agent "b" {}
+`
+	s := ParseSuppressions(source)
+	tests := []struct {
+		line int
+		code i18n.Code
+		want bool
+	}{
+		{3, i18n.UndefinedReference, true},
+		{3, i18n.LaterStepReference, true},
+		{3, i18n.UnknownStep, false},
+		{5, i18n.MissingToolHandler, true},
+		{5, i18n.UnusedTool, true},
+		{5, "ACME001", true},
+		{5, i18n.UndefinedReference, false},
+		{6, i18n.UnclosedBlock, true},
+		{9, i18n.UndefinedReference, false},
+		{1, i18n.UndefinedReference, false},
+	}
+	for _, tt := range tests {
+		if got := s.Suppressed(tt.line, tt.code); got != tt.want {
+			t.Errorf("Suppressed(%d, %s) = %v, want %v", tt.line, tt.code, got, tt.want)
+		}
+	}
+
+	if s := ParseSuppressions(`agent "a" {}`); s != nil || s.Suppressed(1, i18n.UnclosedBlock) {
+		t.Errorf("expected no suppressions, got %v", s)
+	}
+}
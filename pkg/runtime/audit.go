@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultAuditHistorySize is the number of events kept by a MemoryAuditLog.
+const DefaultAuditHistorySize = 1000
+
+// AuditEvent records a policy decision made during an execution.
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+
+	// Type is the kind of check, e.g. "moderation"
+	Type string `json:"type"`
+
+	// Entity is the executed entity as "type/name"
+	Entity string `json:"entity"`
+
+	// Stage is the checked content, e.g. "input" or "output"
+	Stage string `json:"stage,omitempty"`
+
+	// Action is the configured response to flagged content
+	Action     string   `json:"action,omitempty"`
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories,omitempty"`
+
+	// Blocked reports whether the execution was stopped
+	Blocked bool   `json:"blocked"`
+	Error   string `json:"error,omitempty"`
+
+	// Metadata is the execution metadata (e.g. the trigger that started it)
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// AuditLog receives audit events. Implementations must be safe for
+// concurrent use.
+type AuditLog interface {
+	Record(event AuditEvent) error
+}
+
+// MemoryAuditLog keeps the most recent audit events in memory.
+type MemoryAuditLog struct {
+	mu        sync.RWMutex
+	events    []AuditEvent
+	maxEvents int
+}
+
+// NewMemoryAuditLog creates an audit log that keeps up to maxEvents events.
+// A non-positive maxEvents uses DefaultAuditHistorySize.
+func NewMemoryAuditLog(maxEvents int) *MemoryAuditLog {
+	if maxEvents <= 0 {
+		maxEvents = DefaultAuditHistorySize
+	}
+	return &MemoryAuditLog{maxEvents: maxEvents}
+}
+
+// Record adds an event, dropping the oldest once the log is full.
+func (l *MemoryAuditLog) Record(event AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	if len(l.events) > l.maxEvents {
+		l.events = l.events[len(l.events)-l.maxEvents:]
+	}
+	return nil
+}
+
+// Events returns a copy of the recorded events, oldest first.
+func (l *MemoryAuditLog) Events() []AuditEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]AuditEvent(nil), l.events...)
+}
+
+// JSONAuditLog writes audit events to w as JSON lines.
+type JSONAuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditLog creates an audit log writing one JSON object per line.
+func NewJSONAuditLog(w io.Writer) *JSONAuditLog {
+	return &JSONAuditLog{w: w}
+}
+
+// Record writes an event.
+func (l *JSONAuditLog) Record(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// WithAuditLog sets the log receiving audit events such as moderation checks.
+func WithAuditLog(auditLog AuditLog) Option {
+	return func(r *Runtime) {
+		r.auditLog = auditLog
+	}
+}
+
+// audit records an event in the audit log, if one is configured.
+func (r *Runtime) audit(ctx context.Context, event AuditEvent) {
+	if r.auditLog == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if err := r.auditLog.Record(event); err != nil {
+		logAt(ctx, slog.LevelWarn, "failed to record audit event", "error", err)
+	}
+}
@@ -0,0 +1,406 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWSCredentials are credentials for signing AWS requests.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Expires is when temporary credentials expire; zero if they do not
+	Expires time.Time
+}
+
+// awsCredentialChain resolves credentials the way the AWS SDKs do, trying in
+// order: environment variables, the shared credentials file, the ECS container
+// endpoint, and the EC2 instance metadata service. Temporary credentials are
+// cached until shortly before they expire.
+type awsCredentialChain struct {
+	profile    string
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	cached *AWSCredentials
+}
+
+// awsMetadataEndpoint is the EC2 instance metadata service; a variable so
+// tests can replace it.
+var awsMetadataEndpoint = "http://169.254.169.254"
+
+func newAWSCredentialChain(profile string) *awsCredentialChain {
+	return &awsCredentialChain{
+		profile:    profile,
+		httpClient: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Retrieve returns the first credentials found in the chain.
+func (c *awsCredentialChain) Retrieve(ctx context.Context) (*AWSCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && (c.cached.Expires.IsZero() || time.Until(c.cached.Expires) > time.Minute) {
+		return c.cached, nil
+	}
+
+	// An explicit profile skips the environment
+	if c.profile == "" {
+		if creds := awsEnvCredentials(); creds != nil {
+			c.cached = creds
+			return creds, nil
+		}
+	}
+
+	creds, err := awsSharedCredentials(awsProfile(c.profile))
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil && c.profile == "" {
+		if creds, err = c.containerCredentials(ctx); err != nil {
+			return nil, err
+		}
+		if creds == nil {
+			creds = c.instanceCredentials(ctx)
+		}
+	}
+	if creds == nil {
+		return nil, fmt.Errorf("no AWS credentials found (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or configure a profile in ~/.aws/credentials)")
+	}
+	c.cached = creds
+	return creds, nil
+}
+
+func awsEnvCredentials() *AWSCredentials {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return nil
+	}
+	return &AWSCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+}
+
+// awsProfile returns the profile to read from shared files.
+func awsProfile(profile string) string {
+	if profile != "" {
+		return profile
+	}
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
+
+// awsSharedFile returns the path of a file in ~/.aws, honoring its
+// environment variable override.
+func awsSharedFile(envVar, name string) string {
+	if path := os.Getenv(envVar); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// awsSharedCredentials reads a profile from the shared credentials file. It
+// returns nil if the file or the profile does not exist.
+func awsSharedCredentials(profile string) (*AWSCredentials, error) {
+	sections, err := readINI(awsSharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"))
+	if err != nil {
+		return nil, err
+	}
+	values, ok := sections[profile]
+	if !ok || values["aws_access_key_id"] == "" {
+		return nil, nil
+	}
+	return &AWSCredentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}, nil
+}
+
+// awsRegion returns the region from the environment or the shared config
+// file, or "" if none is configured.
+func awsRegion(profile string) string {
+	for _, key := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(key); region != "" {
+			return region
+		}
+	}
+	sections, err := readINI(awsSharedFile("AWS_CONFIG_FILE", "config"))
+	if err != nil {
+		return ""
+	}
+	profile = awsProfile(profile)
+	if profile != "default" {
+		profile = "profile " + profile
+	}
+	return sections[profile]["region"]
+}
+
+// readINI parses the sections of an AWS shared config file. A missing file
+// has no sections.
+func readINI(path string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	if path == "" {
+		return sections, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sections, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			current = make(map[string]string)
+			sections[name] = current
+		case current != nil:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return sections, nil
+}
+
+// awsTemporaryCredentials is the JSON format of the container and instance
+// metadata credential endpoints.
+type awsTemporaryCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// containerCredentials fetches credentials from the ECS container endpoint,
+// if the environment configures one.
+func (c *awsCredentialChain) containerCredentials(ctx context.Context) (*AWSCredentials, error) {
+	url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		url = "http://169.254.170.2" + rel
+	}
+	if url == "" {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("container credentials: %w", err)
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	var creds awsTemporaryCredentials
+	if err := c.getJSON(req, &creds); err != nil {
+		return nil, fmt.Errorf("container credentials: %w", err)
+	}
+	return &AWSCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expires:         creds.Expiration,
+	}, nil
+}
+
+// instanceCredentials fetches the instance role's credentials from the EC2
+// instance metadata service (IMDSv2). It returns nil off EC2.
+func (c *awsCredentialChain) instanceCredentials(ctx context.Context) *AWSCredentials {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, "PUT", awsMetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := c.getString(tokenReq)
+	if err != nil {
+		return nil
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", awsMetadataEndpoint+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return req, err
+	}
+	req, err := get("")
+	if err != nil {
+		return nil
+	}
+	role, err := c.getString(req)
+	if err != nil || role == "" {
+		return nil
+	}
+	if req, err = get(strings.SplitN(role, "\n", 2)[0]); err != nil {
+		return nil
+	}
+	var creds awsTemporaryCredentials
+	if err := c.getJSON(req, &creds); err != nil {
+		return nil
+	}
+	return &AWSCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expires:         creds.Expiration,
+	}
+}
+
+func (c *awsCredentialChain) getString(req *http.Request) (string, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (c *awsCredentialChain) getJSON(req *http.Request, v interface{}) error {
+	body, err := c.getString(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(body), v)
+}
+
+// signV4 signs req with AWS Signature Version 4. Every header already set on
+// req is signed, along with the host and the headers signV4 adds.
+func signV4(req *http.Request, body []byte, creds *AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsCanonicalURI(req.URL.EscapedPath()),
+		awsCanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalURI encodes each segment of an escaped path again, as SigV4
+// requires for every service but S3.
+func awsCanonicalURI(escapedPath string) string {
+	if escapedPath == "" {
+		return "/"
+	}
+	segments := strings.Split(escapedPath, "/")
+	for i, s := range segments {
+		segments[i] = awsURIEncode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsURIEncode(k)+"="+awsURIEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes every byte except the unreserved characters
+// A-Z, a-z, 0-9, '-', '.', '_', and '~'.
+func awsURIEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
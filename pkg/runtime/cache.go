@@ -0,0 +1,351 @@
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// CachedStep is a stored step result.
+type CachedStep struct {
+	Output    string    `json:"output"`
+	Reasoning string    `json:"reasoning,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt is the zero time for entries that never expire
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the entry is past its expiry time.
+func (c *CachedStep) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
+// StepCache stores step results keyed by a hash of the step definition and
+// its resolved inputs. Implementations must be safe for concurrent use and
+// must not return expired entries.
+type StepCache interface {
+	Get(key string) (*CachedStep, bool)
+	Set(key string, entry *CachedStep) error
+}
+
+// MemoryStepCache keeps step results in memory for the life of the process.
+type MemoryStepCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CachedStep
+}
+
+// NewMemoryStepCache creates an empty in-memory step cache.
+func NewMemoryStepCache() *MemoryStepCache {
+	return &MemoryStepCache{entries: make(map[string]*CachedStep)}
+}
+
+// Get returns the entry for key, if present and not expired.
+func (c *MemoryStepCache) Get(key string) (*CachedStep, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || entry.Expired(time.Now()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set stores an entry.
+func (c *MemoryStepCache) Set(key string, entry *CachedStep) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	return nil
+}
+
+// DiskStepCache stores step results as JSON files in a directory, so they
+// survive across runs.
+type DiskStepCache struct {
+	dir string
+}
+
+// NewDiskStepCache creates a step cache in dir, creating it if needed.
+func NewDiskStepCache(dir string) (*DiskStepCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskStepCache{dir: dir}, nil
+}
+
+// DefaultStepCacheDir returns the per-user directory for the step cache.
+func DefaultStepCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "langspace", "steps"), nil
+}
+
+func (c *DiskStepCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the entry for key, if present and not expired. Expired and
+// unreadable entries are removed.
+func (c *DiskStepCache) Get(key string) (*CachedStep, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CachedStep
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("discarding corrupt cache entry", "key", key, "error", err)
+		_ = os.Remove(c.path(key))
+		return nil, false
+	}
+	if entry.Expired(time.Now()) {
+		_ = os.Remove(c.path(key))
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set writes an entry, replacing any previous one atomically.
+func (c *DiskStepCache) Set(key string, entry *CachedStep) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// WithStepCache sets the cache used by pipeline steps that declare a
+// `cache` property. Without a cache, the property is ignored.
+func WithStepCache(cache StepCache) Option {
+	return func(r *Runtime) {
+		r.stepCache = cache
+	}
+}
+
+// getStepCacheTTL reads a step's `cache` property: `cache: true` caches
+// without expiry and `cache: "1h"` caches for the given duration.
+func getStepCacheTTL(step *ast.StepEntity) (ttl time.Duration, enabled bool, err error) {
+	prop, ok := step.GetProperty("cache")
+	if !ok {
+		return 0, false, nil
+	}
+	switch v := prop.(type) {
+	case ast.BoolValue:
+		return 0, v.Value, nil
+	case ast.StringValue:
+		d, err := time.ParseDuration(v.Value)
+		if err != nil || d <= 0 {
+			return 0, false, fmt.Errorf("step %q: invalid cache ttl %q (use true or a duration like \"1h\")", step.Name(), v.Value)
+		}
+		return d, true, nil
+	default:
+		return 0, false, fmt.Errorf("step %q: 'cache' must be true, false, or a duration", step.Name())
+	}
+}
+
+// stepCacheKey hashes a step's definition, its agent's definition, and the
+// fully resolved request, so any change to the step, the agent, or upstream
+// outputs interpolated into the prompt produces a different key.
+func stepCacheKey(step *ast.StepEntity, agent ast.Entity, req *CompletionRequest, schema map[string]interface{}) string {
+	h := sha256.New()
+	hashEntity(h, step, "cache", "timeout", "stream_filters")
+	hashEntity(h, agent)
+
+	resolved, _ := json.Marshal(struct {
+		Model           string                 `json:"model"`
+		SystemPrompt    string                 `json:"system_prompt"`
+		Messages        []Message              `json:"messages"`
+		Temperature     float64                `json:"temperature"`
+		ReasoningBudget int                    `json:"reasoning_budget"`
+		Schema          map[string]interface{} `json:"schema,omitempty"`
+	}{req.Model, req.SystemPrompt, req.Messages, req.Temperature, req.ReasoningBudget, schema})
+	h.Write(resolved)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashEntity writes an entity's type, name, and properties to h in a stable
+// order, skipping the named properties.
+func hashEntity(h hash.Hash, entity ast.Entity, skip ...string) {
+	if entity == nil {
+		fmt.Fprint(h, "nil;")
+		return
+	}
+	fmt.Fprintf(h, "%s %q{", entity.Type(), entity.Name())
+	props := entity.Properties()
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+keys:
+	for _, k := range keys {
+		for _, s := range skip {
+			if k == s {
+				continue keys
+			}
+		}
+		fmt.Fprintf(h, "%q:", k)
+		hashValue(h, props[k])
+	}
+	fmt.Fprint(h, "}")
+}
+
+// hashValue writes a value to h. Nested entities are written by content
+// rather than by pointer, so keys are stable across processes.
+func hashValue(h hash.Hash, v ast.Value) {
+	switch val := v.(type) {
+	case ast.ArrayValue:
+		fmt.Fprint(h, "[")
+		for _, e := range val.Elements {
+			hashValue(h, e)
+		}
+		fmt.Fprint(h, "]")
+	case ast.ObjectValue:
+		fmt.Fprint(h, "{")
+		keys := make([]string, 0, len(val.Properties))
+		for k := range val.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%q:", k)
+			hashValue(h, val.Properties[k])
+		}
+		fmt.Fprint(h, "}")
+	case ast.NestedEntityValue:
+		hashEntity(h, val.Entity)
+	case ast.MethodCallValue:
+		if val.Optional {
+			fmt.Fprint(h, "?")
+		}
+		fmt.Fprintf(h, "call %q(", val.Method)
+		hashValue(h, val.Object)
+		for _, a := range val.Arguments {
+			hashValue(h, a)
+		}
+		fmt.Fprint(h, ")")
+		if val.InlineBody != nil {
+			hashEntity(h, val.InlineBody)
+		}
+	case ast.FunctionCallValue:
+		fmt.Fprintf(h, "fn %q(", val.Function)
+		for _, a := range val.Arguments {
+			hashValue(h, a)
+		}
+		fmt.Fprint(h, ")")
+	case ast.ComparisonValue:
+		fmt.Fprint(h, "(")
+		hashValue(h, val.Left)
+		fmt.Fprintf(h, " %s ", val.Operator)
+		hashValue(h, val.Right)
+		fmt.Fprint(h, ")")
+	case ast.CoalesceValue:
+		fmt.Fprint(h, "(")
+		hashValue(h, val.Left)
+		fmt.Fprint(h, " ?? ")
+		hashValue(h, val.Right)
+		fmt.Fprint(h, ")")
+	case ast.ArithmeticValue:
+		fmt.Fprint(h, "(")
+		hashValue(h, val.Left)
+		fmt.Fprintf(h, " %s ", val.Operator)
+		hashValue(h, val.Right)
+		fmt.Fprint(h, ")")
+	case ast.LogicalValue:
+		fmt.Fprint(h, "(")
+		hashValue(h, val.Left)
+		fmt.Fprintf(h, " %s ", val.Operator)
+		hashValue(h, val.Right)
+		fmt.Fprint(h, ")")
+	case ast.NotValue:
+		fmt.Fprint(h, "!(")
+		hashValue(h, val.Operand)
+		fmt.Fprint(h, ")")
+	case ast.TypedParameterValue:
+		fmt.Fprintf(h, "param %s %t %q %q", val.ParamType, val.Required, val.Description, val.EnumValues)
+		hashValue(h, val.Default)
+	case nil:
+		fmt.Fprint(h, "nil")
+	default:
+		// Remaining values hold only scalars and strings
+		fmt.Fprintf(h, "%T%+v;", val, val)
+	}
+}
+
+// cachedStepResult fills stepResult from a cache hit and publishes the
+// output to downstream steps as if the step had run.
+func (r *Runtime) cachedStepResult(ctx *ExecutionContext, step *ast.StepEntity, entry *CachedStep, stepResult *StepResult) *StepResult {
+	stepResult.Success = true
+	stepResult.Cached = true
+	stepResult.Output = entry.Output
+	stepResult.EndTime = time.Now()
+	stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+
+	ctx.SetStepOutput(step.Name(), entry.Output)
+	ctx.SetStepOutput(step.Name()+".output", entry.Output)
+	ctx.SetStepOutput(step.Name()+".tokens", TokenUsage{})
+	if !r.config.RedactReasoning {
+		stepResult.Reasoning = entry.Reasoning
+		ctx.SetStepOutput(step.Name()+".reasoning", entry.Reasoning)
+	}
+
+	ctx.EmitProgress(ProgressEvent{
+		Type:    ProgressTypeStep,
+		Message: fmt.Sprintf("Using cached result for step: %s", step.Name()),
+		Step:    step.Name(),
+	})
+	return stepResult
+}
+
+// storeStepResult caches a successful step result. Failures are logged but
+// do not fail the step.
+func (r *Runtime) storeStepResult(ctx context.Context, key string, ttl time.Duration, stepResult *StepResult) {
+	output, ok := stepResult.Output.(string)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	entry := &CachedStep{
+		Output:    output,
+		Reasoning: stepResult.Reasoning,
+		Model:     stepResult.Model,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = now.Add(ttl)
+	}
+	if err := r.stepCache.Set(key, entry); err != nil {
+		logAt(ctx, slog.LevelWarn, "failed to cache step", "error", err)
+	}
+}
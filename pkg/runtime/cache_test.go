@@ -0,0 +1,212 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const cachedPipelineSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		input: "{{$input}}"
+		cache: true
+	}
+
+	step "polish" {
+		use: agent("writer")
+		input: step("draft").output
+	}
+}
+`
+
+func runCachedPipeline(t *testing.T, rt *Runtime, input string) *ExecutionResult {
+	t.Helper()
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "report", WithInput(input))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	return result
+}
+
+func TestExecute_StepCache(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, cachedPipelineSource))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "draft text"}))
+	rt := New(ws, WithProvider("mock", provider), WithStepCache(NewMemoryStepCache()))
+
+	first := runCachedPipeline(t, rt, "topic A")
+	if first.StepResults["draft"].Cached {
+		t.Error("expected first run to miss the cache")
+	}
+	if got := len(provider.GetRequests()); got != 2 {
+		t.Fatalf("expected 2 requests, got %d", got)
+	}
+
+	// Only the uncached step runs again
+	second := runCachedPipeline(t, rt, "topic A")
+	if !second.StepResults["draft"].Cached || second.StepResults["draft"].Output != "draft text" {
+		t.Errorf("expected cached draft, got %+v", second.StepResults["draft"])
+	}
+	if second.StepResults["polish"].Cached {
+		t.Error("expected step without cache property to run")
+	}
+	if got := len(provider.GetRequests()); got != 3 {
+		t.Errorf("expected 3 requests after second run, got %d", got)
+	}
+	// The cached output still reaches downstream steps
+	if got := provider.GetRequests()[2].Messages[0].Content; !strings.Contains(got, "draft text") {
+		t.Errorf("expected polish prompt to use cached output, got %q", got)
+	}
+
+	// Different inputs miss the cache
+	third := runCachedPipeline(t, rt, "topic B")
+	if third.StepResults["draft"].Cached {
+		t.Error("expected changed input to miss the cache")
+	}
+}
+
+func TestExecute_StepCacheDefinitionChange(t *testing.T) {
+	cache := NewMemoryStepCache()
+
+	run := func(instruction string) *ExecutionResult {
+		source := `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		input: "topic"
+		instruction: "` + instruction + `"
+		cache: "1h"
+	}
+}
+`
+		ws := workspace.New()
+		addEntities(t, ws, parseSource(t, source))
+		rt := New(ws, WithProvider("mock", NewMockProvider()), WithStepCache(cache))
+		result, err := rt.ExecuteByName(context.Background(), "pipeline", "report")
+		if err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		return result
+	}
+
+	run("Be brief.")
+	if !run("Be brief.").StepResults["draft"].Cached {
+		t.Error("expected identical definition to hit the cache")
+	}
+	if run("Be thorough.").StepResults["draft"].Cached {
+		t.Error("expected changed definition to miss the cache")
+	}
+}
+
+func TestExecute_StepCacheDisabled(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, cachedPipelineSource))
+	provider := NewMockProvider()
+	rt := New(ws, WithProvider("mock", provider))
+
+	runCachedPipeline(t, rt, "topic")
+	if runCachedPipeline(t, rt, "topic").StepResults["draft"].Cached {
+		t.Error("expected no caching without a step cache")
+	}
+	if got := len(provider.GetRequests()); got != 4 {
+		t.Errorf("expected 4 requests, got %d", got)
+	}
+}
+
+func TestExecute_StepCacheInvalid(t *testing.T) {
+	source := `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		cache: "forever"
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	rt := New(ws, WithProvider("mock", NewMockProvider()), WithStepCache(NewMemoryStepCache()))
+
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "report"); err == nil {
+		t.Error("expected error for invalid cache ttl")
+	}
+}
+
+func TestStepCache_Expiry(t *testing.T) {
+	expired := &CachedStep{Output: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	fresh := &CachedStep{Output: "new", ExpiresAt: time.Now().Add(time.Hour)}
+
+	disk, err := NewDiskStepCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, cache := range map[string]StepCache{"memory": NewMemoryStepCache(), "disk": disk} {
+		t.Run(name, func(t *testing.T) {
+			if err := cache.Set("a", expired); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Set("b", fresh); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := cache.Get("a"); ok {
+				t.Error("expected expired entry to be a miss")
+			}
+			if entry, ok := cache.Get("b"); !ok || entry.Output != "new" {
+				t.Errorf("expected fresh entry, got %+v", entry)
+			}
+			if _, ok := cache.Get("missing"); ok {
+				t.Error("expected missing entry to be a miss")
+			}
+		})
+	}
+}
+
+func TestDiskStepCache_Persists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "steps")
+	cache, err := NewDiskStepCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set("key", &CachedStep{Output: "saved", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache over the same directory sees the entry
+	reopened, err := NewDiskStepCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := reopened.Get("key"); !ok || entry.Output != "saved" {
+		t.Errorf("expected persisted entry, got %+v", entry)
+	}
+
+	// Corrupt entries are discarded
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get("bad"); ok {
+		t.Error("expected corrupt entry to be a miss")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.json")); !os.IsNotExist(err) {
+		t.Error("expected corrupt entry to be removed")
+	}
+}
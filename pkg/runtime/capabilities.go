@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
+)
+
+// ModelCapabilities describes a family of models.
+type ModelCapabilities struct {
+	// Provider is the provider type that serves the models
+	Provider string
+
+	// Tools reports whether the models support tool calling
+	Tools bool
+
+	// Reasoning reports whether the models accept a reasoning budget
+	Reasoning bool
+}
+
+// DefaultModelCapabilities is the capability registry used to check agents
+// before they run. Models are matched by the longest key that prefixes the
+// model name; models matching no key are not checked.
+var DefaultModelCapabilities = map[string]ModelCapabilities{
+	"claude":          {Provider: "anthropic", Tools: true},
+	"claude-3-7":      {Provider: "anthropic", Tools: true, Reasoning: true},
+	"claude-sonnet-4": {Provider: "anthropic", Tools: true, Reasoning: true},
+	"claude-opus-4":   {Provider: "anthropic", Tools: true, Reasoning: true},
+	"claude-haiku-4":  {Provider: "anthropic", Tools: true, Reasoning: true},
+	"gpt":             {Provider: "openai", Tools: true},
+	"o1":              {Provider: "openai", Tools: true, Reasoning: true},
+	"o3":              {Provider: "openai", Tools: true, Reasoning: true},
+	"gemini":          {Provider: "gemini", Tools: true},
+	"gemini-2.5":      {Provider: "gemini", Tools: true, Reasoning: true},
+
+	"anthropic.":                {Provider: "bedrock", Tools: true},
+	"anthropic.claude-3-7":      {Provider: "bedrock", Tools: true, Reasoning: true},
+	"anthropic.claude-sonnet-4": {Provider: "bedrock", Tools: true, Reasoning: true},
+	"anthropic.claude-opus-4":   {Provider: "bedrock", Tools: true, Reasoning: true},
+	"amazon.titan-text":         {Provider: "bedrock"},
+}
+
+// lookupCapabilities returns the capabilities of a model, if known.
+func lookupCapabilities(model string) (ModelCapabilities, bool) {
+	best := ""
+	for prefix := range DefaultModelCapabilities {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelCapabilities{}, false
+	}
+	return DefaultModelCapabilities[best], true
+}
+
+// ModelProvider returns the provider type that serves a model according to
+// DefaultModelCapabilities, or "" for unknown models.
+func ModelProvider(model string) string {
+	caps, _ := lookupCapabilities(model)
+	return caps.Provider
+}
+
+// CheckAgents checks every agent against the registered providers and the
+// capability registry, so misconfigurations are reported together when a
+// workspace is loaded rather than one step at a time mid-run:
+//   - an agent's `provider` names a registered provider
+//   - some provider serves the agent's model
+//   - that provider is of the type the capability registry expects for the
+//     model
+//   - the model supports the agent's tools and reasoning budget
+//
+// Errors are ordered by source position.
+func (r *Runtime) CheckAgents() []validator.SemanticError {
+	var errs []validator.SemanticError
+	report := func(agent ast.Entity, format string, args ...interface{}) {
+		errs = append(errs, validator.SemanticError{
+			EntityType: agent.Type(),
+			EntityName: agent.Name(),
+			Line:       agent.Line(),
+			Column:     agent.Column(),
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, agent := range r.workspace.GetEntitiesByType("agent") {
+		model := r.getAgentModel(agent)
+
+		name := propertyString(agent, "provider")
+		var provider LLMProvider
+		if name != "" {
+			var ok bool
+			if provider, ok = r.GetProvider(name); !ok {
+				report(agent, "unknown provider %q (registered: %v)", name, r.providerNames())
+				continue
+			}
+		} else {
+			var err error
+			if name, provider, err = r.lookupProvider(model); err != nil {
+				report(agent, "%v", err)
+				continue
+			}
+		}
+
+		caps, known := lookupCapabilities(model)
+		if !known {
+			continue
+		}
+		if providerType := r.providerType(name, provider); isHostedProviderType(providerType) && providerType != caps.Provider {
+			report(agent, "model %q is served by %s, but provider %q is %s", model, caps.Provider, name, providerType)
+		}
+		if len(validator.AgentToolNames(agent)) > 0 && !caps.Tools {
+			report(agent, "model %q does not support tools", model)
+		}
+		if r.getAgentReasoningBudget(agent) > 0 && !caps.Reasoning {
+			report(agent, "model %q does not support 'reasoning_budget'", model)
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return errs
+}
+
+// providerType returns the type of a registered provider: its provider
+// entity's type, or else the provider's own name.
+func (r *Runtime) providerType(name string, p LLMProvider) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.providerTypes[name]; ok {
+		return t
+	}
+	return p.Name()
+}
+
+// isHostedProviderType reports whether a provider type serves only its
+// vendor's models. Other types, such as local endpoints, may serve any model.
+func isHostedProviderType(providerType string) bool {
+	for _, caps := range DefaultModelCapabilities {
+		if caps.Provider == providerType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestRuntime_CheckAgents(t *testing.T) {
+	source := `agent "classifier" {
+	model: "llama3.1"
+	provider: "vllm-internal"
+}
+
+agent "writer" {
+	model: "gpt-4o"
+	provider: "anthropic"
+	reasoning_budget: 2048
+}
+
+agent "planner" {
+	model: "claude-sonnet-4-20250514"
+	reasoning_budget: 2048
+	tools: ["search"]
+}
+
+agent "summarizer" {
+	model: "gemini-2.0-flash"
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	rt := New(ws)
+	rt.RegisterProvider("anthropic", NewAnthropicProvider())
+	rt.RegisterProvider("openai", NewOpenAIProvider())
+	rt.RegisterProvider("gemini", NewGeminiProvider())
+
+	errs := rt.CheckAgents()
+	want := []string{
+		`1:1: agent "classifier": unknown provider "vllm-internal" (registered: [anthropic gemini openai])`,
+		`6:1: agent "writer": model "gpt-4o" is served by openai, but provider "anthropic" is anthropic`,
+		`6:1: agent "writer": model "gpt-4o" does not support 'reasoning_budget'`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, e.Error(), want[i])
+		}
+	}
+}
+
+func TestRuntime_CheckAgentsNoProvider(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `agent "writer" { model: "gpt-4o" }`))
+
+	errs := New(ws).CheckAgents()
+	if len(errs) != 1 || errs[0].Message != `no LLM provider available for model "gpt-4o"` {
+		t.Errorf("expected missing provider error, got %v", errs)
+	}
+}
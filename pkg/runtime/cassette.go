@@ -0,0 +1,270 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrCassetteMiss is returned when replaying a request the cassette has no
+// recording of.
+var ErrCassetteMiss = errors.New("request not recorded in cassette")
+
+// CassetteMode is whether a cassette records model calls or replays them.
+type CassetteMode string
+
+const (
+	// CassetteRecord sends requests to providers and records them
+	CassetteRecord CassetteMode = "record"
+
+	// CassetteReplay answers requests from the recording, without providers
+	CassetteReplay CassetteMode = "replay"
+)
+
+// cassetteVersion is the version of the cassette file format.
+const cassetteVersion = 1
+
+// Cassette records the requests an execution sends to model providers and
+// their responses, and replays them in later executions without network
+// access or API keys, for tests of pipelines in CI.
+//
+// A replayed request is matched on what determines its response, like the
+// response cache: the model, prompts, tool schemas, and sampling settings.
+// Identical requests replay their recordings in the order they were
+// recorded, and the last one once those run out. A request with no
+// recording fails with ErrCassetteMiss.
+//
+// Example:
+//
+//	cassette, _ := runtime.NewCassette("testdata/review.json", runtime.CassetteRecord)
+//	rt := runtime.New(ws, runtime.WithCassette(cassette))
+//	result, _ := rt.Execute(ctx, pipeline)
+//	err := cassette.Save()
+type Cassette struct {
+	path string
+	mode CassetteMode
+
+	mu           sync.Mutex
+	interactions []CassetteInteraction
+	replayed     map[string]int // key -> interactions replayed
+}
+
+// CassetteInteraction is a recorded model call.
+type CassetteInteraction struct {
+	// Key identifies the request (see responseCacheKey)
+	Key string `json:"key"`
+
+	// Provider is the name of the provider that served the request
+	Provider string `json:"provider"`
+
+	Request  *CompletionRequest  `json:"request"`
+	Response *CompletionResponse `json:"response,omitempty"`
+
+	// Error is the error the call failed with, and StatusCode the status
+	// of an API error
+	Error      string `json:"error,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+// cassetteFile is the JSON form of a cassette.
+type cassetteFile struct {
+	Version      int                   `json:"version"`
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// NewCassette creates a cassette backed by the file at path. A cassette
+// that records starts empty and replaces the file on Save; one that
+// replays reads the file.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, replayed: make(map[string]int)}
+	switch mode {
+	case CassetteRecord:
+		return c, nil
+	case CassetteReplay:
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q: expected record or replay", mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	if f.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s has version %d; this version of langspace reads version %d", path, f.Version, cassetteVersion)
+	}
+	c.interactions = f.Interactions
+	return c, nil
+}
+
+// WithCassette records the model calls of executions to cassette, or
+// replays them from it, depending on its mode.
+func WithCassette(cassette *Cassette) Option {
+	return func(r *Runtime) {
+		r.cassette = cassette
+	}
+}
+
+// Mode returns whether the cassette records or replays.
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Interactions returns a copy of the recorded model calls, in the order
+// they were made.
+func (c *Cassette) Interactions() []CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CassetteInteraction(nil), c.interactions...)
+}
+
+// Save writes the recorded calls to the cassette's file, replacing it
+// atomically. Saving a cassette that replays does nothing.
+func (c *Cassette) Save() error {
+	if c.mode != CassetteRecord {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.MarshalIndent(cassetteFile{Version: cassetteVersion, Interactions: c.interactions}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// record adds a call.
+func (c *Cassette) record(provider string, req *CompletionRequest, resp *CompletionResponse, err error) {
+	// Later calls (e.g. schema repairs) extend the request's messages
+	reqCopy := *req
+	reqCopy.Messages = append([]Message(nil), req.Messages...)
+	interaction := CassetteInteraction{Key: responseCacheKey(req), Provider: provider, Request: &reqCopy}
+	if resp != nil {
+		respCopy := *resp
+		respCopy.ToolCalls = append([]ToolCall(nil), resp.ToolCalls...)
+		interaction.Response = &respCopy
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			interaction.StatusCode = apiErr.StatusCode
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, interaction)
+}
+
+// replay returns the recorded outcome of req: the next recording of the
+// same request, or the last once they run out.
+func (c *Cassette) replay(req *CompletionRequest) (*CompletionResponse, error) {
+	key := responseCacheKey(req)
+
+	c.mu.Lock()
+	var matches []*CassetteInteraction
+	for i := range c.interactions {
+		if c.interactions[i].Key == key {
+			matches = append(matches, &c.interactions[i])
+		}
+	}
+	n := c.replayed[key]
+	c.replayed[key]++
+	c.mu.Unlock()
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w %s: a request to model %q; record the cassette again", ErrCassetteMiss, c.path, req.Model)
+	}
+	interaction := matches[min(n, len(matches)-1)]
+	if interaction.Error != "" {
+		if interaction.StatusCode != 0 {
+			return interaction.Response, &APIError{StatusCode: interaction.StatusCode, Body: interaction.Error}
+		}
+		return interaction.Response, errors.New(interaction.Error)
+	}
+	if interaction.Response == nil {
+		return nil, fmt.Errorf("cassette %s: recorded request to model %q has no response", c.path, req.Model)
+	}
+	resp := *interaction.Response
+	resp.ToolCalls = append([]ToolCall(nil), interaction.Response.ToolCalls...)
+	return &resp, nil
+}
+
+// cassetteProvider records the calls made through it to a cassette, or
+// answers them from it.
+type cassetteProvider struct {
+	LLMProvider
+	name     string
+	cassette *Cassette
+}
+
+// recordResponses wraps the provider registered under name so its calls are
+// recorded or replayed, if a cassette is configured.
+func (r *Runtime) recordResponses(name string, p LLMProvider) LLMProvider {
+	if r.cassette == nil {
+		return p
+	}
+	return &cassetteProvider{LLMProvider: p, name: name, cassette: r.cassette}
+}
+
+// Complete replays a recorded response, or sends the request and records
+// it.
+func (p *cassetteProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	if p.cassette.mode == CassetteReplay {
+		return p.cassette.replay(req)
+	}
+	resp, err := p.LLMProvider.Complete(ctx, req)
+	// Calls cut short by cancellation or a timeout would not replay alike
+	if ctx.Err() == nil {
+		p.cassette.record(p.name, req, resp, err)
+	}
+	return resp, err
+}
+
+// CompleteStream replays a recorded response to handler as a single chunk,
+// or streams the request and records it.
+func (p *cassetteProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	if p.cassette.mode == CassetteReplay {
+		resp, err := p.cassette.replay(req)
+		if err == nil {
+			replayResponse(resp, handler)
+		}
+		return resp, err
+	}
+	resp, err := p.LLMProvider.CompleteStream(ctx, req, handler)
+	// Calls cut short by cancellation or a timeout would not replay alike
+	if ctx.Err() == nil {
+		p.cassette.record(p.name, req, resp, err)
+	}
+	return resp, err
+}
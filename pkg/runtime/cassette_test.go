@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const cassetteSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "release" {
+	step "draft" {
+		use: agent("writer")
+		input: "Draft the release notes"
+	}
+	step "again" {
+		use: agent("writer")
+		input: "Draft the release notes"
+	}
+	step "polish" {
+		use: agent("writer")
+		input: "Polish: $draft.output"
+	}
+}
+`
+
+func TestCassette_RecordReplay(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, cassetteSource))
+	pipeline, _ := ws.GetEntityByName("pipeline", "release")
+	path := filepath.Join(t.TempDir(), "cassettes", "release.json")
+
+	recorder, err := NewCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "Bug fixes", FinishReason: FinishReasonStop},
+		MockResponse{Content: "Bug fixes and features", FinishReason: FinishReasonStop},
+		MockResponse{Content: "Polished notes", FinishReason: FinishReasonStop},
+	))
+	rt := New(ws, WithProvider("mock", live), WithCassette(recorder))
+	recorded, err := rt.Execute(context.Background(), pipeline)
+	if err != nil || !recorded.Success {
+		t.Fatalf("Execute failed: %v, %v", err, recorded.Error)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if n := len(recorder.Interactions()); n != 3 {
+		t.Fatalf("recorded %d interactions, want 3", n)
+	}
+
+	// Replaying sends nothing to the provider, which would fail
+	player, err := NewCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatalf("NewCassette() error = %v", err)
+	}
+	offline := NewMockProvider(WithMockError(errors.New("no network")))
+	handler := &BufferedStreamHandler{}
+	rt = New(ws, WithProvider("mock", offline), WithCassette(player), WithConfig(&Config{EnableStreaming: true}))
+	replayed, err := rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+	if err != nil || !replayed.Success {
+		t.Fatalf("Execute failed: %v, %v", err, replayed.Error)
+	}
+	if n := len(offline.GetRequests()); n != 0 {
+		t.Errorf("expected no requests to the provider, got %d", n)
+	}
+	for step, want := range map[string]string{"draft": "Bug fixes", "again": "Bug fixes and features", "polish": "Polished notes"} {
+		if got := replayed.StepResults[step].Output; got != want {
+			t.Errorf("step %s output = %v, want %q", step, got, want)
+		}
+	}
+	if len(handler.Chunks) != 3 {
+		t.Errorf("expected each replayed response streamed as a chunk, got %+v", handler.Chunks)
+	}
+
+	// Changing a prompt needs a new recording
+	changed := workspace.New()
+	addEntities(t, changed, parseSource(t, strings.Replace(cassetteSource, "Polish:", "Shorten:", 1)))
+	pipeline, _ = changed.GetEntityByName("pipeline", "release")
+	player, _ = NewCassette(path, CassetteReplay)
+	rt = New(changed, WithProvider("mock", offline), WithCassette(player))
+	result, _ := rt.Execute(context.Background(), pipeline)
+	if result == nil || result.Success || !errors.Is(result.Error, ErrCassetteMiss) {
+		t.Errorf("expected a cassette miss, got %+v", result)
+	}
+}
+
+func TestCassette_ReplaysErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.json")
+	recorder, _ := NewCassette(path, CassetteRecord)
+	req := &CompletionRequest{Model: "mock-model", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+	recorder.record("mock", req, nil, &APIError{StatusCode: 429, Body: "slow down"})
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := NewCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = player.replay(req)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 {
+		t.Errorf("expected the recorded API error, got %v", err)
+	}
+
+	if _, err := NewCassette(filepath.Join(t.TempDir(), "missing.json"), CassetteReplay); err == nil {
+		t.Error("expected replaying a missing cassette to fail")
+	}
+	if _, err := NewCassette(path, "rewind"); err == nil || !strings.Contains(err.Error(), "invalid cassette mode") {
+		t.Errorf("expected an invalid mode to fail, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// resolveListFunction resolves map(list, expr) and filter(list, expr). The
+// expression is evaluated once per element, with the element bound to $item
+// (or {{item}} in a string) and its position to $index:
+//
+//	map(step("review").output, $item.summary)
+//	map(step("review").output, "- {{item.file}}: {{item.summary}}")
+//	filter(step("review").output, $item.severity == "high")
+func (r *Resolver) resolveListFunction(fc ast.FunctionCallValue) (interface{}, error) {
+	if len(fc.Arguments) != 2 {
+		return nil, fmt.Errorf("%s() requires a list and an expression", fc.Function)
+	}
+	resolved, err := r.Resolve(fc.Arguments[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve argument 0: %w", err)
+	}
+	list, err := toList(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", fc.Function, err)
+	}
+
+	result := make([]interface{}, 0, len(list))
+	for i, item := range list {
+		value, err := r.withLocals(map[string]interface{}{"item": item, "index": float64(i)}).Resolve(fc.Arguments[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s(): element %d: %w", fc.Function, i, err)
+		}
+
+		if fc.Function == "map" {
+			result = append(result, value)
+			continue
+		}
+		keep, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("filter(): element %d: condition must be true or false, got %T", i, value)
+		}
+		if keep {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// joinList resolves join(list, sep), joining the elements' text with sep
+// (a newline by default, one element per line). Objects and lists are
+// joined as JSON.
+func joinList(args []interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("join() requires a list and an optional separator")
+	}
+	list, err := toList(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("join(): %w", err)
+	}
+	sep := "\n"
+	if len(args) == 2 {
+		sep = toString(args[1])
+	}
+
+	parts := make([]string, len(list))
+	for i, item := range list {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			data, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("join(): element %d: %w", i, err)
+			}
+			parts[i] = string(data)
+		default:
+			parts[i] = toString(item)
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// toList converts a resolved value to a list. Text holding a JSON array,
+// such as the output of a step told to answer in JSON, is decoded; null is
+// an empty list.
+func toList(v interface{}) ([]interface{}, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return val, nil
+	case []string:
+		list := make([]interface{}, len(val))
+		for i, s := range val {
+			list[i] = s
+		}
+		return list, nil
+	case []FileContent:
+		list := make([]interface{}, len(val))
+		for i, f := range val {
+			list[i] = map[string]interface{}{"path": f.Path, "content": f.Content}
+		}
+		return list, nil
+	case string:
+		var list []interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(val)), &list); err == nil {
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a list, got %T", v)
+}
+
+// withLocals returns a resolver that sees the given variables in addition
+// to the execution context's.
+func (r *Resolver) withLocals(locals map[string]interface{}) *Resolver {
+	merged := make(map[string]interface{}, len(r.locals)+len(locals))
+	for k, v := range r.locals {
+		merged[k] = v
+	}
+	for k, v := range locals {
+		merged[k] = v
+	}
+	return &Resolver{ctx: r.ctx, workspace: r.workspace, locals: merged, includes: r.includes}
+}
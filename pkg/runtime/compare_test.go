@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestCompareStep(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "canary" {
+	step "stable" {
+		use: agent("writer")
+		input: $input
+	}
+	step "canary" {
+		use: agent("writer")
+		input: $input
+	}
+	step "drift" {
+		compare: [step("stable").output, step("canary").output]
+		method: "json"
+		threshold: 0.75
+	}
+	step "wording" {
+		compare: [step("stable").output, step("canary").output]
+	}
+	output: step("drift").output.passed
+}
+`))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: `{"severity": "high", "files": ["a.go"], "fix": "check nil"}`},
+		MockResponse{Content: "```json\n{\"severity\": \"high\", \"files\": [\"a.go\", \"b.go\"], \"fix\": \"guard nil\"}\n```"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "canary", WithInput("review"))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if len(provider.GetRequests()) != 2 {
+		t.Errorf("expected comparisons to make no model calls, got %d calls", len(provider.GetRequests()))
+	}
+	if result.Output != false {
+		t.Errorf("expected the comparison not to pass, got %v", result.Output)
+	}
+
+	drift := result.StepResults["drift"].Output.(map[string]interface{})
+	if drift["equal"] != false || drift["similarity"] != 0.5 {
+		t.Errorf("expected half the leaves to match, got %v", drift)
+	}
+	wantDiff := []interface{}{`+ $.files[1]: "b.go"`, `~ $.fix: "check nil" -> "guard nil"`}
+	if !reflect.DeepEqual(drift["diff"], wantDiff) {
+		t.Errorf("diff = %v, want %v", drift["diff"], wantDiff)
+	}
+
+	wording := result.StepResults["wording"].Output.(map[string]interface{})
+	if wording["method"] != CompareText || wording["passed"] != false || len(wording["diff"].([]interface{})) != 4 {
+		t.Errorf("expected a failed text comparison with a line diff, got %v", wording)
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	equal, similarity, diff := compareText("the quick brown fox", "the quick brown fox")
+	if !equal || similarity != 1 || diff != nil {
+		t.Errorf("expected equal texts, got %v %v %v", equal, similarity, diff)
+	}
+
+	equal, similarity, diff = compareText("the quick brown fox\njumps", "the quick red fox\njumps")
+	if equal || similarity != 0.8 {
+		t.Errorf("expected 8 of 10 words in common, got %v %v", equal, similarity)
+	}
+	if want := []string{"- the quick brown fox", "+ the quick red fox"}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %v, want %v", diff, want)
+	}
+}
+
+func TestCompareJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       interface{}
+		similarity float64
+		diff       []string
+	}{
+		{name: "key order", a: `{"a": 1, "b": [1, 2]}`, b: map[string]interface{}{"b": []int{1, 2}, "a": 1}, similarity: 1},
+		{name: "empty", a: `{}`, b: `{}`, similarity: 1},
+		{name: "changed type", a: `{"a": {"b": 1}}`, b: `{"a": "b"}`, similarity: 0, diff: []string{`~ $.a: {"b":1} -> "b"`}},
+		{name: "removed", a: `{"a": 1, "b": {"c": 2, "d": 3}}`, b: `{"a": 1}`, similarity: 1.0 / 3, diff: []string{`- $.b: {"c":2,"d":3}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			equal, similarity, diff, err := compareJSON(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if equal != (len(tt.diff) == 0) || math.Abs(similarity-tt.similarity) > 1e-9 || !reflect.DeepEqual(diff, tt.diff) {
+				t.Errorf("compareJSON = %v, %v, %q; want similarity %v and diff %q", equal, similarity, diff, tt.similarity, tt.diff)
+			}
+		})
+	}
+
+	if _, _, _, err := compareJSON("not json", "{}"); err == nil || !strings.Contains(err.Error(), "not JSON") {
+		t.Errorf("expected an error for text that is not JSON, got %v", err)
+	}
+}
+
+// embeddingProvider embeds texts as the counts of the letters a and b.
+type embeddingProvider struct {
+	*MockProvider
+}
+
+func (p *embeddingProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(strings.Count(text, "a")), float64(strings.Count(text, "b"))}
+	}
+	return vectors, nil
+}
+
+func TestCompareStepEmbedding(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+pipeline "similar" {
+	step "check" {
+		compare: [$input, "bb"]
+		method: "embedding"
+		threshold: 0.7
+	}
+}
+`))
+
+	rt := New(ws)
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "similar", WithInput("ab")); err == nil || !strings.Contains(err.Error(), "supports embeddings") {
+		t.Errorf("expected an error without an embedding provider, got %v", err)
+	}
+
+	rt = New(ws, WithProvider("embed", &embeddingProvider{NewMockProvider()}))
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "similar", WithInput("ab"))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	check := result.Output.(map[string]interface{})
+	if similarity := check["similarity"].(float64); math.Abs(similarity-math.Sqrt(0.5)) > 1e-9 || check["passed"] != true {
+		t.Errorf("expected a passing cosine similarity of 0.707, got %v", check)
+	}
+}
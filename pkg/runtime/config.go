@@ -0,0 +1,174 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/validator"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// WorkspaceConfig is the typed form of a workspace's config entity, for
+// embedders that need its settings without walking the AST. Values such as
+// env("KEY") are resolved when the config is read.
+type WorkspaceConfig struct {
+	DefaultModel       string
+	DefaultTemperature float64
+	Timeout            time.Duration
+	Environment        map[string]string
+	Providers          map[string]ProviderConfig
+
+	// Provider, BaseURL, APIKey, and Models configure a local provider
+	// (see NewLocalProviderFromConfig)
+	Provider string
+	BaseURL  string
+	APIKey   string
+	Models   []string
+
+	Locale      string
+	Timezone    string
+	Translation map[string]interface{}
+
+	// Extra holds project-specific keys LangSpace does not recognize
+	Extra map[string]interface{}
+}
+
+// ProviderConfig is an entry of the config entity's `providers` object.
+type ProviderConfig struct {
+	APIKey  string
+	BaseURL string
+
+	// RateLimit limits the provider registered under the entry's name
+	RateLimit RateLimit
+
+	// Options holds the provider's other settings, e.g. organization
+	Options map[string]interface{}
+}
+
+// ConfigFromWorkspace validates and returns the workspace's config entity.
+// A workspace without a config entity yields an empty config.
+func ConfigFromWorkspace(ws *workspace.Workspace) (*WorkspaceConfig, error) {
+	cfg := &WorkspaceConfig{}
+	configs := ws.GetEntitiesByType("config")
+	if len(configs) == 0 {
+		return cfg, nil
+	}
+	entity := configs[0]
+	if err := validator.New().ValidateEntity(entity); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	resolver := NewResolver(&ExecutionContext{
+		Context:   context.Background(),
+		Workspace: ws,
+		Variables: make(map[string]interface{}),
+	})
+	for key, prop := range entity.Properties() {
+		value, err := resolver.Resolve(prop)
+		if err != nil {
+			return nil, fmt.Errorf("config '%s': %w", key, err)
+		}
+		if err := cfg.set(key, value); err != nil {
+			return nil, fmt.Errorf("config '%s': %w", key, err)
+		}
+	}
+	return cfg, nil
+}
+
+// set assigns a resolved config value to its field.
+func (c *WorkspaceConfig) set(key string, value interface{}) error {
+	switch key {
+	case "default_model":
+		c.DefaultModel = toString(value)
+	case "default_temperature":
+		n, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("must be a number")
+		}
+		c.DefaultTemperature = n
+	case "timeout":
+		d, err := configDuration(value)
+		if err != nil {
+			return err
+		}
+		c.Timeout = d
+	case "environment":
+		vars, _ := value.(map[string]interface{})
+		c.Environment = make(map[string]string, len(vars))
+		for name, v := range vars {
+			c.Environment[name] = toString(v)
+		}
+	case "providers":
+		providers, err := providerConfigs(value)
+		if err != nil {
+			return err
+		}
+		c.Providers = providers
+	case "provider":
+		c.Provider = toString(value)
+	case "base_url":
+		c.BaseURL = toString(value)
+	case "api_key":
+		c.APIKey = toString(value)
+	case "models":
+		models, _ := value.([]interface{})
+		for _, m := range models {
+			c.Models = append(c.Models, toString(m))
+		}
+	case "locale":
+		c.Locale = toString(value)
+	case "timezone":
+		c.Timezone = toString(value)
+	case "translation":
+		c.Translation, _ = value.(map[string]interface{})
+	default:
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[key] = value
+	}
+	return nil
+}
+
+// providerConfigs converts the resolved `providers` object.
+func providerConfigs(value interface{}) (map[string]ProviderConfig, error) {
+	providers, _ := value.(map[string]interface{})
+	configs := make(map[string]ProviderConfig, len(providers))
+	for name, v := range providers {
+		settings, _ := v.(map[string]interface{})
+		pc := ProviderConfig{Options: make(map[string]interface{})}
+		for k, setting := range settings {
+			var err error
+			switch k {
+			case "api_key":
+				pc.APIKey = toString(setting)
+			case "base_url":
+				pc.BaseURL = toString(setting)
+			case "requests_per_minute":
+				pc.RateLimit.RequestsPerMinute, err = positiveInt(k, setting)
+			case "tokens_per_minute":
+				pc.RateLimit.TokensPerMinute, err = positiveInt(k, setting)
+			default:
+				pc.Options[k] = setting
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		configs[name] = pc
+	}
+	return configs, nil
+}
+
+// configDuration converts a duration string or a number of seconds.
+func configDuration(value interface{}) (time.Duration, error) {
+	if n, ok := value.(float64); ok {
+		return time.Duration(n * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(toString(value))
+	if err != nil {
+		return 0, fmt.Errorf("must be a duration like \"30s\": %w", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestConfigFromWorkspace(t *testing.T) {
+	t.Setenv("TEST_OPENAI_KEY", "sk-test")
+
+	source := `
+config {
+	default_model: "gpt-4o"
+	default_temperature: 0.2
+	timeout: "2m"
+	environment: {
+		REGION: "eu-north-1"
+	}
+	providers: {
+		openai: {
+			api_key: env("TEST_OPENAI_KEY")
+			organization: "acme"
+		}
+	}
+	locale: "sv-SE"
+	project_root: "."
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	cfg, err := ConfigFromWorkspace(ws)
+	if err != nil {
+		t.Fatalf("ConfigFromWorkspace error: %v", err)
+	}
+	if cfg.DefaultModel != "gpt-4o" || cfg.DefaultTemperature != 0.2 || cfg.Timeout != 2*time.Minute {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.Environment["REGION"] != "eu-north-1" || cfg.Locale != "sv-SE" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	openai := cfg.Providers["openai"]
+	if openai.APIKey != "sk-test" || openai.Options["organization"] != "acme" {
+		t.Errorf("unexpected provider config %+v", openai)
+	}
+	if cfg.Extra["project_root"] != "." {
+		t.Errorf("expected unrecognized keys in Extra, got %v", cfg.Extra)
+	}
+}
+
+func TestConfigFromWorkspace_Empty(t *testing.T) {
+	cfg, err := ConfigFromWorkspace(workspace.New())
+	if err != nil || cfg == nil || cfg.DefaultModel != "" {
+		t.Errorf("expected empty config, got %+v, %v", cfg, err)
+	}
+}
+
+func TestConfigFromWorkspace_Invalid(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `config { tempratura: 0.2 }`))
+
+	_, err := ConfigFromWorkspace(ws)
+	if err == nil || !strings.Contains(err.Error(), `did you mean "default_temperature"`) {
+		t.Errorf("expected typo error, got %v", err)
+	}
+}
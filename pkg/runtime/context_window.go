@@ -0,0 +1,435 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ContextStrategy is how the context manager fits a file() input that is
+// too large for the context window of the model it is sent to.
+type ContextStrategy string
+
+const (
+	// ContextHead keeps the beginning of the file
+	ContextHead ContextStrategy = "head"
+
+	// ContextTail keeps the end of the file, such as the latest log lines
+	ContextTail ContextStrategy = "tail"
+
+	// ContextSummarize splits the file into chunks and sends an agent's
+	// summaries of them instead
+	ContextSummarize ContextStrategy = "summarize"
+)
+
+// DefaultContextReserve is the number of tokens of a context window the
+// context manager keeps free for the system prompt, the rest of the prompt,
+// and the response.
+const DefaultContextReserve = 4096
+
+// DefaultContextWindows holds the context window sizes, in tokens, that
+// file() inputs are fit to. Models are matched by the longest key that
+// prefixes the model name; agents of other models can set
+// `context_window`.
+var DefaultContextWindows = map[string]int{
+	"claude":         200000,
+	"gpt-4o":         128000,
+	"gpt-4.1":        1047576,
+	"gpt-4-turbo":    128000,
+	"gpt-4":          8192,
+	"gpt-3.5-turbo":  16385,
+	"o1":             200000,
+	"o3":             200000,
+	"o4-mini":        200000,
+	"gemini-2.5":     1048576,
+	"gemini-2.0":     1048576,
+	"gemini-1.5-pro": 2097152,
+}
+
+// ContextWindowConfig configures the context manager (see
+// WithContextWindow).
+type ContextWindowConfig struct {
+	// Strategy fits oversized file() inputs; ContextHead if empty. Intents
+	// and steps can choose their own with `context_strategy`.
+	Strategy ContextStrategy
+
+	// SummaryAgent writes the summaries of ContextSummarize; the agent of
+	// the intent or step if empty
+	SummaryAgent string
+
+	// Reserve is the number of tokens of each context window kept free;
+	// DefaultContextReserve if 0
+	Reserve int
+}
+
+// WithContextWindow fits the file() inputs of each prompt into the context
+// window of the agent's model, less a reserve, by truncating or summarizing
+// the files that do not fit. With fallback models, inputs fit the smallest
+// window. Models without a known window are sent whole.
+// ExecutionResult.ContextWarnings lists the files that were cut down, and
+// the summaries' usage counts towards the result's TokensUsed.
+func WithContextWindow(cfg ContextWindowConfig) Option {
+	return func(r *Runtime) {
+		r.contextWindow = &cfg
+	}
+}
+
+// ContextWarning reports a file() input that was cut down to fit a model's
+// context window.
+type ContextWarning struct {
+	// Step is the pipeline step whose prompt included the file, if any
+	Step string `json:"step,omitempty"`
+
+	File     string          `json:"file"`
+	Model    string          `json:"model"`
+	Strategy ContextStrategy `json:"strategy"`
+
+	// Tokens is the size of the file, and Kept the size of what was sent
+	Tokens int `json:"tokens"`
+	Kept   int `json:"kept"`
+}
+
+// tokenizer estimates the token counts of a family of model tokenizers.
+type tokenizer struct {
+	// charsPerToken is the number of ASCII characters a token covers, on
+	// average, within a word
+	charsPerToken float64
+}
+
+var (
+	cl100k       = tokenizer{charsPerToken: 6}
+	o200k        = tokenizer{charsPerToken: 7}
+	claudeTokens = tokenizer{charsPerToken: 5}
+	geminiTokens = tokenizer{charsPerToken: 6}
+)
+
+// modelTokenizers maps model name prefixes to their tokenizers, matched
+// like DefaultContextWindows.
+var modelTokenizers = map[string]tokenizer{
+	"gpt-4o":        o200k,
+	"gpt-4.1":       o200k,
+	"gpt-4.5":       o200k,
+	"gpt-5":         o200k,
+	"o1":            o200k,
+	"o3":            o200k,
+	"o4":            o200k,
+	"gpt-4":         cl100k,
+	"gpt-3.5-turbo": cl100k,
+	"claude":        claudeTokens,
+	"gemini":        geminiTokens,
+}
+
+// pretokenPattern splits text the way tiktoken's cl100k_base does before
+// encoding each piece, without its lookahead for trailing whitespace.
+var pretokenPattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// CountTokens estimates the number of tokens text takes up in a prompt to
+// model. For OpenAI, Anthropic, and Gemini models it splits text the way
+// tiktoken does and counts the pieces, which approximates tiktoken without
+// its vocabularies; for other models it counts about four bytes per token.
+func CountTokens(model, text string) int {
+	t, ok := lookupByPrefix(modelTokenizers, model)
+	if !ok {
+		return estimateTokens(text)
+	}
+	n := 0
+	for _, piece := range pretokenPattern.FindAllString(text, -1) {
+		n += t.pieceTokens(piece)
+	}
+	return n
+}
+
+// pieceTokens estimates the tokens of a piece of pretokenized text. Most
+// non-ASCII characters are a token of their own.
+func (t tokenizer) pieceTokens(piece string) int {
+	var n float64
+	for _, c := range piece {
+		if c >= utf8.RuneSelf {
+			n++
+		} else {
+			n += 1 / t.charsPerToken
+		}
+	}
+	return max(1, int(math.Ceil(n)))
+}
+
+// truncateTokens returns the longest start of text, or end if tail is set,
+// that takes up at most limit tokens of model, cut at a line break if it
+// keeps any.
+func truncateTokens(model, text string, limit int, tail bool) string {
+	cut := 0 // bytes to keep
+	if t, ok := lookupByPrefix(modelTokenizers, model); ok {
+		pieces := pretokenPattern.FindAllStringIndex(text, -1)
+		if tail {
+			slices.Reverse(pieces)
+		}
+		used := 0
+		for _, p := range pieces {
+			if used += t.pieceTokens(text[p[0]:p[1]]); used > limit {
+				break
+			}
+			cut += p[1] - p[0]
+		}
+	} else {
+		cut = min(len(text), limit*4)
+	}
+
+	if tail {
+		start := len(text) - cut
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		if i := strings.IndexByte(text[start:], '\n'); i >= 0 && start > 0 && text[start-1] != '\n' && start+i+1 < len(text) {
+			start += i + 1
+		}
+		return text[start:]
+	}
+	for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if i := strings.LastIndexByte(text[:cut], '\n'); i > 0 && cut < len(text) {
+		cut = i + 1
+	}
+	return text[:cut]
+}
+
+// lookupByPrefix returns the value of the longest key of m that prefixes
+// model.
+func lookupByPrefix[V any](m map[string]V, model string) (V, bool) {
+	best := ""
+	for prefix := range m {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	v, ok := m[best]
+	return v, ok && best != ""
+}
+
+// contextMarkerTokens is the most the notes of truncatedHead and
+// truncatedTail take up.
+const contextMarkerTokens = 16
+
+// contextBudget is what is left of a model's context window for the file()
+// inputs of one prompt.
+type contextBudget struct {
+	ctx       *ExecutionContext
+	agent     ast.Entity
+	step      string
+	model     string
+	strategy  ContextStrategy
+	remaining int
+}
+
+// newContextBudget returns the budget for the file() inputs of the prompt of
+// entity, an intent or step, to agent, or nil if the runtime does not manage
+// context windows or the agent's window is unknown.
+func (r *Runtime) newContextBudget(ctx *ExecutionContext, entity, agent ast.Entity, step string) (*contextBudget, error) {
+	if r.contextWindow == nil {
+		return nil, nil
+	}
+	strategy := r.contextWindow.Strategy
+	if s := propertyString(entity, "context_strategy"); s != "" {
+		strategy = ContextStrategy(s)
+	}
+	switch strategy {
+	case "":
+		strategy = ContextHead
+	case ContextHead, ContextTail, ContextSummarize:
+	default:
+		return nil, fmt.Errorf("%s %q: context_strategy must be head, tail, or summarize, got %q", entity.Type(), entity.Name(), strategy)
+	}
+
+	models, _, err := r.getAgentModels(agent)
+	if err != nil {
+		return nil, err
+	}
+	window := 0
+	for _, model := range models {
+		if w := agentContextWindow(agent, model); w > 0 && (window == 0 || w < window) {
+			window = w
+		}
+	}
+	if window == 0 {
+		return nil, nil
+	}
+	return &contextBudget{
+		ctx:       ctx,
+		agent:     agent,
+		step:      step,
+		model:     models[0],
+		strategy:  strategy,
+		remaining: r.contextWindow.available(window),
+	}, nil
+}
+
+// available returns the tokens of a context window left after the reserve,
+// which is at most half of it.
+func (c *ContextWindowConfig) available(window int) int {
+	reserve := c.Reserve
+	if reserve <= 0 {
+		reserve = DefaultContextReserve
+	}
+	return window - min(reserve, window/2)
+}
+
+// agentContextWindow returns the context window of an agent's model: its
+// `context_window`, or the known window of the model, or 0.
+func agentContextWindow(agent ast.Entity, model string) int {
+	if prop, ok := agent.GetProperty("context_window"); ok {
+		if nv, ok := prop.(ast.NumberValue); ok && nv.Value > 0 {
+			return int(nv.Value)
+		}
+	}
+	window, _ := lookupByPrefix(DefaultContextWindows, model)
+	return window
+}
+
+// fit returns the content of the file at path, cut down to what is left of
+// the budget if it does not fit, and takes what it returns from the budget.
+func (b *contextBudget) fit(resolver *Resolver, path, content string) (string, error) {
+	tokens := CountTokens(b.model, content)
+	if tokens <= b.remaining {
+		b.remaining -= tokens
+		return content, nil
+	}
+
+	var fitted string
+	switch b.strategy {
+	case ContextSummarize:
+		summary, err := b.summarize(resolver, path, content)
+		if err != nil {
+			return "", err
+		}
+		fitted = summary
+		if CountTokens(b.model, summary) > b.remaining {
+			fitted = truncatedHead(b.model, summary, b.remaining)
+		}
+	case ContextTail:
+		fitted = truncatedTail(b.model, content, b.remaining)
+	default:
+		fitted = truncatedHead(b.model, content, b.remaining)
+	}
+
+	kept := CountTokens(b.model, fitted)
+	b.remaining = max(0, b.remaining-kept)
+	logAt(b.ctx.Context, slog.LevelWarn, "file input cut down to fit the context window",
+		"file", path, "model", b.model, "strategy", string(b.strategy), "tokens", tokens, "kept", kept)
+	if log, ok := b.ctx.Context.Value(contextLogKey{}).(*contextLog); ok {
+		log.warn(ContextWarning{Step: b.step, File: path, Model: b.model, Strategy: b.strategy, Tokens: tokens, Kept: kept})
+	}
+	return fitted, nil
+}
+
+// truncatedHead returns the start of text that fits limit tokens of model,
+// with a note that the rest was cut.
+func truncatedHead(model, text string, limit int) string {
+	kept := truncateTokens(model, text, max(0, limit-contextMarkerTokens), false)
+	return kept + fmt.Sprintf("\n[... %d more tokens truncated ...]", CountTokens(model, text[len(kept):]))
+}
+
+// truncatedTail returns the end of text that fits limit tokens of model,
+// with a note that the start was cut.
+func truncatedTail(model, text string, limit int) string {
+	kept := truncateTokens(model, text, max(0, limit-contextMarkerTokens), true)
+	return fmt.Sprintf("[... %d earlier tokens truncated ...]\n", CountTokens(model, text[:len(text)-len(kept)])) + kept
+}
+
+// summarize splits content into chunks that fit the context window of the
+// summary agent and returns its summaries of them.
+func (b *contextBudget) summarize(resolver *Resolver, path, content string) (string, error) {
+	agent := b.agent
+	if name := b.ctx.Runtime.contextWindow.SummaryAgent; name != "" {
+		var err error
+		if agent, err = resolver.workspace.GetAgent(name); err != nil {
+			return "", fmt.Errorf("summarizing %s: %w", path, err)
+		}
+	}
+	systemPrompt, err := b.ctx.Runtime.getAgentSystemPrompt(agent, resolver)
+	if err != nil {
+		return "", fmt.Errorf("summarizing %s: %w", path, err)
+	}
+	provider, model, err := b.ctx.Runtime.getAgentProvider(agent)
+	if err != nil {
+		return "", fmt.Errorf("summarizing %s: %w", path, err)
+	}
+
+	// Chunks leave the reserve for the instructions and the summary
+	chunkTokens := b.remaining
+	if window := agentContextWindow(agent, model); window > 0 {
+		chunkTokens = b.ctx.Runtime.contextWindow.available(window)
+	}
+	var chunks []string
+	for rest := content; rest != ""; {
+		chunk := truncateTokens(model, rest, chunkTokens, false)
+		if chunk == "" {
+			_, size := utf8.DecodeRuneInString(rest)
+			chunk = rest[:size]
+		}
+		chunks = append(chunks, chunk)
+		rest = rest[len(chunk):]
+	}
+
+	log, _ := b.ctx.Context.Value(contextLogKey{}).(*contextLog)
+	summaries := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		prompt := fmt.Sprintf("Summarize part %d of %d of the file %s. Keep the facts, names, and numbers a reader of the whole file would need.\n\n%s", i+1, len(chunks), path, chunk)
+		resp, err := provider.Complete(b.ctx.Context, &CompletionRequest{
+			Model:        model,
+			SystemPrompt: systemPrompt,
+			Messages:     []Message{{Role: RoleUser, Content: prompt}},
+			Temperature:  0,
+		})
+		if err != nil {
+			return "", fmt.Errorf("summarizing %s: %w", path, err)
+		}
+		b.ctx.addTokens(resp.Usage)
+		if log != nil {
+			log.addUsage(resp.Usage)
+		}
+		summaries[i] = resp.Content
+	}
+	return strings.Join(summaries, "\n\n"), nil
+}
+
+// contextLog collects the ContextWarnings of an execution and the usage of
+// its summaries.
+type contextLog struct {
+	mu       sync.Mutex
+	warnings []ContextWarning
+	usage    TokenUsage
+}
+
+// contextLogKey is the context key of the contextLog of an execution.
+type contextLogKey struct{}
+
+func withContextLog(ctx context.Context, log *contextLog) context.Context {
+	return context.WithValue(ctx, contextLogKey{}, log)
+}
+
+func (l *contextLog) warn(w ContextWarning) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, w)
+}
+
+func (l *contextLog) addUsage(usage TokenUsage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.usage.Add(usage)
+}
+
+// result returns what was recorded so far.
+func (l *contextLog) result() ([]ContextWarning, TokenUsage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.warnings), l.usage
+}
@@ -0,0 +1,191 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{model: "gpt-4o", text: "Hello, world!", want: 4},
+		{model: "gpt-4o", text: "", want: 0},
+		{model: "claude-sonnet-4-20250514", text: "It's 2025.", want: 6},
+		{model: "gpt-4", text: "日本語", want: 3},
+		{model: "mock-model", text: "twelve bytes", want: 3},
+	}
+	for _, tt := range tests {
+		if got := CountTokens(tt.model, tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q, %q) = %d, want %d", tt.model, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateTokens(t *testing.T) {
+	text := "first line\nsecond line\nthird line\n"
+
+	if got := truncateTokens("gpt-4o", text, 6, false); got != "first line\nsecond line\n" {
+		t.Errorf("head = %q, want the whole lines that fit", got)
+	}
+	if got := truncateTokens("gpt-4o", text, 6, true); got != "second line\nthird line\n" {
+		t.Errorf("tail = %q, want the whole lines that fit", got)
+	}
+	if got := truncateTokens("gpt-4o", text, 100, false); got != text {
+		t.Errorf("expected text that fits to be kept whole, got %q", got)
+	}
+	if got := truncateTokens("mock-model", "ab\ncdef", 1, false); got != "ab\n" {
+		t.Errorf("head of an unknown model = %q, want four bytes cut at the line break", got)
+	}
+}
+
+// writeLines writes a file of n numbered lines of 8 bytes, 2 tokens each
+// to models without a known tokenizer, and returns its path.
+func writeLines(t *testing.T, n int) string {
+	t.Helper()
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %02d\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.ToSlash(path)
+}
+
+func TestContextWindow(t *testing.T) {
+	path := writeLines(t, 50)
+	source := fmt.Sprintf(`
+agent "reader" {
+	model: "mock-model"
+	context_window: 100
+}
+
+intent "read" {
+	use: agent("reader")
+	input: file(%[1]q)
+}
+
+pipeline "triage" {
+	step "latest" {
+		use: agent("reader")
+		input: file(%[1]q)
+		context_strategy: "tail"
+	}
+}
+`, path)
+
+	newRuntime := func(cfg *ContextWindowConfig, responses ...MockResponse) (*Runtime, *MockProvider) {
+		ws := workspace.New()
+		addEntities(t, ws, parseSource(t, source))
+		provider := NewMockProvider(WithMockResponses(responses...))
+		opts := []Option{WithProvider("mock", provider)}
+		if cfg != nil {
+			opts = append(opts, WithContextWindow(*cfg))
+		}
+		return New(ws, opts...), provider
+	}
+
+	t.Run("head", func(t *testing.T) {
+		rt, provider := newRuntime(&ContextWindowConfig{})
+		result, err := rt.ExecuteByName(context.Background(), "intent", "read")
+		if err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		prompt := provider.GetRequests()[0].Messages[0].Content
+		if !strings.Contains(prompt, "line 01\n") || strings.Contains(prompt, "line 50") || !strings.Contains(prompt, "more tokens truncated") {
+			t.Errorf("expected the start of the file, got %q", prompt)
+		}
+		if len(result.ContextWarnings) != 1 {
+			t.Fatalf("expected a warning, got %+v", result.ContextWarnings)
+		}
+		if w := result.ContextWarnings[0]; w.File != path || w.Strategy != ContextHead || w.Tokens != 100 || w.Kept > 50 {
+			t.Errorf("unexpected warning %+v", w)
+		}
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		rt, provider := newRuntime(&ContextWindowConfig{})
+		result, err := rt.ExecuteByName(context.Background(), "pipeline", "triage")
+		if err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		prompt := provider.GetRequests()[0].Messages[0].Content
+		if strings.Contains(prompt, "line 01") || !strings.Contains(prompt, "line 50\n") || !strings.Contains(prompt, "earlier tokens truncated") {
+			t.Errorf("expected the end of the file, got %q", prompt)
+		}
+		if len(result.ContextWarnings) != 1 || result.ContextWarnings[0].Step != "latest" {
+			t.Errorf("expected a warning for step latest, got %+v", result.ContextWarnings)
+		}
+	})
+
+	t.Run("summarize", func(t *testing.T) {
+		rt, provider := newRuntime(&ContextWindowConfig{Strategy: ContextSummarize},
+			MockResponse{Content: "first half", Usage: TokenUsage{InputTokens: 10, OutputTokens: 2}},
+			MockResponse{Content: "second half", Usage: TokenUsage{InputTokens: 10, OutputTokens: 2}},
+			MockResponse{Content: "answer", Usage: TokenUsage{InputTokens: 5, OutputTokens: 1}},
+		)
+		result, err := rt.ExecuteByName(context.Background(), "intent", "read")
+		if err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		requests := provider.GetRequests()
+		if len(requests) != 3 {
+			t.Fatalf("expected two summaries and the answer, got %d requests", len(requests))
+		}
+		if chunk := requests[1].Messages[0].Content; !strings.Contains(chunk, "part 2 of 2") || !strings.Contains(chunk, "line 50") {
+			t.Errorf("expected the second chunk to end the file, got %q", chunk)
+		}
+		if prompt := requests[2].Messages[0].Content; !strings.Contains(prompt, "first half\n\nsecond half") {
+			t.Errorf("expected the summaries in the prompt, got %q", prompt)
+		}
+		if result.TokensUsed.InputTokens != 25 {
+			t.Errorf("expected the summaries' usage to count, got %+v", result.TokensUsed)
+		}
+		if len(result.ContextWarnings) != 1 || result.ContextWarnings[0].Strategy != ContextSummarize {
+			t.Errorf("expected a summarize warning, got %+v", result.ContextWarnings)
+		}
+	})
+
+	t.Run("unmanaged", func(t *testing.T) {
+		rt, provider := newRuntime(nil)
+		result, err := rt.ExecuteByName(context.Background(), "intent", "read")
+		if err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		if prompt := provider.GetRequests()[0].Messages[0].Content; !strings.Contains(prompt, "line 01") || !strings.Contains(prompt, "line 50") {
+			t.Errorf("expected the whole file without a context manager, got %q", prompt)
+		}
+		if len(result.ContextWarnings) != 0 {
+			t.Errorf("expected no warnings, got %+v", result.ContextWarnings)
+		}
+	})
+}
+
+func TestContextWindow_InvalidStrategy(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "reader" {
+	model: "gpt-4o"
+}
+
+intent "read" {
+	use: agent("reader")
+	input: "text"
+	context_strategy: "middle"
+}
+`))
+	rt := New(ws, WithProvider("mock", NewMockProvider()), WithContextWindow(ContextWindowConfig{}))
+	if _, err := rt.ExecuteByName(context.Background(), "intent", "read"); err == nil || !strings.Contains(err.Error(), "context_strategy") {
+		t.Errorf("expected an invalid context_strategy error, got %v", err)
+	}
+}
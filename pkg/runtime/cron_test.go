@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	base := time.Date(2025, time.January, 15, 10, 30, 0, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2025, 1, 16, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * MON", time.Date(2025, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 10 15 * *", time.Date(2025, 2, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 JAN,JUL *", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 0", time.Date(2025, 1, 19, 12, 0, 0, 0, time.UTC)}, // day 1 OR Sunday
+		{"0 12 * * 7", time.Date(2025, 1, 19, 12, 0, 0, 0, time.UTC)}, // 7 is Sunday
+		{"@hourly", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCronSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCronSchedule error: %v", err)
+			}
+			if got := s.Next(base); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	s, err := ParseCronSchedule("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	next := s.Next(now.In(loc))
+	if want := time.Date(2025, 1, 16, 7, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next() = %v, want %v", next.UTC(), want)
+	}
+
+	// 02:00 does not exist on the spring-forward day, so that run is skipped
+	spring := time.Date(2025, time.March, 9, 0, 0, 0, 0, loc)
+	if next := s.Next(spring); next.Day() != 10 || next.Hour() != 2 {
+		t.Errorf("expected next run at 02:00 the day after DST change, got %v", next)
+	}
+
+	// 01:30 occurs twice on the fall-back day; Next still moves forward
+	s, err = ParseCronSchedule("30 1 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.Next(time.Date(2025, time.November, 2, 0, 0, 0, 0, loc))
+	if first.Day() != 2 || first.Hour() != 1 || first.Minute() != 30 {
+		t.Errorf("unexpected first fall-back run %v", first)
+	}
+	if second := s.Next(first); !second.After(first) {
+		t.Errorf("Next(%v) = %v, want a later time", first, second)
+	}
+}
+
+func TestParseCronSchedule_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * FOO *",
+	} {
+		if _, err := ParseCronSchedule(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
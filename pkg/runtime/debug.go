@@ -0,0 +1,274 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ErrDebugStopped is the error of an execution a debugger stopped.
+var ErrDebugStopped = errors.New("stopped by debugger")
+
+// DebugAction tells an execution paused by a debugger how to go on.
+type DebugAction string
+
+const (
+	// DebugContinue runs the step and the ones after it until the next
+	// breakpoint
+	DebugContinue DebugAction = "continue"
+
+	// DebugStep runs the step and pauses before the next one
+	DebugStep DebugAction = "step"
+
+	// DebugSkip does not run the step; its output is whatever the debugger
+	// set with DebugFrame.SetStepOutput, or null. The execution pauses
+	// before the next step.
+	DebugSkip DebugAction = "skip"
+
+	// DebugStop stops the execution with ErrDebugStopped
+	DebugStop DebugAction = "stop"
+)
+
+// Debugger controls the execution of a pipeline step by step (see
+// WithDebugger).
+type Debugger interface {
+	// BeforeStep is called before each step of the pipeline and blocks
+	// the execution until it returns how to go on. To the execution,
+	// DebugContinue and DebugStep both run the step; the difference is
+	// for the debugger to keep.
+	BeforeStep(frame *DebugFrame) DebugAction
+}
+
+// WithDebugger runs an execution under a debugger, which is asked before
+// every step of the pipeline whether to run it. Time spent paused counts
+// toward the execution's timeout, so debug without one.
+//
+// Only the pipeline's own steps pause: those of parallel, branch, and loop
+// blocks run as executions of their own.
+func WithDebugger(d Debugger) ExecuteOption {
+	return func(o *executeOptions) {
+		o.debugger = d
+	}
+}
+
+// DebugFrame is the state of an execution paused before a step. Its
+// snapshot and input are for reading; changes to the execution go through
+// SetVariable and SetStepOutput, which work only until the debugger
+// returns.
+type DebugFrame struct {
+	// Pipeline is the name of the pipeline executing
+	Pipeline string `json:"pipeline"`
+
+	// Step is the name of the step about to run, and Line and Column its
+	// location in its source file
+	Step   string `json:"step"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+
+	// Index is the step's position in the pipeline from 1, of Total steps
+	Index int `json:"index"`
+	Total int `json:"total"`
+
+	// Input is the step's `input`, resolved, or nil if it has none.
+	// InputError is why it could not be resolved, if it could not.
+	Input      interface{} `json:"input,omitempty"`
+	InputError string      `json:"input_error,omitempty"`
+
+	// Snapshot is the state of the execution before the step
+	Snapshot ExecutionSnapshot `json:"snapshot"`
+
+	mu   sync.Mutex
+	ctx  *ExecutionContext
+	done bool
+}
+
+// SetVariable sets a variable of the paused execution, such as "input".
+func (f *DebugFrame) SetVariable(name string, value interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return fmt.Errorf("execution is no longer paused at step %q", f.Step)
+	}
+	f.ctx.SetVariable(name, value)
+	f.Snapshot.Variables[name] = value
+	return nil
+}
+
+// SetStepOutput sets the output of a step of the paused execution, as if
+// the step had returned it: that of an earlier step to change what later
+// steps see, or that of the paused step to skip it with that output.
+func (f *DebugFrame) SetStepOutput(step string, output interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return fmt.Errorf("execution is no longer paused at step %q", f.Step)
+	}
+	f.ctx.SetStepOutput(step, output)
+	f.ctx.SetStepOutput(step+".output", output)
+	f.Snapshot.StepOutputs[step] = output
+	f.Snapshot.StepOutputs[step+".output"] = output
+	return nil
+}
+
+// resume ends the frame's pause; later changes are rejected.
+func (f *DebugFrame) resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = true
+}
+
+// debugStep asks the execution's debugger, if any, how to go on before a
+// step of a pipeline.
+func (ec *ExecutionContext) debugStep(pipeline string, step *ast.StepEntity, resolver *Resolver, index, total int) DebugAction {
+	if ec.debugger == nil {
+		return DebugContinue
+	}
+	frame := &DebugFrame{
+		Pipeline: pipeline,
+		Step:     step.Name(),
+		Line:     step.Line(),
+		Column:   step.Column(),
+		Index:    index,
+		Total:    total,
+		Snapshot: ec.Snapshot(),
+		ctx:      ec,
+	}
+	if inputProp, ok := step.GetProperty("input"); ok {
+		input, err := resolver.Resolve(inputProp)
+		if err != nil {
+			frame.InputError = err.Error()
+		}
+		frame.Input = input
+	}
+	defer frame.resume()
+	return ec.debugger.BeforeStep(frame)
+}
+
+// skipStep records a step a debugger skipped.
+func (ec *ExecutionContext) skipStep(step *ast.StepEntity) *StepResult {
+	output, ok := ec.GetStepOutput(step.Name())
+	if !ok {
+		ec.SetStepOutput(step.Name(), nil)
+		ec.SetStepOutput(step.Name()+".output", nil)
+	}
+	now := time.Now()
+	return &StepResult{
+		Name:      step.Name(),
+		Success:   true,
+		Status:    StepSkipped,
+		Output:    output,
+		StartTime: now,
+		EndTime:   now,
+	}
+}
+
+// DebugSession is a Debugger driven from another goroutine, such as a
+// terminal prompt or an editor's debug adapter. It pauses at breakpoints,
+// after Pause, and, after DebugStep or DebugSkip, before the next step.
+// Every step it sees is kept in its history, so the state before any
+// earlier step can be inspected.
+//
+//	session := runtime.NewDebugSession()
+//	session.Pause() // before the first step
+//	go func() {
+//	    for frame := range session.Paused() {
+//	        fmt.Println("paused before", frame.Step)
+//	        session.Resume(runtime.DebugStep)
+//	    }
+//	}()
+//	rt.Execute(ctx, pipeline, runtime.WithDebugger(session))
+//	session.Close()
+type DebugSession struct {
+	mu          sync.Mutex
+	breakpoints map[string]bool
+	stepping    bool
+	history     []*DebugFrame
+
+	paused  chan *DebugFrame
+	actions chan DebugAction
+}
+
+// NewDebugSession creates a DebugSession that pauses at the given steps.
+func NewDebugSession(breakpoints ...string) *DebugSession {
+	s := &DebugSession{
+		paused:  make(chan *DebugFrame),
+		actions: make(chan DebugAction),
+	}
+	s.SetBreakpoints(breakpoints...)
+	return s
+}
+
+// Pause makes the session pause before the next step, breakpoint or not.
+func (s *DebugSession) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stepping = true
+}
+
+// SetBreakpoints replaces the steps the session pauses at.
+func (s *DebugSession) SetBreakpoints(steps ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = make(map[string]bool, len(steps))
+	for _, step := range steps {
+		s.breakpoints[step] = true
+	}
+}
+
+// Breakpoints returns the steps the session pauses at.
+func (s *DebugSession) Breakpoints() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steps := make([]string, 0, len(s.breakpoints))
+	for step := range s.breakpoints {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	return steps
+}
+
+// Paused receives the frame of every pause. The execution waits until
+// Resume is called. The channel is closed by Close.
+func (s *DebugSession) Paused() <-chan *DebugFrame {
+	return s.paused
+}
+
+// Resume tells the paused execution how to go on.
+func (s *DebugSession) Resume(action DebugAction) {
+	s.actions <- action
+}
+
+// Close closes Paused, once the execution has ended.
+func (s *DebugSession) Close() {
+	close(s.paused)
+}
+
+// History returns the frames of every step the session has seen, in
+// order, including those it did not pause at.
+func (s *DebugSession) History() []*DebugFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*DebugFrame(nil), s.history...)
+}
+
+// BeforeStep implements Debugger.
+func (s *DebugSession) BeforeStep(frame *DebugFrame) DebugAction {
+	s.mu.Lock()
+	s.history = append(s.history, frame)
+	pause := s.stepping || s.breakpoints[frame.Step]
+	s.mu.Unlock()
+	if !pause {
+		return DebugContinue
+	}
+
+	s.paused <- frame
+	action := <-s.actions
+	s.mu.Lock()
+	s.stepping = action == DebugStep || action == DebugSkip
+	s.mu.Unlock()
+	return action
+}
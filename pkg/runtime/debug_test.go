@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const debugPipeline = `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "draft" {
+	step "outline" {
+		use: agent("writer")
+		input: $input
+	}
+	step "write" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+	step "polish" {
+		use: agent("writer")
+		input: step("write").output
+	}
+}
+`
+
+// scriptedDebugger answers the pauses of a session in turn. The func it
+// returns ends the session and returns the steps it paused at.
+func scriptedDebugger(t *testing.T, session *DebugSession, answers ...func(*DebugFrame) DebugAction) (done func() []string) {
+	var paused []string
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for frame := range session.Paused() {
+			paused = append(paused, frame.Step)
+			if len(answers) == 0 {
+				t.Errorf("unexpected pause at step %q", frame.Step)
+				session.Resume(DebugStop)
+				continue
+			}
+			session.Resume(answers[0](frame))
+			answers = answers[1:]
+		}
+	}()
+	return func() []string {
+		session.Close()
+		<-finished
+		return paused
+	}
+}
+
+func TestDebugSession(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, debugPipeline))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "final"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	session := NewDebugSession()
+	session.Pause()
+	done := scriptedDebugger(t, session,
+		func(f *DebugFrame) DebugAction {
+			if f.Index != 1 || f.Total != 3 || f.Input != "topic" || f.Line == 0 {
+				t.Errorf("unexpected first frame %+v", f)
+			}
+			if err := f.SetStepOutput("outline", "my outline"); err != nil {
+				t.Error(err)
+			}
+			return DebugSkip
+		},
+		func(f *DebugFrame) DebugAction {
+			if f.Input != "my outline" {
+				t.Errorf("expected the input of the skipped step's output, got %v", f.Input)
+			}
+			if err := f.SetStepOutput("write", "draft"); err != nil {
+				t.Error(err)
+			}
+			session.SetBreakpoints("missing")
+			return DebugSkip
+		},
+		func(f *DebugFrame) DebugAction {
+			if err := f.SetVariable("tone", "formal"); err != nil {
+				t.Error(err)
+			}
+			return DebugContinue
+		},
+	)
+
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "draft", WithInput("topic"), WithDebugger(session))
+	paused := done()
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if want := []string{"outline", "write", "polish"}; !reflect.DeepEqual(paused, want) {
+		t.Errorf("paused at %v, want %v", paused, want)
+	}
+	if result.Output != "final" || len(provider.GetRequests()) != 1 {
+		t.Errorf("expected only the last step to run, got %v after %d calls", result.Output, len(provider.GetRequests()))
+	}
+	if got := provider.GetRequests()[0].Messages[0].Content; got != "## Input\n\ndraft" {
+		t.Errorf("expected the last step to see the edited output, got %q", got)
+	}
+	if outline := result.StepResults["outline"]; outline.Status != StepSkipped || outline.Output != "my outline" {
+		t.Errorf("expected a skipped step with the set output, got %+v", outline)
+	}
+
+	history := session.History()
+	if len(history) != 3 || history[2].Snapshot.Variables["tone"] != "formal" {
+		t.Errorf("expected the history of every step, got %d frames", len(history))
+	}
+	if err := history[0].SetVariable("x", 1); err == nil {
+		t.Error("expected edits after resuming to fail")
+	}
+}
+
+func TestDebugSessionBreakpoints(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, debugPipeline))
+	rt := New(ws, WithProvider("mock", NewMockProvider()))
+
+	session := NewDebugSession("write")
+	done := scriptedDebugger(t, session,
+		func(f *DebugFrame) DebugAction { return DebugStep },
+		func(f *DebugFrame) DebugAction { return DebugStop },
+	)
+
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "draft", WithInput("topic"), WithDebugger(session))
+	paused := done()
+	if !errors.Is(err, ErrDebugStopped) {
+		t.Fatalf("expected the debugger to stop the execution, got %v", err)
+	}
+	if want := []string{"write", "polish"}; !reflect.DeepEqual(paused, want) {
+		t.Errorf("paused at %v, want %v", paused, want)
+	}
+	if _, ran := result.StepResults["polish"]; ran || len(result.StepResults) != 2 {
+		t.Errorf("expected the execution to stop before polish, got %v", result.StepResults)
+	}
+	if len(session.History()) != 3 {
+		t.Errorf("expected the history to include steps run without pausing, got %d frames", len(session.History()))
+	}
+}
@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// deterministicSeed is the seed deterministic executions send to providers
+// that support one.
+const deterministicSeed = 1
+
+// Sources of nondeterminism that deterministic executions record.
+const (
+	// NondeterminismUnseeded is a request to a provider that ignores seeds
+	NondeterminismUnseeded = "unseeded"
+
+	// NondeterminismReasoning is a request with extended thinking, which
+	// providers sample at their own temperature
+	NondeterminismReasoning = "reasoning"
+
+	// NondeterminismTools is a request whose agent can call tools, whose
+	// results may change between runs
+	NondeterminismTools = "tools"
+
+	// NondeterminismFallback is a request served by a fallback model
+	NondeterminismFallback = "fallback"
+)
+
+// Nondeterminism is a way the result of a deterministic execution may still
+// differ between runs (see WithDeterministic).
+type Nondeterminism struct {
+	// Source is what may vary, such as NondeterminismUnseeded
+	Source string `json:"source"`
+
+	// Step is the pipeline step it affects, if any
+	Step string `json:"step,omitempty"`
+
+	// Detail describes it
+	Detail string `json:"detail"`
+}
+
+// WithDeterministic makes executions as repeatable as providers allow, for
+// regression tests of pipelines. Requests are sent at temperature 0, with a
+// fixed seed to providers that support one, and steps ignore their
+// self-consistency sampling. ExecutionResult.Nondeterminism lists what may
+// still vary.
+func WithDeterministic() Option {
+	return func(r *Runtime) {
+		r.deterministic = true
+	}
+}
+
+// seedSupporter is implemented by providers that sample repeatably given a
+// seed.
+type seedSupporter interface {
+	SupportsSeed() bool
+}
+
+// makeDeterministic sets req to temperature 0 and the fixed seed, if the
+// runtime is deterministic.
+func (r *Runtime) makeDeterministic(req *CompletionRequest) {
+	if !r.deterministic {
+		return
+	}
+	seed := deterministicSeed
+	req.Temperature = 0
+	req.Seed = &seed
+}
+
+// noteNondeterminism records what may make a request of agent vary between
+// runs, if the runtime is deterministic. step is the pipeline step that sent
+// it, if any, model the agent's model, and served the model that answered.
+func (r *Runtime) noteNondeterminism(ctx context.Context, step string, agent ast.Entity, req *CompletionRequest, model, served string) {
+	log, ok := ctx.Value(nondeterminismLogKey{}).(*nondeterminismLog)
+	if !r.deterministic || !ok {
+		return
+	}
+	if !r.supportsSeed(agent, served) {
+		log.add(Nondeterminism{Source: NondeterminismUnseeded, Step: step, Detail: fmt.Sprintf("the provider of model %q ignores seeds", served)})
+	}
+	if req.ReasoningBudget > 0 {
+		log.add(Nondeterminism{Source: NondeterminismReasoning, Step: step, Detail: fmt.Sprintf("agent %q thinks before answering", agent.Name())})
+	}
+	if len(req.Tools) > 0 {
+		log.add(Nondeterminism{Source: NondeterminismTools, Step: step, Detail: fmt.Sprintf("agent %q can call tools", agent.Name())})
+	}
+	if served != model {
+		log.add(Nondeterminism{Source: NondeterminismFallback, Step: step, Detail: fmt.Sprintf("model %q served instead of %q", served, model)})
+	}
+}
+
+// supportsSeed reports whether the provider serving model for agent
+// supports seeds.
+func (r *Runtime) supportsSeed(agent ast.Entity, model string) bool {
+	var p LLMProvider
+	if name := propertyString(agent, "provider"); name != "" {
+		p, _ = r.GetProvider(name)
+	} else {
+		_, p, _ = r.lookupProvider(model)
+	}
+	s, ok := p.(seedSupporter)
+	return ok && s.SupportsSeed()
+}
+
+// nondeterminismLog collects the Nondeterminism of an execution.
+type nondeterminismLog struct {
+	mu      sync.Mutex
+	entries []Nondeterminism
+}
+
+// nondeterminismLogKey is the context key of the nondeterminismLog of an
+// execution.
+type nondeterminismLogKey struct{}
+
+func withNondeterminismLog(ctx context.Context, log *nondeterminismLog) context.Context {
+	return context.WithValue(ctx, nondeterminismLogKey{}, log)
+}
+
+// add records n, unless it is recorded already.
+func (l *nondeterminismLog) add(n Nondeterminism) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !slices.Contains(l.entries, n) {
+		l.entries = append(l.entries, n)
+	}
+}
+
+// Entries returns what was recorded so far.
+func (l *nondeterminismLog) Entries() []Nondeterminism {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.entries)
+}
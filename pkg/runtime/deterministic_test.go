@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecute_Deterministic(t *testing.T) {
+	source := `
+agent "solver" {
+	model: "mock-model"
+	temperature: 0.8
+}
+
+pipeline "vote" {
+	step "answer" {
+		use: agent("solver")
+		prompt: "What is 6 * 7?"
+		samples: 5
+		aggregate: "majority"
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "42"}))
+	rt := New(ws, WithProvider("mock", provider), WithDeterministic())
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "vote")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	requests := provider.GetRequests()
+	if len(requests) != 1 {
+		t.Fatalf("expected sampling to be off and 1 request, got %d", len(requests))
+	}
+	if req := requests[0]; req.Temperature != 0 || req.Seed == nil || *req.Seed != deterministicSeed {
+		t.Errorf("expected temperature 0 and seed %d, got %v and %v", deterministicSeed, req.Temperature, req.Seed)
+	}
+	if len(result.StepResults["answer"].Samples) != 0 {
+		t.Errorf("expected no samples, got %d", len(result.StepResults["answer"].Samples))
+	}
+	if len(result.Nondeterminism) != 0 {
+		t.Errorf("expected nothing to vary, got %+v", result.Nondeterminism)
+	}
+}
+
+func TestExecute_NotDeterministic(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+	temperature: 0.8
+}
+
+intent "write" {
+	use: agent("writer")
+}
+`))
+	provider := NewMockProvider()
+	rt := New(ws, WithProvider("mock", provider))
+
+	intent, _ := ws.GetEntityByName("intent", "write")
+	result, err := rt.Execute(context.Background(), intent)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if req := provider.LastRequest(); req.Temperature != 0.8 || req.Seed != nil {
+		t.Errorf("expected the agent's temperature and no seed, got %v and %v", req.Temperature, req.Seed)
+	}
+	if result.Nondeterminism != nil {
+		t.Errorf("expected no nondeterminism report, got %+v", result.Nondeterminism)
+	}
+}
+
+// unseededProvider is a provider that ignores seeds.
+type unseededProvider struct {
+	*MockProvider
+}
+
+func (p unseededProvider) SupportsSeed() bool {
+	return false
+}
+
+func TestExecute_DeterministicRecordsNondeterminism(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: ["primary-model", "backup-model"]
+	reasoning_budget: 1024
+	tools: [linter]
+}
+
+tool "linter" {
+	command: "echo lint"
+}
+
+pipeline "write" {
+	step "draft" {
+		use: agent("writer")
+		input: "Write"
+	}
+}
+`))
+	provider := unseededProvider{NewMockProvider(WithMockResponses(MockResponse{Error: &APIError{StatusCode: 429}}, MockResponse{Content: "ok"}))}
+	rt := New(ws, WithProvider("mock", provider), WithDeterministic())
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "write")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	var sources []string
+	for _, n := range result.Nondeterminism {
+		if n.Step != "draft" {
+			t.Errorf("expected %+v to name step draft", n)
+		}
+		sources = append(sources, n.Source)
+	}
+	want := []string{NondeterminismUnseeded, NondeterminismReasoning, NondeterminismTools, NondeterminismFallback}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("expected sources %v, got %v", want, sources)
+	}
+}
+
+func TestOpenAIProvider_SendsZeroTemperatureAndSeed(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	seed := deterministicSeed
+	p := NewOpenAIProvider(WithOpenAIAPIKey("test-key"), WithOpenAIBaseURL(server.URL))
+	if _, err := p.Complete(context.Background(), &CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		Seed:     &seed,
+	}); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if got["temperature"] != 0.0 || got["seed"] != float64(deterministicSeed) {
+		t.Errorf("expected temperature 0 and seed %d, got %v and %v", deterministicSeed, got["temperature"], got["seed"])
+	}
+}
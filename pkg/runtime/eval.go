@@ -0,0 +1,526 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// Assertions of eval cases, the keys of a case's `expect` object.
+const (
+	AssertContains    = "contains"
+	AssertNotContains = "not_contains"
+	AssertRegex       = "regex"
+	AssertJSONSchema  = "json_schema"
+	AssertGraded      = "graded"
+)
+
+// DefaultEvalRuns is how many times each case of an eval runs unless the
+// eval sets `runs`.
+const DefaultEvalRuns = 1
+
+// evalSpec describes an eval entity, a suite of cases run against an intent
+// or pipeline:
+//
+//	eval "refunds" {
+//	  target: intent("reply")
+//	  runs: 5                # per case (default 1)
+//	  pass_rate: 0.9         # least share of runs that pass (default 1)
+//	  grader: agent("judge") # grades `graded` assertions
+//
+//	  case "asks for a refund" {
+//	    input: "I want my money back"
+//	    expect: {
+//	      contains: "refund"             # or a list, all of which must appear
+//	      not_contains: ["sorry", "unfortunately"]
+//	      regex: "(?i)within \d+ days"
+//	      json_schema: { type: "object" required: ["category"] }
+//	      graded: "The reply is polite and offers a refund"
+//	    }
+//	  }
+//	}
+//
+// A case may also set `params` for the target. A run passes if the target
+// succeeds and its output passes every assertion.
+type evalSpec struct {
+	name     string
+	target   ast.Entity
+	version  string
+	runs     int
+	passRate float64
+	grader   ast.Entity
+	cases    []evalCase
+}
+
+// evalCase is a case of an eval.
+type evalCase struct {
+	name       string
+	input      ast.Value
+	params     ast.Value
+	assertions []evalAssertion
+}
+
+// evalAssertion is an assertion on the output of a case's runs.
+type evalAssertion struct {
+	kind    string
+	text    string
+	pattern *regexp.Regexp
+	schema  map[string]interface{}
+}
+
+// EvalReport is the outcome of running an eval.
+type EvalReport struct {
+	Eval string `json:"eval"`
+
+	// Target is the intent or pipeline the cases ran against, e.g.
+	// `intent "reply"`
+	Target string `json:"target"`
+
+	// Runs is how many times each case ran
+	Runs  int              `json:"runs"`
+	Cases []EvalCaseReport `json:"cases"`
+
+	// Passed and Total count the runs of every case; PassRate is their
+	// ratio, and Threshold the least pass rate the eval accepts
+	Passed    int     `json:"passed"`
+	Total     int     `json:"total"`
+	PassRate  float64 `json:"pass_rate"`
+	Threshold float64 `json:"threshold"`
+
+	// Latency is the mean duration of a run
+	Latency    time.Duration `json:"latency"`
+	TokensUsed TokenUsage    `json:"tokens_used"`
+	Cost       float64       `json:"cost"`
+}
+
+// OK reports whether the eval's pass rate reached its threshold.
+func (r *EvalReport) OK() bool {
+	return r.PassRate >= r.Threshold
+}
+
+// EvalCaseReport is the outcome of the runs of one case.
+type EvalCaseReport struct {
+	Name     string    `json:"name"`
+	Runs     []EvalRun `json:"runs"`
+	Passed   int       `json:"passed"`
+	PassRate float64   `json:"pass_rate"`
+
+	// Latency is the mean duration of a run, and MaxLatency the longest
+	Latency    time.Duration `json:"latency"`
+	MaxLatency time.Duration `json:"max_latency"`
+	TokensUsed TokenUsage    `json:"tokens_used"`
+	Cost       float64       `json:"cost"`
+}
+
+// EvalRun is one run of a case.
+type EvalRun struct {
+	Passed bool   `json:"passed"`
+	Output string `json:"output,omitempty"`
+
+	// Error is why the target failed, and Failures the assertions its
+	// output did not pass
+	Error    string   `json:"error,omitempty"`
+	Failures []string `json:"failures,omitempty"`
+
+	Latency time.Duration `json:"latency"`
+
+	// TokensUsed and Cost include grading the output
+	TokensUsed TokenUsage `json:"tokens_used"`
+	Cost       float64    `json:"cost"`
+}
+
+// EvalOption configures Eval.
+type EvalOption func(*evalOptions)
+
+type evalOptions struct {
+	runs     int
+	execOpts []ExecuteOption
+}
+
+// WithEvalRuns runs each case n times, overriding the eval's `runs`.
+func WithEvalRuns(n int) EvalOption {
+	return func(o *evalOptions) {
+		o.runs = n
+	}
+}
+
+// WithEvalExecuteOptions applies opts, such as WithTimeout, to every run.
+func WithEvalExecuteOptions(opts ...ExecuteOption) EvalOption {
+	return func(o *evalOptions) {
+		o.execOpts = append(o.execOpts, opts...)
+	}
+}
+
+// Eval runs each case of an eval entity against its target, one run after
+// another, and reports how many runs passed their assertions, with their
+// latency, token usage, and cost. Runs that fail are reported, not
+// returned: Eval returns an error only for an eval that is missing or
+// invalid.
+func (r *Runtime) Eval(ctx context.Context, name string, opts ...EvalOption) (*EvalReport, error) {
+	entity, found := r.workspace.GetEntityByName("eval", name)
+	if !found {
+		return nil, i18n.New(i18n.EntityNotFound, "eval", name)
+	}
+	spec, err := r.getEvalSpec(entity)
+	if err != nil {
+		return nil, err
+	}
+	var o evalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.runs > 0 {
+		spec.runs = o.runs
+	}
+
+	report := &EvalReport{
+		Eval:      spec.name,
+		Target:    fmt.Sprintf("%s %q", spec.target.Type(), spec.target.Name()),
+		Runs:      spec.runs,
+		Threshold: spec.passRate,
+	}
+	var latency time.Duration
+	for _, c := range spec.cases {
+		cr := EvalCaseReport{Name: c.name}
+		for i := 0; i < spec.runs; i++ {
+			run := r.evalRun(ctx, spec, c, o.execOpts)
+			cr.Runs = append(cr.Runs, run)
+			if run.Passed {
+				cr.Passed++
+			}
+			cr.Latency += run.Latency
+			cr.MaxLatency = max(cr.MaxLatency, run.Latency)
+			cr.TokensUsed.Add(run.TokensUsed)
+			cr.Cost += run.Cost
+		}
+		latency += cr.Latency
+		cr.Latency /= time.Duration(len(cr.Runs))
+		cr.PassRate = float64(cr.Passed) / float64(len(cr.Runs))
+
+		report.Cases = append(report.Cases, cr)
+		report.Passed += cr.Passed
+		report.Total += len(cr.Runs)
+		report.TokensUsed.Add(cr.TokensUsed)
+		report.Cost += cr.Cost
+	}
+	report.Latency = latency / time.Duration(report.Total)
+	report.PassRate = float64(report.Passed) / float64(report.Total)
+	return report, nil
+}
+
+// evalRun runs a case once and checks its output.
+func (r *Runtime) evalRun(ctx context.Context, spec *evalSpec, c evalCase, execOpts []ExecuteOption) EvalRun {
+	var run EvalRun
+	resolver := NewResolver(&ExecutionContext{
+		Context:   ctx,
+		Runtime:   r,
+		Workspace: r.workspace,
+		Variables: make(map[string]interface{}),
+	})
+
+	opts := append([]ExecuteOption{
+		WithMetadata("eval", spec.name),
+		WithMetadata("eval_case", c.name),
+	}, execOpts...)
+	if spec.version != "" {
+		opts = append(opts, WithVersion(spec.version))
+	}
+	var inputText string
+	if c.input != nil {
+		input, err := resolver.Resolve(c.input)
+		if err != nil {
+			run.Error = fmt.Sprintf("resolving input: %v", err)
+			return run
+		}
+		inputText = outputText(input)
+		opts = append(opts, WithInput(input))
+	}
+	if c.params != nil {
+		value, err := resolver.Resolve(c.params)
+		params, ok := value.(map[string]interface{})
+		if err != nil || !ok {
+			run.Error = fmt.Sprintf("case %q: 'params' must be an object", c.name)
+			return run
+		}
+		opts = append(opts, WithParams(params))
+	}
+
+	start := time.Now()
+	result, err := r.Execute(ctx, spec.target, opts...)
+	run.Latency = time.Since(start)
+	if result != nil {
+		run.TokensUsed = result.TokensUsed
+		run.Cost = ExecutionCost(result)
+		if err == nil {
+			err = result.Error
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	run.Output = outputText(result.Output)
+
+	for _, a := range c.assertions {
+		failure, err := r.checkAssertion(ctx, spec.grader, a, inputText, &run)
+		if err != nil {
+			failure = fmt.Sprintf("%s: %v", a.kind, err)
+		}
+		if failure != "" {
+			run.Failures = append(run.Failures, failure)
+		}
+	}
+	run.Passed = len(run.Failures) == 0
+	return run
+}
+
+// checkAssertion returns why the output of a run fails an assertion, or ""
+// if it passes.
+func (r *Runtime) checkAssertion(ctx context.Context, grader ast.Entity, a evalAssertion, input string, run *EvalRun) (string, error) {
+	switch a.kind {
+	case AssertContains:
+		if !strings.Contains(run.Output, a.text) {
+			return fmt.Sprintf("output does not contain %q", a.text), nil
+		}
+	case AssertNotContains:
+		if strings.Contains(run.Output, a.text) {
+			return fmt.Sprintf("output contains %q", a.text), nil
+		}
+	case AssertRegex:
+		if !a.pattern.MatchString(run.Output) {
+			return fmt.Sprintf("output does not match /%s/", a.pattern), nil
+		}
+	case AssertJSONSchema:
+		if err := validateOutput(run.Output, a.schema); err != nil {
+			return fmt.Sprintf("output does not match the JSON schema: %v", err), nil
+		}
+	case AssertGraded:
+		pass, reason, err := r.grade(ctx, grader, a.text, input, run)
+		if err != nil {
+			return "", err
+		}
+		if !pass {
+			return fmt.Sprintf("graded %q: %s", a.text, reason), nil
+		}
+	}
+	return "", nil
+}
+
+// gradePrompt asks a grader to judge an output against a criterion.
+const gradePrompt = `Grade whether the output meets the criterion. Answer PASS or FAIL on the first line, then give the reason in one sentence.
+
+## Criterion
+
+%s
+
+## Input
+
+%s
+
+## Output
+
+%s`
+
+// grade asks the grader agent whether a run's output meets a criterion,
+// adding the grader's usage to the run.
+func (r *Runtime) grade(ctx context.Context, grader ast.Entity, criterion, input string, run *EvalRun) (bool, string, error) {
+	resolver := NewResolver(&ExecutionContext{
+		Context:   ctx,
+		Runtime:   r,
+		Workspace: r.workspace,
+		Variables: make(map[string]interface{}),
+	})
+	systemPrompt, err := r.getAgentSystemPrompt(grader, resolver)
+	if err != nil {
+		return false, "", err
+	}
+	provider, model, err := r.getAgentProvider(grader)
+	if err != nil {
+		return false, "", err
+	}
+	resp, err := provider.Complete(ctx, &CompletionRequest{
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Messages:     []Message{{Role: RoleUser, Content: fmt.Sprintf(gradePrompt, criterion, input, run.Output)}},
+		Temperature:  0,
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("grading: %w", err)
+	}
+	run.TokensUsed.Add(resp.Usage)
+	cost, _ := usageCost(model, resp.Usage)
+	run.Cost += cost
+
+	verdict, reason, _ := strings.Cut(strings.TrimSpace(resp.Content), "\n")
+	verdict = strings.ToUpper(strings.TrimSpace(verdict))
+	reason = strings.TrimSpace(reason)
+	switch {
+	case strings.HasPrefix(verdict, "PASS"):
+		return true, reason, nil
+	case strings.HasPrefix(verdict, "FAIL"):
+		if reason == "" {
+			reason = "the grader failed it"
+		}
+		return false, reason, nil
+	}
+	return false, "", fmt.Errorf("grader %q answered neither PASS nor FAIL: %q", grader.Name(), verdict)
+}
+
+// getEvalSpec reads an eval entity, resolving its target and grader.
+func (r *Runtime) getEvalSpec(entity ast.Entity) (*evalSpec, error) {
+	eval, ok := entity.(*ast.EvalEntity)
+	if !ok {
+		return nil, fmt.Errorf("%s %q is not an eval", entity.Type(), entity.Name())
+	}
+	spec := &evalSpec{name: eval.Name(), runs: DefaultEvalRuns, passRate: 1}
+
+	targetProp, _ := eval.GetProperty("target")
+	ref, ok := targetProp.(ast.ReferenceValue)
+	if !ok || (ref.Type != "intent" && ref.Type != "pipeline") {
+		return nil, fmt.Errorf("eval %q: 'target' must be an intent(...) or pipeline(...) reference", eval.Name())
+	}
+	target, found := r.workspace.GetEntityByName(ref.Type, ref.Name)
+	if !found && ref.Version == "" {
+		return nil, i18n.New(i18n.EntityNotFound, ref.Type, ref.Name)
+	}
+	if !found {
+		// Only published versions of the target exist
+		target = ast.NewOpaqueEntity(ref.Type, ref.Name)
+	}
+	spec.target, spec.version = target, ref.Version
+
+	if prop, ok := eval.GetProperty("runs"); ok {
+		nv, ok := prop.(ast.NumberValue)
+		if !ok || nv.Value < 1 || nv.Value != float64(int(nv.Value)) {
+			return nil, fmt.Errorf("eval %q: 'runs' must be a whole number of at least 1", eval.Name())
+		}
+		spec.runs = int(nv.Value)
+	}
+	if prop, ok := eval.GetProperty("pass_rate"); ok {
+		nv, ok := prop.(ast.NumberValue)
+		if !ok || nv.Value < 0 || nv.Value > 1 {
+			return nil, fmt.Errorf("eval %q: 'pass_rate' must be a number from 0 to 1", eval.Name())
+		}
+		spec.passRate = nv.Value
+	}
+	if prop, ok := eval.GetProperty("grader"); ok {
+		var name string
+		switch v := prop.(type) {
+		case ast.ReferenceValue:
+			name = v.Name
+		case ast.StringValue:
+			name = v.Value
+		}
+		grader, found := r.workspace.GetEntityByName("agent", name)
+		if !found {
+			return nil, fmt.Errorf("eval %q: 'grader' must name an agent: %w", eval.Name(), i18n.New(i18n.EntityNotFound, "agent", name))
+		}
+		spec.grader = grader
+	}
+
+	if len(eval.Cases) == 0 {
+		return nil, fmt.Errorf("eval %q: %w", eval.Name(), i18n.New(i18n.MissingEvalCases))
+	}
+	for _, c := range eval.Cases {
+		ec, err := getEvalCase(c)
+		if err != nil {
+			return nil, fmt.Errorf("eval %q: %w", eval.Name(), err)
+		}
+		for _, a := range ec.assertions {
+			if a.kind == AssertGraded && spec.grader == nil {
+				return nil, fmt.Errorf("eval %q: case %q has a 'graded' assertion but the eval has no 'grader' agent", eval.Name(), c.Name())
+			}
+		}
+		spec.cases = append(spec.cases, ec)
+	}
+	return spec, nil
+}
+
+// getEvalCase reads a case and the assertions of its `expect` object, in
+// the order of the Assert constants.
+func getEvalCase(c *ast.CaseEntity) (evalCase, error) {
+	ec := evalCase{name: c.Name()}
+	ec.input, _ = c.GetProperty("input")
+	ec.params, _ = c.GetProperty("params")
+
+	prop, _ := c.GetProperty("expect")
+	expect, ok := prop.(ast.ObjectValue)
+	if !ok || len(expect.Properties) == 0 {
+		return ec, fmt.Errorf("case %q: 'expect' must be an object of assertions", c.Name())
+	}
+	for key := range expect.Properties {
+		switch key {
+		case AssertContains, AssertNotContains, AssertRegex, AssertJSONSchema, AssertGraded:
+		default:
+			return ec, fmt.Errorf("case %q: unknown assertion %q (use %s, %s, %s, %s, or %s)", c.Name(), key,
+				AssertContains, AssertNotContains, AssertRegex, AssertJSONSchema, AssertGraded)
+		}
+	}
+
+	for _, kind := range []string{AssertContains, AssertNotContains, AssertRegex, AssertJSONSchema, AssertGraded} {
+		v, ok := expect.Properties[kind]
+		if !ok {
+			continue
+		}
+		if kind == AssertJSONSchema {
+			schema, err := schemaFromValue(v)
+			if err != nil {
+				return ec, fmt.Errorf("case %q: invalid json_schema: %w", c.Name(), err)
+			}
+			ec.assertions = append(ec.assertions, evalAssertion{kind: kind, schema: schema})
+			continue
+		}
+		texts, ok := stringList(v)
+		if !ok {
+			return ec, fmt.Errorf("case %q: '%s' must be a string or a list of strings", c.Name(), kind)
+		}
+		for _, text := range texts {
+			a := evalAssertion{kind: kind, text: text}
+			if kind == AssertRegex {
+				re, err := regexp.Compile(text)
+				if err != nil {
+					return ec, fmt.Errorf("case %q: invalid regex: %w", c.Name(), err)
+				}
+				a.pattern = re
+			}
+			ec.assertions = append(ec.assertions, a)
+		}
+	}
+	return ec, nil
+}
+
+// stringList returns a string, or a list of strings, as a list.
+func stringList(v ast.Value) ([]string, bool) {
+	switch val := v.(type) {
+	case ast.StringValue:
+		return []string{val.Value}, true
+	case ast.ArrayValue:
+		list := make([]string, 0, len(val.Elements))
+		for _, elem := range val.Elements {
+			sv, ok := elem.(ast.StringValue)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, sv.Value)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// outputText returns an output as text: strings as they are, and other
+// values as JSON.
+func outputText(output interface{}) string {
+	if s, ok := output.(string); ok {
+		return s
+	}
+	if output == nil {
+		return ""
+	}
+	return jsonText(output)
+}
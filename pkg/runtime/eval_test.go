@@ -0,0 +1,174 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const evalSource = `
+agent "support" {
+	model: "gpt-4o"
+}
+
+agent "judge" {
+	model: "gpt-4o"
+	instruction: "You grade support replies."
+}
+
+intent "reply" {
+	use: agent("support")
+	input: $input
+}
+
+eval "refunds" {
+	target: intent("reply")
+	runs: 2
+	pass_rate: 0.5
+	grader: agent("judge")
+
+	case "refund" {
+		input: "I want my money back"
+		expect: {
+			contains: "refund"
+			regex: "(?i)\d+ days"
+			graded: "The reply is polite"
+		}
+	}
+
+	case "category" {
+		input: "Classify: my card was charged twice"
+		expect: {
+			json_schema: { type: "object" required: ["category"] }
+			not_contains: "error"
+		}
+	}
+}
+`
+
+func TestEval(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, evalSource))
+	usage := TokenUsage{InputTokens: 100, OutputTokens: 10, TotalTokens: 110}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "You will get a refund within 14 days.", Usage: usage},
+		MockResponse{Content: "PASS\nIt is courteous.", Usage: usage},
+		MockResponse{Content: "No refund for you.", Usage: usage},
+		MockResponse{Content: "FAIL\nIt is curt.", Usage: usage},
+		MockResponse{Content: `{"category": "billing"}`, Usage: usage},
+		MockResponse{Content: "billing", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	report, err := rt.Eval(context.Background(), "refunds")
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if report.Target != `intent "reply"` || report.Runs != 2 || len(report.Cases) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Passed != 2 || report.Total != 4 || report.PassRate != 0.5 || !report.OK() {
+		t.Errorf("expected 2 of 4 runs to pass, reaching the threshold, got %d/%d", report.Passed, report.Total)
+	}
+	if report.TokensUsed.InputTokens != 600 || report.Cost <= 0 {
+		t.Errorf("expected the usage and cost of every run and grade, got %+v, $%f", report.TokensUsed, report.Cost)
+	}
+
+	refund := report.Cases[0]
+	if !refund.Runs[0].Passed || refund.PassRate != 0.5 {
+		t.Errorf("expected the first refund run to pass, got %+v", refund)
+	}
+	want := []string{`output does not match /(?i)\d+ days/`, `graded "The reply is polite": It is curt.`}
+	if got := refund.Runs[1].Failures; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("second refund run failures = %q, want %q", got, want)
+	}
+	if grade := provider.GetRequests()[1]; grade.SystemPrompt != "You grade support replies." || !strings.Contains(grade.Messages[0].Content, "refund within 14 days") {
+		t.Errorf("expected the judge to grade the output, got %+v", grade)
+	}
+
+	category := report.Cases[1]
+	if !category.Runs[0].Passed || category.Runs[1].Passed {
+		t.Errorf("expected only JSON output to pass, got %+v", category.Runs)
+	}
+	if f := category.Runs[1].Failures; len(f) != 1 || !strings.Contains(f[0], "JSON schema") {
+		t.Errorf("expected a schema failure, got %q", f)
+	}
+}
+
+func TestEval_Runs(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, evalSource))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Error: errors.New("provider unavailable")},
+		MockResponse{Content: "billing"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	report, err := rt.Eval(context.Background(), "refunds", WithEvalRuns(1), WithEvalExecuteOptions(WithMetadata("suite", "nightly")))
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if report.Total != 2 || report.Passed != 0 || report.OK() {
+		t.Errorf("expected one failing run per case, got %d/%d", report.Passed, report.Total)
+	}
+	if run := report.Cases[0].Runs[0]; run.Passed || !strings.Contains(run.Error, "provider unavailable") {
+		t.Errorf("expected the target's error, got %+v", run)
+	}
+}
+
+func TestEval_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name: "target",
+			source: `eval "e" {
+	target: agent("support")
+	case "c" { expect: { contains: "x" } }
+}`,
+			want: "'target' must be an intent(...) or pipeline(...) reference",
+		},
+		{
+			name: "assertion",
+			source: `intent "reply" { use: agent("support") }
+eval "e" {
+	target: intent("reply")
+	case "c" { expect: { equals: "x" } }
+}`,
+			want: `unknown assertion "equals"`,
+		},
+		{
+			name: "grader",
+			source: `intent "reply" { use: agent("support") }
+eval "e" {
+	target: intent("reply")
+	case "c" { expect: { graded: "good" } }
+}`,
+			want: "has no 'grader' agent",
+		},
+		{
+			name: "regex",
+			source: `intent "reply" { use: agent("support") }
+eval "e" {
+	target: intent("reply")
+	case "c" { expect: { regex: "(" } }
+}`,
+			want: "invalid regex",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := workspace.New()
+			addEntities(t, ws, parseSource(t, tt.source))
+			rt := New(ws, WithProvider("mock", NewMockProvider()))
+			if _, err := rt.Eval(context.Background(), "e"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Eval() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
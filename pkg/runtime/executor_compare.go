@@ -0,0 +1,297 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// Comparison methods of compare steps.
+const (
+	CompareText      = "text"
+	CompareJSON      = "json"
+	CompareEmbedding = "embedding"
+)
+
+// compareConfig describes a step that compares two values instead of
+// calling a model:
+//
+//	step "drift" {
+//	  compare: [step("stable").output, step("canary").output]
+//	  method: "json"      # or "text" (the default), or "embedding"
+//	  threshold: 0.9      # least similarity that passes (default 1)
+//	}
+//
+// The step's output is an object with the comparison's method, whether the
+// values are equal, their similarity from 0 to 1, whether it passed the
+// threshold, and the differences: removed ("- ") and added ("+ ") lines of
+// text, or the changed ("~ "), removed, and added paths of JSON.
+type compareConfig struct {
+	left, right ast.Value
+	method      string
+	threshold   float64
+}
+
+// getCompareConfig reads the comparison a step makes. It returns nil when
+// the step does not compare.
+func getCompareConfig(step *ast.StepEntity) (*compareConfig, error) {
+	prop, ok := step.GetProperty("compare")
+	if !ok {
+		return nil, nil
+	}
+	values, ok := prop.(ast.ArrayValue)
+	if !ok || len(values.Elements) != 2 {
+		return nil, fmt.Errorf("step %q: 'compare' must be a list of the two values to compare", step.Name())
+	}
+
+	cfg := &compareConfig{
+		left:      values.Elements[0],
+		right:     values.Elements[1],
+		method:    CompareText,
+		threshold: 1,
+	}
+	if methodProp, ok := step.GetProperty("method"); ok {
+		sv, ok := methodProp.(ast.StringValue)
+		if !ok {
+			return nil, fmt.Errorf("step %q: 'method' must be a string", step.Name())
+		}
+		cfg.method = sv.Value
+	}
+	switch cfg.method {
+	case CompareText, CompareJSON, CompareEmbedding:
+	default:
+		return nil, fmt.Errorf("step %q: unknown comparison method %q (use %q, %q, or %q)", step.Name(), cfg.method, CompareText, CompareJSON, CompareEmbedding)
+	}
+	if thresholdProp, ok := step.GetProperty("threshold"); ok {
+		nv, ok := thresholdProp.(ast.NumberValue)
+		if !ok || nv.Value < 0 || nv.Value > 1 {
+			return nil, fmt.Errorf("step %q: 'threshold' must be a number from 0 to 1", step.Name())
+		}
+		cfg.threshold = nv.Value
+	}
+	return cfg, nil
+}
+
+// executeCompareStep runs a pipeline step that compares two values. A
+// comparison that does not pass is not an error: later steps and branches
+// decide what to do with it.
+func (r *Runtime) executeCompareStep(ctx *ExecutionContext, step *ast.StepEntity, cfg *compareConfig, resolver *Resolver, stepResult *StepResult) (*StepResult, error) {
+	fail := func(err error) (*StepResult, error) {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	left, err := resolver.Resolve(cfg.left)
+	if err != nil {
+		return fail(fmt.Errorf("compare: %w", err))
+	}
+	right, err := resolver.Resolve(cfg.right)
+	if err != nil {
+		return fail(fmt.Errorf("compare: %w", err))
+	}
+
+	var equal bool
+	var similarity float64
+	var diff []string
+	switch cfg.method {
+	case CompareText:
+		equal, similarity, diff = compareText(toString(left), toString(right))
+	case CompareJSON:
+		if equal, similarity, diff, err = compareJSON(left, right); err != nil {
+			return fail(fmt.Errorf("compare: %w", err))
+		}
+	case CompareEmbedding:
+		a, b := toString(left), toString(right)
+		if equal = a == b; equal {
+			similarity = 1
+			break
+		}
+		embedder := r.embedder(nil)
+		if embedder == nil {
+			return fail(fmt.Errorf("compare: embedding comparison requires a provider that supports embeddings"))
+		}
+		vectors, err := embedder.Embed(ctx.Context, []string{a, b})
+		if err != nil {
+			return fail(fmt.Errorf("compare: failed to embed values: %w", err))
+		}
+		if len(vectors) != 2 {
+			return fail(fmt.Errorf("compare: expected 2 embeddings, got %d", len(vectors)))
+		}
+		similarity = workspace.CosineSimilarity(vectors[0], vectors[1])
+	}
+
+	changes := make([]interface{}, len(diff))
+	for i, d := range diff {
+		changes[i] = d
+	}
+	output := map[string]interface{}{
+		"method":     cfg.method,
+		"equal":      equal,
+		"similarity": similarity,
+		"passed":     similarity >= cfg.threshold,
+		"diff":       changes,
+	}
+
+	stepResult.Success = true
+	stepResult.Output = output
+	stepResult.EndTime = time.Now()
+	stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+	ctx.SetStepOutput(step.Name(), output)
+	ctx.SetStepOutput(step.Name()+".output", output)
+
+	return stepResult, nil
+}
+
+// compareText diffs two texts by line. Their similarity is the share of
+// their words that they have in common, in order.
+func compareText(a, b string) (bool, float64, []string) {
+	if a == b {
+		return true, 1, nil
+	}
+	x, y := strings.Fields(a), strings.Fields(b)
+	similarity := 1.0
+	if total := len(x) + len(y); total > 0 {
+		similarity = float64(total-len(diffSequences(x, y))) / float64(total)
+	}
+	return false, similarity, diffLines(a, b)
+}
+
+// compareJSON diffs two JSON values, or texts holding them, by path. Their
+// similarity is the share of leaf values that are the same in both.
+func compareJSON(a, b interface{}) (bool, float64, []string, error) {
+	x, err := jsonValue(a)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	y, err := jsonValue(b)
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	var d jsonDiff
+	d.compare("$", x, y)
+	similarity := 1.0
+	if d.leaves > 0 {
+		similarity = float64(d.same) / float64(d.leaves)
+	}
+	return len(d.changes) == 0, similarity, d.changes, nil
+}
+
+// jsonValue returns v as decoded JSON: text is parsed, ignoring a
+// surrounding Markdown code fence, and other values are normalized.
+func jsonValue(v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		value, err := parseJSONOutput(s)
+		if err != nil {
+			return nil, fmt.Errorf("value is not JSON: %w", err)
+		}
+		return value, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+// jsonDiff collects the differences between two JSON values.
+type jsonDiff struct {
+	changes []string
+	leaves  int // leaf values in either
+	same    int // leaf values the same in both
+}
+
+func (d *jsonDiff) compare(path string, a, b interface{}) {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		if y, ok := b.(map[string]interface{}); ok && (len(x) > 0 || len(y) > 0) {
+			keys := make([]string, 0, len(x)+len(y))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			for k := range y {
+				if _, ok := x[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := path + "." + k
+				xv, inX := x[k]
+				yv, inY := y[k]
+				switch {
+				case !inX:
+					d.add("+ ", p, yv)
+				case !inY:
+					d.add("- ", p, xv)
+				default:
+					d.compare(p, xv, yv)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok && (len(x) > 0 || len(y) > 0) {
+			for i := 0; i < max(len(x), len(y)); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(x):
+					d.add("+ ", p, y[i])
+				case i >= len(y):
+					d.add("- ", p, x[i])
+				default:
+					d.compare(p, x[i], y[i])
+				}
+			}
+			return
+		}
+	}
+
+	d.leaves++
+	if reflect.DeepEqual(a, b) {
+		d.same++
+		return
+	}
+	d.changes = append(d.changes, fmt.Sprintf("~ %s: %s -> %s", path, jsonText(a), jsonText(b)))
+}
+
+// add records a value only one side has, counting its leaves as differing.
+func (d *jsonDiff) add(prefix, path string, v interface{}) {
+	d.leaves += countLeaves(v)
+	d.changes = append(d.changes, prefix+path+": "+jsonText(v))
+}
+
+// countLeaves returns the number of leaf values in v, counting empty
+// objects and lists as one.
+func countLeaves(v interface{}) int {
+	n := 0
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for _, e := range x {
+			n += countLeaves(e)
+		}
+	case []interface{}:
+		for _, e := range x {
+			n += countLeaves(e)
+		}
+	}
+	return max(n, 1)
+}
+
+func jsonText(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// executeForEachStep runs a step once per element of its `for_each` list,
+// with the element bound to $item (or {{item}} in a string) and its
+// position to $index:
+//
+//	step "review" {
+//	    use: agent("reviewer")
+//	    for_each: step("list").output
+//	    concurrency: 4
+//	    input: "Review {{item.path}}"
+//	}
+//
+// Up to `concurrency` elements (default 1) run at once. The step's output
+// is the list of the iterations' outputs, in the order of the elements, also
+// available as step("review").outputs. The first iteration to fail fails
+// the step and cancels the rest.
+func (r *Runtime) executeForEachStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepResult *StepResult) (*StepResult, error) {
+	fail := func(err error) (*StepResult, error) {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	concurrency, err := getForEachConcurrency(step)
+	if err != nil {
+		return fail(err)
+	}
+	prop, _ := step.GetProperty("for_each")
+	resolved, err := resolver.Resolve(prop)
+	if err != nil {
+		return fail(fmt.Errorf("step %q: for_each: %w", step.Name(), err))
+	}
+	items, err := toList(resolved)
+	if err != nil {
+		return fail(fmt.Errorf("step %q: for_each: %w", step.Name(), err))
+	}
+
+	iterCtx, cancel := context.WithCancel(ctx.Context)
+	defer cancel()
+	handler := ctx.Handler
+	if concurrency > 1 && handler != nil {
+		handler = &syncStreamHandler{handler: handler}
+	}
+
+	stepResult.Iterations = make([]*StepResult, len(items))
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	slots := make(chan struct{}, concurrency)
+	for i, item := range items {
+		slots <- struct{}{}
+		if iterCtx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			// Each iteration runs on a copy of the context, writing its
+			// outputs and the MCP tools its agent lists to copies of the
+			// context's maps, so iterations running at once do not share one
+			ic := *ctx
+			ic.Context = iterCtx
+			ic.Handler = handler
+			ic.StepOutputs = make(map[string]interface{}, len(ctx.StepOutputs))
+			for k, v := range ctx.StepOutputs {
+				ic.StepOutputs[k] = v
+			}
+			ic.MCPTools = make(map[string]string, len(ctx.MCPTools))
+			for k, v := range ctx.MCPTools {
+				ic.MCPTools[k] = v
+			}
+			locals := resolver.withLocals(map[string]interface{}{"item": item, "index": float64(i)})
+			locals.ctx = &ic
+			result := &StepResult{Name: fmt.Sprintf("%s[%d]", step.Name(), i), StartTime: time.Now()}
+			result, err := r.runStepOnce(&ic, step, locals, result)
+
+			mu.Lock()
+			defer mu.Unlock()
+			stepResult.Iterations[i] = result
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("item %d: %w", i, err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Context.Err()
+	}
+
+	outputs := make([]interface{}, len(items))
+	for i, it := range stepResult.Iterations {
+		if it == nil {
+			continue
+		}
+		outputs[i] = it.Output
+		stepResult.TokensUsed.Add(it.TokensUsed)
+		stepResult.Attempts += it.Attempts
+		if stepResult.Model == "" {
+			stepResult.Model = it.Model
+		}
+	}
+	ctx.addTokens(stepResult.TokensUsed)
+	if firstErr != nil {
+		return fail(firstErr)
+	}
+
+	stepResult.EndTime = time.Now()
+	stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+	stepResult.Success = true
+	stepResult.Output = outputs
+	ctx.SetStepOutput(step.Name(), outputs)
+	ctx.SetStepOutput(step.Name()+".output", outputs)
+	ctx.SetStepOutput(step.Name()+".outputs", outputs)
+	ctx.SetStepOutput(step.Name()+".tokens", stepResult.TokensUsed)
+	return stepResult, nil
+}
+
+// getForEachConcurrency returns how many iterations of a for_each step may
+// run at once: its `concurrency`, or 1.
+func getForEachConcurrency(step *ast.StepEntity) (int, error) {
+	prop, ok := step.GetProperty("concurrency")
+	if !ok {
+		return 1, nil
+	}
+	n, ok := prop.(ast.NumberValue)
+	if !ok || n.Value < 1 || n.Value != math.Trunc(n.Value) {
+		return 0, fmt.Errorf("step %q: 'concurrency' must be a whole number of at least 1", step.Name())
+	}
+	return int(n.Value), nil
+}
+
+// syncStreamHandler serializes the callbacks of iterations that stream to
+// one handler at once.
+type syncStreamHandler struct {
+	mu      sync.Mutex
+	handler StreamHandler
+}
+
+func (h *syncStreamHandler) OnChunk(chunk StreamChunk) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler.OnChunk(chunk)
+}
+
+func (h *syncStreamHandler) OnProgress(event ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler.OnProgress(event)
+}
+
+func (h *syncStreamHandler) OnComplete(response *CompletionResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler.OnComplete(response)
+}
+
+func (h *syncStreamHandler) OnError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler.OnError(err)
+}
@@ -2,10 +2,12 @@ package runtime
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
 )
 
 // executeIntent executes an intent entity.
@@ -34,8 +36,14 @@ func (r *Runtime) executeIntent(ctx *ExecutionContext, entity ast.Entity) (*Exec
 		return result, result.Error
 	}
 
-	// Build the prompt from input and context
-	prompt, err := r.buildIntentPrompt(ctx, entity, resolver)
+	// Build the prompt from input and context, with file inputs that fit
+	// the agent's context window
+	budget, err := r.newContextBudget(ctx, entity, agent, "")
+	if err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+	prompt, err := r.buildIntentPrompt(ctx, entity, resolver.withContextBudget(budget))
 	if err != nil {
 		result.Error = fmt.Errorf("failed to build prompt: %w", err)
 		return result, result.Error
@@ -48,9 +56,6 @@ func (r *Runtime) executeIntent(ctx *ExecutionContext, entity ast.Entity) (*Exec
 		return result, result.Error
 	}
 
-	// Get the model to use
-	model := r.getAgentModel(agent)
-
 	// Get temperature
 	temperature := r.getAgentTemperature(agent)
 
@@ -61,101 +66,95 @@ func (r *Runtime) executeIntent(ctx *ExecutionContext, entity ast.Entity) (*Exec
 		return result, result.Error
 	}
 
-	// Get the provider
-	provider, err := r.getProviderForModel(model)
+	// Get the provider and the model to use
+	provider, model, err := r.getAgentProvider(agent)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to get provider: %w", err)
 		return result, result.Error
 	}
 
-	// Build the initial messages
-	messages := []Message{
-		{Role: RoleUser, Content: prompt},
+	// Output must match the schema on the intent or its agent, if any
+	schema, err := getOutputSchema(entity, agent)
+	if err != nil {
+		result.Error = err
+		return result, result.Error
 	}
 
-	// Loop for tool execution
-	maxTurns := 10
-	for turn := 0; turn < maxTurns; turn++ {
-		// Build the request
-		req := &CompletionRequest{
-			Model:        model,
-			SystemPrompt: systemPrompt,
-			Messages:     messages,
-			Temperature:  temperature,
-			Tools:        tools,
-		}
+	// Agents with memory continue the conversation of the session
+	history, memory, err := ctx.sessionHistory(agent)
+	if err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	// Build the request
+	req := &CompletionRequest{
+		Model:           model,
+		SystemPrompt:    systemPrompt,
+		Messages:        append(history, Message{Role: RoleUser, Content: prompt}),
+		Temperature:     temperature,
+		Tools:           tools,
+		ReasoningBudget: r.getAgentReasoningBudget(agent),
+	}
+	r.makeDeterministic(req)
 
-		// Execute the LLM call
-		var resp *CompletionResponse
-		var lastResp *CompletionResponse
+	filters, err := getStreamFilters(entity)
+	if err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	// Run tool calls until the model gives its final answer
+	complete := func(req *CompletionRequest) (*CompletionResponse, error) {
 		if ctx.Handler != nil && r.config.EnableStreaming {
-			resp, err = provider.CompleteStream(ctx.Context, req, ctx.Handler)
-		} else {
-			resp, err = provider.Complete(ctx.Context, req)
+			return provider.CompleteStream(ctx.Context, req, r.streamHandler(ctx, filters))
 		}
+		return provider.Complete(ctx.Context, req)
+	}
+	resp, usage, err := r.runToolLoop(ctx, agent, req, resolver, complete)
+	r.noteNondeterminism(ctx.Context, "", agent, req, model, servedModel(provider, model))
+	result.TokensUsed.Add(usage)
+	ctx.addTokens(usage)
+	if err != nil {
+		result.Error = err
+		ctx.EmitProgress(ProgressEvent{
+			Type:    ProgressTypeError,
+			Message: err.Error(),
+		})
+		return result, result.Error
+	}
 
+	if schema != nil {
+		content, usage, repairs, err := r.enforceOutputSchema(ctx, provider, req, resp.Content, schema, getRepairAttempts(entity, agent))
+		result.TokensUsed.Add(usage)
+		ctx.addTokens(usage)
+		result.Metadata["repairs"] = fmt.Sprintf("%d", repairs)
 		if err != nil {
-			result.Error = fmt.Errorf("LLM request failed: %w", err)
-			ctx.EmitProgress(ProgressEvent{
-				Type:    ProgressTypeError,
-				Message: err.Error(),
-			})
+			result.Error = err
 			return result, result.Error
 		}
-
-		lastResp = resp
-		// Update token usage
-		result.TokensUsed.Add(resp.Usage)
-
-		// Add assistant message to history
-		assistantMsg := Message{
-			Role:      RoleAssistant,
-			Content:   resp.Content,
-			ToolCalls: resp.ToolCalls,
-		}
-		messages = append(messages, assistantMsg)
-
-		// If no tool calls, we're done
-		if len(resp.ToolCalls) == 0 || resp.FinishReason != FinishReasonToolUse {
-			result.Output = resp.Content
-			result.Metadata["finish_reason"] = string(resp.FinishReason)
-			break
-		}
-
-		// Execute tool calls
-		for _, tc := range resp.ToolCalls {
-			ctx.EmitProgress(ProgressEvent{
-				Type:    ProgressTypeStep,
-				Message: fmt.Sprintf("Executing tool: %s", tc.Name),
-				Metadata: map[string]string{
-					"tool": tc.Name,
-				},
-			})
-
-			toolResult, err := r.executeToolCall(ctx, tc, resolver)
-			if err != nil {
-				// We report the error back to the LLM so it can try to fix it
-				toolResult = fmt.Sprintf("Error: %v", err)
-			}
-
-			// Add tool result to history
-			messages = append(messages, Message{
-				Role:       RoleTool,
-				Content:    toString(toolResult),
-				ToolCallID: tc.ID,
-			})
+		resp.Content = content
+	}
+	text := resp.Content
+	result.Output = resp.Content
+	if schema != nil {
+		// Embedders get the decoded value rather than JSON text
+		if result.Output, err = parseJSONOutput(resp.Content); err != nil {
+			result.Error = err
+			return result, result.Error
 		}
-		_ = lastResp // Suppress unused warning, kept for future metadata access
 	}
+	result.Metadata["finish_reason"] = string(resp.FinishReason)
 
 	// Store the output
 	result.Success = true
 	result.Duration = time.Since(startTime)
-	result.Metadata["model"] = model
+	ctx.remember(agent, memory, prompt, text)
+	result.Metadata["model"] = servedModel(provider, model)
 
 	// Handle output destination if specified
 	if result.Output != nil {
-		if err := r.handleIntentOutput(ctx, entity, toString(result.Output), resolver); err != nil {
+		if err := r.handleIntentOutput(ctx, entity, text, resolver); err != nil {
 			result.Error = fmt.Errorf("failed to handle output: %w", err)
 			return result, result.Error
 		}
@@ -176,26 +175,25 @@ func (r *Runtime) executeIntent(ctx *ExecutionContext, entity ast.Entity) (*Exec
 }
 
 // getAgentTools extracts tool definitions from an agent.
+// An agent may only use tools listed in its `tools:` property or linked to it
+// by an "assigned" relationship; the returned set is recorded in ctx.AllowedTools.
 func (r *Runtime) getAgentTools(ctx *ExecutionContext, agent ast.Entity, resolver *Resolver) ([]ToolDefinition, error) {
-	toolsProp, ok := agent.GetProperty("tools")
-	if !ok {
-		return nil, nil
-	}
-
 	var toolNames []string
-	switch v := toolsProp.(type) {
-	case ast.ArrayValue:
-		for _, elem := range v.Elements {
-			if sv, ok := elem.(ast.StringValue); ok {
-				toolNames = append(toolNames, sv.Value)
-			} else if rv, ok := elem.(ast.ReferenceValue); ok && rv.Type == "tool" {
-				toolNames = append(toolNames, rv.Name)
-			} else if rv, ok := elem.(ast.ReferenceValue); ok && rv.Type == "mcp" {
-				toolNames = append(toolNames, rv.Name)
-			}
+	seen := make(map[string]bool)
+	for _, name := range append(validator.AgentToolNames(agent), ctx.Workspace.GetAssignedTools(agent.Name())...) {
+		if !seen[name] {
+			seen[name] = true
+			toolNames = append(toolNames, name)
 		}
 	}
 
+	ctx.AllowedTools = make(map[string]bool)
+	if len(toolNames) == 0 && len(agentScriptNames(agent)) == 0 {
+		return nil, nil
+	}
+
+	mcpSelections := agentMCPToolSelections(agent)
+
 	var definitions []ToolDefinition
 	for _, name := range toolNames {
 		// Check if it's an MCP server reference
@@ -213,16 +211,24 @@ func (r *Runtime) getAgentTools(ctx *ExecutionContext, agent ast.Entity, resolve
 			if ctx.MCPTools == nil {
 				ctx.MCPTools = make(map[string]string)
 			}
+			selected := mcpSelections[mcpEntity.Name()]
 			for _, t := range mcpTools {
+				if selected != nil && !selected[t.Name] {
+					continue
+				}
 				ctx.MCPTools[t.Name] = mcpEntity.Name()
+				definitions = append(definitions, t)
 			}
-
-			definitions = append(definitions, mcpTools...)
 			continue
 		}
 
 		tool, err := resolver.workspace.GetTool(name)
 		if err != nil {
+			// Tools backed by a registered Go handler need no declaration
+			if _, ok := r.getToolHandler(name); ok {
+				definitions = append(definitions, ToolDefinition{Name: name, Description: name, Parameters: emptyToolSchema()})
+				continue
+			}
 			return nil, err
 		}
 
@@ -237,45 +243,152 @@ func (r *Runtime) getAgentTools(ctx *ExecutionContext, agent ast.Entity, resolve
 			}
 		}
 
-		if params, ok := tool.GetProperty("parameters"); ok {
-			if obj, ok := params.(ast.ObjectValue); ok {
-				def.Parameters = make(map[string]interface{})
-				// Convert AST ObjectValue to JSON-compatible map
-				// This is a simplified conversion
-				for k, v := range obj.Properties {
-					def.Parameters[k] = v
-				}
+		def.Parameters = toolInputSchema(tool)
+
+		definitions = append(definitions, def)
+	}
+
+	// Scripts the agent lists are offered as tools taking their parameters
+	for _, name := range agentScriptNames(agent) {
+		script, found := ctx.Workspace.GetEntityByName("script", name)
+		if !found {
+			return nil, fmt.Errorf("script %q not found", name)
+		}
+		def := ToolDefinition{
+			Name:        name,
+			Description: fmt.Sprintf("Run the %s script", name),
+			Parameters:  toolInputSchema(script),
+		}
+		if desc, ok := script.GetProperty("description"); ok {
+			if sv, ok := desc.(ast.StringValue); ok {
+				def.Description = sv.Value
 			}
 		}
-
 		definitions = append(definitions, def)
 	}
 
+	for _, def := range definitions {
+		ctx.AllowedTools[def.Name] = true
+	}
+
 	return definitions, nil
 }
 
+// agentScriptNames returns the scripts an agent lists in `scripts`, as
+// script("name") or by name.
+func agentScriptNames(agent ast.Entity) []string {
+	prop, ok := agent.GetProperty("scripts")
+	if !ok {
+		return nil
+	}
+	arr, ok := prop.(ast.ArrayValue)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, elem := range arr.Elements {
+		switch v := elem.(type) {
+		case ast.ReferenceValue:
+			if v.Type == "script" {
+				names = append(names, v.Name)
+			}
+		case ast.StringValue:
+			names = append(names, v.Value)
+		}
+	}
+	return names
+}
+
+// agentMCPToolSelections returns, per MCP server, the tools an agent selected
+// with references like mcp("fs").read_file. Servers referenced without a tool
+// name (mcp("fs")) map to nil, meaning all of their tools are exposed.
+func agentMCPToolSelections(agent ast.Entity) map[string]map[string]bool {
+	selections := make(map[string]map[string]bool)
+	toolsProp, ok := agent.GetProperty("tools")
+	if !ok {
+		return selections
+	}
+	arr, ok := toolsProp.(ast.ArrayValue)
+	if !ok {
+		return selections
+	}
+
+	all := make(map[string]bool)
+	for _, elem := range arr.Elements {
+		ref, ok := elem.(ast.ReferenceValue)
+		if !ok || ref.Type != "mcp" {
+			continue
+		}
+		if len(ref.Path) == 0 {
+			all[ref.Name] = true
+			continue
+		}
+		if selections[ref.Name] == nil {
+			selections[ref.Name] = make(map[string]bool)
+		}
+		selections[ref.Name][ref.Path[0]] = true
+	}
+	for name := range all {
+		delete(selections, name)
+	}
+	return selections
+}
+
 // executeToolCall executes a single tool call from the LLM.
 func (r *Runtime) executeToolCall(ctx *ExecutionContext, tc ToolCall, resolver *Resolver) (interface{}, error) {
+	// Only run tools that were exposed to the agent
+	if ctx.AllowedTools != nil && !ctx.AllowedTools[tc.Name] {
+		return nil, fmt.Errorf("tool %q is not available to this agent", tc.Name)
+	}
+
+	// A declared tool may mark its arguments as sinks for untrusted content
+	tool, toolErr := resolver.workspace.GetTool(tc.Name)
+	if err := r.checkTaint(ctx, tool, tc); err != nil {
+		return nil, err
+	}
+
+	// Prefer handlers registered by the embedding application
+	if handler, ok := r.getToolHandler(tc.Name); ok {
+		return handler(ctx.Context, tc.Arguments)
+	}
+
 	// Check if it's an MCP tool
 	if mcpServer, ok := ctx.MCPTools[tc.Name]; ok {
 		return r.executeMCPTool(ctx, mcpServer, tc.Name, tc.Arguments)
 	}
 
-	tool, err := resolver.workspace.GetTool(tc.Name)
+	if toolErr != nil {
+		// Scripts listed in the agent's `scripts` are called like tools
+		if script, found := ctx.Workspace.GetEntityByName("script", tc.Name); found {
+			args, err := toolArguments(script, tc.Arguments, resolver)
+			if err != nil {
+				return nil, err
+			}
+			return r.executeScriptTool(ctx, script, args)
+		}
+		return nil, toolErr
+	}
+
+	// Parameters the model left out take their declared defaults
+	args, err := toolArguments(tool, tc.Arguments, resolver)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check for command property (shell tool)
 	if cmd, ok := tool.GetProperty("command"); ok {
-		cmdStr, err := resolver.ResolveString(cmd)
+		// Arguments are available as {{params.name}}; use {{params.name | shell}}
+		// to quote them
+		cmdStr, err := toolResolver(ctx, args).ResolveString(cmd)
 		if err != nil {
 			return nil, err
 		}
 
-		// Interpolate arguments into command if needed
-		// For now, just append them or use a simple template
-		return r.executeShellCommand(ctx, cmdStr, tc.Arguments)
+		shell, err := entityShell(tool)
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: %w", tool.Name(), err)
+		}
+		return r.executeShellCommand(ctx, shell, cmdStr, args)
 	}
 
 	// Check for function property (built-in or custom function)
@@ -284,10 +397,15 @@ func (r *Runtime) executeToolCall(ctx *ExecutionContext, tc ToolCall, resolver *
 		if err != nil {
 			return nil, err
 		}
-		return r.executeFunction(ctx, fnName, tc.Arguments)
+		return r.executeFunction(ctx, fnName, args)
+	}
+
+	// Check for a handler block (shell, http, builtin, or script)
+	if handler, ok := tool.GetProperty("handler"); ok {
+		return r.executeToolHandler(ctx, tool, handler, args)
 	}
 
-	return nil, fmt.Errorf("tool %q has no executable property (command or function)", tc.Name)
+	return nil, fmt.Errorf("tool %q has no executable property (command, function, or handler)", tc.Name)
 }
 
 // resolveAgent resolves the agent to use for an intent.
@@ -390,6 +508,9 @@ func (r *Runtime) resolveContextContent(context ast.Value, resolver *Resolver) (
 // formatContent formats resolved content for inclusion in a prompt.
 func formatContent(content interface{}) string {
 	switch v := content.(type) {
+	case nil:
+		return ""
+
 	case string:
 		return v
 
@@ -458,11 +579,12 @@ func (r *Runtime) getAgentSystemPrompt(agent ast.Entity, resolver *Resolver) (st
 	return fmt.Sprintf("You are %s. Help the user with their request.", agent.Name()), nil
 }
 
-// getAgentModel gets the model to use for an agent.
+// getAgentModel gets the model to use for an agent, the first if it lists
+// several.
 func (r *Runtime) getAgentModel(agent ast.Entity) string {
 	if model, ok := agent.GetProperty("model"); ok {
-		if sv, ok := model.(ast.StringValue); ok {
-			return sv.Value
+		if models, err := modelList(model); err == nil && len(models) > 0 {
+			return models[0]
 		}
 	}
 	return r.defaultModel
@@ -478,31 +600,149 @@ func (r *Runtime) getAgentTemperature(agent ast.Entity) float64 {
 	return 0.7 // Default temperature
 }
 
-// getProviderForModel returns the appropriate provider for a model.
+// getAgentMaxTurns gets the most model calls an agent may make to answer,
+// counting every round of tool calls.
+func (r *Runtime) getAgentMaxTurns(agent ast.Entity) int {
+	if turns, ok := agent.GetProperty("max_turns"); ok {
+		if nv, ok := turns.(ast.NumberValue); ok && nv.Value >= 1 {
+			return int(nv.Value)
+		}
+	}
+	return DefaultMaxTurns
+}
+
+// getAgentReasoningBudget gets the thinking token budget for an agent, or 0 if disabled.
+func (r *Runtime) getAgentReasoningBudget(agent ast.Entity) int {
+	if budget, ok := agent.GetProperty("reasoning_budget"); ok {
+		if nv, ok := budget.(ast.NumberValue); ok {
+			return int(nv.Value)
+		}
+	}
+	return 0
+}
+
+// streamHandler returns the handler that providers should stream to,
+// through the stream filters of the executing step or intent, and filtering
+// out reasoning chunks when reasoning is redacted.
+func (r *Runtime) streamHandler(ctx *ExecutionContext, filters []StreamMiddleware) StreamHandler {
+	h := ctx.Handler
+	if r.config.RedactReasoning {
+		h = &redactReasoningHandler{StreamHandler: h}
+	}
+	return WrapStreamHandler(h, filters...)
+}
+
+// redactReasoningHandler forwards everything except reasoning chunks.
+type redactReasoningHandler struct {
+	StreamHandler
+}
+
+func (h *redactReasoningHandler) OnChunk(chunk StreamChunk) {
+	if chunk.Type != ChunkTypeReasoning {
+		h.StreamHandler.OnChunk(chunk)
+	}
+}
+
+func (h *redactReasoningHandler) OnComplete(response *CompletionResponse) {
+	redacted := *response
+	redacted.Reasoning = ""
+	h.StreamHandler.OnComplete(&redacted)
+}
+
+// getProviderForModel returns the appropriate provider for a model, traced
+// if a tracer provider is configured.
 func (r *Runtime) getProviderForModel(model string) (LLMProvider, error) {
+	return r.getProvider("", model)
+}
+
+// getProviderForAgent returns the provider named by an agent's `provider`
+// property, or else the provider for its model.
+func (r *Runtime) getProviderForAgent(agent ast.Entity, model string) (LLMProvider, error) {
+	return r.getProvider(propertyString(agent, "provider"), model)
+}
+
+// getProvider returns the provider registered under name, or the provider
+// serving model if name is empty, wrapped with its instance's rate limit,
+// metrics, and tracing, the cassette, and the response cache.
+func (r *Runtime) getProvider(name, model string) (LLMProvider, error) {
+	var p LLMProvider
+	if name != "" {
+		var ok bool
+		if p, ok = r.GetProvider(name); !ok {
+			return nil, fmt.Errorf("unknown provider %q (registered: %v)", name, r.providerNames())
+		}
+	} else {
+		var err error
+		if name, p, err = r.lookupProvider(model); err != nil {
+			return nil, err
+		}
+	}
+	return r.cacheResponses(r.traceProvider(r.recordResponses(name, r.instrumentProvider(name, p)))), nil
+}
+
+// providerNames returns the names of the registered providers, sorted.
+func (r *Runtime) providerNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupProvider finds the registered provider serving a model and the name
+// it is registered under.
+func (r *Runtime) lookupProvider(model string) (string, LLMProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Models routed to a provider entity by its `models` property
+	if name, ok := r.modelRoutes[model]; ok {
+		if p, ok := r.providers[name]; ok {
+			return name, p, nil
+		}
+	}
+
 	// Check model prefix to determine provider
 	switch {
+	case isBedrockModel(model):
+		if name, p, ok := r.providerOfType("bedrock"); ok {
+			return name, p, nil
+		}
 	case strings.HasPrefix(model, "claude"):
-		if p, ok := r.providers["anthropic"]; ok {
-			return p, nil
+		if name, p, ok := r.providerOfType("anthropic"); ok {
+			return name, p, nil
 		}
 	case strings.HasPrefix(model, "gpt"), strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"):
-		if p, ok := r.providers["openai"]; ok {
-			return p, nil
+		if name, p, ok := r.providerOfType("openai"); ok {
+			return name, p, nil
+		}
+	case strings.HasPrefix(model, "gemini"):
+		if name, p, ok := r.providerOfType("gemini"); ok {
+			return name, p, nil
+		}
+	}
+
+	// Check providers that declare an explicit model list (e.g., local endpoints)
+	for name, p := range r.providers {
+		if m, ok := p.(modelMatcher); ok && m.SupportsModel(model) {
+			return name, p, nil
 		}
 	}
 
 	// Try default provider
 	if p, ok := r.providers[r.config.DefaultProvider]; ok {
-		return p, nil
+		return r.config.DefaultProvider, p, nil
 	}
 
 	// Return any available provider
-	for _, p := range r.providers {
-		return p, nil
+	for name, p := range r.providers {
+		return name, p, nil
 	}
 
-	return nil, fmt.Errorf("no LLM provider available for model %q", model)
+	return "", nil, fmt.Errorf("no LLM provider available for model %q", model)
 }
 
 // handleIntentOutput handles writing output to a destination.
@@ -0,0 +1,222 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// MatrixResult is the outcome of running a pipeline once per combination of
+// its matrix (see ExecuteMatrix).
+type MatrixResult struct {
+	// Pipeline is the name of the pipeline
+	Pipeline string `json:"pipeline"`
+
+	// Dimensions are the names of the matrix's dimensions, in declaration
+	// order
+	Dimensions []string `json:"dimensions"`
+
+	// Runs holds one run per combination, varying the last dimension
+	// fastest
+	Runs []*MatrixRun `json:"runs"`
+
+	// Duration is how long all runs took
+	Duration time.Duration `json:"duration"`
+}
+
+// MatrixRun is the run of a pipeline with one combination of its matrix.
+type MatrixRun struct {
+	// Values are the combination's value of each dimension, in the
+	// matrix's order
+	Values []MatrixSetting `json:"values"`
+
+	// Result is the result of the run
+	Result *ExecutionResult `json:"result"`
+}
+
+// MatrixSetting is the value a matrix run gives a dimension.
+type MatrixSetting struct {
+	Dimension string      `json:"dimension"`
+	Value     interface{} `json:"value"`
+}
+
+// Value returns the run's value of dimension.
+func (m *MatrixRun) Value(dimension string) (interface{}, bool) {
+	for _, s := range m.Values {
+		if s.Dimension == dimension {
+			return s.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Label describes the run's combination, e.g. "model=gpt-4o temperature=0".
+func (m *MatrixRun) Label() string {
+	parts := make([]string, len(m.Values))
+	for i, s := range m.Values {
+		parts[i] = fmt.Sprintf("%s=%v", s.Dimension, s.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Succeeded returns the number of runs that succeeded.
+func (m *MatrixResult) Succeeded() int {
+	n := 0
+	for _, run := range m.Runs {
+		if run.Result != nil && run.Result.Success {
+			n++
+		}
+	}
+	return n
+}
+
+// Group returns the runs by their value of dimension, for comparing, say,
+// every run of one model with those of another. Values are keyed as
+// formatted by fmt.Sprint.
+func (m *MatrixResult) Group(dimension string) map[string][]*MatrixRun {
+	groups := make(map[string][]*MatrixRun)
+	for _, run := range m.Runs {
+		if v, ok := run.Value(dimension); ok {
+			key := fmt.Sprint(v)
+			groups[key] = append(groups[key], run)
+		}
+	}
+	return groups
+}
+
+// ExecuteMatrix runs a pipeline with a matrix once per combination of the
+// values of its dimensions, one after another:
+//
+//	pipeline "compare" {
+//	  matrix {
+//	    model: ["gpt-4o", "claude-sonnet-4-20250514"]
+//	    temperature: [0, 0.7]
+//	  }
+//	  step "answer" { ... }
+//	}
+//
+// The model and temperature dimensions override those of every step's
+// agent, replacing its fallbacks. Every dimension is available to the
+// pipeline as matrix.name, and each run's metadata holds its combination
+// under "matrix". A run that fails is recorded in its result and does not
+// stop the others. Execute runs such a pipeline once, without its matrix.
+func (r *Runtime) ExecuteMatrix(ctx context.Context, pipeline ast.Entity, opts ...ExecuteOption) (*MatrixResult, error) {
+	prop, ok := pipeline.GetProperty("matrix")
+	if !ok {
+		return nil, fmt.Errorf("%s %q has no matrix", pipeline.Type(), pipeline.Name())
+	}
+	matrix, ok := prop.(ast.MatrixValue)
+	if !ok {
+		return nil, fmt.Errorf("%s %q: 'matrix' must be a matrix block", pipeline.Type(), pipeline.Name())
+	}
+
+	result := &MatrixResult{Pipeline: pipeline.Name()}
+	dimensions := make([][]interface{}, len(matrix.Dimensions))
+	for i, dim := range matrix.Dimensions {
+		result.Dimensions = append(result.Dimensions, dim.Name)
+		for _, v := range dim.Values {
+			value := schemaLiteral(v)
+			if err := checkMatrixValue(dim.Name, value); err != nil {
+				return nil, fmt.Errorf("%s %q: %w", pipeline.Type(), pipeline.Name(), err)
+			}
+			dimensions[i] = append(dimensions[i], value)
+		}
+	}
+
+	start := time.Now()
+	for _, combination := range matrixCombinations(result.Dimensions, dimensions) {
+		if err := ctx.Err(); err != nil {
+			result.Duration = time.Since(start)
+			return result, err
+		}
+		run := &MatrixRun{Values: combination}
+		res, err := r.Execute(ctx, pipeline, append(opts[:len(opts):len(opts)], withMatrix(combination))...)
+		if res == nil {
+			res = &ExecutionResult{Error: err}
+		}
+		if res.Metadata == nil {
+			res.Metadata = make(map[string]string)
+		}
+		res.Metadata["matrix"] = run.Label()
+		run.Result = res
+		result.Runs = append(result.Runs, run)
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// checkMatrixValue checks that a value suits the setting it overrides.
+func checkMatrixValue(dimension string, value interface{}) error {
+	switch dimension {
+	case "model":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("matrix model values must be model names, got %v", value)
+		}
+	case "temperature":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("matrix temperature values must be numbers, got %v", value)
+		}
+	}
+	return nil
+}
+
+// matrixCombinations returns every combination of the values of the named
+// dimensions, varying the last fastest.
+func matrixCombinations(names []string, values [][]interface{}) [][]MatrixSetting {
+	combinations := [][]MatrixSetting{nil}
+	for i, name := range names {
+		var next [][]MatrixSetting
+		for _, combination := range combinations {
+			for _, v := range values[i] {
+				c := append(combination[:len(combination):len(combination)], MatrixSetting{Dimension: name, Value: v})
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// withMatrix runs an execution with a combination of its pipeline's matrix.
+func withMatrix(combination []MatrixSetting) ExecuteOption {
+	return func(o *executeOptions) {
+		o.matrix = combination
+	}
+}
+
+// matrixAgent returns agent with the model and temperature of the
+// execution's matrix combination, if it sets them.
+func (ec *ExecutionContext) matrixAgent(agent ast.Entity) ast.Entity {
+	overrides := make(map[string]ast.Value)
+	for _, s := range ec.matrix {
+		switch s.Dimension {
+		case "model":
+			overrides["model"] = ast.StringValue{Value: s.Value.(string)}
+		case "temperature":
+			overrides["temperature"] = ast.NumberValue{Value: s.Value.(float64)}
+		}
+	}
+	if len(overrides) == 0 {
+		return agent
+	}
+
+	clone := ast.NewAgentEntity(agent.Name())
+	clone.SetLocation(agent.Line(), agent.Column())
+	for key, value := range agent.Properties() {
+		// The matrix model replaces the agent's fallbacks
+		if key == "fallback" && overrides["model"] != nil {
+			continue
+		}
+		clone.SetProperty(key, value)
+	}
+	for key, value := range overrides {
+		clone.SetProperty(key, value)
+	}
+	for key, value := range agent.AllMetadata() {
+		clone.SetMetadata(key, value)
+	}
+	return clone
+}
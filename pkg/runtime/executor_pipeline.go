@@ -1,7 +1,10 @@
 package runtime
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -27,6 +30,12 @@ func (r *Runtime) executePipeline(ctx *ExecutionContext, entity ast.Entity) (*Ex
 
 	resolver := NewResolver(ctx)
 
+	snapshot, err := getPipelineSnapshot(entity)
+	if err != nil {
+		return nil, err
+	}
+	ctx.snapshotSteps = snapshot
+
 	// Get steps from the pipeline
 	pipeline, ok := entity.(*ast.PipelineEntity)
 	if !ok {
@@ -36,6 +45,22 @@ func (r *Runtime) executePipeline(ctx *ExecutionContext, entity ast.Entity) (*Ex
 	// Execute each step
 	totalSteps := len(pipeline.Steps)
 	for i, step := range pipeline.Steps {
+		// Give way to a higher-priority execution if the scheduler asks
+		if err := ctx.yieldSlot(); err != nil {
+			result.Error = err
+			return result, err
+		}
+
+		// A debugger may pause, skip the step, or stop the execution
+		switch ctx.debugStep(entity.Name(), step, resolver, i+1, totalSteps) {
+		case DebugSkip:
+			result.StepResults[step.Name()] = ctx.skipStep(step)
+			continue
+		case DebugStop:
+			result.Error = ErrDebugStopped
+			return result, result.Error
+		}
+
 		stepResult, err := r.executeStep(ctx, step, resolver, i+1, totalSteps)
 		result.StepResults[step.Name()] = stepResult
 
@@ -50,11 +75,7 @@ func (r *Runtime) executePipeline(ctx *ExecutionContext, entity ast.Entity) (*Ex
 		}
 
 		// Update token usage
-		if stepResult.Output != nil {
-			if usage, ok := stepResult.Output.(TokenUsage); ok {
-				result.TokensUsed.Add(usage)
-			}
-		}
+		result.TokensUsed.Add(stepResult.TokensUsed)
 	}
 
 	// Handle parallel blocks in properties
@@ -134,8 +155,122 @@ func (r *Runtime) executePipeline(ctx *ExecutionContext, entity ast.Entity) (*Ex
 	return result, nil
 }
 
-// executeStep executes a single step in a pipeline.
+// executeStep executes a single step in a pipeline inside a span. Provider
+// calls made by the step are children of the span, and their time queued
+// for rate limits is the step's QueueWait. A step with a `timeout` is
+// cancelled once it runs longer, including its retries, which aborts the
+// provider request it is waiting on.
 func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepNum, totalSteps int) (*StepResult, error) {
+	parent := ctx.Context
+	var span Span
+	ctx.Context, span = r.tracer.Start(parent, "step "+step.Name(), Attr("langspace.step.name", step.Name()))
+	var waited queueWait
+	ctx.Context = withQueueWait(ctx.Context, &waited)
+	ctx.Context = withLogAttrs(ctx.Context, slog.String("step", step.Name()))
+	defer func() { ctx.Context = parent }()
+
+	timeout, err := getStepTimeout(step)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx.Context, cancel = context.WithTimeoutCause(ctx.Context, timeout, &StepTimeoutError{Step: step.Name(), Timeout: timeout})
+		defer cancel()
+	}
+	stepCtx := ctx.Context
+
+	logAt(ctx.Context, slog.LevelDebug, "step started")
+	var stepResult *StepResult
+	if err != nil {
+		now := time.Now()
+		stepResult = &StepResult{Name: step.Name(), Error: err, StartTime: now, EndTime: now}
+	} else {
+		stepResult, err = r.invokeStep(ctx, step, resolver, stepNum, totalSteps)
+	}
+	// Whatever the provider reported, a step that ran out of time failed
+	// because of it
+	var timedOut *StepTimeoutError
+	if err != nil && errors.As(context.Cause(stepCtx), &timedOut) {
+		err = timedOut
+		if stepResult != nil {
+			stepResult.Error = err
+		}
+	}
+	logStep(ctx.Context, stepResult, err)
+	if stepResult != nil {
+		stepResult.Status = stepStatus(stepResult, err)
+		stepResult.QueueWait = waited.Duration()
+		r.metrics.countStep(ctx.entityName, stepResult)
+		span.SetAttributes(usageAttributes(stepResult.TokensUsed)...)
+		span.SetAttributes(
+			Attr("gen_ai.request.model", stepResult.Model),
+			Attr("langspace.step.attempts", stepResult.Attempts),
+			Attr("langspace.step.cached", stepResult.Cached),
+		)
+	}
+	endSpan(span, err)
+	return stepResult, err
+}
+
+// StepTimeoutError is the error of a step that ran longer than its
+// `timeout`. It matches context.DeadlineExceeded, so retry policies and run
+// history classify it as a timeout.
+type StepTimeoutError struct {
+	Step    string
+	Timeout time.Duration
+}
+
+func (e *StepTimeoutError) Error() string {
+	return fmt.Sprintf("step %q timed out after %s", e.Step, e.Timeout)
+}
+
+// Is reports whether target is context.DeadlineExceeded.
+func (e *StepTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// getStepTimeout returns the `timeout` of a step, or 0 if it has none.
+func getStepTimeout(step *ast.StepEntity) (time.Duration, error) {
+	prop, ok := step.GetProperty("timeout")
+	if !ok {
+		return 0, nil
+	}
+	v, ok := prop.(ast.StringValue)
+	if !ok {
+		return 0, fmt.Errorf("step %q: 'timeout' must be a duration", step.Name())
+	}
+	d, err := time.ParseDuration(v.Value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("step %q: invalid timeout %q (use a duration like \"30s\")", step.Name(), v.Value)
+	}
+	return d, nil
+}
+
+// stepStatus returns how a step ended.
+func stepStatus(stepResult *StepResult, err error) StepStatus {
+	var timedOut *StepTimeoutError
+	switch {
+	case errors.As(err, &timedOut):
+		return StepTimedOut
+	case err != nil || !stepResult.Success:
+		return StepFailed
+	}
+	return StepSucceeded
+}
+
+// logStep logs the end of a step at debug level.
+func logStep(ctx context.Context, stepResult *StepResult, err error) {
+	if err == nil && stepResult != nil {
+		err = stepResult.Error
+	}
+	switch {
+	case err != nil:
+		logAt(ctx, slog.LevelDebug, "step failed", "error", err)
+	case stepResult != nil:
+		logAt(ctx, slog.LevelDebug, "step finished", "duration", stepResult.Duration, "cached", stepResult.Cached)
+	}
+}
+
+// runStep executes a single step in a pipeline.
+func (r *Runtime) runStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepNum, totalSteps int) (*StepResult, error) {
 	stepResult := &StepResult{
 		Name:      step.Name(),
 		StartTime: time.Now(),
@@ -149,6 +284,37 @@ func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resol
 		Step:     step.Name(),
 		Progress: progress,
 	})
+	if err := ctx.Context.Err(); err != nil {
+		stepResult.Error = err
+		return stepResult, err
+	}
+
+	// Steps with `for_each` run once per element of a list
+	if _, ok := step.GetProperty("for_each"); ok {
+		return r.executeForEachStep(ctx, step, resolver, stepResult)
+	}
+	return r.runStepOnce(ctx, step, resolver, stepResult)
+}
+
+// runStepOnce runs a step's script, comparison, or model call, recording
+// the outcome in stepResult.
+func (r *Runtime) runStepOnce(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepResult *StepResult) (*StepResult, error) {
+	// Steps with `execute: script("name")` run code instead of a model
+	if _, _, ok := stepScript(step); ok {
+		return r.executeScriptStep(ctx, step, resolver, stepResult)
+	}
+
+	// Steps with `compare: [a, b]` diff two values instead of calling a model
+	compare, err := getCompareConfig(step)
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+	if compare != nil {
+		return r.executeCompareStep(ctx, step, compare, resolver, stepResult)
+	}
 
 	// Get the agent to use
 	agent, err := r.resolveStepAgent(ctx, step, resolver)
@@ -159,14 +325,23 @@ func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resol
 		return stepResult, err
 	}
 
-	// Build the prompt for this step
-	prompt, err := r.buildStepPrompt(ctx, step, resolver)
+	// Build the prompt for this step, with file inputs that fit the agent's
+	// context window
+	budget, err := r.newContextBudget(ctx, step, agent, step.Name())
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+	prompt, err := r.buildStepPrompt(ctx, step, resolver.withContextBudget(budget))
 	if err != nil {
 		stepResult.Error = err
 		stepResult.EndTime = time.Now()
 		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
 		return stepResult, err
 	}
+	stepResult.Input = prompt
 
 	// Get system prompt from agent
 	systemPrompt, err := r.getAgentSystemPrompt(agent, resolver)
@@ -185,12 +360,20 @@ func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resol
 		}
 	}
 
-	// Get model and temperature
-	model := r.getAgentModel(agent)
+	// Get provider, model, and temperature
 	temperature := r.getAgentTemperature(agent)
+	agentProvider, model, err := r.getAgentProvider(agent)
+	stepResult.Model = model
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+	provider := r.snapshotStep(ctx, step, agentProvider)
 
-	// Get provider
-	provider, err := r.getProviderForModel(model)
+	// Agents with memory continue the conversation of the session
+	history, memory, err := ctx.sessionHistory(agent)
 	if err != nil {
 		stepResult.Error = err
 		stepResult.EndTime = time.Now()
@@ -200,22 +383,153 @@ func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resol
 
 	// Build request
 	req := &CompletionRequest{
-		Model:        model,
-		SystemPrompt: systemPrompt,
-		Messages: []Message{
-			{Role: RoleUser, Content: prompt},
-		},
-		Temperature: temperature,
+		Model:           model,
+		SystemPrompt:    systemPrompt,
+		Messages:        append(history, Message{Role: RoleUser, Content: prompt}),
+		Temperature:     temperature,
+		ReasoningBudget: r.getAgentReasoningBudget(agent),
+	}
+	r.makeDeterministic(req)
+	if rewriteRequest(ctx.Context, step, req) && len(req.Messages) > 0 {
+		stepResult.Input = req.Messages[len(req.Messages)-1].Content
 	}
 
-	// Execute
-	var resp *CompletionResponse
-	if ctx.Handler != nil && r.config.EnableStreaming {
-		resp, err = provider.CompleteStream(ctx.Context, req, ctx.Handler)
-	} else {
-		resp, err = provider.Complete(ctx.Context, req)
+	// Output must match the schema on the step or its agent, if any
+	schema, err := getOutputSchema(step, agent)
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	// Sample multiple completions when the step asks for self-consistency
+	sampling, err := getSamplingConfig(step)
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+	if sampling != nil && r.deterministic {
+		logAt(ctx.Context, slog.LevelInfo, "self-consistency sampling is off in deterministic mode")
+		sampling = nil
+	}
+	if sampling != nil {
+		if temp, ok := step.GetProperty("temperature"); ok {
+			if nv, ok := temp.(ast.NumberValue); ok {
+				req.Temperature = nv.Value
+			}
+		}
+	}
+
+	filters, err := getStreamFilters(step)
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	// Reuse the result of an identical earlier run when the step opts in
+	cacheTTL, cacheEnabled, err := getStepCacheTTL(step)
+	if err != nil {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+	var cacheKey string
+	if cacheEnabled && r.stepCache != nil {
+		cacheKey = stepCacheKey(step, agent, req, schema)
+		entry, ok := r.stepCache.Get(cacheKey)
+		r.metrics.countCacheLookup("step", ok)
+		if ok {
+			return r.cachedStepResult(ctx, step, entry, stepResult), nil
+		}
 	}
 
+	if sampling != nil {
+		content, samples, usage, err := r.executeSampling(ctx, provider, req, sampling, resolver)
+		if err == nil && schema != nil {
+			var repairUsage TokenUsage
+			content, repairUsage, stepResult.Repairs, err = r.enforceOutputSchema(ctx, provider, req, content, schema, getRepairAttempts(step, agent))
+			usage.Add(repairUsage)
+		}
+		stepResult.Model = servedModel(agentProvider, model)
+		stepResult.Samples = samples
+		stepResult.TokensUsed = usage
+		ctx.addTokens(usage)
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		if err != nil {
+			stepResult.Error = err
+			return stepResult, err
+		}
+
+		stepResult.Success = true
+		stepResult.Output = content
+		ctx.SetStepOutput(step.Name(), content)
+		ctx.SetStepOutput(step.Name()+".output", content)
+		ctx.SetStepOutput(step.Name()+".tokens", usage)
+		ctx.remember(agent, memory, prompt, content)
+		if cacheKey != "" {
+			r.storeStepResult(ctx.Context, cacheKey, cacheTTL, stepResult)
+		}
+		return stepResult, nil
+	}
+
+	// Agents with tools call them until they give a final answer. Tool
+	// access is tracked per step, since parallel steps share ctx
+	toolCtx := *ctx
+	req.Tools, err = r.getAgentTools(&toolCtx, agent, resolver)
+	if err != nil {
+		err = fmt.Errorf("failed to get agent tools: %w", err)
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	// Execute, retrying transient failures of each model call according to
+	// the step's retry policy. A streamed call is retried only until it has
+	// sent part of its answer, which a retry would send again.
+	complete := func(req *CompletionRequest) (*CompletionResponse, error) {
+		var resp *CompletionResponse
+		var stream *retryStreamHandler
+		attempts, err := r.withRetry(ctx, step.Name(), getRetryPolicy(step), func() error {
+			var err error
+			if ctx.Handler != nil && r.config.EnableStreaming {
+				stream = &retryStreamHandler{StreamHandler: r.streamHandler(ctx, filters)}
+				resp, err = provider.CompleteStream(ctx.Context, req, stream)
+				if err != nil && stream.streamed {
+					err = finalError{err}
+				}
+			} else {
+				resp, err = provider.Complete(ctx.Context, req)
+			}
+			return err
+		})
+		if err != nil && stream != nil && stream.err != nil {
+			stream.StreamHandler.OnError(stream.err)
+		}
+		stepResult.Attempts += attempts
+		return resp, err
+	}
+	resp, usage, err := r.runToolLoop(&toolCtx, agent, req, resolver, complete)
+
+	if err == nil {
+		stepResult.TokensUsed = usage
+		if schema != nil {
+			var repairUsage TokenUsage
+			resp.Content, repairUsage, stepResult.Repairs, err = r.enforceOutputSchema(ctx, provider, req, resp.Content, schema, getRepairAttempts(step, agent))
+			stepResult.TokensUsed.Add(repairUsage)
+		}
+		ctx.addTokens(stepResult.TokensUsed)
+	}
+	stepResult.Model = servedModel(agentProvider, model)
+	r.noteNondeterminism(ctx.Context, step.Name(), agent, req, model, stepResult.Model)
+
 	stepResult.EndTime = time.Now()
 	stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
 
@@ -231,13 +545,34 @@ func (r *Runtime) executeStep(ctx *ExecutionContext, step *ast.StepEntity, resol
 
 	// Also store in a structured format for property access
 	ctx.SetStepOutput(step.Name()+".output", resp.Content)
-	ctx.SetStepOutput(step.Name()+".tokens", resp.Usage)
+	ctx.SetStepOutput(step.Name()+".tokens", stepResult.TokensUsed)
+	ctx.remember(agent, memory, prompt, resp.Content)
+
+	// Keep reasoning separate from the answer; downstream steps opt in with step("x").reasoning
+	if !r.config.RedactReasoning {
+		stepResult.Reasoning = resp.Reasoning
+		ctx.SetStepOutput(step.Name()+".reasoning", resp.Reasoning)
+	}
+
+	if cacheKey != "" {
+		r.storeStepResult(ctx.Context, cacheKey, cacheTTL, stepResult)
+	}
 
 	return stepResult, nil
 }
 
-// resolveStepAgent resolves the agent for a step.
+// resolveStepAgent resolves the agent for a step, with the settings of the
+// execution's matrix combination, if any.
 func (r *Runtime) resolveStepAgent(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver) (ast.Entity, error) {
+	agent, err := r.lookupStepAgent(step, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.matrixAgent(agent), nil
+}
+
+// lookupStepAgent looks up the agent a step uses.
+func (r *Runtime) lookupStepAgent(step *ast.StepEntity, resolver *Resolver) (ast.Entity, error) {
 	useProp, ok := step.GetProperty("use")
 	if !ok {
 		return nil, fmt.Errorf("step %q has no 'use' property", step.Name())
@@ -0,0 +1,191 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Error classes that retry policies can match with `on: [...]`.
+const (
+	ErrorClassTimeout     = "timeout"
+	ErrorClassRateLimit   = "rate_limit"
+	ErrorClassServerError = "server_error"
+	ErrorClassNetwork     = "network"
+	ErrorClassOther       = "other"
+)
+
+// defaultRetryDelay is the base delay used when a retry policy does not set one.
+const defaultRetryDelay = time.Second
+
+// maxRetryDelay caps the linear and exponential backoff of a retry policy,
+// unless its base delay is longer.
+const maxRetryDelay = 60 * time.Second
+
+// classifyError maps an execution error to a retry error class.
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimit
+		case apiErr.StatusCode == http.StatusRequestTimeout, apiErr.StatusCode == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case apiErr.StatusCode >= 500:
+			return ErrorClassServerError
+		}
+		return ErrorClassOther
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return ErrorClassNetwork
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "rate limit"):
+		return ErrorClassRateLimit
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"):
+		return ErrorClassTimeout
+	}
+	return ErrorClassOther
+}
+
+// getRetryPolicy returns the retry policy declared on a step, if any.
+func getRetryPolicy(step *ast.StepEntity) *ast.RetryValue {
+	if prop, ok := step.GetProperty("retry"); ok {
+		if policy, ok := prop.(ast.RetryValue); ok {
+			return &policy
+		}
+	}
+	return nil
+}
+
+// shouldRetry reports whether an error class is covered by the policy.
+func shouldRetry(policy *ast.RetryValue, class string) bool {
+	if len(policy.On) == 0 {
+		return true
+	}
+	for _, c := range policy.On {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before the given retry attempt
+// (1-based). The parser rejects invalid delays; policies built otherwise
+// with one use the default.
+func retryDelay(policy *ast.RetryValue, attempt int) time.Duration {
+	base := defaultRetryDelay
+	if d, err := time.ParseDuration(policy.Delay); err == nil && d > 0 {
+		base = d
+	}
+
+	limit := max(maxRetryDelay, base)
+	switch policy.Backoff {
+	case "constant":
+		return base
+	case "linear":
+		if attempt > 1 && base > limit/time.Duration(attempt) {
+			return limit
+		}
+		return base * time.Duration(attempt)
+	default:
+		// Double the delay per attempt, stopping at the limit before the
+		// multiplication could overflow
+		delay := base
+		for i := 1; i < attempt && delay < limit; i++ {
+			delay *= 2
+		}
+		return min(delay, limit)
+	}
+}
+
+// finalError marks an error that must not be retried, such as that of a
+// streamed attempt that already sent part of its answer to the handler.
+type finalError struct {
+	error
+}
+
+func (e finalError) Unwrap() error {
+	return e.error
+}
+
+// withRetry runs fn, retrying failures that match the policy with backoff.
+// A nil policy runs fn exactly once, and a finalError is never retried. It
+// returns the number of attempts made.
+func (r *Runtime) withRetry(ctx *ExecutionContext, name string, policy *ast.RetryValue, fn func() error) (int, error) {
+	attempts := 0
+	for {
+		attempts++
+		err := fn()
+		if err == nil {
+			return attempts, nil
+		}
+		var final finalError
+		if errors.As(err, &final) {
+			return attempts, final.error
+		}
+
+		if policy == nil || attempts > policy.MaxAttempts || ctx.Context.Err() != nil {
+			return attempts, err
+		}
+		class := classifyError(err)
+		if !shouldRetry(policy, class) {
+			return attempts, err
+		}
+
+		delay := retryDelay(policy, attempts)
+
+		ctx.EmitProgress(ProgressEvent{
+			Type:    ProgressTypeStep,
+			Message: fmt.Sprintf("Retrying %s after %s error (attempt %d/%d, waiting %s)", name, class, attempts+1, policy.MaxAttempts+1, delay),
+			Step:    name,
+		})
+
+		select {
+		case <-ctx.Context.Done():
+			return attempts, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryStreamHandler forwards a streamed attempt to the step's handler,
+// noting whether it sent any of its answer and holding back its error,
+// which is reported only if the step gives up.
+type retryStreamHandler struct {
+	StreamHandler
+	streamed bool
+	err      error
+}
+
+func (h *retryStreamHandler) OnChunk(chunk StreamChunk) {
+	h.streamed = true
+	h.StreamHandler.OnChunk(chunk)
+}
+
+func (h *retryStreamHandler) OnError(err error) {
+	h.err = err
+}
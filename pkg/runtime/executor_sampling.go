@@ -0,0 +1,309 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// Aggregation strategies for self-consistency sampling.
+const (
+	AggregateMajority = "majority"
+	AggregateJudge    = "judge"
+	AggregateCluster  = "cluster"
+)
+
+// sampleMetadataKey is the request metadata key of a sample's index.
+const sampleMetadataKey = "sample"
+
+// SampleResult holds a single completion drawn during self-consistency sampling.
+type SampleResult struct {
+	Content string     `json:"content"`
+	Usage   TokenUsage `json:"usage"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// samplingConfig describes the sampling options declared on a step:
+//
+//	step "answer" {
+//	  use: agent("solver")
+//	  samples: 5
+//	  aggregate: "majority"   # or "judge" with judge: agent("x"), or "cluster"
+//	}
+type samplingConfig struct {
+	step      string
+	samples   int
+	aggregate string
+	judge     ast.Value
+	retry     *ast.RetryValue
+}
+
+// getSamplingConfig reads the sampling options from a step.
+// It returns nil when the step does not request more than one sample.
+func getSamplingConfig(step *ast.StepEntity) (*samplingConfig, error) {
+	samplesProp, ok := step.GetProperty("samples")
+	if !ok {
+		return nil, nil
+	}
+	nv, ok := samplesProp.(ast.NumberValue)
+	if !ok {
+		return nil, fmt.Errorf("step %q: 'samples' must be a number", step.Name())
+	}
+	if nv.Value < 1 || nv.Value != math.Trunc(nv.Value) {
+		return nil, fmt.Errorf("step %q: 'samples' must be a positive integer", step.Name())
+	}
+	if nv.Value == 1 {
+		return nil, nil
+	}
+
+	cfg := &samplingConfig{
+		step:      step.Name(),
+		samples:   int(nv.Value),
+		aggregate: AggregateMajority,
+		retry:     getRetryPolicy(step),
+	}
+
+	if aggProp, ok := step.GetProperty("aggregate"); ok {
+		sv, ok := aggProp.(ast.StringValue)
+		if !ok {
+			return nil, fmt.Errorf("step %q: 'aggregate' must be a string", step.Name())
+		}
+		cfg.aggregate = sv.Value
+	}
+
+	switch cfg.aggregate {
+	case AggregateMajority, AggregateCluster:
+	case AggregateJudge:
+		judge, ok := step.GetProperty("judge")
+		if !ok {
+			return nil, fmt.Errorf("step %q: aggregate %q requires a 'judge' agent", step.Name(), cfg.aggregate)
+		}
+		cfg.judge = judge
+	default:
+		return nil, fmt.Errorf("step %q: unknown aggregate %q", step.Name(), cfg.aggregate)
+	}
+
+	return cfg, nil
+}
+
+// executeSampling draws cfg.samples completions concurrently and aggregates them
+// into a single response. The returned usage covers every sample plus any
+// tokens spent on aggregation. The samples' progress events are emitted once
+// they are all drawn, on the calling goroutine.
+func (r *Runtime) executeSampling(ctx *ExecutionContext, provider LLMProvider, req *CompletionRequest, cfg *samplingConfig, resolver *Resolver) (string, []*SampleResult, TokenUsage, error) {
+	var usage TokenUsage
+
+	if req.Temperature <= 0 {
+		return "", nil, usage, fmt.Errorf("self-consistency sampling requires temperature > 0")
+	}
+
+	samples := make([]*SampleResult, cfg.samples)
+	errs := make([]error, cfg.samples)
+	events := make([]*BufferedStreamHandler, cfg.samples)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.samples; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			events[idx] = &BufferedStreamHandler{}
+			sc := *ctx
+			sc.Handler = events[idx]
+			sc.inspector = nil
+			sampleReq := *req
+			sampleReq.Metadata = make(map[string]string, len(req.Metadata)+1)
+			for k, v := range req.Metadata {
+				sampleReq.Metadata[k] = v
+			}
+			sampleReq.Metadata[sampleMetadataKey] = strconv.Itoa(idx)
+			var resp *CompletionResponse
+			_, err := r.withRetry(&sc, cfg.step, cfg.retry, func() error {
+				var err error
+				resp, err = provider.Complete(ctx.Context, &sampleReq)
+				return err
+			})
+			if err != nil {
+				samples[idx] = &SampleResult{Error: err.Error()}
+				errs[idx] = err
+				return
+			}
+			samples[idx] = &SampleResult{Content: resp.Content, Usage: resp.Usage}
+		}(i)
+	}
+	wg.Wait()
+
+	var candidates []string
+	var firstErr error
+	for i, s := range samples {
+		for _, event := range events[i].Events {
+			ctx.EmitProgress(event)
+		}
+		usage.Add(s.Usage)
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		candidates = append(candidates, s.Content)
+	}
+	if len(candidates) == 0 {
+		return "", samples, usage, fmt.Errorf("all %d samples failed: %w", cfg.samples, firstErr)
+	}
+
+	ctx.EmitProgress(ProgressEvent{
+		Type:    ProgressTypeStep,
+		Message: fmt.Sprintf("Aggregating %d samples (%s)", len(candidates), cfg.aggregate),
+	})
+
+	switch cfg.aggregate {
+	case AggregateJudge:
+		content, judgeUsage, err := r.aggregateByJudge(ctx, cfg.judge, req, candidates, resolver)
+		usage.Add(judgeUsage)
+		return content, samples, usage, err
+
+	case AggregateCluster:
+		content, err := r.aggregateByCluster(ctx, provider, candidates)
+		return content, samples, usage, err
+
+	default:
+		return aggregateByMajority(candidates), samples, usage, nil
+	}
+}
+
+// aggregateByMajority returns the most frequent candidate, comparing answers
+// after trimming whitespace and ignoring case. Ties go to the candidate seen
+// first.
+func aggregateByMajority(candidates []string) string {
+	keys := make([]string, len(candidates))
+	counts := make(map[string]int)
+	for i, c := range candidates {
+		keys[i] = strings.ToLower(strings.TrimSpace(c))
+		counts[keys[i]]++
+	}
+	best := 0
+	for i, key := range keys {
+		if counts[key] > counts[keys[best]] {
+			best = i
+		}
+	}
+	return candidates[best]
+}
+
+var judgeChoicePattern = regexp.MustCompile(`\d+`)
+
+// aggregateByJudge asks a judge agent to pick the best candidate.
+func (r *Runtime) aggregateByJudge(ctx *ExecutionContext, judgeValue ast.Value, req *CompletionRequest, candidates []string, resolver *Resolver) (string, TokenUsage, error) {
+	var usage TokenUsage
+
+	var judgeName string
+	switch v := judgeValue.(type) {
+	case ast.ReferenceValue:
+		if v.Type != "agent" {
+			return "", usage, fmt.Errorf("judge must be an agent reference, got %s", v.Type)
+		}
+		judgeName = v.Name
+	case ast.StringValue:
+		judgeName = v.Value
+	default:
+		return "", usage, fmt.Errorf("cannot resolve judge agent from %T", judgeValue)
+	}
+
+	judge, err := resolver.workspace.GetAgent(judgeName)
+	if err != nil {
+		return "", usage, fmt.Errorf("judge: %w", err)
+	}
+
+	systemPrompt, err := r.getAgentSystemPrompt(judge, resolver)
+	if err != nil {
+		return "", usage, fmt.Errorf("judge: %w", err)
+	}
+	provider, model, err := r.getAgentProvider(judge)
+	if err != nil {
+		return "", usage, fmt.Errorf("judge: %w", err)
+	}
+
+	var sb strings.Builder
+	if len(req.Messages) > 0 {
+		sb.WriteString("## Task\n\n")
+		sb.WriteString(req.Messages[len(req.Messages)-1].Content)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("## Candidates\n\n")
+	for i, c := range candidates {
+		fmt.Fprintf(&sb, "### Candidate %d\n\n%s\n\n", i+1, c)
+	}
+	sb.WriteString("Reply with the number of the best candidate only.")
+
+	resp, err := provider.Complete(ctx.Context, &CompletionRequest{
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Messages:     []Message{{Role: RoleUser, Content: sb.String()}},
+		Temperature:  0,
+	})
+	if err != nil {
+		return "", usage, fmt.Errorf("judge: %w", err)
+	}
+	usage = resp.Usage
+
+	match := judgeChoicePattern.FindString(resp.Content)
+	choice, err := strconv.Atoi(match)
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return "", usage, fmt.Errorf("judge returned an invalid choice: %q", resp.Content)
+	}
+
+	return candidates[choice-1], usage, nil
+}
+
+// aggregateByCluster embeds the candidates and returns the medoid: the candidate
+// with the highest total cosine similarity to all others.
+func (r *Runtime) aggregateByCluster(ctx *ExecutionContext, provider LLMProvider, candidates []string) (string, error) {
+	embedder := r.embedder(provider)
+	if embedder == nil {
+		return "", fmt.Errorf("cluster aggregation requires a provider that supports embeddings")
+	}
+
+	vectors, err := embedder.Embed(ctx.Context, candidates)
+	if err != nil {
+		return "", fmt.Errorf("failed to embed samples: %w", err)
+	}
+	if len(vectors) != len(candidates) {
+		return "", fmt.Errorf("expected %d embeddings, got %d", len(candidates), len(vectors))
+	}
+
+	best, bestScore := 0, math.Inf(-1)
+	for i := range vectors {
+		var score float64
+		for j := range vectors {
+			if i != j {
+				score += workspace.CosineSimilarity(vectors[i], vectors[j])
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return candidates[best], nil
+}
+
+// embedder returns provider if it supports embeddings, and otherwise any
+// registered provider that does, or nil if none does.
+func (r *Runtime) embedder(provider LLMProvider) EmbeddingProvider {
+	if embedder, ok := unwrapProvider(provider).(EmbeddingProvider); ok {
+		return embedder
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.providers {
+		if e, ok := p.(EmbeddingProvider); ok {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// defaultRepairAttempts is how many times the model is re-prompted to fix
+// output that does not match the output schema.
+const defaultRepairAttempts = 2
+
+// getOutputSchema returns the output schema declared on the step, or on its
+// agent, as a JSON Schema document. It returns nil if neither declares one.
+//
+// The schema can be written as JSON Schema (`{ type: "object" properties: {...} }`),
+// as a JSON string, or in the typed parameter shorthand used by tools
+// (`{ name: string required, score: number }`).
+func getOutputSchema(entities ...ast.Entity) (map[string]interface{}, error) {
+	for _, e := range entities {
+		if e == nil {
+			continue
+		}
+		prop, ok := e.GetProperty("output_schema")
+		if !ok {
+			continue
+		}
+		schema, err := schemaFromValue(prop)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output_schema on %s %q: %w", e.Type(), e.Name(), err)
+		}
+		return schema, nil
+	}
+	return nil, nil
+}
+
+// getRepairAttempts returns the repair attempts declared on the step or agent.
+func getRepairAttempts(entities ...ast.Entity) int {
+	for _, e := range entities {
+		if e == nil {
+			continue
+		}
+		if prop, ok := e.GetProperty("repair_attempts"); ok {
+			if nv, ok := prop.(ast.NumberValue); ok && nv.Value >= 0 {
+				return int(nv.Value)
+			}
+		}
+	}
+	return defaultRepairAttempts
+}
+
+// schemaFromValue converts an output_schema property to a JSON Schema map.
+func schemaFromValue(v ast.Value) (map[string]interface{}, error) {
+	switch val := v.(type) {
+	case ast.StringValue:
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(val.Value), &schema); err != nil {
+			return nil, fmt.Errorf("schema string is not valid JSON: %w", err)
+		}
+		return schema, nil
+	case ast.ObjectValue:
+		if _, hasType := val.Properties["type"]; !hasType && isTypedShorthand(val) {
+			return shorthandSchema(val), nil
+		}
+		schema, ok := schemaLiteral(val).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("schema must be an object")
+		}
+		return schema, nil
+	}
+	return nil, fmt.Errorf("schema must be an object or JSON string, got %T", v)
+}
+
+func isTypedShorthand(obj ast.ObjectValue) bool {
+	for _, v := range obj.Properties {
+		if _, ok := v.(ast.TypedParameterValue); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shorthandSchema builds an object schema from typed parameter declarations.
+func shorthandSchema(obj ast.ObjectValue) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []interface{}
+	for name, v := range obj.Properties {
+		tp, ok := v.(ast.TypedParameterValue)
+		if !ok {
+			properties[name] = schemaLiteral(v)
+			continue
+		}
+		field := map[string]interface{}{"type": tp.ParamType}
+		if tp.ParamType == "enum" {
+			field = map[string]interface{}{"type": "string"}
+			enum := make([]interface{}, len(tp.EnumValues))
+			for i, e := range tp.EnumValues {
+				enum[i] = e
+			}
+			field["enum"] = enum
+		}
+		if tp.ParamType == "bool" {
+			field["type"] = "boolean"
+		}
+		properties[name] = field
+		if tp.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Slice(required, func(i, j int) bool { return required[i].(string) < required[j].(string) })
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaLiteral converts literal AST values to plain Go values.
+func schemaLiteral(v ast.Value) interface{} {
+	switch val := v.(type) {
+	case ast.StringValue:
+		return val.Value
+	case ast.NumberValue:
+		return val.Value
+	case ast.BoolValue:
+		return val.Value
+	case ast.ArrayValue:
+		elems := make([]interface{}, len(val.Elements))
+		for i, e := range val.Elements {
+			elems[i] = schemaLiteral(e)
+		}
+		return elems
+	case ast.ObjectValue:
+		if _, hasType := val.Properties["type"]; !hasType && isTypedShorthand(val) {
+			return shorthandSchema(val)
+		}
+		obj := make(map[string]interface{}, len(val.Properties))
+		for k, e := range val.Properties {
+			obj[k] = schemaLiteral(e)
+		}
+		return obj
+	}
+	return nil
+}
+
+// parseJSONOutput parses model output as JSON, ignoring a surrounding
+// Markdown code fence.
+func parseJSONOutput(output string) (interface{}, error) {
+	s := strings.TrimSpace(output)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		if nl := strings.IndexByte(s, '\n'); nl >= 0 {
+			s = s[nl+1:]
+		}
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return nil, fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	return value, nil
+}
+
+// validateOutput checks that output is JSON matching the schema.
+func validateOutput(output string, schema map[string]interface{}) error {
+	value, err := parseJSONOutput(output)
+	if err != nil {
+		return err
+	}
+	return validateSchema(value, schema, "$")
+}
+
+// validateSchema validates a JSON value against a JSON Schema subset: type,
+// properties, required, additionalProperties (false), items, enum,
+// minimum/maximum, minLength/maxLength, and minItems/maxItems.
+func validateSchema(value interface{}, schema map[string]interface{}, path string) error {
+	if t, ok := schema["type"].(string); ok {
+		if err := checkSchemaType(value, t, path); err != nil {
+			return err
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				name := fmt.Sprint(r)
+				if _, ok := v[name]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propSchema, ok := props[k].(map[string]interface{})
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := validateSchema(v[k], propSchema, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: expected at least %v items, got %d", path, min, len(v))
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: expected at most %v items, got %d", path, max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, elem := range v {
+				if err := validateSchema(elem, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: expected at least %v characters, got %d", path, min, len(v))
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: expected at most %v characters, got %d", path, max, len(v))
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, v, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%s: %v is greater than maximum %v", path, v, max)
+		}
+	}
+	return nil
+}
+
+func checkSchemaType(value interface{}, t, path string) error {
+	ok := false
+	switch t {
+	case "object":
+		_, ok = value.(map[string]interface{})
+	case "array":
+		_, ok = value.([]interface{})
+	case "string":
+		_, ok = value.(string)
+	case "number":
+		_, ok = value.(float64)
+	case "integer":
+		f, isNum := value.(float64)
+		ok = isNum && f == float64(int64(f))
+	case "boolean", "bool":
+		_, ok = value.(bool)
+	case "null":
+		ok = value == nil
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, t)
+	}
+	if !ok {
+		return fmt.Errorf("%s: expected %s, got %s", path, t, jsonTypeName(value))
+	}
+	return nil
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// enforceOutputSchema validates content against the schema and, while it does
+// not match, re-prompts the model with the validation error up to maxRepairs
+// times. It returns the final content, the tokens used by repair requests, and
+// the number of repairs made.
+func (r *Runtime) enforceOutputSchema(ctx *ExecutionContext, provider LLMProvider, req *CompletionRequest, content string, schema map[string]interface{}, maxRepairs int) (string, TokenUsage, int, error) {
+	var usage TokenUsage
+	err := validateOutput(content, schema)
+	if err == nil {
+		return content, usage, 0, nil
+	}
+
+	schemaJSON, _ := json.Marshal(schema)
+	repairReq := *req
+	repairReq.Messages = append([]Message(nil), req.Messages...)
+
+	for repair := 1; repair <= maxRepairs; repair++ {
+		ctx.EmitProgress(ProgressEvent{
+			Type:    ProgressTypeStep,
+			Message: fmt.Sprintf("Output does not match schema, asking model to repair (attempt %d/%d): %v", repair, maxRepairs, err),
+		})
+
+		repairReq.Messages = append(repairReq.Messages,
+			Message{Role: RoleAssistant, Content: content},
+			Message{Role: RoleUser, Content: fmt.Sprintf(
+				"Your response does not match the required output schema: %v\n\nSchema:\n%s\n\nRespond again with only JSON that matches the schema.",
+				err, schemaJSON)},
+		)
+
+		resp, callErr := provider.Complete(ctx.Context, &repairReq)
+		if callErr != nil {
+			return content, usage, repair, fmt.Errorf("output repair request failed: %w", callErr)
+		}
+		usage.Add(resp.Usage)
+		content = resp.Content
+
+		if err = validateOutput(content, schema); err == nil {
+			return content, usage, repair, nil
+		}
+	}
+
+	return content, usage, maxRepairs, fmt.Errorf("output does not match output_schema after %d repair attempts: %w", maxRepairs, err)
+}
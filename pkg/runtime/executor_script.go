@@ -2,155 +2,432 @@ package runtime
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
 )
 
-// executeScript executes a script entity.
+// scriptInterpreters maps script languages to the default interpreter and
+// the extension of the file the code is written to.
+var scriptInterpreters = map[string]struct{ command, ext string }{
+	"python":     {"python3", ".py"},
+	"python3":    {"python3", ".py"},
+	"bash":       {"bash", ".sh"},
+	"sh":         {"sh", ".sh"},
+	"node":       {"node", ".js"},
+	"javascript": {"node", ".js"},
+	"js":         {"node", ".js"},
+}
+
+// scriptEnvAllowlist is the host environment passed to scripts; anything
+// else must be listed in `sandbox.env`.
+var scriptEnvAllowlist = []string{"PATH", "LANG", "LC_ALL", "TZ"}
+
+// ScriptLimits are the resource limits of a script run.
+type ScriptLimits struct {
+	// Timeout kills the script when exceeded; 0 means the execution timeout
+	Timeout time.Duration
+
+	// Memory caps the address space in bytes, where the OS allows; 0 means
+	// no limit
+	Memory int64
+}
+
+// ScriptSandbox restricts what a script can reach.
+type ScriptSandbox struct {
+	// Network allows network access. Without it the script runs in an empty
+	// network namespace, and fails to start where that is unsupported.
+	Network bool
+
+	// Env lists host environment variables passed through to the script
+	Env []string
+}
+
+// ScriptSpec describes one script run.
+type ScriptSpec struct {
+	Name     string
+	Language string
+	// Interpreter overrides the language default (e.g. "python3.12")
+	Interpreter string
+	Code        string
+	Params      map[string]interface{}
+	Limits      ScriptLimits
+	Sandbox     ScriptSandbox
+
+	// WorkDir is the directory the script runs in; scripts without one run
+	// in a temporary directory of their own
+	WorkDir string
+}
+
+// ScriptResult is the outcome of a script run.
+type ScriptResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+
+	// Output is the JSON the script wrote to $LS_OUTPUT, or Stdout if it
+	// wrote none
+	Output   interface{}
+	Duration time.Duration
+}
+
+// executeScript executes a script entity. Parameters come from the script's
+// `parameters` defaults and, when the input is an object, from the input.
 func (r *Runtime) executeScript(ctx *ExecutionContext, entity ast.Entity) (*ExecutionResult, error) {
 	result := &ExecutionResult{
 		Metadata: make(map[string]string),
 	}
-	startTime := timeNow()
 
 	resolver := NewResolver(ctx)
 
-	// Get language
+	var args map[string]interface{}
+	if input, ok := ctx.GetVariable("input"); ok {
+		args, _ = input.(map[string]interface{})
+	}
+
+	spec, err := scriptSpec(entity, resolver, args)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := runScript(ctx.Context, spec)
+	if run != nil {
+		result.Metadata["exit_code"] = strconv.Itoa(run.ExitCode)
+		result.Duration = run.Duration
+	}
+	if err != nil {
+		result.Error = err
+		return result, err
+	}
+
+	result.Success = true
+	result.Output = run.Output
+
+	return result, nil
+}
+
+// scriptSpec builds the run of a script entity. args override the declared
+// parameter defaults.
+func scriptSpec(entity ast.Entity, resolver *Resolver, args map[string]interface{}) (*ScriptSpec, error) {
+	spec := &ScriptSpec{
+		Name:    entity.Name(),
+		Params:  make(map[string]interface{}),
+		Sandbox: ScriptSandbox{Network: true},
+		WorkDir: resolver.ctx.WorkDir,
+	}
+
 	langProp, ok := entity.GetProperty("language")
 	if !ok {
 		return nil, fmt.Errorf("script %q missing 'language' property", entity.Name())
 	}
-	lang, _ := resolver.ResolveString(langProp)
+	spec.Language, _ = resolver.ResolveString(langProp)
+	if prop, ok := entity.GetProperty("runtime"); ok {
+		spec.Interpreter, _ = resolver.ResolveString(prop)
+	}
 
-	// Get code
-	var code string
 	if codeProp, ok := entity.GetProperty("code"); ok {
-		code, _ = resolver.ResolveString(codeProp)
+		spec.Code, _ = resolver.ResolveString(codeProp)
 	} else if pathProp, ok := entity.GetProperty("path"); ok {
 		path, _ := resolver.ResolveString(pathProp)
 		content, err := os.ReadFile(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read script file %q: %w", path, err)
 		}
-		code = string(content)
+		spec.Code = string(content)
 	}
-
-	if code == "" {
+	if spec.Code == "" {
 		return nil, fmt.Errorf("script %q has no code or path", entity.Name())
 	}
 
-	// Execute based on language
-	var output string
-	var err error
-
-	// Resolve parameters
-	params := make(map[string]interface{})
-	if paramsProp, ok := entity.GetProperty("parameters"); ok {
-		resolvedParams, err := resolver.Resolve(paramsProp)
-		if err == nil {
-			if m, ok := resolvedParams.(map[string]interface{}); ok {
-				params = m
+	if prop, ok := entity.GetProperty("parameters"); ok {
+		if obj, ok := prop.(ast.ObjectValue); ok {
+			for name, value := range obj.Properties {
+				if param, ok := value.(ast.TypedParameterValue); ok {
+					if param.Default == nil {
+						continue
+					}
+					value = param.Default
+				}
+				resolved, err := resolver.Resolve(value)
+				if err != nil {
+					return nil, fmt.Errorf("script %q parameter %q: %w", entity.Name(), name, err)
+				}
+				spec.Params[name] = resolved
 			}
 		}
 	}
+	for name, value := range args {
+		spec.Params[name] = value
+	}
 
-	switch lang {
-	case "python", "python3":
-		output, err = r.executePythonScript(ctx, code, params, resolver)
-	case "bash", "sh":
-		output, err = r.executeShellScript(ctx, code, params, resolver)
-	default:
-		return nil, fmt.Errorf("unsupported script language: %s", lang)
+	// timeout may be set directly or under limits
+	limits := make(map[string]ast.Value)
+	if prop, ok := entity.GetProperty("timeout"); ok {
+		limits["timeout"] = prop
+	}
+	if prop, ok := entity.GetProperty("limits"); ok {
+		if obj, ok := prop.(ast.ObjectValue); ok {
+			for k, v := range obj.Properties {
+				limits[k] = v
+			}
+		}
+	}
+	if v, ok := limits["timeout"]; ok {
+		s, _ := resolver.ResolveString(v)
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("script %q: invalid timeout %q: %w", entity.Name(), s, err)
+		}
+		spec.Limits.Timeout = d
+	}
+	if v, ok := limits["memory"]; ok {
+		s, _ := resolver.ResolveString(v)
+		n, err := parseByteSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("script %q: %w", entity.Name(), err)
+		}
+		spec.Limits.Memory = n
 	}
 
-	if err != nil {
-		result.Error = err
-		return result, err
+	if prop, ok := entity.GetProperty("sandbox"); ok {
+		if obj, ok := prop.(ast.ObjectValue); ok {
+			if v, ok := obj.Properties["network"].(ast.BoolValue); ok {
+				spec.Sandbox.Network = v.Value
+			}
+			if arr, ok := obj.Properties["env"].(ast.ArrayValue); ok {
+				for _, elem := range arr.Elements {
+					if sv, ok := elem.(ast.StringValue); ok {
+						spec.Sandbox.Env = append(spec.Sandbox.Env, sv.Value)
+					}
+				}
+			}
+		}
 	}
 
-	result.Success = true
-	result.Output = output
-	result.Duration = time.Since(startTime)
+	return spec, nil
+}
 
-	return result, nil
+// parseByteSize parses sizes like "128MB", "1GB", "512k", or a byte count.
+func parseByteSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory limit %q", s)
+	}
+	return n * multiplier, nil
 }
 
-// executePythonScript executes Python code in a temporary file.
-func (r *Runtime) executePythonScript(ctx *ExecutionContext, code string, params map[string]interface{}, resolver *Resolver) (string, error) {
-	// Create temporary file
-	tmpDir := os.TempDir()
-	tmpFile := filepath.Join(tmpDir, fmt.Sprintf("ls_script_%d.py", timeNow().UnixNano()))
+// runScript runs a script in a subprocess, in spec.WorkDir or its own
+// temporary working directory, and with a restricted environment. Parameters are passed as
+// LS_PARAM_<NAME> variables and as JSON in LS_PARAMS; a script may write
+// JSON to the file named by LS_OUTPUT to return structured output.
+func runScript(ctx context.Context, spec *ScriptSpec) (*ScriptResult, error) {
+	interp, ok := scriptInterpreters[spec.Language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported script language: %s", spec.Language)
+	}
+	command := interp.command
+	if spec.Interpreter != "" {
+		command = spec.Interpreter
+	}
 
-	if err := os.WriteFile(tmpFile, []byte(code), 0644); err != nil {
-		return "", fmt.Errorf("failed to create temporary script file: %w", err)
+	// The script file and its output file are private to this run, so
+	// concurrent scripts sharing a working directory don't collide
+	scriptDir, err := os.MkdirTemp(spec.WorkDir, ".ls_script_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script directory: %w", err)
 	}
 	defer func() {
-		if err := os.Remove(tmpFile); err != nil {
-			log.Printf("failed to remove temporary script file %s: %v", tmpFile, err)
+		if err := os.RemoveAll(scriptDir); err != nil {
+			logAt(ctx, slog.LevelWarn, "failed to remove script directory", "dir", scriptDir, "error", err)
 		}
 	}()
+	workDir := spec.WorkDir
+	if workDir == "" {
+		workDir = scriptDir
+	}
 
-	// Execute python
-	cmd := exec.CommandContext(ctx.Context, "python3", tmpFile)
+	scriptFile := filepath.Join(scriptDir, "script"+interp.ext)
+	if err := os.WriteFile(scriptFile, []byte(spec.Code), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+	outputFile := filepath.Join(scriptDir, "output.json")
 
-	// Pass parameters as environment variables
-	cmd.Env = os.Environ()
-	for k, v := range params {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("LS_PARAM_%s=%s", strings.ToUpper(k), toString(v)))
+	if spec.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.Limits.Timeout)
+		defer cancel()
 	}
 
-	// Also pass as a single JSON env var
-	if len(params) > 0 {
-		if data, err := json.Marshal(params); err == nil {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("LS_PARAMS=%s", string(data)))
-		}
+	args := []string{scriptFile}
+	if spec.Limits.Memory > 0 && interp.command == "node" {
+		// V8 reserves far more address space than it uses, so cap the heap
+		args = append([]string{fmt.Sprintf("--max-old-space-size=%d", spec.Limits.Memory>>20)}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Dir = workDir
+	cmd.Env = scriptEnv(spec, workDir, outputFile)
+	if spec.Limits.Memory > 0 && interp.command != "node" {
+		limitMemory(cmd, spec.Limits.Memory)
+	}
+	if err := sandboxProcess(cmd, spec.Sandbox); err != nil {
+		return nil, fmt.Errorf("script %q: %w", spec.Name, err)
 	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
-	if err != nil {
-		return stdout.String(), fmt.Errorf("python script failed: %w\nStderr: %s", err, stderr.String())
+	start := timeNow()
+	runErr := cmd.Run()
+	result := &ScriptResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+		Output:   stdout.String(),
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return result, fmt.Errorf("%s script timed out after %s", spec.Language, result.Duration.Round(time.Millisecond))
+		case errors.As(runErr, &exitErr):
+			return result, fmt.Errorf("%s script failed: %w\nStderr: %s", spec.Language, runErr, result.Stderr)
+		default:
+			return result, fmt.Errorf("failed to run %s script: %w", spec.Language, runErr)
+		}
 	}
 
-	return stdout.String(), nil
+	if data, err := os.ReadFile(outputFile); err == nil {
+		var output interface{}
+		if err := json.Unmarshal(data, &output); err != nil {
+			return result, fmt.Errorf("script %q wrote invalid JSON to LS_OUTPUT: %w", spec.Name, err)
+		}
+		result.Output = output
+	}
+
+	return result, nil
 }
 
-// executeShellScript executes shell code.
-func (r *Runtime) executeShellScript(ctx *ExecutionContext, code string, params map[string]interface{}, resolver *Resolver) (string, error) {
-	cmd := exec.CommandContext(ctx.Context, "sh", "-c", code)
+// scriptEnv builds the environment of a script: the allowlisted host
+// variables, HOME and TMPDIR pointing at the working directory, and the
+// parameters.
+func scriptEnv(spec *ScriptSpec, workDir, outputFile string) []string {
+	var env []string
+	for _, name := range append(append([]string(nil), scriptEnvAllowlist...), spec.Sandbox.Env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	env = append(env,
+		"HOME="+workDir,
+		"TMPDIR="+workDir,
+		"LS_OUTPUT="+outputFile,
+	)
 
-	// Pass parameters as environment variables
-	cmd.Env = os.Environ()
-	for k, v := range params {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("LS_PARAM_%s=%s", strings.ToUpper(k), toString(v)))
+	for k, v := range spec.Params {
+		env = append(env, fmt.Sprintf("LS_PARAM_%s=%s", strings.ToUpper(k), toString(v)))
+	}
+	if len(spec.Params) > 0 {
+		if data, err := json.Marshal(spec.Params); err == nil {
+			env = append(env, fmt.Sprintf("LS_PARAMS=%s", string(data)))
+		}
 	}
+	return env
+}
 
-	// Also pass as a single JSON env var
-	if len(params) > 0 {
-		if data, err := json.Marshal(params); err == nil {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("LS_PARAMS=%s", string(data)))
+// stepScript returns the script a step runs with
+// `execute: script("name")` or `execute: script("name") { param: value }`.
+func stepScript(step ast.Entity) (name string, args ast.Entity, ok bool) {
+	prop, found := step.GetProperty("execute")
+	if !found {
+		return "", nil, false
+	}
+	switch v := prop.(type) {
+	case ast.ReferenceValue:
+		if v.Type == "script" {
+			return v.Name, nil, true
+		}
+	case ast.MethodCallValue:
+		if sv, isStr := v.Object.(ast.StringValue); isStr && sv.Value == "script" {
+			return v.Method, v.InlineBody, true
 		}
 	}
+	return "", nil, false
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// executeScriptStep runs a pipeline step that executes a script instead of
+// calling a model.
+func (r *Runtime) executeScriptStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepResult *StepResult) (*StepResult, error) {
+	name, argsEntity, _ := stepScript(step)
+	fail := func(err error) (*StepResult, error) {
+		stepResult.Error = err
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		return stepResult, err
+	}
+
+	script, err := resolver.workspace.GetScript(name)
+	if err != nil {
+		return fail(err)
+	}
+
+	args := make(map[string]interface{})
+	if argsEntity != nil {
+		for key, value := range argsEntity.Properties() {
+			resolved, err := resolver.Resolve(value)
+			if err != nil {
+				return fail(fmt.Errorf("script argument %q: %w", key, err))
+			}
+			args[key] = resolved
+		}
+	}
 
-	err := cmd.Run()
+	spec, err := scriptSpec(script, resolver, args)
 	if err != nil {
-		return stdout.String(), fmt.Errorf("shell script failed: %w\nStderr: %s", err, stderr.String())
+		return fail(err)
 	}
+	run, err := runScript(ctx.Context, spec)
+	if err != nil {
+		return fail(err)
+	}
+
+	stepResult.Success = true
+	stepResult.Output = run.Output
+	stepResult.EndTime = time.Now()
+	stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+	ctx.SetStepOutput(step.Name(), run.Output)
+	ctx.SetStepOutput(step.Name()+".output", run.Output)
+	ctx.SetStepOutput(step.Name()+".stderr", run.Stderr)
 
-	return stdout.String(), nil
+	return stepResult, nil
 }
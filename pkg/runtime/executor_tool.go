@@ -2,18 +2,318 @@ package runtime
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os/exec"
+	"net/url"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
 )
 
-// executeShellCommand executes a shell command with arguments.
-func (r *Runtime) executeShellCommand(ctx *ExecutionContext, command string, args map[string]interface{}) (string, error) {
+// ToolHandler is a Go function that implements a tool. It receives the
+// arguments from the model's tool call and returns the tool result.
+type ToolHandler func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// DefaultMaxTurns is the number of model calls an agent may make to answer
+// when it does not set `max_turns`.
+const DefaultMaxTurns = 10
+
+// runToolLoop sends req with complete and runs the tool calls in each
+// response, feeding their results back, until the model gives a final answer.
+// The tool calls and their results are appended to req.Messages. It fails if the agent's
+// `max_turns` model calls are made without a final answer. The returned usage
+// covers every call.
+func (r *Runtime) runToolLoop(ctx *ExecutionContext, agent ast.Entity, req *CompletionRequest, resolver *Resolver, complete func(*CompletionRequest) (*CompletionResponse, error)) (*CompletionResponse, TokenUsage, error) {
+	var usage TokenUsage
+	maxTurns := r.getAgentMaxTurns(agent)
+	for turn := 0; turn < maxTurns; turn++ {
+		if err := ctx.Context.Err(); err != nil {
+			return nil, usage, err
+		}
+
+		resp, err := complete(req)
+		if err != nil {
+			return nil, usage, fmt.Errorf("LLM request failed: %w", err)
+		}
+		usage.Add(resp.Usage)
+		if len(resp.ToolCalls) == 0 || resp.FinishReason != FinishReasonToolUse {
+			return resp, usage, nil
+		}
+
+		req.Messages = append(req.Messages, Message{
+			Role:      RoleAssistant,
+			Content:   resp.Content,
+			ToolCalls: resp.ToolCalls,
+		})
+
+		for _, tc := range resp.ToolCalls {
+			ctx.EmitProgress(ProgressEvent{
+				Type:    ProgressTypeStep,
+				Message: fmt.Sprintf("Executing tool: %s", tc.Name),
+				Metadata: map[string]string{
+					"tool": tc.Name,
+				},
+			})
+
+			toolStart := time.Now()
+			toolResult, err := r.executeToolCall(ctx, tc, resolver)
+			inv := ToolInvocation{
+				Tool:      tc.Name,
+				Agent:     agent.Name(),
+				StartTime: toolStart,
+				Duration:  time.Since(toolStart),
+				Success:   err == nil,
+				BytesIn:   argumentsSize(tc.Arguments),
+			}
+			if err != nil {
+				inv.Error = err.Error()
+				// We report the error back to the LLM so it can try to fix it
+				toolResult = fmt.Sprintf("Error: %v", err)
+			} else {
+				inv.BytesOut = len(toString(toolResult))
+				ctx.Taint.Mark(toolResult)
+			}
+			r.toolMetrics.Record(inv)
+
+			req.Messages = append(req.Messages, Message{
+				Role:       RoleTool,
+				Content:    toString(toolResult),
+				ToolCallID: tc.ID,
+			})
+		}
+	}
+	return nil, usage, fmt.Errorf("agent %q did not give a final answer within %d turns (max_turns)", agent.Name(), maxTurns)
+}
+
+// toolInputSchema returns the JSON schema of a tool's or script's
+// `parameters`, which providers send to the model as the function's
+// parameters. Descriptions and defaults of typed parameters are kept so the
+// model knows how to fill them in.
+func toolInputSchema(entity ast.Entity) map[string]interface{} {
+	prop, ok := entity.GetProperty("parameters")
+	obj, isObj := prop.(ast.ObjectValue)
+	if !ok || !isObj {
+		return emptyToolSchema()
+	}
+
+	schema := shorthandSchema(obj)
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, v := range obj.Properties {
+		tp, ok := v.(ast.TypedParameterValue)
+		if !ok {
+			continue
+		}
+		field, _ := properties[name].(map[string]interface{})
+		if tp.Description != "" {
+			field["description"] = tp.Description
+		}
+		if tp.Default != nil {
+			if def := schemaLiteral(tp.Default); def != nil {
+				field["default"] = def
+			}
+		}
+		if tp.ParamType == "array" {
+			// Some providers reject array schemas without items
+			field["items"] = map[string]interface{}{}
+		}
+	}
+	return schema
+}
+
+// emptyToolSchema is the schema of a tool that takes no parameters.
+func emptyToolSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+// toolArguments returns a tool call's arguments with the defaults of the
+// typed parameters the model left out.
+func toolArguments(entity ast.Entity, args map[string]interface{}, resolver *Resolver) (map[string]interface{}, error) {
+	prop, _ := entity.GetProperty("parameters")
+	obj, ok := prop.(ast.ObjectValue)
+	if !ok {
+		return args, nil
+	}
+	merged := make(map[string]interface{}, len(obj.Properties))
+	for name, v := range obj.Properties {
+		tp, ok := v.(ast.TypedParameterValue)
+		if !ok || tp.Default == nil {
+			continue
+		}
+		def, err := resolver.Resolve(tp.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default of parameter %q: %w", name, err)
+		}
+		merged[name] = def
+	}
+	for name, v := range args {
+		merged[name] = v
+	}
+	return merged, nil
+}
+
+// toolResolver returns a resolver in which a tool call's arguments are
+// available as params.name.
+func toolResolver(ctx *ExecutionContext, args map[string]interface{}) *Resolver {
+	toolCtx := *ctx
+	toolCtx.Variables = make(map[string]interface{}, len(ctx.Variables)+1)
+	for k, v := range ctx.Variables {
+		toolCtx.Variables[k] = v
+	}
+	toolCtx.Variables["params"] = args
+	return NewResolver(&toolCtx)
+}
+
+// builtinTools maps the names of handler: builtin("...") to built-in
+// function tools.
+var builtinTools = map[string]string{
+	"fs.read":  "read_file",
+	"fs.write": "write_file",
+	"http":     "http",
+}
+
+// executeToolHandler runs a tool declared with a `handler`: a shell or http
+// block, builtin("fs.read"), script("name"), or mcp("server"). Arguments are available to
+// the handler as params.name.
+func (r *Runtime) executeToolHandler(ctx *ExecutionContext, tool ast.Entity, handler ast.Value, args map[string]interface{}) (interface{}, error) {
+	switch h := handler.(type) {
+	case ast.NestedEntityValue:
+		switch h.Entity.Type() {
+		case "shell":
+			return r.executeShellHandler(ctx, tool, h.Entity, args)
+		case "http":
+			return r.executeHTTPHandler(ctx, h.Entity, args)
+		}
+		return nil, fmt.Errorf("tool %q: unknown handler type %q", tool.Name(), h.Entity.Type())
+
+	case ast.FunctionCallValue:
+		if h.Function == "builtin" && len(h.Arguments) == 1 {
+			if sv, ok := h.Arguments[0].(ast.StringValue); ok {
+				fn, ok := builtinTools[sv.Value]
+				if !ok {
+					return nil, fmt.Errorf("tool %q: unknown builtin %q", tool.Name(), sv.Value)
+				}
+				return r.executeFunction(ctx, fn, args)
+			}
+		}
+
+	case ast.ReferenceValue:
+		if h.Type == "mcp" {
+			// mcp("server") calls the server's tool of the same name;
+			// mcp("server").other calls another one
+			name := tool.Name()
+			if len(h.Path) > 0 {
+				name = h.Path[0]
+			}
+			return r.executeMCPTool(ctx, h.Name, name, args)
+		}
+		if h.Type == "script" {
+			script, found := ctx.Workspace.GetEntityByName("script", h.Name)
+			if !found {
+				return nil, fmt.Errorf("tool %q: script %q not found", tool.Name(), h.Name)
+			}
+			return r.executeScriptTool(ctx, script, args)
+		}
+	}
+	return nil, fmt.Errorf("tool %q: unsupported handler %T", tool.Name(), handler)
+}
+
+// executeShellHandler runs a `handler: shell { command: ... }` block in its
+// `shell`, in its `working_dir` if set and within its `timeout`.
+func (r *Runtime) executeShellHandler(ctx *ExecutionContext, tool, handler ast.Entity, args map[string]interface{}) (interface{}, error) {
+	cmd, ok := handler.GetProperty("command")
+	if !ok {
+		return nil, fmt.Errorf("tool %q: shell handler has no 'command'", tool.Name())
+	}
+	resolver := toolResolver(ctx, args)
+	command, err := resolver.ResolveString(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	shell, err := entityShell(handler)
+	if err != nil {
+		return nil, fmt.Errorf("tool %q: %w", tool.Name(), err)
+	}
+
+	shellCtx := *ctx
+	if prop, ok := handler.GetProperty("working_dir"); ok {
+		dir, err := resolver.ResolveString(prop)
+		if err != nil {
+			return nil, fmt.Errorf("tool %q working_dir: %w", tool.Name(), err)
+		}
+		shellCtx.WorkDir = ctx.resolvePath(dir)
+	}
+	if prop, ok := handler.GetProperty("timeout"); ok {
+		timeout, err := time.ParseDuration(toString(schemaLiteral(prop)))
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: invalid timeout: %w", tool.Name(), err)
+		}
+		var cancel context.CancelFunc
+		shellCtx.Context, cancel = context.WithTimeout(ctx.Context, timeout)
+		defer cancel()
+	}
+	return r.executeShellCommand(&shellCtx, shell, command, nil)
+}
+
+// executeHTTPHandler runs a `handler: http { method: ... url: ... }` block.
+// Its `query` object is added to the URL.
+func (r *Runtime) executeHTTPHandler(ctx *ExecutionContext, handler ast.Entity, args map[string]interface{}) (interface{}, error) {
+	resolver := toolResolver(ctx, args)
+	httpArgs := make(map[string]interface{})
+	for _, key := range []string{"method", "url", "headers", "body", "query"} {
+		prop, ok := handler.GetProperty(key)
+		if !ok {
+			continue
+		}
+		value, err := resolver.Resolve(prop)
+		if err != nil {
+			return nil, fmt.Errorf("http handler %s: %w", key, err)
+		}
+		httpArgs[key] = value
+	}
+
+	if query, ok := httpArgs["query"].(map[string]interface{}); ok {
+		rawURL := toString(httpArgs["url"])
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("http handler url: %w", err)
+		}
+		values := u.Query()
+		for k, v := range query {
+			if v != nil {
+				values.Set(k, toString(v))
+			}
+		}
+		u.RawQuery = values.Encode()
+		httpArgs["url"] = u.String()
+		delete(httpArgs, "query")
+	}
+	return r.executeHTTPTool(ctx, httpArgs)
+}
+
+// executeScriptTool runs a script the model called as a tool, with the call's
+// arguments as its parameters.
+func (r *Runtime) executeScriptTool(ctx *ExecutionContext, script ast.Entity, args map[string]interface{}) (interface{}, error) {
+	spec, err := scriptSpec(script, NewResolver(ctx), args)
+	if err != nil {
+		return nil, err
+	}
+	run, err := runScript(ctx.Context, spec)
+	if err != nil {
+		return nil, err
+	}
+	return run.Output, nil
+}
+
+// executeShellCommand executes a shell command with arguments in the named
+// shell, or the platform's default one.
+func (r *Runtime) executeShellCommand(ctx *ExecutionContext, shell, command string, args map[string]interface{}) (string, error) {
 	// Replace placeholders in command string: {{arg}}
 	for k, v := range args {
 		placeholder := fmt.Sprintf("{{%s}}", k)
@@ -21,13 +321,17 @@ func (r *Runtime) executeShellCommand(ctx *ExecutionContext, command string, arg
 	}
 
 	// Execute the command
-	cmd := exec.CommandContext(ctx.Context, "sh", "-c", command)
+	cmd, err := shellCommand(ctx.Context, shell, command)
+	if err != nil {
+		return "", err
+	}
+	cmd.Dir = ctx.WorkDir
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	output := stdout.String()
 	if err != nil {
 		return output, fmt.Errorf("command failed: %w\nStderr: %s", err, stderr.String())
@@ -43,16 +347,16 @@ func (r *Runtime) executeFunction(ctx *ExecutionContext, name string, args map[s
 		return r.executeHTTPTool(ctx, args)
 	case "read_file":
 		if path, ok := args["path"].(string); ok {
-			return r.executeShellCommand(ctx, "cat {{path}}", map[string]interface{}{"path": path})
+			content, err := os.ReadFile(ctx.resolvePath(path))
+			if err != nil {
+				return nil, err
+			}
+			return string(content), nil
 		}
 	case "write_file":
 		if path, ok := args["path"].(string); ok {
 			if content, ok := args["content"].(string); ok {
-				// Use a safer way in production, but for now:
-				return r.executeShellCommand(ctx, "printf '%s' {{content}} > {{path}}", map[string]interface{}{
-					"path":    path,
-					"content": content,
-				})
+				return "", os.WriteFile(ctx.resolvePath(path), []byte(content), 0644)
 			}
 		}
 	}
@@ -85,6 +389,7 @@ func (r *Runtime) executeHTTPTool(ctx *ExecutionContext, args map[string]interfa
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(req)
 
 	// Add headers if provided
 	if headers, ok := args["headers"].(map[string]interface{}); ok {
@@ -107,7 +412,7 @@ func (r *Runtime) executeHTTPTool(ctx *ExecutionContext, args map[string]interfa
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx.Context, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
@@ -0,0 +1,141 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Explanation describes why a recorded run failed and how it might be fixed.
+type Explanation struct {
+	Run *RunRecord
+
+	// Step is the step that failed, or nil if the run failed outside a step
+	Step *StepRecord
+
+	// Error is the underlying error, with its class and provider status code
+	Error      string
+	ErrorClass string
+	StatusCode int
+
+	// Retries is the number of times the failed step was retried
+	Retries int
+
+	// Suggestions are likely fixes, most specific first
+	Suggestions []string
+}
+
+// contextOverflowMarkers are phrases providers use when a request does not
+// fit the model's context window.
+var contextOverflowMarkers = []string{
+	"context length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"too many input tokens",
+}
+
+// Explain reconstructs the failure of a recorded run. It returns nil for a
+// run that succeeded.
+func Explain(run *RunRecord) *Explanation {
+	if run == nil || run.Success {
+		return nil
+	}
+
+	e := &Explanation{
+		Run:        run,
+		Error:      run.Error,
+		ErrorClass: run.ErrorClass,
+		StatusCode: run.StatusCode,
+	}
+	if step := run.FailedStep(); step != nil {
+		e.Step = step
+		e.Error = step.Error
+		e.ErrorClass = step.ErrorClass
+		e.StatusCode = step.StatusCode
+		if step.Attempts > 1 {
+			e.Retries = step.Attempts - 1
+		}
+	}
+	e.Suggestions = suggestFixes(e)
+	return e
+}
+
+// suggestFixes returns likely fixes for a failure.
+func suggestFixes(e *Explanation) []string {
+	msg := strings.ToLower(e.Error)
+	target := "the step"
+	if e.Step != nil {
+		target = fmt.Sprintf("step %q", e.Step.Name)
+	}
+
+	var suggestions []string
+	switch {
+	case containsAny(msg, contextOverflowMarkers):
+		suggestions = append(suggestions,
+			fmt.Sprintf("The input to %s does not fit the model's context window: pass a summary or excerpt of earlier output instead of all of it", target),
+			"Use a model with a larger context window for this agent")
+
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		suggestions = append(suggestions,
+			"The provider rejected the credentials: check that the API key environment variable (e.g. ANTHROPIC_API_KEY or OPENAI_API_KEY) is set and valid",
+			"If the agent uses a provider entity, check its api_key and base_url")
+
+	case e.StatusCode == http.StatusNotFound:
+		suggestions = append(suggestions,
+			"The provider did not recognize the request: check that the agent's model name is correct and available to your account")
+
+	case e.ErrorClass == ErrorClassRateLimit:
+		suggestions = append(suggestions,
+			fmt.Sprintf(`Add a retry policy to %s that covers rate limits: retry { max: 3 backoff: "exponential" on: ["rate_limit"] }`, target),
+			"Set requests_per_minute or tokens_per_minute on the provider so requests queue instead of failing")
+
+	case e.Step != nil && e.Step.Status == StepTimedOut:
+		suggestions = append(suggestions,
+			fmt.Sprintf("%s ran longer than its timeout, which covers its retries: raise the timeout or give it less to do", strings.ToUpper(target[:1])+target[1:]))
+
+	case e.ErrorClass == ErrorClassTimeout:
+		suggestions = append(suggestions,
+			"Increase the execution timeout (e.g. langspace run -timeout 10m)",
+			fmt.Sprintf(`Add a retry policy to %s that covers timeouts: retry { max: 2 on: ["timeout"] }`, target))
+
+	case e.ErrorClass == ErrorClassServerError:
+		suggestions = append(suggestions,
+			fmt.Sprintf(`The provider failed: add a retry policy to %s: retry { max: 3 backoff: "exponential" on: ["server_error"] }`, target))
+
+	case e.ErrorClass == ErrorClassNetwork:
+		suggestions = append(suggestions,
+			"The provider could not be reached: check your network connection and the provider's base_url")
+
+	case strings.Contains(msg, "schema"):
+		suggestions = append(suggestions,
+			fmt.Sprintf("The output of %s did not match its output schema: raise its repair_attempts or make the instruction describe the expected format", target))
+
+	case strings.Contains(msg, "undefined") || strings.Contains(msg, "not found") || strings.Contains(msg, "no 'use' property"):
+		suggestions = append(suggestions,
+			"Run `langspace validate` to find references to undefined entities and steps")
+
+	case strings.Contains(msg, "stopped by inspector"):
+		suggestions = append(suggestions, "The run was stopped by an inspector; check why it stopped the run")
+	}
+
+	if e.Retries > 0 && len(suggestions) > 0 {
+		suggestions = append(suggestions, fmt.Sprintf("The error persisted through %d retries, so it is unlikely to be transient", e.Retries))
+	}
+	if len(suggestions) == 0 {
+		suggestions = append(suggestions,
+			"Re-run with -verbose, or with -snapshot-dir on a pipeline that sets snapshot: true, to see the exact request")
+	}
+	return suggestions
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
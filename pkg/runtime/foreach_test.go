@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// echoProvider answers with the input of each request, and records
+// how many requests it served at once.
+type echoProvider struct {
+	*MockProvider
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (p *echoProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.maxInFlight = max(p.maxInFlight, p.inFlight)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.inFlight--
+		p.mu.Unlock()
+	}()
+
+	prompt := strings.TrimPrefix(req.Messages[len(req.Messages)-1].Content, "## Input\n\n")
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(prompt, "broken") {
+		return nil, fmt.Errorf("cannot review %s", prompt)
+	}
+	return &CompletionResponse{Content: "ok: " + prompt, FinishReason: FinishReasonStop, Usage: TokenUsage{TotalTokens: 10}}, nil
+}
+
+func forEachWorkspace(t *testing.T, files string, concurrency string) *workspace.Workspace {
+	t.Helper()
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "reviewer" {
+	model: "mock-model"
+}
+
+pipeline "review" {
+	step "review" {
+		use: agent("reviewer")
+		for_each: `+files+`
+		`+concurrency+`
+		input: "Review {{index}} {{item}}"
+	}
+	step "summary" {
+		use: agent("reviewer")
+		input: step("review").outputs
+	}
+}
+`))
+	return ws
+}
+
+func TestExecutePipeline_ForEach(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency string
+		maxInFlight int
+	}{
+		{"sequential", "", 1},
+		{"concurrent", "concurrency: 2", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := forEachWorkspace(t, `["a.go", "b.go", "c.go", "d.go"]`, tt.concurrency)
+			provider := &echoProvider{MockProvider: NewMockProvider()}
+			rt := New(ws, WithProvider("mock", provider))
+
+			result, err := rt.ExecuteByName(context.Background(), "pipeline", "review")
+			if err != nil || !result.Success {
+				t.Fatalf("Execute failed: %v, %v", err, result.Error)
+			}
+
+			step := result.StepResults["review"]
+			want := []interface{}{"ok: Review 0 a.go", "ok: Review 1 b.go", "ok: Review 2 c.go", "ok: Review 3 d.go"}
+			outputs, ok := step.Output.([]interface{})
+			if !ok || fmt.Sprint(outputs) != fmt.Sprint(want) {
+				t.Errorf("step output = %#v, want %#v", step.Output, want)
+			}
+			if len(step.Iterations) != 4 || step.Iterations[2].Name != "review[2]" {
+				t.Errorf("expected a result per element, got %+v", step.Iterations)
+			}
+			if step.TokensUsed.TotalTokens != 40 {
+				t.Errorf("step tokens = %d, want the iterations' total", step.TokensUsed.TotalTokens)
+			}
+			if provider.maxInFlight != tt.maxInFlight {
+				t.Errorf("ran %d iterations at once, want %d", provider.maxInFlight, tt.maxInFlight)
+			}
+
+			summary := result.StepResults["summary"].Input
+			if !strings.Contains(summary, "ok: Review 3 d.go") {
+				t.Errorf("expected the next step to see the outputs, got %q", summary)
+			}
+		})
+	}
+}
+
+func TestExecutePipeline_ForEachErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       string
+		concurrency string
+		wantErr     string
+	}{
+		{"failing item", `["a.go", "broken.go", "c.go"]`, "", "item 1: LLM request failed: cannot review"},
+		{"not a list", `"a.go"`, "", `step "review": for_each: expected a list`},
+		{"bad concurrency", `["a.go"]`, "concurrency: 1.5", `step "review": 'concurrency' must be a whole number of at least 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := forEachWorkspace(t, tt.files, tt.concurrency)
+			provider := &echoProvider{MockProvider: NewMockProvider()}
+			rt := New(ws, WithProvider("mock", provider))
+
+			result, err := rt.ExecuteByName(context.Background(), "pipeline", "review")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+			if step := result.StepResults["review"]; step == nil || step.Success {
+				t.Errorf("expected the step to fail, got %+v", step)
+			}
+			if _, ok := result.StepResults["summary"]; ok {
+				t.Error("expected the pipeline to stop at the failed step")
+			}
+		})
+	}
+}
+
+// toolListClient is an MCP client that lists the given tools.
+type toolListClient struct {
+	tools []ToolDefinition
+}
+
+func (c toolListClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (c toolListClient) ListTools(ctx context.Context) ([]ToolDefinition, error) {
+	return c.tools, nil
+}
+
+func (c toolListClient) Close() error {
+	return nil
+}
+
+func TestExecutePipeline_ForEachMCPTools(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+mcp "files" {
+	command: "files-server"
+}
+
+agent "reviewer" {
+	model: "mock-model"
+	tools: [mcp("files").read]
+}
+
+pipeline "review" {
+	step "review" {
+		use: agent("reviewer")
+		for_each: ["a.go", "b.go", "c.go", "d.go"]
+		concurrency: 4
+		input: "Review {{item}}"
+	}
+}
+`))
+	provider := &echoProvider{MockProvider: NewMockProvider()}
+	rt := New(ws, WithProvider("mock", provider))
+	rt.mcpClients["files"] = toolListClient{tools: []ToolDefinition{{Name: "read"}}}
+	ctx := &ExecutionContext{
+		Context:     context.Background(),
+		Runtime:     rt,
+		Workspace:   ws,
+		Variables:   make(map[string]interface{}),
+		StepOutputs: make(map[string]interface{}),
+		MCPTools:    map[string]string{"search": "web"},
+	}
+
+	// The iterations list the server's tools at once, each into its own
+	// copy of the context's tools
+	pipeline, _ := ws.GetEntityByName("pipeline", "review")
+	result, err := rt.executePipeline(ctx, pipeline)
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v, %v", err, result.Error)
+	}
+	if provider.maxInFlight != 4 {
+		t.Errorf("ran %d iterations at once, want 4", provider.maxInFlight)
+	}
+	if len(ctx.MCPTools) != 1 {
+		t.Errorf("expected the iterations not to write the context's tools, got %v", ctx.MCPTools)
+	}
+}
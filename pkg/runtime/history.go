@@ -0,0 +1,268 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// DefaultRunHistorySize is the number of runs kept by a MemoryRunHistory.
+const DefaultRunHistorySize = 100
+
+// RunRecord records a finished execution, with enough detail to explain a
+// failure after the fact.
+type RunRecord struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	EntityType string    `json:"entity_type"`
+	EntityName string    `json:"entity_name"`
+
+	// Input is the execution input, if any
+	Input interface{} `json:"input,omitempty"`
+
+	Success bool `json:"success"`
+
+	// Error is the error that stopped the run, with its retry error class
+	// and the provider's HTTP status code, if it came from a provider
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+
+	// Steps are the pipeline steps that ran, in the order they started
+	Steps []StepRecord `json:"steps,omitempty"`
+
+	Duration   time.Duration     `json:"duration"`
+	TokensUsed TokenUsage        `json:"tokens_used"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// StepRecord records one pipeline step of a run.
+type StepRecord struct {
+	Name    string     `json:"name"`
+	Success bool       `json:"success"`
+	Status  StepStatus `json:"status,omitempty"`
+
+	// Input is the resolved prompt sent to the model
+	Input string `json:"input,omitempty"`
+	Model string `json:"model,omitempty"`
+
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+
+	// Attempts is the number of times the step was tried, including retries
+	Attempts int           `json:"attempts,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Cached   bool          `json:"cached,omitempty"`
+}
+
+// FailedStep returns the step that failed, or nil if no step did.
+func (rec *RunRecord) FailedStep() *StepRecord {
+	for i := range rec.Steps {
+		if !rec.Steps[i].Success && rec.Steps[i].Error != "" {
+			return &rec.Steps[i]
+		}
+	}
+	return nil
+}
+
+// RunHistory stores run records by ID. Implementations must be safe for
+// concurrent use.
+type RunHistory interface {
+	Record(run RunRecord) error
+	Get(id string) (*RunRecord, error)
+}
+
+// MemoryRunHistory keeps the most recent runs in memory.
+type MemoryRunHistory struct {
+	mu      sync.RWMutex
+	runs    []RunRecord
+	maxRuns int
+}
+
+// NewMemoryRunHistory creates a history that keeps up to maxRuns runs. A
+// non-positive maxRuns uses DefaultRunHistorySize.
+func NewMemoryRunHistory(maxRuns int) *MemoryRunHistory {
+	if maxRuns <= 0 {
+		maxRuns = DefaultRunHistorySize
+	}
+	return &MemoryRunHistory{maxRuns: maxRuns}
+}
+
+// Record adds a run, dropping the oldest once the history is full.
+func (h *MemoryRunHistory) Record(run RunRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, run)
+	if len(h.runs) > h.maxRuns {
+		h.runs = h.runs[len(h.runs)-h.maxRuns:]
+	}
+	return nil
+}
+
+// Get returns the run with the given ID.
+func (h *MemoryRunHistory) Get(id string) (*RunRecord, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		if h.runs[i].ID == id {
+			run := h.runs[i]
+			return &run, nil
+		}
+	}
+	return nil, fmt.Errorf("run %q not found", id)
+}
+
+// Runs returns a copy of the recorded runs, oldest first.
+func (h *MemoryRunHistory) Runs() []RunRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]RunRecord(nil), h.runs...)
+}
+
+// DiskRunHistory writes each run to <dir>/<id>.json, so runs can be looked up
+// by later processes such as `langspace explain`.
+type DiskRunHistory struct {
+	dir string
+}
+
+// NewDiskRunHistory creates a run history in dir, creating it if needed.
+func NewDiskRunHistory(dir string) (*DiskRunHistory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create run history directory: %w", err)
+	}
+	return &DiskRunHistory{dir: dir}, nil
+}
+
+// DefaultRunHistoryDir returns the per-user directory for the run history.
+func DefaultRunHistoryDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "langspace", "runs"), nil
+}
+
+// Record writes a run.
+func (h *DiskRunHistory) Record(run RunRecord) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	if err := os.WriteFile(h.path(run.ID), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return nil
+}
+
+// Get reads the run with the given ID.
+func (h *DiskRunHistory) Get(id string) (*RunRecord, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(h.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("run %q not found in %s", id, h.dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run: %w", err)
+	}
+	var run RunRecord
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %q: %w", id, err)
+	}
+	return &run, nil
+}
+
+func (h *DiskRunHistory) path(id string) string {
+	return filepath.Join(h.dir, id+".json")
+}
+
+// WithRunHistory sets the history that every execution is recorded in. The
+// ID of the recorded run is returned in ExecutionResult.RunID.
+func WithRunHistory(history RunHistory) Option {
+	return func(r *Runtime) {
+		r.runHistory = history
+	}
+}
+
+// newRunID returns a unique, time-ordered run ID.
+func newRunID(t time.Time) string {
+	return t.UTC().Format("20060102T150405") + "-" + randomHex(4)
+}
+
+// recordRun records an execution in the run history, if one is configured.
+func (r *Runtime) recordRun(ctx *ExecutionContext, entity ast.Entity, input interface{}, result *ExecutionResult, err error) {
+	if r.runHistory == nil || result == nil {
+		return
+	}
+
+	run := RunRecord{
+		ID:         ctx.RunID,
+		Time:       ctx.StartTime,
+		EntityType: entity.Type(),
+		EntityName: entity.Name(),
+		Input:      input,
+		Success:    result.Success && err == nil,
+		Duration:   time.Since(ctx.StartTime),
+		TokensUsed: result.TokensUsed,
+		Metadata:   ctx.Metadata,
+	}
+	if err == nil {
+		err = result.Error
+	}
+	if err != nil {
+		run.Error = err.Error()
+		run.ErrorClass, run.StatusCode = describeError(err)
+	}
+
+	for _, step := range result.StepResults {
+		if step == nil {
+			continue
+		}
+		rec := StepRecord{
+			Name:     step.Name,
+			Success:  step.Success,
+			Status:   step.Status,
+			Input:    step.Input,
+			Model:    step.Model,
+			Attempts: step.Attempts,
+			Duration: step.Duration,
+			Cached:   step.Cached,
+		}
+		if step.Error != nil {
+			rec.Error = step.Error.Error()
+			rec.ErrorClass, rec.StatusCode = describeError(step.Error)
+		}
+		run.Steps = append(run.Steps, rec)
+	}
+	// Step results are keyed by name; keep the order the steps ran in
+	sort.Slice(run.Steps, func(i, j int) bool {
+		return result.StepResults[run.Steps[i].Name].StartTime.Before(result.StepResults[run.Steps[j].Name].StartTime)
+	})
+
+	if err := r.runHistory.Record(run); err != nil {
+		logAt(ctx.Context, slog.LevelWarn, "failed to record run", "error", err)
+		return
+	}
+	result.RunID = run.ID
+}
+
+// describeError returns an error's retry error class and, for provider
+// errors, the HTTP status code.
+func describeError(err error) (string, int) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return classifyError(err), apiErr.StatusCode
+	}
+	return classifyError(err), 0
+}
@@ -0,0 +1,186 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecute_RecordsRunHistory(t *testing.T) {
+	source := `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "outline" {
+		use: agent("writer")
+		input: "topic"
+	}
+
+	step "draft" {
+		use: agent("writer")
+		input: step("outline").output
+		retry {
+			max: 1
+			delay: "1ms"
+			on: ["server_error"]
+		}
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "1. intro"},
+		MockResponse{Error: &APIError{StatusCode: 400, Body: "prompt is too long: 250000 tokens > 200000 maximum"}},
+	))
+	history := NewMemoryRunHistory(0)
+	rt := New(ws, WithProvider("mock", provider), WithRunHistory(history))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "report")
+	result, err := rt.Execute(context.Background(), pipeline, WithInput("notes"))
+	if err == nil {
+		t.Fatal("expected execution to fail")
+	}
+	if result.RunID == "" {
+		t.Fatal("expected the run ID in the result")
+	}
+
+	run, err := history.Get(result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Success || run.EntityName != "report" || run.Input != "notes" {
+		t.Errorf("unexpected run record: %+v", run)
+	}
+	if len(run.Steps) != 2 || run.Steps[0].Name != "outline" || run.Steps[1].Name != "draft" {
+		t.Fatalf("expected steps in the order they ran, got %+v", run.Steps)
+	}
+
+	step := run.FailedStep()
+	if step == nil || step.Name != "draft" {
+		t.Fatalf("expected step draft to have failed, got %+v", step)
+	}
+	if step.StatusCode != 400 || step.Attempts != 1 {
+		t.Errorf("expected a 400 on the only attempt, got status %d after %d attempts", step.StatusCode, step.Attempts)
+	}
+	if !strings.Contains(step.Input, "1. intro") {
+		t.Errorf("expected the resolved input, got %q", step.Input)
+	}
+}
+
+func TestExecute_NoRunHistory(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`))
+	rt := New(ws, WithProvider("mock", NewMockProvider()))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "report")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if result.RunID != "" {
+		t.Errorf("expected no run ID without a history, got %q", result.RunID)
+	}
+}
+
+func TestDiskRunHistory(t *testing.T) {
+	history, err := NewDiskRunHistory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := RunRecord{
+		ID:         "20250101T120000-1a2b3c4d",
+		EntityType: "pipeline",
+		EntityName: "report",
+		Error:      "step \"draft\" failed: boom",
+		Steps:      []StepRecord{{Name: "draft", Error: "boom", Attempts: 3}},
+	}
+	if err := history.Record(run); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	got, err := history.Get(run.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.EntityName != "report" || got.FailedStep().Attempts != 3 {
+		t.Errorf("unexpected run: %+v", got)
+	}
+
+	if _, err := history.Get("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if _, err := history.Get("../escape"); err == nil {
+		t.Error("expected an error for an ID with a path separator")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    StepRecord
+		retries int
+		want    string
+	}{
+		{
+			name: "context overflow",
+			step: StepRecord{Name: "draft", Error: "API error (status 400): prompt is too long", StatusCode: 400, ErrorClass: ErrorClassOther, Attempts: 1},
+			want: "context window",
+		},
+		{
+			name:    "rate limit",
+			step:    StepRecord{Name: "draft", Error: "API error (status 429): slow down", StatusCode: 429, ErrorClass: ErrorClassRateLimit, Attempts: 3},
+			retries: 2,
+			want:    `on: ["rate_limit"]`,
+		},
+		{
+			name: "credentials",
+			step: StepRecord{Name: "draft", Error: "API error (status 401): invalid x-api-key", StatusCode: 401, ErrorClass: ErrorClassOther, Attempts: 1},
+			want: "API key",
+		},
+		{
+			name: "unknown",
+			step: StepRecord{Name: "draft", Error: "something odd", ErrorClass: ErrorClassOther},
+			want: "-verbose",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &RunRecord{
+				Error: "step \"draft\" failed: " + tt.step.Error,
+				Steps: []StepRecord{{Name: "outline", Success: true}, tt.step},
+			}
+			e := Explain(run)
+			if e == nil || e.Step == nil || e.Step.Name != "draft" {
+				t.Fatalf("expected the failure at step draft, got %+v", e)
+			}
+			if e.Retries != tt.retries {
+				t.Errorf("expected %d retries, got %d", tt.retries, e.Retries)
+			}
+			if len(e.Suggestions) == 0 || !strings.Contains(e.Suggestions[0], tt.want) {
+				t.Errorf("expected first suggestion to mention %q, got %q", tt.want, e.Suggestions)
+			}
+		})
+	}
+
+	if Explain(&RunRecord{Success: true}) != nil {
+		t.Error("expected no explanation for a successful run")
+	}
+}
@@ -0,0 +1,132 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExecutionSnapshot is a read-only view of a running execution. Its maps are
+// copies, so holding or modifying a snapshot does not affect the execution;
+// the values in them are shared.
+type ExecutionSnapshot struct {
+	// EntityType and EntityName identify the intent or pipeline executing
+	EntityType string `json:"entity_type"`
+	EntityName string `json:"entity_name"`
+
+	// Event is the progress event the snapshot was taken for
+	Event ProgressEvent `json:"event"`
+
+	Variables   map[string]interface{} `json:"variables,omitempty"`
+	StepOutputs map[string]interface{} `json:"step_outputs,omitempty"`
+	Metadata    map[string]string      `json:"metadata,omitempty"`
+
+	// TokensUsed counts the tokens used so far
+	TokensUsed TokenUsage `json:"tokens_used"`
+
+	StartTime time.Time     `json:"start_time"`
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+// InspectFunc receives a snapshot of an execution at every progress event:
+// when it starts, before and after each step, on tool calls, and when it
+// completes. Returning an error stops the execution with that error, so host
+// applications can enforce their own guardrails (e.g. a token budget).
+// It is called on the executing goroutine and should return quickly.
+type InspectFunc func(snapshot ExecutionSnapshot) error
+
+// WithInspector calls fn with a snapshot of the execution at every progress
+// event.
+//
+// Example:
+//
+//	rt.Execute(ctx, pipeline, runtime.WithInspector(func(s runtime.ExecutionSnapshot) error {
+//	    if s.TokensUsed.TotalTokens > 50000 {
+//	        return fmt.Errorf("token budget exceeded")
+//	    }
+//	    return nil
+//	}))
+func WithInspector(fn InspectFunc) ExecuteOption {
+	return func(o *executeOptions) {
+		o.inspect = fn
+	}
+}
+
+// inspectorStop is the cancellation cause when an inspector stops an
+// execution.
+type inspectorStop struct {
+	err error
+}
+
+func (e *inspectorStop) Error() string {
+	return fmt.Sprintf("stopped by inspector: %v", e.err)
+}
+
+func (e *inspectorStop) Unwrap() error {
+	return e.err
+}
+
+// Snapshot returns a read-only view of the execution's current state.
+func (ec *ExecutionContext) Snapshot() ExecutionSnapshot {
+	s := ExecutionSnapshot{
+		EntityType:  ec.entityType,
+		EntityName:  ec.entityName,
+		Variables:   make(map[string]interface{}, len(ec.Variables)),
+		StepOutputs: make(map[string]interface{}, len(ec.StepOutputs)),
+		Metadata:    make(map[string]string, len(ec.Metadata)),
+		TokensUsed:  ec.tokens,
+		StartTime:   ec.StartTime,
+		Elapsed:     time.Since(ec.StartTime),
+	}
+	for k, v := range ec.Variables {
+		s.Variables[k] = v
+	}
+	for k, v := range ec.StepOutputs {
+		s.StepOutputs[k] = v
+	}
+	for k, v := range ec.Metadata {
+		s.Metadata[k] = v
+	}
+	return s
+}
+
+// addTokens adds token usage to the execution's running count.
+func (ec *ExecutionContext) addTokens(usage TokenUsage) {
+	ec.tokens.Add(usage)
+}
+
+// inspect passes a snapshot to the inspector, if any, and stops the
+// execution if it returns an error.
+func (ec *ExecutionContext) inspect(event ProgressEvent) {
+	if ec.inspector == nil || ec.stop == nil || ec.Context.Err() != nil {
+		return
+	}
+	s := ec.Snapshot()
+	s.Event = event
+	if err := ec.inspector(s); err != nil {
+		ec.stop(&inspectorStop{err: err})
+	}
+}
+
+// stopError returns the error an inspector, the stall detector, or the
+// scheduler stopped the execution with, if one did.
+func (ec *ExecutionContext) stopError() error {
+	if ec.stop == nil {
+		return nil
+	}
+	cause := context.Cause(ec.Context)
+	var stop *inspectorStop
+	if errors.As(cause, &stop) {
+		return stop
+	}
+	var stall *StallError
+	if errors.As(cause, &stall) {
+		return stall
+	}
+	var preempted *PreemptedError
+	if errors.As(cause, &preempted) {
+		return preempted
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const inspectSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "draft" {
+	step "outline" {
+		use: agent("writer")
+		input: "topic"
+	}
+	step "write" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+	step "edit" {
+		use: agent("writer")
+		input: step("write").output
+	}
+}
+`
+
+func TestExecute_Inspector(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, inspectSource))
+
+	usage := TokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "an outline", Usage: usage},
+		MockResponse{Content: "a draft", Usage: usage},
+		MockResponse{Content: "an edit", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	var snapshots []ExecutionSnapshot
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	result, err := rt.Execute(context.Background(), pipeline,
+		WithInput("topic"),
+		WithInspector(func(s ExecutionSnapshot) error {
+			snapshots = append(snapshots, s)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("expected success, got %v", result.Error)
+	}
+
+	// start, one per step, complete
+	if len(snapshots) != 5 {
+		t.Fatalf("expected 5 snapshots, got %d", len(snapshots))
+	}
+	for _, s := range snapshots {
+		if s.EntityType != "pipeline" || s.EntityName != "draft" {
+			t.Errorf("snapshot for %s %q, want pipeline \"draft\"", s.EntityType, s.EntityName)
+		}
+		if s.Variables["input"] != "topic" {
+			t.Errorf("snapshot variables = %v, want input", s.Variables)
+		}
+	}
+
+	write := snapshots[2]
+	if write.Event.Step != "write" {
+		t.Fatalf("expected snapshot before step 'write', got %q", write.Event.Step)
+	}
+	if got := write.StepOutputs["outline"]; got != "an outline" {
+		t.Errorf("outline output = %v, want 'an outline'", got)
+	}
+	if _, ok := write.StepOutputs["write"]; ok {
+		t.Error("snapshot before step 'write' should not have its output")
+	}
+	if write.TokensUsed.TotalTokens != 15 {
+		t.Errorf("tokens before step 'write' = %d, want 15", write.TokensUsed.TotalTokens)
+	}
+
+	last := snapshots[len(snapshots)-1]
+	if last.Event.Type != ProgressTypeComplete {
+		t.Errorf("last event = %s, want complete", last.Event.Type)
+	}
+	if last.TokensUsed.TotalTokens != 45 {
+		t.Errorf("total tokens = %d, want 45", last.TokensUsed.TotalTokens)
+	}
+
+	// Snapshots are copies
+	write.StepOutputs["outline"] = "changed"
+	if snapshots[3].StepOutputs["outline"] != "an outline" {
+		t.Error("modifying a snapshot changed another snapshot")
+	}
+}
+
+func TestExecute_InspectorStops(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, inspectSource))
+
+	usage := TokenUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "an outline", Usage: usage},
+		MockResponse{Content: "a draft", Usage: usage},
+		MockResponse{Content: "an edit", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	errBudget := errors.New("token budget exceeded")
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	result, err := rt.Execute(context.Background(), pipeline,
+		WithInspector(func(s ExecutionSnapshot) error {
+			if s.TokensUsed.TotalTokens >= 30 {
+				return errBudget
+			}
+			return nil
+		}),
+	)
+	if !errors.Is(err, errBudget) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	if result == nil || result.Success || !errors.Is(result.Error, errBudget) {
+		t.Fatalf("expected failed result with budget error, got %+v", result)
+	}
+	if n := len(provider.GetRequests()); n != 2 {
+		t.Errorf("expected 2 requests before stopping, got %d", n)
+	}
+	if _, ok := result.StepResults["edit"]; ok && result.StepResults["edit"].Success {
+		t.Error("step 'edit' should not have run")
+	}
+}
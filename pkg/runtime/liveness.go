@@ -0,0 +1,247 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// StallAction is what the stall detector does with an execution that has
+// been silent for Config.StallTimeout.
+type StallAction string
+
+const (
+	// StallWarn reports the stall with a ProgressTypeStall event and a log
+	// line, and lets the execution continue.
+	StallWarn StallAction = ""
+
+	// StallAbort reports the stall and stops the execution with a
+	// StallError.
+	StallAbort StallAction = "abort"
+)
+
+// ParseStallAction parses "warn" or "abort".
+func ParseStallAction(s string) (StallAction, error) {
+	switch s {
+	case "", "warn":
+		return StallWarn, nil
+	case string(StallAbort):
+		return StallAbort, nil
+	default:
+		return "", fmt.Errorf("unknown stall action %q (want warn or abort)", s)
+	}
+}
+
+// StallError is the error of an execution the stall detector stopped.
+type StallError struct {
+	// Step is the step that was running, if any
+	Step string
+
+	// Idle is how long the execution had been silent
+	Idle time.Duration
+}
+
+func (e *StallError) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("execution stalled: no activity for %s", e.Idle)
+	}
+	return fmt.Sprintf("step %q stalled: no activity for %s", e.Step, e.Idle)
+}
+
+// livenessMonitor watches what an execution streams to its handler. It
+// emits heartbeats on a schedule and reports the execution once it has been
+// silent for too long. Calls to the wrapped handler are serialized, since
+// heartbeats are sent from the monitor's own goroutine.
+type livenessMonitor struct {
+	mu       sync.Mutex
+	next     StreamHandler
+	entity   string
+	started  time.Time
+	active   time.Time
+	beat     time.Time
+	step     string
+	reported bool
+	paused   bool
+
+	interval time.Duration
+	timeout  time.Duration
+	action   StallAction
+	stop     context.CancelCauseFunc
+}
+
+// newLivenessMonitor returns a monitor that forwards to next, which may be
+// nil.
+func newLivenessMonitor(next StreamHandler, entity string, cfg *Config, stop context.CancelCauseFunc) *livenessMonitor {
+	now := time.Now()
+	return &livenessMonitor{
+		next:     next,
+		entity:   entity,
+		started:  now,
+		active:   now,
+		beat:     now,
+		interval: cfg.HeartbeatInterval,
+		timeout:  cfg.StallTimeout,
+		action:   cfg.StallAction,
+		stop:     stop,
+	}
+}
+
+// touch records activity; callers hold m.mu.
+func (m *livenessMonitor) touch() {
+	m.active = time.Now()
+	m.reported = false
+}
+
+// pause stops stall detection while the execution waits to resume, such as
+// for a scheduler slot; heartbeats continue.
+func (m *livenessMonitor) pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = true
+}
+
+// resume restarts stall detection, counting silence from now.
+func (m *livenessMonitor) resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = false
+	m.touch()
+}
+
+func (m *livenessMonitor) OnChunk(chunk StreamChunk) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touch()
+	if m.next != nil {
+		m.next.OnChunk(chunk)
+	}
+}
+
+func (m *livenessMonitor) OnProgress(event ProgressEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touch()
+	if event.Type == ProgressTypeStep && event.Step != "" {
+		m.step = event.Step
+	}
+	if m.next != nil {
+		m.next.OnProgress(event)
+	}
+}
+
+func (m *livenessMonitor) OnComplete(response *CompletionResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touch()
+	if m.next != nil {
+		m.next.OnComplete(response)
+	}
+}
+
+func (m *livenessMonitor) OnError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touch()
+	if m.next != nil {
+		m.next.OnError(err)
+	}
+}
+
+// start runs the monitor until ctx is done or the returned function is
+// called, which waits for it to stop.
+func (m *livenessMonitor) start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// run checks the execution until ctx is done. The check interval is short
+// enough for both heartbeats and stalls to be noticed on time.
+func (m *livenessMonitor) run(ctx context.Context) {
+	tick := m.interval
+	if m.timeout > 0 && (tick == 0 || m.timeout/4 < tick) {
+		tick = m.timeout / 4
+	}
+	if tick <= 0 {
+		tick = m.timeout
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.check(ctx, now)
+		}
+	}
+}
+
+// check sends a heartbeat if one is due and reports a stall once per
+// silent period.
+func (m *livenessMonitor) check(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idle := now.Sub(m.active)
+
+	if m.interval > 0 && now.Sub(m.beat) >= m.interval {
+		m.beat = now
+		m.emit(ProgressEvent{
+			Type:    ProgressTypeHeartbeat,
+			Message: m.describe(fmt.Sprintf("running for %s, last activity %s ago", roundMillis(now.Sub(m.started)), roundMillis(idle))),
+			Step:    m.step,
+			Metadata: map[string]string{
+				"elapsed": roundMillis(now.Sub(m.started)).String(),
+				"idle":    roundMillis(idle).String(),
+			},
+		})
+	}
+
+	if m.timeout <= 0 || idle < m.timeout || m.reported || m.paused {
+		return
+	}
+	m.reported = true
+	action, message := "warn", m.describe(fmt.Sprintf("stalled: no activity for %s", roundMillis(idle)))
+	if m.action == StallAbort {
+		action, message = "abort", message+", aborting"
+	}
+	logAt(ctx, slog.LevelWarn, message)
+	m.emit(ProgressEvent{
+		Type:     ProgressTypeStall,
+		Message:  message,
+		Step:     m.step,
+		Metadata: map[string]string{"idle": roundMillis(idle).String(), "action": action},
+	})
+	if m.action == StallAbort && m.stop != nil {
+		m.stop(&StallError{Step: m.step, Idle: roundMillis(idle)})
+	}
+}
+
+// emit sends an event of the monitor's own; callers hold m.mu.
+func (m *livenessMonitor) emit(event ProgressEvent) {
+	if m.next != nil {
+		m.next.OnProgress(event)
+	}
+}
+
+// describe prefixes message with the execution and its current step.
+func (m *livenessMonitor) describe(message string) string {
+	if m.step == "" {
+		return fmt.Sprintf("%s %s", m.entity, message)
+	}
+	return fmt.Sprintf("%s, step %q %s", m.entity, m.step, message)
+}
+
+func roundMillis(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,196 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func progressOfType(events []ProgressEvent, t ProgressType) []ProgressEvent {
+	var out []ProgressEvent
+	for _, e := range events {
+		if e.Type == t {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestParseStallAction(t *testing.T) {
+	for in, want := range map[string]StallAction{"": StallWarn, "warn": StallWarn, "abort": StallAbort} {
+		if got, err := ParseStallAction(in); err != nil || got != want {
+			t.Errorf("ParseStallAction(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseStallAction("kill"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+func TestExecute_Heartbeats(t *testing.T) {
+	rt := New(workspace.New(), WithConfig(&Config{HeartbeatInterval: 20 * time.Millisecond}))
+	handler := &BufferedStreamHandler{}
+
+	res, err := rt.Execute(context.Background(), newWorkDirScript("sleep 0.15; echo done"), WithStreamHandler(handler))
+	if err != nil || !res.Success {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	beats := progressOfType(handler.Events, ProgressTypeHeartbeat)
+	if len(beats) < 2 {
+		t.Fatalf("expected heartbeats while the script ran, got %+v", handler.Events)
+	}
+	if beats[0].Metadata["elapsed"] == "" || beats[0].Metadata["idle"] == "" || !strings.HasPrefix(beats[0].Message, `script "workdir"`) {
+		t.Errorf("expected elapsed and idle time, got %+v", beats[0])
+	}
+	if stalls := progressOfType(handler.Events, ProgressTypeStall); len(stalls) != 0 {
+		t.Errorf("expected no stall events without a stall timeout, got %+v", stalls)
+	}
+}
+
+func TestExecute_StallWarn(t *testing.T) {
+	rt := New(workspace.New(), WithConfig(&Config{StallTimeout: 40 * time.Millisecond}))
+	handler := &BufferedStreamHandler{}
+
+	res, err := rt.Execute(context.Background(), newWorkDirScript("sleep 0.2; echo done"), WithStreamHandler(handler))
+	if err != nil || !res.Success {
+		t.Fatalf("expected a warning only, got %v", err)
+	}
+	stalls := progressOfType(handler.Events, ProgressTypeStall)
+	if len(stalls) != 1 || stalls[0].Metadata["action"] != "warn" {
+		t.Errorf("expected one stall warning per silent period, got %+v", stalls)
+	}
+}
+
+func TestExecute_StallAbort(t *testing.T) {
+	rt := New(workspace.New(), WithConfig(&Config{StallTimeout: 40 * time.Millisecond, StallAction: StallAbort}))
+
+	start := time.Now()
+	_, err := rt.Execute(context.Background(), newWorkDirScript("sleep 5"))
+	var stall *StallError
+	if !errors.As(err, &stall) || stall.Idle < 40*time.Millisecond {
+		t.Fatalf("expected a StallError, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the stalled script to be stopped, took %s", elapsed)
+	}
+}
+
+func TestExecutePipeline_StreamingIsNotStalled(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "slow" {
+	step "write" {
+		use: agent("writer")
+		input: "Write slowly"
+	}
+}
+`))
+	provider := NewMockProvider(
+		WithMockResponses(MockResponse{Content: strings.Repeat("word ", 30)}),
+		WithMockStreamDelay(10*time.Millisecond),
+	)
+	rt := New(ws, WithProvider("mock", provider), WithConfig(&Config{
+		EnableStreaming: true,
+		StallTimeout:    40 * time.Millisecond,
+		StallAction:     StallAbort,
+	}))
+	pipeline, _ := ws.GetEntityByName("pipeline", "slow")
+
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil || !result.Success {
+		t.Fatalf("expected a step that keeps streaming to finish, got %v", err)
+	}
+}
+
+func TestExecutePipeline_StepTimeout(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "slow" {
+	step "write" {
+		use: agent("writer")
+		input: "Write slowly"
+		timeout: "50ms"
+	}
+}
+`))
+	provider := NewMockProvider(
+		WithMockResponses(MockResponse{Content: strings.Repeat("word ", 100)}),
+		WithMockStreamDelay(20*time.Millisecond),
+	)
+	rt := New(ws, WithProvider("mock", provider), WithConfig(&Config{EnableStreaming: true}))
+	pipeline, _ := ws.GetEntityByName("pipeline", "slow")
+
+	handler := &BufferedStreamHandler{}
+	start := time.Now()
+	result, err := rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the timeout to abort the stream, took %s", elapsed)
+	}
+	var timedOut *StepTimeoutError
+	if !errors.As(err, &timedOut) || timedOut.Step != "write" {
+		t.Fatalf("expected a step timeout error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || classifyError(err) != ErrorClassTimeout {
+		t.Errorf("expected the timeout to classify as a timeout, got %v", err)
+	}
+	if got := result.StepResults["write"].Status; got != StepTimedOut {
+		t.Errorf("expected status %q, got %q", StepTimedOut, got)
+	}
+	if len(handler.Chunks) == 0 || len(handler.Chunks) >= 100 {
+		t.Errorf("expected the stream to stop part way, got %d chunks", len(handler.Chunks))
+	}
+}
+
+func TestExecutePipeline_StepTimeoutStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		want    StepStatus
+	}{
+		{"within timeout", `timeout: "5s"`, StepSucceeded},
+		{"no timeout", ``, StepSucceeded},
+		{"invalid timeout", `timeout: "soon"`, StepFailed},
+		{"negative timeout", `timeout: "-1s"`, StepFailed},
+		{"not a duration", `timeout: 30`, StepFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := workspace.New()
+			addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "quick" {
+	step "write" {
+		use: agent("writer")
+		input: "Write"
+		`+tt.timeout+`
+	}
+}
+`))
+			rt := New(ws, WithProvider("mock", NewMockProvider(WithMockResponses(MockResponse{Content: "done"}))))
+			pipeline, _ := ws.GetEntityByName("pipeline", "quick")
+
+			result, err := rt.Execute(context.Background(), pipeline)
+			if (err != nil) != (tt.want == StepFailed) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := result.StepResults["write"].Status; got != tt.want {
+				t.Errorf("expected status %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Locale holds the conventions used to format dates and numbers for a
+// language and region.
+type Locale struct {
+	// Tag is the BCP 47 tag, e.g. "de-DE"
+	Tag string
+
+	// Language is the English name of the language, used in translation prompts
+	Language string
+
+	// DateFormat, TimeFormat, and LongDateFormat are Go time layouts. English
+	// month and weekday names in the output are replaced with Months and Weekdays.
+	DateFormat     string
+	TimeFormat     string
+	LongDateFormat string
+
+	// Decimal and Group are the decimal and thousands separators
+	Decimal string
+	Group   string
+
+	Months   [12]string
+	Weekdays [7]string // starting with Sunday
+}
+
+// DefaultTranslationPrompt is the prompt template used by translate().
+// {{language}} and {{text}} are replaced with the target language and the
+// text to translate.
+const DefaultTranslationPrompt = `Translate the following text into {{language}}. Preserve formatting, Markdown, placeholders, and numbers. Reply with the translation only.
+
+{{text}}`
+
+var englishMonths = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+var englishWeekdays = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+// locales are the built-in locales, keyed by lowercase tag.
+var locales = map[string]*Locale{
+	"en-us": {
+		Tag: "en-US", Language: "English",
+		DateFormat: "01/02/2006", TimeFormat: "3:04 PM", LongDateFormat: "January 2, 2006",
+		Decimal: ".", Group: ",",
+		Months: englishMonths, Weekdays: englishWeekdays,
+	},
+	"en-gb": {
+		Tag: "en-GB", Language: "English",
+		DateFormat: "02/01/2006", TimeFormat: "15:04", LongDateFormat: "2 January 2006",
+		Decimal: ".", Group: ",",
+		Months: englishMonths, Weekdays: englishWeekdays,
+	},
+	"de-de": {
+		Tag: "de-DE", Language: "German",
+		DateFormat: "02.01.2006", TimeFormat: "15:04", LongDateFormat: "2. January 2006",
+		Decimal: ",", Group: ".",
+		Months:   [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		Weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	},
+	"fr-fr": {
+		Tag: "fr-FR", Language: "French",
+		DateFormat: "02/01/2006", TimeFormat: "15:04", LongDateFormat: "2 January 2006",
+		Decimal: ",", Group: "\u202f",
+		Months:   [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		Weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	},
+	"es-es": {
+		Tag: "es-ES", Language: "Spanish",
+		DateFormat: "02/01/2006", TimeFormat: "15:04", LongDateFormat: "2 de January de 2006",
+		Decimal: ",", Group: ".",
+		Months:   [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		Weekdays: [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	},
+	"it-it": {
+		Tag: "it-IT", Language: "Italian",
+		DateFormat: "02/01/2006", TimeFormat: "15:04", LongDateFormat: "2 January 2006",
+		Decimal: ",", Group: ".",
+		Months:   [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		Weekdays: [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+	},
+	"sv-se": {
+		Tag: "sv-SE", Language: "Swedish",
+		DateFormat: "2006-01-02", TimeFormat: "15:04", LongDateFormat: "2 January 2006",
+		Decimal: ",", Group: "\u00a0",
+		Months:   [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		Weekdays: [7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+	},
+	"ja-jp": {
+		Tag: "ja-JP", Language: "Japanese",
+		DateFormat: "2006/01/02", TimeFormat: "15:04", LongDateFormat: "2006年1月2日",
+		Decimal: ".", Group: ",",
+		Months:   [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		Weekdays: [7]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"},
+	},
+}
+
+// defaultRegions maps a bare language to its built-in locale.
+var defaultRegions = map[string]string{
+	"en": "en-us", "de": "de-de", "fr": "fr-fr", "es": "es-es",
+	"it": "it-it", "sv": "sv-se", "ja": "ja-jp",
+}
+
+// LookupLocale returns the built-in locale for a tag such as "de", "de-DE",
+// or "de_DE". An unknown region falls back to the language's default region.
+func LookupLocale(tag string) (*Locale, error) {
+	key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if loc, ok := locales[key]; ok {
+		return loc, nil
+	}
+	lang, _, _ := strings.Cut(key, "-")
+	if region, ok := defaultRegions[lang]; ok {
+		return locales[region], nil
+	}
+	return nil, fmt.Errorf("unknown locale %q", tag)
+}
+
+// Locale returns the active locale: Config.Locale if set, otherwise the
+// workspace config entity's `locale` property. It returns nil when neither
+// is set, in which case dates use ISO formats and numbers are unformatted.
+func (r *Runtime) Locale() (*Locale, error) {
+	tag := r.config.Locale
+	if tag == "" {
+		if configs := r.workspace.GetEntitiesByType("config"); len(configs) > 0 {
+			if prop, ok := configs[0].GetProperty("locale"); ok {
+				sv, ok := prop.(ast.StringValue)
+				if !ok {
+					return nil, fmt.Errorf("config 'locale' must be a string")
+				}
+				tag = sv.Value
+			}
+		}
+	}
+	if tag == "" {
+		return nil, nil
+	}
+	return LookupLocale(tag)
+}
+
+// Timezone returns the name of the default timezone: Config.Timezone if
+// set, otherwise the workspace config entity's `timezone` property. An empty
+// name means the server's local time.
+func (r *Runtime) Timezone() string {
+	if r.config.Timezone != "" {
+		return r.config.Timezone
+	}
+	if configs := r.workspace.GetEntitiesByType("config"); len(configs) > 0 {
+		if prop, ok := configs[0].GetProperty("timezone"); ok {
+			if sv, ok := prop.(ast.StringValue); ok {
+				return sv.Value
+			}
+		}
+	}
+	return ""
+}
+
+// Location returns the default timezone (see Timezone).
+func (r *Runtime) Location() (*time.Location, error) {
+	return loadLocation(r.Timezone())
+}
+
+// loadLocation loads a timezone by IANA name; an empty name is local time.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// FormatDate formats t in one of the styles "date", "time", "datetime", or
+// "long", or with a Go time layout. Month and weekday names are localized.
+func (l *Locale) FormatDate(t time.Time, style string) string {
+	switch style {
+	case "date":
+		return l.localizeNames(t.Format(l.DateFormat), t)
+	case "time":
+		return t.Format(l.TimeFormat)
+	case "datetime":
+		return l.localizeNames(t.Format(l.DateFormat+" "+l.TimeFormat), t)
+	case "long":
+		return l.localizeNames(t.Format(l.LongDateFormat), t)
+	default:
+		return l.localizeNames(t.Format(style), t)
+	}
+}
+
+// localizeNames replaces the English month and weekday names, full or
+// abbreviated, that Go's time formatting produced for t.
+func (l *Locale) localizeNames(s string, t time.Time) string {
+	for _, name := range [][2]string{
+		{englishMonths[t.Month()-1], l.Months[t.Month()-1]},
+		{englishWeekdays[t.Weekday()], l.Weekdays[t.Weekday()]},
+	} {
+		if strings.Contains(s, name[0]) {
+			s = strings.ReplaceAll(s, name[0], name[1])
+		} else {
+			s = strings.ReplaceAll(s, name[0][:3], abbreviate(name[1]))
+		}
+	}
+	return s
+}
+
+// abbreviate shortens a month or weekday name to three characters.
+func abbreviate(name string) string {
+	runes := []rune(name)
+	if len(runes) <= 3 {
+		return name
+	}
+	return string(runes[:3])
+}
+
+// FormatNumber formats n with the locale's separators. A negative decimals
+// uses the fewest digits that represent n exactly.
+func (l *Locale) FormatNumber(n float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if n < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFrac {
+		b.WriteString(l.Decimal)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// translate translates text into the language of target (a locale tag, or
+// the active locale if empty) by asking a model. The model and prompt come
+// from the config entity's `translation` property:
+//
+//	config {
+//	    locale: "de-DE"
+//	    translation: { model: "claude-haiku-4-5" source: "en" prompt: file("prompts/translate.md") }
+//	}
+//
+// Text already in the source language (default "en") is returned unchanged.
+// Translations are cached for the life of the runtime.
+func (r *Runtime) translate(ctx *ExecutionContext, text, target string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+
+	language := ""
+	if target == "" {
+		loc, err := r.Locale()
+		if err != nil {
+			return "", err
+		}
+		if loc == nil {
+			return text, nil
+		}
+		target, language = loc.Tag, loc.Language
+	} else if loc, err := LookupLocale(target); err == nil {
+		language = loc.Language
+	} else {
+		language = target
+	}
+
+	model, source, prompt := r.defaultModel, "en", DefaultTranslationPrompt
+	if configs := r.workspace.GetEntitiesByType("config"); len(configs) > 0 {
+		if prop, ok := configs[0].GetProperty("translation"); ok {
+			obj, ok := prop.(ast.ObjectValue)
+			if !ok {
+				return "", fmt.Errorf("config 'translation' must be an object")
+			}
+			resolver := NewResolver(ctx)
+			for key, dst := range map[string]*string{"model": &model, "source": &source, "prompt": &prompt} {
+				v, ok := obj.Properties[key]
+				if !ok {
+					continue
+				}
+				// Prompt placeholders are filled in below, not by the resolver
+				if sv, ok := v.(ast.StringValue); ok && key == "prompt" {
+					*dst = sv.Value
+					continue
+				}
+				s, err := resolver.ResolveString(v)
+				if err != nil {
+					return "", fmt.Errorf("config translation %s: %w", key, err)
+				}
+				*dst = s
+			}
+		}
+	}
+
+	targetLang, _, _ := strings.Cut(strings.ToLower(strings.ReplaceAll(target, "_", "-")), "-")
+	sourceLang, _, _ := strings.Cut(strings.ToLower(source), "-")
+	if targetLang == sourceLang {
+		return text, nil
+	}
+
+	cacheKey := targetLang + "\x00" + text
+	r.mu.RLock()
+	cached, ok := r.translations[cacheKey]
+	r.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	provider, err := r.getProviderForModel(model)
+	if err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+	content := strings.NewReplacer("{{language}}", language, "{{text}}", text).Replace(prompt)
+	req := &CompletionRequest{
+		Model:    model,
+		Messages: []Message{{Role: RoleUser, Content: content}},
+	}
+	r.makeDeterministic(req)
+	resp, err := provider.Complete(ctx.Context, req)
+	if err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+
+	translated := strings.TrimSpace(resp.Content)
+	r.mu.Lock()
+	r.translations[cacheKey] = translated
+	r.mu.Unlock()
+	return translated, nil
+}
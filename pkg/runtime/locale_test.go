@@ -0,0 +1,260 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "de", want: "de-DE"},
+		{tag: "de-DE", want: "de-DE"},
+		{tag: "de_AT", want: "de-DE"},
+		{tag: "EN-gb", want: "en-GB"},
+		{tag: "xx-YY", wantErr: true},
+	}
+	for _, tt := range tests {
+		loc, err := LookupLocale(tt.tag)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("LookupLocale(%q) expected error", tt.tag)
+			}
+			continue
+		}
+		if err != nil || loc.Tag != tt.want {
+			t.Errorf("LookupLocale(%q) = %v, %v; want %s", tt.tag, loc, err, tt.want)
+		}
+	}
+}
+
+func TestLocale_FormatNumber(t *testing.T) {
+	tests := []struct {
+		tag      string
+		n        float64
+		decimals int
+		want     string
+	}{
+		{"en-US", 1234567.891, 2, "1,234,567.89"},
+		{"en-US", 999, -1, "999"},
+		{"en-US", -1234.5, -1, "-1,234.5"},
+		{"en-US", -0.001, 2, "0.00"},
+		{"de-DE", 1234567.891, 2, "1.234.567,89"},
+		{"fr-FR", 1234.5, 1, "1\u202f234,5"},
+		{"sv-SE", 1000000, 0, "1\u00a0000\u00a0000"},
+	}
+	for _, tt := range tests {
+		loc, _ := LookupLocale(tt.tag)
+		if got := loc.FormatNumber(tt.n, tt.decimals); got != tt.want {
+			t.Errorf("%s FormatNumber(%v, %d) = %q, want %q", tt.tag, tt.n, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestLocale_FormatDate(t *testing.T) {
+	date := time.Date(2024, time.March, 15, 14, 30, 0, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		tag   string
+		style string
+		want  string
+	}{
+		{"en-US", "date", "03/15/2024"},
+		{"en-US", "time", "2:30 PM"},
+		{"en-US", "long", "March 15, 2024"},
+		{"de-DE", "date", "15.03.2024"},
+		{"de-DE", "datetime", "15.03.2024 14:30"},
+		{"de-DE", "long", "15. März 2024"},
+		{"de-DE", "Monday, 2 Jan", "Freitag, 15 Mär"},
+		{"fr-FR", "long", "15 mars 2024"},
+		{"es-ES", "long", "15 de marzo de 2024"},
+		{"ja-JP", "long", "2024年3月15日"},
+	}
+	for _, tt := range tests {
+		loc, _ := LookupLocale(tt.tag)
+		if got := loc.FormatDate(date, tt.style); got != tt.want {
+			t.Errorf("%s FormatDate(%q) = %q, want %q", tt.tag, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestResolver_Locale(t *testing.T) {
+	orig := timeNow
+	timeNow = func() time.Time { return time.Date(2024, time.March, 15, 14, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = orig }()
+
+	resolve := func(t *testing.T, rt *Runtime, value ast.Value) string {
+		t.Helper()
+		ctx := &ExecutionContext{Runtime: rt, Workspace: rt.Workspace(), Variables: map[string]interface{}{}}
+		got, err := NewResolver(ctx).ResolveString(value)
+		if err != nil {
+			t.Fatalf("resolve error: %v", err)
+		}
+		return got
+	}
+
+	template := ast.StringValue{Value: "{{date.date}} / {{date.long}}"}
+	numberCall := ast.FunctionCallValue{Function: "format_number", Arguments: []ast.Value{ast.NumberValue{Value: 1234.5}, ast.NumberValue{Value: 2}}}
+	dateCall := ast.FunctionCallValue{Function: "format_date", Arguments: []ast.Value{ast.StringValue{Value: "long"}, ast.StringValue{Value: "2023-12-01"}}}
+
+	// Without a locale, dates keep their ISO formats
+	rt := New(workspace.New())
+	if got := resolve(t, rt, template); got != "2024-03-15 / March 15, 2024" {
+		t.Errorf("default template = %q", got)
+	}
+	if got := resolve(t, rt, numberCall); got != "1,234.50" {
+		t.Errorf("default format_number = %q", got)
+	}
+
+	// The config entity selects the locale
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `config { locale: "de-DE" }`))
+	rt = New(ws)
+	if got := resolve(t, rt, template); got != "15.03.2024 / 15. März 2024" {
+		t.Errorf("de template = %q", got)
+	}
+	if got := resolve(t, rt, numberCall); got != "1.234,50" {
+		t.Errorf("de format_number = %q", got)
+	}
+	if got := resolve(t, rt, dateCall); got != "1. Dezember 2023" {
+		t.Errorf("de format_date = %q", got)
+	}
+
+	// Config.Locale overrides the config entity
+	rt = New(ws, WithConfig(&Config{Locale: "fr"}))
+	if got := resolve(t, rt, dateCall); got != "1 décembre 2023" {
+		t.Errorf("fr format_date = %q", got)
+	}
+
+	rt = New(ws, WithConfig(&Config{Locale: "klingon"}))
+	ctx := &ExecutionContext{Runtime: rt, Workspace: ws, Variables: map[string]interface{}{}}
+	if _, err := NewResolver(ctx).ResolveString(template); err == nil {
+		t.Error("expected error for unknown locale")
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	source := `
+config {
+	locale: "de-DE"
+	translation: {
+		model: "mock-model"
+		prompt: "Into {{language}}: {{text}}"
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: " Zusammenfassung \n"}))
+	rt := New(ws, WithProvider("mock", provider))
+	ctx := &ExecutionContext{Context: context.Background(), Runtime: rt, Workspace: ws, Variables: map[string]interface{}{}}
+	resolver := NewResolver(ctx)
+
+	translate := func(args ...string) string {
+		t.Helper()
+		call := ast.FunctionCallValue{Function: "translate"}
+		for _, a := range args {
+			call.Arguments = append(call.Arguments, ast.StringValue{Value: a})
+		}
+		got, err := resolver.ResolveString(call)
+		if err != nil {
+			t.Fatalf("translate error: %v", err)
+		}
+		return got
+	}
+
+	if got := translate("Summary"); got != "Zusammenfassung" {
+		t.Errorf("translate = %q", got)
+	}
+	requests := provider.GetRequests()
+	if len(requests) != 1 || requests[0].Messages[0].Content != "Into German: Summary" {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+
+	// Repeated translations are cached
+	translate("Summary")
+	if got := len(provider.GetRequests()); got != 1 {
+		t.Errorf("expected cached translation, got %d requests", got)
+	}
+
+	// Text is already in the source language
+	if got := translate("Summary", "en-GB"); got != "Summary" {
+		t.Errorf("translate to source language = %q", got)
+	}
+
+	// An explicit target outside the built-in locales is passed through
+	translate("Summary", "Finnish")
+	if got := provider.GetRequests()[1].Messages[0].Content; !strings.HasPrefix(got, "Into Finnish:") {
+		t.Errorf("unexpected prompt %q", got)
+	}
+}
+
+func TestResolver_Timezone(t *testing.T) {
+	orig := timeNow
+	timeNow = func() time.Time { return time.Date(2024, time.March, 15, 23, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = orig }()
+
+	source := `
+config {
+	timezone: "Asia/Tokyo"
+}
+
+agent "a" {
+	model: "mock-model"
+	instruction: date("2006-01-02 15:04")
+	description: date("2006-01-02 15:04", "Europe/Stockholm")
+	role: format_date("datetime", "2024-03-15T12:00:00", "America/New_York")
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	agent, ok := ws.GetEntityByName("agent", "a")
+	if !ok {
+		t.Fatal("agent not found")
+	}
+	ctx := &ExecutionContext{Runtime: New(ws), Workspace: ws, Variables: map[string]interface{}{}}
+	resolver := NewResolver(ctx)
+
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{"instruction", "2024-03-16 08:30"}, // config default
+		{"description", "2024-03-16 00:30"}, // explicit timezone
+		{"role", "2024-03-15T12:00:00"},     // parsed in the given timezone
+	}
+	for _, tt := range tests {
+		value, _ := agent.GetProperty(tt.property)
+		got, err := resolver.ResolveString(value)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.property, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.property, got, tt.want)
+		}
+	}
+
+	// {{date.*}} templates use the default timezone too
+	if got, _ := resolver.ResolveString(ast.StringValue{Value: "{{date.date}}"}); got != "2024-03-16" {
+		t.Errorf("template date = %q", got)
+	}
+
+	// Config.Timezone overrides the config entity
+	ctx.Runtime = New(ws, WithConfig(&Config{Timezone: "UTC"}))
+	if got, _ := resolver.ResolveString(ast.StringValue{Value: "{{date.date}}"}); got != "2024-03-15" {
+		t.Errorf("UTC template date = %q", got)
+	}
+
+	bad := ast.FunctionCallValue{Function: "date", Arguments: []ast.Value{ast.StringValue{Value: "15:04"}, ast.StringValue{Value: "Mars/Olympus"}}}
+	if _, err := resolver.ResolveString(bad); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+}
@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Logger receives the runtime's log entries: warnings such as a failed
+// cache write or a stalled run, and at slog.LevelDebug the start and end of
+// executions and steps. *slog.Logger implements it.
+//
+// Entries logged during an execution carry its run ID (run_id), the
+// executing entity (e.g. pipeline="review"), and the current step (step),
+// so the entries of concurrent runs can be told apart.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// WithLogger sets the logger of the runtime, e.g. to send its entries to an
+// application's own slog handler. The default logs text to stderr at
+// Config.LogLevel.
+func WithLogger(logger Logger) Option {
+	return func(r *Runtime) {
+		r.logger = logger
+	}
+}
+
+// NewLogger returns a logger that writes entries at level and above to w as
+// text.
+func NewLogger(w io.Writer, level slog.Level) Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Logger returns the runtime's logger.
+func (r *Runtime) Logger() Logger {
+	return r.logger
+}
+
+// logKey is the context key of the logger and attributes of an execution.
+type logKey struct{}
+
+// logState is the logger of an execution and the attributes it adds to
+// every entry.
+type logState struct {
+	logger Logger
+	attrs  []slog.Attr
+}
+
+// withLogger returns ctx with the runtime's logger, keeping the attributes
+// of an enclosing execution.
+func withLogger(ctx context.Context, logger Logger) context.Context {
+	state := logState{logger: logger}
+	if parent, ok := ctx.Value(logKey{}).(logState); ok {
+		state.attrs = parent.attrs
+	}
+	return context.WithValue(ctx, logKey{}, state)
+}
+
+// withLogAttrs returns ctx with attributes added to its log entries.
+// Attributes replace those of the same key, so a nested execution logs its
+// own run ID.
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	state, _ := ctx.Value(logKey{}).(logState)
+	merged := make([]slog.Attr, 0, len(state.attrs)+len(attrs))
+	for _, a := range state.attrs {
+		replaced := false
+		for _, b := range attrs {
+			if a.Key == b.Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, a)
+		}
+	}
+	state.attrs = append(merged, attrs...)
+	return context.WithValue(ctx, logKey{}, state)
+}
+
+// logAt logs an entry with the attributes of ctx. Outside an execution,
+// e.g. in a provider used on its own, entries go to slog.Default().
+func logAt(ctx context.Context, level slog.Level, msg string, args ...any) {
+	state, _ := ctx.Value(logKey{}).(logState)
+	logger := state.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	all := make([]any, 0, len(state.attrs)+len(args))
+	for _, a := range state.attrs {
+		all = append(all, a)
+	}
+	logger.Log(ctx, level, msg, append(all, args...)...)
+}
+
+// defaultLogger is the logger of a runtime without WithLogger.
+func defaultLogger(cfg *Config) Logger {
+	return NewLogger(os.Stderr, cfg.LogLevel)
+}
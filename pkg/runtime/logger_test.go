@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// logEntries decodes the entries of a JSON slog handler.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log entry %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogger_CorrelationAttributes(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, snapshotSource))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cfg := DefaultConfig()
+	cfg.EnableStreaming = false
+	rt := New(ws, WithConfig(cfg), WithProvider("mock", NewMockProvider()), WithLogger(logger), WithRunHistory(NewMemoryRunHistory(10)))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	result, err := rt.Execute(context.Background(), pipeline, WithInput("a topic"))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	entries := logEntries(t, &buf)
+	steps := map[string]bool{}
+	for _, e := range entries {
+		if e["run_id"] != result.RunID {
+			t.Errorf("expected run_id %q, got %v", result.RunID, e)
+		}
+		if e["pipeline"] != "draft" {
+			t.Errorf("expected pipeline draft, got %v", e)
+		}
+		if e["msg"] == "step finished" {
+			steps[e["step"].(string)] = true
+		}
+	}
+	if !steps["outline"] || !steps["write"] {
+		t.Errorf("expected an entry for each step, got %v", entries)
+	}
+	if entries[0]["msg"] != "execution started" || entries[len(entries)-1]["msg"] != "execution finished" {
+		t.Errorf("expected the execution to be logged, got %v", entries)
+	}
+}
+
+func TestLogger_Level(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, snapshotSource))
+
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.EnableStreaming = false
+	rt := New(ws, WithConfig(cfg), WithProvider("mock", NewMockProvider()), WithLogger(NewLogger(&buf, slog.LevelInfo)))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	if _, err := rt.Execute(context.Background(), pipeline, WithInput("a topic")); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no debug entries at info level, got %q", buf.String())
+	}
+}
+
+func TestLogger_NestedAttributes(t *testing.T) {
+	ctx := withLogAttrs(withLogger(context.Background(), nil), slog.String("run_id", "a"), slog.String("pipeline", "p"))
+	ctx = withLogAttrs(ctx, slog.String("run_id", "b"))
+
+	var buf bytes.Buffer
+	ctx = withLogger(ctx, slog.New(slog.NewJSONHandler(&buf, nil)))
+	logAt(ctx, slog.LevelWarn, "nested")
+
+	entries := logEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["run_id"] != "b" || entries[0]["pipeline"] != "p" {
+		t.Errorf("expected the inner run ID and the outer pipeline, got %v", entries)
+	}
+}
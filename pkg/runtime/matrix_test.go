@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecuteMatrix(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+	temperature: 0.3
+	fallback {
+		models: ["backup-model"]
+	}
+}
+
+pipeline "compare" {
+	matrix {
+		model: ["model-a", "model-b"]
+		temperature: [0, 0.7]
+		tone: ["terse"]
+	}
+	step "answer" {
+		use: agent("writer")
+		prompt: "Answer in a {{matrix.tone}} tone"
+	}
+}
+`))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "a0"},
+		MockResponse{Content: "a7"},
+		MockResponse{Error: &APIError{StatusCode: 500}},
+		MockResponse{Content: "b7"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+	pipeline, _ := ws.GetEntityByName("pipeline", "compare")
+
+	result, err := rt.ExecuteMatrix(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("ExecuteMatrix error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Dimensions, []string{"model", "temperature", "tone"}) {
+		t.Errorf("unexpected dimensions %v", result.Dimensions)
+	}
+
+	var labels []string
+	for _, run := range result.Runs {
+		labels = append(labels, run.Label())
+	}
+	wantLabels := []string{
+		"model=model-a temperature=0 tone=terse",
+		"model=model-a temperature=0.7 tone=terse",
+		"model=model-b temperature=0 tone=terse",
+		"model=model-b temperature=0.7 tone=terse",
+	}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Fatalf("expected runs %v, got %v", wantLabels, labels)
+	}
+
+	// The matrix model replaces the agent's fallbacks, so the failed run is
+	// not retried on backup-model
+	requests := provider.GetRequests()
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(requests))
+	}
+	for i, run := range result.Runs {
+		model, _ := run.Value("model")
+		temperature, _ := run.Value("temperature")
+		if requests[i].Model != model || requests[i].Temperature != temperature {
+			t.Errorf("run %q sent model %q at temperature %v", run.Label(), requests[i].Model, requests[i].Temperature)
+		}
+		if got := requests[i].Messages[0].Content; got != "Answer in a terse tone" {
+			t.Errorf("expected matrix.tone in the prompt, got %q", got)
+		}
+		if run.Result.Metadata["matrix"] != run.Label() {
+			t.Errorf("expected the run's metadata to hold its combination, got %v", run.Result.Metadata)
+		}
+	}
+
+	if result.Succeeded() != 3 || result.Runs[2].Result.Success {
+		t.Errorf("expected the third run to fail and the others to succeed")
+	}
+	if got := result.Runs[3].Result.Output; got != "b7" {
+		t.Errorf("expected the last run's output, got %v", got)
+	}
+	groups := result.Group("model")
+	if len(groups["model-a"]) != 2 || len(groups["model-b"]) != 2 {
+		t.Errorf("expected two runs per model, got %v", groups)
+	}
+}
+
+func TestExecuteMatrix_Errors(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "plain" {
+	step "answer" {
+		use: agent("writer")
+	}
+}
+
+pipeline "numeric-model" {
+	matrix {
+		model: [4]
+	}
+	step "answer" {
+		use: agent("writer")
+	}
+}
+`))
+	rt := New(ws, WithProvider("mock", NewMockProvider()))
+
+	for _, name := range []string{"plain", "numeric-model"} {
+		pipeline, _ := ws.GetEntityByName("pipeline", name)
+		if _, err := rt.ExecuteMatrix(context.Background(), pipeline); err == nil {
+			t.Errorf("expected an error for pipeline %q", name)
+		}
+	}
+}
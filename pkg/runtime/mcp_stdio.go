@@ -4,26 +4,67 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"os"
 	"os/exec"
+	"strings"
 	"sync"
 )
 
+// MCPProtocolVersion is the Model Context Protocol revision sent in the
+// initialize handshake.
+const MCPProtocolVersion = "2024-11-05"
+
+// mcpClientName identifies LangSpace to MCP servers during initialization.
+const mcpClientName = "langspace"
+
 // StdioMCPClient implements an MCP client that communicates with a server over stdio.
+// Messages are newline-delimited JSON-RPC 2.0. The initialize handshake is
+// performed on first use.
 type StdioMCPClient struct {
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
-	reader *bufio.Reader
-	mu     sync.Mutex
-	id     int
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	id      int
+	pending map[int]chan jsonRPCResponse
+	err     error         // set once the server's stdout is closed
+	done    chan struct{} // closed when the read loop exits
+
+	initMu      sync.Mutex
+	initialized bool
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// ServerInfo is the name and version reported by the server.
+	ServerInfo MCPServerInfo
+}
+
+// MCPServerInfo describes an MCP server as reported by the initialize handshake.
+type MCPServerInfo struct {
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	ProtocolVersion string `json:"-"`
 }
 
-// NewStdioMCPClient creates a new StdioMCPClient.
+// NewStdioMCPClient starts the MCP server command and returns a client
+// connected to its stdin and stdout.
 func NewStdioMCPClient(command string, args ...string) (*StdioMCPClient, error) {
+	return NewStdioMCPClientWithEnv(command, args, nil)
+}
+
+// NewStdioMCPClientWithEnv is like NewStdioMCPClient but adds env ("KEY=value")
+// to the environment inherited by the server process.
+func NewStdioMCPClientWithEnv(command string, args []string, env []string) (*StdioMCPClient, error) {
 	cmd := exec.Command(command, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -37,12 +78,14 @@ func NewStdioMCPClient(command string, args ...string) (*StdioMCPClient, error)
 		return nil, err
 	}
 
-	return &StdioMCPClient{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: stdout,
-		reader: bufio.NewReader(stdout),
-	}, nil
+	c := &StdioMCPClient{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int]chan jsonRPCResponse),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(stdout)
+	return c, nil
 }
 
 type jsonRPCRequest struct {
@@ -54,6 +97,7 @@ type jsonRPCRequest struct {
 
 type jsonRPCResponse struct {
 	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *jsonRPCError   `json:"error,omitempty"`
 	ID      interface{}     `json:"id"`
@@ -65,47 +109,169 @@ type jsonRPCError struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// readLoop dispatches responses from the server to waiting calls until the
+// server's stdout is closed.
+func (c *StdioMCPClient) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var msg jsonRPCResponse
+		if err := json.Unmarshal(line, &msg); err != nil {
+			slog.Warn("ignoring malformed MCP message", "error", err)
+			continue
+		}
+
+		// Server notifications and requests are not supported; reply to
+		// requests so the server does not wait forever
+		if msg.Method != "" {
+			if msg.ID != nil {
+				c.send(jsonRPCResponse{
+					JSONRPC: "2.0",
+					ID:      msg.ID,
+					Error:   &jsonRPCError{Code: -32601, Message: "method not supported by client: " + msg.Method},
+				})
+			}
+			continue
+		}
+
+		id, ok := msg.ID.(float64)
+		if !ok {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[int(id)]
+		delete(c.pending, int(id))
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	c.mu.Lock()
+	c.err = fmt.Errorf("MCP server closed connection: %w", err)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// send writes a single JSON-RPC message to the server.
+func (c *StdioMCPClient) send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
 func (c *StdioMCPClient) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	ch := make(chan jsonRPCResponse, 1)
+
 	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
 	c.id++
 	id := c.id
+	c.pending[id] = ch
 	c.mu.Unlock()
 
+	cancel := func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}
+
 	req := jsonRPCRequest{
 		JSONRPC: "2.0",
 		Method:  method,
 		Params:  params,
 		ID:      id,
 	}
+	if err := c.send(req); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to send MCP %s request: %w", method, err)
+	}
 
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, fmt.Errorf("MCP error (%d): %s", resp.Error.Code, resp.Error.Message)
+		}
+		return resp.Result, nil
+	case <-c.done:
+		cancel()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
 	}
+}
 
-	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
-		return nil, err
+// Initialize performs the MCP initialize handshake. It is called automatically
+// by ListTools and CallTool, and does nothing once it has succeeded.
+func (c *StdioMCPClient) Initialize(ctx context.Context) error {
+	c.initMu.Lock()
+	defer c.initMu.Unlock()
+	if c.initialized {
+		return nil
 	}
 
-	// Read response
-	line, err := c.reader.ReadBytes('\n')
+	params := map[string]interface{}{
+		"protocolVersion": MCPProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo": map[string]interface{}{
+			"name":    mcpClientName,
+			"version": "1.0.0",
+		},
+	}
+	result, err := c.call(ctx, "initialize", params)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("MCP initialize failed: %w", err)
 	}
 
-	var resp jsonRPCResponse
-	if err := json.Unmarshal(line, &resp); err != nil {
-		return nil, err
+	var initResp struct {
+		ProtocolVersion string        `json:"protocolVersion"`
+		ServerInfo      MCPServerInfo `json:"serverInfo"`
 	}
-
-	if resp.Error != nil {
-		return nil, fmt.Errorf("MCP error (%d): %s", resp.Error.Code, resp.Error.Message)
+	if err := json.Unmarshal(result, &initResp); err != nil {
+		return fmt.Errorf("invalid MCP initialize response: %w", err)
+	}
+	if err := c.send(jsonRPCRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		return fmt.Errorf("failed to send MCP initialized notification: %w", err)
 	}
 
-	return resp.Result, nil
+	c.ServerInfo = initResp.ServerInfo
+	c.ServerInfo.ProtocolVersion = initResp.ProtocolVersion
+	c.initialized = true
+	return nil
 }
 
+// CallTool calls a tool on the server. Text content in the result is returned
+// as a single string; other results are returned as decoded JSON. A result
+// flagged with isError is returned as an error.
 func (c *StdioMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (interface{}, error) {
+	if err := c.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
 	params := map[string]interface{}{
 		"name":      name,
 		"arguments": arguments,
@@ -115,6 +281,38 @@ func (c *StdioMCPClient) CallTool(ctx context.Context, name string, arguments ma
 		return nil, err
 	}
 
+	var callResp struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StructuredContent interface{} `json:"structuredContent"`
+		IsError           bool        `json:"isError"`
+	}
+	if err := json.Unmarshal(result, &callResp); err != nil {
+		return nil, fmt.Errorf("invalid MCP tools/call response: %w", err)
+	}
+
+	var texts []string
+	allText := len(callResp.Content) > 0
+	for _, content := range callResp.Content {
+		if content.Type != "text" {
+			allText = false
+			continue
+		}
+		texts = append(texts, content.Text)
+	}
+
+	if callResp.IsError {
+		return nil, fmt.Errorf("MCP tool %q failed: %s", name, strings.Join(texts, "\n"))
+	}
+	if callResp.StructuredContent != nil {
+		return callResp.StructuredContent, nil
+	}
+	if allText {
+		return strings.Join(texts, "\n"), nil
+	}
+
 	var toolResult interface{}
 	if err := json.Unmarshal(result, &toolResult); err != nil {
 		return nil, err
@@ -122,37 +320,62 @@ func (c *StdioMCPClient) CallTool(ctx context.Context, name string, arguments ma
 	return toolResult, nil
 }
 
+// ListTools lists the tools the server exposes, following pagination cursors.
 func (c *StdioMCPClient) ListTools(ctx context.Context) ([]ToolDefinition, error) {
-	result, err := c.call(ctx, "tools/list", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var listResp struct {
-		Tools []struct {
-			Name        string                 `json:"name"`
-			Description string                 `json:"description"`
-			InputSchema map[string]interface{} `json:"inputSchema"`
-		} `json:"tools"`
-	}
-	if err := json.Unmarshal(result, &listResp); err != nil {
+	if err := c.Initialize(ctx); err != nil {
 		return nil, err
 	}
 
 	var tools []ToolDefinition
-	for _, t := range listResp.Tools {
-		tools = append(tools, ToolDefinition{
-			Name:        t.Name,
-			Description: t.Description,
-			Parameters:  t.InputSchema,
-		})
-	}
-	return tools, nil
+	cursor := ""
+	for {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]interface{}{"cursor": cursor}
+		}
+		result, err := c.call(ctx, "tools/list", params)
+		if err != nil {
+			return nil, err
+		}
+
+		var listResp struct {
+			Tools []struct {
+				Name        string                 `json:"name"`
+				Description string                 `json:"description"`
+				InputSchema map[string]interface{} `json:"inputSchema"`
+			} `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(result, &listResp); err != nil {
+			return nil, fmt.Errorf("invalid MCP tools/list response: %w", err)
+		}
+
+		for _, t := range listResp.Tools {
+			tools = append(tools, ToolDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			})
+		}
+		if listResp.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = listResp.NextCursor
+	}
 }
 
+// Close closes the server's stdin and stops the server process. It is safe to
+// call more than once.
 func (c *StdioMCPClient) Close() error {
-	if err := c.stdin.Close(); err != nil {
-		log.Printf("failed to close MCP stdin: %v", err)
-	}
-	return c.cmd.Process.Kill()
+	c.closeOnce.Do(func() {
+		if err := c.stdin.Close(); err != nil {
+			slog.Warn("failed to close MCP stdin", "error", err)
+		}
+		if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			c.closeErr = err
+			return
+		}
+		_ = c.cmd.Wait()
+	})
+	return c.closeErr
 }
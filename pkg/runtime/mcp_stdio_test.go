@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// TestMCPHelperProcess is not a real test. It acts as an MCP server over stdio
+// when started by the tests below.
+func TestMCPHelperProcess(t *testing.T) {
+	if os.Getenv("LANGSPACE_MCP_HELPER") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	initialized := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+			ID     interface{}            `json:"id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+
+		var result interface{}
+		var rpcErr map[string]interface{}
+		switch {
+		case req.Method == "initialize":
+			result = map[string]interface{}{
+				"protocolVersion": req.Params["protocolVersion"],
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+				"serverInfo":      map[string]interface{}{"name": "helper", "version": "0.1.0"},
+			}
+		case req.Method == "notifications/initialized":
+			initialized = true
+			continue
+		case !initialized:
+			rpcErr = map[string]interface{}{"code": -32002, "message": "server not initialized"}
+		case req.Method == "tools/list":
+			result = map[string]interface{}{"tools": []interface{}{
+				map[string]interface{}{
+					"name":        "echo",
+					"description": "Echo the message",
+					"inputSchema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"message": map[string]interface{}{"type": "string"}},
+					},
+				},
+				map[string]interface{}{"name": "fail", "description": "Always fails"},
+			}}
+		case req.Method == "tools/call" && req.Params["name"] == "echo":
+			args, _ := req.Params["arguments"].(map[string]interface{})
+			result = map[string]interface{}{"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": fmt.Sprint(args["message"])},
+			}}
+		case req.Method == "tools/call":
+			result = map[string]interface{}{
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": "boom"}},
+				"isError": true,
+			}
+		default:
+			rpcErr = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		data, _ := json.Marshal(resp)
+		fmt.Println(string(data))
+	}
+}
+
+func startHelperMCPClient(t *testing.T) *StdioMCPClient {
+	t.Helper()
+	client, err := NewStdioMCPClientWithEnv(os.Args[0], []string{"-test.run=TestMCPHelperProcess"}, []string{"LANGSPACE_MCP_HELPER=1"})
+	if err != nil {
+		t.Fatalf("failed to start MCP server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestStdioMCPClient(t *testing.T) {
+	client := startHelperMCPClient(t)
+	ctx := context.Background()
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools error: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Name != "echo" || tools[1].Name != "fail" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+	if tools[0].Parameters["type"] != "object" {
+		t.Errorf("expected input schema as parameters, got %v", tools[0].Parameters)
+	}
+	if client.ServerInfo.Name != "helper" || client.ServerInfo.ProtocolVersion != MCPProtocolVersion {
+		t.Errorf("unexpected server info: %+v", client.ServerInfo)
+	}
+
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"message": "hello"})
+	if err != nil {
+		t.Fatalf("CallTool error: %v", err)
+	}
+	if result != "hello" {
+		t.Errorf("expected text content 'hello', got %v", result)
+	}
+
+	if _, err := client.CallTool(ctx, "fail", nil); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected tool error containing 'boom', got %v", err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if _, err := client.ListTools(ctx); err == nil {
+		t.Error("expected error after server was closed")
+	}
+}
+
+func TestExecute_MCPTools(t *testing.T) {
+	source := fmt.Sprintf(`
+mcp "helper" {
+	command: %q
+	args: ["-test.run=TestMCPHelperProcess"]
+	env: { LANGSPACE_MCP_HELPER: "1" }
+}
+
+agent "assistant" {
+	model: "mock-model"
+	tools: [mcp("helper").echo]
+}
+
+intent "ask" {
+	use: agent("assistant")
+}
+`, os.Args[0])
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{
+			ToolCalls: []ToolCall{
+				{ID: "call-1", Name: "echo", Arguments: map[string]interface{}{"message": "from mcp"}},
+			},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "done", FinishReason: FinishReasonStop},
+	))
+
+	rt := New(ws, WithProvider("mock", provider))
+	defer rt.Close()
+
+	intent, _ := ws.GetEntityByName("intent", "ask")
+	if _, err := rt.Execute(context.Background(), intent); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	requests := provider.GetRequests()
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Name != "echo" {
+		t.Errorf("expected only the selected MCP tool to be exposed, got %+v", requests[0].Tools)
+	}
+	msgs := requests[1].Messages
+	if got := msgs[len(msgs)-1].Content; got != "from mcp" {
+		t.Errorf("expected MCP tool result, got %q", got)
+	}
+}
@@ -0,0 +1,365 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of
+// the provider request latency histogram: model calls take from a fraction
+// of a second to minutes.
+var DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Metrics is a registry of counters and histograms that is exported in the
+// Prometheus text format. A runtime given one with WithMetrics counts its
+// executions, pipeline steps, provider requests and their latency, tokens,
+// cache lookups, and trigger firings:
+//
+//	langspace_executions_total{type, name, status}
+//	langspace_steps_total{pipeline, step, status}
+//	langspace_provider_requests_total{provider, model, status}
+//	langspace_provider_request_duration_seconds{provider, model}
+//	langspace_tokens_total{provider, model, direction}
+//	langspace_cache_lookups_total{cache, result}
+//	langspace_trigger_firings_total{trigger, status}
+//
+// Embedders add their own metrics with Counter and Histogram. Several
+// runtimes, such as the versions of a rollout, may share a registry.
+type Metrics struct {
+	mu       sync.RWMutex
+	families map[string]*metricFamily
+
+	executions       *CounterVec
+	steps            *CounterVec
+	providerRequests *CounterVec
+	providerLatency  *HistogramVec
+	tokens           *CounterVec
+	cacheLookups     *CounterVec
+	triggerFirings   *CounterVec
+}
+
+// NewMetrics creates a registry with the runtime's metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+	m.executions = m.Counter("langspace_executions_total", "Executions of intents and pipelines.", "type", "name", "status")
+	m.steps = m.Counter("langspace_steps_total", "Pipeline steps run, by how they ended.", "pipeline", "step", "status")
+	m.providerRequests = m.Counter("langspace_provider_requests_total", "Completion requests sent to providers.", "provider", "model", "status")
+	m.providerLatency = m.Histogram("langspace_provider_request_duration_seconds", "Latency of completion requests, excluding rate limit waits.", DefaultLatencyBuckets, "provider", "model")
+	m.tokens = m.Counter("langspace_tokens_total", "Tokens used by completion requests.", "provider", "model", "direction")
+	m.cacheLookups = m.Counter("langspace_cache_lookups_total", "Lookups in the step and response caches.", "cache", "result")
+	m.triggerFirings = m.Counter("langspace_trigger_firings_total", "Trigger firings, by whether what they ran succeeded.", "trigger", "status")
+	return m
+}
+
+// WithMetrics counts what the runtime does in m (see Metrics).
+func WithMetrics(m *Metrics) Option {
+	return func(r *Runtime) {
+		r.metrics = m
+	}
+}
+
+// Metrics returns the runtime's metrics registry, or nil if metrics are not
+// enabled (see WithMetrics).
+func (r *Runtime) Metrics() *Metrics {
+	return r.metrics
+}
+
+type metricKind string
+
+const (
+	kindCounter   metricKind = "counter"
+	kindHistogram metricKind = "histogram"
+)
+
+// metricFamily is a metric with its series, keyed by their label values.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64  // counters
+	counts      []uint64 // histograms, per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// register adds a family, or returns the one registered under its name.
+// Registering a name again with a different kind or labels panics, as with
+// the Prometheus client.
+func (m *Metrics) register(f *metricFamily) *metricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.families[f.name]; ok {
+		if existing.kind != f.kind || strings.Join(existing.labels, ",") != strings.Join(f.labels, ",") {
+			panic(fmt.Sprintf("metric %q is already registered as a %s with labels %v", f.name, existing.kind, existing.labels))
+		}
+		return existing
+	}
+	f.series = make(map[string]*metricSeries)
+	m.families[f.name] = f
+	return f
+}
+
+// get returns the series of the given label values, creating it if needed.
+// The caller holds f.mu.
+func (f *metricFamily) get(labelValues []string) *metricSeries {
+	s, key := f.lookup(labelValues)
+	if s == nil {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// lookup returns the series of the given label values, or nil if there is
+// none yet, and its key. The caller holds f.mu.
+func (f *metricFamily) lookup(labelValues []string) (*metricSeries, string) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %q takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	return f.series[key], key
+}
+
+// CounterVec is a counter with a value per combination of label values.
+type CounterVec struct {
+	family *metricFamily
+}
+
+// Counter registers a counter, or returns the one already registered under
+// name.
+func (m *Metrics) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: m.register(&metricFamily{name: name, help: help, kind: kindCounter, labels: labels})}
+}
+
+// Inc adds 1 to the counter of the label values, given in the order of the
+// counter's labels.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label
+// values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %q cannot decrease", c.family.name))
+	}
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	c.family.get(labelValues).value += v
+}
+
+// Value returns the counter of the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	if s, _ := c.family.lookup(labelValues); s != nil {
+		return s.value
+	}
+	return 0
+}
+
+// HistogramVec is a histogram with a distribution per combination of label
+// values.
+type HistogramVec struct {
+	family *metricFamily
+}
+
+// Histogram registers a histogram with buckets of the given upper bounds,
+// or returns the one already registered under name.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{family: m.register(&metricFamily{name: name, help: help, kind: kindHistogram, labels: labels, buckets: buckets})}
+}
+
+// Observe adds v to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+	s := h.family.get(labelValues)
+	if i := sort.SearchFloat64s(h.family.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns how many values the histogram of the label values observed.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+	if s, _ := h.family.lookup(labelValues); s != nil {
+		return s.count
+	}
+	return 0
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition
+// format, sorted by name and label values.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.RLock()
+	families := make([]*metricFamily, 0, len(m.families))
+	for _, f := range m.families {
+		families = append(families, f)
+	}
+	m.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics to Prometheus, e.g. on /metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WritePrometheus(w); err != nil {
+		logAt(r.Context(), slog.LevelWarn, "failed to write metrics", "error", err)
+	}
+}
+
+func (f *metricFamily) write(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+
+	series := make([]*metricSeries, 0, len(f.series))
+	for _, s := range f.series {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].labelValues, "\xff") < strings.Join(series[j].labelValues, "\xff")
+	})
+	for _, s := range series {
+		labels := formatLabels(f.labels, s.labelValues)
+		if f.kind == kindCounter {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, labels, formatFloat(s.value))
+			continue
+		}
+		bucketLabels := append(f.labels[:len(f.labels):len(f.labels)], "le")
+		bucket := func(le string, count uint64) {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(bucketLabels, append(s.labelValues[:len(s.labelValues):len(s.labelValues)], le)), count)
+		}
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += s.counts[i]
+			bucket(formatFloat(upper), cumulative)
+		}
+		bucket("+Inf", s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, labels, s.count)
+	}
+}
+
+// formatLabels formats label pairs as {a="1",b="2"}, or nothing for none.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricStatus is the status label of an outcome.
+func metricStatus(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// The runtime's counts. Each does nothing without a registry.
+
+func (m *Metrics) countExecution(entity ast.Entity, err error) {
+	if m != nil {
+		m.executions.Inc(entity.Type(), entity.Name(), metricStatus(err))
+	}
+}
+
+func (m *Metrics) countStep(pipeline string, result *StepResult) {
+	if m != nil {
+		m.steps.Inc(pipeline, result.Name, string(result.Status))
+	}
+}
+
+func (m *Metrics) countProviderRequest(call ProviderCall) {
+	if m == nil {
+		return
+	}
+	status := "failure"
+	if call.Success {
+		status = "success"
+	}
+	m.providerRequests.Inc(call.Provider, call.Model, status)
+	m.providerLatency.Observe(call.Duration.Seconds(), call.Provider, call.Model)
+	m.tokens.Add(float64(call.InputTokens), call.Provider, call.Model, "input")
+	m.tokens.Add(float64(call.OutputTokens), call.Provider, call.Model, "output")
+}
+
+func (m *Metrics) countCacheLookup(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.Inc(cache, result)
+}
+
+func (m *Metrics) countTriggerFiring(trigger string, err error) {
+	if m != nil {
+		m.triggerFirings.Inc(trigger, metricStatus(err))
+	}
+}
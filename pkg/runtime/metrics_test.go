@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestMetrics_WritePrometheus(t *testing.T) {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+	runs := m.Counter("app_runs_total", "Runs.\nBy user.", "user")
+	runs.Inc(`a "quoted"\name`)
+	runs.Add(2.5, "bob")
+	latency := m.Histogram("app_latency_seconds", "Latency.", []float64{1, 0.5})
+	latency.Observe(0.2)
+	latency.Observe(0.7)
+	latency.Observe(3)
+	m.Counter("app_unused_total", "Never incremented.")
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP app_latency_seconds Latency.
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{le="0.5"} 1
+app_latency_seconds_bucket{le="1"} 2
+app_latency_seconds_bucket{le="+Inf"} 3
+app_latency_seconds_sum 3.9
+app_latency_seconds_count 3
+# HELP app_runs_total Runs.\nBy user.
+# TYPE app_runs_total counter
+app_runs_total{user="a \"quoted\"\\name"} 1
+app_runs_total{user="bob"} 2.5
+`
+	if got := b.String(); got != want {
+		t.Errorf("WritePrometheus() =\n%s\nwant\n%s", got, want)
+	}
+
+	m.Counter("app_runs_total", "Runs.", "user").Inc("bob")
+	if got := runs.Value("bob"); got != 3.5 {
+		t.Errorf("counter = %v, want registering it again to return the same counter", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a name with other labels to panic")
+		}
+	}()
+	m.Counter("app_runs_total", "Runs.", "team")
+}
+
+func TestExecute_Metrics(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "notes" {
+	step "draft" {
+		use: agent("writer")
+		input: "Draft notes"
+		cache: true
+	}
+	step "broken" {
+		use: agent("writer")
+		input: "Again"
+		stream_filters: ["sparkles"]
+	}
+}
+
+trigger "nightly" {
+	event: "nightly"
+	run: pipeline("notes")
+}
+`))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "Notes", FinishReason: FinishReasonStop, Usage: TokenUsage{InputTokens: 12, OutputTokens: 3}},
+	))
+	metrics := NewMetrics()
+	rt := New(ws, WithProvider("mock", provider), WithMetrics(metrics), WithStepCache(NewMemoryStepCache()))
+
+	for range 2 {
+		if _, err := rt.ExecuteByName(context.Background(), "pipeline", "notes"); err == nil {
+			t.Fatal("expected the broken step to fail the pipeline")
+		}
+	}
+	e := NewTriggerEngine(rt)
+	e.runCtx = context.Background()
+	e.active = true
+	if err := e.Fire("nightly", nil); err != nil {
+		t.Fatal(err)
+	}
+	e.running.Wait()
+
+	counts := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"failed executions", metrics.executions.Value("pipeline", "notes", "failure"), 3},
+		{"succeeded draft steps", metrics.steps.Value("notes", "draft", "succeeded"), 3},
+		{"failed broken steps", metrics.steps.Value("notes", "broken", "failed"), 3},
+		{"provider requests", metrics.providerRequests.Value("mock", "mock-model", "success"), 1},
+		{"input tokens", metrics.tokens.Value("mock", "mock-model", "input"), 12},
+		{"output tokens", metrics.tokens.Value("mock", "mock-model", "output"), 3},
+		{"step cache hits", metrics.cacheLookups.Value("step", "hit"), 2},
+		{"step cache misses", metrics.cacheLookups.Value("step", "miss"), 1},
+		{"trigger firings", metrics.triggerFirings.Value("nightly", "failure"), 1},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if n := metrics.providerLatency.Count("mock", "mock-model"); n != 1 {
+		t.Errorf("observed %d request latencies, want 1", n)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, line := range []string{
+		`langspace_executions_total{type="pipeline",name="notes",status="failure"} 3`,
+		`langspace_provider_request_duration_seconds_bucket{provider="mock",model="mock-model",le="+Inf"} 1`,
+		`langspace_cache_lookups_total{cache="step",result="hit"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("expected %q in\n%s", line, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// StepKind is what a step does when it runs.
+type StepKind string
+
+const (
+	StepKindModel   StepKind = "model"   // calls an agent's model
+	StepKindScript  StepKind = "script"  // runs a script, with `execute:`
+	StepKindCompare StepKind = "compare" // diffs two values, with `compare:`
+)
+
+// StepCall is a pipeline step about to run, as middleware sees it.
+type StepCall struct {
+	Pipeline string
+	Step     *ast.StepEntity
+	Kind     StepKind
+
+	// Number is the step's position in its pipeline, from 1, of Total
+	Number int
+	Total  int
+
+	// Execution is the run the step belongs to, with its variables,
+	// metadata, and the outputs of earlier steps
+	Execution *ExecutionContext
+
+	rewrites []func(*CompletionRequest)
+}
+
+// RewriteRequest has fn change the request a model step sends, such as its
+// prompt, before any model call or step cache lookup. Rewrites apply in the
+// order they are added, and do nothing for script and compare steps.
+func (c *StepCall) RewriteRequest(fn func(req *CompletionRequest)) {
+	c.rewrites = append(c.rewrites, fn)
+}
+
+// StepInvoker runs a step and returns its result.
+type StepInvoker func(ctx context.Context, call *StepCall) (*StepResult, error)
+
+// Middleware wraps the invoker of every pipeline step, to check, log,
+// measure, or change steps and their results. It may return without calling
+// next to stop a step from running.
+type Middleware func(next StepInvoker) StepInvoker
+
+// WithMiddleware adds middleware around every pipeline step (see Use).
+func WithMiddleware(mw ...Middleware) Option {
+	return func(r *Runtime) {
+		r.middleware = append(r.middleware, mw...)
+	}
+}
+
+// Use adds middleware around every pipeline step the runtime runs, whether
+// it calls a model or runs a script. Middleware applies in the order added,
+// the first outermost:
+//
+//	rt.Use(func(next runtime.StepInvoker) runtime.StepInvoker {
+//	    return func(ctx context.Context, call *runtime.StepCall) (*runtime.StepResult, error) {
+//	        start := time.Now()
+//	        result, err := next(ctx, call)
+//	        log.Printf("step %s took %s", call.Step.Name(), time.Since(start))
+//	        return result, err
+//	    }
+//	})
+//
+// Later steps see the Output of the result middleware returns, so
+// middleware can scrub or rewrite what a step produced.
+func (r *Runtime) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+// invokeStep runs a step through the runtime's middleware.
+func (r *Runtime) invokeStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver, stepNum, totalSteps int) (*StepResult, error) {
+	r.mu.RLock()
+	middleware := r.middleware
+	r.mu.RUnlock()
+	if len(middleware) == 0 {
+		return r.runStep(ctx, step, resolver, stepNum, totalSteps)
+	}
+
+	call := &StepCall{
+		Pipeline:  ctx.entityName,
+		Step:      step,
+		Kind:      kindOfStep(step),
+		Number:    stepNum,
+		Total:     totalSteps,
+		Execution: ctx,
+	}
+	invoke := func(c context.Context, call *StepCall) (*StepResult, error) {
+		ctx.Context = withStepCall(c, call)
+		return r.runStep(ctx, step, resolver, stepNum, totalSteps)
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		invoke = middleware[i](invoke)
+	}
+
+	stepResult, err := invoke(ctx.Context, call)
+	if stepResult == nil {
+		now := time.Now()
+		stepResult = &StepResult{Name: step.Name(), Error: err, StartTime: now, EndTime: now}
+	}
+	if err == nil && stepResult.Success {
+		ctx.SetStepOutput(step.Name(), stepResult.Output)
+		ctx.SetStepOutput(step.Name()+".output", stepResult.Output)
+	}
+	return stepResult, err
+}
+
+// kindOfStep returns what a step does.
+func kindOfStep(step *ast.StepEntity) StepKind {
+	if _, _, ok := stepScript(step); ok {
+		return StepKindScript
+	}
+	if _, ok := step.GetProperty("compare"); ok {
+		return StepKindCompare
+	}
+	return StepKindModel
+}
+
+type stepCallKey struct{}
+
+func withStepCall(ctx context.Context, call *StepCall) context.Context {
+	return context.WithValue(ctx, stepCallKey{}, call)
+}
+
+// rewriteRequest applies the request rewrites middleware added for a step,
+// and reports whether there were any. ctx may belong to an outer step, such
+// as one whose tool runs a pipeline, whose rewrites are not the step's.
+func rewriteRequest(ctx context.Context, step *ast.StepEntity, req *CompletionRequest) bool {
+	call, _ := ctx.Value(stepCallKey{}).(*StepCall)
+	if call == nil || call.Step != step || len(call.rewrites) == 0 {
+		return false
+	}
+	for _, fn := range call.rewrites {
+		fn(req)
+	}
+	return true
+}
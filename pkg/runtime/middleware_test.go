@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const middlewareSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+script "count" {
+	language: "sh"
+}
+
+pipeline "release" {
+	step "draft" {
+		use: agent("writer")
+		input: "Draft notes for alice@example.com"
+	}
+	step "polish" {
+		use: agent("writer")
+		input: step("draft").output
+	}
+	step "stats" {
+		execute: script("count")
+	}
+}
+`
+
+func middlewareWorkspace(t *testing.T) *workspace.Workspace {
+	t.Helper()
+	ws := workspace.New()
+	entities := parseSource(t, middlewareSource)
+	entities[1].SetProperty("code", ast.StringValue{Value: `printf '3' > "$LS_OUTPUT"`})
+	addEntities(t, ws, entities)
+	return ws
+}
+
+func TestRuntime_Use(t *testing.T) {
+	ws := middlewareWorkspace(t)
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "Notes, ask alice@example.com", FinishReason: FinishReasonStop},
+		MockResponse{Content: "Polished notes", FinishReason: FinishReasonStop},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next StepInvoker) StepInvoker {
+			return func(ctx context.Context, call *StepCall) (*StepResult, error) {
+				calls = append(calls, name+" "+call.Step.Name()+" "+string(call.Kind))
+				result, err := next(ctx, call)
+				calls = append(calls, name+" done")
+				return result, err
+			}
+		}
+	}
+	redact := func(s, with string) string { return strings.ReplaceAll(s, "alice@example.com", with) }
+	rt.Use(trace("outer"), trace("inner"))
+	rt.Use(func(next StepInvoker) StepInvoker {
+		return func(ctx context.Context, call *StepCall) (*StepResult, error) {
+			call.RewriteRequest(func(req *CompletionRequest) {
+				for i := range req.Messages {
+					req.Messages[i].Content = redact(req.Messages[i].Content, "[email]")
+				}
+			})
+			result, err := next(ctx, call)
+			if s, ok := result.Output.(string); ok {
+				result.Output = redact(s, "[scrubbed]")
+			}
+			return result, err
+		}
+	})
+
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "release")
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v, %v", err, result.Error)
+	}
+
+	want := []string{
+		"outer draft model", "inner draft model", "inner done", "outer done",
+		"outer polish model", "inner polish model", "inner done", "outer done",
+		"outer stats script", "inner stats script", "inner done", "outer done",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("middleware calls =\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	requests := provider.GetRequests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if got := requests[0].Messages[0].Content; strings.Contains(got, "alice") || !strings.Contains(got, "[email]") {
+		t.Errorf("expected the prompt rewritten, got %q", got)
+	}
+	if got := result.StepResults["draft"].Input; strings.Contains(got, "alice") {
+		t.Errorf("expected the step's input to be the prompt sent, got %q", got)
+	}
+	// The next step sees the scrubbed output
+	if got := requests[1].Messages[0].Content; !strings.Contains(got, "Notes, ask [scrubbed]") {
+		t.Errorf("polish prompt = %q, want the scrubbed draft", got)
+	}
+}
+
+func TestRuntime_UseDenies(t *testing.T) {
+	ws := middlewareWorkspace(t)
+	provider := NewMockProvider()
+	denied := errors.New("not allowed to run model steps")
+	rt := New(ws, WithProvider("mock", provider), WithMiddleware(func(next StepInvoker) StepInvoker {
+		return func(ctx context.Context, call *StepCall) (*StepResult, error) {
+			if call.Kind == StepKindModel && call.Execution.Metadata["role"] != "admin" {
+				return nil, denied
+			}
+			return next(ctx, call)
+		}
+	}))
+
+	result, err := rt.ExecuteByName(context.Background(), "pipeline", "release")
+	if !errors.Is(err, denied) {
+		t.Fatalf("Execute() error = %v, want the middleware's", err)
+	}
+	if step := result.StepResults["draft"]; step == nil || !errors.Is(step.Error, denied) || step.Status != StepFailed {
+		t.Errorf("expected a failed step result for a denied step, got %+v", step)
+	}
+	if n := len(provider.GetRequests()); n != 0 {
+		t.Errorf("expected no model calls, got %d", n)
+	}
+}
@@ -0,0 +1,327 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ModerationAction is what happens when moderated content is flagged.
+type ModerationAction string
+
+const (
+	// ModerationBlock stops the execution with a *ModerationError.
+	ModerationBlock ModerationAction = "block"
+
+	// ModerationFlag continues and marks the result's metadata with the
+	// flagged categories.
+	ModerationFlag ModerationAction = "flag"
+
+	// ModerationAnnotate continues and records the moderation outcome and
+	// scores in the result's metadata, whether or not content was flagged.
+	ModerationAnnotate ModerationAction = "annotate"
+)
+
+// ModerationPolicy selects which content is moderated. An empty action
+// leaves that content unchecked.
+type ModerationPolicy struct {
+	Input  ModerationAction `json:"input,omitempty"`
+	Output ModerationAction `json:"output,omitempty"`
+}
+
+// ModerationResult is the classification of a piece of text.
+type ModerationResult struct {
+	Flagged bool `json:"flagged"`
+
+	// Categories lists the flagged categories, sorted
+	Categories []string           `json:"categories,omitempty"`
+	Scores     map[string]float64 `json:"scores,omitempty"`
+}
+
+// Moderator classifies text for harmful content.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (*ModerationResult, error)
+}
+
+// ModerationError is returned when moderation blocks an execution.
+type ModerationError struct {
+	Stage      string
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s blocked by moderation (categories: %s)", e.Stage, strings.Join(e.Categories, ", "))
+}
+
+// WithModeration moderates execution inputs and outputs with m according to
+// policy. Entities may override the policy with a `moderation` property:
+//
+//	intent "chat" {
+//	    moderation: { input: "block", output: "flag" }
+//	}
+//
+// When no moderator is set, a registered provider implementing Moderator
+// (such as OpenAI) is used.
+func WithModeration(m Moderator, policy ModerationPolicy) Option {
+	return func(r *Runtime) {
+		r.moderator = m
+		r.moderationPolicy = policy
+	}
+}
+
+// getModerator returns the configured moderator, falling back to a
+// registered provider that supports moderation.
+func (r *Runtime) getModerator() Moderator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.moderator != nil {
+		return r.moderator
+	}
+	if m, ok := r.providers["openai"].(Moderator); ok {
+		return m
+	}
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if m, ok := r.providers[name].(Moderator); ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// getModerationPolicy returns the runtime policy overridden by the entity's
+// `moderation` property.
+func (r *Runtime) getModerationPolicy(entity ast.Entity) (ModerationPolicy, error) {
+	policy := r.moderationPolicy
+	prop, ok := entity.GetProperty("moderation")
+	if !ok {
+		return policy, nil
+	}
+	obj, ok := prop.(ast.ObjectValue)
+	if !ok {
+		return policy, fmt.Errorf("%s %q: moderation must be an object like { input: \"block\" }", entity.Type(), entity.Name())
+	}
+	for stage, target := range map[string]*ModerationAction{"input": &policy.Input, "output": &policy.Output} {
+		v, ok := obj.Properties[stage]
+		if !ok {
+			continue
+		}
+		sv, ok := v.(ast.StringValue)
+		if !ok {
+			return policy, fmt.Errorf("%s %q: moderation %s must be a string", entity.Type(), entity.Name(), stage)
+		}
+		switch action := ModerationAction(sv.Value); action {
+		case ModerationBlock, ModerationFlag, ModerationAnnotate, "":
+			*target = action
+		default:
+			return policy, fmt.Errorf("%s %q: invalid moderation action %q (use block, flag, or annotate)", entity.Type(), entity.Name(), sv.Value)
+		}
+	}
+	return policy, nil
+}
+
+// moderate checks value according to action, records the check in the
+// audit log, and adds annotations to metadata. It returns an error only when
+// the execution must stop: flagged content under ModerationBlock, or a
+// failed check under ModerationBlock (moderation fails closed).
+func (r *Runtime) moderate(ctx *ExecutionContext, entity ast.Entity, stage string, action ModerationAction, value interface{}, metadata map[string]string) error {
+	if action == "" || value == nil {
+		return nil
+	}
+	text := moderationText(value)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	event := AuditEvent{
+		Type:     "moderation",
+		Entity:   entity.Type() + "/" + entity.Name(),
+		Stage:    stage,
+		Action:   string(action),
+		Metadata: ctx.Metadata,
+	}
+
+	var result *ModerationResult
+	var err error
+	if moderator := r.getModerator(); moderator == nil {
+		err = fmt.Errorf("no moderator configured")
+	} else {
+		result, err = moderator.Moderate(ctx.Context, text)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s moderation failed: %w", stage, err)
+		event.Error = err.Error()
+		event.Blocked = action == ModerationBlock
+		r.audit(ctx.Context, event)
+		if event.Blocked {
+			return err
+		}
+		logAt(ctx.Context, slog.LevelWarn, err.Error())
+		return nil
+	}
+
+	event.Flagged = result.Flagged
+	event.Categories = result.Categories
+	key := "moderation_" + stage
+
+	switch action {
+	case ModerationBlock:
+		if result.Flagged {
+			event.Blocked = true
+			r.audit(ctx.Context, event)
+			return &ModerationError{Stage: stage, Categories: result.Categories}
+		}
+	case ModerationFlag:
+		if result.Flagged {
+			metadata[key] = "flagged"
+			metadata[key+"_categories"] = strings.Join(result.Categories, ",")
+		}
+	case ModerationAnnotate:
+		metadata[key] = "clean"
+		if result.Flagged {
+			metadata[key] = "flagged"
+			metadata[key+"_categories"] = strings.Join(result.Categories, ",")
+		}
+		if data, err := json.Marshal(result.Scores); err == nil && len(result.Scores) > 0 {
+			metadata[key+"_scores"] = string(data)
+		}
+	}
+
+	r.audit(ctx.Context, event)
+	return nil
+}
+
+// moderationText returns the text to moderate for an input or output value.
+func moderationText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return toString(v)
+		}
+		return string(data)
+	default:
+		return toString(v)
+	}
+}
+
+// HTTPModerator calls a moderation endpoint that accepts {"input": text}
+// and responds in the OpenAI moderation format.
+type HTTPModerator struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// HTTPModeratorOption is a functional option for configuring HTTPModerator.
+type HTTPModeratorOption func(*HTTPModerator)
+
+// WithModeratorHeader sets a header sent with every request (e.g. an API key).
+func WithModeratorHeader(key, value string) HTTPModeratorOption {
+	return func(m *HTTPModerator) {
+		m.headers[key] = value
+	}
+}
+
+// WithModeratorHTTPClient sets a custom HTTP client.
+func WithModeratorHTTPClient(client *http.Client) HTTPModeratorOption {
+	return func(m *HTTPModerator) {
+		m.httpClient = client
+	}
+}
+
+// NewHTTPModerator creates a moderator for the endpoint at url.
+func NewHTTPModerator(url string, opts ...HTTPModeratorOption) *HTTPModerator {
+	m := &HTTPModerator{
+		url:        url,
+		headers:    make(map[string]string),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Moderate classifies text.
+func (m *HTTPModerator) Moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", m.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range m.headers {
+		httpReq.Header.Set(k, v)
+	}
+	return doModeration(m.httpClient, httpReq)
+}
+
+// doModeration sends a moderation request and decodes an OpenAI-format
+// response. Content is flagged if any result is flagged.
+func doModeration(client *http.Client, req *http.Request) (*ModerationResult, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logAt(req.Context(), slog.LevelWarn, "failed to close response body", "error", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var modResp struct {
+		Results []struct {
+			Flagged        bool               `json:"flagged"`
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	result := &ModerationResult{Scores: make(map[string]float64)}
+	flagged := make(map[string]bool)
+	for _, res := range modResp.Results {
+		result.Flagged = result.Flagged || res.Flagged
+		for category, hit := range res.Categories {
+			if hit {
+				flagged[category] = true
+			}
+		}
+		for category, score := range res.CategoryScores {
+			if score > result.Scores[category] {
+				result.Scores[category] = score
+			}
+		}
+	}
+	for category := range flagged {
+		result.Categories = append(result.Categories, category)
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
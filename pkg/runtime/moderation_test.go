@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// keywordModerator flags text containing "forbidden".
+type keywordModerator struct {
+	calls []string
+}
+
+func (m *keywordModerator) Moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	m.calls = append(m.calls, text)
+	if strings.Contains(text, "forbidden") {
+		return &ModerationResult{Flagged: true, Categories: []string{"harassment"}, Scores: map[string]float64{"harassment": 0.9}}, nil
+	}
+	return &ModerationResult{Scores: map[string]float64{"harassment": 0.01}}, nil
+}
+
+func newModeratedRuntime(t *testing.T, intentProps, reply string, opts ...Option) (*Runtime, *MockProvider) {
+	t.Helper()
+	source := `
+agent "assistant" {
+	model: "mock-model"
+}
+
+intent "chat" {
+	use: agent("assistant")
+	input: "{{$input}}"
+	` + intentProps + `
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: reply, FinishReason: FinishReasonStop}))
+	return New(ws, append([]Option{WithProvider("mock", provider)}, opts...)...), provider
+}
+
+func TestExecute_ModerationBlocksInput(t *testing.T) {
+	moderator := &keywordModerator{}
+	auditLog := NewMemoryAuditLog(0)
+	rt, provider := newModeratedRuntime(t, "", "hello",
+		WithModeration(moderator, ModerationPolicy{Input: ModerationBlock}),
+		WithAuditLog(auditLog))
+
+	_, err := rt.ExecuteByName(context.Background(), "intent", "chat", WithInput("something forbidden"))
+	var modErr *ModerationError
+	if !errors.As(err, &modErr) || modErr.Stage != "input" {
+		t.Fatalf("expected input moderation error, got %v", err)
+	}
+	if len(provider.GetRequests()) != 0 {
+		t.Error("expected blocked input not to reach the model")
+	}
+
+	events := auditLog.Events()
+	if len(events) != 1 || !events[0].Blocked || events[0].Entity != "intent/chat" || events[0].Categories[0] != "harassment" {
+		t.Errorf("unexpected audit events: %+v", events)
+	}
+
+	// Clean input passes
+	if _, err := rt.ExecuteByName(context.Background(), "intent", "chat", WithInput("hi there")); err != nil {
+		t.Fatalf("expected clean input to run, got %v", err)
+	}
+	if events := auditLog.Events(); len(events) != 2 || events[1].Flagged {
+		t.Errorf("expected clean check to be audited, got %+v", events)
+	}
+}
+
+func TestExecute_ModerationOutputActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    string
+		reply    string
+		wantErr  bool
+		metadata map[string]string
+	}{
+		{
+			name:     "flag",
+			props:    `moderation: { output: "flag" }`,
+			reply:    "a forbidden reply",
+			metadata: map[string]string{"moderation_output": "flagged", "moderation_output_categories": "harassment"},
+		},
+		{
+			name:     "flag clean",
+			props:    `moderation: { output: "flag" }`,
+			reply:    "a kind reply",
+			metadata: map[string]string{"moderation_output": ""},
+		},
+		{
+			name:     "annotate",
+			props:    `moderation: { output: "annotate" }`,
+			reply:    "a kind reply",
+			metadata: map[string]string{"moderation_output": "clean", "moderation_output_scores": `{"harassment":0.01}`},
+		},
+		{
+			name:    "block",
+			props:   `moderation: { output: "block" }`,
+			reply:   "a forbidden reply",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, _ := newModeratedRuntime(t, tt.props, tt.reply, WithModeration(&keywordModerator{}, ModerationPolicy{}))
+
+			result, err := rt.ExecuteByName(context.Background(), "intent", "chat", WithInput("hi"))
+			if tt.wantErr {
+				if err == nil || result.Output != nil || result.Success {
+					t.Fatalf("expected blocked output, got %+v (err %v)", result, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute error: %v", err)
+			}
+			for k, want := range tt.metadata {
+				if got := result.Metadata[k]; got != want {
+					t.Errorf("metadata[%q] = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExecute_ModerationInvalidPolicy(t *testing.T) {
+	rt, _ := newModeratedRuntime(t, `moderation: { input: "shout" }`, "hello")
+	if _, err := rt.ExecuteByName(context.Background(), "intent", "chat", WithInput("hi")); err == nil {
+		t.Error("expected error for invalid moderation action")
+	}
+}
+
+func TestExecute_ModerationFailsClosed(t *testing.T) {
+	// No moderator and no provider supporting moderation
+	rt, provider := newModeratedRuntime(t, `moderation: { input: "block" }`, "hello")
+	if _, err := rt.ExecuteByName(context.Background(), "intent", "chat", WithInput("hi")); err == nil {
+		t.Error("expected blocking moderation without a moderator to fail")
+	}
+	if len(provider.GetRequests()) != 0 {
+		t.Error("expected input not to reach the model")
+	}
+}
+
+func TestOpenAIProvider_Moderate(t *testing.T) {
+	var req map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/moderations" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		req = nil
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_, _ = w.Write([]byte(`{"results": [{"flagged": true, "categories": {"violence": true, "hate": false}, "category_scores": {"violence": 0.8, "hate": 0.1}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider(WithOpenAIAPIKey("test"), WithOpenAIBaseURL(server.URL))
+	result, err := p.Moderate(context.Background(), "some text")
+	if err != nil {
+		t.Fatalf("Moderate error: %v", err)
+	}
+	if req["input"] != "some text" || req["model"] != "omni-moderation-latest" {
+		t.Errorf("unexpected request %v", req)
+	}
+	if !result.Flagged || len(result.Categories) != 1 || result.Categories[0] != "violence" || result.Scores["hate"] != 0.1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	// The same format works for a custom endpoint
+	m := NewHTTPModerator(server.URL+"/v1/moderations", WithModeratorHeader("X-Api-Key", "k"))
+	if result, err := m.Moderate(context.Background(), "some text"); err != nil || !result.Flagged {
+		t.Errorf("HTTPModerator: %+v, %v", result, err)
+	}
+	if req["input"] != "some text" {
+		t.Errorf("unexpected request %v", req)
+	}
+}
+
+func TestJSONAuditLog(t *testing.T) {
+	var buf bytes.Buffer
+	auditLog := NewJSONAuditLog(&buf)
+	if err := auditLog.Record(AuditEvent{Type: "moderation", Entity: "intent/chat", Stage: "input", Flagged: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditLog.Record(AuditEvent{Type: "moderation", Entity: "intent/chat", Stage: "output"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var event AuditEvent
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil || !event.Flagged || event.Stage != "input" {
+		t.Errorf("unexpected event %+v (%v)", event, err)
+	}
+}
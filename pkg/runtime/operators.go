@@ -0,0 +1,338 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operand kinds, in the order operands are coerced:
+//
+//   - numbers (float64, int, int64, and strings that parse as a number in
+//     full, such as "10" or " 2.5\n"; "10 apples" is a string)
+//   - durations (time.Duration, and strings that parse with
+//     time.ParseDuration, such as "90s" or "1h30m")
+//   - bools (only bool values; "true" is a string)
+//   - null (nil, e.g. a missing optional output)
+//   - strings (everything else)
+const (
+	kindString = iota
+	kindNumber
+	kindDuration
+	kindBool
+	kindNull
+)
+
+var kindNames = map[int]string{
+	kindString:   "string",
+	kindNumber:   "number",
+	kindDuration: "duration",
+	kindBool:     "bool",
+	kindNull:     "null",
+}
+
+// operandValue is a value coerced for use with an operator.
+type operandValue struct {
+	kind int
+	num  float64
+	dur  time.Duration
+	b    bool
+	str  string
+}
+
+// coerceOperand coerces a resolved value to an operand.
+func coerceOperand(v interface{}) operandValue {
+	switch val := v.(type) {
+	case float64:
+		return operandValue{kind: kindNumber, num: val}
+	case float32:
+		return operandValue{kind: kindNumber, num: float64(val)}
+	case int:
+		return operandValue{kind: kindNumber, num: float64(val)}
+	case int64:
+		return operandValue{kind: kindNumber, num: float64(val)}
+	case time.Duration:
+		return operandValue{kind: kindDuration, dur: val}
+	case bool:
+		return operandValue{kind: kindBool, b: val}
+	case nil:
+		return operandValue{kind: kindNull}
+	}
+
+	s := toString(v)
+	trimmed := strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return operandValue{kind: kindNumber, num: f}
+	}
+	if d, err := time.ParseDuration(trimmed); err == nil {
+		return operandValue{kind: kindDuration, dur: d}
+	}
+	return operandValue{kind: kindString, str: s}
+}
+
+func (o operandValue) String() string {
+	switch o.kind {
+	case kindNumber:
+		return strconv.FormatFloat(o.num, 'g', -1, 64)
+	case kindDuration:
+		return o.dur.String()
+	case kindBool:
+		return strconv.FormatBool(o.b)
+	case kindNull:
+		return "null"
+	}
+	return strconv.Quote(o.str)
+}
+
+// compareValues compares two resolved values. Numbers compare numerically
+// and durations by length. Strings compare lexicographically, and a string
+// equals a value only if it has the same text. Null equals only null.
+// Ordering a number or duration against a value of another kind, or
+// ordering bools or null, is an error.
+func compareValues(op string, left, right interface{}) (bool, error) {
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return false, fmt.Errorf("unknown comparison operator: %s", op)
+	}
+
+	l, r := coerceOperand(left), coerceOperand(right)
+
+	var c int
+	switch {
+	case l.kind == kindNumber && r.kind == kindNumber:
+		c = compareOrdered(l.num, r.num)
+	case l.kind == kindDuration && r.kind == kindDuration:
+		c = compareOrdered(l.dur, r.dur)
+	case l.kind == kindBool && r.kind == kindBool:
+		if op != "==" && op != "!=" {
+			return false, fmt.Errorf("cannot order bools with %s", op)
+		}
+		if l.b != r.b {
+			c = 1
+		}
+	case l.kind == kindNull || r.kind == kindNull:
+		if op != "==" && op != "!=" {
+			return false, fmt.Errorf("cannot order null with %s", op)
+		}
+		if l.kind != r.kind {
+			c = 1
+		}
+	default:
+		if op != "==" && op != "!=" && l.kind != r.kind {
+			return false, fmt.Errorf("cannot compare %s %s with %s %s using %s", kindNames[l.kind], l, kindNames[r.kind], r, op)
+		}
+		c = strings.Compare(toString(left), toString(right))
+	}
+
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func compareOrdered[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// applyArithmetic applies an arithmetic operator (+, -, *, /, %) to two
+// resolved values:
+//
+//   - number op number is a number; dividing by zero is an error
+//   - duration + or - duration is a duration, and duration / duration is a
+//     number (their ratio)
+//   - duration * number, number * duration, and duration / number are
+//     durations
+//   - + with a string operand concatenates the operands' text
+//
+// Every other combination is an error.
+func applyArithmetic(op string, left, right interface{}) (interface{}, error) {
+	l, r := coerceOperand(left), coerceOperand(right)
+
+	switch {
+	case l.kind == kindNumber && r.kind == kindNumber:
+		switch op {
+		case "+":
+			return l.num + r.num, nil
+		case "-":
+			return l.num - r.num, nil
+		case "*":
+			return l.num * r.num, nil
+		case "/":
+			if r.num == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return l.num / r.num, nil
+		case "%":
+			if r.num == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return math.Mod(l.num, r.num), nil
+		}
+
+	case l.kind == kindDuration && r.kind == kindDuration:
+		switch op {
+		case "+":
+			return l.dur + r.dur, nil
+		case "-":
+			return l.dur - r.dur, nil
+		case "/":
+			if r.dur == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return float64(l.dur) / float64(r.dur), nil
+		}
+
+	case l.kind == kindDuration && r.kind == kindNumber:
+		switch op {
+		case "*":
+			return time.Duration(float64(l.dur) * r.num), nil
+		case "/":
+			if r.num == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return time.Duration(float64(l.dur) / r.num), nil
+		}
+
+	case l.kind == kindNumber && r.kind == kindDuration:
+		if op == "*" {
+			return time.Duration(l.num * float64(r.dur)), nil
+		}
+
+	case op == "+" && (l.kind == kindString || r.kind == kindString):
+		return toString(left) + toString(right), nil
+	}
+
+	switch op {
+	case "+", "-", "*", "/", "%":
+		return nil, fmt.Errorf("cannot apply %s to %s %s and %s %s", op, kindNames[l.kind], l, kindNames[r.kind], r)
+	}
+	return nil, fmt.Errorf("unknown arithmetic operator: %s", op)
+}
+
+// expressionOperators are the binary operators of interpolated expressions,
+// from lowest to highest precedence. Operators must be surrounded by spaces,
+// so names such as step.fetch-data.output are not split.
+var expressionOperators = [][]string{
+	{"??"},
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// splitBinaryExpression splits an expression such as `step.count.output * 2`
+// at its lowest-precedence, rightmost operator. Quoted text is not split.
+func splitBinaryExpression(expr string) (left, op, right string, ok bool) {
+	// Find the whitespace-separated words outside quotes
+	type word struct{ start, end int }
+	var words []word
+	start, quoted := -1, false
+	for i := 0; i <= len(expr); i++ {
+		if i < len(expr) && (quoted || (expr[i] != ' ' && expr[i] != '\t' && expr[i] != '\n')) {
+			if start < 0 {
+				start = i
+			}
+			if expr[i] == '"' && (i == 0 || expr[i-1] != '\\') {
+				quoted = !quoted
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, word{start, i})
+			start = -1
+		}
+	}
+	if len(words) < 3 {
+		return "", "", "", false
+	}
+
+	for _, level := range expressionOperators {
+		for i := len(words) - 2; i >= 1; i-- {
+			w := words[i]
+			if containsString(level, expr[w.start:w.end]) {
+				return expr[:w.start], expr[w.start:w.end], expr[w.end:], true
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// evalBinaryExpression evaluates an interpolated expression with a binary
+// operator, e.g. {{step.count.output * 2}}, {{$elapsed > "5m"}}, or
+// {{step.x?.summary ?? "none"}}.
+func (r *Resolver) evalBinaryExpression(left, op, right string) (interface{}, error) {
+	l, err := r.resolveOperand(left)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "??":
+		if l != nil {
+			return l, nil
+		}
+	case "&&", "||":
+		// The right operand is only resolved if the left one does not
+		// decide the result
+		b, err := conditionValue(l, op)
+		if err != nil || b == (op == "||") {
+			return b, err
+		}
+	}
+	rv, err := r.resolveOperand(right)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case op == "??":
+		return rv, nil
+	case op == "&&" || op == "||":
+		return conditionValue(rv, op)
+	case containsString(expressionOperators[3], op):
+		return compareValues(op, l, rv)
+	}
+	return applyArithmetic(op, l, rv)
+}
+
+// resolveOperand resolves one side of an interpolated expression; quoted
+// text is a string literal and null is null.
+func (r *Resolver) resolveOperand(expr string) (interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "null" {
+		return nil, nil
+	}
+	if len(expr) >= 2 && strings.HasPrefix(expr, `"`) && strings.HasSuffix(expr, `"`) {
+		if s, err := strconv.Unquote(expr); err == nil {
+			return s, nil
+		}
+	}
+	return r.resolveExpression(expr)
+}
@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// ParamError reports the params of an invocation that do not match those the
+// intent or pipeline declares. It lists every violation, not just the first.
+type ParamError struct {
+	EntityType string
+	EntityName string
+	Violations []ParamViolation
+}
+
+// ParamViolation is a single parameter that failed validation.
+type ParamViolation struct {
+	Param   string
+	Message string // in English
+
+	// Code identifies the message in the i18n catalog, if it is cataloged
+	Code i18n.Code
+}
+
+func (e *ParamError) Error() string {
+	return e.Localize(i18n.English)
+}
+
+// Localize returns the error in the language of tag. Violations whose
+// message is not cataloged stay in English.
+func (e *ParamError) Localize(tag string) string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msg := v.Message
+		if v.Code != "" {
+			msg = i18n.Translate(tag, v.Code)
+		}
+		msgs[i] = fmt.Sprintf("%s: %s", v.Param, msg)
+	}
+	return i18n.Translate(tag, i18n.InvalidParams, e.EntityType, e.EntityName, strings.Join(msgs, "; "))
+}
+
+// MessageCode returns the catalog code of the error.
+func (e *ParamError) MessageCode() i18n.Code {
+	return i18n.InvalidParams
+}
+
+// WithParams sets the params of an intent or pipeline, available as
+// params.name. They are checked against the entity's `params` declaration
+// before anything runs:
+//
+//	intent "review-module" {
+//	  params: {
+//	    module: string required "The module path to review"
+//	    depth: enum optional "shallow" ["shallow", "deep"]
+//	  }
+//	}
+func WithParams(params map[string]interface{}) ExecuteOption {
+	return func(o *executeOptions) {
+		o.params = params
+	}
+}
+
+// bindParams checks params against the parameters an entity declares: their
+// types and enum values, that required ones are given, and that no unknown
+// ones are. Defaults are applied to omitted optional parameters. Params are
+// returned as given if the entity declares none.
+func bindParams(entity ast.Entity, params map[string]interface{}, resolver *Resolver) (map[string]interface{}, error) {
+	prop, ok := entity.GetProperty("params")
+	if !ok {
+		return params, nil
+	}
+	decl, ok := prop.(ast.ObjectValue)
+	if !ok {
+		return nil, fmt.Errorf("params of %s %q must be an object", entity.Type(), entity.Name())
+	}
+
+	perr := &ParamError{EntityType: entity.Type(), EntityName: entity.Name()}
+	fields, _ := shorthandSchema(decl)["properties"].(map[string]interface{})
+	bound := make(map[string]interface{}, len(decl.Properties))
+
+	names := make([]string, 0, len(decl.Properties))
+	for name := range decl.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, given := params[name]
+		tp, typed := decl.Properties[name].(ast.TypedParameterValue)
+		if !typed {
+			// A plain value is the default of an untyped parameter
+			if !given {
+				resolved, err := resolver.Resolve(decl.Properties[name])
+				if err != nil {
+					return nil, fmt.Errorf("default of parameter %q: %w", name, err)
+				}
+				bound[name] = resolved
+				continue
+			}
+			bound[name] = value
+			continue
+		}
+
+		if !given {
+			switch {
+			case tp.Required:
+				perr.Violations = append(perr.Violations, ParamViolation{Param: name, Message: i18n.New(i18n.ParamRequired).Error(), Code: i18n.ParamRequired})
+			case tp.Default != nil:
+				resolved, err := resolver.Resolve(tp.Default)
+				if err != nil {
+					return nil, fmt.Errorf("default of parameter %q: %w", name, err)
+				}
+				bound[name] = resolved
+			}
+			continue
+		}
+
+		// Go values such as int or []string are checked as their JSON form
+		normalized := value
+		var err error
+		if _, isString := value.(string); !isString {
+			normalized, err = toJSONValue(value)
+		}
+		if err == nil {
+			if field, ok := fields[name].(map[string]interface{}); ok {
+				err = validateSchema(normalized, field, name)
+			}
+		}
+		if err != nil {
+			perr.Violations = append(perr.Violations, ParamViolation{Param: name, Message: strings.TrimPrefix(err.Error(), name+": ")})
+			continue
+		}
+		bound[name] = value
+	}
+
+	var unknown []string
+	for name := range params {
+		if _, ok := decl.Properties[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		perr.Violations = append(perr.Violations, ParamViolation{Param: name, Message: i18n.New(i18n.ParamUnknown).Error(), Code: i18n.ParamUnknown})
+	}
+
+	if len(perr.Violations) > 0 {
+		return nil, perr
+	}
+	return bound, nil
+}
@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const paramsSource = `
+agent "reviewer" {
+	model: "mock-model"
+}
+
+intent "review-module" {
+	params: {
+		module: string required "The module path to review"
+		depth: enum ["shallow", "deep"]
+		tags: array optional
+		strict: bool optional false
+		limit: 10
+	}
+	use: agent("reviewer")
+	input: "Review {{params.module}} ({{params.depth}}, strict: {{params.strict}}, limit: {{params.limit}})"
+}
+`
+
+func TestExecute_Params(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, paramsSource))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "ok"}))
+	rt := New(ws, WithProvider("mock", provider))
+	intent, _ := ws.GetEntityByName("intent", "review-module")
+
+	_, err := rt.Execute(context.Background(), intent, WithParams(map[string]interface{}{
+		"module": "pkg/parser",
+		"depth":  "deep",
+		"tags":   []string{"go"},
+	}))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	requests := provider.GetRequests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	want := "Review pkg/parser (deep, strict: false, limit: 10)"
+	if got := requests[0].Messages[0].Content; !strings.Contains(got, want) {
+		t.Errorf("expected defaults to be applied, got prompt %q", got)
+	}
+}
+
+func TestExecute_ParamsInvalid(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, paramsSource))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "ok"}))
+	rt := New(ws, WithProvider("mock", provider))
+	intent, _ := ws.GetEntityByName("intent", "review-module")
+
+	result, err := rt.Execute(context.Background(), intent, WithParams(map[string]interface{}{
+		"depth":  "thorough",
+		"tags":   "go",
+		"strict": 1,
+		"colour": "red",
+	}))
+
+	var perr *ParamError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParamError, got %v", err)
+	}
+	want := []ParamViolation{
+		{Param: "depth", Message: "value thorough is not one of [shallow deep]"},
+		{Param: "module", Message: "required parameter not provided", Code: i18n.ParamRequired},
+		{Param: "strict", Message: "expected boolean, got number"},
+		{Param: "tags", Message: "expected array, got string"},
+		{Param: "colour", Message: "unknown parameter", Code: i18n.ParamUnknown},
+	}
+	if len(perr.Violations) != len(want) {
+		t.Fatalf("violations = %+v, want %+v", perr.Violations, want)
+	}
+	for i := range want {
+		if perr.Violations[i] != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, perr.Violations[i], want[i])
+		}
+	}
+	if !strings.HasPrefix(err.Error(), `invalid params for intent "review-module": depth: value thorough`) {
+		t.Errorf("unexpected message %q", err)
+	}
+	// Cataloged violations are translated; schema errors stay in English
+	if got := i18n.Localize(err, "de"); !strings.HasPrefix(got, `ungültige Parameter für intent "review-module": depth: value thorough`) ||
+		!strings.Contains(got, "module: erforderlicher Parameter fehlt") {
+		t.Errorf("unexpected localized message %q", got)
+	}
+	if result == nil || result.Error != err {
+		t.Errorf("expected the error on the result, got %+v", result)
+	}
+	if n := len(provider.GetRequests()); n != 0 {
+		t.Errorf("expected no LLM calls, got %d", n)
+	}
+}
@@ -0,0 +1,412 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
+)
+
+// defaultPlannedOutputTokens is the number of output tokens assumed per model
+// call when estimating cost.
+const defaultPlannedOutputTokens = 1024
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// DefaultModelPricing holds list prices used for cost estimates. Models are
+// matched by the longest key that prefixes the model name.
+var DefaultModelPricing = map[string]ModelPricing{
+	"claude-opus-4":    {Input: 15, Output: 75},
+	"claude-sonnet-4":  {Input: 3, Output: 15},
+	"claude-3-7":       {Input: 3, Output: 15},
+	"claude-3-5-haiku": {Input: 0.8, Output: 4},
+	"claude-3-haiku":   {Input: 0.25, Output: 1.25},
+	"gpt-4o-mini":      {Input: 0.15, Output: 0.6},
+	"gpt-4o":           {Input: 2.5, Output: 10},
+	"gpt-4.1-mini":     {Input: 0.4, Output: 1.6},
+	"gpt-4.1":          {Input: 2, Output: 8},
+	"o3-mini":          {Input: 1.1, Output: 4.4},
+	"gemini-2.5-pro":   {Input: 1.25, Output: 10},
+	"gemini-2.5-flash": {Input: 0.3, Output: 2.5},
+	"gemini-2.0-flash": {Input: 0.1, Output: 0.4},
+}
+
+// lookupPricing returns the pricing for a model, if known.
+func lookupPricing(model string) (ModelPricing, bool) {
+	return lookupByPrefix(DefaultModelPricing, model)
+}
+
+// usageCost returns the cost in USD of token usage on a model, and whether
+// the model's pricing is known.
+func usageCost(model string, usage TokenUsage) (float64, bool) {
+	pricing, ok := lookupPricing(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.InputTokens)*pricing.Input + float64(usage.OutputTokens)*pricing.Output) / 1e6, true
+}
+
+// ExecutionCost returns the cost in USD of an execution's token usage, based
+// on DefaultModelPricing. Usage on models with unknown pricing is not counted.
+func ExecutionCost(result *ExecutionResult) float64 {
+	if result == nil {
+		return 0
+	}
+	if len(result.StepResults) > 0 {
+		var total float64
+		for _, step := range result.StepResults {
+			if step == nil {
+				continue
+			}
+			cost, _ := usageCost(step.Model, step.TokensUsed)
+			total += cost
+		}
+		return total
+	}
+	cost, _ := usageCost(result.Metadata["model"], result.TokensUsed)
+	return cost
+}
+
+// estimateTokens roughly estimates the token count of text (~4 bytes per token).
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// PlannedStep is a model call that an execution would make.
+type PlannedStep struct {
+	Name         string   `json:"name"`
+	Agent        string   `json:"agent"`
+	Model        string   `json:"model"`
+	SystemPrompt string   `json:"system_prompt"`
+	Prompt       string   `json:"prompt"`
+	Tools        []string `json:"tools,omitempty"`
+
+	// Script is set for steps that run a script instead of a model
+	Script string `json:"script,omitempty"`
+
+	// Compare is the method of steps that compare two values instead of
+	// calling a model
+	Compare string `json:"compare,omitempty"`
+
+	// Estimated usage and cost; Cost is 0 when the model's pricing is unknown
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	PriceKnown   bool    `json:"price_known"`
+
+	// Error is set if the step could not be planned (e.g. an unknown agent)
+	Error string `json:"error,omitempty"`
+}
+
+// ExecutionPlan is the result of a dry run: the model calls an intent or
+// pipeline would make for a given input, without calling any provider.
+type ExecutionPlan struct {
+	Type         string        `json:"type"`
+	Name         string        `json:"name"`
+	Steps        []PlannedStep `json:"steps"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	Cost         float64       `json:"cost"`
+}
+
+// Plan performs a dry run of an intent or pipeline with the given input and
+// returns the model calls it would make, with estimated tokens and cost.
+// Outputs of earlier steps are not known, so references to them are replaced
+// by placeholders. Branches and loops are not expanded.
+func (r *Runtime) Plan(ctx context.Context, entity ast.Entity, input interface{}) (*ExecutionPlan, error) {
+	execCtx := &ExecutionContext{
+		Context:     ctx,
+		Runtime:     r,
+		Workspace:   r.workspace,
+		Variables:   make(map[string]interface{}),
+		Metadata:    make(map[string]string),
+		StepOutputs: make(map[string]interface{}),
+		StartTime:   time.Now(),
+	}
+	if input != nil {
+		execCtx.SetVariable("input", input)
+	}
+	resolver := NewResolver(execCtx)
+
+	plan := &ExecutionPlan{Type: entity.Type(), Name: entity.Name()}
+
+	switch e := entity.(type) {
+	case *ast.IntentEntity:
+		plan.Steps = append(plan.Steps, r.planIntent(execCtx, e, resolver))
+	case *ast.PipelineEntity:
+		steps := pipelineSteps(e)
+		for _, step := range steps {
+			placeholder := fmt.Sprintf("<output of step %q>", step.Name())
+			execCtx.SetStepOutput(step.Name(), placeholder)
+			execCtx.SetStepOutput(step.Name()+".output", placeholder)
+		}
+		for _, step := range steps {
+			plan.Steps = append(plan.Steps, r.planStep(execCtx, step, resolver))
+		}
+	default:
+		return nil, fmt.Errorf("cannot plan entity type: %s", entity.Type())
+	}
+
+	for _, step := range plan.Steps {
+		plan.InputTokens += step.InputTokens
+		plan.OutputTokens += step.OutputTokens
+		plan.Cost += step.Cost
+	}
+	return plan, nil
+}
+
+// pipelineSteps returns the pipeline's steps followed by the steps of its
+// parallel block, if any.
+func pipelineSteps(pipeline *ast.PipelineEntity) []*ast.StepEntity {
+	steps := append([]*ast.StepEntity(nil), pipeline.Steps...)
+	if prop, ok := pipeline.GetProperty("parallel"); ok {
+		if nested, ok := prop.(ast.NestedEntityValue); ok {
+			if parallel, ok := nested.Entity.(*ast.ParallelEntity); ok {
+				steps = append(steps, parallel.Steps...)
+			}
+		}
+	}
+	return steps
+}
+
+func (r *Runtime) planIntent(ctx *ExecutionContext, intent ast.Entity, resolver *Resolver) PlannedStep {
+	planned := PlannedStep{Name: intent.Name()}
+
+	agent, err := r.resolveAgent(ctx, intent, resolver)
+	if err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+	planned.Agent = agent.Name()
+
+	if planned.Prompt, err = r.buildIntentPrompt(ctx, intent, resolver); err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+	if planned.SystemPrompt, err = r.getAgentSystemPrompt(agent, resolver); err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+
+	r.estimateStep(&planned, agent)
+	return planned
+}
+
+func (r *Runtime) planStep(ctx *ExecutionContext, step *ast.StepEntity, resolver *Resolver) PlannedStep {
+	planned := PlannedStep{Name: step.Name()}
+
+	// Scripts make no model calls
+	if name, _, ok := stepScript(step); ok {
+		planned.Script = name
+		planned.PriceKnown = true
+		return planned
+	}
+
+	// Comparisons make no model calls, though embedding them does
+	if compare, err := getCompareConfig(step); err != nil || compare != nil {
+		if err != nil {
+			planned.Error = err.Error()
+			return planned
+		}
+		planned.Compare = compare.method
+		planned.PriceKnown = compare.method != CompareEmbedding
+		return planned
+	}
+
+	agent, err := r.resolveStepAgent(ctx, step, resolver)
+	if err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+	planned.Agent = agent.Name()
+
+	if planned.Prompt, err = r.buildStepPrompt(ctx, step, resolver); err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+	if planned.SystemPrompt, err = r.getAgentSystemPrompt(agent, resolver); err != nil {
+		planned.Error = err.Error()
+		return planned
+	}
+	if instruction, ok := step.GetProperty("instruction"); ok {
+		if instructionStr, err := resolver.ResolveString(instruction); err == nil && instructionStr != "" {
+			planned.SystemPrompt += "\n\n" + instructionStr
+		}
+	}
+
+	r.estimateStep(&planned, agent)
+	return planned
+}
+
+// estimateStep fills in the model, tools, and estimated usage of a step.
+func (r *Runtime) estimateStep(planned *PlannedStep, agent ast.Entity) {
+	planned.Model = r.getAgentModel(agent)
+	planned.Tools = validator.AgentToolNames(agent)
+	planned.InputTokens = CountTokens(planned.Model, planned.SystemPrompt) + CountTokens(planned.Model, planned.Prompt)
+	planned.OutputTokens = defaultPlannedOutputTokens
+	if prop, ok := agent.GetProperty("max_tokens"); ok {
+		if nv, ok := prop.(ast.NumberValue); ok && nv.Value > 0 {
+			planned.OutputTokens = int(nv.Value)
+		}
+	}
+
+	planned.Cost, planned.PriceKnown = usageCost(planned.Model, TokenUsage{
+		InputTokens:  planned.InputTokens,
+		OutputTokens: planned.OutputTokens,
+	})
+}
+
+// StepChange describes how a planned step differs between two plans.
+type StepChange struct {
+	Name string `json:"name"`
+
+	// Changes lists the changed fields, e.g. `model: "a" -> "b"`
+	Changes []string `json:"changes"`
+
+	// PromptDiff and SystemPromptDiff are line diffs ("- " removed, "+ " added)
+	PromptDiff       []string `json:"prompt_diff,omitempty"`
+	SystemPromptDiff []string `json:"system_prompt_diff,omitempty"`
+
+	CostDelta float64 `json:"cost_delta"`
+}
+
+// PlanDiff describes how an execution plan changed between two versions of a
+// workflow.
+type PlanDiff struct {
+	Added      []PlannedStep `json:"added,omitempty"`
+	Removed    []PlannedStep `json:"removed,omitempty"`
+	Changed    []StepChange  `json:"changed,omitempty"`
+	OldCost    float64       `json:"old_cost"`
+	NewCost    float64       `json:"new_cost"`
+	CostDelta  float64       `json:"cost_delta"`
+	TokenDelta int           `json:"token_delta"`
+}
+
+// Empty reports whether the plans are equivalent.
+func (d *PlanDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffPlans compares two execution plans step by step. Either plan may be nil,
+// e.g. when a pipeline was added or removed.
+func DiffPlans(oldPlan, newPlan *ExecutionPlan) *PlanDiff {
+	if oldPlan == nil {
+		oldPlan = &ExecutionPlan{}
+	}
+	if newPlan == nil {
+		newPlan = &ExecutionPlan{}
+	}
+
+	diff := &PlanDiff{
+		OldCost:    oldPlan.Cost,
+		NewCost:    newPlan.Cost,
+		CostDelta:  newPlan.Cost - oldPlan.Cost,
+		TokenDelta: (newPlan.InputTokens + newPlan.OutputTokens) - (oldPlan.InputTokens + oldPlan.OutputTokens),
+	}
+
+	oldSteps := make(map[string]PlannedStep, len(oldPlan.Steps))
+	for _, step := range oldPlan.Steps {
+		oldSteps[step.Name] = step
+	}
+	newSteps := make(map[string]bool, len(newPlan.Steps))
+	for _, step := range newPlan.Steps {
+		newSteps[step.Name] = true
+		old, ok := oldSteps[step.Name]
+		if !ok {
+			diff.Added = append(diff.Added, step)
+			continue
+		}
+		if change, changed := diffStep(old, step); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, step := range oldPlan.Steps {
+		if !newSteps[step.Name] {
+			diff.Removed = append(diff.Removed, step)
+		}
+	}
+	return diff
+}
+
+func diffStep(oldStep, newStep PlannedStep) (StepChange, bool) {
+	change := StepChange{Name: newStep.Name, CostDelta: newStep.Cost - oldStep.Cost}
+
+	field := func(name, oldVal, newVal string) {
+		if oldVal != newVal {
+			change.Changes = append(change.Changes, fmt.Sprintf("%s: %q -> %q", name, oldVal, newVal))
+		}
+	}
+	field("agent", oldStep.Agent, newStep.Agent)
+	field("script", oldStep.Script, newStep.Script)
+	field("compare", oldStep.Compare, newStep.Compare)
+	field("model", oldStep.Model, newStep.Model)
+	field("tools", strings.Join(oldStep.Tools, ", "), strings.Join(newStep.Tools, ", "))
+	field("error", oldStep.Error, newStep.Error)
+	if oldStep.OutputTokens != newStep.OutputTokens {
+		change.Changes = append(change.Changes, fmt.Sprintf("max output tokens: %d -> %d", oldStep.OutputTokens, newStep.OutputTokens))
+	}
+	if oldStep.SystemPrompt != newStep.SystemPrompt {
+		change.Changes = append(change.Changes, "system prompt changed")
+		change.SystemPromptDiff = diffLines(oldStep.SystemPrompt, newStep.SystemPrompt)
+	}
+	if oldStep.Prompt != newStep.Prompt {
+		change.Changes = append(change.Changes, "prompt changed")
+		change.PromptDiff = diffLines(oldStep.Prompt, newStep.Prompt)
+	}
+	return change, len(change.Changes) > 0
+}
+
+// diffLines returns a minimal line diff of two texts, listing only removed
+// ("- ") and added ("+ ") lines.
+func diffLines(a, b string) []string {
+	return diffSequences(strings.Split(a, "\n"), strings.Split(b, "\n"))
+}
+
+// diffSequences returns a minimal diff of two sequences, listing only
+// removed ("- ") and added ("+ ") elements.
+func diffSequences(x, y []string) []string {
+	// Longest common subsequence table
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
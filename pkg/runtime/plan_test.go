@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestPlan_Pipeline(t *testing.T) {
+	source := `
+agent "writer" {
+	model: "claude-sonnet-4-20250514"
+	instruction: "Write clearly"
+	max_tokens: 200
+}
+
+agent "local" {
+	model: "my-local-model"
+}
+
+pipeline "draft" {
+	step "outline" {
+		use: agent("writer")
+		input: $input
+	}
+	step "expand" {
+		use: agent("local")
+		input: step("outline").output
+		instruction: "Expand the outline"
+	}
+	step "broken" {
+		use: agent("missing")
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	rt := New(ws)
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	plan, err := rt.Plan(context.Background(), pipeline, "Topic: testing")
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if len(plan.Steps) != 3 {
+		t.Fatalf("expected 3 planned steps, got %d", len(plan.Steps))
+	}
+
+	outline := plan.Steps[0]
+	if !strings.Contains(outline.Prompt, "Topic: testing") || outline.SystemPrompt != "Write clearly" {
+		t.Errorf("unexpected outline prompts: %q / %q", outline.SystemPrompt, outline.Prompt)
+	}
+	if outline.OutputTokens != 200 || !outline.PriceKnown || outline.Cost <= 0 {
+		t.Errorf("expected priced estimate with max_tokens 200, got %+v", outline)
+	}
+
+	expand := plan.Steps[1]
+	if !strings.Contains(expand.Prompt, `<output of step "outline">`) {
+		t.Errorf("expected placeholder for previous step output, got %q", expand.Prompt)
+	}
+	if !strings.HasSuffix(expand.SystemPrompt, "Expand the outline") {
+		t.Errorf("expected step instruction in system prompt, got %q", expand.SystemPrompt)
+	}
+	if expand.PriceKnown || expand.Cost != 0 {
+		t.Errorf("expected unknown pricing for local model, got %+v", expand)
+	}
+
+	if plan.Steps[2].Error == "" {
+		t.Error("expected error for step with unknown agent")
+	}
+	if plan.Cost != outline.Cost {
+		t.Errorf("expected plan cost %v, got %v", outline.Cost, plan.Cost)
+	}
+}
+
+func TestDiffPlans(t *testing.T) {
+	oldPlan := &ExecutionPlan{
+		Steps: []PlannedStep{
+			{Name: "a", Agent: "x", Model: "gpt-4o", Prompt: "one\ntwo", Cost: 0.01},
+			{Name: "b", Agent: "x", Model: "gpt-4o", Cost: 0.02},
+		},
+		Cost: 0.03,
+	}
+	newPlan := &ExecutionPlan{
+		Steps: []PlannedStep{
+			{Name: "a", Agent: "x", Model: "gpt-4o", Prompt: "one\nthree", Cost: 0.01},
+			{Name: "c", Agent: "y", Model: "gpt-4o-mini", Cost: 0.001},
+		},
+		Cost: 0.011,
+	}
+
+	diff := DiffPlans(oldPlan, newPlan)
+	if len(diff.Added) != 1 || diff.Added[0].Name != "c" {
+		t.Errorf("expected step c added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "b" {
+		t.Errorf("expected step b removed, got %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Name != "a" {
+		t.Fatalf("expected step a changed, got %+v", diff.Changed)
+	}
+	if got := strings.Join(diff.Changed[0].PromptDiff, "|"); got != "- two|+ three" {
+		t.Errorf("unexpected prompt diff: %q", got)
+	}
+	if diff.CostDelta > -0.018 || diff.CostDelta < -0.02 {
+		t.Errorf("expected cost delta of about -0.019, got %v", diff.CostDelta)
+	}
+
+	if !DiffPlans(oldPlan, oldPlan).Empty() {
+		t.Error("expected identical plans to have an empty diff")
+	}
+	if added := DiffPlans(nil, newPlan); len(added.Added) != 2 {
+		t.Errorf("expected all steps added when old plan is nil, got %+v", added)
+	}
+}
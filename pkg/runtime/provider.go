@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"context"
+	"fmt"
 )
 
 // LLMProvider defines the interface for LLM providers.
@@ -20,6 +21,22 @@ type LLMProvider interface {
 	ListModels(ctx context.Context) ([]ModelInfo, error)
 }
 
+// EmbeddingProvider is implemented by providers that can embed text into vectors.
+type EmbeddingProvider interface {
+	// Embed returns one embedding vector per input text.
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// APIError is returned by providers when the API responds with a non-success status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
 // CompletionRequest represents a request to an LLM.
 type CompletionRequest struct {
 	// Model specifies which model to use
@@ -34,6 +51,10 @@ type CompletionRequest struct {
 	// Temperature controls randomness (0-1)
 	Temperature float64 `json:"temperature,omitempty"`
 
+	// Seed makes sampling repeatable on providers that support it (see
+	// WithDeterministic)
+	Seed *int `json:"seed,omitempty"`
+
 	// MaxTokens limits the response length
 	MaxTokens int `json:"max_tokens,omitempty"`
 
@@ -43,6 +64,10 @@ type CompletionRequest struct {
 	// StopSequences to end generation
 	StopSequences []string `json:"stop_sequences,omitempty"`
 
+	// ReasoningBudget enables extended thinking with the given token budget
+	// on providers that support it
+	ReasoningBudget int `json:"reasoning_budget,omitempty"`
+
 	// Metadata for tracking/logging
 	Metadata map[string]string `json:"metadata,omitempty"`
 }
@@ -87,6 +112,9 @@ type CompletionResponse struct {
 	// Content is the generated text
 	Content string `json:"content"`
 
+	// Reasoning is the model's thinking content, kept separate from the answer
+	Reasoning string `json:"reasoning,omitempty"`
+
 	// ToolCalls contains any tool calls made
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 
@@ -135,6 +163,20 @@ type StreamHandler interface {
 	OnError(err error)
 }
 
+// replayResponse passes a response that was not streamed to handler: its
+// reasoning and its content as a chunk each, then the response.
+func replayResponse(resp *CompletionResponse, handler StreamHandler) {
+	index := 0
+	if resp.Reasoning != "" {
+		handler.OnChunk(StreamChunk{Content: resp.Reasoning, Type: ChunkTypeReasoning, Index: index})
+		index++
+	}
+	if resp.Content != "" {
+		handler.OnChunk(StreamChunk{Content: resp.Content, Type: ChunkTypeContent, Index: index})
+	}
+	handler.OnComplete(resp)
+}
+
 // StreamChunk represents a chunk of streamed content.
 type StreamChunk struct {
 	// Content is the text chunk
@@ -155,6 +197,7 @@ type ChunkType string
 
 const (
 	ChunkTypeContent   ChunkType = "content"
+	ChunkTypeReasoning ChunkType = "reasoning"
 	ChunkTypeToolStart ChunkType = "tool_start"
 	ChunkTypeToolEnd   ChunkType = "tool_end"
 )
@@ -185,6 +228,14 @@ const (
 	ProgressTypeStep     ProgressType = "step"
 	ProgressTypeComplete ProgressType = "complete"
 	ProgressTypeError    ProgressType = "error"
+
+	// ProgressTypeHeartbeat is sent every Config.HeartbeatInterval while an
+	// execution runs, with its "elapsed" and "idle" time in Metadata
+	ProgressTypeHeartbeat ProgressType = "heartbeat"
+
+	// ProgressTypeStall is sent when an execution has been silent for
+	// Config.StallTimeout
+	ProgressTypeStall ProgressType = "stall"
 )
 
 // DefaultStreamHandler provides a no-op implementation of StreamHandler.
@@ -261,3 +312,14 @@ func (h *BufferedStreamHandler) Content() string {
 	}
 	return content
 }
+
+// Reasoning returns all collected reasoning content as a single string.
+func (h *BufferedStreamHandler) Reasoning() string {
+	var reasoning string
+	for _, chunk := range h.Chunks {
+		if chunk.Type == ChunkTypeReasoning {
+			reasoning += chunk.Content
+		}
+	}
+	return reasoning
+}
@@ -6,7 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -74,9 +74,15 @@ type anthropicRequest struct {
 	Messages    []anthropicMessage `json:"messages"`
 	System      string             `json:"system,omitempty"`
 	MaxTokens   int                `json:"max_tokens"`
-	Temperature float64            `json:"temperature,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
 	Stream      bool               `json:"stream,omitempty"`
 	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
 type anthropicMessage struct {
@@ -87,6 +93,7 @@ type anthropicMessage struct {
 type anthropicContentBlock struct {
 	Type      string                 `json:"type"`
 	Text      string                 `json:"text,omitempty"`
+	Thinking  string                 `json:"thinking,omitempty"`
 	ID        string                 `json:"id,omitempty"`
 	Name      string                 `json:"name,omitempty"`
 	Input     map[string]interface{} `json:"input,omitempty"`
@@ -184,9 +191,10 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req *CompletionRequest
 		Messages:    anthropicMsgs,
 		System:      req.SystemPrompt,
 		MaxTokens:   maxTokens,
-		Temperature: req.Temperature,
+		Temperature: &req.Temperature,
 		Tools:       anthropicTools,
 	}
+	applyAnthropicThinking(&anthropicReq, req.ReasoningBudget)
 
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
@@ -197,6 +205,7 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req *CompletionRequest
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", p.apiKey)
@@ -208,13 +217,13 @@ func (p *AnthropicProvider) Complete(ctx context.Context, req *CompletionRequest
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var anthropicResp anthropicResponse
@@ -235,12 +244,14 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse) *Completion
 		},
 	}
 
-	// Extract content and tool calls
-	var contentParts []string
+	// Extract content, reasoning, and tool calls
+	var contentParts, reasoningParts []string
 	for _, block := range resp.Content {
 		switch block.Type {
 		case "text":
 			contentParts = append(contentParts, block.Text)
+		case "thinking":
+			reasoningParts = append(reasoningParts, block.Thinking)
 		case "tool_use":
 			result.ToolCalls = append(result.ToolCalls, ToolCall{
 				ID:        block.ID,
@@ -250,6 +261,7 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse) *Completion
 		}
 	}
 	result.Content = strings.Join(contentParts, "")
+	result.Reasoning = strings.Join(reasoningParts, "")
 
 	// Convert stop reason
 	switch resp.StopReason {
@@ -311,9 +323,10 @@ func (p *AnthropicProvider) CompleteStream(ctx context.Context, req *CompletionR
 		Messages:    anthropicMsgs,
 		System:      req.SystemPrompt,
 		MaxTokens:   maxTokens,
-		Temperature: req.Temperature,
+		Temperature: &req.Temperature,
 		Stream:      true,
 	}
+	applyAnthropicThinking(&anthropicReq, req.ReasoningBudget)
 
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
@@ -324,6 +337,7 @@ func (p *AnthropicProvider) CompleteStream(ctx context.Context, req *CompletionR
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", p.apiKey)
@@ -335,13 +349,13 @@ func (p *AnthropicProvider) CompleteStream(ctx context.Context, req *CompletionR
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	return p.handleStream(resp.Body, handler)
@@ -349,7 +363,7 @@ func (p *AnthropicProvider) CompleteStream(ctx context.Context, req *CompletionR
 
 func (p *AnthropicProvider) handleStream(body io.Reader, handler StreamHandler) (*CompletionResponse, error) {
 	result := &CompletionResponse{}
-	var contentBuilder strings.Builder
+	var contentBuilder, reasoningBuilder strings.Builder
 	chunkIndex := 0
 
 	reader := NewSSEReader(body)
@@ -369,15 +383,17 @@ func (p *AnthropicProvider) handleStream(body io.Reader, handler StreamHandler)
 				Type  string `json:"type"`
 				Index int    `json:"index"`
 				Delta struct {
-					Type string `json:"type"`
-					Text string `json:"text"`
+					Type     string `json:"type"`
+					Text     string `json:"text"`
+					Thinking string `json:"thinking"`
 				} `json:"delta"`
 			}
 			if err := json.Unmarshal([]byte(event.Data), &delta); err != nil {
 				continue
 			}
 
-			if delta.Delta.Type == "text_delta" {
+			switch delta.Delta.Type {
+			case "text_delta":
 				contentBuilder.WriteString(delta.Delta.Text)
 				handler.OnChunk(StreamChunk{
 					Content: delta.Delta.Text,
@@ -385,6 +401,14 @@ func (p *AnthropicProvider) handleStream(body io.Reader, handler StreamHandler)
 					Index:   chunkIndex,
 				})
 				chunkIndex++
+			case "thinking_delta":
+				reasoningBuilder.WriteString(delta.Delta.Thinking)
+				handler.OnChunk(StreamChunk{
+					Content: delta.Delta.Thinking,
+					Type:    ChunkTypeReasoning,
+					Index:   chunkIndex,
+				})
+				chunkIndex++
 			}
 
 		case "message_delta":
@@ -429,10 +453,25 @@ func (p *AnthropicProvider) handleStream(body io.Reader, handler StreamHandler)
 	}
 
 	result.Content = contentBuilder.String()
+	result.Reasoning = reasoningBuilder.String()
 	handler.OnComplete(result)
 	return result, nil
 }
 
+// applyAnthropicThinking enables extended thinking when a reasoning budget is set.
+// The API requires max_tokens to exceed the budget and does not accept a custom
+// temperature while thinking is enabled.
+func applyAnthropicThinking(req *anthropicRequest, budget int) {
+	if budget <= 0 {
+		return
+	}
+	req.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+	req.Temperature = nil
+	if req.MaxTokens <= budget {
+		req.MaxTokens = budget + 4096
+	}
+}
+
 func (p *AnthropicProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	// Anthropic doesn't have a models endpoint, return known models
 	return []ModelInfo{
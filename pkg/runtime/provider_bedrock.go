@@ -0,0 +1,542 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BedrockProvider implements LLMProvider for Amazon Bedrock, serving
+// Anthropic Claude and Amazon Titan models through the Converse API. Requests
+// are signed with SigV4 using credentials from the standard AWS chain.
+type BedrockProvider struct {
+	region      string
+	endpoint    string
+	profile     string
+	credentials *AWSCredentials
+	chain       *awsCredentialChain
+	httpClient  *http.Client
+}
+
+// BedrockOption is a functional option for configuring BedrockProvider.
+type BedrockOption func(*BedrockProvider)
+
+// WithBedrockRegion sets the AWS region (default: AWS_REGION or the shared
+// config file).
+func WithBedrockRegion(region string) BedrockOption {
+	return func(p *BedrockProvider) {
+		p.region = region
+	}
+}
+
+// WithBedrockProfile reads credentials and region from a named profile in
+// the shared AWS files instead of the default chain.
+func WithBedrockProfile(profile string) BedrockOption {
+	return func(p *BedrockProvider) {
+		p.profile = profile
+	}
+}
+
+// WithBedrockCredentials sets static credentials, bypassing the chain.
+func WithBedrockCredentials(creds AWSCredentials) BedrockOption {
+	return func(p *BedrockProvider) {
+		p.credentials = &creds
+	}
+}
+
+// WithBedrockEndpoint sets a custom endpoint (e.g., a VPC endpoint).
+func WithBedrockEndpoint(url string) BedrockOption {
+	return func(p *BedrockProvider) {
+		p.endpoint = url
+	}
+}
+
+// WithBedrockHTTPClient sets a custom HTTP client.
+func WithBedrockHTTPClient(client *http.Client) BedrockOption {
+	return func(p *BedrockProvider) {
+		p.httpClient = client
+	}
+}
+
+// NewBedrockProvider creates a new Bedrock provider.
+func NewBedrockProvider(opts ...BedrockOption) *BedrockProvider {
+	p := &BedrockProvider{httpClient: http.DefaultClient}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.region == "" {
+		p.region = awsRegion(p.profile)
+	}
+	if p.endpoint == "" && p.region != "" {
+		p.endpoint = "https://bedrock-runtime." + p.region + ".amazonaws.com"
+	}
+	p.chain = newAWSCredentialChain(p.profile)
+
+	return p
+}
+
+func (p *BedrockProvider) Name() string {
+	return "bedrock"
+}
+
+// isBedrockModel reports whether a model is a Bedrock model ID, such as
+// "anthropic.claude-3-5-sonnet-20240620-v1:0" or the cross-region inference
+// profile "us.anthropic.claude-3-5-sonnet-20240620-v1:0".
+func isBedrockModel(model string) bool {
+	for _, vendor := range []string{"anthropic.", "amazon."} {
+		if strings.HasPrefix(model, vendor) || strings.Contains(model, "."+vendor) {
+			return true
+		}
+	}
+	return false
+}
+
+// bedrockRequest is the request format for the Converse API.
+type bedrockRequest struct {
+	Messages        []bedrockMessage        `json:"messages"`
+	System          []bedrockContentBlock   `json:"system,omitempty"`
+	InferenceConfig *bedrockInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *bedrockToolConfig      `json:"toolConfig,omitempty"`
+
+	// AdditionalModelRequestFields passes model-specific fields, such as
+	// Claude's thinking configuration
+	AdditionalModelRequestFields map[string]interface{} `json:"additionalModelRequestFields,omitempty"`
+}
+
+type bedrockMessage struct {
+	Role    string                `json:"role"`
+	Content []bedrockContentBlock `json:"content"`
+}
+
+type bedrockContentBlock struct {
+	Text             string                   `json:"text,omitempty"`
+	ToolUse          *bedrockToolUse          `json:"toolUse,omitempty"`
+	ToolResult       *bedrockToolResult       `json:"toolResult,omitempty"`
+	ReasoningContent *bedrockReasoningContent `json:"reasoningContent,omitempty"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string                 `json:"toolUseId"`
+	Name      string                 `json:"name"`
+	Input     map[string]interface{} `json:"input"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string                `json:"toolUseId"`
+	Content   []bedrockContentBlock `json:"content"`
+}
+
+type bedrockReasoningContent struct {
+	ReasoningText struct {
+		Text string `json:"text"`
+	} `json:"reasoningText"`
+}
+
+type bedrockInferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type bedrockToolConfig struct {
+	Tools []bedrockTool `json:"tools"`
+}
+
+type bedrockTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		InputSchema struct {
+			JSON map[string]interface{} `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+type bedrockUsage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	TotalTokens  int `json:"totalTokens"`
+}
+
+// bedrockResponse is the response format of the Converse API.
+type bedrockResponse struct {
+	Output struct {
+		Message bedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string       `json:"stopReason"`
+	Usage      bedrockUsage `json:"usage"`
+}
+
+// buildRequest converts a completion request to the Converse format.
+func (p *BedrockProvider) buildRequest(req *CompletionRequest) *bedrockRequest {
+	brReq := &bedrockRequest{Messages: make([]bedrockMessage, 0, len(req.Messages))}
+	if req.SystemPrompt != "" {
+		brReq.System = []bedrockContentBlock{{Text: req.SystemPrompt}}
+	}
+
+	for _, msg := range req.Messages {
+		var content []bedrockContentBlock
+		role := string(msg.Role)
+		switch {
+		case msg.ToolCallID != "":
+			// Tool results come from the user role
+			role = "user"
+			content = append(content, bedrockContentBlock{ToolResult: &bedrockToolResult{
+				ToolUseID: msg.ToolCallID,
+				Content:   []bedrockContentBlock{{Text: msg.Content}},
+			}})
+		case msg.Content != "":
+			content = append(content, bedrockContentBlock{Text: msg.Content})
+		}
+		for _, tc := range msg.ToolCalls {
+			input := tc.Arguments
+			if input == nil {
+				input = map[string]interface{}{}
+			}
+			content = append(content, bedrockContentBlock{ToolUse: &bedrockToolUse{ToolUseID: tc.ID, Name: tc.Name, Input: input}})
+		}
+		if len(content) > 0 {
+			brReq.Messages = append(brReq.Messages, bedrockMessage{Role: role, Content: content})
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		brReq.ToolConfig = &bedrockToolConfig{}
+		for _, t := range req.Tools {
+			var tool bedrockTool
+			tool.ToolSpec.Name = t.Name
+			tool.ToolSpec.Description = t.Description
+			tool.ToolSpec.InputSchema.JSON = t.Parameters
+			if tool.ToolSpec.InputSchema.JSON == nil {
+				tool.ToolSpec.InputSchema.JSON = map[string]interface{}{"type": "object"}
+			}
+			brReq.ToolConfig.Tools = append(brReq.ToolConfig.Tools, tool)
+		}
+	}
+
+	config := &bedrockInferenceConfig{
+		MaxTokens:     req.MaxTokens,
+		Temperature:   &req.Temperature,
+		StopSequences: req.StopSequences,
+	}
+	// Claude on Bedrock takes the same thinking configuration as the
+	// Anthropic API, with the same constraints
+	if req.ReasoningBudget > 0 && strings.Contains(req.Model, "anthropic.") {
+		brReq.AdditionalModelRequestFields = map[string]interface{}{
+			"thinking": anthropicThinking{Type: "enabled", BudgetTokens: req.ReasoningBudget},
+		}
+		config.Temperature = nil
+		if config.MaxTokens <= req.ReasoningBudget {
+			config.MaxTokens = req.ReasoningBudget + 4096
+		}
+	}
+	brReq.InferenceConfig = config
+
+	return brReq
+}
+
+// post sends a signed request to a model operation such as converse.
+func (p *BedrockProvider) post(ctx context.Context, model, operation string, payload interface{}) (*http.Response, error) {
+	if p.endpoint == "" {
+		return nil, fmt.Errorf("bedrock region not set (set AWS_REGION or the provider's region)")
+	}
+	creds := p.credentials
+	if creds == nil {
+		var err error
+		if creds, err = p.chain.Retrieve(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Model IDs contain ':', which must be escaped in the path
+	url := p.endpoint + "/model/" + awsURIEncode(model) + "/" + operation
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+	signV4(httpReq, body, creds, p.region, "bedrock", time.Now())
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return resp, nil
+}
+
+func (p *BedrockProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, req.Model, "converse", p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	var brResp bedrockResponse
+	if err := json.NewDecoder(resp.Body).Decode(&brResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	result := &CompletionResponse{
+		Model:        req.Model,
+		FinishReason: bedrockFinishReason(brResp.StopReason),
+		Usage: TokenUsage{
+			InputTokens:  brResp.Usage.InputTokens,
+			OutputTokens: brResp.Usage.OutputTokens,
+			TotalTokens:  brResp.Usage.TotalTokens,
+		},
+	}
+	var contentParts, reasoningParts []string
+	for _, block := range brResp.Output.Message.Content {
+		switch {
+		case block.ToolUse != nil:
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:        block.ToolUse.ToolUseID,
+				Name:      block.ToolUse.Name,
+				Arguments: block.ToolUse.Input,
+			})
+		case block.ReasoningContent != nil:
+			reasoningParts = append(reasoningParts, block.ReasoningContent.ReasoningText.Text)
+		default:
+			contentParts = append(contentParts, block.Text)
+		}
+	}
+	result.Content = strings.Join(contentParts, "")
+	result.Reasoning = strings.Join(reasoningParts, "")
+	return result, nil
+}
+
+func bedrockFinishReason(stopReason string) FinishReason {
+	switch stopReason {
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolUse
+	default:
+		return FinishReasonStop
+	}
+}
+
+func (p *BedrockProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, req.Model, "converse-stream", p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	return p.handleStream(req.Model, resp.Body, handler)
+}
+
+// handleStream reads a ConverseStream response, which uses the AWS event
+// stream encoding rather than server-sent events.
+func (p *BedrockProvider) handleStream(model string, body io.Reader, handler StreamHandler) (*CompletionResponse, error) {
+	result := &CompletionResponse{Model: model}
+	var contentBuilder, reasoningBuilder strings.Builder
+	chunkIndex := 0
+
+	// Tool inputs arrive as JSON fragments per content block
+	type pendingTool struct {
+		call  ToolCall
+		input strings.Builder
+	}
+	tools := make(map[int]*pendingTool)
+	var order []int
+
+	for {
+		msg, err := readEventStreamMessage(body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			handler.OnError(err)
+			return nil, err
+		}
+
+		if msg.headers[":message-type"] == "exception" {
+			err := fmt.Errorf("bedrock %s: %s", msg.headers[":exception-type"], msg.payload)
+			handler.OnError(err)
+			return nil, err
+		}
+
+		var event struct {
+			ContentBlockIndex int `json:"contentBlockIndex"`
+			Start             struct {
+				ToolUse *struct {
+					ToolUseID string `json:"toolUseId"`
+					Name      string `json:"name"`
+				} `json:"toolUse"`
+			} `json:"start"`
+			Delta struct {
+				Text    string `json:"text"`
+				ToolUse *struct {
+					Input string `json:"input"`
+				} `json:"toolUse"`
+				ReasoningContent *struct {
+					Text string `json:"text"`
+				} `json:"reasoningContent"`
+			} `json:"delta"`
+			StopReason string       `json:"stopReason"`
+			Usage      bedrockUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(msg.payload, &event); err != nil {
+			continue
+		}
+
+		switch msg.headers[":event-type"] {
+		case "contentBlockStart":
+			if tu := event.Start.ToolUse; tu != nil {
+				tools[event.ContentBlockIndex] = &pendingTool{call: ToolCall{ID: tu.ToolUseID, Name: tu.Name}}
+				order = append(order, event.ContentBlockIndex)
+			}
+		case "contentBlockDelta":
+			switch {
+			case event.Delta.ToolUse != nil:
+				if t, ok := tools[event.ContentBlockIndex]; ok {
+					t.input.WriteString(event.Delta.ToolUse.Input)
+				}
+			case event.Delta.ReasoningContent != nil:
+				reasoningBuilder.WriteString(event.Delta.ReasoningContent.Text)
+				handler.OnChunk(StreamChunk{Content: event.Delta.ReasoningContent.Text, Type: ChunkTypeReasoning, Index: chunkIndex})
+				chunkIndex++
+			case event.Delta.Text != "":
+				contentBuilder.WriteString(event.Delta.Text)
+				handler.OnChunk(StreamChunk{Content: event.Delta.Text, Type: ChunkTypeContent, Index: chunkIndex})
+				chunkIndex++
+			}
+		case "messageStop":
+			result.FinishReason = bedrockFinishReason(event.StopReason)
+		case "metadata":
+			result.Usage = TokenUsage{
+				InputTokens:  event.Usage.InputTokens,
+				OutputTokens: event.Usage.OutputTokens,
+				TotalTokens:  event.Usage.TotalTokens,
+			}
+		}
+	}
+
+	for _, i := range order {
+		t := tools[i]
+		if t.input.Len() > 0 {
+			_ = json.Unmarshal([]byte(t.input.String()), &t.call.Arguments)
+		}
+		result.ToolCalls = append(result.ToolCalls, t.call)
+	}
+	result.Content = contentBuilder.String()
+	result.Reasoning = reasoningBuilder.String()
+	handler.OnComplete(result)
+	return result, nil
+}
+
+// eventStreamMessage is a message in the AWS event stream encoding.
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readEventStreamMessage reads one message: a prelude with the total and
+// header lengths and its CRC, the headers, the payload, and a message CRC.
+// Only string header values are kept.
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("event stream: truncated prelude")
+		}
+		return nil, err
+	}
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("event stream: prelude checksum mismatch")
+	}
+	if totalLen < 16+headersLen || totalLen > 16<<20 {
+		return nil, fmt.Errorf("event stream: invalid message length %d", totalLen)
+	}
+
+	rest := make([]byte, totalLen-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("event stream: truncated message: %w", err)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(prelude)
+	crc.Write(rest[:len(rest)-4])
+	if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+		return nil, fmt.Errorf("event stream: message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(rest[:headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamMessage{headers: headers, payload: rest[headersLen : len(rest)-4]}, nil
+}
+
+// eventStreamValueSizes are the sizes of fixed-size header value types,
+// indexed by type: bool true, bool false, byte, short, int, long, (bytes),
+// (string), timestamp, uuid.
+var eventStreamValueSizes = [...]int{0, 0, 1, 2, 4, 8, -1, -1, 8, 16}
+
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 2+nameLen {
+			return nil, fmt.Errorf("event stream: truncated header")
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := int(b[1+nameLen])
+		b = b[2+nameLen:]
+
+		if valueType >= len(eventStreamValueSizes) {
+			return nil, fmt.Errorf("event stream: unknown header type %d", valueType)
+		}
+		size := eventStreamValueSizes[valueType]
+		if size < 0 {
+			// Byte arrays and strings have a 2-byte length prefix
+			if len(b) < 2 {
+				return nil, fmt.Errorf("event stream: truncated header")
+			}
+			size = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		}
+		if len(b) < size {
+			return nil, fmt.Errorf("event stream: truncated header")
+		}
+		if valueType == 7 {
+			headers[name] = string(b[:size])
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
+
+func (p *BedrockProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	// The runtime endpoint has no models operation, return known models
+	return []ModelInfo{
+		{ID: "anthropic.claude-sonnet-4-20250514-v1:0", Name: "Claude Sonnet 4", Provider: "bedrock", MaxTokens: 200000},
+		{ID: "anthropic.claude-3-5-sonnet-20241022-v2:0", Name: "Claude 3.5 Sonnet", Provider: "bedrock", MaxTokens: 200000},
+		{ID: "anthropic.claude-3-5-haiku-20241022-v1:0", Name: "Claude 3.5 Haiku", Provider: "bedrock", MaxTokens: 200000},
+		{ID: "amazon.titan-text-premier-v1:0", Name: "Titan Text Premier", Provider: "bedrock", MaxTokens: 32000},
+		{ID: "amazon.titan-text-express-v1", Name: "Titan Text Express", Provider: "bedrock", MaxTokens: 8000},
+	}, nil
+}
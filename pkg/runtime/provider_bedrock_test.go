@@ -0,0 +1,242 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// Vectors from the AWS Signature Version 4 test suite
+	creds := &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := map[string]string{
+		"GET":  "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"POST": "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+	}
+	for method, signature := range tests {
+		req, _ := http.NewRequest(method, "https://example.amazonaws.com/", nil)
+		signV4(req, nil, creds, "us-east-1", "service", now)
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: got %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestBedrockProvider_Complete(t *testing.T) {
+	var gotURI, gotAuth, gotToken string
+	var gotReq bedrockRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.RequestURI
+		gotAuth = r.Header.Get("Authorization")
+		gotToken = r.Header.Get("X-Amz-Security-Token")
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		_, _ = w.Write([]byte(`{
+			"output": {"message": {"role": "assistant", "content": [
+				{"text": "Searching."},
+				{"toolUse": {"toolUseId": "tooluse_1", "name": "search", "input": {"query": "go"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 20, "outputTokens": 9, "totalTokens": 29}
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewBedrockProvider(
+		WithBedrockRegion("us-east-1"),
+		WithBedrockEndpoint(server.URL),
+		WithBedrockCredentials(AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}),
+	)
+	resp, err := p.Complete(context.Background(), &CompletionRequest{
+		Model:        "anthropic.claude-3-5-sonnet-20240620-v1:0",
+		SystemPrompt: "You are helpful.",
+		Messages: []Message{
+			{Role: RoleUser, Content: "find go"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "tooluse_0", Name: "search", Arguments: map[string]interface{}{"query": "golang"}}}},
+			{Role: RoleTool, ToolCallID: "tooluse_0", Content: "no results"},
+		},
+		Tools: []ToolDefinition{{Name: "search", Description: "Search the web"}},
+	})
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	if gotURI != "/model/anthropic.claude-3-5-sonnet-20240620-v1%3A0/converse" {
+		t.Errorf("unexpected request URI %s", gotURI)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/us-east-1/bedrock/aws4_request") || gotToken != "session" {
+		t.Errorf("expected SigV4 signature with session token, got %q, %q", gotAuth, gotToken)
+	}
+	if len(gotReq.System) != 1 || gotReq.System[0].Text != "You are helpful." {
+		t.Errorf("expected system prompt, got %+v", gotReq.System)
+	}
+	if len(gotReq.Messages) != 3 || gotReq.Messages[1].Content[0].ToolUse == nil {
+		t.Fatalf("unexpected messages %+v", gotReq.Messages)
+	}
+	if tr := gotReq.Messages[2].Content[0].ToolResult; gotReq.Messages[2].Role != "user" || tr == nil || tr.ToolUseID != "tooluse_0" {
+		t.Errorf("expected tool result from the user, got %+v", gotReq.Messages[2])
+	}
+	if gotReq.ToolConfig == nil || gotReq.ToolConfig.Tools[0].ToolSpec.Name != "search" {
+		t.Errorf("expected tool config, got %+v", gotReq.ToolConfig)
+	}
+
+	if resp.Content != "Searching." || resp.FinishReason != FinishReasonToolUse {
+		t.Errorf("got content %q, finish reason %q", resp.Content, resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "tooluse_1" || resp.ToolCalls[0].Arguments["query"] != "go" {
+		t.Errorf("unexpected tool calls %+v", resp.ToolCalls)
+	}
+	if resp.Usage.InputTokens != 20 || resp.Usage.TotalTokens != 29 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+}
+
+// encodeEventStreamMessage encodes an event in the AWS event stream format.
+func encodeEventStreamMessage(eventType, payload string) []byte {
+	var headers bytes.Buffer
+	for _, h := range [][2]string{{":message-type", "event"}, {":event-type", eventType}} {
+		headers.WriteByte(byte(len(h[0])))
+		headers.WriteString(h[0])
+		headers.WriteByte(7)
+		_ = binary.Write(&headers, binary.BigEndian, uint16(len(h[1])))
+		headers.WriteString(h[1])
+	}
+
+	var msg bytes.Buffer
+	_ = binary.Write(&msg, binary.BigEndian, uint32(16+headers.Len()+len(payload)))
+	_ = binary.Write(&msg, binary.BigEndian, uint32(headers.Len()))
+	_ = binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(headers.Bytes())
+	msg.WriteString(payload)
+	_ = binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func TestBedrockProvider_HandleStream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, e := range [][2]string{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hel"}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"lo"}}`},
+		{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"search"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"query\":"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"go\"}"}}}`},
+		{"messageStop", `{"stopReason":"tool_use"}`},
+		{"metadata", `{"usage":{"inputTokens":5,"outputTokens":7,"totalTokens":12}}`},
+	} {
+		stream.Write(encodeEventStreamMessage(e[0], e[1]))
+	}
+
+	handler := &BufferedStreamHandler{}
+	resp, err := NewBedrockProvider().handleStream("amazon.titan-text-express-v1", &stream, handler)
+	if err != nil {
+		t.Fatalf("handleStream error: %v", err)
+	}
+	if resp.Content != "Hello" || handler.Content() != "Hello" {
+		t.Errorf("got content %q, streamed %q", resp.Content, handler.Content())
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["query"] != "go" {
+		t.Errorf("unexpected tool calls %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != FinishReasonToolUse || resp.Usage.TotalTokens != 12 {
+		t.Errorf("unexpected finish reason %q or usage %+v", resp.FinishReason, resp.Usage)
+	}
+
+	corrupt := encodeEventStreamMessage("messageStop", `{}`)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := NewBedrockProvider().handleStream("m", bytes.NewReader(corrupt), &BufferedStreamHandler{}); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestAWSCredentialChain(t *testing.T) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials")
+	config := filepath.Join(dir, "config")
+	if err := os.WriteFile(credentials, []byte("[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = s1\n\n[work]\naws_access_key_id = AKIDWORK\naws_secret_access_key = s2\naws_session_token = tok\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte("[default]\nregion = eu-west-1\n\n[profile work]\nregion = eu-north-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		t.Setenv(key, "")
+	}
+	ctx := context.Background()
+
+	creds, err := newAWSCredentialChain("").Retrieve(ctx)
+	if err != nil || creds.AccessKeyID != "AKIDDEFAULT" {
+		t.Errorf("expected default profile, got %+v, %v", creds, err)
+	}
+	creds, err = newAWSCredentialChain("work").Retrieve(ctx)
+	if err != nil || creds.AccessKeyID != "AKIDWORK" || creds.SessionToken != "tok" {
+		t.Errorf("expected work profile, got %+v, %v", creds, err)
+	}
+	if region := awsRegion("work"); region != "eu-north-1" {
+		t.Errorf("expected profile region, got %q", region)
+	}
+
+	// The environment takes precedence over the shared files
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "s3")
+	t.Setenv("AWS_REGION", "us-west-2")
+	if creds, err := newAWSCredentialChain("").Retrieve(ctx); err != nil || creds.AccessKeyID != "AKIDENV" {
+		t.Errorf("expected environment credentials, got %+v, %v", creds, err)
+	}
+	if region := awsRegion(""); region != "us-west-2" {
+		t.Errorf("expected environment region, got %q", region)
+	}
+}
+
+func TestAWSCredentialChain_Container(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "container-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"AccessKeyId":"AKIDTASK","SecretAccessKey":"s","Token":"tok","Expiration":"2099-01-01T00:00:00Z"}`))
+	}))
+	defer server.Close()
+
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_PROFILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/creds")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+	creds, err := newAWSCredentialChain("").Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKIDTASK" || creds.SessionToken != "tok" || creds.Expires.IsZero() {
+		t.Errorf("expected container credentials, got %+v, %v", creds, err)
+	}
+}
+
+func TestBedrockProvider_ModelPrefix(t *testing.T) {
+	rt := New(nil)
+	rt.RegisterProvider("anthropic", NewMockProvider())
+	rt.RegisterProvider("bedrock", NewBedrockProvider(WithBedrockRegion("us-east-1")))
+
+	for _, model := range []string{"anthropic.claude-3-5-sonnet-20240620-v1:0", "us.anthropic.claude-3-5-sonnet-20240620-v1:0", "amazon.titan-text-express-v1"} {
+		p, err := rt.getProviderForModel(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := p.(*BedrockProvider); !ok {
+			t.Errorf("%s: expected bedrock provider, got %T", model, p)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// defaultFallbackOn are the error classes that move a request on to the
+// next model when a fallback does not list its own.
+var defaultFallbackOn = []string{ErrorClassRateLimit, ErrorClassServerError, ErrorClassTimeout, ErrorClassNetwork}
+
+// getAgentModels returns the models an agent's requests go to, in the order
+// they are tried, and the error classes that move a request on to the next.
+// The models come from `model`, which may list several, followed by those of
+// a `fallback` block.
+func (r *Runtime) getAgentModels(agent ast.Entity) ([]string, []string, error) {
+	models := []string{r.defaultModel}
+	if prop, ok := agent.GetProperty("model"); ok {
+		list, err := modelList(prop)
+		if err != nil || len(list) == 0 {
+			return nil, nil, fmt.Errorf("agent %q: 'model' must be a model name or a list of them", agent.Name())
+		}
+		models = list
+	}
+
+	on := defaultFallbackOn
+	if prop, ok := agent.GetProperty("fallback"); ok {
+		var list []string
+		var err error
+		if fallback, ok := prop.(ast.FallbackValue); ok {
+			list = fallback.Models
+			if len(fallback.On) > 0 {
+				on = fallback.On
+			}
+		} else {
+			list, err = modelList(prop)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("agent %q: 'fallback' must be a fallback block or a list of models", agent.Name())
+		}
+		models = append(models, list...)
+	}
+	return models, on, nil
+}
+
+// modelList returns the models named by a string or an array of strings.
+func modelList(v ast.Value) ([]string, error) {
+	switch v := v.(type) {
+	case ast.StringValue:
+		return []string{v.Value}, nil
+	case ast.ArrayValue:
+		models := make([]string, 0, len(v.Elements))
+		for _, elem := range v.Elements {
+			sv, ok := elem.(ast.StringValue)
+			if !ok {
+				return nil, fmt.Errorf("expected a model name, got %T", elem)
+			}
+			models = append(models, sv.Value)
+		}
+		return models, nil
+	}
+	return nil, fmt.Errorf("expected a model name, got %T", v)
+}
+
+// getAgentProvider returns the provider for an agent's requests and the
+// model they name. An agent with several models gets a provider that sends
+// a request that fails to the next one.
+func (r *Runtime) getAgentProvider(agent ast.Entity) (LLMProvider, string, error) {
+	models, on, err := r.getAgentModels(agent)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(models) == 1 {
+		p, err := r.getProviderForAgent(agent, models[0])
+		return p, models[0], err
+	}
+
+	f := &fallbackProvider{on: on}
+	for _, model := range models {
+		p, err := r.getProviderForAgent(agent, model)
+		if err != nil {
+			return nil, "", err
+		}
+		f.chain = append(f.chain, fallbackModel{model: model, provider: p})
+	}
+	return f, models[0], nil
+}
+
+// servedModel returns the model that served the last successful request
+// of provider, or model if provider does not fall back.
+func servedModel(provider LLMProvider, model string) string {
+	if f, ok := provider.(*fallbackProvider); ok {
+		if served := f.Served(); served != "" {
+			return served
+		}
+	}
+	return model
+}
+
+// fallbackModel is a model of a fallback chain and the provider serving it.
+type fallbackModel struct {
+	model    string
+	provider LLMProvider
+}
+
+// fallbackProvider sends each request to the models of its chain in turn,
+// until one succeeds or fails with an error its `on` classes do not cover.
+type fallbackProvider struct {
+	chain []fallbackModel
+	on    []string
+
+	mu     sync.Mutex
+	served string
+}
+
+func (p *fallbackProvider) Name() string {
+	return p.chain[0].provider.Name()
+}
+
+func (p *fallbackProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return p.chain[0].provider.ListModels(ctx)
+}
+
+// Served returns the model that served the last successful request.
+func (p *fallbackProvider) Served() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.served
+}
+
+func (p *fallbackProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return p.complete(ctx, req, nil)
+}
+
+// CompleteStream streams the response of the first model that succeeds. A
+// model that fails after streaming content is not fallen back from, since
+// the handler has already shown part of its answer.
+func (p *fallbackProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	return p.complete(ctx, req, handler)
+}
+
+func (p *fallbackProvider) complete(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	for i, next := range p.chain {
+		attempt := *req
+		attempt.Model = next.model
+
+		var resp *CompletionResponse
+		var err error
+		var stream *fallbackStreamHandler
+		if handler != nil {
+			stream = &fallbackStreamHandler{StreamHandler: handler}
+			resp, err = next.provider.CompleteStream(ctx, &attempt, stream)
+		} else {
+			resp, err = next.provider.Complete(ctx, &attempt)
+		}
+		if err == nil {
+			p.mu.Lock()
+			p.served = next.model
+			p.mu.Unlock()
+			return resp, nil
+		}
+
+		class := classifyError(err)
+		last := i == len(p.chain)-1 || ctx.Err() != nil || !slices.Contains(p.on, class)
+		if last || (stream != nil && stream.streamed) {
+			if stream != nil && stream.err != nil {
+				handler.OnError(stream.err)
+			}
+			return resp, err
+		}
+		logAt(ctx, slog.LevelWarn, "falling back to the next model",
+			slog.String("model", next.model),
+			slog.String("fallback", p.chain[i+1].model),
+			slog.String("error_class", class),
+			slog.Any("error", err))
+	}
+	return nil, fmt.Errorf("no models to fall back to")
+}
+
+// fallbackStreamHandler forwards a stream to the handler of a request,
+// holding back the error of a model that may yet be fallen back from.
+type fallbackStreamHandler struct {
+	StreamHandler
+	streamed bool
+	err      error
+}
+
+func (h *fallbackStreamHandler) OnChunk(chunk StreamChunk) {
+	h.streamed = true
+	h.StreamHandler.OnChunk(chunk)
+}
+
+func (h *fallbackStreamHandler) OnError(err error) {
+	h.err = err
+}
@@ -0,0 +1,193 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func requestModels(p *MockProvider) []string {
+	var models []string
+	for _, req := range p.GetRequests() {
+		models = append(models, req.Model)
+	}
+	return models
+}
+
+func TestExecute_PipelineModelFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		agent     string
+		responses []MockResponse
+		wantErr   bool
+		wantModel string
+		wantCalls []string
+	}{
+		{
+			name:      "model list falls back on rate limit",
+			agent:     `model: ["primary-model", "backup-model"]`,
+			responses: []MockResponse{{Error: &APIError{StatusCode: 429, Body: "slow down"}}, {Content: "ok"}},
+			wantModel: "backup-model",
+			wantCalls: []string{"primary-model", "backup-model"},
+		},
+		{
+			name: "fallback block falls back on server error",
+			agent: `model: "primary-model"
+	fallback {
+		models: ["backup-model", "last-model"]
+	}`,
+			responses: []MockResponse{{Error: &APIError{StatusCode: 503}}, {Error: &APIError{StatusCode: 500}}, {Content: "ok"}},
+			wantModel: "last-model",
+			wantCalls: []string{"primary-model", "backup-model", "last-model"},
+		},
+		{
+			name:      "primary serves",
+			agent:     `model: ["primary-model", "backup-model"]`,
+			responses: []MockResponse{{Content: "ok"}},
+			wantModel: "primary-model",
+			wantCalls: []string{"primary-model"},
+		},
+		{
+			name: "error class not covered",
+			agent: `model: "primary-model"
+	fallback {
+		models: ["backup-model"]
+		on: ["rate_limit"]
+	}`,
+			responses: []MockResponse{{Error: &APIError{StatusCode: 503}}, {Content: "ok"}},
+			wantErr:   true,
+			wantModel: "primary-model",
+			wantCalls: []string{"primary-model"},
+		},
+		{
+			name:      "every model fails",
+			agent:     `model: ["primary-model", "backup-model"]`,
+			responses: []MockResponse{{Error: &APIError{StatusCode: 429}}},
+			wantErr:   true,
+			wantModel: "primary-model",
+			wantCalls: []string{"primary-model", "backup-model"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := workspace.New()
+			addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	`+tt.agent+`
+}
+
+pipeline "write" {
+	step "draft" {
+		use: agent("writer")
+		input: "Write"
+	}
+}
+`))
+			provider := NewMockProvider(WithMockResponses(tt.responses...))
+			rt := New(ws, WithProvider("mock", provider))
+			pipeline, _ := ws.GetEntityByName("pipeline", "write")
+
+			result, err := rt.Execute(context.Background(), pipeline)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := result.StepResults["draft"].Model; got != tt.wantModel {
+				t.Errorf("expected the step to record model %q, got %q", tt.wantModel, got)
+			}
+			if got := requestModels(provider); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("expected requests to %v, got %v", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestExecute_IntentModelFallback(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: ["primary-model", "backup-model"]
+}
+
+intent "write" {
+	use: agent("writer")
+	input: "Write"
+}
+`))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Error: &APIError{StatusCode: 429}}, MockResponse{Content: "ok"}))
+	rt := New(ws, WithProvider("mock", provider))
+	intent, _ := ws.GetEntityByName("intent", "write")
+
+	handler := &BufferedStreamHandler{}
+	result, err := rt.Execute(context.Background(), intent, WithStreamHandler(handler))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if got := result.Metadata["model"]; got != "backup-model" {
+		t.Errorf("expected model %q, got %q", "backup-model", got)
+	}
+	if handler.Err != nil {
+		t.Errorf("expected the error of the fallen back from model to be held back, got %v", handler.Err)
+	}
+}
+
+func TestExecute_InvalidAgentModel(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: [4]
+}
+
+intent "write" {
+	use: agent("writer")
+	input: "Write"
+}
+`))
+	rt := New(ws, WithProvider("mock", NewMockProvider()))
+	intent, _ := ws.GetEntityByName("intent", "write")
+
+	if _, err := rt.Execute(context.Background(), intent); err == nil {
+		t.Fatal("expected an error for a model that is not a name")
+	}
+}
+
+// partialStreamProvider streams a chunk of its answer and then fails.
+type partialStreamProvider struct {
+	*MockProvider
+}
+
+func (p partialStreamProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	p.recordRequest(req)
+	handler.OnChunk(StreamChunk{Content: "Once upon", Type: ChunkTypeContent})
+	err := &APIError{StatusCode: 502}
+	handler.OnError(err)
+	return nil, err
+}
+
+func TestFallbackProvider_StreamedAnswerNotFallenBack(t *testing.T) {
+	primary := partialStreamProvider{NewMockProvider()}
+	backup := NewMockProvider()
+	p := &fallbackProvider{
+		chain: []fallbackModel{{model: "primary-model", provider: primary}, {model: "backup-model", provider: backup}},
+		on:    defaultFallbackOn,
+	}
+
+	handler := &BufferedStreamHandler{}
+	_, err := p.CompleteStream(context.Background(), &CompletionRequest{Model: "primary-model"}, handler)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 502 {
+		t.Fatalf("expected the primary's error, got %v", err)
+	}
+	if !errors.Is(handler.Err, err) {
+		t.Errorf("expected the handler to get the error, got %v", handler.Err)
+	}
+	if len(backup.GetRequests()) != 0 {
+		t.Error("expected no request to the backup model after streaming part of an answer")
+	}
+	if p.Served() != "" {
+		t.Errorf("expected no model to have served, got %q", p.Served())
+	}
+}
@@ -0,0 +1,450 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// GeminiProvider implements LLMProvider for the Google Gemini API.
+type GeminiProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// GeminiOption is a functional option for configuring GeminiProvider.
+type GeminiOption func(*GeminiProvider)
+
+// WithGeminiAPIKey sets the API key.
+func WithGeminiAPIKey(key string) GeminiOption {
+	return func(p *GeminiProvider) {
+		p.apiKey = key
+	}
+}
+
+// WithGeminiBaseURL sets a custom base URL.
+func WithGeminiBaseURL(url string) GeminiOption {
+	return func(p *GeminiProvider) {
+		p.baseURL = url
+	}
+}
+
+// WithGeminiHTTPClient sets a custom HTTP client.
+func WithGeminiHTTPClient(client *http.Client) GeminiOption {
+	return func(p *GeminiProvider) {
+		p.httpClient = client
+	}
+}
+
+// NewGeminiProvider creates a new Gemini provider. The API key is read from
+// GEMINI_API_KEY, or GOOGLE_API_KEY if that is unset.
+func NewGeminiProvider(opts ...GeminiOption) *GeminiProvider {
+	p := &GeminiProvider{
+		baseURL:    "https://generativelanguage.googleapis.com",
+		httpClient: http.DefaultClient,
+	}
+
+	// Check for API key in environment
+	if key := os.Getenv("GEMINI_API_KEY"); key != "" {
+		p.apiKey = key
+	} else if key := os.Getenv("GOOGLE_API_KEY"); key != "" {
+		p.apiKey = key
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// SupportsSeed reports that requests with a seed sample repeatably.
+func (p *GeminiProvider) SupportsSeed() bool {
+	return true
+}
+
+// geminiRequest is the request format for Gemini's generateContent API.
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []openaiFunction `json:"functionDeclarations"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64              `json:"temperature,omitempty"`
+	Seed            *int                  `json:"seed,omitempty"`
+	MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string              `json:"stopSequences,omitempty"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+// geminiResponse is the response format from Gemini's API. Streamed chunks
+// use the same format.
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+// buildRequest converts a completion request to Gemini's format. The system
+// prompt becomes the system instruction, assistant messages use the "model"
+// role, and tool results are function responses from the user.
+func (p *GeminiProvider) buildRequest(req *CompletionRequest) *geminiRequest {
+	gemReq := &geminiRequest{Contents: make([]geminiContent, 0, len(req.Messages))}
+
+	if req.SystemPrompt != "" {
+		gemReq.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.SystemPrompt}}}
+	}
+
+	// Gemini identifies function responses by function name, not call ID
+	callNames := make(map[string]string)
+	for _, msg := range req.Messages {
+		var content geminiContent
+		switch msg.Role {
+		case RoleAssistant:
+			content.Role = "model"
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				callNames[tc.ID] = tc.Name
+				content.Parts = append(content.Parts, geminiPart{
+					FunctionCall: &geminiFunctionCall{Name: tc.Name, Args: tc.Arguments},
+				})
+			}
+		case RoleTool:
+			content.Role = "user"
+			name := callNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.ToolCallID
+			}
+			content.Parts = []geminiPart{{
+				FunctionResponse: &geminiFunctionResponse{
+					Name:     name,
+					Response: map[string]interface{}{"content": msg.Content},
+				},
+			}}
+		default:
+			content.Role = "user"
+			content.Parts = []geminiPart{{Text: msg.Content}}
+		}
+		if len(content.Parts) > 0 {
+			gemReq.Contents = append(gemReq.Contents, content)
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, openaiFunction(t))
+		}
+		gemReq.Tools = []geminiTool{tool}
+	}
+
+	config := &geminiGenerationConfig{
+		Temperature:     &req.Temperature,
+		Seed:            req.Seed,
+		MaxOutputTokens: req.MaxTokens,
+		StopSequences:   req.StopSequences,
+	}
+	if req.ReasoningBudget > 0 {
+		config.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: req.ReasoningBudget, IncludeThoughts: true}
+	}
+	gemReq.GenerationConfig = config
+
+	return gemReq
+}
+
+// post sends a request body to a model method such as generateContent.
+func (p *GeminiProvider) post(ctx context.Context, model, method string, payload interface{}) (*http.Response, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("gemini API key not set")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1beta/models/%s:%s", p.baseURL, strings.TrimPrefix(model, "models/"), method)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return resp, nil
+}
+
+// closeBody closes a response body, logging any error.
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		logAt(resp.Request.Context(), slog.LevelWarn, "failed to close response body", "error", err)
+	}
+}
+
+func (p *GeminiProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, req.Model, "generateContent", p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	var gemResp geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gemResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	result := &CompletionResponse{Model: req.Model}
+	var contentBuilder, reasoningBuilder strings.Builder
+	p.mergeResponse(result, &gemResp, func(text string, thought bool) {
+		if thought {
+			reasoningBuilder.WriteString(text)
+		} else {
+			contentBuilder.WriteString(text)
+		}
+	})
+	result.Content = contentBuilder.String()
+	result.Reasoning = reasoningBuilder.String()
+	return result, nil
+}
+
+// mergeResponse adds a response, or a streamed chunk of one, to result. Text
+// parts are passed to onText; function calls, usage, and the finish reason
+// are recorded on result.
+func (p *GeminiProvider) mergeResponse(result *CompletionResponse, resp *geminiResponse, onText func(text string, thought bool)) {
+	if resp.ModelVersion != "" {
+		result.Model = resp.ModelVersion
+	}
+
+	// Usage metadata is cumulative, so the last chunk's counts are the totals
+	if usage := resp.UsageMetadata; usage.TotalTokenCount > 0 {
+		result.Usage = TokenUsage{
+			InputTokens:  usage.PromptTokenCount,
+			OutputTokens: usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+			TotalTokens:  usage.TotalTokenCount,
+		}
+	}
+
+	if len(resp.Candidates) == 0 {
+		return
+	}
+	candidate := resp.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			// Gemini calls carry no ID; number them so results can be matched
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d_%s", len(result.ToolCalls), part.FunctionCall.Name),
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+			})
+		case part.Text != "":
+			onText(part.Text, part.Thought)
+		}
+	}
+
+	switch candidate.FinishReason {
+	case "":
+		return
+	case "MAX_TOKENS":
+		result.FinishReason = FinishReasonLength
+	default:
+		result.FinishReason = FinishReasonStop
+	}
+	if len(result.ToolCalls) > 0 {
+		result.FinishReason = FinishReasonToolUse
+	}
+}
+
+func (p *GeminiProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, req.Model, "streamGenerateContent?alt=sse", p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	return p.handleStream(req.Model, resp.Body, handler)
+}
+
+func (p *GeminiProvider) handleStream(model string, body io.Reader, handler StreamHandler) (*CompletionResponse, error) {
+	result := &CompletionResponse{Model: model}
+	var contentBuilder, reasoningBuilder strings.Builder
+	chunkIndex := 0
+
+	reader := NewSSEReader(body)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			handler.OnError(err)
+			return nil, err
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			continue
+		}
+
+		p.mergeResponse(result, &chunk, func(text string, thought bool) {
+			chunkType := ChunkTypeContent
+			if thought {
+				chunkType = ChunkTypeReasoning
+				reasoningBuilder.WriteString(text)
+			} else {
+				contentBuilder.WriteString(text)
+			}
+			handler.OnChunk(StreamChunk{
+				Content: text,
+				Type:    chunkType,
+				Index:   chunkIndex,
+			})
+			chunkIndex++
+		})
+	}
+
+	result.Content = contentBuilder.String()
+	result.Reasoning = reasoningBuilder.String()
+	handler.OnComplete(result)
+	return result, nil
+}
+
+// CountTokens returns the number of input tokens a request would use,
+// including its system instruction and tools.
+func (p *GeminiProvider) CountTokens(ctx context.Context, req *CompletionRequest) (int, error) {
+	gemReq := p.buildRequest(req)
+	payload := map[string]interface{}{
+		"generateContentRequest": struct {
+			Model string `json:"model"`
+			*geminiRequest
+		}{Model: "models/" + strings.TrimPrefix(req.Model, "models/"), geminiRequest: gemReq},
+	}
+
+	resp, err := p.post(ctx, req.Model, "countTokens", payload)
+	if err != nil {
+		return 0, err
+	}
+	defer closeBody(resp)
+
+	var countResp struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&countResp); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return countResp.TotalTokens, nil
+}
+
+func (p *GeminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("gemini API key not set")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1beta/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var listResp struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			DisplayName                string   `json:"displayName"`
+			InputTokenLimit            int      `json:"inputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(listResp.Models))
+	for _, m := range listResp.Models {
+		models = append(models, ModelInfo{
+			ID:           strings.TrimPrefix(m.Name, "models/"),
+			Name:         m.DisplayName,
+			Provider:     "gemini",
+			MaxTokens:    m.InputTokenLimit,
+			Capabilities: m.SupportedGenerationMethods,
+		})
+	}
+	return models, nil
+}
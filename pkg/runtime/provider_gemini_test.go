@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiProvider_Complete(t *testing.T) {
+	var gotPath, gotKey string
+	var gotReq geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		_, _ = w.Write([]byte(`{
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "checking", "thought": true},
+					{"text": "Let me look that up."},
+					{"functionCall": {"name": "search", "args": {"query": "go"}}}
+				]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {"promptTokenCount": 12, "candidatesTokenCount": 8, "thoughtsTokenCount": 2, "totalTokenCount": 22},
+			"modelVersion": "gemini-2.0-flash-001"
+		}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider(WithGeminiAPIKey("test-key"), WithGeminiBaseURL(server.URL))
+	resp, err := p.Complete(context.Background(), &CompletionRequest{
+		Model:        "gemini-2.0-flash",
+		SystemPrompt: "You are helpful.",
+		Temperature:  0.3,
+		Messages: []Message{
+			{Role: RoleUser, Content: "find go"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0_search", Name: "search", Arguments: map[string]interface{}{"query": "golang"}}}},
+			{Role: RoleTool, ToolCallID: "call_0_search", Content: "no results"},
+		},
+		Tools: []ToolDefinition{{Name: "search", Description: "Search the web", Parameters: map[string]interface{}{"type": "object"}}},
+	})
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	if gotPath != "/v1beta/models/gemini-2.0-flash:generateContent" || gotKey != "test-key" {
+		t.Errorf("unexpected request to %s with key %q", gotPath, gotKey)
+	}
+	if gotReq.SystemInstruction == nil || gotReq.SystemInstruction.Parts[0].Text != "You are helpful." {
+		t.Errorf("expected system instruction, got %+v", gotReq.SystemInstruction)
+	}
+	if len(gotReq.Contents) != 3 || gotReq.Contents[1].Role != "model" || gotReq.Contents[1].Parts[0].FunctionCall == nil {
+		t.Fatalf("unexpected contents %+v", gotReq.Contents)
+	}
+	if fr := gotReq.Contents[2].Parts[0].FunctionResponse; fr == nil || fr.Name != "search" || fr.Response["content"] != "no results" {
+		t.Errorf("expected function response named by its call, got %+v", gotReq.Contents[2])
+	}
+	if len(gotReq.Tools) != 1 || gotReq.Tools[0].FunctionDeclarations[0].Name != "search" {
+		t.Errorf("expected function declarations, got %+v", gotReq.Tools)
+	}
+	if gotReq.GenerationConfig == nil || gotReq.GenerationConfig.Temperature == nil || *gotReq.GenerationConfig.Temperature != 0.3 {
+		t.Errorf("expected generation config, got %+v", gotReq.GenerationConfig)
+	}
+
+	if resp.Content != "Let me look that up." || resp.Reasoning != "checking" {
+		t.Errorf("got content %q reasoning %q", resp.Content, resp.Reasoning)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "search" || resp.ToolCalls[0].Arguments["query"] != "go" {
+		t.Errorf("unexpected tool calls %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != FinishReasonToolUse || resp.Model != "gemini-2.0-flash-001" {
+		t.Errorf("unexpected finish reason %q or model %q", resp.FinishReason, resp.Model)
+	}
+	if resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 10 || resp.Usage.TotalTokens != 22 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+}
+
+func TestGeminiProvider_HandleStream(t *testing.T) {
+	stream := `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":4,"totalTokenCount":5,"candidatesTokenCount":1}}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}
+
+`
+	handler := &BufferedStreamHandler{}
+	resp, err := NewGeminiProvider().handleStream("gemini-2.0-flash", strings.NewReader(stream), handler)
+	if err != nil {
+		t.Fatalf("handleStream error: %v", err)
+	}
+	if resp.Content != "Hello" || handler.Content() != "Hello" {
+		t.Errorf("got content %q, streamed %q", resp.Content, handler.Content())
+	}
+	if resp.FinishReason != FinishReasonLength || resp.Usage.OutputTokens != 2 || resp.Usage.TotalTokens != 6 {
+		t.Errorf("unexpected finish reason %q or usage %+v", resp.FinishReason, resp.Usage)
+	}
+}
+
+func TestGeminiProvider_CountTokens(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:countTokens" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"totalTokens": 31}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider(WithGeminiAPIKey("test-key"), WithGeminiBaseURL(server.URL))
+	n, err := p.CountTokens(context.Background(), &CompletionRequest{
+		Model:        "gemini-2.0-flash",
+		SystemPrompt: "Be brief.",
+		Messages:     []Message{{Role: RoleUser, Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("CountTokens error: %v", err)
+	}
+	if n != 31 {
+		t.Errorf("expected 31 tokens, got %d", n)
+	}
+	inner, _ := body["generateContentRequest"].(map[string]interface{})
+	if inner["model"] != "models/gemini-2.0-flash" || inner["systemInstruction"] == nil {
+		t.Errorf("unexpected countTokens request %v", body)
+	}
+}
+
+func TestGeminiProvider_ModelPrefix(t *testing.T) {
+	rt := New(nil)
+	rt.RegisterProvider("anthropic", NewMockProvider())
+	rt.RegisterProvider("gemini", NewGeminiProvider())
+
+	p, err := rt.getProviderForModel("gemini-2.0-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*GeminiProvider); !ok {
+		t.Errorf("expected gemini provider, got %T", p)
+	}
+}
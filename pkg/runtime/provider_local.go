@@ -0,0 +1,233 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// DefaultLocalBaseURL is the default endpoint used by the local provider (Ollama).
+const DefaultLocalBaseURL = "http://localhost:11434"
+
+// LocalProvider implements LLMProvider for self-hosted endpoints that speak the
+// OpenAI chat completions API, such as Ollama, vLLM, or LM Studio.
+type LocalProvider struct {
+	*OpenAIProvider
+	name   string
+	models []string
+}
+
+// LocalOption is a functional option for configuring LocalProvider.
+type LocalOption func(*LocalProvider)
+
+// WithLocalName sets the name the provider reports and is registered under.
+func WithLocalName(name string) LocalOption {
+	return func(p *LocalProvider) {
+		p.name = name
+	}
+}
+
+// WithLocalModels sets the models served by the endpoint.
+// When set, these models are routed to this provider and returned by ListModels.
+func WithLocalModels(models ...string) LocalOption {
+	return func(p *LocalProvider) {
+		p.models = models
+	}
+}
+
+// WithLocalAPIKey sets an optional API key for endpoints that require one.
+func WithLocalAPIKey(key string) LocalOption {
+	return func(p *LocalProvider) {
+		p.apiKey = key
+	}
+}
+
+// WithLocalEmbeddingModel sets the model used by Embed.
+func WithLocalEmbeddingModel(model string) LocalOption {
+	return func(p *LocalProvider) {
+		p.embeddingModel = model
+	}
+}
+
+// WithLocalStreaming sets whether CompleteStream streams (default:
+// StreamAuto).
+func WithLocalStreaming(mode StreamMode) LocalOption {
+	return func(p *LocalProvider) {
+		p.streaming = mode
+	}
+}
+
+// WithLocalHTTPClient sets a custom HTTP client.
+func WithLocalHTTPClient(client *http.Client) LocalOption {
+	return func(p *LocalProvider) {
+		p.httpClient = client
+	}
+}
+
+// NewLocalProvider creates a provider for an OpenAI-compatible endpoint.
+// The base URL may include or omit the trailing "/v1" path segment.
+func NewLocalProvider(baseURL string, opts ...LocalOption) *LocalProvider {
+	if baseURL == "" {
+		baseURL = DefaultLocalBaseURL
+	}
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+
+	p := &LocalProvider{
+		OpenAIProvider: &OpenAIProvider{
+			baseURL:        baseURL,
+			httpClient:     http.DefaultClient,
+			embeddingModel: "nomic-embed-text",
+			keyOptional:    true,
+		},
+		name: "local",
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *LocalProvider) Name() string {
+	return p.name
+}
+
+// SupportsModel reports whether the model is served by this provider.
+func (p *LocalProvider) SupportsModel(model string) bool {
+	for _, m := range p.models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *LocalProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if len(p.models) > 0 {
+		models := make([]ModelInfo, 0, len(p.models))
+		for _, m := range p.models {
+			models = append(models, ModelInfo{ID: m, Name: m, Provider: p.name})
+		}
+		return models, nil
+	}
+
+	models, err := p.OpenAIProvider.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range models {
+		models[i].Provider = p.name
+	}
+	return models, nil
+}
+
+// modelMatcher is implemented by providers that serve an explicit set of models.
+type modelMatcher interface {
+	SupportsModel(model string) bool
+}
+
+// NewLocalProviderFromConfig creates a local provider from a config entity, e.g.
+//
+//	config {
+//	  provider: "local"
+//	  base_url: "http://localhost:11434"
+//	  models: ["llama3.1", "qwen2.5-coder"]
+//	  stream: "auto"  // or "always", "never"
+//	}
+func NewLocalProviderFromConfig(config ast.Entity) (*LocalProvider, error) {
+	var opts []LocalOption
+
+	baseURL := DefaultLocalBaseURL
+	if v, ok := config.GetProperty("base_url"); ok {
+		sv, ok := v.(ast.StringValue)
+		if !ok {
+			return nil, fmt.Errorf("config 'base_url' must be a string")
+		}
+		baseURL = sv.Value
+	}
+
+	if v, ok := config.GetProperty("api_key"); ok {
+		if sv, ok := v.(ast.StringValue); ok {
+			opts = append(opts, WithLocalAPIKey(sv.Value))
+		}
+	}
+
+	if v, ok := config.GetProperty("models"); ok {
+		arr, ok := v.(ast.ArrayValue)
+		if !ok {
+			return nil, fmt.Errorf("config 'models' must be an array")
+		}
+		var models []string
+		for _, elem := range arr.Elements {
+			if sv, ok := elem.(ast.StringValue); ok {
+				models = append(models, sv.Value)
+			}
+		}
+		opts = append(opts, WithLocalModels(models...))
+	}
+
+	if v, ok := config.GetProperty("stream"); ok {
+		var raw interface{}
+		switch v := v.(type) {
+		case ast.BoolValue:
+			raw = v.Value
+		case ast.StringValue:
+			raw = v.Value
+		}
+		mode, err := ParseStreamMode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("config 'stream': %w", err)
+		}
+		opts = append(opts, WithLocalStreaming(mode))
+	}
+
+	return NewLocalProvider(baseURL, opts...), nil
+}
+
+// ConfigureProviders registers providers declared in the workspace: one for
+// each provider entity (see ProviderSettings), registered under the entity's
+// name, and a LocalProvider for a config with `provider: "local"`, which
+// becomes the default provider. Rate limits in the config's `providers`
+// object apply to the instances of those names.
+func (r *Runtime) ConfigureProviders() error {
+	if err := r.configureProviderEntities(); err != nil {
+		return err
+	}
+
+	configs := r.workspace.GetEntitiesByType("config")
+	if len(configs) == 0 {
+		return nil
+	}
+	config := configs[0]
+
+	if err := r.configureProviderRateLimits(config); err != nil {
+		return err
+	}
+
+	providerProp, ok := config.GetProperty("provider")
+	if !ok {
+		return nil
+	}
+	providerName, ok := providerProp.(ast.StringValue)
+	if !ok {
+		return fmt.Errorf("config 'provider' must be a string")
+	}
+
+	switch providerName.Value {
+	case "local", "ollama", "vllm", "lmstudio":
+		provider, err := NewLocalProviderFromConfig(config)
+		if err != nil {
+			return err
+		}
+		r.RegisterProvider(provider.Name(), provider)
+		r.mu.Lock()
+		r.config.DefaultProvider = provider.Name()
+		r.mu.Unlock()
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestLocalProvider_Complete(t *testing.T) {
+	var gotAuth, gotPath, gotModel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotPath = r.URL.Path
+		var req openaiRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+		_, _ = w.Write([]byte(`{"model":"llama3.1","choices":[{"message":{"role":"assistant","content":"hi from llama"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`))
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(server.URL+"/v1/", WithLocalModels("llama3.1"))
+	if p.Name() != "local" {
+		t.Errorf("expected name 'local', got %q", p.Name())
+	}
+
+	resp, err := p.Complete(context.Background(), &CompletionRequest{
+		Model:    "llama3.1",
+		Messages: []Message{{Role: RoleUser, Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if resp.Content != "hi from llama" {
+		t.Errorf("unexpected content: %q", resp.Content)
+	}
+	if resp.Usage.TotalTokens != 7 {
+		t.Errorf("expected 7 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Errorf("unexpected request path: %s", gotPath)
+	}
+	if gotAuth != "" {
+		t.Errorf("expected no Authorization header, got %q", gotAuth)
+	}
+	if gotModel != "llama3.1" {
+		t.Errorf("unexpected model: %s", gotModel)
+	}
+
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "llama3.1" || models[0].Provider != "local" {
+		t.Errorf("unexpected models: %+v", models)
+	}
+}
+
+func TestRuntime_ConfigureProviders_Local(t *testing.T) {
+	source := `
+config {
+	provider: "local"
+	base_url: "http://localhost:8000/v1"
+	models: ["qwen2.5-coder"]
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	rt := New(ws, WithProvider("anthropic", NewMockProvider(WithMockName("anthropic"))))
+	if err := rt.ConfigureProviders(); err != nil {
+		t.Fatalf("ConfigureProviders failed: %v", err)
+	}
+
+	p, ok := rt.GetProvider("local")
+	if !ok {
+		t.Fatal("expected local provider to be registered")
+	}
+	local := p.(*LocalProvider)
+	if local.baseURL != "http://localhost:8000" {
+		t.Errorf("unexpected base URL: %s", local.baseURL)
+	}
+	if rt.config.DefaultProvider != "local" {
+		t.Errorf("expected default provider 'local', got %q", rt.config.DefaultProvider)
+	}
+
+	got, err := rt.getProviderForModel("qwen2.5-coder")
+	if err != nil {
+		t.Fatalf("getProviderForModel failed: %v", err)
+	}
+	if got != p {
+		t.Errorf("expected local provider for listed model, got %s", got.Name())
+	}
+}
+
+// gatewayServer is an OpenAI-compatible endpoint that answers every request
+// unstreamed. It rejects streaming requests with status, or ignores their
+// `stream` if status is 0, and counts them.
+func gatewayServer(t *testing.T, status int, streamed *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openaiRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			*streamed++
+			if status != 0 {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{"error":{"message":"stream is not supported"}}`))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"model":"llama3.1","choices":[{"message":{"role":"assistant","content":"hi from the gateway"},"finish_reason":"stop"}]}`))
+	}))
+}
+
+func TestLocalProvider_StreamingFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		mode         StreamMode
+		wantErr      bool
+		wantStreamed int
+	}{
+		{name: "rejected", status: http.StatusBadRequest, wantStreamed: 1},
+		{name: "not found", status: http.StatusNotFound, mode: StreamAuto, wantStreamed: 1},
+		{name: "ignored", wantStreamed: 1},
+		{name: "never", status: http.StatusBadRequest, mode: StreamNever, wantStreamed: 0},
+		{name: "always", status: http.StatusBadRequest, mode: StreamAlways, wantErr: true, wantStreamed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamed := 0
+			server := gatewayServer(t, tt.status, &streamed)
+			defer server.Close()
+
+			var opts []LocalOption
+			if tt.mode != "" {
+				opts = append(opts, WithLocalStreaming(tt.mode))
+			}
+			p := NewLocalProvider(server.URL, opts...)
+			for range 2 {
+				handler := &BufferedStreamHandler{}
+				resp, err := p.CompleteStream(context.Background(), &CompletionRequest{
+					Model:    "llama3.1",
+					Messages: []Message{{Role: RoleUser, Content: "hello"}},
+				}, handler)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("expected the rejected stream to fail")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("CompleteStream failed: %v", err)
+				}
+				if resp.Content != "hi from the gateway" {
+					t.Errorf("unexpected content %q", resp.Content)
+				}
+				if len(handler.Chunks) != 1 || handler.Chunks[0].Content != resp.Content || handler.Response != resp {
+					t.Errorf("expected the response as a single chunk, got %+v", handler.Chunks)
+				}
+			}
+			if streamed != tt.wantStreamed {
+				t.Errorf("expected %d streaming requests, got %d", tt.wantStreamed, streamed)
+			}
+		})
+	}
+}
+
+func TestParseStreamMode(t *testing.T) {
+	for _, v := range []interface{}{"auto", "always", "never", true, false} {
+		if _, err := ParseStreamMode(v); err != nil {
+			t.Errorf("ParseStreamMode(%v): %v", v, err)
+		}
+	}
+	if _, err := ParseStreamMode("sometimes"); err == nil {
+		t.Error("expected an error for an unknown stream mode")
+	}
+	if _, err := newLocalFromSettings(ProviderSettings{Name: "gateway", Options: map[string]interface{}{"stream": "sometimes"}}); err == nil {
+		t.Error("expected a provider entity with an unknown stream mode to fail")
+	}
+}
@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderCall records a single completion request made to a provider
+// instance.
+type ProviderCall struct {
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model"`
+	StartTime    time.Time     `json:"start_time"`
+	Duration     time.Duration `json:"duration"`
+	Wait         time.Duration `json:"wait"`
+	Success      bool          `json:"success"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+}
+
+// ProviderStats aggregates the requests made to a single provider instance.
+type ProviderStats struct {
+	Provider      string        `json:"provider"`
+	Requests      int           `json:"requests"`
+	Successes     int           `json:"successes"`
+	Failures      int           `json:"failures"`
+	InputTokens   int64         `json:"input_tokens"`
+	OutputTokens  int64         `json:"output_tokens"`
+	TotalDuration time.Duration `json:"total_duration"`
+	AvgDuration   time.Duration `json:"avg_duration"`
+	TotalWait     time.Duration `json:"total_wait"`
+	LastCalled    time.Time     `json:"last_called"`
+}
+
+// ProviderMetrics aggregates requests per provider instance, keyed by the
+// name the provider is registered under, so two instances of the same
+// provider type (e.g. OpenAI and an internal vLLM endpoint) are reported
+// separately.
+type ProviderMetrics struct {
+	mu    sync.RWMutex
+	stats map[string]*ProviderStats
+}
+
+// NewProviderMetrics creates an empty provider metrics recorder.
+func NewProviderMetrics() *ProviderMetrics {
+	return &ProviderMetrics{stats: make(map[string]*ProviderStats)}
+}
+
+// WithProviderMetrics records every provider request made by the runtime.
+func WithProviderMetrics(m *ProviderMetrics) Option {
+	return func(r *Runtime) {
+		r.providerMetrics = m
+	}
+}
+
+// Record adds a provider request to the aggregates.
+func (m *ProviderMetrics) Record(call ProviderCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[call.Provider]
+	if !ok {
+		s = &ProviderStats{Provider: call.Provider}
+		m.stats[call.Provider] = s
+	}
+	s.Requests++
+	if call.Success {
+		s.Successes++
+	} else {
+		s.Failures++
+	}
+	s.InputTokens += int64(call.InputTokens)
+	s.OutputTokens += int64(call.OutputTokens)
+	s.TotalDuration += call.Duration
+	s.TotalWait += call.Wait
+	if call.StartTime.After(s.LastCalled) {
+		s.LastCalled = call.StartTime
+	}
+}
+
+// Stats returns statistics for a single provider instance.
+func (m *ProviderMetrics) Stats(provider string) (ProviderStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.stats[provider]
+	if !ok {
+		return ProviderStats{}, false
+	}
+	return s.snapshot(), true
+}
+
+// Report returns statistics for every provider instance, sorted by name.
+func (m *ProviderMetrics) Report() []ProviderStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := make([]ProviderStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		report = append(report, s.snapshot())
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Provider < report[j].Provider
+	})
+	return report
+}
+
+// Reset clears all statistics.
+func (m *ProviderMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = make(map[string]*ProviderStats)
+}
+
+func (s *ProviderStats) snapshot() ProviderStats {
+	out := *s
+	if out.Requests > 0 {
+		out.AvgDuration = out.TotalDuration / time.Duration(out.Requests)
+	}
+	return out
+}
+
+// ProviderMetrics returns the recorder of provider requests, or nil if
+// provider metrics are not enabled (see WithProviderMetrics).
+func (r *Runtime) ProviderMetrics() *ProviderMetrics {
+	return r.providerMetrics
+}
+
+// providerInstance applies the rate limit and metrics of a named provider
+// instance to its requests.
+type providerInstance struct {
+	LLMProvider
+	name    string
+	limiter *rateLimiter
+	metrics *ProviderMetrics
+	counts  *Metrics
+}
+
+// instrumentProvider wraps p, registered under name, with its rate limit
+// and metrics, if any are configured.
+func (r *Runtime) instrumentProvider(name string, p LLMProvider) LLMProvider {
+	limiter := r.rateLimiter(name)
+	if limiter == nil && r.providerMetrics == nil && r.metrics == nil {
+		return p
+	}
+	return &providerInstance{LLMProvider: p, name: name, limiter: limiter, metrics: r.providerMetrics, counts: r.metrics}
+}
+
+func (p *providerInstance) do(ctx context.Context, req *CompletionRequest, call func(context.Context) (*CompletionResponse, error)) (*CompletionResponse, error) {
+	var wait time.Duration
+	estimated := estimateRequestTokens(req)
+	if p.limiter != nil {
+		var err error
+		if wait, err = p.limiter.Wait(ctx, estimated); err != nil {
+			return nil, fmt.Errorf("provider %q: waiting for rate limit: %w", p.name, err)
+		}
+		addQueueWait(ctx, wait)
+	}
+
+	start := time.Now()
+	resp, err := call(ctx)
+	if p.limiter != nil && resp != nil {
+		used := resp.Usage.TotalTokens
+		if used == 0 {
+			used = resp.Usage.InputTokens + resp.Usage.OutputTokens
+		}
+		p.limiter.Settle(estimated, used)
+	}
+	if p.metrics != nil || p.counts != nil {
+		rec := ProviderCall{
+			Provider:  p.name,
+			Model:     req.Model,
+			StartTime: start,
+			Duration:  time.Since(start),
+			Wait:      wait,
+			Success:   err == nil,
+		}
+		if resp != nil {
+			rec.InputTokens = resp.Usage.InputTokens
+			rec.OutputTokens = resp.Usage.OutputTokens
+		}
+		if p.metrics != nil {
+			p.metrics.Record(rec)
+		}
+		p.counts.countProviderRequest(rec)
+	}
+	return resp, err
+}
+
+// Complete sends a completion request once the rate limit allows.
+func (p *providerInstance) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return p.do(ctx, req, func(ctx context.Context) (*CompletionResponse, error) {
+		return p.LLMProvider.Complete(ctx, req)
+	})
+}
+
+// CompleteStream streams a completion once the rate limit allows.
+func (p *providerInstance) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	return p.do(ctx, req, func(ctx context.Context) (*CompletionResponse, error) {
+		return p.LLMProvider.CompleteStream(ctx, req, handler)
+	})
+}
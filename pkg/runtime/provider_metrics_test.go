@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func openAICompatibleServer(t *testing.T, output string, calls *int32, key *atomic.Value) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if key != nil {
+			key.Store(r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"` + output + `"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProviderInstances(t *testing.T) {
+	var openaiCalls, vllmCalls int32
+	var vllmKey atomic.Value
+	openai := openAICompatibleServer(t, "from openai", &openaiCalls, nil)
+	vllm := openAICompatibleServer(t, "from vllm", &vllmCalls, &vllmKey)
+	t.Setenv("TEST_OPENAI_KEY", "sk-openai")
+	t.Setenv("TEST_VLLM_KEY", "sk-vllm")
+
+	source := `
+provider "openai" {
+	type: "openai"
+	api_key: secret("TEST_OPENAI_KEY")
+	base_url: "` + openai.URL + `"
+}
+
+provider "vllm-internal" {
+	type: "openai"
+	api_key: secret("TEST_VLLM_KEY")
+	base_url: "` + vllm.URL + `"
+}
+
+agent "public" {
+	model: "gpt-4o"
+}
+
+agent "internal" {
+	model: "gpt-4o"
+	provider: "vllm-internal"
+}
+
+intent "a" {
+	use: agent("public")
+	input: "hello"
+}
+
+intent "b" {
+	use: agent("internal")
+	input: "hello"
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	metrics := NewProviderMetrics()
+	rt := New(ws, WithProviderMetrics(metrics))
+	if err := rt.ConfigureProviders(); err != nil {
+		t.Fatalf("ConfigureProviders error: %v", err)
+	}
+
+	for name, want := range map[string]string{"a": "from openai", "b": "from vllm"} {
+		result, err := rt.ExecuteByName(context.Background(), "intent", name)
+		if err != nil {
+			t.Fatalf("execute %s: %v", name, err)
+		}
+		if result.Output != want {
+			t.Errorf("intent %s: expected %q, got %v", name, want, result.Output)
+		}
+	}
+	if atomic.LoadInt32(&openaiCalls) != 1 || atomic.LoadInt32(&vllmCalls) != 1 || vllmKey.Load() != "Bearer sk-vllm" {
+		t.Errorf("unexpected calls: openai=%d vllm=%d key=%v", openaiCalls, vllmCalls, vllmKey.Load())
+	}
+
+	report := metrics.Report()
+	if len(report) != 2 || report[0].Provider != "openai" || report[1].Provider != "vllm-internal" {
+		t.Fatalf("expected stats per instance, got %+v", report)
+	}
+	for _, s := range report {
+		if s.Requests != 1 || s.Successes != 1 || s.InputTokens != 10 || s.OutputTokens != 5 {
+			t.Errorf("unexpected stats %+v", s)
+		}
+	}
+}
+
+func TestProviderInstances_UnknownProvider(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "internal" {
+	model: "gpt-4o"
+	provider: "vllm-internal"
+}
+
+intent "a" {
+	use: agent("internal")
+	input: "hello"
+}
+`))
+	rt := New(ws, WithProvider("openai", NewMockProvider()))
+
+	_, err := rt.ExecuteByName(context.Background(), "intent", "a")
+	if err == nil || !strings.Contains(err.Error(), `unknown provider "vllm-internal" (registered: [openai])`) {
+		t.Errorf("expected unknown provider error, got %v", err)
+	}
+}
+
+func TestProviderInstances_RateLimit(t *testing.T) {
+	var calls int32
+	server := openAICompatibleServer(t, "ok", &calls, nil)
+
+	metrics := NewProviderMetrics()
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+provider "limited" {
+	type: "openai"
+	api_key: "sk-test"
+	base_url: "`+server.URL+`"
+	requests_per_minute: 1200
+}
+`))
+	rt := New(ws, WithProviderMetrics(metrics))
+	if err := rt.ConfigureProviders(); err != nil {
+		t.Fatalf("ConfigureProviders error: %v", err)
+	}
+
+	p, err := rt.getProviderForModel("gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := p.Complete(context.Background(), &CompletionRequest{Model: "gpt-4o"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1200 requests per minute admits one request every 50ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected requests to be spaced by the rate limit, took %v", elapsed)
+	}
+	if s, ok := metrics.Stats("limited"); !ok || s.Requests != 3 || s.TotalWait <= 0 {
+		t.Errorf("expected rate limit wait in stats, got %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Complete(ctx, &CompletionRequest{Model: "gpt-4o"}); err == nil || !strings.Contains(err.Error(), "waiting for rate limit") {
+		t.Errorf("expected canceled wait, got %v", err)
+	}
+}
+
+func TestProviderSettings_RequestsPerMinute(t *testing.T) {
+	_, err := configureSource(t, `provider "p" { type: "openai" requests_per_minute: 0.5 }`)
+	if err == nil || !strings.Contains(err.Error(), "'requests_per_minute' must be a positive integer") {
+		t.Errorf("expected requests_per_minute error, got %v", err)
+	}
+}
@@ -24,6 +24,7 @@ type MockProvider struct {
 // MockResponse represents a canned response for the mock provider.
 type MockResponse struct {
 	Content      string
+	Reasoning    string
 	ToolCalls    []ToolCall
 	FinishReason FinishReason
 	Usage        TokenUsage
@@ -182,6 +183,7 @@ func (p *MockProvider) Complete(ctx context.Context, req *CompletionRequest) (*C
 
 	return &CompletionResponse{
 		Content:      resp.Content,
+		Reasoning:    resp.Reasoning,
 		ToolCalls:    resp.ToolCalls,
 		FinishReason: resp.FinishReason,
 		Usage:        resp.Usage,
@@ -213,6 +215,15 @@ func (p *MockProvider) CompleteStream(ctx context.Context, req *CompletionReques
 	var sentContent strings.Builder
 	chunkIndex := 0
 
+	if resp.Reasoning != "" {
+		handler.OnChunk(StreamChunk{
+			Content: resp.Reasoning,
+			Type:    ChunkTypeReasoning,
+			Index:   chunkIndex,
+		})
+		chunkIndex++
+	}
+
 	for i := 0; i < len(content); i += chunkSize {
 		select {
 		case <-ctx.Done():
@@ -237,12 +248,18 @@ func (p *MockProvider) CompleteStream(ctx context.Context, req *CompletionReques
 		chunkIndex++
 
 		if p.streamDelay > 0 {
-			time.Sleep(p.streamDelay)
+			select {
+			case <-ctx.Done():
+				handler.OnError(ctx.Err())
+				return nil, ctx.Err()
+			case <-time.After(p.streamDelay):
+			}
 		}
 	}
 
 	result := &CompletionResponse{
 		Content:      sentContent.String(),
+		Reasoning:    resp.Reasoning,
 		ToolCalls:    resp.ToolCalls,
 		FinishReason: resp.FinishReason,
 		Usage:        resp.Usage,
@@ -253,6 +270,11 @@ func (p *MockProvider) CompleteStream(ctx context.Context, req *CompletionReques
 	return result, nil
 }
 
+// SupportsSeed reports that responses are repeatable, since they are canned.
+func (p *MockProvider) SupportsSeed() bool {
+	return true
+}
+
 func (p *MockProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	return []ModelInfo{
 		{ID: "mock-model", Name: "Mock Model", Provider: "mock", MaxTokens: 4096},
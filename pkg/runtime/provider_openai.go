@@ -4,19 +4,67 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 )
 
 // OpenAIProvider implements LLMProvider for the OpenAI API.
 type OpenAIProvider struct {
-	apiKey     string
-	baseURL    string
-	httpClient *http.Client
+	apiKey          string
+	baseURL         string
+	httpClient      *http.Client
+	embeddingModel  string
+	moderationModel string
+
+	// keyOptional allows requests without an API key, for self-hosted
+	// OpenAI-compatible endpoints.
+	keyOptional bool
+
+	// streaming is whether CompleteStream streams, and streamRejected
+	// records that the endpoint turned out not to support it
+	streaming      StreamMode
+	streamRejected atomic.Bool
+}
+
+// StreamMode is whether an OpenAI-compatible provider streams responses.
+// Some gateways reject streaming requests or ignore them; without streaming,
+// stream handlers get each response as a single chunk.
+type StreamMode string
+
+const (
+	// StreamAuto streams until the endpoint rejects a streaming request or
+	// answers one unstreamed, and then completes without streaming
+	StreamAuto StreamMode = "auto"
+
+	// StreamAlways always streams
+	StreamAlways StreamMode = "always"
+
+	// StreamNever never streams
+	StreamNever StreamMode = "never"
+)
+
+// ParseStreamMode parses a stream mode: "auto", "always", or "never", or
+// true for always and false for never.
+func ParseStreamMode(v interface{}) (StreamMode, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return StreamAlways, nil
+		}
+		return StreamNever, nil
+	case string:
+		switch mode := StreamMode(v); mode {
+		case StreamAuto, StreamAlways, StreamNever:
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid stream mode %v (use auto, always, or never)", v)
 }
 
 // OpenAIOption is a functional option for configuring OpenAIProvider.
@@ -43,11 +91,35 @@ func WithOpenAIHTTPClient(client *http.Client) OpenAIOption {
 	}
 }
 
+// WithOpenAIEmbeddingModel sets the model used by Embed.
+func WithOpenAIEmbeddingModel(model string) OpenAIOption {
+	return func(p *OpenAIProvider) {
+		p.embeddingModel = model
+	}
+}
+
+// WithOpenAIStreaming sets whether CompleteStream streams (default:
+// StreamAuto).
+func WithOpenAIStreaming(mode StreamMode) OpenAIOption {
+	return func(p *OpenAIProvider) {
+		p.streaming = mode
+	}
+}
+
+// WithOpenAIModerationModel sets the model used by Moderate.
+func WithOpenAIModerationModel(model string) OpenAIOption {
+	return func(p *OpenAIProvider) {
+		p.moderationModel = model
+	}
+}
+
 // NewOpenAIProvider creates a new OpenAI provider.
 func NewOpenAIProvider(opts ...OpenAIOption) *OpenAIProvider {
 	p := &OpenAIProvider{
-		baseURL:    "https://api.openai.com",
-		httpClient: http.DefaultClient,
+		baseURL:         "https://api.openai.com",
+		httpClient:      http.DefaultClient,
+		embeddingModel:  "text-embedding-3-small",
+		moderationModel: "omni-moderation-latest",
 	}
 
 	// Check for API key in environment
@@ -66,12 +138,33 @@ func (p *OpenAIProvider) Name() string {
 	return "openai"
 }
 
+// SupportsSeed reports that requests with a seed sample repeatably.
+func (p *OpenAIProvider) SupportsSeed() bool {
+	return true
+}
+
+// checkAPIKey returns an error if the provider requires an API key and none is set.
+func (p *OpenAIProvider) checkAPIKey() error {
+	if p.apiKey == "" && !p.keyOptional {
+		return fmt.Errorf("openai API key not set")
+	}
+	return nil
+}
+
+// setAuthHeader adds the bearer token to a request if an API key is configured.
+func (p *OpenAIProvider) setAuthHeader(req *http.Request) {
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+}
+
 // openaiRequest is the request format for OpenAI's API.
 type openaiRequest struct {
 	Model       string          `json:"model"`
 	Messages    []openaiMessage `json:"messages"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	Seed        *int            `json:"seed,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
 	Tools       []openaiTool    `json:"tools,omitempty"`
 }
@@ -79,6 +172,7 @@ type openaiRequest struct {
 type openaiMessage struct {
 	Role       string           `json:"role"`
 	Content    string           `json:"content,omitempty"`
+	Reasoning  string           `json:"reasoning_content,omitempty"`
 	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
@@ -122,8 +216,8 @@ type openaiResponse struct {
 }
 
 func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
-	if p.apiKey == "" {
-		return nil, fmt.Errorf("openai API key not set")
+	if err := p.checkAPIKey(); err != nil {
+		return nil, err
 	}
 
 	// Convert messages to OpenAI format
@@ -179,7 +273,8 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (
 		Model:       req.Model,
 		Messages:    openaiMsgs,
 		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+		Temperature: &req.Temperature,
+		Seed:        req.Seed,
 		Tools:       openaiTools,
 	}
 
@@ -192,9 +287,10 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setAuthHeader(httpReq)
 
 	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -202,13 +298,13 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var openaiResp openaiResponse
@@ -232,6 +328,7 @@ func (p *OpenAIProvider) convertResponse(resp *openaiResponse) *CompletionRespon
 	if len(resp.Choices) > 0 {
 		choice := resp.Choices[0]
 		result.Content = choice.Message.Content
+		result.Reasoning = choice.Message.Reasoning
 
 		// Convert tool calls
 		for _, tc := range choice.Message.ToolCalls {
@@ -260,9 +357,66 @@ func (p *OpenAIProvider) convertResponse(resp *openaiResponse) *CompletionRespon
 	return result
 }
 
+// CompleteStream streams the response, or completes it without streaming
+// and passes it to handler as a single chunk, depending on the provider's
+// StreamMode.
 func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
-	if p.apiKey == "" {
-		return nil, fmt.Errorf("openai API key not set")
+	if p.streaming == StreamNever || p.streamRejected.Load() {
+		return p.completeUnstreamed(ctx, req, handler)
+	}
+	resp, err := p.stream(ctx, req, handler)
+	if p.streaming == StreamAlways || !rejectsStreaming(err) {
+		return resp, err
+	}
+
+	// Only an unstreamed request that succeeds shows the endpoint does not
+	// stream, rather than rejecting the request for another reason
+	resp, err = p.completeUnstreamed(ctx, req, handler)
+	if err == nil {
+		p.rejectStreaming(ctx, "rejected a streaming request")
+	}
+	return resp, err
+}
+
+// completeUnstreamed completes req without streaming and replays the
+// response to handler.
+func (p *OpenAIProvider) completeUnstreamed(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	resp, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	replayResponse(resp, handler)
+	return resp, nil
+}
+
+// rejectStreaming completes later requests without streaming.
+func (p *OpenAIProvider) rejectStreaming(ctx context.Context, reason string) {
+	if p.streamRejected.CompareAndSwap(false, true) {
+		logAt(ctx, slog.LevelWarn, "endpoint "+reason+"; completing requests without streaming", slog.String("base_url", p.baseURL))
+	}
+}
+
+// rejectsStreaming reports whether err may be an endpoint refusing to
+// stream: a status for an unsupported request, or a bad request that
+// mentions streaming.
+func rejectsStreaming(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+		return true
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return strings.Contains(strings.ToLower(apiErr.Body), "stream")
+	}
+	return false
+}
+
+// stream sends req as a streaming request.
+func (p *OpenAIProvider) stream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	if err := p.checkAPIKey(); err != nil {
+		return nil, err
 	}
 
 	// Convert messages to OpenAI format
@@ -286,7 +440,8 @@ func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *CompletionRequ
 		Model:       req.Model,
 		Messages:    openaiMsgs,
 		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+		Temperature: &req.Temperature,
+		Seed:        req.Seed,
 		Stream:      true,
 	}
 
@@ -299,9 +454,10 @@ func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *CompletionRequ
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setAuthHeader(httpReq)
 
 	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -309,13 +465,27 @@ func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *CompletionRequ
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	// Endpoints that ignore `stream` answer with the whole response
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var openaiResp openaiResponse
+		if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		if p.streaming != StreamAlways {
+			p.rejectStreaming(ctx, "answered a streaming request unstreamed")
+		}
+		result := p.convertResponse(&openaiResp)
+		replayResponse(result, handler)
+		return result, nil
 	}
 
 	return p.handleStream(resp.Body, handler)
@@ -323,7 +493,7 @@ func (p *OpenAIProvider) CompleteStream(ctx context.Context, req *CompletionRequ
 
 func (p *OpenAIProvider) handleStream(body io.Reader, handler StreamHandler) (*CompletionResponse, error) {
 	result := &CompletionResponse{}
-	var contentBuilder strings.Builder
+	var contentBuilder, reasoningBuilder strings.Builder
 	chunkIndex := 0
 
 	reader := NewSSEReader(body)
@@ -348,7 +518,8 @@ func (p *OpenAIProvider) handleStream(body io.Reader, handler StreamHandler) (*C
 			Choices []struct {
 				Index int `json:"index"`
 				Delta struct {
-					Content string `json:"content"`
+					Content   string `json:"content"`
+					Reasoning string `json:"reasoning_content"`
 				} `json:"delta"`
 				FinishReason string `json:"finish_reason"`
 			} `json:"choices"`
@@ -362,6 +533,15 @@ func (p *OpenAIProvider) handleStream(body io.Reader, handler StreamHandler) (*C
 
 		if len(chunk.Choices) > 0 {
 			choice := chunk.Choices[0]
+			if choice.Delta.Reasoning != "" {
+				reasoningBuilder.WriteString(choice.Delta.Reasoning)
+				handler.OnChunk(StreamChunk{
+					Content: choice.Delta.Reasoning,
+					Type:    ChunkTypeReasoning,
+					Index:   chunkIndex,
+				})
+				chunkIndex++
+			}
 			if choice.Delta.Content != "" {
 				contentBuilder.WriteString(choice.Delta.Content)
 				handler.OnChunk(StreamChunk{
@@ -386,21 +566,23 @@ func (p *OpenAIProvider) handleStream(body io.Reader, handler StreamHandler) (*C
 	}
 
 	result.Content = contentBuilder.String()
+	result.Reasoning = reasoningBuilder.String()
 	handler.OnComplete(result)
 	return result, nil
 }
 
 func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
-	if p.apiKey == "" {
-		return nil, fmt.Errorf("openai API key not set")
+	if err := p.checkAPIKey(); err != nil {
+		return nil, err
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1/models", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setTraceparent(httpReq)
 
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setAuthHeader(httpReq)
 
 	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -408,13 +590,13 @@ func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("failed to close response body: %v", err)
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var listResp struct {
@@ -440,3 +622,86 @@ func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 
 	return models, nil
 }
+
+// Embed returns embedding vectors for the given texts using the embeddings endpoint.
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if err := p.checkAPIKey(); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": p.embeddingModel,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.setAuthHeader(httpReq)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logAt(ctx, slog.LevelWarn, "failed to close response body", "error", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var embedResp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range embedResp.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+// Moderate classifies text with the OpenAI moderation API.
+func (p *OpenAIProvider) Moderate(ctx context.Context, text string) (*ModerationResult, error) {
+	if err := p.checkAPIKey(); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": p.moderationModel,
+		"input": text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setTraceparent(httpReq)
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.setAuthHeader(httpReq)
+
+	return doModeration(p.httpClient, httpReq)
+}
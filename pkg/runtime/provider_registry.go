@@ -0,0 +1,279 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ProviderSettings are the resolved properties of a provider entity:
+//
+//	provider "my-anthropic" {
+//	    type: "anthropic"
+//	    api_key: secret("ANTHROPIC_KEY")
+//	    base_url: "https://anthropic-proxy.internal"
+//	    models: ["claude-sonnet-4-20250514"]
+//	    default: true
+//	}
+//
+// OpenAI-compatible types also take `stream` (see StreamMode).
+type ProviderSettings struct {
+	Name    string
+	Type    string
+	APIKey  string
+	BaseURL string
+
+	// Models are routed to this provider regardless of their prefix
+	Models []string
+
+	// Default makes this the provider for models no other provider claims
+	Default bool
+
+	// RequestsPerMinute and TokensPerMinute limit the load sent to this
+	// instance; zero means unlimited
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// Options holds the remaining properties, e.g. organization
+	Options map[string]interface{}
+}
+
+// ProviderFactory constructs a provider from a provider entity.
+type ProviderFactory func(settings ProviderSettings) (LLMProvider, error)
+
+var (
+	providerFactories = map[string]ProviderFactory{
+		"anthropic": newAnthropicFromSettings,
+		"openai":    newOpenAIFromSettings,
+		"gemini":    newGeminiFromSettings,
+		"bedrock":   newBedrockFromSettings,
+		"local":     newLocalFromSettings,
+		"ollama":    newLocalFromSettings,
+		"vllm":      newLocalFromSettings,
+		"lmstudio":  newLocalFromSettings,
+	}
+	providerFactoriesMu sync.RWMutex
+)
+
+// RegisterProviderType registers the factory for provider entities of the
+// given type, so embedders can declare their own providers in LangSpace.
+//
+// Example:
+//
+//	runtime.RegisterProviderType("acme", func(s runtime.ProviderSettings) (runtime.LLMProvider, error) {
+//	    return acme.NewProvider(s.APIKey), nil
+//	})
+func RegisterProviderType(providerType string, factory ProviderFactory) {
+	providerFactoriesMu.Lock()
+	defer providerFactoriesMu.Unlock()
+	providerFactories[providerType] = factory
+}
+
+// ProviderTypes returns the provider types that provider entities can use.
+func ProviderTypes() []string {
+	providerFactoriesMu.RLock()
+	defer providerFactoriesMu.RUnlock()
+	types := make([]string, 0, len(providerFactories))
+	for t := range providerFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func newAnthropicFromSettings(s ProviderSettings) (LLMProvider, error) {
+	var opts []AnthropicOption
+	if s.APIKey != "" {
+		opts = append(opts, WithAnthropicAPIKey(s.APIKey))
+	}
+	if s.BaseURL != "" {
+		opts = append(opts, WithAnthropicBaseURL(s.BaseURL))
+	}
+	return NewAnthropicProvider(opts...), nil
+}
+
+func newOpenAIFromSettings(s ProviderSettings) (LLMProvider, error) {
+	var opts []OpenAIOption
+	if s.APIKey != "" {
+		opts = append(opts, WithOpenAIAPIKey(s.APIKey))
+	}
+	if s.BaseURL != "" {
+		opts = append(opts, WithOpenAIBaseURL(s.BaseURL))
+	}
+	if v, ok := s.Options["stream"]; ok {
+		mode, err := ParseStreamMode(v)
+		if err != nil {
+			return nil, fmt.Errorf("'stream': %w", err)
+		}
+		opts = append(opts, WithOpenAIStreaming(mode))
+	}
+	return NewOpenAIProvider(opts...), nil
+}
+
+func newGeminiFromSettings(s ProviderSettings) (LLMProvider, error) {
+	var opts []GeminiOption
+	if s.APIKey != "" {
+		opts = append(opts, WithGeminiAPIKey(s.APIKey))
+	}
+	if s.BaseURL != "" {
+		opts = append(opts, WithGeminiBaseURL(s.BaseURL))
+	}
+	return NewGeminiProvider(opts...), nil
+}
+
+func newBedrockFromSettings(s ProviderSettings) (LLMProvider, error) {
+	var opts []BedrockOption
+	if region := toString(s.Options["region"]); s.Options["region"] != nil {
+		opts = append(opts, WithBedrockRegion(region))
+	}
+	if profile := toString(s.Options["profile"]); s.Options["profile"] != nil {
+		opts = append(opts, WithBedrockProfile(profile))
+	}
+	if s.BaseURL != "" {
+		opts = append(opts, WithBedrockEndpoint(s.BaseURL))
+	}
+	return NewBedrockProvider(opts...), nil
+}
+
+func newLocalFromSettings(s ProviderSettings) (LLMProvider, error) {
+	opts := []LocalOption{WithLocalName(s.Name), WithLocalModels(s.Models...)}
+	if s.APIKey != "" {
+		opts = append(opts, WithLocalAPIKey(s.APIKey))
+	}
+	if v, ok := s.Options["stream"]; ok {
+		mode, err := ParseStreamMode(v)
+		if err != nil {
+			return nil, fmt.Errorf("'stream': %w", err)
+		}
+		opts = append(opts, WithLocalStreaming(mode))
+	}
+	return NewLocalProvider(s.BaseURL, opts...), nil
+}
+
+// configureProviderEntities constructs and registers the providers declared
+// by provider entities, under the entity names.
+func (r *Runtime) configureProviderEntities() error {
+	entities := r.workspace.GetEntitiesByType("provider")
+	if len(entities) == 0 {
+		return nil
+	}
+
+	resolver := NewResolver(&ExecutionContext{
+		Context:   context.Background(),
+		Runtime:   r,
+		Workspace: r.workspace,
+		Variables: make(map[string]interface{}),
+	})
+	for _, entity := range entities {
+		settings, err := providerSettings(entity, resolver)
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", entity.Name(), err)
+		}
+
+		providerFactoriesMu.RLock()
+		factory, ok := providerFactories[settings.Type]
+		providerFactoriesMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("provider %q: unknown type %q (known types: %v)", entity.Name(), settings.Type, ProviderTypes())
+		}
+		provider, err := factory(settings)
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", entity.Name(), err)
+		}
+
+		r.mu.Lock()
+		r.providers[settings.Name] = provider
+		r.providerTypes[settings.Name] = settings.Type
+		for _, model := range settings.Models {
+			r.modelRoutes[model] = settings.Name
+		}
+		if settings.Default {
+			r.config.DefaultProvider = settings.Name
+		}
+		r.setRateLimit(settings.Name, RateLimit{
+			RequestsPerMinute: settings.RequestsPerMinute,
+			TokensPerMinute:   settings.TokensPerMinute,
+		})
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// providerSettings resolves the properties of a provider entity.
+func providerSettings(entity ast.Entity, resolver *Resolver) (ProviderSettings, error) {
+	settings := ProviderSettings{Name: entity.Name(), Options: make(map[string]interface{})}
+	for key, prop := range entity.Properties() {
+		value, err := resolver.Resolve(prop)
+		if err != nil {
+			return settings, fmt.Errorf("'%s': %w", key, err)
+		}
+		switch key {
+		case "type":
+			settings.Type = toString(value)
+		case "api_key":
+			settings.APIKey = toString(value)
+		case "base_url":
+			settings.BaseURL = toString(value)
+		case "models":
+			models, ok := value.([]interface{})
+			if !ok {
+				return settings, fmt.Errorf("'models' must be an array")
+			}
+			for _, m := range models {
+				settings.Models = append(settings.Models, toString(m))
+			}
+		case "default":
+			b, ok := value.(bool)
+			if !ok {
+				return settings, fmt.Errorf("'default' must be a boolean")
+			}
+			settings.Default = b
+		case "requests_per_minute":
+			if settings.RequestsPerMinute, err = positiveInt(key, value); err != nil {
+				return settings, err
+			}
+		case "tokens_per_minute":
+			if settings.TokensPerMinute, err = positiveInt(key, value); err != nil {
+				return settings, err
+			}
+		default:
+			settings.Options[key] = value
+		}
+	}
+	if settings.Type == "" {
+		return settings, fmt.Errorf("missing 'type'")
+	}
+	return settings, nil
+}
+
+// positiveInt returns the positive integer value of a property.
+func positiveInt(key string, value interface{}) (int, error) {
+	n, ok := value.(float64)
+	if !ok || n < 1 || n != float64(int(n)) {
+		return 0, fmt.Errorf("'%s' must be a positive integer", key)
+	}
+	return int(n), nil
+}
+
+// providerOfType returns the provider registered under the type's name, or
+// else the first (by name) provider entity of that type.
+func (r *Runtime) providerOfType(providerType string) (string, LLMProvider, bool) {
+	if p, ok := r.providers[providerType]; ok {
+		return providerType, p, true
+	}
+	var names []string
+	for name, t := range r.providerTypes {
+		if t == providerType {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil, false
+	}
+	sort.Strings(names)
+	p, ok := r.providers[names[0]]
+	return names[0], p, ok
+}
@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func configureSource(t *testing.T, source string) (*Runtime, error) {
+	t.Helper()
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	rt := New(ws)
+	return rt, rt.ConfigureProviders()
+}
+
+func TestConfigureProviders_Entities(t *testing.T) {
+	t.Setenv("TEST_ANTHROPIC_KEY", "sk-ant-test")
+
+	rt, err := configureSource(t, `
+provider "my-anthropic" {
+	type: "anthropic"
+	api_key: secret("TEST_ANTHROPIC_KEY")
+	base_url: "https://anthropic-proxy.internal"
+}
+
+provider "vllm-internal" {
+	type: "vllm"
+	base_url: "http://vllm.internal:8000/v1"
+	models: ["llama3.1"]
+	default: true
+}
+`)
+	if err != nil {
+		t.Fatalf("ConfigureProviders error: %v", err)
+	}
+
+	// Prefix detection finds the anthropic-typed provider by its type
+	p, err := rt.getProviderForModel("claude-sonnet-4-20250514")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anthropic, ok := p.(*AnthropicProvider)
+	if !ok || anthropic.apiKey != "sk-ant-test" || anthropic.baseURL != "https://anthropic-proxy.internal" {
+		t.Errorf("unexpected provider for claude model: %#v", p)
+	}
+
+	p, err = rt.getProviderForModel("llama3.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local, ok := p.(*LocalProvider); !ok || local.Name() != "vllm-internal" || local.baseURL != "http://vllm.internal:8000" {
+		t.Errorf("unexpected provider for routed model: %#v", p)
+	}
+
+	// The default provider serves models no other provider claims
+	if p, _ := rt.getProviderForModel("mistral-large"); p.Name() != "vllm-internal" {
+		t.Errorf("expected default provider, got %s", p.Name())
+	}
+	if _, ok := rt.GetProvider("my-anthropic"); !ok {
+		t.Error("expected provider registered under the entity name")
+	}
+}
+
+func TestConfigureProviders_EntityRequest(t *testing.T) {
+	var gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("TEST_OPENAI_KEY", "sk-test")
+
+	rt, err := configureSource(t, `
+provider "openai-proxy" {
+	type: "openai"
+	api_key: secret("TEST_OPENAI_KEY")
+	base_url: "`+server.URL+`"
+}
+
+agent "writer" {
+	model: "gpt-4o"
+}
+
+intent "draft" {
+	use: agent("writer")
+	input: "hello"
+}
+`)
+	if err != nil {
+		t.Fatalf("ConfigureProviders error: %v", err)
+	}
+
+	result, err := rt.ExecuteByName(context.Background(), "intent", "draft")
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if result.Output != "done" || gotKey != "Bearer sk-test" {
+		t.Errorf("unexpected output %v with key %q", result.Output, gotKey)
+	}
+}
+
+func TestConfigureProviders_EntityErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "unknown type",
+			source: `provider "p" { type: "carrier-pigeon" }`,
+			want:   `provider "p": unknown type "carrier-pigeon"`,
+		},
+		{
+			name:   "missing secret",
+			source: `provider "p" { type: "openai" api_key: secret("TEST_UNSET_SECRET") }`,
+			want:   `secret "TEST_UNSET_SECRET" is not set`,
+		},
+		{
+			name:   "models not an array",
+			source: `provider "p" { type: "ollama" models: "llama3.1" }`,
+			want:   `'models' must be an array`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configureSource(t, tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRegisterProviderType(t *testing.T) {
+	var got ProviderSettings
+	RegisterProviderType("test-custom", func(s ProviderSettings) (LLMProvider, error) {
+		got = s
+		return NewMockProvider(), nil
+	})
+	defer func() {
+		providerFactoriesMu.Lock()
+		delete(providerFactories, "test-custom")
+		providerFactoriesMu.Unlock()
+	}()
+
+	rt, err := configureSource(t, `
+provider "custom" {
+	type: "test-custom"
+	region: "eu-north-1"
+	models: ["custom-model"]
+}
+`)
+	if err != nil {
+		t.Fatalf("ConfigureProviders error: %v", err)
+	}
+	if got.Name != "custom" || got.Options["region"] != "eu-north-1" {
+		t.Errorf("unexpected settings %+v", got)
+	}
+	if p, _ := rt.getProviderForModel("custom-model"); p == nil || p.Name() != "mock" {
+		t.Errorf("expected custom provider for routed model, got %v", p)
+	}
+}
@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/jsonpath"
+)
+
+// queryValue resolves query(value, path), selecting from a structured value
+// with a JSONPath expression:
+//
+//	query(step("review").output, "$.items[?(@.severity=='high')].title")
+//
+// Text is decoded as JSON first. A path that can select at most one value,
+// such as "$.summary", returns it (or null); any other path returns a list.
+func queryValue(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("query() requires a value and a path, got %d arguments", len(args))
+	}
+	path, err := jsonpath.Compile(toString(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("query(): %w", err)
+	}
+	doc, err := toJSONValue(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("query(): %w", err)
+	}
+
+	results := path.Get(doc)
+	if path.Definite() {
+		if len(results) == 0 {
+			return nil, nil
+		}
+		return results[0], nil
+	}
+	if results == nil {
+		results = []interface{}{}
+	}
+	return results, nil
+}
+
+// toJSONValue converts a resolved value to the generic form encoding/json
+// decodes into, so that paths see maps, lists, numbers as float64, and so on.
+func toJSONValue(v interface{}) (interface{}, error) {
+	// Maps and lists may hold other types, such as int, so only text and
+	// null are used as they are
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(val)), &decoded); err != nil {
+			return nil, fmt.Errorf("value is not JSON: %w", err)
+		}
+		return decoded, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %T to JSON: %w", v, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
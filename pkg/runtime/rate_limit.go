@@ -0,0 +1,242 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// RateLimit caps the load sent to a provider instance. Zero fields are
+// unlimited.
+type RateLimit struct {
+	// RequestsPerMinute spaces requests evenly so that at most this many
+	// start in any minute
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+
+	// TokensPerMinute caps the input and output tokens per minute. A request
+	// reserves its estimated input tokens and max_tokens before it is sent,
+	// and the reservation is corrected by the usage the provider reports.
+	TokensPerMinute int `json:"tokens_per_minute,omitempty"`
+}
+
+// IsZero reports whether the limit is unlimited.
+func (l RateLimit) IsZero() bool {
+	return l.RequestsPerMinute <= 0 && l.TokensPerMinute <= 0
+}
+
+// rateLimiter queues requests to a provider instance so they stay within its
+// RateLimit. Requests are admitted in the order they arrive.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	// interval is the spacing between request starts, and next the earliest
+	// start of the next request
+	interval time.Duration
+	next     time.Time
+
+	// Tokens refill continuously at tokenRate per second up to capacity;
+	// tokens were available at last, which may be a reserved future start
+	tokenRate float64
+	capacity  float64
+	tokens    float64
+	last      time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	l := &rateLimiter{}
+	if limit.RequestsPerMinute > 0 {
+		l.interval = time.Minute / time.Duration(limit.RequestsPerMinute)
+	}
+	if limit.TokensPerMinute > 0 {
+		l.capacity = float64(limit.TokensPerMinute)
+		l.tokenRate = l.capacity / time.Minute.Seconds()
+		l.tokens = l.capacity
+	}
+	return l
+}
+
+// Wait blocks until a request expected to use tokens may start, and returns
+// how long it waited in the queue.
+func (l *rateLimiter) Wait(ctx context.Context, tokens int) (time.Duration, error) {
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	if l.tokenRate > 0 {
+		need := l.reservation(tokens)
+		avail := l.available(start)
+		if avail < need {
+			start = start.Add(time.Duration((need - avail) / l.tokenRate * float64(time.Second)))
+			avail = need
+		}
+		l.tokens = avail - need
+		l.last = start
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := start.Sub(now)
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Settle corrects a request's reservation of estimated tokens once the
+// tokens it used are known.
+func (l *rateLimiter) Settle(estimated, used int) {
+	if l.tokenRate == 0 || used <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.tokens+l.reservation(estimated)-float64(used), l.capacity)
+}
+
+// reservation is the number of tokens reserved for a request expected to
+// use tokens. Requests larger than the whole budget reserve all of it, so
+// they wait for a full minute's budget rather than forever.
+func (l *rateLimiter) reservation(tokens int) float64 {
+	return math.Min(float64(tokens), l.capacity)
+}
+
+// available returns the tokens available at t, which is never before last.
+func (l *rateLimiter) available(t time.Time) float64 {
+	if l.last.IsZero() {
+		return l.tokens
+	}
+	return math.Min(l.tokens+t.Sub(l.last).Seconds()*l.tokenRate, l.capacity)
+}
+
+// estimateRequestTokens estimates the tokens a request will use: its prompt
+// and the most it may generate.
+func estimateRequestTokens(req *CompletionRequest) int {
+	n := CountTokens(req.Model, req.SystemPrompt) + req.MaxTokens
+	for _, msg := range req.Messages {
+		n += CountTokens(req.Model, msg.Content)
+	}
+	return n
+}
+
+// queueWaitKey is the context key of the queueWait that rate limit waits are
+// added to.
+type queueWaitKey struct{}
+
+// queueWait accumulates the time a step's provider calls spend queued.
+type queueWait struct {
+	total atomic.Int64
+}
+
+func withQueueWait(ctx context.Context, w *queueWait) context.Context {
+	return context.WithValue(ctx, queueWaitKey{}, w)
+}
+
+// addQueueWait adds d to the context's queueWait, if any.
+func addQueueWait(ctx context.Context, d time.Duration) {
+	if w, ok := ctx.Value(queueWaitKey{}).(*queueWait); ok {
+		w.total.Add(int64(d))
+	}
+}
+
+// Duration returns the time waited so far.
+func (w *queueWait) Duration() time.Duration {
+	return time.Duration(w.total.Load())
+}
+
+// rateLimiter returns the limiter of the named provider instance, or nil if
+// it is unlimited.
+func (r *Runtime) rateLimiter(name string) *rateLimiter {
+	r.mu.RLock()
+	l, ok := r.rateLimiters[name]
+	limit := r.config.RateLimits[name]
+	r.mu.RUnlock()
+	if ok || limit.IsZero() {
+		return l
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.rateLimiters[name]; ok {
+		return l
+	}
+	l = newRateLimiter(limit)
+	r.rateLimiters[name] = l
+	return l
+}
+
+// setRateLimit limits the named provider instance, unless the runtime
+// Config already does. The caller must hold r.mu.
+func (r *Runtime) setRateLimit(name string, limit RateLimit) {
+	if limit.IsZero() {
+		return
+	}
+	if _, ok := r.config.RateLimits[name]; ok {
+		return
+	}
+	r.rateLimiters[name] = newRateLimiter(limit)
+}
+
+// configureProviderRateLimits applies `requests_per_minute` and
+// `tokens_per_minute` from the config entity's `providers` object to the
+// instances that provider entities do not limit. Only those keys are
+// resolved, so an unset secret does not fail the configuration here.
+func (r *Runtime) configureProviderRateLimits(config ast.Entity) error {
+	prop, ok := config.GetProperty("providers")
+	if !ok {
+		return nil
+	}
+	providers, ok := prop.(ast.ObjectValue)
+	if !ok {
+		return nil
+	}
+
+	resolver := NewResolver(&ExecutionContext{
+		Context:   context.Background(),
+		Runtime:   r,
+		Workspace: r.workspace,
+		Variables: make(map[string]interface{}),
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, entry := range providers.Properties {
+		settings, ok := entry.(ast.ObjectValue)
+		if !ok {
+			continue
+		}
+		var limit RateLimit
+		for key, field := range map[string]*int{
+			"requests_per_minute": &limit.RequestsPerMinute,
+			"tokens_per_minute":   &limit.TokensPerMinute,
+		} {
+			prop, ok := settings.Properties[key]
+			if !ok {
+				continue
+			}
+			value, err := resolver.Resolve(prop)
+			if err == nil {
+				*field, err = positiveInt(key, value)
+			}
+			if err != nil {
+				return fmt.Errorf("config 'providers.%s': %w", name, err)
+			}
+		}
+		if _, ok := r.rateLimiters[name]; !ok {
+			r.setRateLimit(name, limit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestRateLimiter_Tokens(t *testing.T) {
+	// 1000 tokens per second
+	l := newRateLimiter(RateLimit{TokensPerMinute: 60000})
+	ctx := context.Background()
+
+	if wait, err := l.Wait(ctx, 60000); err != nil || wait != 0 {
+		t.Fatalf("first request waited %v (err %v), want no wait", wait, err)
+	}
+	wait, err := l.Wait(ctx, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 40*time.Millisecond {
+		t.Errorf("request after exhausting the budget waited %v, want ~50ms", wait)
+	}
+
+	// The first request used far fewer tokens than it reserved
+	l.Settle(60000, 1000)
+	if wait, err := l.Wait(ctx, 50); err != nil || wait != 0 {
+		t.Errorf("request after settling waited %v (err %v), want no wait", wait, err)
+	}
+}
+
+func TestRateLimiter_OversizedRequest(t *testing.T) {
+	l := newRateLimiter(RateLimit{TokensPerMinute: 60000})
+	if wait, err := l.Wait(context.Background(), 1000000); err != nil || wait != 0 {
+		t.Errorf("oversized request waited %v (err %v), want it to take the full budget", wait, err)
+	}
+}
+
+func TestRateLimiter_Cancel(t *testing.T) {
+	l := newRateLimiter(RateLimit{RequestsPerMinute: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := l.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := l.Wait(ctx, 0); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExecute_StepQueueWait(t *testing.T) {
+	source := `
+agent "caller" {
+	model: "mock-model"
+}
+
+pipeline "twice" {
+	step "first" {
+		use: agent("caller")
+	}
+	step "second" {
+		use: agent("caller")
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	cfg := DefaultConfig()
+	cfg.RateLimits = map[string]RateLimit{"mock": {RequestsPerMinute: 600}}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "one"},
+		MockResponse{Content: "two"},
+	))
+	rt := New(ws, WithConfig(cfg), WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "twice")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if got := result.StepResults["first"].QueueWait; got != 0 {
+		t.Errorf("first step queued for %v, want 0", got)
+	}
+	if got := result.StepResults["second"].QueueWait; got < 50*time.Millisecond {
+		t.Errorf("second step queued for %v, want ~100ms", got)
+	}
+}
+
+func TestConfigureProviders_RateLimits(t *testing.T) {
+	rt, err := configureSource(t, `
+config {
+	providers: {
+		anthropic: {
+			api_key: secret("UNSET_RATE_LIMIT_TEST_KEY")
+			tokens_per_minute: 40000
+		}
+		openai: {
+			requests_per_minute: 60
+		}
+	}
+}
+
+provider "openai" {
+	type: "openai"
+	requests_per_minute: 120
+}
+`)
+	if err != nil {
+		t.Fatalf("ConfigureProviders: %v", err)
+	}
+
+	if l := rt.rateLimiter("anthropic"); l == nil || l.capacity != 40000 {
+		t.Errorf("anthropic limiter = %+v, want 40000 tokens per minute", l)
+	}
+	// The provider entity takes precedence over the config entity
+	if l := rt.rateLimiter("openai"); l == nil || l.interval != 500*time.Millisecond {
+		t.Errorf("openai limiter = %+v, want 120 requests per minute", l)
+	}
+}
+
+func TestConfigureProviders_RateLimitsOverride(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `provider "openai" {
+	type: "openai"
+	requests_per_minute: 120
+}`))
+	cfg := DefaultConfig()
+	cfg.RateLimits = map[string]RateLimit{"openai": {}}
+	rt := New(ws, WithConfig(cfg))
+	if err := rt.ConfigureProviders(); err != nil {
+		t.Fatalf("ConfigureProviders: %v", err)
+	}
+	if l := rt.rateLimiter("openai"); l != nil {
+		t.Errorf("runtime config should lift the limit, got %+v", l)
+	}
+}
+
+func TestConfigureProviders_RateLimitInvalid(t *testing.T) {
+	_, err := configureSource(t, `config {
+	providers: {
+		openai: { tokens_per_minute: -5 }
+	}
+}`)
+	if err == nil || !strings.Contains(err.Error(), "'tokens_per_minute' must be a positive integer") {
+		t.Errorf("expected tokens_per_minute error, got %v", err)
+	}
+}
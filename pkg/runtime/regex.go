@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// resolveRegexFunction resolves the regex built-ins, whose patterns use RE2
+// syntax (see regexp/syntax):
+//
+//	regex_match(text, pattern)              true if pattern matches text
+//	regex_extract(text, pattern)            the first match's groups as an
+//	                                        object, or null if none matches
+//	regex_replace(text, pattern, template)  text with every match replaced;
+//	                                        template may use $1 or ${name}
+func resolveRegexFunction(name string, args []interface{}) (interface{}, error) {
+	want := 2
+	if name == "regex_replace" {
+		want = 3
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%s() requires %d arguments, got %d", name, want, len(args))
+	}
+	text := toString(args[0])
+	re, err := regexp.Compile(toString(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("%s(): invalid pattern: %w", name, err)
+	}
+
+	switch name {
+	case "regex_match":
+		return re.MatchString(text), nil
+	case "regex_replace":
+		return re.ReplaceAllString(text, toString(args[2])), nil
+	}
+
+	match := re.FindStringSubmatchIndex(text)
+	if match == nil {
+		return nil, nil
+	}
+
+	// Groups are keyed by name, or by number if unnamed; groups that did
+	// not take part in the match are null
+	groups := make(map[string]interface{}, re.NumSubexp())
+	for i, group := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if group == "" {
+			group = strconv.Itoa(i)
+		}
+		if start := match[2*i]; start >= 0 {
+			groups[group] = text[start:match[2*i+1]]
+		} else {
+			groups[group] = nil
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often a Reloader checks its files for changes.
+const DefaultReloadInterval = time.Second
+
+// ReloadFunc loads a new version of a workspace. It returns the runtime and
+// the files it was loaded from (the workspace file and its imports), which
+// are watched for the next change.
+type ReloadFunc func() (*Runtime, []string, error)
+
+// ReloadEvent reports a change to the watched files.
+type ReloadEvent struct {
+	Time time.Time
+
+	// Files are the watched files that changed, were created, or were removed
+	Files []string
+
+	// Runtime is the new stable runtime, or nil if loading failed
+	Runtime *Runtime
+
+	// Err is the error loading the new version; the previous version keeps
+	// serving until the files change again
+	Err error
+}
+
+// Reloader watches the files a workspace was loaded from and hot-swaps the
+// rollout's stable runtime when any of them changes, so a server picks up
+// edits without a restart. Files are polled for changes to their size and
+// modification time.
+//
+// Example:
+//
+//	reloader := runtime.NewReloader(rollout, load, files).WithTriggerEngine(engine)
+//	reloader.OnReload(func(e runtime.ReloadEvent) { log.Printf("reloaded %v: %v", e.Files, e.Err) })
+//	go reloader.Run(ctx)
+type Reloader struct {
+	rollout  *Rollout
+	engine   *TriggerEngine
+	load     ReloadFunc
+	interval time.Duration
+	files    map[string]fileState
+	handlers []func(ReloadEvent)
+	mu       sync.Mutex
+}
+
+// fileState is what a Reloader compares to detect a change.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// NewReloader creates a reloader that calls load when any of files changes
+// and makes the result the rollout's stable version.
+func NewReloader(rollout *Rollout, load ReloadFunc, files []string) *Reloader {
+	rl := &Reloader{
+		rollout:  rollout,
+		load:     load,
+		interval: DefaultReloadInterval,
+	}
+	rl.watch(files)
+	return rl
+}
+
+// WithTriggerEngine reschedules the engine's triggers after each reload.
+func (rl *Reloader) WithTriggerEngine(engine *TriggerEngine) *Reloader {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.engine = engine
+	return rl
+}
+
+// WithInterval sets how often the files are checked.
+func (rl *Reloader) WithInterval(interval time.Duration) *Reloader {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if interval > 0 {
+		rl.interval = interval
+	}
+	return rl
+}
+
+// OnReload registers fn to be called after every reload attempt.
+func (rl *Reloader) OnReload(fn func(ReloadEvent)) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.handlers = append(rl.handlers, fn)
+}
+
+// Run checks the files until ctx is done.
+func (rl *Reloader) Run(ctx context.Context) {
+	rl.mu.Lock()
+	interval := rl.interval
+	rl.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rl.Check()
+		}
+	}
+}
+
+// Check reloads the workspace if any watched file changed since the last
+// check, and reports whether it did.
+func (rl *Reloader) Check() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var changed []string
+	for path, state := range rl.files {
+		if statFile(path) != state {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return false
+	}
+	sort.Strings(changed)
+
+	event := ReloadEvent{Time: time.Now(), Files: changed}
+	rt, files, err := rl.load()
+	if err == nil {
+		err = rl.rollout.Replace(rt)
+		event.Runtime = rt
+		rl.watch(files)
+		if rl.engine != nil {
+			rl.engine.Reload()
+		}
+	} else {
+		// Wait for the next edit rather than failing on every check
+		for _, path := range changed {
+			rl.files[path] = statFile(path)
+		}
+	}
+	event.Err = err
+
+	for _, fn := range rl.handlers {
+		fn(event)
+	}
+	return true
+}
+
+// watch replaces the watched files. Must be called with lock held, or
+// before the reloader is shared.
+func (rl *Reloader) watch(files []string) {
+	rl.files = make(map[string]fileState, len(files))
+	for _, path := range files {
+		rl.files[path] = statFile(path)
+	}
+}
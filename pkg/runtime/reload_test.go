@@ -0,0 +1,128 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func writeReloadFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadReloadFile(path string) ReloadFunc {
+	return func() (*Runtime, []string, error) {
+		ws := workspace.New()
+		l := workspace.NewLoader(ws)
+		if err := l.Load(path); err != nil {
+			return nil, nil, err
+		}
+		return New(ws), l.Files(), nil
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.ls")
+	lib := filepath.Join(dir, "lib.ls")
+	writeReloadFile(t, lib, `agent "writer" { model: "gpt-4o" }`)
+	writeReloadFile(t, main, `import "lib.ls"`)
+
+	load := loadReloadFile(main)
+	rt, files, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollout := NewRollout(rt)
+	reloader := NewReloader(rollout, load, files)
+	var events []ReloadEvent
+	reloader.OnReload(func(e ReloadEvent) { events = append(events, e) })
+
+	if reloader.Check() {
+		t.Fatal("reloaded without changes")
+	}
+
+	// An edit to an import swaps in a new version
+	writeReloadFile(t, lib, `agent "writer" { model: "gpt-4o" }
+agent "editor" { model: "gpt-4o" }`)
+	if !reloader.Check() {
+		t.Fatal("expected a reload after editing an import")
+	}
+	if rollout.Stable() == rt {
+		t.Fatal("stable runtime was not replaced")
+	}
+	if _, ok := rollout.Stable().Workspace().GetEntityByName("agent", "editor"); !ok {
+		t.Error("new version is missing agent 'editor'")
+	}
+	if len(events) != 1 || events[0].Err != nil || len(events[0].Files) != 1 || events[0].Files[0] != lib {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	// A broken edit keeps the previous version serving
+	current := rollout.Stable()
+	writeReloadFile(t, main, `import "lib.ls"
+agent "broken" {`)
+	if !reloader.Check() {
+		t.Fatal("expected a reload attempt after a broken edit")
+	}
+	if rollout.Stable() != current {
+		t.Error("a failed reload replaced the stable runtime")
+	}
+	if len(events) != 2 || events[1].Err == nil || events[1].Runtime != nil {
+		t.Fatalf("expected a failed reload event, got %+v", events[len(events)-1])
+	}
+	if reloader.Check() {
+		t.Error("a failed reload should wait for the next edit")
+	}
+}
+
+func TestReloader_ReschedulesTriggers(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.ls")
+	writeReloadFile(t, main, `agent "writer" { model: "gpt-4o" }`)
+
+	load := loadReloadFile(main)
+	rt, files, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollout := NewRollout(rt)
+	engine := NewTriggerEngine(rt).WithRollout(rollout)
+	if err := engine.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = engine.Stop() }()
+	reloader := NewReloader(rollout, load, files).WithTriggerEngine(engine)
+
+	writeReloadFile(t, main, `agent "writer" { model: "gpt-4o" }
+
+intent "report" {
+	use: agent("writer")
+}
+
+trigger "nightly" {
+	schedule: "0 2 * * *"
+	run: intent("report")
+}`)
+	if !reloader.Check() {
+		t.Fatal("expected a reload")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := engine.NextRuns()["nightly"]; ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("trigger from the reloaded workspace was not scheduled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
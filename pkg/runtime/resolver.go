@@ -5,8 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
 )
 
 // Resolver handles variable resolution and value interpolation.
@@ -14,6 +16,26 @@ import (
 type Resolver struct {
 	ctx       *ExecutionContext
 	workspace *WorkspaceResolver
+
+	// locals are variables scoped to an expression, such as $item in map()
+	locals map[string]interface{}
+
+	// includes are the prompts being included, outermost first
+	includes []string
+
+	// budget fits file() inputs to a context window (see WithContextWindow)
+	budget *contextBudget
+}
+
+// withContextBudget returns a resolver like r that fits file() inputs to
+// budget, or r if budget is nil.
+func (r *Resolver) withContextBudget(budget *contextBudget) *Resolver {
+	if budget == nil {
+		return r
+	}
+	fitted := *r
+	fitted.budget = budget
+	return &fitted
 }
 
 // NewResolver creates a new resolver with the given execution context.
@@ -41,6 +63,9 @@ func (r *Resolver) Resolve(value ast.Value) (interface{}, error) {
 	case ast.BoolValue:
 		return v.Value, nil
 
+	case ast.NullValue:
+		return nil, nil
+
 	case ast.ArrayValue:
 		return r.resolveArray(v)
 
@@ -51,6 +76,9 @@ func (r *Resolver) Resolve(value ast.Value) (interface{}, error) {
 		return r.resolveVariable(v.Name)
 
 	case ast.ReferenceValue:
+		if v.Optional != nil {
+			return r.resolveOptionalReference(v)
+		}
 		return r.resolveReference(v)
 
 	case ast.PropertyAccessValue:
@@ -72,6 +100,26 @@ func (r *Resolver) Resolve(value ast.Value) (interface{}, error) {
 	case ast.ComparisonValue:
 		return r.resolveComparison(v)
 
+	case ast.CoalesceValue:
+		left, err := r.Resolve(v.Left)
+		if err != nil || left != nil {
+			return left, err
+		}
+		return r.Resolve(v.Right)
+
+	case ast.ArithmeticValue:
+		return r.resolveArithmetic(v)
+
+	case ast.LogicalValue:
+		return r.resolveLogical(v)
+
+	case ast.NotValue:
+		operand, err := r.resolveCondition(v.Operand, "!")
+		if err != nil {
+			return nil, err
+		}
+		return !operand, nil
+
 	case ast.BranchValue:
 		// Branch values are control flow, return as-is
 		return v, nil
@@ -113,7 +161,9 @@ func toString(v interface{}) string {
 }
 
 // interpolateString handles template interpolation in strings.
-// Supports {{variable}} and {{expression}} syntax.
+// Supports {{variable}} and {{expression}} syntax, with escaping filters such
+// as {{step.fetch.output | untrusted}} (see applyFilter), and prompt partials
+// such as {{include "style-guide"}}.
 func (r *Resolver) interpolateString(s string) (string, error) {
 	result := s
 
@@ -130,11 +180,16 @@ func (r *Resolver) interpolateString(s string) (string, error) {
 		}
 		end += start + 2
 
-		expr := strings.TrimSpace(result[start+2 : end-2])
+		expr, filters := splitFilters(result[start+2 : end-2])
 		value, err := r.resolveExpression(expr)
 		if err != nil {
 			return "", fmt.Errorf("failed to interpolate {{%s}}: %w", expr, err)
 		}
+		for _, filter := range filters {
+			if value, err = applyFilter(filter, value, r.ctx.Taint); err != nil {
+				return "", fmt.Errorf("failed to interpolate {{%s}}: %w", expr, err)
+			}
+		}
 
 		result = result[:start] + toString(value) + result[end:]
 	}
@@ -142,41 +197,73 @@ func (r *Resolver) interpolateString(s string) (string, error) {
 	return result, nil
 }
 
+// isFunctionCall reports whether an interpolated expression is a call such
+// as query($items, "$[0]"): a name followed by parenthesized arguments.
+func isFunctionCall(expr string) bool {
+	open := strings.IndexByte(expr, '(')
+	if open <= 0 || !strings.HasSuffix(expr, ")") {
+		return false
+	}
+	for i := 0; i < open; i++ {
+		if c := expr[i]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 // resolveExpression parses and resolves a string expression.
 func (r *Resolver) resolveExpression(expr string) (interface{}, error) {
 	expr = strings.TrimSpace(expr)
 
+	// Handle prompt partials: include "style-guide"
+	if name, ok := includedPrompt(expr); ok {
+		return r.includePrompt(name)
+	}
+
+	// Handle operators: step.count.output * 2, $elapsed > "5m"
+	if left, op, right, ok := splitBinaryExpression(expr); ok {
+		return r.evalBinaryExpression(left, op, right)
+	}
+
+	// Handle function calls: query($items, "$[0].title"), upper(step.x.output)
+	if isFunctionCall(expr) {
+		value, err := parser.ParseValue(expr)
+		if err != nil {
+			return nil, err
+		}
+		return r.Resolve(value)
+	}
+
 	// Handle variable references: $var or var
 	if strings.HasPrefix(expr, "$") {
 		return r.resolveVariable(expr[1:])
 	}
 
-	// Handle property access: params.field, step.output
+	// Handle property access: params.field, step.output, step.x?.summary
 	if strings.Contains(expr, ".") {
-		parts := strings.SplitN(expr, ".", 2)
-		base := parts[0]
-		path := strings.Split(parts[1], ".")
+		base, path, optional := splitPath(expr)
 
 		// Check if base is a variable
-		if baseVal, ok := r.ctx.GetVariable(base); ok {
-			return getNestedValue(baseVal, path)
+		if baseVal, ok := r.variable(base); ok {
+			return getPath(baseVal, path, optional)
 		}
 
 		// Check if base is a special reference
 		switch base {
 		case "params":
-			if params, ok := r.ctx.GetVariable("params"); ok {
-				return getNestedValue(params, path)
+			if params, ok := r.variable("params"); ok {
+				return getPath(params, path, optional)
 			}
 		case "step":
 			if len(path) >= 1 {
 				stepName := path[0]
-				remainder := path[1:]
 				if output, ok := r.ctx.GetStepOutput(stepName); ok {
-					if len(remainder) == 0 {
-						return output, nil
-					}
-					return getNestedValue(output, remainder)
+					return getPath(output, path[1:], optional[1:])
+				}
+				// step.x?.output is null if step x has no output
+				if len(optional) > 1 && optional[1] {
+					return nil, nil
 				}
 			}
 		case "env":
@@ -184,14 +271,22 @@ func (r *Resolver) resolveExpression(expr string) (interface{}, error) {
 				return os.Getenv(path[0]), nil
 			}
 		case "date":
-			return formatDate(path[0])
+			loc, err := r.locale()
+			if err != nil {
+				return nil, err
+			}
+			tz, err := r.location("")
+			if err != nil {
+				return nil, err
+			}
+			return formatDate(path[0], loc, tz)
 		}
 
 		return nil, fmt.Errorf("cannot resolve expression: %s", expr)
 	}
 
 	// Simple variable name
-	if val, ok := r.ctx.GetVariable(expr); ok {
+	if val, ok := r.variable(expr); ok {
 		return val, nil
 	}
 
@@ -199,10 +294,57 @@ func (r *Resolver) resolveExpression(expr string) (interface{}, error) {
 	return expr, nil
 }
 
+// includedPrompt returns the name of the prompt an include expression
+// names, in double quotes or, inside double-quoted strings, single quotes.
+func includedPrompt(expr string) (string, bool) {
+	rest, ok := strings.CutPrefix(expr, "include")
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	name := strings.TrimSpace(rest)
+	if len(name) < 2 || (name[0] != '"' && name[0] != '\'') || name[len(name)-1] != name[0] {
+		return "", false
+	}
+	return name[1 : len(name)-1], true
+}
+
+// includePrompt resolves the text of a prompt entity, interpolating the
+// templates and includes in it. A prompt that includes itself, directly or
+// through others, is an error.
+func (r *Resolver) includePrompt(name string) (interface{}, error) {
+	for i, included := range r.includes {
+		if included == name {
+			cycle := append(append([]string(nil), r.includes[i:]...), name)
+			return nil, fmt.Errorf("circular prompt include: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	prompt, err := r.workspace.GetPrompt(name)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := prompt.GetProperty("text")
+	if !ok {
+		return nil, fmt.Errorf("prompt %q has no text", name)
+	}
+
+	nested := *r
+	nested.includes = append(r.includes[:len(r.includes):len(r.includes)], name)
+	return nested.ResolveString(text)
+}
+
+// variable looks up a variable in the expression's locals, then in the
+// execution context.
+func (r *Resolver) variable(name string) (interface{}, bool) {
+	if val, ok := r.locals[name]; ok {
+		return val, true
+	}
+	return r.ctx.GetVariable(name)
+}
+
 // resolveVariable resolves a variable by name.
 func (r *Resolver) resolveVariable(name string) (interface{}, error) {
 	// Check execution context variables
-	if val, ok := r.ctx.GetVariable(name); ok {
+	if val, ok := r.variable(name); ok {
 		return val, nil
 	}
 
@@ -235,6 +377,8 @@ func (r *Resolver) resolveReference(ref ast.ReferenceValue) (interface{}, error)
 		// step("name") returns the step output directly
 		// step("name").output returns the step output
 		// step("name").tokens returns token usage info
+		// step("name").reasoning returns the model's thinking content
+		// step("name").outputs returns the outputs of a for_each step
 		if len(ref.Path) == 0 {
 			output, ok := r.ctx.GetStepOutput(ref.Name)
 			if !ok {
@@ -267,6 +411,25 @@ func (r *Resolver) resolveReference(ref ast.ReferenceValue) (interface{}, error)
 			return tokens, nil
 		}
 
+		if ref.Path[0] == "outputs" {
+			outputs, ok := r.ctx.GetStepOutput(ref.Name + ".outputs")
+			if !ok {
+				return nil, fmt.Errorf("step outputs not found: %s (only steps with for_each have outputs)", ref.Name)
+			}
+			if len(ref.Path) > 1 {
+				return getNestedValue(outputs, ref.Path[1:])
+			}
+			return outputs, nil
+		}
+
+		if ref.Path[0] == "reasoning" {
+			reasoning, ok := r.ctx.GetStepOutput(ref.Name + ".reasoning")
+			if !ok {
+				return nil, fmt.Errorf("step reasoning not found: %s", ref.Name)
+			}
+			return reasoning, nil
+		}
+
 		// For other paths, try to get the output and access properties on it
 		output, ok := r.ctx.GetStepOutput(ref.Name)
 		if !ok {
@@ -301,6 +464,34 @@ func (r *Resolver) resolveReference(ref ast.ReferenceValue) (interface{}, error)
 	}
 }
 
+// resolveOptionalReference resolves a reference with optional chaining,
+// e.g. step("x")?.output?.summary. The reference is resolved up to the first
+// optional access; if the value there is missing, the result is null.
+func (r *Resolver) resolveOptionalReference(ref ast.ReferenceValue) (interface{}, error) {
+	optional := optionalPath(ref.Path, ref.Optional)
+	first := 0
+	for first < len(optional) && !optional[first] {
+		first++
+	}
+
+	base := ast.ReferenceValue{Type: ref.Type, Name: ref.Name, Path: ref.Path[:first]}
+	if ref.Type == "step" && first == 0 {
+		// The first element selects the step's output, tokens or reasoning,
+		// so step("x")?.output is null if step x has no output
+		base.Path = ref.Path[:1]
+		first = 1
+	}
+
+	value, err := r.resolveReference(base)
+	if err != nil {
+		if optional[0] {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return getPath(value, ref.Path[first:], optional[first:])
+}
+
 // resolveFileReference resolves a file reference.
 func (r *Resolver) resolveFileReference(path string) (interface{}, error) {
 	// Check if it's a glob pattern
@@ -308,18 +499,21 @@ func (r *Resolver) resolveFileReference(path string) (interface{}, error) {
 		return r.resolveGlobPattern(path)
 	}
 
-	// Single file
-	content, err := os.ReadFile(path)
+	// Single file. Paths are written with forward slashes on every platform.
+	content, err := os.ReadFile(filepath.FromSlash(path))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 	}
 
+	if r.budget != nil {
+		return r.budget.fit(r, path, string(content))
+	}
 	return string(content), nil
 }
 
 // resolveGlobPattern resolves a glob pattern to file contents.
 func (r *Resolver) resolveGlobPattern(pattern string) (interface{}, error) {
-	matches, err := filepath.Glob(pattern)
+	matches, err := filepath.Glob(filepath.FromSlash(pattern))
 	if err != nil {
 		return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
 	}
@@ -339,10 +533,18 @@ func (r *Resolver) resolveGlobPattern(pattern string) (interface{}, error) {
 			continue
 		}
 
-		files = append(files, FileContent{
-			Path:    path,
+		// Report paths with forward slashes so prompts are the same on
+		// every platform
+		file := FileContent{
+			Path:    filepath.ToSlash(path),
 			Content: string(content),
-		})
+		}
+		if r.budget != nil {
+			if file.Content, err = r.budget.fit(r, file.Path, file.Content); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, file)
 	}
 
 	return files, nil
@@ -358,13 +560,17 @@ type FileContent struct {
 func (r *Resolver) resolvePropertyAccess(pa ast.PropertyAccessValue) (interface{}, error) {
 	// Handle variable prefix ($varname.property)
 	base := pa.Base
+	optional := optionalPath(pa.Path, pa.Optional)
 	if strings.HasPrefix(base, "$") {
 		varName := base[1:]
 		varVal, err := r.resolveVariable(varName)
 		if err != nil {
+			if optional[0] {
+				return nil, nil
+			}
 			return nil, err
 		}
-		return getNestedValue(varVal, pa.Path)
+		return getPath(varVal, pa.Path, optional)
 	}
 
 	// Resolve base as a variable or special reference
@@ -374,8 +580,8 @@ func (r *Resolver) resolvePropertyAccess(pa ast.PropertyAccessValue) (interface{
 	case "github":
 		return r.resolveGitHubProperty(pa.Path)
 	case "params":
-		if params, ok := r.ctx.GetVariable("params"); ok {
-			return getNestedValue(params, pa.Path)
+		if params, ok := r.variable("params"); ok {
+			return getPath(params, pa.Path, optional)
 		}
 		return nil, fmt.Errorf("params not defined")
 	case "step":
@@ -383,18 +589,19 @@ func (r *Resolver) resolvePropertyAccess(pa ast.PropertyAccessValue) (interface{
 			stepName := pa.Path[0]
 			output, ok := r.ctx.GetStepOutput(stepName)
 			if !ok {
+				// step.x?.output is null if step x has no output
+				if len(optional) > 1 && optional[1] {
+					return nil, nil
+				}
 				return nil, fmt.Errorf("step output not found: %s", stepName)
 			}
-			if len(pa.Path) > 1 {
-				return getNestedValue(output, pa.Path[1:])
-			}
-			return output, nil
+			return getPath(output, pa.Path[1:], optional[1:])
 		}
 	}
 
 	// Try as a variable
-	if val, ok := r.ctx.GetVariable(base); ok {
-		return getNestedValue(val, pa.Path)
+	if val, ok := r.variable(base); ok {
+		return getPath(val, pa.Path, optional)
 	}
 
 	return nil, fmt.Errorf("cannot resolve property access: %s.%s", base, strings.Join(pa.Path, "."))
@@ -424,6 +631,11 @@ func (r *Resolver) resolveMethodCall(mc ast.MethodCallValue) (interface{}, error
 			return val, nil
 		}
 	}
+	if mc.Optional {
+		if objMap, ok := obj.(map[string]interface{}); ok || obj == nil {
+			return objMap[mc.Method], nil
+		}
+	}
 
 	// Handle string methods
 	if s, ok := obj.(string); ok {
@@ -562,6 +774,11 @@ func toInt(v interface{}) (int, bool) {
 
 // resolveFunctionCall resolves a function call.
 func (r *Resolver) resolveFunctionCall(fc ast.FunctionCallValue) (interface{}, error) {
+	// map and filter evaluate their expression per element
+	if fc.Function == "map" || fc.Function == "filter" {
+		return r.resolveListFunction(fc)
+	}
+
 	// Resolve arguments
 	args := make([]interface{}, len(fc.Arguments))
 	for i, arg := range fc.Arguments {
@@ -574,12 +791,34 @@ func (r *Resolver) resolveFunctionCall(fc ast.FunctionCallValue) (interface{}, e
 
 	// Built-in functions
 	switch fc.Function {
+	case "join":
+		return joinList(args)
+
+	case "regex_match", "regex_extract", "regex_replace":
+		return resolveRegexFunction(fc.Function, args)
+
+	case "query":
+		return queryValue(args)
+
 	case "env":
 		if len(args) > 0 {
 			return os.Getenv(toString(args[0])), nil
 		}
 		return "", nil
 
+	case "secret":
+		// secret("KEY") reads a credential from the environment; unlike env(),
+		// a missing value is an error rather than an empty string
+		if len(args) == 0 {
+			return nil, fmt.Errorf("secret() requires a name argument")
+		}
+		name := toString(args[0])
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("secret %q is not set", name)
+		}
+		return value, nil
+
 	case "file":
 		if len(args) > 0 {
 			return r.resolveFileReference(toString(args[0]))
@@ -588,7 +827,7 @@ func (r *Resolver) resolveFunctionCall(fc ast.FunctionCallValue) (interface{}, e
 
 	case "read_file":
 		if len(args) > 0 {
-			content, err := os.ReadFile(toString(args[0]))
+			content, err := os.ReadFile(filepath.FromSlash(toString(args[0])))
 			if err != nil {
 				return nil, err
 			}
@@ -598,7 +837,8 @@ func (r *Resolver) resolveFunctionCall(fc ast.FunctionCallValue) (interface{}, e
 
 	case "write_file":
 		if len(args) >= 2 {
-			path := toString(args[0])
+			// Relative paths are written to the run's working directory
+			path := r.ctx.resolvePath(toString(args[0]))
 			content := toString(args[1])
 			return nil, os.WriteFile(path, []byte(content), 0644)
 		}
@@ -633,6 +873,90 @@ func (r *Resolver) resolveFunctionCall(fc ast.FunctionCallValue) (interface{}, e
 		}
 		return 0.0, nil
 
+	case "date":
+		// date("2006-01-02") or date("15:04", "Europe/Stockholm") formats the
+		// current time in the given or default timezone
+		if len(args) == 0 {
+			return nil, fmt.Errorf("date() requires a style or layout argument")
+		}
+		tzName := ""
+		if len(args) > 1 {
+			tzName = toString(args[1])
+		}
+		tz, err := r.location(tzName)
+		if err != nil {
+			return nil, fmt.Errorf("date(): %w", err)
+		}
+		loc, err := r.locale()
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(timeNow().In(tz), toString(args[0]), loc), nil
+
+	case "format_date":
+		// format_date("long"), format_date("date", "2024-03-15"), or
+		// format_date("datetime", "2024-03-15T08:00:00Z", "Asia/Tokyo")
+		if len(args) == 0 {
+			return nil, fmt.Errorf("format_date() requires a style or layout argument")
+		}
+		tzName := ""
+		if len(args) > 2 {
+			tzName = toString(args[2])
+		}
+		tz, err := r.location(tzName)
+		if err != nil {
+			return nil, fmt.Errorf("format_date(): %w", err)
+		}
+		t := timeNow()
+		if len(args) > 1 {
+			if t, err = parseTime(args[1], tz); err != nil {
+				return nil, fmt.Errorf("format_date(): %w", err)
+			}
+		}
+		loc, err := r.locale()
+		if err != nil {
+			return nil, err
+		}
+		return formatTime(t.In(tz), toString(args[0]), loc), nil
+
+	case "format_number":
+		// format_number(1234.5) or format_number(1234.5, 2)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("format_number() requires a number argument")
+		}
+		n, ok := toFloat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("format_number(): %v is not a number", args[0])
+		}
+		decimals := -1
+		if len(args) > 1 {
+			if decimals, ok = toInt(args[1]); !ok {
+				return nil, fmt.Errorf("format_number(): decimals must be a number")
+			}
+		}
+		loc, err := r.locale()
+		if err != nil {
+			return nil, err
+		}
+		if loc == nil {
+			loc = locales["en-us"]
+		}
+		return loc.FormatNumber(n, decimals), nil
+
+	case "translate":
+		// translate(text) into the active locale, or translate(text, "fr")
+		if len(args) == 0 {
+			return nil, fmt.Errorf("translate() requires a text argument")
+		}
+		if r.ctx.Runtime == nil {
+			return toString(args[0]), nil
+		}
+		target := ""
+		if len(args) > 1 {
+			target = toString(args[1])
+		}
+		return r.ctx.Runtime.translate(r.ctx, toString(args[0]), target)
+
 	case "step":
 		// step("name") returns a step result object with output, tokens, etc.
 		if len(args) > 0 {
@@ -682,7 +1006,8 @@ func (r *Resolver) resolveObject(obj ast.ObjectValue) (interface{}, error) {
 	return result, nil
 }
 
-// resolveComparison resolves a comparison expression.
+// resolveComparison resolves a comparison expression with the coercion
+// rules of compareValues.
 func (r *Resolver) resolveComparison(cmp ast.ComparisonValue) (interface{}, error) {
 	left, err := r.Resolve(cmp.Left)
 	if err != nil {
@@ -694,46 +1019,68 @@ func (r *Resolver) resolveComparison(cmp ast.ComparisonValue) (interface{}, erro
 		return nil, err
 	}
 
-	// Try numeric comparison first
-	if leftNum, ok := toFloat(left); ok {
-		if rightNum, ok := toFloat(right); ok {
-			switch cmp.Operator {
-			case "==":
-				return leftNum == rightNum, nil
-			case "!=":
-				return leftNum != rightNum, nil
-			case "<":
-				return leftNum < rightNum, nil
-			case ">":
-				return leftNum > rightNum, nil
-			case "<=":
-				return leftNum <= rightNum, nil
-			case ">=":
-				return leftNum >= rightNum, nil
-			}
-		}
-	}
-
-	// Fall back to string comparison
-	leftStr := toString(left)
-	rightStr := toString(right)
-
-	switch cmp.Operator {
-	case "==":
-		return leftStr == rightStr, nil
-	case "!=":
-		return leftStr != rightStr, nil
-	case "<":
-		return leftStr < rightStr, nil
-	case ">":
-		return leftStr > rightStr, nil
-	case "<=":
-		return leftStr <= rightStr, nil
-	case ">=":
-		return leftStr >= rightStr, nil
+	return compareValues(cmp.Operator, left, right)
+}
+
+// resolveArithmetic resolves an arithmetic expression with the coercion
+// rules of applyArithmetic.
+func (r *Resolver) resolveArithmetic(expr ast.ArithmeticValue) (interface{}, error) {
+	left, err := r.Resolve(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := r.Resolve(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyArithmetic(expr.Operator, left, right)
+}
+
+// resolveLogical resolves && and ||. The right operand is only resolved if
+// the left one does not decide the result.
+func (r *Resolver) resolveLogical(expr ast.LogicalValue) (interface{}, error) {
+	left, err := r.resolveCondition(expr.Left, expr.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	switch expr.Operator {
+	case "&&":
+		if !left {
+			return false, nil
+		}
+	case "||":
+		if left {
+			return true, nil
+		}
 	default:
-		return nil, fmt.Errorf("unknown comparison operator: %s", cmp.Operator)
+		return nil, fmt.Errorf("unknown logical operator: %s", expr.Operator)
+	}
+
+	return r.resolveCondition(expr.Right, expr.Operator)
+}
+
+// resolveCondition resolves an operand of a logical operator, which must be
+// a bool: the text "true" is a string, so compare it instead, e.g.
+// env("DEBUG") == "true".
+func (r *Resolver) resolveCondition(val ast.Value, op string) (bool, error) {
+	resolved, err := r.Resolve(val)
+	if err != nil {
+		return false, err
+	}
+	return conditionValue(resolved, op)
+}
+
+// conditionValue returns a resolved operand of a logical operator, which
+// must be a bool.
+func conditionValue(v interface{}, op string) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
 	}
+	o := coerceOperand(v)
+	return false, fmt.Errorf("cannot apply %s to %s %s", op, kindNames[o.kind], o)
 }
 
 // toFloat converts a value to float64 if possible.
@@ -792,28 +1139,113 @@ func getNestedValue(obj interface{}, path []string) (interface{}, error) {
 	return current, nil
 }
 
-// formatDate formats a date component.
-func formatDate(format string) (string, error) {
-	now := timeNow()
+// getPath is getNestedValue with optional chaining: where optional[i] is
+// true, a null value or a missing path[i] makes the result null instead of
+// an error.
+func getPath(obj interface{}, path []string, optional []bool) (interface{}, error) {
+	current := obj
+	for i := range path {
+		val, err := getNestedValue(current, path[i:i+1])
+		if err != nil {
+			if optional[i] {
+				return nil, nil
+			}
+			return nil, err
+		}
+		current = val
+	}
+	return current, nil
+}
+
+// optionalPath returns the optional chaining flags of a path, one per
+// element; the parser leaves them nil if no access is optional.
+func optionalPath(path []string, optional []bool) []bool {
+	flags := make([]bool, len(path))
+	copy(flags, optional)
+	return flags
+}
+
+// splitPath splits an interpolated path such as step.x?.output into its
+// base, elements, and optional chaining flags.
+func splitPath(expr string) (base string, path []string, optional []bool) {
+	parts := strings.Split(expr, ".")
+	base = strings.TrimSuffix(parts[0], "?")
+	optional = make([]bool, len(parts)-1)
+	for i, part := range parts[1:] {
+		optional[i] = strings.HasSuffix(parts[i], "?")
+		path = append(path, strings.TrimSuffix(part, "?"))
+	}
+	return base, path, optional
+}
+
+// locale returns the runtime's active locale, or nil for the defaults.
+func (r *Resolver) locale() (*Locale, error) {
+	if r.ctx.Runtime == nil {
+		return nil, nil
+	}
+	return r.ctx.Runtime.Locale()
+}
+
+// location returns the named timezone, or the runtime's default timezone
+// if name is empty.
+func (r *Resolver) location(name string) (*time.Location, error) {
+	if name == "" && r.ctx.Runtime != nil {
+		name = r.ctx.Runtime.Timezone()
+	}
+	return loadLocation(name)
+}
+
+// formatDate formats a date component of the current time in tz. With a
+// locale, the date, time, datetime, and long styles and custom layouts
+// follow the locale's conventions; otherwise dates use ISO formats.
+func formatDate(format string, loc *Locale, tz *time.Location) (string, error) {
+	return formatTime(timeNow().In(tz), format, loc), nil
+}
 
+// formatTime formats t like formatDate.
+func formatTime(t time.Time, format string, loc *Locale) string {
 	switch format {
-	case "date":
-		return now.Format("2006-01-02"), nil
-	case "time":
-		return now.Format("15:04:05"), nil
-	case "datetime":
-		return now.Format("2006-01-02T15:04:05"), nil
 	case "year":
-		return now.Format("2006"), nil
+		return t.Format("2006")
 	case "month":
-		return now.Format("01"), nil
+		return t.Format("01")
 	case "day":
-		return now.Format("02"), nil
+		return t.Format("02")
 	case "timestamp":
-		return fmt.Sprintf("%d", now.Unix()), nil
+		return fmt.Sprintf("%d", t.Unix())
+	}
+
+	if loc != nil {
+		return loc.FormatDate(t, format)
+	}
+
+	switch format {
+	case "date":
+		return t.Format("2006-01-02")
+	case "time":
+		return t.Format("15:04:05")
+	case "datetime":
+		return t.Format("2006-01-02T15:04:05")
+	case "long":
+		return t.Format("January 2, 2006")
 	default:
-		return now.Format(format), nil
+		return t.Format(format)
+	}
+}
+
+// parseTime parses a date argument: a Unix timestamp, an RFC 3339 time, or
+// a date like "2024-03-15". Times without an offset are in tz.
+func parseTime(v interface{}, tz *time.Location) (time.Time, error) {
+	if n, ok := v.(float64); ok {
+		return time.Unix(int64(n), 0), nil
+	}
+	s := toString(v)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, tz); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("cannot parse date %q", s)
 }
 
 // Git integration helpers
@@ -948,6 +1380,14 @@ func (wr *WorkspaceResolver) GetMCP(name string) (ast.Entity, error) {
 	return entity, nil
 }
 
+func (wr *WorkspaceResolver) GetPrompt(name string) (ast.Entity, error) {
+	entity, found := wr.ws.GetEntityByName("prompt", name)
+	if !found {
+		return nil, fmt.Errorf("prompt not found: %s", name)
+	}
+	return entity, nil
+}
+
 func (wr *WorkspaceResolver) GetScript(name string) (ast.Entity, error) {
 	entity, found := wr.ws.GetEntityByName("script", name)
 	if !found {
@@ -1,7 +1,12 @@
 package runtime
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
 	"github.com/shellkjell/langspace/pkg/workspace"
@@ -164,3 +169,512 @@ func TestResolver_MethodCalls(t *testing.T) {
 		})
 	}
 }
+
+func TestResolver_Comparison(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{},
+		StepOutputs: map[string]interface{}{
+			"count":   "10\n",
+			"elapsed": "90s",
+		},
+	}
+	resolver := NewResolver(ctx)
+	step := func(name string) ast.Value {
+		return ast.MethodCallValue{
+			Object:    ast.FunctionCallValue{Function: "step", Arguments: []ast.Value{ast.StringValue{Value: name}}},
+			Method:    "output",
+			Arguments: []ast.Value{},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		value   ast.ComparisonValue
+		want    bool
+		wantErr bool
+	}{
+		{"numeric output", ast.ComparisonValue{Left: step("count"), Operator: ">", Right: ast.NumberValue{Value: 5}}, true, false},
+		{"numeric strings", ast.ComparisonValue{Left: ast.StringValue{Value: "10"}, Operator: "<", Right: ast.StringValue{Value: "9"}}, false, false},
+		{"durations", ast.ComparisonValue{Left: step("elapsed"), Operator: ">", Right: ast.StringValue{Value: "1m"}}, true, false},
+		{"strings", ast.ComparisonValue{Left: ast.StringValue{Value: "apple"}, Operator: "<", Right: ast.StringValue{Value: "banana"}}, true, false},
+		{"string equality", ast.ComparisonValue{Left: ast.StringValue{Value: "bug"}, Operator: "==", Right: ast.StringValue{Value: "bug"}}, true, false},
+		{"mixed equality", ast.ComparisonValue{Left: ast.NumberValue{Value: 5}, Operator: "==", Right: ast.StringValue{Value: "five"}}, false, false},
+		{"bools", ast.ComparisonValue{Left: ast.BoolValue{Value: true}, Operator: "!=", Right: ast.BoolValue{Value: false}}, true, false},
+		{"ordering mixed kinds", ast.ComparisonValue{Left: ast.StringValue{Value: "10 apples"}, Operator: ">", Right: ast.NumberValue{Value: 5}}, false, true},
+		{"ordering number and duration", ast.ComparisonValue{Left: ast.NumberValue{Value: 90}, Operator: ">", Right: ast.StringValue{Value: "1m"}}, false, true},
+		{"ordering bools", ast.ComparisonValue{Left: ast.BoolValue{Value: true}, Operator: ">", Right: ast.BoolValue{Value: false}}, false, true},
+		{"null equality", ast.ComparisonValue{Left: ast.NullValue{}, Operator: "==", Right: ast.NullValue{}}, true, false},
+		{"null is not empty", ast.ComparisonValue{Left: ast.NullValue{}, Operator: "==", Right: ast.StringValue{Value: ""}}, false, false},
+		{"ordering null", ast.ComparisonValue{Left: ast.NullValue{}, Operator: "<", Right: ast.NumberValue{Value: 1}}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyArithmetic(t *testing.T) {
+	tests := []struct {
+		op          string
+		left, right interface{}
+		want        interface{}
+		wantErr     bool
+	}{
+		{"+", 2.0, "3", 5.0, false},
+		{"-", "10", 4, 6.0, false},
+		{"*", 2.5, 2.0, 5.0, false},
+		{"/", "9", "3", 3.0, false},
+		{"%", 7.0, 4.0, 3.0, false},
+		{"/", 1.0, 0.0, nil, true},
+		{"+", "1m", "30s", 90 * time.Second, false},
+		{"-", time.Minute, "15s", 45 * time.Second, false},
+		{"*", "30s", 2.0, time.Minute, false},
+		{"*", 3.0, "1s", 3 * time.Second, false},
+		{"/", "1m", 4.0, 15 * time.Second, false},
+		{"/", "1m", "30s", 2.0, false},
+		{"+", "report-", 2.0, "report-2", false},
+		{"-", "abc", 1.0, nil, true},
+		{"+", "1m", 5.0, nil, true},
+		{"^", 1.0, 2.0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v %s %v", tt.left, tt.op, tt.right), func(t *testing.T) {
+			got, err := applyArithmetic(tt.op, tt.left, tt.right)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyArithmetic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("applyArithmetic() = %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_Expressions(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{
+			"attempt": 3,
+			"done":    false,
+			"budget":  "2m",
+		},
+		StepOutputs: map[string]interface{}{
+			"count": "4",
+		},
+	}
+	resolver := NewResolver(ctx)
+
+	tests := []struct {
+		expr    string
+		want    interface{}
+		wantErr bool
+	}{
+		{`step("count").output * 2 + 1`, float64(9), false},
+		{`step("count").output * (2 + 1)`, float64(12), false},
+		{`10 - 4 - 3`, float64(3), false},
+		{`$budget / 4`, 30 * time.Second, false},
+		{`$attempt + 1 > 3 && !$done`, true, false},
+		{`$attempt > 5 || step("count").output >= 4`, true, false},
+		{`!($attempt == 3 || $done)`, false, false},
+		{`$done && step("missing").output`, false, false},
+		{`!$done || step("missing").output`, true, false},
+		{`$attempt / 0`, nil, true},
+		{`"true" && true`, nil, true},
+		{`!$attempt`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			entities := parseSource(t, "step \"s\" {\n\tvalue: "+tt.expr+"\n}")
+			v, _ := entities[0].GetProperty("value")
+			got, err := resolver.Resolve(v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Resolve() = %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_InterpolateOperators(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{
+			"budget": "2m",
+		},
+		StepOutputs: map[string]interface{}{
+			"count":      "4",
+			"fetch-data": "3",
+		},
+	}
+	resolver := NewResolver(ctx)
+
+	tests := map[string]string{
+		"{{step.count * 2 + 1}}":           "9",
+		"{{step.count - step.fetch-data}}": "1",
+		"{{$budget / 4}}":                  "30s",
+		"{{step.count > 10}}":              "false",
+		`{{"a  b" + step.count}}`:          "a  b4",
+		"{{step.fetch-data}}":              "3",
+	}
+	for input, want := range tests {
+		got, err := resolver.interpolateString(input)
+		if err != nil {
+			t.Errorf("interpolate %s: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("interpolate %s = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestResolver_IncludePrompts(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `prompt "tone" {
+	text: "Be {{$tone}}."
+}
+
+prompt "style-guide" {
+	text: `+"```Use short sentences. {{include \"tone\"}}```"+`
+}
+
+prompt "a" {
+	text: "{{include 'b'}}"
+}
+
+prompt "b" {
+	text: "{{include 'a'}}"
+}
+`))
+	ctx := &ExecutionContext{
+		Workspace: ws,
+		Variables: map[string]interface{}{"tone": "friendly"},
+	}
+	resolver := NewResolver(ctx)
+
+	got, err := resolver.interpolateString(`You review code. {{include "style-guide"}} {{ include 'tone' | quote }}`)
+	if err != nil {
+		t.Fatalf("interpolate: %v", err)
+	}
+	if want := `You review code. Use short sentences. Be friendly. "Be friendly."`; got != want {
+		t.Errorf("interpolate = %q, want %q", got, want)
+	}
+
+	for input, want := range map[string]string{
+		`{{include "missing"}}`: "prompt not found: missing",
+		`{{include "a"}}`:       "circular prompt include: a -> b -> a",
+	} {
+		if _, err := resolver.interpolateString(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("interpolate %s: expected error containing %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestResolver_OptionalChaining(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{
+			"params": map[string]interface{}{"region": "eu"},
+		},
+		StepOutputs: map[string]interface{}{
+			"classify": map[string]interface{}{"type": "bug"},
+		},
+	}
+	resolver := NewResolver(ctx)
+	ref := func(name string, path []string, optional []bool) ast.ReferenceValue {
+		return ast.ReferenceValue{Type: "step", Name: name, Path: path, Optional: optional}
+	}
+
+	tests := []struct {
+		name    string
+		value   ast.Value
+		want    interface{}
+		wantErr bool
+	}{
+		{"missing step", ref("summarize", []string{"output"}, []bool{true}), nil, false},
+		{"missing property", ref("classify", []string{"output", "summary"}, []bool{false, true}), nil, false},
+		{"present property", ref("classify", []string{"output", "type"}, []bool{false, true}), "bug", false},
+		{"required step", ref("summarize", []string{"output", "summary"}, []bool{false, true}), nil, true},
+		{"required property", ref("classify", []string{"output", "summary"}, nil), nil, true},
+		{"optional parameter", ast.PropertyAccessValue{Base: "params", Path: []string{"limit"}, Optional: []bool{true}}, nil, false},
+		{"default", ast.CoalesceValue{Left: ref("summarize", []string{"output"}, []bool{true}), Right: ast.StringValue{Value: "none"}}, "none", false},
+		{"default unused", ast.CoalesceValue{Left: ref("classify", []string{"output", "type"}, nil), Right: ast.StringValue{Value: "none"}}, "bug", false},
+		{"default keeps errors", ast.CoalesceValue{Left: ref("summarize", []string{"output"}, nil), Right: ast.StringValue{Value: "none"}}, nil, true},
+		{"null", ast.NullValue{}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	interpolations := map[string]string{
+		`{{step.summarize?.output ?? "none"}}`:        "none",
+		`{{step.classify?.summary ?? "none"}}`:        "none",
+		`{{step.classify.type ?? "none"}}`:            "bug",
+		`{{step.classify?.summary}}`:                  "",
+		`{{params?.limit ?? 10}}`:                     "10",
+		`{{step.classify?.summary == null}}`:          "true",
+		`{{step.summarize?.output ?? params.region}}`: "eu",
+	}
+	for input, want := range interpolations {
+		got, err := resolver.interpolateString(input)
+		if err != nil {
+			t.Errorf("interpolate %s: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("interpolate %s = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestResolver_ListFunctions(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{},
+		StepOutputs: map[string]interface{}{
+			"review": []interface{}{
+				map[string]interface{}{"file": "a.go", "severity": "high", "summary": "nil deref"},
+				map[string]interface{}{"file": "b.go", "severity": "low", "summary": "typo"},
+				map[string]interface{}{"file": "c.go", "severity": "high", "summary": "race"},
+			},
+			"tags": `["go", "review"]`,
+		},
+	}
+	resolver := NewResolver(ctx)
+
+	parse := func(expr string) ast.Value {
+		t.Helper()
+		entities := parseSource(t, "step \"s\" {\n\tvalue: "+expr+"\n}")
+		v, _ := entities[0].GetProperty("value")
+		return v
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "map property",
+			expr: `join(map(step("review").output, $item.file), ", ")`,
+			want: "a.go, b.go, c.go",
+		},
+		{
+			name: "map template",
+			expr: `join(map(step("review").output, "{{index}}. {{item.file}}: {{item.summary}}"))`,
+			want: "0. a.go: nil deref\n1. b.go: typo\n2. c.go: race",
+		},
+		{
+			name: "filter",
+			expr: `join(map(filter(step("review").output, $item.severity == "high"), $item.summary), "; ")`,
+			want: "nil deref; race",
+		},
+		{
+			name: "JSON text",
+			expr: `join(step("tags").output, " + ")`,
+			want: "go + review",
+		},
+		{
+			name: "missing optional list",
+			expr: `join(map(step("missing")?.output, $item.file))`,
+			want: "",
+		},
+		{
+			name:    "filter condition",
+			expr:    `filter(step("review").output, $item.file)`,
+			wantErr: "condition must be true or false",
+		},
+		{
+			name:    "not a list",
+			expr:    `map("plain text", $item)`,
+			wantErr: "expected a list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(parse(tt.expr))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := ctx.GetVariable("item"); ok {
+		t.Error("expected $item to be scoped to the expression")
+	}
+}
+
+func TestResolver_RegexFunctions(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{},
+		StepOutputs: map[string]interface{}{
+			"classify": "Sure! Here is the result:\n```\nSEVERITY: high (score 8/10)\n```",
+		},
+	}
+	resolver := NewResolver(ctx)
+	resolve := func(expr string) (interface{}, error) {
+		t.Helper()
+		entities := parseSource(t, "step \"s\" {\n\tvalue: "+expr+"\n}")
+		v, _ := entities[0].GetProperty("value")
+		return resolver.Resolve(v)
+	}
+
+	got, err := resolve(`regex_match(step("classify").output, "SEVERITY: (high|critical)")`)
+	if err != nil || got != true {
+		t.Errorf("regex_match = %v, %v; want true", got, err)
+	}
+
+	got, err = resolve(`regex_extract(step("classify").output, "SEVERITY: (?P<level>\w+) \(score (?P<score>\d+)/10\)( urgent)?")`)
+	if err != nil {
+		t.Fatalf("regex_extract: %v", err)
+	}
+	groups := got.(map[string]interface{})
+	if groups["level"] != "high" || groups["score"] != "8" || groups["3"] != nil {
+		t.Errorf("regex_extract = %v, want level high, score 8 and no group 3", groups)
+	}
+
+	got, err = resolve(`regex_extract(step("classify").output, "PRIORITY: (?P<level>\w+)")?.level ?? "none"`)
+	if err != nil || got != "none" {
+		t.Errorf("regex_extract without a match = %v, %v; want none", got, err)
+	}
+
+	got, err = resolve("regex_replace(step(\"classify\").output, \"(?s)^.*```\\n(.*)\\n```$\", \"$1\")")
+	if err != nil || got != "SEVERITY: high (score 8/10)" {
+		t.Errorf("regex_replace = %q, %v", got, err)
+	}
+
+	if _, err := resolve(`regex_match("text", "(unclosed")`); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+}
+
+func TestResolver_Query(t *testing.T) {
+	ctx := &ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: map[string]interface{}{
+			"report": map[string]interface{}{"summary": "ok", "count": 2},
+		},
+		StepOutputs: map[string]interface{}{
+			"review": `{"items": [{"title": "SQL injection", "severity": "high"}, {"title": "Typo", "severity": "low"}]}`,
+		},
+	}
+	resolver := NewResolver(ctx)
+	resolve := func(expr string) (interface{}, error) {
+		t.Helper()
+		entities := parseSource(t, "step \"s\" {\n\tvalue: "+expr+"\n}")
+		v, _ := entities[0].GetProperty("value")
+		return resolver.Resolve(v)
+	}
+
+	got, err := resolve(`query(step("review").output, "$.items[?(@.severity=='high')].title")`)
+	if err != nil {
+		t.Fatalf("query with filter: %v", err)
+	}
+	if titles, ok := got.([]interface{}); !ok || len(titles) != 1 || titles[0] != "SQL injection" {
+		t.Errorf("query with filter = %#v, want [SQL injection]", got)
+	}
+
+	got, err = resolve(`query(step("review").output, "$.items[?(@.severity=='critical')]")`)
+	if titles, ok := got.([]interface{}); err != nil || !ok || len(titles) != 0 {
+		t.Errorf("query without matches = %#v, %v; want an empty list", got, err)
+	}
+
+	got, err = resolve(`query(step("review").output, "$.items[0].title")`)
+	if err != nil || got != "SQL injection" {
+		t.Errorf("definite query = %v, %v; want SQL injection", got, err)
+	}
+
+	got, err = resolve(`query($report, "$.count")`)
+	if err != nil || got != float64(2) {
+		t.Errorf("query over a variable = %#v, %v; want 2", got, err)
+	}
+
+	got, err = resolve(`query(step("review").output, "$.summary") ?? "none"`)
+	if err != nil || got != "none" {
+		t.Errorf("missing definite query = %v, %v; want none", got, err)
+	}
+
+	if _, err := resolve(`query(step("review").output, "items[0]")`); err == nil || !strings.Contains(err.Error(), "invalid JSONPath") {
+		t.Errorf("expected an invalid path error, got %v", err)
+	}
+	if _, err := resolve(`query("not json", "$.a")`); err == nil || !strings.Contains(err.Error(), "not JSON") {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+}
+
+func TestResolver_FileGlobPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "pkg", "main.go"), []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewResolver(&ExecutionContext{Workspace: workspace.New(), Variables: make(map[string]interface{})})
+
+	// Patterns use forward slashes on every platform, and so do the paths
+	// that come back
+	got, err := resolver.resolveFileReference(filepath.ToSlash(dir) + "/src/*/*.go")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	files, _ := got.([]FileContent)
+	want := filepath.ToSlash(dir) + "/src/pkg/main.go"
+	if len(files) != 1 || files[0].Path != want || files[0].Content != "package main" {
+		t.Errorf("expected %s, got %+v", want, got)
+	}
+
+	content, err := resolver.resolveFileReference(filepath.ToSlash(dir) + "/src/pkg/main.go")
+	if err != nil || content != "package main" {
+		t.Errorf("expected the file content, got %v, %v", content, err)
+	}
+}
+
+func TestResolver_KnowsRequiredFunctions(t *testing.T) {
+	// Bundles record the functions they call, and loading checks them
+	// against workspace.Features, so every function listed there resolves
+	resolver := NewResolver(&ExecutionContext{Workspace: workspace.New(), Variables: map[string]interface{}{}})
+	for _, f := range workspace.Features() {
+		name, ok := strings.CutPrefix(f, "function:")
+		if !ok {
+			continue
+		}
+		if _, err := resolver.Resolve(ast.FunctionCallValue{Function: name}); err != nil && strings.Contains(err.Error(), "unknown function") {
+			t.Errorf("workspace.Features() lists %s(), which the resolver does not know", name)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package runtime
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResponseCache stores model responses keyed by what determines them: the
+// model, the system prompt and messages, the tool schemas, and the sampling
+// settings. Identical prompts from different steps, pipelines, or
+// executions call the model once. Unlike the step cache it needs no opt-in
+// per step, so it suits deduplicating calls rather than skipping work.
+//
+// Entries expire after the TTL, and the least recently used entry is
+// evicted once the cache holds its maximum. Only successful responses are
+// cached.
+//
+// Example:
+//
+//	rt := runtime.New(ws, runtime.WithResponseCache(runtime.NewResponseCache(time.Hour, 1000)))
+//	result, _ := rt.Execute(ctx, pipeline)
+//	fmt.Println(result.ResponseCache.Hits, result.ResponseCache.Misses)
+type ResponseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // most recently used first
+	now        func() time.Time
+}
+
+// responseCacheEntry is a cached response.
+type responseCacheEntry struct {
+	key       string
+	response  CompletionResponse
+	expiresAt time.Time
+}
+
+// NewResponseCache creates a response cache whose entries expire after ttl
+// (zero for never) and that holds at most maxEntries (zero for no limit).
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// WithResponseCache caches model responses in cache. Share a cache between
+// runtimes to deduplicate calls across them.
+func WithResponseCache(cache *ResponseCache) Option {
+	return func(r *Runtime) {
+		r.responseCache = cache
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet
+// evicted.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// get returns a copy of the response cached under key, if present and not
+// expired.
+func (c *ResponseCache) get(key string) (*CompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !entry.expiresAt.IsZero() && c.now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	resp := entry.response
+	resp.ToolCalls = append([]ToolCall(nil), entry.response.ToolCalls...)
+	return &resp, true
+}
+
+// set caches resp under key, evicting the least recently used entries over
+// the limit.
+func (c *ResponseCache) set(key string, resp *CompletionResponse) {
+	entry := &responseCacheEntry{key: key, response: *resp}
+	entry.response.ToolCalls = append([]ToolCall(nil), resp.ToolCalls...)
+	if c.ttl > 0 {
+		entry.expiresAt = c.now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// responseCacheKey hashes the parts of a request that determine the
+// response. Metadata, which only tags the request, is left out except for
+// the sample index of self-consistency sampling, whose identical requests
+// are meant to get different answers.
+func responseCacheKey(req *CompletionRequest) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	// Encoding errors can't happen for these types; maps are sorted by key
+	_ = enc.Encode(struct {
+		Model           string           `json:"model"`
+		SystemPrompt    string           `json:"system_prompt"`
+		Messages        []Message        `json:"messages"`
+		Tools           []ToolDefinition `json:"tools"`
+		Temperature     float64          `json:"temperature"`
+		Seed            *int             `json:"seed"`
+		MaxTokens       int              `json:"max_tokens"`
+		StopSequences   []string         `json:"stop_sequences"`
+		ReasoningBudget int              `json:"reasoning_budget"`
+		Sample          string           `json:"sample,omitempty"`
+	}{req.Model, req.SystemPrompt, req.Messages, req.Tools, req.Temperature, req.Seed, req.MaxTokens, req.StopSequences, req.ReasoningBudget, req.Metadata[sampleMetadataKey]})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ResponseCacheStats counts an execution's lookups in the response cache.
+type ResponseCacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// responseCacheCounter accumulates an execution's cache lookups.
+type responseCacheCounter struct {
+	hits, misses atomic.Int64
+}
+
+// responseCacheCounterKey is the context key of the responseCacheCounter
+// that lookups are counted in.
+type responseCacheCounterKey struct{}
+
+func withResponseCacheCounter(ctx context.Context, c *responseCacheCounter) context.Context {
+	return context.WithValue(ctx, responseCacheCounterKey{}, c)
+}
+
+// countResponseCacheLookup counts a hit or miss in the context's counter, if
+// any.
+func countResponseCacheLookup(ctx context.Context, hit bool) {
+	c, ok := ctx.Value(responseCacheCounterKey{}).(*responseCacheCounter)
+	if !ok {
+		return
+	}
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// Stats returns the lookups counted so far.
+func (c *responseCacheCounter) Stats() *ResponseCacheStats {
+	return &ResponseCacheStats{Hits: int(c.hits.Load()), Misses: int(c.misses.Load())}
+}
+
+// cachedProvider answers requests from a ResponseCache when it can.
+type cachedProvider struct {
+	LLMProvider
+	cache   *ResponseCache
+	metrics *Metrics
+}
+
+// cacheResponses wraps p so its responses are cached, if a response cache
+// is configured.
+func (r *Runtime) cacheResponses(p LLMProvider) LLMProvider {
+	if r.responseCache == nil {
+		return p
+	}
+	return &cachedProvider{LLMProvider: p, cache: r.responseCache, metrics: r.metrics}
+}
+
+// lookup returns the cached response for req. Hits use no tokens.
+func (p *cachedProvider) lookup(ctx context.Context, key string) (*CompletionResponse, bool) {
+	resp, ok := p.cache.get(key)
+	countResponseCacheLookup(ctx, ok)
+	p.metrics.countCacheLookup("response", ok)
+	if ok {
+		resp.Usage = TokenUsage{}
+	}
+	return resp, ok
+}
+
+// store caches a successful response.
+func (p *cachedProvider) store(key string, resp *CompletionResponse, err error) {
+	if err != nil || resp == nil || resp.FinishReason == FinishReasonError || resp.FinishReason == FinishReasonCancelled {
+		return
+	}
+	p.cache.set(key, resp)
+}
+
+// Complete returns a cached response or sends the request.
+func (p *cachedProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	key := responseCacheKey(req)
+	if resp, ok := p.lookup(ctx, key); ok {
+		return resp, nil
+	}
+	resp, err := p.LLMProvider.Complete(ctx, req)
+	p.store(key, resp, err)
+	return resp, err
+}
+
+// CompleteStream replays a cached response to handler as a single chunk, or
+// streams the request.
+func (p *cachedProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	key := responseCacheKey(req)
+	if resp, ok := p.lookup(ctx, key); ok {
+		replayResponse(resp, handler)
+		return resp, nil
+	}
+	resp, err := p.LLMProvider.CompleteStream(ctx, req, handler)
+	p.store(key, resp, err)
+	return resp, err
+}
@@ -0,0 +1,178 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestResponseCacheKey(t *testing.T) {
+	base := CompletionRequest{
+		Model:       "mock-model",
+		Messages:    []Message{{Role: RoleUser, Content: "hi"}},
+		Temperature: 0.2,
+		Metadata:    map[string]string{"step": "a"},
+	}
+	same := base
+	same.Metadata = map[string]string{"step": "b"}
+	if responseCacheKey(&base) != responseCacheKey(&same) {
+		t.Error("expected metadata not to affect the key")
+	}
+
+	for name, change := range map[string]func(*CompletionRequest){
+		"sample":      func(r *CompletionRequest) { r.Metadata = map[string]string{sampleMetadataKey: "1"} },
+		"model":       func(r *CompletionRequest) { r.Model = "other" },
+		"messages":    func(r *CompletionRequest) { r.Messages = []Message{{Role: RoleUser, Content: "hello"}} },
+		"temperature": func(r *CompletionRequest) { r.Temperature = 0.9 },
+		"tools": func(r *CompletionRequest) {
+			r.Tools = []ToolDefinition{{Name: "search", Parameters: map[string]interface{}{"type": "object"}}}
+		},
+	} {
+		changed := base
+		change(&changed)
+		if responseCacheKey(&base) == responseCacheKey(&changed) {
+			t.Errorf("expected %s to change the key", name)
+		}
+	}
+}
+
+func TestResponseCache_Eviction(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewResponseCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+
+	cache.set("a", &CompletionResponse{Content: "A"})
+	cache.set("b", &CompletionResponse{Content: "B"})
+	cache.get("a") // b is now the least recently used
+	cache.set("c", &CompletionResponse{Content: "C"})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if resp, ok := cache.get("a"); !ok || resp.Content != "A" {
+		t.Errorf("get(a) = %v, %v", resp, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.get("c"); ok {
+		t.Error("expected an expired entry to be missing")
+	}
+	if n := cache.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1 after dropping the expired entry", n)
+	}
+}
+
+func TestExecute_ResponseCache(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+	temperature: 0
+}
+
+intent "summarize" {
+	use: agent("writer")
+	input: "Summarize the release notes"
+}
+
+pipeline "release" {
+	step "notes" {
+		use: agent("writer")
+		input: "Summarize the release notes"
+	}
+}
+`))
+	provider := NewMockProvider(WithMockResponses(MockResponse{
+		Content:      "Bug fixes",
+		FinishReason: FinishReasonStop,
+		Usage:        TokenUsage{InputTokens: 10, OutputTokens: 2, TotalTokens: 12},
+	}))
+	rt := New(ws, WithProvider("mock", provider), WithResponseCache(NewResponseCache(time.Hour, 10)), WithConfig(&Config{EnableStreaming: true}))
+	intent, _ := ws.GetEntityByName("intent", "summarize")
+	pipeline, _ := ws.GetEntityByName("pipeline", "release")
+
+	first, err := rt.Execute(context.Background(), intent)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if first.ResponseCache == nil || first.ResponseCache.Hits != 0 || first.ResponseCache.Misses != 1 {
+		t.Errorf("expected one miss, got %+v", first.ResponseCache)
+	}
+
+	handler := &BufferedStreamHandler{}
+	second, err := rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if second.ResponseCache == nil || second.ResponseCache.Hits != 1 || second.ResponseCache.Misses != 0 {
+		t.Errorf("expected one hit, got %+v", second.ResponseCache)
+	}
+	if n := len(provider.GetRequests()); n != 1 {
+		t.Errorf("expected the identical prompt to call the model once, got %d calls", n)
+	}
+	if out := second.StepResults["notes"].Output; out != "Bug fixes" {
+		t.Errorf("expected the cached output, got %v", out)
+	}
+	if chunks := handler.Chunks; len(chunks) != 1 || chunks[0].Content != "Bug fixes" {
+		t.Errorf("expected the cached response to be replayed to the stream, got %+v", chunks)
+	}
+	if second.TokensUsed.TotalTokens != 0 {
+		t.Errorf("expected a cache hit to use no tokens, got %+v", second.TokensUsed)
+	}
+}
+
+func TestExecute_ResponseCacheSampling(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "solver" {
+	model: "mock-model"
+	temperature: 0.8
+}
+
+pipeline "vote" {
+	step "answer" {
+		use: agent("solver")
+		prompt: "What is 6 * 7?"
+		samples: 3
+	}
+}
+`))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "41", FinishReason: FinishReasonStop},
+		MockResponse{Content: "42", FinishReason: FinishReasonStop},
+		MockResponse{Content: "43", FinishReason: FinishReasonStop},
+	))
+	rt := New(ws, WithProvider("mock", provider), WithResponseCache(NewResponseCache(time.Hour, 10)))
+	pipeline, _ := ws.GetEntityByName("pipeline", "vote")
+
+	// Each sample is a separate model call
+	first, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	answers := make(map[string]bool)
+	for _, s := range first.StepResults["answer"].Samples {
+		answers[s.Content] = true
+	}
+	if len(answers) != 3 || len(provider.GetRequests()) != 3 {
+		t.Errorf("expected 3 distinct samples from 3 calls, got %v from %d calls", answers, len(provider.GetRequests()))
+	}
+
+	// and is cached under its own index
+	second, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if second.ResponseCache == nil || second.ResponseCache.Hits != 3 || len(provider.GetRequests()) != 3 {
+		t.Errorf("expected every sample from the cache, got %+v", second.ResponseCache)
+	}
+	cached := make(map[string]bool)
+	for _, s := range second.StepResults["answer"].Samples {
+		cached[s.Content] = true
+	}
+	if len(cached) != 3 {
+		t.Errorf("expected the cached samples to stay distinct, got %v", cached)
+	}
+}
@@ -0,0 +1,207 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecute_PipelineStepRetry(t *testing.T) {
+	source := `
+agent "caller" {
+	model: "mock-model"
+}
+
+pipeline "flaky" {
+	step "call" {
+		use: agent("caller")
+		retry {
+			max: 2
+			backoff: "constant"
+			delay: "1ms"
+			on: ["rate_limit"]
+		}
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Error: &APIError{StatusCode: 429, Body: "slow down"}},
+		MockResponse{Error: &APIError{StatusCode: 429, Body: "slow down"}},
+		MockResponse{Content: "ok"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "flaky")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if result.Output != "ok" {
+		t.Errorf("expected output 'ok', got %v", result.Output)
+	}
+	if got := result.StepResults["call"].Attempts; got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestExecute_PipelineStepRetryNotMatched(t *testing.T) {
+	source := `
+agent "caller" {
+	model: "mock-model"
+}
+
+pipeline "flaky" {
+	step "call" {
+		use: agent("caller")
+		retry {
+			max: 3
+			delay: "1ms"
+			on: ["timeout"]
+		}
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Error: &APIError{StatusCode: 400, Body: "bad request"}},
+		MockResponse{Content: "ok"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "flaky")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err == nil {
+		t.Fatal("expected non-retryable error to fail the pipeline")
+	}
+	if got := result.StepResults["call"].Attempts; got != 1 {
+		t.Errorf("expected 1 attempt, got %d", got)
+	}
+}
+
+func TestExecute_PipelineStepRetryStreamed(t *testing.T) {
+	source := `
+agent "caller" {
+	model: "mock-model"
+}
+
+pipeline "flaky" {
+	step "call" {
+		use: agent("caller")
+		retry {
+			max: 2
+			delay: "1ms"
+		}
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	// A stream that fails before its first chunk is retried
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Error: &APIError{StatusCode: 503}},
+		MockResponse{Content: "ok"},
+	))
+	rt := New(ws, WithProvider("mock", provider), WithConfig(&Config{EnableStreaming: true}))
+	pipeline, _ := ws.GetEntityByName("pipeline", "flaky")
+
+	handler := &BufferedStreamHandler{}
+	result, err := rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if got := result.StepResults["call"].Attempts; got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+	if handler.Err != nil {
+		t.Errorf("expected the retried error to be held back from the handler, got %v", handler.Err)
+	}
+
+	// A stream that fails after sending part of its answer is not, since a
+	// retry would send that part again
+	partial := partialStreamProvider{NewMockProvider()}
+	rt = New(ws, WithProvider("mock", partial), WithConfig(&Config{EnableStreaming: true}))
+
+	handler = &BufferedStreamHandler{}
+	result, err = rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 502 {
+		t.Fatalf("expected the provider's error, got %v", err)
+	}
+	if got := result.StepResults["call"].Attempts; got != 1 {
+		t.Errorf("expected 1 attempt, got %d", got)
+	}
+	if got := len(partial.GetRequests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+	if len(handler.Chunks) != 1 {
+		t.Errorf("expected the partial answer once, got %d chunks", len(handler.Chunks))
+	}
+	if handler.Err == nil || !errors.Is(err, handler.Err) {
+		t.Errorf("expected the handler to get the error, got %v", handler.Err)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"rate limit status", &APIError{StatusCode: 429}, ErrorClassRateLimit},
+		{"server error status", &APIError{StatusCode: 503}, ErrorClassServerError},
+		{"gateway timeout", &APIError{StatusCode: 504}, ErrorClassTimeout},
+		{"client error", &APIError{StatusCode: 400}, ErrorClassOther},
+		{"wrapped api error", fmt.Errorf("step failed: %w", &APIError{StatusCode: 429}), ErrorClassRateLimit},
+		{"deadline", context.DeadlineExceeded, ErrorClassTimeout},
+		{"message", errors.New("request timed out"), ErrorClassTimeout},
+		{"unknown", errors.New("boom"), ErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		backoff string
+		attempt int
+		want    time.Duration
+	}{
+		{"constant", 3, 100 * time.Millisecond},
+		{"linear", 3, 300 * time.Millisecond},
+		{"exponential", 1, 100 * time.Millisecond},
+		{"exponential", 3, 400 * time.Millisecond},
+		{"exponential", 12, maxRetryDelay},
+		{"exponential", 100, maxRetryDelay},
+		{"linear", 1 << 40, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s_%d", tt.backoff, tt.attempt), func(t *testing.T) {
+			policy := &ast.RetryValue{Backoff: tt.backoff, Delay: "100ms"}
+			if got := retryDelay(policy, tt.attempt); got != tt.want {
+				t.Errorf("retryDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	// A policy built without the parser falls back to the default delay
+	if got := retryDelay(&ast.RetryValue{Delay: "soon"}, 1); got != defaultRetryDelay {
+		t.Errorf("retryDelay() = %s, want %s", got, defaultRetryDelay)
+	}
+}
@@ -0,0 +1,334 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RolloutVersion identifies which workspace version handled an execution.
+type RolloutVersion string
+
+const (
+	RolloutStable RolloutVersion = "stable"
+	RolloutCanary RolloutVersion = "canary"
+)
+
+// RolloutStats summarizes executions handled by one version.
+type RolloutStats struct {
+	Runs          int           `json:"runs"`
+	Failures      int           `json:"failures"`
+	ErrorRate     float64       `json:"error_rate"`
+	TokensUsed    TokenUsage    `json:"tokens_used"`
+	Cost          float64       `json:"cost"`
+	AvgCost       float64       `json:"avg_cost"`
+	TotalDuration time.Duration `json:"total_duration"`
+	AvgDuration   time.Duration `json:"avg_duration"`
+}
+
+func (s *RolloutStats) record(result *ExecutionResult, err error, duration time.Duration) {
+	s.Runs++
+	if err != nil || result == nil || !result.Success {
+		s.Failures++
+	}
+	if result != nil {
+		s.TokensUsed.Add(result.TokensUsed)
+		s.Cost += ExecutionCost(result)
+	}
+	s.TotalDuration += duration
+
+	s.ErrorRate = float64(s.Failures) / float64(s.Runs)
+	s.AvgCost = s.Cost / float64(s.Runs)
+	s.AvgDuration = s.TotalDuration / time.Duration(s.Runs)
+}
+
+// RolloutStatus is a snapshot of a rollout for comparing the two versions.
+type RolloutStatus struct {
+	// Active reports whether a canary version is receiving traffic
+	Active bool `json:"active"`
+
+	// Standby reports whether a second version is loaded, with or without
+	// traffic
+	Standby bool         `json:"standby"`
+	Percent float64      `json:"percent"`
+	Stable  RolloutStats `json:"stable"`
+	Canary  RolloutStats `json:"canary"`
+
+	// ErrorRateDelta and AvgCostDelta are canary minus stable
+	ErrorRateDelta float64 `json:"error_rate_delta"`
+	AvgCostDelta   float64 `json:"avg_cost_delta"`
+}
+
+// Rollout routes executions between a stable runtime and a canary runtime
+// loaded from a new workspace version. A configurable percentage of
+// executions go to the canary; the rest use the stable version. Results are
+// tracked per version so the canary can be promoted or rolled back.
+//
+// For blue/green deploys, load the new version with no traffic
+// (StartCanary(rt, 0)) and Switch to it; the previous version stays loaded
+// so a second Switch rolls back instantly.
+type Rollout struct {
+	stable  *Runtime
+	canary  *Runtime
+	percent float64
+	stats   map[RolloutVersion]*RolloutStats
+	random  func() float64
+	mu      sync.RWMutex
+
+	// running counts the executions in progress on each runtime; retired
+	// runtimes no longer receive executions and are closed once theirs finish
+	running map[*Runtime]int
+	retired map[*Runtime]bool
+}
+
+// NewRollout creates a rollout serving all executions from the stable runtime.
+func NewRollout(stable *Runtime) *Rollout {
+	return &Rollout{
+		stable: stable,
+		stats: map[RolloutVersion]*RolloutStats{
+			RolloutStable: {},
+			RolloutCanary: {},
+		},
+		random:  rand.Float64,
+		running: make(map[*Runtime]int),
+		retired: make(map[*Runtime]bool),
+	}
+}
+
+// StartCanary begins sending percent (0-100) of executions to canary,
+// replacing any canary already in progress, which is closed once the
+// executions running on it finish. Statistics are reset.
+func (ro *Rollout) StartCanary(canary *Runtime, percent float64) error {
+	if canary == nil {
+		return fmt.Errorf("canary runtime is required")
+	}
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100, got %v", percent)
+	}
+
+	ro.mu.Lock()
+	previous := ro.canary
+	ro.canary = canary
+	ro.percent = percent
+	delete(ro.retired, canary)
+	ro.resetStats()
+	idle := previous != nil && previous != canary && ro.retire(previous)
+	ro.mu.Unlock()
+
+	if idle {
+		return previous.Close()
+	}
+	return nil
+}
+
+// SetPercent changes the share of executions sent to the canary.
+func (ro *Rollout) SetPercent(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100, got %v", percent)
+	}
+
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	if ro.canary == nil {
+		return fmt.Errorf("no canary rollout in progress")
+	}
+	ro.percent = percent
+	return nil
+}
+
+// Promote makes the canary the stable version and ends the rollout. The
+// previous stable version is closed once the executions running on it
+// finish.
+func (ro *Rollout) Promote() error {
+	ro.mu.Lock()
+	if ro.canary == nil {
+		ro.mu.Unlock()
+		return fmt.Errorf("no canary rollout in progress")
+	}
+	previous := ro.stable
+	ro.stable = ro.canary
+	ro.canary = nil
+	ro.percent = 0
+	ro.resetStats()
+	idle := ro.retire(previous)
+	ro.mu.Unlock()
+
+	if idle {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Switch atomically swaps the two loaded versions: the canary serves all new
+// executions and the previous stable version is kept warm as a canary with
+// no traffic. Executions already running finish on the version they started
+// on. Statistics are reset.
+func (ro *Rollout) Switch() error {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	if ro.canary == nil {
+		return fmt.Errorf("no standby version loaded")
+	}
+	ro.stable, ro.canary = ro.canary, ro.stable
+	ro.percent = 0
+	ro.resetStats()
+	return nil
+}
+
+// Rollback discards the canary and sends all executions to the stable
+// version. The canary is closed once the executions running on it finish.
+func (ro *Rollout) Rollback() error {
+	ro.mu.Lock()
+	if ro.canary == nil {
+		ro.mu.Unlock()
+		return fmt.Errorf("no canary rollout in progress")
+	}
+	canary := ro.canary
+	ro.canary = nil
+	ro.percent = 0
+	ro.resetStats()
+	idle := ro.retire(canary)
+	ro.mu.Unlock()
+
+	if idle {
+		return canary.Close()
+	}
+	return nil
+}
+
+// Replace makes rt the stable version, e.g. after the workspace files were
+// edited, and closes the previous one. A canary in progress is kept.
+// Executions already running finish on the version they started on; the
+// previous version is closed once they do.
+func (ro *Rollout) Replace(rt *Runtime) error {
+	if rt == nil {
+		return fmt.Errorf("runtime is required")
+	}
+
+	ro.mu.Lock()
+	previous := ro.stable
+	ro.stable = rt
+	delete(ro.retired, rt)
+	ro.stats[RolloutStable] = &RolloutStats{}
+	idle := previous != nil && previous != rt && ro.retire(previous)
+	ro.mu.Unlock()
+
+	if idle {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Stable returns the current stable runtime.
+func (ro *Rollout) Stable() *Runtime {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+	return ro.stable
+}
+
+// Canary returns the canary or standby runtime, or nil if none is loaded.
+func (ro *Rollout) Canary() *Runtime {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+	return ro.canary
+}
+
+// Status returns per-version statistics for the current rollout.
+func (ro *Rollout) Status() RolloutStatus {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+
+	status := RolloutStatus{
+		Active:  ro.canary != nil && ro.percent > 0,
+		Standby: ro.canary != nil,
+		Percent: ro.percent,
+		Stable:  *ro.stats[RolloutStable],
+		Canary:  *ro.stats[RolloutCanary],
+	}
+	if status.Stable.Runs > 0 && status.Canary.Runs > 0 {
+		status.ErrorRateDelta = status.Canary.ErrorRate - status.Stable.ErrorRate
+		status.AvgCostDelta = status.Canary.AvgCost - status.Stable.AvgCost
+	}
+	return status
+}
+
+// Select picks the runtime for the next execution.
+func (ro *Rollout) Select() (*Runtime, RolloutVersion) {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+	return ro.selectLocked()
+}
+
+// selectLocked must be called with lock held.
+func (ro *Rollout) selectLocked() (*Runtime, RolloutVersion) {
+	if ro.canary != nil && ro.random()*100 < ro.percent {
+		return ro.canary, RolloutCanary
+	}
+	return ro.stable, RolloutStable
+}
+
+// ExecuteByName runs the named entity on the stable or canary runtime and
+// records the outcome for that version. The result's metadata includes the
+// version under "rollout_version".
+func (ro *Rollout) ExecuteByName(ctx context.Context, entityType, entityName string, opts ...ExecuteOption) (*ExecutionResult, error) {
+	ro.mu.Lock()
+	rt, version := ro.selectLocked()
+	ro.running[rt]++
+	ro.mu.Unlock()
+
+	start := time.Now()
+	result, err := rt.ExecuteByName(ctx, entityType, entityName, opts...)
+	duration := time.Since(start)
+
+	ro.mu.Lock()
+	// Ignore results that finished after a promotion or rollback
+	if (version == RolloutStable && rt == ro.stable) || (version == RolloutCanary && rt == ro.canary) {
+		ro.stats[version].record(result, err, duration)
+	}
+	ro.running[rt]--
+	idle := ro.running[rt] == 0
+	if idle {
+		delete(ro.running, rt)
+	}
+	closing := idle && ro.retired[rt]
+	if closing {
+		delete(ro.retired, rt)
+	}
+	ro.mu.Unlock()
+
+	// The last execution on a version that was replaced, promoted over or
+	// rolled back closes it
+	if closing {
+		if err := rt.Close(); err != nil {
+			logAt(withLogger(ctx, rt.logger), slog.LevelWarn, "failed to close retired runtime", "error", err)
+		}
+	}
+
+	if result != nil {
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]string)
+		}
+		result.Metadata["rollout_version"] = string(version)
+	}
+	return result, err
+}
+
+// retire marks rt, which no longer receives executions, to be closed when
+// the executions running on it finish, and reports whether none are, in
+// which case the caller closes it. It must be called with lock held.
+func (ro *Rollout) retire(rt *Runtime) bool {
+	if ro.running[rt] > 0 {
+		ro.retired[rt] = true
+		return false
+	}
+	return true
+}
+
+// resetStats must be called with lock held.
+func (ro *Rollout) resetStats() {
+	ro.stats[RolloutStable] = &RolloutStats{}
+	ro.stats[RolloutCanary] = &RolloutStats{}
+}
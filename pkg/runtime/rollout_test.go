@@ -0,0 +1,308 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func newRolloutRuntime(t *testing.T, model string, resp MockResponse) *Runtime {
+	t.Helper()
+	source := `
+agent "helper" {
+	model: "` + model + `"
+}
+
+intent "ask" {
+	use: agent("helper")
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	return New(ws, WithProvider("mock", NewMockProvider(WithMockResponses(resp))))
+}
+
+func TestRollout(t *testing.T) {
+	stable := newRolloutRuntime(t, "mock-model", MockResponse{Content: "ok", FinishReason: FinishReasonStop})
+	canary := newRolloutRuntime(t, "mock-model", MockResponse{Error: errors.New("canary broke")})
+
+	ro := NewRollout(stable)
+	if _, version := ro.Select(); version != RolloutStable {
+		t.Fatalf("expected stable without a canary, got %s", version)
+	}
+	if err := ro.Promote(); err == nil {
+		t.Error("expected error promoting without a canary")
+	}
+
+	if err := ro.StartCanary(canary, 150); err == nil {
+		t.Error("expected error for percent above 100")
+	}
+	if err := ro.StartCanary(canary, 50); err != nil {
+		t.Fatalf("StartCanary error: %v", err)
+	}
+
+	// Alternate between the canary (< 50%) and stable
+	rolls := []float64{0.1, 0.9}
+	n := 0
+	ro.random = func() float64 {
+		n++
+		return rolls[n%2]
+	}
+
+	for i := 0; i < 4; i++ {
+		result, _ := ro.ExecuteByName(context.Background(), "intent", "ask")
+		if result == nil {
+			continue
+		}
+		if v := result.Metadata["rollout_version"]; v != string(RolloutStable) && v != string(RolloutCanary) {
+			t.Errorf("expected rollout version in metadata, got %q", v)
+		}
+	}
+
+	status := ro.Status()
+	if !status.Active || status.Percent != 50 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.Stable.Runs != 2 || status.Canary.Runs != 2 {
+		t.Fatalf("expected 2 runs per version, got stable=%d canary=%d", status.Stable.Runs, status.Canary.Runs)
+	}
+	if status.Stable.ErrorRate != 0 || status.Canary.ErrorRate != 1 || status.ErrorRateDelta != 1 {
+		t.Errorf("unexpected error rates: %+v", status)
+	}
+
+	if err := ro.SetPercent(10); err != nil {
+		t.Fatalf("SetPercent error: %v", err)
+	}
+	if err := ro.Rollback(); err != nil {
+		t.Fatalf("Rollback error: %v", err)
+	}
+	if rt, _ := ro.Select(); rt != stable {
+		t.Error("expected stable runtime after rollback")
+	}
+	if ro.Status().Canary.Runs != 0 {
+		t.Error("expected stats to reset after rollback")
+	}
+
+	if err := ro.StartCanary(canary, 100); err != nil {
+		t.Fatalf("StartCanary error: %v", err)
+	}
+	if err := ro.Promote(); err != nil {
+		t.Fatalf("Promote error: %v", err)
+	}
+	if ro.Stable() != canary || ro.Status().Active {
+		t.Error("expected canary to become stable after promotion")
+	}
+}
+
+func TestRollout_Switch(t *testing.T) {
+	blue := newRolloutRuntime(t, "mock-model", MockResponse{Content: "blue", FinishReason: FinishReasonStop})
+	green := newRolloutRuntime(t, "mock-model", MockResponse{Content: "green", FinishReason: FinishReasonStop})
+
+	ro := NewRollout(blue)
+	if err := ro.Switch(); err == nil {
+		t.Error("expected error switching without a standby version")
+	}
+
+	// Load green side by side with no traffic
+	if err := ro.StartCanary(green, 0); err != nil {
+		t.Fatalf("StartCanary error: %v", err)
+	}
+	if status := ro.Status(); status.Active || !status.Standby {
+		t.Errorf("expected an idle standby version, got %+v", status)
+	}
+	if ro.Canary() != green {
+		t.Error("expected green to be the standby runtime")
+	}
+	if rt, _ := ro.Select(); rt != blue {
+		t.Error("expected blue to serve before switching")
+	}
+
+	if err := ro.Switch(); err != nil {
+		t.Fatalf("Switch error: %v", err)
+	}
+	result, err := ro.ExecuteByName(context.Background(), "intent", "ask")
+	if err != nil {
+		t.Fatalf("ExecuteByName error: %v", err)
+	}
+	if result.Output != "green" || result.Metadata["rollout_version"] != string(RolloutStable) {
+		t.Errorf("expected green to serve as stable, got %v (%s)", result.Output, result.Metadata["rollout_version"])
+	}
+	if !ro.Status().Standby {
+		t.Error("expected blue to stay loaded after switching")
+	}
+
+	// Switching again rolls back to blue
+	if err := ro.Switch(); err != nil {
+		t.Fatalf("Switch error: %v", err)
+	}
+	if ro.Stable() != blue {
+		t.Error("expected blue to serve after switching back")
+	}
+	if ro.Status().Stable.Runs != 0 {
+		t.Error("expected stats to reset after switching")
+	}
+}
+
+// blockingProvider answers once release is closed, after sending on started.
+type blockingProvider struct {
+	*MockProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p blockingProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return p.MockProvider.Complete(ctx, req)
+}
+
+func (p blockingProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return p.MockProvider.CompleteStream(ctx, req, handler)
+}
+
+// closeRecorder is an MCP client that records being closed.
+type closeRecorder struct {
+	closed chan struct{}
+}
+
+func (c *closeRecorder) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (c *closeRecorder) ListTools(ctx context.Context) ([]ToolDefinition, error) {
+	return nil, nil
+}
+
+func (c *closeRecorder) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// newBlockingRuntime returns a runtime whose executions answer content once
+// provider.release is closed, with an MCP client that records being closed.
+func newBlockingRuntime(t *testing.T, content string) (*Runtime, blockingProvider, *closeRecorder) {
+	t.Helper()
+	provider := blockingProvider{
+		MockProvider: NewMockProvider(WithMockResponses(MockResponse{Content: content, FinishReason: FinishReasonStop})),
+		started:      make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	rt := newRolloutRuntime(t, "mock-model", MockResponse{})
+	rt.providers["mock"] = provider
+	client := &closeRecorder{closed: make(chan struct{})}
+	rt.mcpClients["files"] = client
+	return rt, provider, client
+}
+
+// executeAsync runs the intent on ro, returning its result on the channel.
+func executeAsync(ro *Rollout) <-chan *ExecutionResult {
+	done := make(chan *ExecutionResult)
+	go func() {
+		result, _ := ro.ExecuteByName(context.Background(), "intent", "ask")
+		done <- result
+	}()
+	return done
+}
+
+func TestRollout_ReplaceDrains(t *testing.T) {
+	old, provider, client := newBlockingRuntime(t, "old")
+	ro := NewRollout(old)
+	done := executeAsync(ro)
+	<-provider.started
+
+	// The running execution keeps the old version open
+	if err := ro.Replace(newRolloutRuntime(t, "mock-model", MockResponse{Content: "new", FinishReason: FinishReasonStop})); err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	select {
+	case <-client.closed:
+		t.Fatal("expected the old version to stay open while an execution runs on it")
+	default:
+	}
+
+	close(provider.release)
+	if result := <-done; result == nil || result.Output != "old" {
+		t.Errorf("expected the execution to finish on the old version, got %+v", result)
+	}
+	select {
+	case <-client.closed:
+	default:
+		t.Error("expected the old version to close once its execution finished")
+	}
+}
+
+func TestRollout_RollbackAndPromoteDrain(t *testing.T) {
+	ro := NewRollout(newRolloutRuntime(t, "mock-model", MockResponse{Content: "stable", FinishReason: FinishReasonStop}))
+
+	// A canary rolled back mid-execution stays open until it finishes
+	canary, provider, client := newBlockingRuntime(t, "canary")
+	if err := ro.StartCanary(canary, 100); err != nil {
+		t.Fatalf("StartCanary error: %v", err)
+	}
+	done := executeAsync(ro)
+	<-provider.started
+	if err := ro.Rollback(); err != nil {
+		t.Fatalf("Rollback error: %v", err)
+	}
+	select {
+	case <-client.closed:
+		t.Fatal("expected the canary to stay open while an execution runs on it")
+	default:
+	}
+	close(provider.release)
+	if result := <-done; result == nil || result.Output != "canary" {
+		t.Errorf("expected the execution to finish on the canary, got %+v", result)
+	}
+	select {
+	case <-client.closed:
+	default:
+		t.Error("expected the canary to close once its execution finished")
+	}
+
+	// So does a stable version promoted over mid-execution
+	stable, provider, client := newBlockingRuntime(t, "stable")
+	if err := ro.Replace(stable); err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	done = executeAsync(ro)
+	<-provider.started
+	if err := ro.StartCanary(newRolloutRuntime(t, "mock-model", MockResponse{Content: "new", FinishReason: FinishReasonStop}), 0); err != nil {
+		t.Fatalf("StartCanary error: %v", err)
+	}
+	if err := ro.Promote(); err != nil {
+		t.Fatalf("Promote error: %v", err)
+	}
+	select {
+	case <-client.closed:
+		t.Fatal("expected the previous stable version to stay open while an execution runs on it")
+	default:
+	}
+	close(provider.release)
+	<-done
+	select {
+	case <-client.closed:
+	default:
+		t.Error("expected the previous stable version to close once its execution finished")
+	}
+}
+
+func TestExecutionCost(t *testing.T) {
+	usage := TokenUsage{InputTokens: 1_000_000, OutputTokens: 1_000_000}
+
+	intent := &ExecutionResult{TokensUsed: usage, Metadata: map[string]string{"model": "gpt-4o"}}
+	if got := ExecutionCost(intent); got != 12.5 {
+		t.Errorf("expected intent cost 12.5, got %v", got)
+	}
+
+	pipeline := &ExecutionResult{StepResults: map[string]*StepResult{
+		"a": {Model: "claude-sonnet-4-20250514", TokensUsed: usage},
+		"b": {Model: "unknown-model", TokensUsed: usage},
+	}}
+	if got := ExecutionCost(pipeline); got != 18 {
+		t.Errorf("expected pipeline cost 18, got %v", got)
+	}
+}
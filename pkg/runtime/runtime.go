@@ -5,11 +5,15 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/workspace"
 )
 
@@ -21,7 +25,60 @@ type Runtime struct {
 	mcpClients   map[string]MCPClient
 	defaultModel string
 	config       *Config
+	toolMetrics  *ToolMetrics
+	toolHandlers map[string]ToolHandler
+	auditLog     AuditLog
+	stepCache    StepCache
+	translations map[string]string
+	tracer       Tracer
 	mu           sync.RWMutex
+
+	moderator        Moderator
+	moderationPolicy ModerationPolicy
+
+	// providerTypes and modelRoutes record the providers declared by
+	// provider entities (see ConfigureProviders)
+	providerTypes map[string]string // provider name -> type
+	modelRoutes   map[string]string // model -> provider name
+
+	// rateLimiters and providerMetrics apply per provider instance, keyed
+	// by the name the provider is registered under
+	rateLimiters    map[string]*rateLimiter
+	providerMetrics *ProviderMetrics
+
+	// snapshotStore receives step snapshots (see WithSnapshotStore)
+	snapshotStore SnapshotStore
+
+	// runHistory records every execution (see WithRunHistory)
+	runHistory RunHistory
+
+	// sessions holds the sessions of ExecuteInSession (see WithSessionStore)
+	sessions SessionStore
+
+	// scheduler limits concurrent executions (see WithScheduler)
+	scheduler *Scheduler
+
+	// responseCache deduplicates model calls (see WithResponseCache)
+	responseCache *ResponseCache
+
+	// logger receives log entries (see WithLogger)
+	logger Logger
+
+	// deterministic makes executions repeatable (see WithDeterministic)
+	deterministic bool
+
+	// contextWindow fits file() inputs to context windows (see
+	// WithContextWindow)
+	contextWindow *ContextWindowConfig
+
+	// cassette records or replays model calls (see WithCassette)
+	cassette *Cassette
+
+	// middleware wraps every pipeline step (see Use)
+	middleware []Middleware
+
+	// metrics counts what the runtime does (see WithMetrics)
+	metrics *Metrics
 }
 
 // Config holds runtime configuration options.
@@ -41,14 +98,63 @@ type Config struct {
 	// EnableStreaming enables streaming responses by default
 	EnableStreaming bool `json:"enable_streaming"`
 
+	// RedactReasoning drops model thinking content from stream output, step
+	// results, and step outputs visible to downstream steps
+	RedactReasoning bool `json:"redact_reasoning"`
+
+	// TaintPolicy flags untrusted step outputs and tool results flowing into
+	// shell, SQL, and URL tool arguments (see TaintPolicy)
+	TaintPolicy TaintPolicy `json:"taint_policy"`
+
+	// Locale selects date and number formatting and the target language of
+	// translate(), overriding the config entity's `locale` (e.g. "de-DE")
+	Locale string `json:"locale"`
+
+	// Timezone is the IANA timezone for dates and for cron triggers without
+	// their own, overriding the config entity's `timezone` (default: local time)
+	Timezone string `json:"timezone"`
+
+	// WorkDirRoot is the directory each run's working directory is created
+	// in (default: the system temp directory)
+	WorkDirRoot string `json:"workdir_root"`
+
+	// RetainWorkDir keeps the working directories of finished runs instead
+	// of removing them
+	RetainWorkDir WorkDirRetention `json:"retain_workdir"`
+
+	// HeartbeatInterval is how often a running execution sends a
+	// ProgressTypeHeartbeat event to its stream handler (default: never)
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+
+	// StallTimeout is how long an execution may stream no chunks and no
+	// progress events before it counts as stalled (default: never)
+	StallTimeout time.Duration `json:"stall_timeout"`
+
+	// StallAction is what happens to a stalled execution: StallWarn reports
+	// it, StallAbort also stops it
+	StallAction StallAction `json:"stall_action"`
+
+	// LogLevel is the least severe level the default logger writes (see
+	// WithLogger), e.g. slog.LevelDebug to log every step (default: info)
+	LogLevel slog.Level `json:"log_level"`
+
+	// RateLimits limit provider instances by the name they are registered
+	// under, overriding `requests_per_minute` and `tokens_per_minute` in the
+	// workspace
+	RateLimits map[string]RateLimit `json:"rate_limits,omitempty"`
+
 	// Environment variables (can be overridden)
 	Environment map[string]string `json:"environment"`
 }
 
+// DefaultModel is the model of agents that name none, unless the Config
+// sets another.
+const DefaultModel = "claude-sonnet-4-20250514"
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		DefaultModel:    "claude-sonnet-4-20250514",
+		DefaultModel:    DefaultModel,
 		DefaultProvider: "anthropic",
 		Timeout:         5 * time.Minute,
 		MaxRetries:      3,
@@ -60,16 +166,27 @@ func DefaultConfig() *Config {
 // New creates a new Runtime with the given workspace.
 func New(ws *workspace.Workspace, opts ...Option) *Runtime {
 	r := &Runtime{
-		workspace:    ws,
-		providers:    make(map[string]LLMProvider),
-		mcpClients:   make(map[string]MCPClient),
-		config:       DefaultConfig(),
-		defaultModel: "claude-sonnet-4-20250514",
+		workspace:     ws,
+		providers:     make(map[string]LLMProvider),
+		mcpClients:    make(map[string]MCPClient),
+		providerTypes: make(map[string]string),
+		modelRoutes:   make(map[string]string),
+		rateLimiters:  make(map[string]*rateLimiter),
+		toolHandlers:  make(map[string]ToolHandler),
+		translations:  make(map[string]string),
+		config:        DefaultConfig(),
+		defaultModel:  DefaultModel,
+		toolMetrics:   NewToolMetrics(DefaultToolHistorySize),
+		tracer:        noopTracer{},
+		sessions:      NewMemorySessionStore(),
 	}
 
 	for _, opt := range opts {
 		opt(r)
 	}
+	if r.logger == nil {
+		r.logger = defaultLogger(r.config)
+	}
 
 	return r
 }
@@ -111,6 +228,50 @@ func (r *Runtime) GetProvider(name string) (LLMProvider, bool) {
 	return p, ok
 }
 
+// Workspace returns the workspace the runtime executes.
+func (r *Runtime) Workspace() *workspace.Workspace {
+	return r.workspace
+}
+
+// WithToolHandler registers a Go function as the handler for a tool.
+func WithToolHandler(name string, handler ToolHandler) Option {
+	return func(r *Runtime) {
+		r.toolHandlers[name] = handler
+	}
+}
+
+// RegisterToolHandler registers a Go function as the handler for a tool.
+// Registered handlers take precedence over a tool's command, function or handler
+// property, and let agents use the tool without declaring it in the workspace.
+func (r *Runtime) RegisterToolHandler(name string, handler ToolHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toolHandlers[name] = handler
+}
+
+// getToolHandler returns the registered handler for a tool, if any.
+func (r *Runtime) getToolHandler(name string) (ToolHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.toolHandlers[name]
+	return h, ok
+}
+
+// ToolMetrics returns the recorder of tool invocations made by this runtime.
+func (r *Runtime) ToolMetrics() *ToolMetrics {
+	return r.toolMetrics
+}
+
+// ToolReport returns per-tool usage statistics, listing workspace tools that
+// have never been called as unused.
+func (r *Runtime) ToolReport() ToolReport {
+	var declared []string
+	for _, e := range r.workspace.GetEntitiesByType("tool") {
+		declared = append(declared, e.Name())
+	}
+	return r.toolMetrics.Report(declared...)
+}
+
 // getMCPClient returns an MCP client for the given MCP server name.
 func (r *Runtime) getMCPClient(name string) (MCPClient, error) {
 	r.mu.Lock()
@@ -147,7 +308,18 @@ func (r *Runtime) getMCPClient(name string) (MCPClient, error) {
 		}
 	}
 
-	client, err := NewStdioMCPClient(command.Value, args...)
+	var env []string
+	if envProp, ok := mcpEntity.GetProperty("env"); ok {
+		if obj, ok := envProp.(ast.ObjectValue); ok {
+			for key, val := range obj.Properties {
+				if sv, ok := val.(ast.StringValue); ok {
+					env = append(env, key+"="+sv.Value)
+				}
+			}
+		}
+	}
+
+	client, err := NewStdioMCPClientWithEnv(command.Value, args, env)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start MCP server %q: %w", name, err)
 	}
@@ -156,8 +328,26 @@ func (r *Runtime) getMCPClient(name string) (MCPClient, error) {
 	return client, nil
 }
 
-// Execute runs an entity (intent or pipeline) and returns the result.
-func (r *Runtime) Execute(ctx context.Context, entity ast.Entity, opts ...ExecuteOption) (*ExecutionResult, error) {
+// Close stops all MCP servers started by the runtime.
+func (r *Runtime) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for name, client := range r.mcpClients {
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close MCP server %q: %w", name, err)
+		}
+		delete(r.mcpClients, name)
+	}
+	return firstErr
+}
+
+// Execute runs an entity (intent or pipeline) and returns the result. Each
+// execution gets its own working directory, available as $workdir, that
+// tools and scripts run in and write_file() writes relative paths to. It is
+// removed when the execution finishes unless Config.RetainWorkDir keeps it.
+func (r *Runtime) Execute(ctx context.Context, entity ast.Entity, opts ...ExecuteOption) (result *ExecutionResult, err error) {
 	execOpts := &executeOptions{
 		input:    nil,
 		handler:  nil,
@@ -169,6 +359,43 @@ func (r *Runtime) Execute(ctx context.Context, entity ast.Entity, opts ...Execut
 		opt(execOpts)
 	}
 
+	// A pinned execution runs the published version instead
+	if execOpts.version != "" {
+		published, found := r.workspace.GetPublishedVersion(entity.Type(), entity.Name(), execOpts.version)
+		if !found {
+			err = fmt.Errorf("%s %q version %s is not published", entity.Type(), entity.Name(), execOpts.version)
+			return &ExecutionResult{Error: err}, err
+		}
+		entity = published
+	}
+
+	// Log entries of the execution carry its run ID and entity
+	startTime := time.Now()
+	runID := newRunID(startTime)
+	ctx = withLogAttrs(withLogger(ctx, r.logger), slog.String("run_id", runID), slog.String(entity.Type(), entity.Name()))
+	logAt(ctx, slog.LevelDebug, "execution started")
+	defer func() {
+		failure := err
+		if failure == nil && result != nil {
+			failure = result.Error
+		}
+		if failure != nil {
+			logAt(ctx, slog.LevelDebug, "execution failed", "duration", time.Since(startTime), "error", failure)
+		} else {
+			logAt(ctx, slog.LevelDebug, "execution finished", "duration", time.Since(startTime))
+		}
+		r.metrics.countExecution(entity, failure)
+	}()
+
+	workDir, err := r.createWorkDir()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		r.releaseWorkDir(ctx, workDir, err != nil || result == nil || !result.Success)
+	}()
+	ctx = context.WithValue(ctx, workDirKey{}, workDir)
+
 	// Create execution context
 	execCtx := &ExecutionContext{
 		Context:   ctx,
@@ -177,29 +404,179 @@ func (r *Runtime) Execute(ctx context.Context, entity ast.Entity, opts ...Execut
 		Variables: make(map[string]interface{}),
 		Metadata:  execOpts.metadata,
 		Handler:   execOpts.handler,
-		StartTime: time.Now(),
+		StartTime: startTime,
+		RunID:     runID,
+		WorkDir:   workDir,
+
+		entityType: entity.Type(),
+		entityName: entity.Name(),
+		inspector:  execOpts.inspect,
+		session:    execOpts.session,
+		matrix:     execOpts.matrix,
+		debugger:   execOpts.debugger,
+	}
+	if r.config.TaintPolicy != TaintOff {
+		execCtx.Taint = NewTaintTracker()
 	}
 
 	// Set input variable if provided
 	if execOpts.input != nil {
 		execCtx.Variables["input"] = execOpts.input
 	}
+	execCtx.Variables["workdir"] = workDir
+	if execCtx.matrix != nil {
+		values := make(map[string]interface{}, len(execCtx.matrix))
+		for _, s := range execCtx.matrix {
+			values[s.Dimension] = s.Value
+		}
+		execCtx.Variables["matrix"] = values
+	}
+
+	// Params are checked before anything runs
+	params, err := bindParams(entity, execOpts.params, NewResolver(execCtx))
+	if err != nil {
+		return &ExecutionResult{Error: err}, err
+	}
+	if params != nil {
+		execCtx.Variables["params"] = params
+	}
+
+	// An inspector, the stall detector, or the scheduler stops the execution
+	// by cancelling its context
+	if execCtx.inspector != nil || r.config.StallTimeout > 0 || r.scheduler != nil {
+		execCtx.Context, execCtx.stop = context.WithCancelCause(execCtx.Context)
+		defer execCtx.stop(nil)
+	}
+
+	// Executions wait for a slot, unless they were started by one that has
+	// a slot already
+	if _, nested := scheduledRunFromContext(ctx); r.scheduler != nil && !nested {
+		priority, _, err := entityPriority(entity)
+		if err != nil {
+			return &ExecutionResult{Error: err}, err
+		}
+		if execOpts.priority != nil {
+			priority = *execOpts.priority
+		}
+		run, err := r.scheduler.acquire(execCtx.Context, priority, execCtx.stop)
+		if err != nil {
+			return &ExecutionResult{Error: err}, err
+		}
+		defer r.scheduler.release(run)
+		execCtx.Context = context.WithValue(execCtx.Context, scheduledRunKey{}, run)
+	}
 
-	// Apply timeout
+	// The timeout starts once the execution has a slot
 	if execOpts.timeout > 0 {
 		var cancel context.CancelFunc
-		execCtx.Context, cancel = context.WithTimeout(ctx, execOpts.timeout)
+		execCtx.Context, cancel = context.WithTimeout(execCtx.Context, execOpts.timeout)
 		defer cancel()
 	}
 
-	// Dispatch based on entity type
+	// Heartbeats and stall detection watch what the execution streams
+	if r.config.HeartbeatInterval > 0 || r.config.StallTimeout > 0 {
+		monitor := newLivenessMonitor(execCtx.Handler, fmt.Sprintf("%s %q", entity.Type(), entity.Name()), r.config, execCtx.stop)
+		execCtx.Handler = monitor
+		execCtx.liveness = monitor
+		defer monitor.start(execCtx.Context)()
+	}
+
+	var cacheLookups *responseCacheCounter
+	if r.responseCache != nil {
+		cacheLookups = &responseCacheCounter{}
+		execCtx.Context = withResponseCacheCounter(execCtx.Context, cacheLookups)
+	}
+
+	var nondeterminism *nondeterminismLog
+	if r.deterministic {
+		nondeterminism = &nondeterminismLog{}
+		execCtx.Context = withNondeterminismLog(execCtx.Context, nondeterminism)
+	}
+
+	var contextWarnings *contextLog
+	if r.contextWindow != nil {
+		contextWarnings = &contextLog{}
+		execCtx.Context = withContextLog(execCtx.Context, contextWarnings)
+	}
+
+	var span Span
+	execCtx.Context, span = r.tracer.Start(execCtx.Context, entity.Type()+" "+entity.Name(),
+		Attr("langspace.entity.type", entity.Type()),
+		Attr("langspace.entity.name", entity.Name()),
+	)
+	defer span.End()
+
+	policy, err := r.getModerationPolicy(entity)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	annotations := make(map[string]string)
+	if err := r.moderate(execCtx, entity, "input", policy.Input, execOpts.input, annotations); err != nil {
+		span.RecordError(err)
+		return &ExecutionResult{Error: err, Metadata: annotations}, err
+	}
+
+	result, err = r.dispatch(execCtx, entity)
+	if stopErr := execCtx.stopError(); stopErr != nil {
+		if result == nil {
+			result = &ExecutionResult{}
+		}
+		result.Success = false
+		result.Error = stopErr
+		err = stopErr
+	}
+	if err == nil && result != nil && result.Output != nil {
+		if modErr := r.moderate(execCtx, entity, "output", policy.Output, result.Output, annotations); modErr != nil {
+			result.Success = false
+			result.Output = nil
+			result.Error = modErr
+			err = modErr
+		}
+	}
+	if result != nil && len(annotations) > 0 {
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]string)
+		}
+		for k, v := range annotations {
+			result.Metadata[k] = v
+		}
+	}
+
+	if result != nil && cacheLookups != nil {
+		result.ResponseCache = cacheLookups.Stats()
+	}
+	if result != nil && nondeterminism != nil {
+		result.Nondeterminism = nondeterminism.Entries()
+	}
+	if result != nil && contextWarnings != nil {
+		var usage TokenUsage
+		result.ContextWarnings, usage = contextWarnings.result()
+		result.TokensUsed.Add(usage)
+	}
+	if result != nil {
+		span.SetAttributes(usageAttributes(result.TokensUsed)...)
+		span.SetAttributes(Attr("langspace.success", result.Success))
+		if err == nil && result.Error != nil {
+			span.RecordError(result.Error)
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	r.recordRun(execCtx, entity, execOpts.input, result, err)
+	return result, err
+}
+
+// dispatch executes an entity based on its type.
+func (r *Runtime) dispatch(ctx *ExecutionContext, entity ast.Entity) (*ExecutionResult, error) {
 	switch entity.Type() {
 	case "intent":
-		return r.executeIntent(execCtx, entity)
+		return r.executeIntent(ctx, entity)
 	case "pipeline":
-		return r.executePipeline(execCtx, entity)
+		return r.executePipeline(ctx, entity)
 	case "script":
-		return r.executeScript(execCtx, entity)
+		return r.executeScript(ctx, entity)
 	default:
 		return nil, fmt.Errorf("cannot execute entity of type %q", entity.Type())
 	}
@@ -209,11 +586,46 @@ func (r *Runtime) Execute(ctx context.Context, entity ast.Entity, opts ...Execut
 func (r *Runtime) ExecuteByName(ctx context.Context, entityType, entityName string, opts ...ExecuteOption) (*ExecutionResult, error) {
 	entity, found := r.workspace.GetEntityByName(entityType, entityName)
 	if !found {
-		return nil, fmt.Errorf("entity not found: %s %q", entityType, entityName)
+		return nil, i18n.New(i18n.EntityNotFound, entityType, entityName)
 	}
 	return r.Execute(ctx, entity, opts...)
 }
 
+// ExecuteInto runs an entity like Execute and decodes its output into out,
+// which must be a non-nil pointer, as encoding/json would. Text output, such
+// as a pipeline's final step, is decoded as JSON, ignoring a surrounding
+// Markdown code fence.
+func (r *Runtime) ExecuteInto(ctx context.Context, entity ast.Entity, out interface{}, opts ...ExecuteOption) (*ExecutionResult, error) {
+	if v := reflect.ValueOf(out); v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil, fmt.Errorf("ExecuteInto: out must be a non-nil pointer, got %T", out)
+	}
+	result, err := r.Execute(ctx, entity, opts...)
+	if err != nil {
+		return result, err
+	}
+	if err := decodeOutput(result.Output, out); err != nil {
+		return result, fmt.Errorf("failed to decode output of %s %q: %w", entity.Type(), entity.Name(), err)
+	}
+	return result, nil
+}
+
+// decodeOutput decodes an execution output into out.
+func decodeOutput(output, out interface{}) error {
+	data, ok := output.(string)
+	if ok {
+		value, err := parseJSONOutput(data)
+		if err != nil {
+			return err
+		}
+		output = value
+	}
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
 // handleLifecycleEvent executes a lifecycle hook if defined on the entity.
 func (r *Runtime) handleLifecycleEvent(ctx *ExecutionContext, entity ast.Entity, eventName string, resolver *Resolver) {
 	hookProp, ok := entity.GetProperty(eventName)
@@ -276,9 +688,16 @@ func (r *Runtime) handleLifecycleEvent(ctx *ExecutionContext, entity ast.Entity,
 // executeOptions holds options for a single execution.
 type executeOptions struct {
 	input    interface{}
+	params   map[string]interface{}
 	handler  StreamHandler
 	timeout  time.Duration
 	metadata map[string]string
+	inspect  InspectFunc
+	session  *Session
+	priority *Priority
+	version  string
+	matrix   []MatrixSetting
+	debugger Debugger
 }
 
 // ExecuteOption is a functional option for Execute.
@@ -305,6 +724,14 @@ func WithTimeout(timeout time.Duration) ExecuteOption {
 	}
 }
 
+// WithVersion runs a published version of the entity (see
+// workspace.PublishVersion) instead of its current definition.
+func WithVersion(version string) ExecuteOption {
+	return func(o *executeOptions) {
+		o.version = version
+	}
+}
+
 // WithMetadata sets execution metadata.
 func WithMetadata(key, value string) ExecuteOption {
 	return func(o *executeOptions) {
@@ -322,11 +749,45 @@ type ExecutionContext struct {
 	Handler   StreamHandler
 	StartTime time.Time
 
+	// RunID identifies the execution in log entries and the run history
+	RunID string
+
+	// WorkDir is the execution's working directory (see Execute)
+	WorkDir string
+
 	// For pipeline execution
 	StepOutputs map[string]interface{}
 
+	// snapshotSteps saves step snapshots for a pipeline with `snapshot: true`
+	snapshotSteps bool
+
 	// For MCP tool resolution
 	MCPTools map[string]string // toolName -> mcpServerName
+
+	// AllowedTools is the set of tools exposed to the current agent
+	AllowedTools map[string]bool
+
+	// Taint tracks untrusted content when a taint policy is set
+	Taint *TaintTracker
+
+	// For inspection (see WithInspector)
+	entityType string
+	entityName string
+	tokens     TokenUsage
+	inspector  InspectFunc
+	stop       context.CancelCauseFunc
+
+	// For multi-turn sessions (see ExecuteInSession)
+	session *Session
+
+	// matrix is the combination of a matrix run (see ExecuteMatrix)
+	matrix []MatrixSetting
+
+	// debugger pauses the execution before steps (see WithDebugger)
+	debugger Debugger
+
+	// liveness watches the execution for stalls, if configured
+	liveness *livenessMonitor
 }
 
 // SetVariable sets a variable in the execution context.
@@ -346,6 +807,11 @@ func (ec *ExecutionContext) SetStepOutput(stepName string, output interface{}) {
 		ec.StepOutputs = make(map[string]interface{})
 	}
 	ec.StepOutputs[stepName] = output
+
+	// Model output is untrusted: it may repeat injected instructions
+	if s, ok := output.(string); ok {
+		ec.Taint.Mark(s)
+	}
 }
 
 // GetStepOutput gets the output of a step.
@@ -357,11 +823,13 @@ func (ec *ExecutionContext) GetStepOutput(stepName string) (interface{}, bool) {
 	return v, ok
 }
 
-// EmitProgress sends a progress event if a handler is registered.
+// EmitProgress sends a progress event if a handler is registered, and a
+// snapshot of the execution to the inspector if one is set.
 func (ec *ExecutionContext) EmitProgress(event ProgressEvent) {
 	if ec.Handler != nil {
 		ec.Handler.OnProgress(event)
 	}
+	ec.inspect(event)
 }
 
 // EmitChunk sends a streaming chunk if a handler is registered.
@@ -376,7 +844,9 @@ type ExecutionResult struct {
 	// Success indicates whether execution completed successfully
 	Success bool `json:"success"`
 
-	// Output is the final output of the execution
+	// Output is the final output of the execution. For an intent with an
+	// output_schema, it is the decoded JSON value (a map for object
+	// schemas) rather than text; see ExecuteInto to decode it into a struct.
 	Output interface{} `json:"output,omitempty"`
 
 	// Error contains any error that occurred
@@ -393,19 +863,85 @@ type ExecutionResult struct {
 
 	// TokensUsed tracks token usage
 	TokensUsed TokenUsage `json:"tokens_used,omitempty"`
+
+	// RunID identifies the run in the run history, if one is configured
+	RunID string `json:"run_id,omitempty"`
+
+	// ResponseCache counts the execution's model calls answered from the
+	// response cache, if one is configured
+	ResponseCache *ResponseCacheStats `json:"response_cache,omitempty"`
+
+	// Nondeterminism lists what may make a deterministic execution differ
+	// between runs (see WithDeterministic)
+	Nondeterminism []Nondeterminism `json:"nondeterminism,omitempty"`
+
+	// ContextWarnings lists the file() inputs that were cut down to fit a
+	// context window (see WithContextWindow)
+	ContextWarnings []ContextWarning `json:"context_warnings,omitempty"`
 }
 
 // StepResult represents the result of a single pipeline step.
 type StepResult struct {
 	Name      string        `json:"name"`
 	Success   bool          `json:"success"`
+	Status    StepStatus    `json:"status,omitempty"`
 	Output    interface{}   `json:"output,omitempty"`
 	Error     error         `json:"error,omitempty"`
 	Duration  time.Duration `json:"duration"`
 	StartTime time.Time     `json:"start_time"`
 	EndTime   time.Time     `json:"end_time"`
+
+	// Model is the model that served the step, which is a fallback model
+	// of its agent if the agent's first model failed
+	Model string `json:"model,omitempty"`
+
+	// Input is the resolved prompt sent to the model
+	Input string `json:"input,omitempty"`
+
+	// Reasoning is the model's thinking content, if the provider exposed any
+	Reasoning string `json:"reasoning,omitempty"`
+
+	// Attempts is the number of times the step was tried, including retries
+	Attempts int `json:"attempts,omitempty"`
+
+	// QueueWait is the time the step's provider calls waited for provider
+	// rate limits
+	QueueWait time.Duration `json:"queue_wait,omitempty"`
+
+	// Repairs is the number of times the model was re-prompted to fix output
+	// that did not match the output schema
+	Repairs int `json:"repairs,omitempty"`
+
+	// TokensUsed tracks token usage for the step, including all samples
+	TokensUsed TokenUsage `json:"tokens_used,omitempty"`
+
+	// Samples holds the individual completions when self-consistency sampling is enabled
+	Samples []*SampleResult `json:"samples,omitempty"`
+
+	// Iterations holds the result of each element of a `for_each` step, in
+	// the order of the elements
+	Iterations []*StepResult `json:"iterations,omitempty"`
+
+	// Cached reports whether the output came from the step cache
+	Cached bool `json:"cached,omitempty"`
 }
 
+// StepStatus is how a pipeline step ended.
+type StepStatus string
+
+const (
+	StepSucceeded StepStatus = "succeeded"
+	StepFailed    StepStatus = "failed"
+
+	// StepTimedOut is the status of a step that ran longer than its
+	// `timeout`; its error is a StepTimeoutError
+	StepTimedOut StepStatus = "timeout"
+
+	// StepSkipped is the status of a step a debugger skipped (see
+	// WithDebugger)
+	StepSkipped StepStatus = "skipped"
+)
+
 // TokenUsage tracks LLM token usage.
 type TokenUsage struct {
 	InputTokens  int `json:"input_tokens"`
@@ -470,3 +470,218 @@ intent "meta-intent" {
 		t.Errorf("expected request_id metadata, got: %v", result.Metadata)
 	}
 }
+
+func TestExecute_PipelineReasoningCapture(t *testing.T) {
+	source := `
+agent "thinker" {
+	model: "mock-model"
+	reasoning_budget: 1024
+}
+
+pipeline "think" {
+	step "solve" {
+		use: agent("thinker")
+		prompt: "2 + 2"
+	}
+	step "explain" {
+		use: agent("thinker")
+		prompt: step("solve").reasoning
+	}
+}
+`
+	tests := []struct {
+		name          string
+		redact        bool
+		wantReasoning string
+		wantErr       bool
+	}{
+		{name: "captured", wantReasoning: "add the numbers"},
+		{name: "redacted", redact: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := workspace.New()
+			addEntities(t, ws, parseSource(t, source))
+
+			provider := NewMockProvider(WithMockResponses(MockResponse{
+				Content:   "4",
+				Reasoning: "add the numbers",
+			}))
+			cfg := DefaultConfig()
+			cfg.RedactReasoning = tt.redact
+			rt := New(ws, WithConfig(cfg), WithProvider("mock", provider))
+
+			handler := &BufferedStreamHandler{}
+			pipeline, _ := ws.GetEntityByName("pipeline", "think")
+			result, err := rt.Execute(context.Background(), pipeline, WithStreamHandler(handler))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("execute error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			solve := result.StepResults["solve"]
+			if solve.Output != "4" {
+				t.Errorf("expected answer '4' without reasoning, got %q", solve.Output)
+			}
+			if solve.Reasoning != tt.wantReasoning {
+				t.Errorf("StepResult.Reasoning = %q, want %q", solve.Reasoning, tt.wantReasoning)
+			}
+			if got := handler.Reasoning(); !strings.Contains(got, tt.wantReasoning) || (tt.redact && got != "") {
+				t.Errorf("streamed reasoning = %q, want %q", got, tt.wantReasoning)
+			}
+			if req := provider.GetRequests()[0]; req.ReasoningBudget != 1024 {
+				t.Errorf("expected reasoning budget 1024, got %d", req.ReasoningBudget)
+			}
+			if !tt.redact && provider.LastRequest().Messages[0].Content != "add the numbers" {
+				t.Errorf("expected downstream step to read reasoning, got %q", provider.LastRequest().Messages[0].Content)
+			}
+		})
+	}
+}
+
+func TestAnthropicProvider_HandleStreamReasoning(t *testing.T) {
+	stream := `event: message_start
+data: {"message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":5}}}
+
+event: content_block_delta
+data: {"index":0,"delta":{"type":"thinking_delta","thinking":"let me think"}}
+
+event: content_block_delta
+data: {"index":1,"delta":{"type":"text_delta","text":"answer"}}
+
+event: message_stop
+data: {}
+
+`
+	handler := &BufferedStreamHandler{}
+	resp, err := NewAnthropicProvider().handleStream(strings.NewReader(stream), handler)
+	if err != nil {
+		t.Fatalf("handleStream error: %v", err)
+	}
+	if resp.Content != "answer" || resp.Reasoning != "let me think" {
+		t.Errorf("got content %q reasoning %q", resp.Content, resp.Reasoning)
+	}
+	if handler.Content() != "answer" || handler.Reasoning() != "let me think" {
+		t.Errorf("got streamed content %q reasoning %q", handler.Content(), handler.Reasoning())
+	}
+}
+
+func TestExecute_IntentToolPermissions(t *testing.T) {
+	source := `
+agent "reviewer" {
+	model: "mock-model"
+	tools: [linter]
+}
+
+tool "linter" {
+	description: "Run the linter"
+	command: "echo lint"
+}
+
+tool "formatter" {
+	command: "echo format"
+}
+
+tool "deployer" {
+	command: "echo deploy"
+}
+
+intent "review" {
+	use: agent("reviewer")
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	if err := ws.AddRelationship("agent", "reviewer", "tool", "formatter", workspace.RelationTypeAssigned); err != nil {
+		t.Fatalf("AddRelationship failed: %v", err)
+	}
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{
+			ToolCalls:    []ToolCall{{ID: "call-1", Name: "deployer"}},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "done", FinishReason: FinishReasonStop},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	intent, _ := ws.GetEntityByName("intent", "review")
+	if _, err := rt.Execute(context.Background(), intent); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	requests := provider.GetRequests()
+	var exposed []string
+	for _, tool := range requests[0].Tools {
+		exposed = append(exposed, tool.Name)
+	}
+	if strings.Join(exposed, ",") != "linter,formatter" {
+		t.Errorf("expected tools [linter formatter], got %v", exposed)
+	}
+
+	toolMsg := requests[1].Messages[len(requests[1].Messages)-1]
+	if toolMsg.Role != RoleTool || !strings.Contains(toolMsg.Content, "not available to this agent") {
+		t.Errorf("expected unassigned tool call to be rejected, got %+v", toolMsg)
+	}
+}
+
+func TestExecute_RegisteredToolHandler(t *testing.T) {
+	source := `
+agent "helper" {
+	model: "mock-model"
+	tools: [search_docs, lookup]
+}
+
+tool "search_docs" {
+	description: "Search the docs"
+	command: "exit 1"
+}
+
+intent "ask" {
+	use: agent("helper")
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{
+			ToolCalls: []ToolCall{
+				{ID: "call-1", Name: "search_docs", Arguments: map[string]interface{}{"query": "retry"}},
+				{ID: "call-2", Name: "lookup"},
+			},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "done", FinishReason: FinishReasonStop},
+	))
+
+	var gotQuery interface{}
+	rt := New(ws, WithProvider("mock", provider), WithToolHandler("lookup", func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return "looked up", nil
+	}))
+	rt.RegisterToolHandler("search_docs", func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		gotQuery = args["query"]
+		return "found 3 pages", nil
+	})
+
+	intent, _ := ws.GetEntityByName("intent", "ask")
+	if _, err := rt.Execute(context.Background(), intent); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	if gotQuery != "retry" {
+		t.Errorf("expected handler to receive query 'retry', got %v", gotQuery)
+	}
+
+	requests := provider.GetRequests()
+	if len(requests[0].Tools) != 2 {
+		t.Errorf("expected undeclared handler tool to be exposed, got %d tools", len(requests[0].Tools))
+	}
+	msgs := requests[1].Messages
+	if got := msgs[len(msgs)-2].Content; got != "found 3 pages" {
+		t.Errorf("expected registered handler to take precedence over command, got %q", got)
+	}
+	if got := msgs[len(msgs)-1].Content; got != "looked up" {
+		t.Errorf("expected undeclared handler tool result, got %q", got)
+	}
+}
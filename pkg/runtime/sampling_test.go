@@ -0,0 +1,223 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecute_PipelineSamplingMajority(t *testing.T) {
+	source := `
+agent "solver" {
+	model: "mock-model"
+	temperature: 0.8
+}
+
+pipeline "vote" {
+	step "answer" {
+		use: agent("solver")
+		prompt: "What is 6 * 7?"
+		samples: 5
+		aggregate: "majority"
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	usage := TokenUsage{InputTokens: 10, OutputTokens: 2, TotalTokens: 12}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "42", Usage: usage},
+		MockResponse{Content: "41", Usage: usage},
+		MockResponse{Content: " 42\n", Usage: usage},
+		MockResponse{Content: "40", Usage: usage},
+		MockResponse{Content: "42", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "vote")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	if strings.TrimSpace(result.Output.(string)) != "42" {
+		t.Errorf("expected majority answer '42', got %q", result.Output)
+	}
+	if got := len(provider.GetRequests()); got != 5 {
+		t.Errorf("expected 5 requests, got %d", got)
+	}
+
+	step := result.StepResults["answer"]
+	if len(step.Samples) != 5 {
+		t.Errorf("expected 5 samples, got %d", len(step.Samples))
+	}
+	if step.TokensUsed.TotalTokens != 60 {
+		t.Errorf("expected 60 step tokens, got %d", step.TokensUsed.TotalTokens)
+	}
+	if result.TokensUsed.TotalTokens != 60 {
+		t.Errorf("expected 60 total tokens, got %d", result.TokensUsed.TotalTokens)
+	}
+}
+
+func TestExecute_PipelineSamplingJudge(t *testing.T) {
+	source := `
+agent "writer" {
+	model: "mock-model"
+	temperature: 0.9
+}
+
+agent "critic" {
+	model: "mock-model"
+}
+
+pipeline "pick" {
+	step "draft" {
+		use: agent("writer")
+		prompt: "Write a title"
+		samples: 2
+		aggregate: "judge"
+		judge: agent("critic")
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	usage := TokenUsage{TotalTokens: 5}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "Title A", Usage: usage},
+		MockResponse{Content: "Title B", Usage: usage},
+		MockResponse{Content: "Candidate 2", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "pick")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	step := result.StepResults["draft"]
+	if step.Output != step.Samples[1].Content {
+		t.Errorf("expected judge to pick the second sample %q, got %q", step.Samples[1].Content, step.Output)
+	}
+	if result.TokensUsed.TotalTokens != 15 {
+		t.Errorf("expected 15 total tokens including judge, got %d", result.TokensUsed.TotalTokens)
+	}
+}
+
+func TestExecute_PipelineSamplingRequiresTemperature(t *testing.T) {
+	source := `
+agent "solver" {
+	model: "mock-model"
+	temperature: 0
+}
+
+pipeline "vote" {
+	step "answer" {
+		use: agent("solver")
+		samples: 3
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+	rt := New(ws, WithProvider("mock", NewMockProvider()))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "vote")
+	if _, err := rt.Execute(context.Background(), pipeline); err == nil {
+		t.Fatal("expected error when sampling with temperature 0")
+	}
+}
+
+func TestExecute_PipelineSamplingInspected(t *testing.T) {
+	source := `
+agent "solver" {
+	model: "mock-model"
+	temperature: 0.8
+}
+
+pipeline "vote" {
+	step "answer" {
+		use: agent("solver")
+		prompt: "What is 6 * 7?"
+		samples: 3
+		retry {
+			max: 1
+			delay: "1ms"
+			on: ["rate_limit"]
+		}
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	usage := TokenUsage{TotalTokens: 12}
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Error: &APIError{StatusCode: 429}},
+		MockResponse{Error: &APIError{StatusCode: 400, Body: "bad sample"}},
+		MockResponse{Content: "42", Usage: usage},
+		MockResponse{Content: "42", Usage: usage},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	// The inspector is not called from the samples' goroutines, so it
+	// needs no lock
+	var snapshots []ExecutionSnapshot
+	inspect := func(s ExecutionSnapshot) error {
+		snapshots = append(snapshots, s)
+		return nil
+	}
+	pipeline, _ := ws.GetEntityByName("pipeline", "vote")
+	result, err := rt.Execute(context.Background(), pipeline, WithInspector(inspect))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	var retried bool
+	for _, s := range snapshots {
+		retried = retried || strings.HasPrefix(s.Event.Message, "Retrying answer")
+	}
+	if !retried {
+		t.Error("expected the inspector to see the sample's retry")
+	}
+	if got := snapshots[len(snapshots)-1].TokensUsed.TotalTokens; got != 24 {
+		t.Errorf("expected the inspector to count 24 tokens, got %d", got)
+	}
+
+	// A failed sample records its error's message
+	data, err := json.Marshal(result.StepResults["answer"].Samples)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if !strings.Contains(string(data), "bad sample") {
+		t.Errorf("expected the failed sample's error in %s", data)
+	}
+}
+
+func TestAggregateByMajority(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"single", []string{"a"}, "a"},
+		{"clear winner", []string{"a", "b", "b"}, "b"},
+		{"case insensitive", []string{"Yes", "no", "yes"}, "Yes"},
+		{"tie goes to first", []string{"a", "b"}, "a"},
+		{"tie goes to first seen", []string{"a", "b", "b", "a"}, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aggregateByMajority(tt.candidates); got != tt.want {
+				t.Errorf("aggregateByMajority() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Priority orders executions waiting for a slot in a Scheduler. It is set
+// with the `priority` property of an intent, pipeline, or trigger, or with
+// WithPriority.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// ParsePriority parses "low", "normal", or "high".
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q (want low, normal or high)", s)
+	}
+}
+
+func (p Priority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "high"
+	}
+	return "normal"
+}
+
+// entityPriority returns the priority set by an entity's `priority`
+// property, or ok false if it has none.
+func entityPriority(entity ast.Entity) (p Priority, ok bool, err error) {
+	prop, found := entity.GetProperty("priority")
+	if !found {
+		return PriorityNormal, false, nil
+	}
+	s, isString := prop.(ast.StringValue)
+	if !isString {
+		return 0, false, fmt.Errorf("%s %q: priority must be low, normal or high", entity.Type(), entity.Name())
+	}
+	p, err = ParsePriority(s.Value)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s %q: %w", entity.Type(), entity.Name(), err)
+	}
+	return p, true, nil
+}
+
+// WithPriority sets the priority of the execution, overriding the entity's
+// `priority` property.
+func WithPriority(p Priority) ExecuteOption {
+	return func(o *executeOptions) {
+		o.priority = &p
+	}
+}
+
+// Preemption is what a Scheduler does to a running execution of lower
+// priority when a higher-priority one is waiting for a slot.
+type Preemption string
+
+const (
+	// PreemptNone lets running executions finish.
+	PreemptNone Preemption = ""
+
+	// PreemptPause makes a pipeline give up its slot before its next step
+	// and wait for a slot again, at its own priority. Intents are not
+	// paused.
+	PreemptPause Preemption = "pause"
+
+	// PreemptAbort stops the execution with a PreemptedError.
+	PreemptAbort Preemption = "abort"
+)
+
+// ParsePreemption parses "none", "pause", or "abort".
+func ParsePreemption(s string) (Preemption, error) {
+	switch s {
+	case "", "none":
+		return PreemptNone, nil
+	case string(PreemptPause), string(PreemptAbort):
+		return Preemption(s), nil
+	default:
+		return "", fmt.Errorf("unknown preemption %q (want none, pause or abort)", s)
+	}
+}
+
+// PreemptedError is the error of an execution a Scheduler aborted to make
+// room for one of higher priority.
+type PreemptedError struct {
+	Priority Priority // of the execution aborted
+	By       Priority // of the execution it made room for
+}
+
+func (e *PreemptedError) Error() string {
+	return fmt.Sprintf("%s-priority execution preempted by a %s-priority one", e.Priority, e.By)
+}
+
+// Scheduler limits how many executions run at once. Executions wait for a
+// slot in priority order, and in the order they arrived within a priority,
+// so interactive requests are not stuck behind batch jobs. Share one
+// Scheduler between runtimes, such as the versions of a Rollout, to limit
+// them together.
+//
+// Example:
+//
+//	sched := runtime.NewScheduler(4, runtime.PreemptPause)
+//	rt := runtime.New(ws, runtime.WithScheduler(sched))
+//	rt.Execute(ctx, intent, runtime.WithPriority(runtime.PriorityHigh))
+type Scheduler struct {
+	mu      sync.Mutex
+	slots   int
+	preempt Preemption
+	seq     uint64
+	running map[*scheduledRun]bool
+	waiting []*scheduledRun
+}
+
+// scheduledRun is an execution holding or waiting for a slot.
+type scheduledRun struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{} // closed when the run gets a slot
+	stop     context.CancelCauseFunc
+
+	// preempted is set once the run has been asked to make room, and
+	// pause while it has yet to do so
+	preempted bool
+	pause     bool
+}
+
+// NewScheduler returns a scheduler that runs up to maxConcurrent executions
+// at once (at least one).
+func NewScheduler(maxConcurrent int, preempt Preemption) *Scheduler {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &Scheduler{
+		slots:   maxConcurrent,
+		preempt: preempt,
+		running: make(map[*scheduledRun]bool),
+	}
+}
+
+// WithScheduler runs executions through sched. Executions started by a
+// running one, such as lifecycle hooks, use its slot.
+func WithScheduler(sched *Scheduler) Option {
+	return func(r *Runtime) {
+		r.scheduler = sched
+	}
+}
+
+// SchedulerStatus counts the executions of a Scheduler by priority.
+type SchedulerStatus struct {
+	Running map[string]int `json:"running"`
+	Waiting map[string]int `json:"waiting"`
+}
+
+// Status returns the number of running and waiting executions.
+func (s *Scheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := SchedulerStatus{Running: make(map[string]int), Waiting: make(map[string]int)}
+	for run := range s.running {
+		status.Running[run.priority.String()]++
+	}
+	for _, run := range s.waiting {
+		status.Waiting[run.priority.String()]++
+	}
+	return status
+}
+
+// acquire waits for a slot. stop aborts the execution if it is preempted
+// under PreemptAbort.
+func (s *Scheduler) acquire(ctx context.Context, priority Priority, stop context.CancelCauseFunc) (*scheduledRun, error) {
+	s.mu.Lock()
+	s.seq++
+	run := &scheduledRun{priority: priority, seq: s.seq, ready: make(chan struct{}), stop: stop}
+	s.enqueue(run)
+	s.mu.Unlock()
+
+	if err := s.wait(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// release gives up the run's slot.
+func (s *Scheduler) release(run *scheduledRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, run)
+	s.dispatch()
+}
+
+// yield gives up the run's slot and queues it for a new one if it has been
+// asked to pause, after which the caller waits for the slot. It reports
+// whether the run paused.
+func (s *Scheduler) yield(run *scheduledRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !run.pause {
+		return false
+	}
+	run.pause, run.preempted = false, false
+	run.ready = make(chan struct{})
+	delete(s.running, run)
+	s.dispatch()
+	// The run keeps its place among runs of its priority
+	s.enqueue(run)
+	return true
+}
+
+// wait blocks until run has a slot or ctx is done.
+func (s *Scheduler) wait(ctx context.Context, run *scheduledRun) error {
+	select {
+	case <-run.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[run] {
+		// Got a slot as ctx was done
+		delete(s.running, run)
+		s.dispatch()
+	} else {
+		s.remove(run)
+	}
+	return ctx.Err()
+}
+
+// enqueue adds run to the queue and gives out free slots, preempting a
+// lower-priority run if the queue is still blocked. Callers hold s.mu.
+func (s *Scheduler) enqueue(run *scheduledRun) {
+	i := sort.Search(len(s.waiting), func(i int) bool {
+		w := s.waiting[i]
+		return w.priority < run.priority || (w.priority == run.priority && w.seq > run.seq)
+	})
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = run
+
+	s.dispatch()
+	if len(s.waiting) > 0 && s.waiting[0] == run {
+		s.preemptFor(run)
+	}
+}
+
+// dispatch gives free slots to the runs at the head of the queue. Callers
+// hold s.mu.
+func (s *Scheduler) dispatch() {
+	for len(s.waiting) > 0 && len(s.running) < s.slots {
+		run := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		s.running[run] = true
+		close(run.ready)
+	}
+}
+
+// preemptFor asks the newest running run of the lowest priority below
+// run's to make room. Callers hold s.mu.
+func (s *Scheduler) preemptFor(run *scheduledRun) {
+	if s.preempt == PreemptNone {
+		return
+	}
+	var victim *scheduledRun
+	for r := range s.running {
+		if r.preempted || r.priority >= run.priority {
+			continue
+		}
+		if victim == nil || r.priority < victim.priority || (r.priority == victim.priority && r.seq > victim.seq) {
+			victim = r
+		}
+	}
+	if victim == nil {
+		return
+	}
+	victim.preempted = true
+	switch s.preempt {
+	case PreemptPause:
+		victim.pause = true
+	case PreemptAbort:
+		if victim.stop != nil {
+			victim.stop(&PreemptedError{Priority: victim.priority, By: run.priority})
+		}
+	}
+}
+
+// remove drops run from the queue. Callers hold s.mu.
+func (s *Scheduler) remove(run *scheduledRun) {
+	for i, w := range s.waiting {
+		if w == run {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+type scheduledRunKey struct{}
+
+// scheduledRunFromContext returns the slot of the execution ctx belongs to.
+func scheduledRunFromContext(ctx context.Context) (*scheduledRun, bool) {
+	run, ok := ctx.Value(scheduledRunKey{}).(*scheduledRun)
+	return run, ok
+}
+
+// yieldSlot lets the execution pause for a higher-priority one, between
+// pipeline steps. The stall detector does not count the time paused.
+func (ec *ExecutionContext) yieldSlot() error {
+	run, ok := scheduledRunFromContext(ec.Context)
+	if !ok || ec.Runtime == nil || ec.Runtime.scheduler == nil {
+		return nil
+	}
+	if !ec.Runtime.scheduler.yield(run) {
+		return nil
+	}
+	if ec.liveness != nil {
+		ec.liveness.pause()
+		defer ec.liveness.resume()
+	}
+	if err := ec.Runtime.scheduler.wait(ec.Context, run); err != nil {
+		return err
+	}
+	ec.EmitProgress(ProgressEvent{
+		Type:    ProgressTypeStep,
+		Message: "Resumed after pausing for a higher-priority execution",
+	})
+	return nil
+}
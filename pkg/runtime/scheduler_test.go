@@ -0,0 +1,243 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// waitForStatus polls sched until cond holds.
+func waitForStatus(t *testing.T, sched *Scheduler, cond func(SchedulerStatus) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(sched.Status()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the scheduler, status %+v", sched.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]Priority{"": PriorityNormal, "low": PriorityLow, "normal": PriorityNormal, "high": PriorityHigh} {
+		if got, err := ParsePriority(in); err != nil || got != want {
+			t.Errorf("ParsePriority(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("expected an error for an unknown priority")
+	}
+	if _, err := ParsePreemption("kill"); err == nil {
+		t.Error("expected an error for an unknown preemption")
+	}
+}
+
+func TestScheduler_PriorityOrder(t *testing.T) {
+	sched := NewScheduler(1, PreemptNone)
+	holder, err := sched.acquire(context.Background(), PriorityNormal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	for i, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run, err := sched.acquire(context.Background(), p, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			sched.release(run)
+		}()
+		waitForStatus(t, sched, func(s SchedulerStatus) bool {
+			return s.Waiting["low"]+s.Waiting["normal"]+s.Waiting["high"] == i+1
+		})
+	}
+
+	sched.release(holder)
+	wg.Wait()
+	want := []Priority{PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow}
+	if len(order) != len(want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestExecute_PreemptAbort(t *testing.T) {
+	sched := NewScheduler(1, PreemptAbort)
+	rt := New(workspace.New(), WithScheduler(sched))
+
+	lowErr := make(chan error, 1)
+	go func() {
+		_, err := rt.Execute(context.Background(), newWorkDirScript("sleep 5"), WithPriority(PriorityLow))
+		lowErr <- err
+	}()
+	waitForStatus(t, sched, func(s SchedulerStatus) bool { return s.Running["low"] == 1 })
+
+	res, err := rt.Execute(context.Background(), newWorkDirScript("echo urgent"), WithPriority(PriorityHigh))
+	if err != nil || !res.Success {
+		t.Fatalf("high-priority execution failed: %v", err)
+	}
+	var preempted *PreemptedError
+	if err := <-lowErr; !errors.As(err, &preempted) || preempted.By != PriorityHigh {
+		t.Fatalf("expected the low-priority execution to be preempted, got %v", err)
+	}
+}
+
+func TestExecutePipeline_PreemptPause(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "batch" {
+	priority: "low"
+
+	step "first" {
+		use: agent("writer")
+		input: "Part one"
+	}
+
+	step "second" {
+		use: agent("writer")
+		input: "Part two"
+	}
+}
+
+intent "interactive" {
+	use: agent("writer")
+	input: "Answer now"
+	priority: "high"
+}
+`))
+	provider := NewMockProvider(
+		WithMockResponses(MockResponse{Content: strings.Repeat("word ", 10)}),
+		WithMockStreamDelay(10*time.Millisecond),
+	)
+	sched := NewScheduler(1, PreemptPause)
+	rt := New(ws, WithProvider("mock", provider), WithScheduler(sched), WithConfig(&Config{EnableStreaming: true}))
+	batch, _ := ws.GetEntityByName("pipeline", "batch")
+	interactive, _ := ws.GetEntityByName("intent", "interactive")
+
+	handler := &BufferedStreamHandler{}
+	batchDone := make(chan time.Time, 1)
+	go func() {
+		result, err := rt.Execute(context.Background(), batch, WithStreamHandler(handler))
+		if err != nil || !result.Success {
+			t.Errorf("batch pipeline failed: %v", err)
+		}
+		batchDone <- time.Now()
+	}()
+	waitForStatus(t, sched, func(s SchedulerStatus) bool { return s.Running["low"] == 1 })
+
+	result, err := rt.Execute(context.Background(), interactive)
+	if err != nil || !result.Success {
+		t.Fatalf("interactive intent failed: %v", err)
+	}
+	interactiveDone := time.Now()
+
+	if done := <-batchDone; done.Before(interactiveDone) {
+		t.Error("expected the interactive intent to finish before the paused pipeline")
+	}
+	resumed := false
+	for _, e := range progressOfType(handler.Events, ProgressTypeStep) {
+		resumed = resumed || strings.HasPrefix(e.Message, "Resumed")
+	}
+	if !resumed {
+		t.Errorf("expected the pipeline to report resuming, got %+v", handler.Events)
+	}
+}
+
+func TestExecute_TimeoutStartsWithSlot(t *testing.T) {
+	sched := NewScheduler(1, PreemptNone)
+	rt := New(workspace.New(), WithScheduler(sched))
+	holder, err := sched.acquire(context.Background(), PriorityNormal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := rt.Execute(context.Background(), newWorkDirScript("echo queued"), WithTimeout(200*time.Millisecond))
+		done <- err
+	}()
+	waitForStatus(t, sched, func(s SchedulerStatus) bool { return s.Waiting["normal"] == 1 })
+
+	// Time spent queued does not count toward the timeout
+	time.Sleep(300 * time.Millisecond)
+	sched.release(holder)
+	if err := <-done; err != nil {
+		t.Fatalf("expected the queued execution to run, got %v", err)
+	}
+}
+
+func TestExecutePipeline_PausedNotStalled(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "batch" {
+	priority: "low"
+
+	step "first" {
+		use: agent("writer")
+		input: "Part one"
+	}
+
+	step "second" {
+		use: agent("writer")
+		input: "Part two"
+	}
+}
+
+intent "interactive" {
+	use: agent("writer")
+	input: "Answer now"
+	priority: "high"
+}
+`))
+	provider := NewMockProvider(
+		WithMockResponses(MockResponse{Content: strings.Repeat("word ", 30)}),
+		WithMockStreamDelay(10*time.Millisecond),
+	)
+	sched := NewScheduler(1, PreemptPause)
+	cfg := &Config{EnableStreaming: true, StallTimeout: 100 * time.Millisecond, StallAction: StallAbort}
+	rt := New(ws, WithProvider("mock", provider), WithScheduler(sched), WithConfig(cfg))
+	batch, _ := ws.GetEntityByName("pipeline", "batch")
+	interactive, _ := ws.GetEntityByName("intent", "interactive")
+
+	// The pipeline waits out the interactive intent's 300ms answer, longer
+	// than the stall timeout, without being stopped as stalled
+	batchErr := make(chan error, 1)
+	go func() {
+		_, err := rt.Execute(context.Background(), batch, WithStreamHandler(&BufferedStreamHandler{}))
+		batchErr <- err
+	}()
+	waitForStatus(t, sched, func(s SchedulerStatus) bool { return s.Running["low"] == 1 })
+
+	if _, err := rt.Execute(context.Background(), interactive, WithStreamHandler(&BufferedStreamHandler{})); err != nil {
+		t.Fatalf("interactive intent failed: %v", err)
+	}
+	if err := <-batchErr; err != nil {
+		t.Fatalf("expected the paused pipeline to finish, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestValidateOutput(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name", "score"},
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "string", "minLength": float64(1)},
+			"score": map[string]interface{}{"type": "integer", "minimum": float64(0), "maximum": float64(10)},
+			"level": map[string]interface{}{"enum": []interface{}{"low", "high"}},
+			"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		wantErr string
+	}{
+		{"valid", `{"name": "a", "score": 3, "tags": ["x"]}`, ""},
+		{"fenced", "```json\n{\"name\": \"a\", \"score\": 3}\n```", ""},
+		{"not json", `sure, here you go`, "not valid JSON"},
+		{"missing required", `{"name": "a"}`, `$: missing required property "score"`},
+		{"wrong type", `{"name": 1, "score": 3}`, "$.name: expected string, got number"},
+		{"not integer", `{"name": "a", "score": 2.5}`, "$.score: expected integer"},
+		{"above maximum", `{"name": "a", "score": 11}`, "greater than maximum"},
+		{"enum", `{"name": "a", "score": 1, "level": "mid"}`, "not one of"},
+		{"array item", `{"name": "a", "score": 1, "tags": ["x", 2]}`, "$.tags[1]: expected string"},
+		{"min length", `{"name": "", "score": 1}`, "at least 1 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOutput(tt.output, schema)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateOutput() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateOutput() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecute_OutputSchemaRepair(t *testing.T) {
+	source := `
+agent "extractor" {
+	model: "mock-model"
+	output_schema: {
+		name: string required
+		score: number optional
+	}
+}
+
+pipeline "extract" {
+	step "parse" {
+		use: agent("extractor")
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "The name is Ada"},
+		MockResponse{Content: `{"score": 5}`},
+		MockResponse{Content: `{"name": "Ada", "score": 5}`},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "extract")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	step := result.StepResults["parse"]
+	if step.Repairs != 2 {
+		t.Errorf("expected 2 repairs, got %d", step.Repairs)
+	}
+	if step.Output != `{"name": "Ada", "score": 5}` {
+		t.Errorf("expected repaired output, got %v", step.Output)
+	}
+
+	requests := provider.GetRequests()
+	last := requests[2].Messages[len(requests[2].Messages)-1]
+	if !strings.Contains(last.Content, `missing required property "name"`) {
+		t.Errorf("expected repair prompt to include validation error, got %q", last.Content)
+	}
+}
+
+func TestExecute_OutputSchemaRepairExhausted(t *testing.T) {
+	source := `
+agent "extractor" {
+	model: "mock-model"
+}
+
+pipeline "extract" {
+	step "parse" {
+		use: agent("extractor")
+		output_schema: { type: "object" required: ["name"] }
+		repair_attempts: 1
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "no json here"}))
+	rt := New(ws, WithProvider("mock", provider))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "extract")
+	_, err := rt.Execute(context.Background(), pipeline)
+	if err == nil || !strings.Contains(err.Error(), "after 1 repair attempts") {
+		t.Fatalf("expected schema failure after 1 repair, got %v", err)
+	}
+	if got := len(provider.GetRequests()); got != 2 {
+		t.Errorf("expected 2 requests (original + 1 repair), got %d", got)
+	}
+}
+
+func TestExecute_IntentOutputSchemaDecoded(t *testing.T) {
+	source := `
+agent "extractor" {
+	model: "mock-model"
+}
+
+intent "extract" {
+	use: agent("extractor")
+	input: "Ada, 5"
+	output_schema: {
+		name: string required
+		score: number optional
+	}
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "```json\n{\"name\": \"Ada\", \"score\": 5}\n```"}))
+	rt := New(ws, WithProvider("mock", provider))
+
+	intent, _ := ws.GetEntityByName("intent", "extract")
+	result, err := rt.Execute(context.Background(), intent)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	output, ok := result.Output.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a decoded object, got %T: %v", result.Output, result.Output)
+	}
+	if output["name"] != "Ada" || output["score"] != float64(5) {
+		t.Errorf("unexpected output %v", output)
+	}
+}
+
+func TestExecuteInto(t *testing.T) {
+	source := `
+agent "extractor" {
+	model: "mock-model"
+	output_schema: { name: string required, score: number }
+}
+
+intent "extract" {
+	use: agent("extractor")
+	input: "Ada, 5"
+}
+
+pipeline "plain" {
+	step "answer" {
+		use: agent("writer")
+	}
+}
+
+agent "writer" {
+	model: "mock-model"
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: `{"name": "Ada", "score": 5}`},
+		MockResponse{Content: `{"name": "Grace", "score": 7}`},
+		MockResponse{Content: "not JSON"},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	var out struct {
+		Name  string  `json:"name"`
+		Score float64 `json:"score"`
+	}
+	intent, _ := ws.GetEntityByName("intent", "extract")
+	if _, err := rt.ExecuteInto(context.Background(), intent, &out); err != nil {
+		t.Fatalf("ExecuteInto() error = %v", err)
+	}
+	if out.Name != "Ada" || out.Score != 5 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	// Text output is decoded as JSON
+	pipeline, _ := ws.GetEntityByName("pipeline", "plain")
+	if _, err := rt.ExecuteInto(context.Background(), pipeline, &out); err != nil {
+		t.Fatalf("ExecuteInto() error = %v", err)
+	}
+	if out.Name != "Grace" || out.Score != 7 {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	if _, err := rt.ExecuteInto(context.Background(), pipeline, &out); err == nil || !strings.Contains(err.Error(), "failed to decode output") {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+	if _, err := rt.ExecuteInto(context.Background(), pipeline, out); err == nil || !strings.Contains(err.Error(), "non-nil pointer") {
+		t.Errorf("expected a pointer error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package runtime
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// limitMemory caps the address space of cmd by starting it through a shell
+// that sets `ulimit -v` and then execs the interpreter.
+func limitMemory(cmd *exec.Cmd, bytes int64) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+	cmd.Args = append([]string{"sh", "-c", `ulimit -v "$0" && exec "$@"`, strconv.FormatInt(bytes>>10, 10)}, cmd.Args...)
+	cmd.Path = sh
+}
+
+// sandboxProcess runs cmd in its own process group, killed as a whole when
+// the script is cancelled, and in an empty network namespace unless the
+// sandbox allows network access.
+func sandboxProcess(cmd *exec.Cmd, sandbox ScriptSandbox) error {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if !sandbox.Network {
+		attr.Cloneflags = syscall.CLONE_NEWNET
+		if uid := os.Getuid(); uid != 0 {
+			// Unprivileged users need a user namespace to create one
+			attr.Cloneflags |= syscall.CLONE_NEWUSER
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+		}
+	}
+	cmd.SysProcAttr = attr
+
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package runtime
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	goruntime "runtime"
+)
+
+// limitMemory is not supported on this platform; the limit is ignored.
+func limitMemory(cmd *exec.Cmd, bytes int64) {
+	slog.Warn("script memory limit not enforced", "os", goruntime.GOOS)
+}
+
+// sandboxProcess refuses to run scripts that require network isolation,
+// which is only implemented on Linux.
+func sandboxProcess(cmd *exec.Cmd, sandbox ScriptSandbox) error {
+	if !sandbox.Network {
+		return fmt.Errorf("network isolation is not supported on %s", goruntime.GOOS)
+	}
+	return nil
+}
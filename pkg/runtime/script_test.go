@@ -3,7 +3,10 @@ package runtime
 import (
 	"context"
 	"os"
+	goruntime "runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
 	"github.com/shellkjell/langspace/pkg/workspace"
@@ -67,3 +70,153 @@ func TestExecuteScript_Shell(t *testing.T) {
 		t.Errorf("Expected 'hello from shell\\n', got %q", output)
 	}
 }
+
+// runScriptSource executes script "test" from source with the given code.
+func runScriptSource(t *testing.T, source, code string, opts ...ExecuteOption) (*ExecutionResult, error) {
+	t.Helper()
+	ws := workspace.New()
+	entities := parseSource(t, source)
+	for _, e := range entities {
+		if e.Type() == "script" {
+			e.SetProperty("code", ast.StringValue{Value: code})
+		}
+	}
+	addEntities(t, ws, entities)
+	return New(ws).ExecuteByName(context.Background(), "script", "test", opts...)
+}
+
+func TestExecuteScript_StructuredOutput(t *testing.T) {
+	res, err := runScriptSource(t, `
+script "test" {
+	language: "sh"
+	parameters: {
+		greeting: string optional "hello"
+	}
+}
+`, `printf '{"message": "%s %s"}' "$LS_PARAM_GREETING" "$LS_PARAM_NAME" > "$LS_OUTPUT"`, WithInput(map[string]interface{}{"name": "world"}))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	output, ok := res.Output.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected structured output, got %T: %v", res.Output, res.Output)
+	}
+	if output["message"] != "hello world" {
+		t.Errorf("unexpected output %v", output)
+	}
+}
+
+func TestExecuteScript_Timeout(t *testing.T) {
+	start := time.Now()
+	_, err := runScriptSource(t, `
+script "test" {
+	language: "sh"
+	limits: {
+		timeout: "100ms"
+	}
+}
+`, "sleep 10 & sleep 10")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("script was not killed promptly: %s", elapsed)
+	}
+}
+
+func TestExecuteScript_RestrictedEnv(t *testing.T) {
+	t.Setenv("LS_TEST_SECRET", "s3cret")
+	t.Setenv("LS_TEST_ALLOWED", "visible")
+
+	res, err := runScriptSource(t, `
+script "test" {
+	language: "bash"
+	sandbox: {
+		env: ["LS_TEST_ALLOWED"]
+	}
+}
+`, "echo ${LS_TEST_SECRET:-unset} $LS_TEST_ALLOWED")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res.Output != "unset visible\n" {
+		t.Errorf("expected only allowlisted variables, got %q", res.Output)
+	}
+}
+
+func TestExecuteScript_MemoryLimit(t *testing.T) {
+	if goruntime.GOOS != "linux" {
+		t.Skip("memory limits are enforced on Linux only")
+	}
+	if _, err := os.Stat("/usr/bin/python3"); os.IsNotExist(err) {
+		t.Skip("python3 not found")
+	}
+
+	_, err := runScriptSource(t, `
+script "test" {
+	language: "python"
+	runtime: "/usr/bin/python3"
+	limits: {
+		memory: "64MB"
+	}
+}
+`, "data = bytearray(512 * 1024 * 1024)")
+	if err == nil {
+		t.Fatal("expected allocation beyond the memory limit to fail")
+	}
+}
+
+func TestExecuteScript_NetworkIsolation(t *testing.T) {
+	if goruntime.GOOS != "linux" {
+		t.Skip("network isolation is implemented on Linux only")
+	}
+
+	res, err := runScriptSource(t, `
+script "test" {
+	language: "sh"
+	sandbox: {
+		network: false
+	}
+}
+`, "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '")
+	if err != nil {
+		if strings.Contains(err.Error(), "failed to run") {
+			t.Skipf("network namespaces unavailable: %v", err)
+		}
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res.Output != "lo\n" {
+		t.Errorf("expected only the loopback interface, got %q", res.Output)
+	}
+}
+
+func TestExecutePipeline_ScriptStep(t *testing.T) {
+	source := `
+script "count" {
+	language: "sh"
+}
+
+pipeline "etl" {
+	step "extract" {
+		execute: script("count") {
+			table: "raw_events"
+		}
+	}
+}
+`
+	ws := workspace.New()
+	entities := parseSource(t, source)
+	entities[0].SetProperty("code", ast.StringValue{Value: `printf '{"table": "%s", "rows": 3}' "$LS_PARAM_TABLE" > "$LS_OUTPUT"`})
+	addEntities(t, ws, entities)
+
+	res, err := New(ws).ExecuteByName(context.Background(), "pipeline", "etl")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	output, ok := res.StepResults["extract"].Output.(map[string]interface{})
+	if !ok || output["table"] != "raw_events" || output["rows"] != float64(3) {
+		t.Errorf("unexpected step output %#v", res.StepResults["extract"].Output)
+	}
+}
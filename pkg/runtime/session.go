@@ -0,0 +1,295 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// DefaultMemoryMessages is the number of messages an agent with a buffer
+// memory keeps when it does not set `max_messages`.
+const DefaultMemoryMessages = 20
+
+// Memory types accepted by an agent's `memory` property.
+const (
+	// MemoryBuffer keeps the most recent messages of the conversation
+	MemoryBuffer = "buffer"
+)
+
+// Session is the conversation of a multi-turn session, kept per agent so
+// that the agents of a pipeline each see their own earlier turns.
+type Session struct {
+	ID string `json:"id"`
+
+	// Messages maps agent names to their conversation, oldest first
+	Messages  map[string][]Message `json:"messages"`
+	UpdatedAt time.Time            `json:"updated_at"`
+
+	// mu guards Messages while the steps of a pipeline run in parallel
+	mu sync.Mutex
+}
+
+// NewSession creates an empty session.
+func NewSession(id string) *Session {
+	return &Session{ID: id, Messages: make(map[string][]Message)}
+}
+
+// clone returns a copy of the session that shares no slices with it.
+func (s *Session) clone() *Session {
+	c := &Session{ID: s.ID, UpdatedAt: s.UpdatedAt, Messages: make(map[string][]Message, len(s.Messages))}
+	for agent, msgs := range s.Messages {
+		c.Messages[agent] = append([]Message(nil), msgs...)
+	}
+	return c
+}
+
+// SessionStore stores sessions by ID. Load returns an empty session for an
+// unknown ID. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	Load(id string) (*Session, error)
+	Save(session *Session) error
+}
+
+// MemorySessionStore keeps sessions in memory for the life of the process.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemorySessionStore creates an empty in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+// Load returns a copy of the session with the given ID.
+func (s *MemorySessionStore) Load(id string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if session, ok := s.sessions[id]; ok {
+		return session.clone(), nil
+	}
+	return NewSession(id), nil
+}
+
+// Save stores a copy of the session, replacing any previous one.
+func (s *MemorySessionStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session.clone()
+	return nil
+}
+
+// FileSessionStore writes each session to <dir>/<id>.json, so a session can be
+// continued by later processes.
+type FileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore creates a session store in dir, creating it if needed.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// DefaultSessionDir returns the per-user directory for sessions.
+func DefaultSessionDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "langspace", "sessions"), nil
+}
+
+// Load reads the session with the given ID.
+func (s *FileSessionStore) Load(id string) (*Session, error) {
+	if err := checkSessionID(id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return NewSession(id), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	session := NewSession(id)
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %q: %w", id, err)
+	}
+	if session.Messages == nil {
+		session.Messages = make(map[string][]Message)
+	}
+	return session, nil
+}
+
+// Save writes the session, replacing any previous one atomically.
+func (s *FileSessionStore) Save(session *Session) error {
+	if err := checkSessionID(session.ID); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, session.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(session.ID)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func checkSessionID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return fmt.Errorf("invalid session ID %q", id)
+	}
+	return nil
+}
+
+// WithSessionStore sets the store ExecuteInSession loads and saves sessions
+// in. By default, sessions are kept in memory for the life of the runtime.
+func WithSessionStore(store SessionStore) Option {
+	return func(r *Runtime) {
+		r.sessions = store
+	}
+}
+
+// ExecuteInSession runs an entity as the next turn of a session. Agents that
+// declare a `memory` property see their earlier turns of the session, and
+// the new turn is saved once the execution finishes:
+//
+//	agent "assistant" {
+//	  model: "claude-sonnet-4-20250514"
+//	  memory: { type: "buffer" max_messages: 20 }
+//	}
+//
+// Agents without a `memory` property take part without remembering anything.
+// A session should be used by one execution at a time.
+func (r *Runtime) ExecuteInSession(ctx context.Context, sessionID string, entity ast.Entity, opts ...ExecuteOption) (*ExecutionResult, error) {
+	if err := checkSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	session, err := r.sessions.Load(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session %q: %w", sessionID, err)
+	}
+	opts = append(opts, func(o *executeOptions) { o.session = session })
+	result, err := r.Execute(ctx, entity, opts...)
+
+	session.UpdatedAt = time.Now()
+	if saveErr := r.sessions.Save(session); saveErr != nil {
+		saveErr = fmt.Errorf("failed to save session %q: %w", sessionID, saveErr)
+		if err == nil {
+			err = saveErr
+			if result != nil {
+				result.Error = err
+			}
+		}
+	}
+	return result, err
+}
+
+// memoryConfig is an agent's parsed `memory` property.
+type memoryConfig struct {
+	maxMessages int
+}
+
+// getAgentMemory reads an agent's `memory` property. It returns nil if the
+// agent declares none.
+func getAgentMemory(agent ast.Entity) (*memoryConfig, error) {
+	prop, ok := agent.GetProperty("memory")
+	if !ok {
+		return nil, nil
+	}
+	obj, ok := prop.(ast.ObjectValue)
+	if !ok {
+		return nil, fmt.Errorf("agent %q: 'memory' must be an object", agent.Name())
+	}
+
+	memType := MemoryBuffer
+	if tv, ok := obj.Properties["type"]; ok {
+		sv, ok := tv.(ast.StringValue)
+		if !ok {
+			return nil, fmt.Errorf("agent %q: memory 'type' must be a string", agent.Name())
+		}
+		memType = sv.Value
+	}
+	if memType != MemoryBuffer {
+		return nil, fmt.Errorf("agent %q: unknown memory type %q", agent.Name(), memType)
+	}
+
+	cfg := &memoryConfig{maxMessages: DefaultMemoryMessages}
+	if mv, ok := obj.Properties["max_messages"]; ok {
+		nv, ok := mv.(ast.NumberValue)
+		if !ok || nv.Value < 1 || nv.Value != math.Trunc(nv.Value) {
+			return nil, fmt.Errorf("agent %q: memory 'max_messages' must be a positive integer", agent.Name())
+		}
+		cfg.maxMessages = int(nv.Value)
+	}
+	return cfg, nil
+}
+
+// sessionHistory returns the messages an agent remembers from earlier turns
+// of the session, and its memory configuration. Both are nil outside a
+// session or for agents without memory.
+func (ec *ExecutionContext) sessionHistory(agent ast.Entity) ([]Message, *memoryConfig, error) {
+	if ec.session == nil {
+		return nil, nil, nil
+	}
+	cfg, err := getAgentMemory(agent)
+	if err != nil || cfg == nil {
+		return nil, nil, err
+	}
+	ec.session.mu.Lock()
+	defer ec.session.mu.Unlock()
+	return append([]Message(nil), ec.session.Messages[agent.Name()]...), cfg, nil
+}
+
+// remember adds a turn to an agent's conversation in the session, keeping
+// only the most recent cfg.maxMessages messages. A conversation never starts
+// with an assistant message.
+func (ec *ExecutionContext) remember(agent ast.Entity, cfg *memoryConfig, prompt, answer string) {
+	if ec.session == nil || cfg == nil {
+		return
+	}
+	ec.session.mu.Lock()
+	defer ec.session.mu.Unlock()
+	msgs := append(ec.session.Messages[agent.Name()],
+		Message{Role: RoleUser, Content: prompt},
+		Message{Role: RoleAssistant, Content: answer},
+	)
+	if len(msgs) > cfg.maxMessages {
+		msgs = msgs[len(msgs)-cfg.maxMessages:]
+	}
+	for len(msgs) > 0 && msgs[0].Role != RoleUser {
+		msgs = msgs[1:]
+	}
+	ec.session.Messages[agent.Name()] = msgs
+}
@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const sessionSource = `
+agent "assistant" {
+	model: "mock-model"
+	memory: { type: "buffer" max_messages: 4 }
+}
+
+agent "forgetful" {
+	model: "mock-model"
+}
+
+intent "chat" {
+	use: agent("assistant")
+	input: $input
+}
+
+intent "oneshot" {
+	use: agent("forgetful")
+	input: $input
+}
+`
+
+func newSessionRuntime(t *testing.T, opts ...Option) (*Runtime, *MockProvider, *workspace.Workspace) {
+	t.Helper()
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, sessionSource))
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "one"},
+		MockResponse{Content: "two"},
+		MockResponse{Content: "three"},
+	))
+	rt := New(ws, append([]Option{WithProvider("mock", provider)}, opts...)...)
+	return rt, provider, ws
+}
+
+func TestExecuteInSession_RemembersTurns(t *testing.T) {
+	rt, provider, ws := newSessionRuntime(t)
+	intent, _ := ws.GetEntityByName("intent", "chat")
+
+	for _, input := range []string{"first", "second", "third"} {
+		if _, err := rt.ExecuteInSession(context.Background(), "s1", intent, WithInput(input)); err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+	}
+
+	requests := provider.GetRequests()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	second := requests[1].Messages
+	if len(second) != 3 || !strings.Contains(second[0].Content, "first") || second[1].Content != "one" || !strings.Contains(second[2].Content, "second") {
+		t.Errorf("expected the first turn before the second prompt, got %+v", second)
+	}
+	// max_messages: 4 keeps the last two turns
+	third := requests[2].Messages
+	if len(third) != 5 || !strings.Contains(third[0].Content, "first") {
+		t.Errorf("expected both earlier turns, got %+v", third)
+	}
+
+	session, err := rt.sessions.Load("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := session.Messages["assistant"]
+	if len(msgs) != 4 || !strings.Contains(msgs[0].Content, "second") || msgs[3].Content != "three" {
+		t.Errorf("expected the buffer to keep the last 4 messages, got %+v", msgs)
+	}
+}
+
+func TestExecuteInSession_Isolation(t *testing.T) {
+	rt, provider, ws := newSessionRuntime(t)
+	chat, _ := ws.GetEntityByName("intent", "chat")
+	oneshot, _ := ws.GetEntityByName("intent", "oneshot")
+
+	if _, err := rt.ExecuteInSession(context.Background(), "a", chat, WithInput("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.ExecuteInSession(context.Background(), "b", chat, WithInput("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.ExecuteInSession(context.Background(), "a", oneshot, WithInput("again")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, req := range provider.GetRequests() {
+		if len(req.Messages) != 1 {
+			t.Errorf("request %d: expected no history, got %+v", i, req.Messages)
+		}
+	}
+}
+
+func TestExecuteInSession_InvalidMemory(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "assistant" {
+	model: "mock-model"
+	memory: { type: "vector" }
+}
+
+intent "chat" {
+	use: agent("assistant")
+	input: "hi"
+}
+`))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "ok"}))
+	rt := New(ws, WithProvider("mock", provider))
+	intent, _ := ws.GetEntityByName("intent", "chat")
+
+	_, err := rt.ExecuteInSession(context.Background(), "s1", intent)
+	if err == nil || !strings.Contains(err.Error(), `unknown memory type "vector"`) {
+		t.Errorf("expected an unknown memory type error, got %v", err)
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, provider, ws := newSessionRuntime(t, WithSessionStore(store))
+	intent, _ := ws.GetEntityByName("intent", "chat")
+	if _, err := rt.ExecuteInSession(context.Background(), "s1", intent, WithInput("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new runtime continues the session from disk
+	reopened, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt2 := New(ws, WithProvider("mock", provider), WithSessionStore(reopened))
+	if _, err := rt2.ExecuteInSession(context.Background(), "s1", intent, WithInput("second")); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := provider.GetRequests()[1].Messages; len(msgs) != 3 || msgs[1].Content != "one" {
+		t.Errorf("expected the stored turn, got %+v", msgs)
+	}
+
+	if _, err := store.Load("../escape"); err == nil {
+		t.Error("expected an error for an ID with a path separator")
+	}
+	if _, err := rt.ExecuteInSession(context.Background(), "", intent); err == nil {
+		t.Error("expected an error for an empty session ID")
+	}
+}
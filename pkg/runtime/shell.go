@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Shells a shell tool can run its command in.
+const (
+	ShellSh         = "sh"
+	ShellBash       = "bash"
+	ShellCmd        = "cmd"
+	ShellPowerShell = "powershell"
+	ShellPwsh       = "pwsh"
+)
+
+// shellArgs returns the command line that runs command in the named shell.
+func shellArgs(shell, command string) ([]string, error) {
+	switch shell {
+	case ShellSh, ShellBash:
+		return []string{shell, "-c", command}, nil
+	case ShellCmd:
+		// /d skips AutoRun commands; /s keeps the quotes around command
+		return []string{"cmd", "/d", "/s", "/c", command}, nil
+	case ShellPowerShell, ShellPwsh:
+		return []string{shell, "-NoProfile", "-NonInteractive", "-Command", command}, nil
+	default:
+		return nil, fmt.Errorf("unknown shell %q (want sh, bash, cmd, powershell or pwsh)", shell)
+	}
+}
+
+// shellCommand returns a command that runs command in the named shell, or in
+// the platform's default shell (sh, or cmd on Windows) if shell is empty.
+func shellCommand(ctx context.Context, shell, command string) (*exec.Cmd, error) {
+	if shell == "" {
+		shell = defaultShell
+	}
+	args, err := shellArgs(shell, command)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	prepareShell(cmd, shell, command)
+	return cmd, nil
+}
+
+// entityShell reads the `shell` property of a tool or shell handler.
+func entityShell(entity ast.Entity) (string, error) {
+	prop, ok := entity.GetProperty("shell")
+	if !ok {
+		return "", nil
+	}
+	sv, ok := prop.(ast.StringValue)
+	if !ok {
+		return "", fmt.Errorf("'shell' must be a string")
+	}
+	if _, err := shellArgs(sv.Value, ""); err != nil {
+		return "", err
+	}
+	return sv.Value, nil
+}
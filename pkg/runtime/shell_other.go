@@ -0,0 +1,12 @@
+//go:build !windows
+
+package runtime
+
+import "os/exec"
+
+// defaultShell runs shell tools that do not name a shell.
+const defaultShell = ShellSh
+
+// prepareShell needs to do nothing outside Windows, where arguments reach
+// the shell as they are.
+func prepareShell(cmd *exec.Cmd, shell, command string) {}
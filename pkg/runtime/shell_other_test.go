@@ -0,0 +1,31 @@
+//go:build !windows
+
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestExecuteToolCall_DefaultShell(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+tool "which" {
+	handler: shell {
+		command: "echo $0"
+	}
+}
+`))
+	rt := New(ws)
+	ctx := &ExecutionContext{Context: context.Background(), Runtime: rt, Workspace: ws, Variables: make(map[string]interface{})}
+
+	got, err := rt.executeToolCall(ctx, ToolCall{Name: "which"}, NewResolver(ctx))
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if got != "sh\n" {
+		t.Errorf("expected the command to run in sh, got %q", got)
+	}
+}
@@ -0,0 +1,51 @@
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func TestShellArgs(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{ShellSh, []string{"sh", "-c", "echo hi"}},
+		{ShellBash, []string{"bash", "-c", "echo hi"}},
+		{ShellCmd, []string{"cmd", "/d", "/s", "/c", "echo hi"}},
+		{ShellPowerShell, []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+		{ShellPwsh, []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+	}
+	for _, tt := range tests {
+		got, err := shellArgs(tt.shell, "echo hi")
+		if err != nil {
+			t.Errorf("%s: %v", tt.shell, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+
+	if _, err := shellArgs("zsh", "echo hi"); err == nil || !strings.Contains(err.Error(), `unknown shell "zsh"`) {
+		t.Errorf("expected an unknown shell error, got %v", err)
+	}
+}
+
+func TestEntityShell(t *testing.T) {
+	tool := ast.NewToolEntity("t")
+	if shell, err := entityShell(tool); err != nil || shell != "" {
+		t.Errorf("expected the default shell, got %q, %v", shell, err)
+	}
+	tool.SetProperty("shell", ast.StringValue{Value: "powershell"})
+	if shell, err := entityShell(tool); err != nil || shell != ShellPowerShell {
+		t.Errorf("expected powershell, got %q, %v", shell, err)
+	}
+	tool.SetProperty("shell", ast.StringValue{Value: "fish"})
+	if _, err := entityShell(tool); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package runtime
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// defaultShell runs shell tools that do not name a shell.
+const defaultShell = ShellCmd
+
+// prepareShell passes the command to cmd.exe verbatim. cmd does not follow
+// the argument quoting exec uses, so quotes inside the command would
+// otherwise be escaped with backslashes it does not understand.
+func prepareShell(cmd *exec.Cmd, shell, command string) {
+	if shell != ShellCmd {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd /d /s /c "` + command + `"`}
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestShellCommand_CmdLine(t *testing.T) {
+	cmd, err := shellCommand(context.Background(), "", `echo "a b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.CmdLine != `cmd /d /s /c "echo "a b""` {
+		t.Errorf("expected the command to be passed to cmd verbatim, got %+v", cmd.SysProcAttr)
+	}
+}
+
+func TestExecuteToolCall_DefaultShell(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+tool "greet" {
+	handler: shell {
+		command: `+"```"+`echo "a b"`+"```"+`
+	}
+}
+`))
+	rt := New(ws)
+	ctx := &ExecutionContext{Context: context.Background(), Runtime: rt, Workspace: ws, Variables: make(map[string]interface{})}
+
+	got, err := rt.executeToolCall(ctx, ToolCall{Name: "greet"}, NewResolver(ctx))
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if got != "\"a b\"\r\n" {
+		t.Errorf("expected the command to run in cmd, got %q", got)
+	}
+}
@@ -0,0 +1,196 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// StepSnapshot records one model call made by a pipeline step: the fully
+// resolved request, after interpolation and with its tool schemas, and the
+// provider's response. Replaying the request reproduces the call exactly.
+type StepSnapshot struct {
+	Time     time.Time `json:"time"`
+	Pipeline string    `json:"pipeline"`
+	Step     string    `json:"step"`
+
+	// Call numbers the step's model calls from 1; retries, samples, and
+	// schema repairs each make a call
+	Call int `json:"call"`
+
+	Request  *CompletionRequest  `json:"request"`
+	Response *CompletionResponse `json:"response,omitempty"`
+	Error    string              `json:"error,omitempty"`
+	Duration time.Duration       `json:"duration"`
+
+	// Metadata is the execution metadata (e.g. the trigger that started it)
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SnapshotStore saves step snapshots. Implementations must be safe for
+// concurrent use.
+type SnapshotStore interface {
+	Save(snapshot StepSnapshot) error
+}
+
+// MemorySnapshotStore keeps step snapshots in memory.
+type MemorySnapshotStore struct {
+	mu        sync.RWMutex
+	snapshots []StepSnapshot
+}
+
+// NewMemorySnapshotStore creates an empty in-memory snapshot store.
+func NewMemorySnapshotStore() *MemorySnapshotStore {
+	return &MemorySnapshotStore{}
+}
+
+// Save adds a snapshot.
+func (s *MemorySnapshotStore) Save(snapshot StepSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+// Snapshots returns a copy of the saved snapshots, oldest first.
+func (s *MemorySnapshotStore) Snapshots() []StepSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]StepSnapshot(nil), s.snapshots...)
+}
+
+// DiskSnapshotStore writes each step snapshot to its own JSON file, at
+// <dir>/<pipeline>/<time>-<step>-<call>.json.
+type DiskSnapshotStore struct {
+	dir string
+}
+
+// NewDiskSnapshotStore creates a snapshot store in dir, creating it if
+// needed.
+func NewDiskSnapshotStore(dir string) (*DiskSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &DiskSnapshotStore{dir: dir}, nil
+}
+
+// Save writes a snapshot.
+func (s *DiskSnapshotStore) Save(snapshot StepSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	dir := filepath.Join(s.dir, snapshotFileName(snapshot.Pipeline))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%d.json", snapshot.Time.UTC().Format("20060102T150405.000000000Z"), snapshotFileName(snapshot.Step), snapshot.Call)
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshotFileName makes an entity name safe to use as a file name.
+func snapshotFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// WithSnapshotStore sets the store receiving step snapshots from pipelines
+// that declare `snapshot: true`. Without a store, the property is ignored.
+func WithSnapshotStore(store SnapshotStore) Option {
+	return func(r *Runtime) {
+		r.snapshotStore = store
+	}
+}
+
+// getPipelineSnapshot reports whether a pipeline asks for its steps to be
+// snapshotted.
+func getPipelineSnapshot(pipeline ast.Entity) (bool, error) {
+	prop, ok := pipeline.GetProperty("snapshot")
+	if !ok {
+		return false, nil
+	}
+	b, ok := prop.(ast.BoolValue)
+	if !ok {
+		return false, fmt.Errorf("pipeline %q: 'snapshot' must be true or false", pipeline.Name())
+	}
+	return b.Value, nil
+}
+
+// snapshotProvider saves a snapshot of every call made through it.
+type snapshotProvider struct {
+	LLMProvider
+	store    SnapshotStore
+	pipeline string
+	step     string
+	metadata map[string]string
+	calls    atomic.Int64
+}
+
+// snapshotStep wraps the provider of a step so its calls are snapshotted, if
+// the pipeline asks for it.
+func (r *Runtime) snapshotStep(ctx *ExecutionContext, step *ast.StepEntity, provider LLMProvider) LLMProvider {
+	if !ctx.snapshotSteps || r.snapshotStore == nil {
+		return provider
+	}
+	return &snapshotProvider{
+		LLMProvider: provider,
+		store:       r.snapshotStore,
+		pipeline:    ctx.entityName,
+		step:        step.Name(),
+		metadata:    ctx.Metadata,
+	}
+}
+
+func (p *snapshotProvider) save(ctx context.Context, req *CompletionRequest, start time.Time, resp *CompletionResponse, err error) {
+	// Later calls (e.g. schema repairs) extend the request's messages
+	reqCopy := *req
+	reqCopy.Messages = append([]Message(nil), req.Messages...)
+	snapshot := StepSnapshot{
+		Time:     start,
+		Pipeline: p.pipeline,
+		Step:     p.step,
+		Call:     int(p.calls.Add(1)),
+		Request:  &reqCopy,
+		Response: resp,
+		Duration: time.Since(start),
+		Metadata: p.metadata,
+	}
+	if err != nil {
+		snapshot.Error = err.Error()
+	}
+	if err := p.store.Save(snapshot); err != nil {
+		logAt(ctx, slog.LevelWarn, "failed to save step snapshot", "error", err)
+	}
+}
+
+// Complete sends a completion request and saves a snapshot of it.
+func (p *snapshotProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	start := time.Now()
+	resp, err := p.LLMProvider.Complete(ctx, req)
+	p.save(ctx, req, start, resp, err)
+	return resp, err
+}
+
+// CompleteStream streams a completion and saves a snapshot of it.
+func (p *snapshotProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	start := time.Now()
+	resp, err := p.LLMProvider.CompleteStream(ctx, req, handler)
+	p.save(ctx, req, start, resp, err)
+	return resp, err
+}
@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const snapshotSource = `
+agent "writer" {
+	model: "mock-model"
+	instruction: "You write."
+}
+
+pipeline "draft" {
+	snapshot: true
+
+	step "outline" {
+		use: agent("writer")
+		input: $input
+	}
+	step "write" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+}
+`
+
+func TestExecute_StepSnapshots(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, snapshotSource))
+
+	store := NewMemorySnapshotStore()
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{Content: "an outline"},
+		MockResponse{Error: &APIError{StatusCode: 500, Body: "overloaded"}},
+	))
+	cfg := DefaultConfig()
+	cfg.EnableStreaming = false
+	rt := New(ws, WithConfig(cfg), WithProvider("mock", provider), WithSnapshotStore(store))
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	_, err := rt.Execute(context.Background(), pipeline, WithInput("a topic"), WithMetadata("trigger", "nightly"))
+	if err == nil {
+		t.Fatal("expected the second step to fail")
+	}
+
+	snapshots := store.Snapshots()
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+	outline, write := snapshots[0], snapshots[1]
+	if outline.Pipeline != "draft" || outline.Step != "outline" || outline.Call != 1 {
+		t.Errorf("unexpected snapshot identity: %+v", outline)
+	}
+	if outline.Request.SystemPrompt != "You write." || !strings.Contains(outline.Request.Messages[0].Content, "a topic") {
+		t.Errorf("snapshot should hold the resolved request, got %+v", outline.Request)
+	}
+	if outline.Response == nil || outline.Response.Content != "an outline" {
+		t.Errorf("snapshot should hold the response, got %+v", outline.Response)
+	}
+	if outline.Metadata["trigger"] != "nightly" {
+		t.Errorf("snapshot metadata = %v", outline.Metadata)
+	}
+	if !strings.Contains(write.Request.Messages[0].Content, "an outline") {
+		t.Errorf("failed step request = %+v, want the interpolated outline", write.Request)
+	}
+	if write.Response != nil || !strings.Contains(write.Error, "overloaded") {
+		t.Errorf("failed step snapshot should record the error, got %+v", write)
+	}
+}
+
+func TestExecute_StepSnapshotsDisabled(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, strings.Replace(snapshotSource, "snapshot: true", "snapshot: false", 1)))
+
+	store := NewMemorySnapshotStore()
+	rt := New(ws, WithProvider("mock", NewMockProvider()), WithSnapshotStore(store))
+	pipeline, _ := ws.GetEntityByName("pipeline", "draft")
+	if _, err := rt.Execute(context.Background(), pipeline, WithInput("a topic")); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if n := len(store.Snapshots()); n != 0 {
+		t.Errorf("expected no snapshots, got %d", n)
+	}
+}
+
+func TestDiskSnapshotStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskSnapshotStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := StepSnapshot{
+		Pipeline: "nightly/report",
+		Step:     "summarize",
+		Call:     2,
+		Request:  &CompletionRequest{Model: "mock-model", Messages: []Message{{Role: RoleUser, Content: "hi"}}},
+		Response: &CompletionResponse{Content: "hello"},
+	}
+	if err := store.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "nightly_report", "*-summarize-2.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one snapshot file, got %v (err %v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got StepSnapshot
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Request.Messages[0].Content != "hi" || got.Response.Content != "hello" {
+		t.Errorf("round-tripped snapshot = %+v", got)
+	}
+}
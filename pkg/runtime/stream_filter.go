@@ -0,0 +1,296 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// TextFilter transforms streamed text. Filter is given the text of each
+// content chunk in turn and returns the text to pass on; it may hold text
+// back until later chunks show what to do with it. Flush returns the text
+// held back when the stream ends.
+type TextFilter interface {
+	Filter(text string) string
+	Flush() string
+}
+
+// FilterText returns middleware that passes the content of chunks through
+// a filter made by newFilter for each stream. The content of the complete
+// response is filtered the same way, by a filter of its own, so handlers
+// that use it see what they were streamed.
+func FilterText(newFilter func() TextFilter) StreamMiddleware {
+	return func(next StreamHandler) StreamHandler {
+		return &textFilterHandler{StreamHandler: next, filter: newFilter(), newFilter: newFilter}
+	}
+}
+
+type textFilterHandler struct {
+	StreamHandler
+	newFilter func() TextFilter
+
+	mu     sync.Mutex
+	filter TextFilter
+	index  int
+}
+
+func (h *textFilterHandler) OnChunk(chunk StreamChunk) {
+	if chunk.Type != ChunkTypeContent {
+		h.StreamHandler.OnChunk(chunk)
+		return
+	}
+	h.mu.Lock()
+	chunk.Content = h.filter.Filter(chunk.Content)
+	h.index = chunk.Index
+	h.mu.Unlock()
+	if chunk.Content != "" || chunk.Delta != nil {
+		h.StreamHandler.OnChunk(chunk)
+	}
+}
+
+// flush passes on the text the filter held back.
+func (h *textFilterHandler) flush() {
+	h.mu.Lock()
+	rest := h.filter.Flush()
+	index := h.index + 1
+	h.mu.Unlock()
+	if rest != "" {
+		h.StreamHandler.OnChunk(StreamChunk{Content: rest, Type: ChunkTypeContent, Index: index})
+	}
+}
+
+func (h *textFilterHandler) OnComplete(response *CompletionResponse) {
+	h.flush()
+	if response != nil {
+		filtered := *response
+		f := h.newFilter()
+		filtered.Content = f.Filter(response.Content) + f.Flush()
+		response = &filtered
+	}
+	h.StreamHandler.OnComplete(response)
+}
+
+func (h *textFilterHandler) OnError(err error) {
+	h.flush()
+	h.StreamHandler.OnError(err)
+}
+
+// lineFilter is a TextFilter that passes text on a line at a time through
+// fn, which is given each line with its newline, if any.
+type lineFilter struct {
+	fn      func(line string) string
+	partial string
+}
+
+func (f *lineFilter) Filter(text string) string {
+	f.partial += text
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		out.WriteString(f.fn(f.partial[:i+1]))
+		f.partial = f.partial[i+1:]
+	}
+	return out.String()
+}
+
+func (f *lineFilter) Flush() string {
+	if f.partial == "" {
+		return ""
+	}
+	line := f.partial
+	f.partial = ""
+	return f.fn(line)
+}
+
+// StripFences removes the lines of Markdown code fences, such as ```json,
+// so a model's fenced answer streams as the bare code. Text is passed on a
+// line at a time.
+func StripFences() StreamMiddleware {
+	return FilterText(func() TextFilter {
+		return &lineFilter{fn: func(line string) string {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				return ""
+			}
+			return line
+		}}
+	})
+}
+
+// secretPatterns match common credentials: API keys of model providers,
+// AWS access keys, GitHub and Slack tokens, and bearer tokens.
+var secretPatterns = regexp.MustCompile(strings.Join([]string{
+	`sk-[A-Za-z0-9_-]{20,}`,
+	`AKIA[0-9A-Z]{16}`,
+	`gh[pousr]_[A-Za-z0-9]{36,}`,
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,
+	`(?i:bearer)\s+[A-Za-z0-9._~+/-]{20,}=*`,
+}, "|"))
+
+// RedactSecrets replaces text that looks like a credential, such as an API
+// key or a bearer token, with [REDACTED]. Text is passed on a line at a
+// time, so a key split across chunks is still found.
+func RedactSecrets() StreamMiddleware {
+	return FilterText(func() TextFilter {
+		return &lineFilter{fn: func(line string) string {
+			return secretPatterns.ReplaceAllString(line, "[REDACTED]")
+		}}
+	})
+}
+
+// ExtractJSON passes on only the first JSON object or array in the text,
+// dropping prose and code fences around it, as soon as each part of it
+// arrives.
+func ExtractJSON() StreamMiddleware {
+	return FilterText(func() TextFilter { return &jsonExtractor{} })
+}
+
+// jsonExtractor tracks where it is in the first JSON value of a text.
+type jsonExtractor struct {
+	depth    int
+	inString bool
+	escaped  bool
+	done     bool
+}
+
+func (j *jsonExtractor) Filter(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text) && !j.done; i++ {
+		c := text[i]
+		if j.depth == 0 {
+			if c != '{' && c != '[' {
+				continue
+			}
+		}
+		out.WriteByte(c)
+		switch {
+		case j.inString:
+			switch {
+			case j.escaped:
+				j.escaped = false
+			case c == '\\':
+				j.escaped = true
+			case c == '"':
+				j.inString = false
+			}
+		case c == '"':
+			j.inString = true
+		case c == '{' || c == '[':
+			j.depth++
+		case c == '}' || c == ']':
+			j.depth--
+			j.done = j.depth == 0
+		}
+	}
+	return out.String()
+}
+
+func (j *jsonExtractor) Flush() string {
+	return ""
+}
+
+// ANSI escapes that Colorize uses.
+const (
+	ansiDim   = "\x1b[2m"
+	ansiCyan  = "\x1b[36m"
+	ansiReset = "\x1b[0m"
+)
+
+// Colorize marks chunks for a terminal with ANSI colors: reasoning dim,
+// and the start and end of tool calls cyan. Content is unchanged.
+func Colorize() StreamMiddleware {
+	return TransformChunks(func(chunk StreamChunk) StreamChunk {
+		if chunk.Content == "" {
+			return chunk
+		}
+		switch chunk.Type {
+		case ChunkTypeReasoning:
+			chunk.Content = ansiDim + chunk.Content + ansiReset
+		case ChunkTypeToolStart, ChunkTypeToolEnd:
+			chunk.Content = ansiCyan + chunk.Content + ansiReset
+		}
+		return chunk
+	})
+}
+
+var (
+	streamFilters = map[string]StreamMiddleware{
+		"strip_fences": StripFences(),
+		"json":         ExtractJSON(),
+		"redact":       RedactSecrets(),
+		"colorize":     Colorize(),
+	}
+	streamFiltersMu sync.RWMutex
+)
+
+// RegisterStreamFilter registers middleware under a name that steps and
+// intents can list in `stream_filters`. The middleware wraps the handler
+// of each model call, so state it keeps is per stream.
+//
+// Example:
+//
+//	runtime.RegisterStreamFilter("upper", runtime.TransformChunks(func(c runtime.StreamChunk) runtime.StreamChunk {
+//	    c.Content = strings.ToUpper(c.Content)
+//	    return c
+//	}))
+func RegisterStreamFilter(name string, filter StreamMiddleware) {
+	streamFiltersMu.Lock()
+	defer streamFiltersMu.Unlock()
+	streamFilters[name] = filter
+}
+
+// StreamFilters returns the names of the registered stream filters, sorted.
+func StreamFilters() []string {
+	streamFiltersMu.RLock()
+	defer streamFiltersMu.RUnlock()
+	names := make([]string, 0, len(streamFilters))
+	for name := range streamFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getStreamFilters returns the filters an entity lists in `stream_filters`,
+// in order:
+//
+//	step "answer" {
+//	    use: agent("writer")
+//	    stream_filters: ["strip_fences", "redact"]
+//	}
+func getStreamFilters(entity ast.Entity) ([]StreamMiddleware, error) {
+	prop, ok := entity.GetProperty("stream_filters")
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := prop.(ast.ArrayValue)
+	if !ok {
+		return nil, fmt.Errorf("%s %q: 'stream_filters' must be a list of filter names", entity.Type(), entity.Name())
+	}
+	streamFiltersMu.RLock()
+	defer streamFiltersMu.RUnlock()
+	filters := make([]StreamMiddleware, 0, len(arr.Elements))
+	for _, elem := range arr.Elements {
+		name, ok := elem.(ast.StringValue)
+		if !ok {
+			return nil, fmt.Errorf("%s %q: 'stream_filters' must be a list of filter names", entity.Type(), entity.Name())
+		}
+		filter, ok := streamFilters[name.Value]
+		if !ok {
+			names := make([]string, 0, len(streamFilters))
+			for n := range streamFilters {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%s %q: unknown stream filter %q (registered: %s)", entity.Type(), entity.Name(), name.Value, strings.Join(names, ", "))
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
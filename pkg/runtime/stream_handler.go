@@ -0,0 +1,112 @@
+package runtime
+
+import "sync/atomic"
+
+// MultiStreamHandler forwards every callback to each of its handlers in
+// turn, e.g. to stream to a terminal, an SSE client, and a log file at once.
+type MultiStreamHandler []StreamHandler
+
+// NewMultiStreamHandler returns a handler that forwards to the non-nil
+// handlers given.
+//
+// Example:
+//
+//	handler := runtime.NewMultiStreamHandler(terminal, sse, log)
+//	rt.Execute(ctx, pipeline, runtime.WithStreamHandler(handler))
+func NewMultiStreamHandler(handlers ...StreamHandler) MultiStreamHandler {
+	m := make(MultiStreamHandler, 0, len(handlers))
+	for _, h := range handlers {
+		if h != nil {
+			m = append(m, h)
+		}
+	}
+	return m
+}
+
+func (m MultiStreamHandler) OnChunk(chunk StreamChunk) {
+	for _, h := range m {
+		h.OnChunk(chunk)
+	}
+}
+
+func (m MultiStreamHandler) OnProgress(event ProgressEvent) {
+	for _, h := range m {
+		h.OnProgress(event)
+	}
+}
+
+func (m MultiStreamHandler) OnComplete(response *CompletionResponse) {
+	for _, h := range m {
+		h.OnComplete(response)
+	}
+}
+
+func (m MultiStreamHandler) OnError(err error) {
+	for _, h := range m {
+		h.OnError(err)
+	}
+}
+
+// StreamMiddleware wraps a StreamHandler to change what reaches it.
+type StreamMiddleware func(next StreamHandler) StreamHandler
+
+// WrapStreamHandler applies middleware to h. The first middleware sees
+// callbacks first.
+//
+// Example:
+//
+//	// Log every 10th content chunk
+//	logged := runtime.WrapStreamHandler(log,
+//	    runtime.FilterChunks(func(c runtime.StreamChunk) bool { return c.Type == runtime.ChunkTypeContent }),
+//	    runtime.SampleChunks(10),
+//	)
+func WrapStreamHandler(h StreamHandler, middleware ...StreamMiddleware) StreamHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// chunkHandler passes chunks through fn, which forwards them to the wrapped
+// handler or drops them; other callbacks go straight through.
+type chunkHandler struct {
+	StreamHandler
+	fn func(next StreamHandler, chunk StreamChunk)
+}
+
+func (h *chunkHandler) OnChunk(chunk StreamChunk) {
+	h.fn(h.StreamHandler, chunk)
+}
+
+// FilterChunks passes on only the chunks keep returns true for.
+func FilterChunks(keep func(StreamChunk) bool) StreamMiddleware {
+	return func(next StreamHandler) StreamHandler {
+		return &chunkHandler{StreamHandler: next, fn: func(next StreamHandler, chunk StreamChunk) {
+			if keep(chunk) {
+				next.OnChunk(chunk)
+			}
+		}}
+	}
+}
+
+// TransformChunks passes on fn(chunk) in place of each chunk.
+func TransformChunks(fn func(StreamChunk) StreamChunk) StreamMiddleware {
+	return func(next StreamHandler) StreamHandler {
+		return &chunkHandler{StreamHandler: next, fn: func(next StreamHandler, chunk StreamChunk) {
+			next.OnChunk(fn(chunk))
+		}}
+	}
+}
+
+// SampleChunks passes on the first of every n chunks, for consumers such as
+// logs and metrics that do not need every chunk.
+func SampleChunks(n int) StreamMiddleware {
+	return func(next StreamHandler) StreamHandler {
+		var seen atomic.Int64
+		return &chunkHandler{StreamHandler: next, fn: func(next StreamHandler, chunk StreamChunk) {
+			if n <= 1 || (seen.Add(1)-1)%int64(n) == 0 {
+				next.OnChunk(chunk)
+			}
+		}}
+	}
+}
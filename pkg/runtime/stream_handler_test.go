@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMultiStreamHandler(t *testing.T) {
+	a, b := &BufferedStreamHandler{}, &BufferedStreamHandler{}
+	m := NewMultiStreamHandler(a, nil, b)
+	if len(m) != 2 {
+		t.Fatalf("expected nil handlers to be skipped, got %d handlers", len(m))
+	}
+
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "hello world"}), WithMockChunkSize(3))
+	if _, err := provider.CompleteStream(context.Background(), &CompletionRequest{}, m); err != nil {
+		t.Fatal(err)
+	}
+	m.OnProgress(ProgressEvent{Type: ProgressTypeStep})
+	m.OnError(errors.New("boom"))
+
+	for name, h := range map[string]*BufferedStreamHandler{"a": a, "b": b} {
+		if h.Content() != "hello world" {
+			t.Errorf("handler %s content = %q", name, h.Content())
+		}
+		if h.Response == nil || len(h.Events) != 1 || h.Err == nil {
+			t.Errorf("handler %s missed callbacks: %+v", name, h)
+		}
+	}
+}
+
+func TestWrapStreamHandler(t *testing.T) {
+	out := &BufferedStreamHandler{}
+	h := WrapStreamHandler(out,
+		FilterChunks(func(c StreamChunk) bool { return c.Type == ChunkTypeContent }),
+		TransformChunks(func(c StreamChunk) StreamChunk {
+			c.Content = strings.ToUpper(c.Content)
+			return c
+		}),
+	)
+
+	h.OnChunk(StreamChunk{Type: ChunkTypeReasoning, Content: "thinking"})
+	h.OnChunk(StreamChunk{Type: ChunkTypeContent, Content: "hi "})
+	h.OnChunk(StreamChunk{Type: ChunkTypeContent, Content: "there"})
+	h.OnProgress(ProgressEvent{Type: ProgressTypeComplete})
+
+	if got := out.Content(); got != "HI THERE" {
+		t.Errorf("content = %q, want %q", got, "HI THERE")
+	}
+	if len(out.Chunks) != 2 {
+		t.Errorf("expected the reasoning chunk to be filtered, got %d chunks", len(out.Chunks))
+	}
+	if len(out.Events) != 1 {
+		t.Errorf("expected progress to pass through, got %d events", len(out.Events))
+	}
+}
+
+func TestSampleChunks(t *testing.T) {
+	out := &BufferedStreamHandler{}
+	h := WrapStreamHandler(out, SampleChunks(3))
+	for i := 0; i < 7; i++ {
+		h.OnChunk(StreamChunk{Index: i})
+	}
+	var got []int
+	for _, c := range out.Chunks {
+		got = append(got, c.Index)
+	}
+	if len(got) != 3 || got[0] != 0 || got[1] != 3 || got[2] != 6 {
+		t.Errorf("sampled chunks %v, want [0 3 6]", got)
+	}
+}
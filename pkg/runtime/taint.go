@@ -0,0 +1,295 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// TaintPolicy controls what happens when untrusted content (step outputs and
+// tool results) flows into a tool argument that reaches a shell command, a
+// SQL query, or an HTTP URL.
+type TaintPolicy string
+
+const (
+	// TaintOff disables taint checks.
+	TaintOff TaintPolicy = ""
+
+	// TaintWarn logs the flow and runs the tool.
+	TaintWarn TaintPolicy = "warn"
+
+	// TaintBlock refuses to run the tool. The error is reported to the model
+	// like any other tool failure.
+	TaintBlock TaintPolicy = "block"
+)
+
+// TaintSink is a kind of tool argument where untrusted content is dangerous.
+type TaintSink string
+
+const (
+	SinkShell TaintSink = "shell"
+	SinkSQL   TaintSink = "sql"
+	SinkURL   TaintSink = "url"
+)
+
+// minTaintLength is the shortest fragment tracked; shorter strings are too
+// common to attribute to an untrusted source.
+const minTaintLength = 8
+
+// sinkMetachars are the characters that change the meaning of a shell command
+// or SQL query. Any untrusted content in a URL is flagged.
+var sinkMetachars = map[TaintSink]string{
+	SinkShell: ";&|`$<>()\\'\"\n*?~",
+	SinkSQL:   "';\"\\",
+}
+
+// TaintError reports untrusted content flowing into a tool argument.
+type TaintError struct {
+	Tool     string
+	Argument string
+	Sink     TaintSink
+}
+
+func (e *TaintError) Error() string {
+	return fmt.Sprintf("untrusted content in argument %q of tool %q flows into a %s sink", e.Argument, e.Tool, e.Sink)
+}
+
+// TaintTracker records untrusted values seen during an execution. Values are
+// tracked by content: an argument is tainted when it contains a line of an
+// untrusted value verbatim, or is itself part of one.
+type TaintTracker struct {
+	fragments []string
+	mu        sync.RWMutex
+}
+
+// NewTaintTracker creates an empty tracker.
+func NewTaintTracker() *TaintTracker {
+	return &TaintTracker{}
+}
+
+// Mark records value as untrusted. A nil tracker ignores it.
+func (t *TaintTracker) Mark(value interface{}) {
+	if t == nil || value == nil {
+		return
+	}
+	var text string
+	if s, ok := value.(string); ok {
+		text = s
+	} else if data, err := json.Marshal(value); err == nil {
+		text = string(data)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= minTaintLength {
+			t.fragments = append(t.fragments, line)
+		}
+	}
+}
+
+// Tainted reports whether s contains or is part of an untrusted value.
+func (t *TaintTracker) Tainted(s string) bool {
+	if t == nil || len(s) < minTaintLength {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, f := range t.fragments {
+		if strings.Contains(s, f) || strings.Contains(f, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTaint applies the runtime's taint policy to a tool call. It returns a
+// *TaintError under TaintBlock; under TaintWarn the flow is only logged.
+func (r *Runtime) checkTaint(ctx *ExecutionContext, tool ast.Entity, tc ToolCall) error {
+	if r.config.TaintPolicy == TaintOff || ctx.Taint == nil {
+		return nil
+	}
+
+	for arg, sink := range toolSinks(tool, tc) {
+		value, ok := tc.Arguments[arg]
+		if !ok || !taintedFor(ctx.Taint, sink, value) {
+			continue
+		}
+		err := &TaintError{Tool: tc.Name, Argument: arg, Sink: sink}
+		if r.config.TaintPolicy == TaintBlock {
+			return err
+		}
+		logAt(ctx.Context, slog.LevelWarn, err.Error())
+		ctx.EmitProgress(ProgressEvent{
+			Type:     ProgressTypeStep,
+			Message:  err.Error(),
+			Metadata: map[string]string{"tool": tc.Name, "taint": string(sink)},
+		})
+	}
+	return nil
+}
+
+// taintedFor reports whether value, or any string nested in it, carries
+// untrusted content that is dangerous for sink.
+func taintedFor(tracker *TaintTracker, sink TaintSink, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		if !tracker.Tainted(v) {
+			return false
+		}
+		if sink == SinkURL {
+			return true
+		}
+		return strings.ContainsAny(v, sinkMetachars[sink])
+	case []interface{}:
+		for _, elem := range v {
+			if taintedFor(tracker, sink, elem) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			if taintedFor(tracker, sink, elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandPlaceholder matches {{name}} and {{params.name | filter}} in a tool
+// command.
+var commandPlaceholder = regexp.MustCompile(`\{\{\s*(?:params\.)?(\w+)\s*((?:\|\s*\w+\s*)*)\}\}`)
+
+// toolSinks returns the sink each argument of a tool call flows into.
+//
+// A tool may declare `sink: "sql"` (or "shell", "url") to mark all of its
+// arguments. Otherwise arguments placed in a shell command without the
+// `shell` filter, and the url of the built-in http function, are sinks.
+func toolSinks(tool ast.Entity, tc ToolCall) map[string]TaintSink {
+	sinks := make(map[string]TaintSink)
+	if tool == nil {
+		return sinks
+	}
+
+	if sink := propertyString(tool, "sink"); sink != "" {
+		for arg := range tc.Arguments {
+			sinks[arg] = TaintSink(sink)
+		}
+		return sinks
+	}
+
+	if prop, ok := tool.GetProperty("command"); ok {
+		if sv, ok := prop.(ast.StringValue); ok {
+			for _, m := range commandPlaceholder.FindAllStringSubmatch(sv.Value, -1) {
+				if !hasFilter(m[2], "shell") {
+					sinks[m[1]] = SinkShell
+				}
+			}
+		}
+		return sinks
+	}
+
+	switch propertyString(tool, "function") {
+	case "http", "http_request":
+		sinks["url"] = SinkURL
+	}
+	return sinks
+}
+
+func hasFilter(filters, name string) bool {
+	for _, f := range strings.Split(filters, "|") {
+		if strings.TrimSpace(f) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFilters splits a template expression like `step.x.output | shell`
+// into the expression and its filters. Only a single | outside string
+// literals separates them, so `$a || $b` and `$x ?? "a|b"` are expressions.
+func splitFilters(expr string) (string, []string) {
+	var parts []string
+	var quote byte
+	last := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '|':
+			if i+1 < len(expr) && expr[i+1] == '|' {
+				i++
+				continue
+			}
+			parts = append(parts, expr[last:i])
+			last = i + 1
+		}
+	}
+	parts = append(parts, expr[last:])
+
+	filters := make([]string, 0, len(parts)-1)
+	for _, f := range parts[1:] {
+		filters = append(filters, strings.TrimSpace(f))
+	}
+	return strings.TrimSpace(parts[0]), filters
+}
+
+// applyFilter escapes an interpolated value for the context it is placed in.
+//
+//	quote      Go-style double-quoted string
+//	json       JSON encoding of the value
+//	shell      single-quoted POSIX shell word
+//	sql        single-quoted SQL string literal
+//	url        URL query component
+//	untrusted  fenced in <untrusted> tags for prompts, and marked as tainted
+func applyFilter(name string, value interface{}, tracker *TaintTracker) (interface{}, error) {
+	switch name {
+	case "quote":
+		return strconv.Quote(toString(value)), nil
+	case "json":
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("json filter: %w", err)
+		}
+		return string(data), nil
+	case "shell":
+		return shellQuote(toString(value)), nil
+	case "sql":
+		return "'" + strings.ReplaceAll(toString(value), "'", "''") + "'", nil
+	case "url":
+		return url.QueryEscape(toString(value)), nil
+	case "untrusted":
+		tracker.Mark(value)
+		return fenceUntrusted(toString(value)), nil
+	default:
+		return nil, fmt.Errorf("unknown filter %q", name)
+	}
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fenceUntrusted wraps content in tags that tell the model to treat it as
+// data. Tags inside the content are neutralized so it cannot close the fence.
+func fenceUntrusted(s string) string {
+	s = strings.ReplaceAll(s, "<untrusted>", "&lt;untrusted&gt;")
+	s = strings.ReplaceAll(s, "</untrusted>", "&lt;/untrusted&gt;")
+	return "<untrusted>\n" + s + "\n</untrusted>"
+}
@@ -0,0 +1,200 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const toolLoopSource = `
+tool "greet" {
+	description: "Greet someone"
+	parameters: {
+		name: string required "Who to greet"
+		greeting: string optional "hello" "The greeting to use"
+		tags: array optional
+	}
+	handler: shell {
+		command: "echo {{params.greeting}} {{params.name}}"
+	}
+}
+
+script "shout" {
+	language: "sh"
+	description: "Shout a word"
+	parameters: {
+		word: string required
+	}
+	code: "echo $LS_PARAM_WORD!"
+}
+
+agent "greeter" {
+	model: "mock-model"
+	tools: [greet]
+	scripts: [script("shout")]
+	max_turns: 3
+}
+
+intent "welcome" {
+	use: agent("greeter")
+	input: "Welcome the new user"
+}
+
+pipeline "onboard" {
+	step "welcome" {
+		use: agent("greeter")
+		input: "Welcome the new user"
+	}
+}
+`
+
+func newToolLoopRuntime(t *testing.T, responses ...MockResponse) (*Runtime, *MockProvider, *workspace.Workspace) {
+	t.Helper()
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, toolLoopSource))
+	provider := NewMockProvider(WithMockResponses(responses...))
+	return New(ws, WithProvider("mock", provider)), provider, ws
+}
+
+func TestExecute_ToolSchemas(t *testing.T) {
+	rt, provider, ws := newToolLoopRuntime(t, MockResponse{Content: "hi", FinishReason: FinishReasonStop})
+	intent, _ := ws.GetEntityByName("intent", "welcome")
+	if _, err := rt.Execute(context.Background(), intent); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	tools := provider.GetRequests()[0].Tools
+	if len(tools) != 2 || tools[0].Name != "greet" || tools[1].Name != "shout" {
+		t.Fatalf("expected tools [greet shout], got %+v", tools)
+	}
+	want := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":     map[string]interface{}{"type": "string", "description": "Who to greet"},
+			"greeting": map[string]interface{}{"type": "string", "description": "The greeting to use", "default": "hello"},
+			"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{}},
+		},
+		"required": []interface{}{"name"},
+	}
+	if !reflect.DeepEqual(tools[0].Parameters, want) {
+		t.Errorf("greet schema = %v, want %v", tools[0].Parameters, want)
+	}
+	if tools[1].Description != "Shout a word" {
+		t.Errorf("expected the script's description, got %q", tools[1].Description)
+	}
+}
+
+func TestExecute_ToolLoop(t *testing.T) {
+	rt, provider, ws := newToolLoopRuntime(t,
+		MockResponse{
+			ToolCalls: []ToolCall{
+				{ID: "call-1", Name: "greet", Arguments: map[string]interface{}{"name": "ada"}},
+				{ID: "call-2", Name: "shout", Arguments: map[string]interface{}{"word": "welcome"}},
+			},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "Greeted ada", FinishReason: FinishReasonStop},
+	)
+	intent, _ := ws.GetEntityByName("intent", "welcome")
+	result, err := rt.Execute(context.Background(), intent)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if result.Output != "Greeted ada" {
+		t.Errorf("expected the final answer, got %v", result.Output)
+	}
+
+	msgs := provider.GetRequests()[1].Messages
+	if len(msgs) != 4 {
+		t.Fatalf("expected prompt, tool calls and two results, got %+v", msgs)
+	}
+	if msgs[2].Role != RoleTool || msgs[2].Content != "hello ada\n" {
+		t.Errorf("expected the shell handler to use the default greeting, got %+v", msgs[2])
+	}
+	if msgs[3].Content != "welcome!\n" {
+		t.Errorf("expected the script result, got %+v", msgs[3])
+	}
+}
+
+func TestExecute_ToolLoopMaxTurns(t *testing.T) {
+	call := MockResponse{
+		ToolCalls:    []ToolCall{{ID: "call", Name: "greet", Arguments: map[string]interface{}{"name": "ada"}}},
+		FinishReason: FinishReasonToolUse,
+	}
+	rt, provider, ws := newToolLoopRuntime(t, call, call, call, call)
+	intent, _ := ws.GetEntityByName("intent", "welcome")
+
+	_, err := rt.Execute(context.Background(), intent)
+	if err == nil || !strings.Contains(err.Error(), `agent "greeter" did not give a final answer within 3 turns`) {
+		t.Errorf("expected a max_turns error, got %v", err)
+	}
+	if n := len(provider.GetRequests()); n != 3 {
+		t.Errorf("expected 3 model calls, got %d", n)
+	}
+}
+
+func TestExecutePipeline_StepToolLoop(t *testing.T) {
+	rt, provider, ws := newToolLoopRuntime(t,
+		MockResponse{
+			ToolCalls:    []ToolCall{{ID: "call-1", Name: "greet", Arguments: map[string]interface{}{"name": "ada", "greeting": "hi"}}},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "Greeted ada", FinishReason: FinishReasonStop},
+	)
+	pipeline, _ := ws.GetEntityByName("pipeline", "onboard")
+	result, err := rt.Execute(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	step := result.StepResults["welcome"]
+	if step.Output != "Greeted ada" || step.Attempts != 2 {
+		t.Errorf("expected the final answer after 2 model calls, got %q after %d", step.Output, step.Attempts)
+	}
+	msgs := provider.GetRequests()[1].Messages
+	if last := msgs[len(msgs)-1]; last.Role != RoleTool || last.Content != "hi ada\n" {
+		t.Errorf("expected the tool result to be fed back, got %+v", last)
+	}
+}
+
+func TestExecuteToolCall_HTTPHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"city": "` + r.URL.Query().Get("q") + `", "key": "` + r.Header.Get("X-Key") + `"}`))
+	}))
+	defer server.Close()
+
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+tool "weather" {
+	parameters: {
+		location: string required
+	}
+	handler: http {
+		method: "GET"
+		url: "`+server.URL+`/current"
+		query: {
+			q: params.location
+		}
+		headers: {
+			"X-Key": "secret"
+		}
+	}
+}
+`))
+	rt := New(ws)
+	ctx := &ExecutionContext{Context: context.Background(), Runtime: rt, Workspace: ws, Variables: make(map[string]interface{})}
+
+	got, err := rt.executeToolCall(ctx, ToolCall{Name: "weather", Arguments: map[string]interface{}{"location": "Oslo"}}, NewResolver(ctx))
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	body, _ := got.(map[string]interface{})["json"].(map[string]interface{})
+	if body["city"] != "Oslo" || body["key"] != "secret" {
+		t.Errorf("expected the query and headers to be sent, got %v", got)
+	}
+}
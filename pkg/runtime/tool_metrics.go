@@ -0,0 +1,172 @@
+package runtime
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultToolHistorySize is the number of tool invocations kept in history.
+const DefaultToolHistorySize = 1000
+
+// ToolInvocation records a single tool call made during execution.
+type ToolInvocation struct {
+	Tool      string        `json:"tool"`
+	Agent     string        `json:"agent,omitempty"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration"`
+	Success   bool          `json:"success"`
+	Error     string        `json:"error,omitempty"`
+	BytesIn   int           `json:"bytes_in"`
+	BytesOut  int           `json:"bytes_out"`
+}
+
+// ToolStats aggregates all recorded invocations of a single tool.
+type ToolStats struct {
+	Tool          string        `json:"tool"`
+	Calls         int           `json:"calls"`
+	Successes     int           `json:"successes"`
+	Failures      int           `json:"failures"`
+	SuccessRate   float64       `json:"success_rate"`
+	TotalDuration time.Duration `json:"total_duration"`
+	AvgDuration   time.Duration `json:"avg_duration"`
+	BytesIn       int64         `json:"bytes_in"`
+	BytesOut      int64         `json:"bytes_out"`
+	LastCalled    time.Time     `json:"last_called"`
+}
+
+// ToolReport summarizes tool usage across executions.
+type ToolReport struct {
+	// Tools contains per-tool statistics, sorted by tool name
+	Tools []ToolStats `json:"tools"`
+
+	// Unused lists tools declared in the workspace that were never called
+	Unused []string `json:"unused,omitempty"`
+}
+
+// ToolMetrics records tool invocations and aggregates per-tool statistics.
+// Aggregates cover every invocation since the last Reset; the invocation
+// history is bounded.
+type ToolMetrics struct {
+	mu         sync.RWMutex
+	history    []ToolInvocation
+	stats      map[string]*ToolStats
+	maxHistory int
+}
+
+// NewToolMetrics creates a tool metrics recorder that keeps up to maxHistory
+// invocations. A non-positive maxHistory uses DefaultToolHistorySize.
+func NewToolMetrics(maxHistory int) *ToolMetrics {
+	if maxHistory <= 0 {
+		maxHistory = DefaultToolHistorySize
+	}
+	return &ToolMetrics{
+		stats:      make(map[string]*ToolStats),
+		maxHistory: maxHistory,
+	}
+}
+
+// Record adds a tool invocation to the history and aggregates.
+func (m *ToolMetrics) Record(inv ToolInvocation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history = append(m.history, inv)
+	if len(m.history) > m.maxHistory {
+		m.history = m.history[len(m.history)-m.maxHistory:]
+	}
+
+	s, ok := m.stats[inv.Tool]
+	if !ok {
+		s = &ToolStats{Tool: inv.Tool}
+		m.stats[inv.Tool] = s
+	}
+	s.Calls++
+	if inv.Success {
+		s.Successes++
+	} else {
+		s.Failures++
+	}
+	s.TotalDuration += inv.Duration
+	s.BytesIn += int64(inv.BytesIn)
+	s.BytesOut += int64(inv.BytesOut)
+	if inv.StartTime.After(s.LastCalled) {
+		s.LastCalled = inv.StartTime
+	}
+}
+
+// History returns the recorded invocations, oldest first.
+func (m *ToolMetrics) History() []ToolInvocation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]ToolInvocation, len(m.history))
+	copy(result, m.history)
+	return result
+}
+
+// Stats returns statistics for a single tool.
+func (m *ToolMetrics) Stats(tool string) (ToolStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.stats[tool]
+	if !ok {
+		return ToolStats{}, false
+	}
+	return s.snapshot(), true
+}
+
+// Report returns per-tool statistics. Tools in declared that were never
+// called are listed in Unused.
+func (m *ToolMetrics) Report(declared ...string) ToolReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := ToolReport{Tools: make([]ToolStats, 0, len(m.stats))}
+	for _, s := range m.stats {
+		report.Tools = append(report.Tools, s.snapshot())
+	}
+	sort.Slice(report.Tools, func(i, j int) bool {
+		return report.Tools[i].Tool < report.Tools[j].Tool
+	})
+
+	for _, name := range declared {
+		if _, ok := m.stats[name]; !ok {
+			report.Unused = append(report.Unused, name)
+		}
+	}
+	sort.Strings(report.Unused)
+
+	return report
+}
+
+// Reset clears all recorded invocations and statistics.
+func (m *ToolMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = nil
+	m.stats = make(map[string]*ToolStats)
+}
+
+func (s *ToolStats) snapshot() ToolStats {
+	out := *s
+	if out.Calls > 0 {
+		out.SuccessRate = float64(out.Successes) / float64(out.Calls)
+		out.AvgDuration = out.TotalDuration / time.Duration(out.Calls)
+	}
+	return out
+}
+
+// argumentsSize returns the size in bytes of tool call arguments as JSON.
+func argumentsSize(args map[string]interface{}) int {
+	if len(args) == 0 {
+		return 0
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
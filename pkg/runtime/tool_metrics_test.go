@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func TestToolMetrics_Report(t *testing.T) {
+	m := NewToolMetrics(2)
+	now := time.Now()
+	m.Record(ToolInvocation{Tool: "search", StartTime: now, Duration: 10 * time.Millisecond, Success: true, BytesIn: 5, BytesOut: 100})
+	m.Record(ToolInvocation{Tool: "search", StartTime: now, Duration: 30 * time.Millisecond, Success: false, BytesIn: 7})
+	m.Record(ToolInvocation{Tool: "fetch", StartTime: now, Duration: 5 * time.Millisecond, Success: true, BytesOut: 20})
+
+	if got := len(m.History()); got != 2 {
+		t.Errorf("expected history bounded to 2, got %d", got)
+	}
+
+	report := m.Report("fetch", "search", "deploy")
+	if len(report.Tools) != 2 || report.Tools[0].Tool != "fetch" || report.Tools[1].Tool != "search" {
+		t.Fatalf("expected stats for [fetch search], got %+v", report.Tools)
+	}
+
+	search := report.Tools[1]
+	if search.Calls != 2 || search.Failures != 1 || search.SuccessRate != 0.5 {
+		t.Errorf("unexpected search stats: %+v", search)
+	}
+	if search.AvgDuration != 20*time.Millisecond {
+		t.Errorf("expected avg duration 20ms, got %s", search.AvgDuration)
+	}
+	if search.BytesIn != 12 || search.BytesOut != 100 {
+		t.Errorf("expected 12 bytes in / 100 out, got %d / %d", search.BytesIn, search.BytesOut)
+	}
+	if !reflect.DeepEqual(report.Unused, []string{"deploy"}) {
+		t.Errorf("expected unused [deploy], got %v", report.Unused)
+	}
+
+	m.Reset()
+	if _, ok := m.Stats("search"); ok {
+		t.Error("expected stats to be cleared after Reset")
+	}
+}
+
+func TestExecute_RecordsToolInvocations(t *testing.T) {
+	source := `
+agent "reviewer" {
+	model: "mock-model"
+	tools: [linter]
+}
+
+tool "linter" {
+	command: "echo lint"
+}
+
+tool "deployer" {
+	command: "echo deploy"
+}
+
+intent "review" {
+	use: agent("reviewer")
+}
+`
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	provider := NewMockProvider(WithMockResponses(
+		MockResponse{
+			ToolCalls: []ToolCall{
+				{ID: "call-1", Name: "linter", Arguments: map[string]interface{}{"path": "."}},
+				{ID: "call-2", Name: "deployer"},
+			},
+			FinishReason: FinishReasonToolUse,
+		},
+		MockResponse{Content: "done", FinishReason: FinishReasonStop},
+	))
+	rt := New(ws, WithProvider("mock", provider))
+
+	intent, _ := ws.GetEntityByName("intent", "review")
+	if _, err := rt.Execute(context.Background(), intent); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	history := rt.ToolMetrics().History()
+	if len(history) != 2 {
+		t.Fatalf("expected 2 recorded invocations, got %d", len(history))
+	}
+	if inv := history[0]; inv.Tool != "linter" || !inv.Success || inv.Agent != "reviewer" || inv.BytesIn == 0 {
+		t.Errorf("unexpected linter invocation: %+v", inv)
+	}
+	if inv := history[1]; inv.Tool != "deployer" || inv.Success || inv.Error == "" {
+		t.Errorf("expected failed deployer invocation, got %+v", inv)
+	}
+
+	report := rt.ToolReport()
+	if len(report.Unused) != 0 {
+		t.Errorf("expected no unused tools, got %v", report.Unused)
+	}
+	if stats, _ := rt.ToolMetrics().Stats("deployer"); stats.Failures != 1 {
+		t.Errorf("expected 1 deployer failure, got %+v", stats)
+	}
+}
@@ -0,0 +1,573 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracerName is the instrumentation scope reported with every span.
+const tracerName = "github.com/shellkjell/langspace/pkg/runtime"
+
+// Attribute is a key/value pair attached to a span. Values are strings,
+// bools, ints, or float64s.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates an Attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// TracerProvider creates tracers. OTelTracerProvider adapts an
+// OpenTelemetry provider, such as the SDK's; the OTLPTracerProvider exports
+// to Jaeger or any OTLP collector directly.
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+// Tracer starts spans. The returned context carries the span, so spans
+// started from it become its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a timed operation in a trace.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// WithTracerProvider records a span for each execution, pipeline step, and
+// provider call. Provider spans follow the OpenTelemetry GenAI conventions
+// (gen_ai.request.model, gen_ai.usage.input_tokens, ...).
+func WithTracerProvider(tp TracerProvider) Option {
+	return func(r *Runtime) {
+		if tp != nil {
+			r.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+// traceparentKey is the context key of a remote parent span.
+type traceparentKey struct{}
+
+// spanContext identifies a span in a W3C traceparent header.
+type spanContext struct {
+	traceID string // 32 hex digits
+	spanID  string // 16 hex digits
+	sampled bool
+}
+
+// String returns sc as a traceparent header value.
+func (sc spanContext) String() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + sc.traceID + "-" + sc.spanID + "-" + flags
+}
+
+// parseTraceparent parses a W3C traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(header string) (spanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return spanContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || !isHex(flags, 2) {
+		return spanContext{}, false
+	}
+	// All-zero IDs are invalid
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return spanContext{}, false
+	}
+	sampled, _ := strconv.ParseUint(flags, 16, 8)
+	return spanContext{traceID: traceID, spanID: spanID, sampled: sampled&1 == 1}, true
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithTraceparent returns ctx with the remote span of a W3C
+// traceparent header, such as one received with a request, so that the
+// spans of executions started from ctx join its trace. Invalid values are
+// ignored.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if sc, ok := parseTraceparent(traceparent); ok {
+		return context.WithValue(ctx, traceparentKey{}, sc)
+	}
+	return ctx
+}
+
+// Traceparent returns the W3C traceparent header value of the current span
+// in ctx, to propagate the trace to a service the execution calls, or "" if
+// there is none. Provider, moderation, and HTTP tool requests send it.
+func Traceparent(ctx context.Context) string {
+	if sc, ok := currentSpanContext(ctx); ok {
+		return sc.String()
+	}
+	return ""
+}
+
+// currentSpanContext returns the span of ctx started by the OTLP or
+// OpenTelemetry tracer, or else its remote parent.
+func currentSpanContext(ctx context.Context) (spanContext, bool) {
+	if span, ok := ctx.Value(otlpSpanKey{}).(*otlpSpan); ok {
+		return spanContext{traceID: span.traceID, spanID: span.spanID, sampled: true}, true
+	}
+	if sc, ok := otelSpanContext(ctx); ok {
+		return sc, true
+	}
+	sc, ok := ctx.Value(traceparentKey{}).(spanContext)
+	return sc, ok
+}
+
+// setTraceparent propagates the trace of req's context to the service it
+// is sent to.
+func setTraceparent(req *http.Request) {
+	if traceparent := Traceparent(req.Context()); traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// usageAttributes returns the token counts of usage as span attributes.
+func usageAttributes(usage TokenUsage) []Attribute {
+	return []Attribute{
+		Attr("gen_ai.usage.input_tokens", usage.InputTokens),
+		Attr("gen_ai.usage.output_tokens", usage.OutputTokens),
+	}
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tracedProvider records a span for each completion request.
+type tracedProvider struct {
+	LLMProvider
+	tracer Tracer
+}
+
+// traceProvider wraps p so its calls are traced, if tracing is enabled.
+func (r *Runtime) traceProvider(p LLMProvider) LLMProvider {
+	if _, ok := r.tracer.(noopTracer); ok {
+		return p
+	}
+	return &tracedProvider{LLMProvider: p, tracer: r.tracer}
+}
+
+// unwrapProvider returns the provider underneath any tracing, instance,
+// cassette, or caching wrapper.
+func unwrapProvider(p LLMProvider) LLMProvider {
+	for {
+		switch w := p.(type) {
+		case *tracedProvider:
+			p = w.LLMProvider
+		case *providerInstance:
+			p = w.LLMProvider
+		case *snapshotProvider:
+			p = w.LLMProvider
+		case *cachedProvider:
+			p = w.LLMProvider
+		case *cassetteProvider:
+			p = w.LLMProvider
+		default:
+			return p
+		}
+	}
+}
+
+func (p *tracedProvider) start(ctx context.Context, req *CompletionRequest, streaming bool) (context.Context, Span) {
+	return p.tracer.Start(ctx, "chat "+req.Model,
+		Attr("gen_ai.operation.name", "chat"),
+		Attr("gen_ai.system", p.Name()),
+		Attr("gen_ai.request.model", req.Model),
+		Attr("gen_ai.request.temperature", req.Temperature),
+		Attr("langspace.streaming", streaming),
+	)
+}
+
+func (p *tracedProvider) end(span Span, resp *CompletionResponse, err error) {
+	if resp != nil {
+		span.SetAttributes(usageAttributes(resp.Usage)...)
+		span.SetAttributes(Attr("gen_ai.response.model", resp.Model))
+		if resp.FinishReason != "" {
+			span.SetAttributes(Attr("gen_ai.response.finish_reasons", string(resp.FinishReason)))
+		}
+	}
+	endSpan(span, err)
+}
+
+// Complete sends a completion request inside a span.
+func (p *tracedProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	ctx, span := p.start(ctx, req, false)
+	resp, err := p.LLMProvider.Complete(ctx, req)
+	p.end(span, resp, err)
+	return resp, err
+}
+
+// CompleteStream streams a completion inside a span.
+func (p *tracedProvider) CompleteStream(ctx context.Context, req *CompletionRequest, handler StreamHandler) (*CompletionResponse, error) {
+	ctx, span := p.start(ctx, req, true)
+	resp, err := p.LLMProvider.CompleteStream(ctx, req, handler)
+	p.end(span, resp, err)
+	return resp, err
+}
+
+// OTLPTracerProvider exports spans to an OpenTelemetry collector, Jaeger, or
+// any other OTLP/HTTP endpoint using the JSON encoding. Spans are batched and
+// sent in the background; call Shutdown to flush before exiting.
+type OTLPTracerProvider struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	httpClient  *http.Client
+	interval    time.Duration
+	batchSize   int
+
+	mu      sync.Mutex
+	pending []*otlpSpan
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	closed  bool
+}
+
+// OTLPOption is a functional option for configuring OTLPTracerProvider.
+type OTLPOption func(*OTLPTracerProvider)
+
+// WithOTLPServiceName sets the service.name resource attribute (default "langspace").
+func WithOTLPServiceName(name string) OTLPOption {
+	return func(p *OTLPTracerProvider) {
+		p.serviceName = name
+	}
+}
+
+// WithOTLPHeader sets a header sent with every export (e.g. an API key).
+func WithOTLPHeader(key, value string) OTLPOption {
+	return func(p *OTLPTracerProvider) {
+		p.headers[key] = value
+	}
+}
+
+// WithOTLPHTTPClient sets a custom HTTP client.
+func WithOTLPHTTPClient(client *http.Client) OTLPOption {
+	return func(p *OTLPTracerProvider) {
+		p.httpClient = client
+	}
+}
+
+// WithOTLPBatch sets how often pending spans are exported and how many
+// spans trigger an export early.
+func WithOTLPBatch(interval time.Duration, size int) OTLPOption {
+	return func(p *OTLPTracerProvider) {
+		if interval > 0 {
+			p.interval = interval
+		}
+		if size > 0 {
+			p.batchSize = size
+		}
+	}
+}
+
+// NewOTLPTracerProvider creates a provider exporting to endpoint, the base
+// URL of an OTLP/HTTP receiver such as "http://localhost:4318". Spans are
+// posted to endpoint + "/v1/traces".
+func NewOTLPTracerProvider(endpoint string, opts ...OTLPOption) *OTLPTracerProvider {
+	p := &OTLPTracerProvider{
+		endpoint:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: "langspace",
+		headers:     make(map[string]string),
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		interval:    5 * time.Second,
+		batchSize:   512,
+		flush:       make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	go p.run()
+	return p
+}
+
+// Tracer returns a tracer whose spans are exported by p.
+func (p *OTLPTracerProvider) Tracer(name string) Tracer {
+	return &otlpTracer{provider: p, scope: name}
+}
+
+// Shutdown exports pending spans and stops the background exporter.
+func (p *OTLPTracerProvider) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.done)
+	select {
+	case <-p.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.export(ctx)
+}
+
+func (p *OTLPTracerProvider) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.flush:
+		}
+		if err := p.export(context.Background()); err != nil {
+			slog.Warn("failed to export spans", "error", err)
+		}
+	}
+}
+
+func (p *OTLPTracerProvider) enqueue(span *otlpSpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.pending = append(p.pending, span)
+	if len(p.pending) >= p.batchSize {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// export sends all pending spans in one request.
+func (p *OTLPTracerProvider) export(ctx context.Context) error {
+	p.mu.Lock()
+	spans := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	// Group spans by instrumentation scope
+	var scopes []map[string]interface{}
+	byScope := make(map[string]int)
+	for _, s := range spans {
+		i, ok := byScope[s.scope]
+		if !ok {
+			i = len(scopes)
+			byScope[s.scope] = i
+			scopes = append(scopes, map[string]interface{}{
+				"scope": map[string]interface{}{"name": s.scope},
+				"spans": []interface{}{},
+			})
+		}
+		scopes[i]["spans"] = append(scopes[i]["spans"].([]interface{}), s.encode())
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes([]Attribute{Attr("service.name", p.serviceName)}),
+			},
+			"scopeSpans": scopes,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("failed to close response body", "error", err)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+type otlpTracer struct {
+	provider *OTLPTracerProvider
+	scope    string
+}
+
+type otlpSpanKey struct{}
+
+func (t *otlpTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &otlpSpan{
+		provider: t.provider,
+		scope:    t.scope,
+		name:     name,
+		spanID:   randomHex(8),
+		start:    time.Now(),
+		attrs:    attrs,
+	}
+	if parent, ok := currentSpanContext(ctx); ok {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = randomHex(16)
+	}
+	return context.WithValue(ctx, otlpSpanKey{}, span), span
+}
+
+type otlpSpan struct {
+	provider *OTLPTracerProvider
+	scope    string
+	name     string
+	traceID  string
+	spanID   string
+	parentID string
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []Attribute
+	errMsg string
+	ended  bool
+}
+
+func (s *otlpSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *otlpSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+func (s *otlpSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.provider.enqueue(s)
+}
+
+// encode returns the span in the OTLP JSON format.
+func (s *otlpSpan) encode() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              1, // SPAN_KIND_INTERNAL
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        encodeAttributes(s.attrs),
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+	if s.errMsg != "" {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.errMsg} // STATUS_CODE_ERROR
+	}
+	return span
+}
+
+// encodeAttributes converts attributes to OTLP key/value pairs.
+func encodeAttributes(attrs []Attribute) []interface{} {
+	out := make([]interface{}, 0, len(attrs))
+	for _, a := range attrs {
+		var value map[string]interface{}
+		switch v := a.Value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]interface{}{"key": a.Key, "value": value})
+	}
+	return out
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
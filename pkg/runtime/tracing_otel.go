@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OTelTracerProvider adapts an OpenTelemetry tracer provider, such as one
+// from the OpenTelemetry SDK, for WithTracerProvider:
+//
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+//	rt := runtime.New(ws, runtime.WithTracerProvider(runtime.OTelTracerProvider(tp)))
+//
+// Spans are children of the OpenTelemetry span in the execution's context,
+// if any, or else of a remote parent set with ContextWithTraceparent.
+func OTelTracerProvider(tp trace.TracerProvider) TracerProvider {
+	return otelTracerProvider{provider: tp}
+}
+
+type otelTracerProvider struct {
+	provider trace.TracerProvider
+}
+
+func (p otelTracerProvider) Tracer(name string) Tracer {
+	return otelTracer{tracer: p.provider.Tracer(name)}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if remote, ok := ctx.Value(traceparentKey{}).(spanContext); ok {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, remote.otel())
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(otelAttributes(attrs)...))
+	return ctx, otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttributes(attrs ...Attribute) {
+	s.span.SetAttributes(otelAttributes(attrs)...)
+}
+
+func (s otelSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// otelAttributes converts attributes to OpenTelemetry attributes.
+func otelAttributes(attrs []Attribute) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			out = append(out, attribute.String(a.Key, v))
+		case bool:
+			out = append(out, attribute.Bool(a.Key, v))
+		case int:
+			out = append(out, attribute.Int(a.Key, v))
+		case int64:
+			out = append(out, attribute.Int64(a.Key, v))
+		case float64:
+			out = append(out, attribute.Float64(a.Key, v))
+		default:
+			out = append(out, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return out
+}
+
+// otel returns sc as a remote OpenTelemetry span context.
+func (sc spanContext) otel() trace.SpanContext {
+	traceID, _ := trace.TraceIDFromHex(sc.traceID)
+	spanID, _ := trace.SpanIDFromHex(sc.spanID)
+	var flags trace.TraceFlags
+	if sc.sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags, Remote: true})
+}
+
+// otelSpanContext returns the OpenTelemetry span in ctx, if any.
+func otelSpanContext(ctx context.Context) (spanContext, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return spanContext{}, false
+	}
+	return spanContext{traceID: sc.TraceID().String(), spanID: sc.SpanID().String(), sampled: sc.IsSampled()}, true
+}
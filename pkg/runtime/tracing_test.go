@@ -0,0 +1,342 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// recordingTracer keeps finished spans in memory.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	parent *recordedSpan
+	attrs  map[string]interface{}
+	err    error
+}
+
+type recordedSpanKey struct{}
+
+func (t *recordingTracer) Tracer(name string) Tracer { return t }
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &recordedSpan{tracer: t, name: name, attrs: make(map[string]interface{})}
+	span.parent, _ = ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+
+func (s *recordedSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+func (t *recordingTracer) span(name string) *recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+const tracedPipelineSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		input: "topic"
+	}
+
+	step "polish" {
+		use: agent("writer")
+		input: step("draft").output
+	}
+}
+`
+
+func TestExecute_Tracing(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, tracedPipelineSource))
+	tracer := &recordingTracer{}
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "text", Usage: TokenUsage{InputTokens: 10, OutputTokens: 4, TotalTokens: 14}}))
+	rt := New(ws, WithProvider("mock", provider), WithTracerProvider(tracer))
+
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "report"); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	if got := len(tracer.spans); got != 5 {
+		t.Fatalf("expected 5 spans (pipeline, 2 steps, 2 calls), got %d", got)
+	}
+	root := tracer.span("pipeline report")
+	if root == nil || root.parent != nil || root.attrs["langspace.success"] != true {
+		t.Fatalf("unexpected root span %+v", root)
+	}
+	for _, name := range []string{"step draft", "step polish"} {
+		step := tracer.span(name)
+		if step == nil || step.parent != root {
+			t.Errorf("expected %q to be a child of the pipeline span", name)
+		}
+	}
+
+	var calls int
+	for _, s := range tracer.spans {
+		if s.name != "chat mock-model" {
+			continue
+		}
+		calls++
+		if s.parent == nil || s.parent.parent != root {
+			t.Errorf("expected provider span under a step span, got parent %+v", s.parent)
+		}
+		if s.attrs["gen_ai.request.model"] != "mock-model" || s.attrs["gen_ai.system"] != "mock" {
+			t.Errorf("unexpected provider span attributes %v", s.attrs)
+		}
+		if s.attrs["gen_ai.usage.input_tokens"] != 10 || s.attrs["gen_ai.usage.output_tokens"] != 4 {
+			t.Errorf("expected token counts, got %v", s.attrs)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 provider spans, got %d", calls)
+	}
+
+	if root.attrs["gen_ai.usage.input_tokens"] != 20 || root.attrs["gen_ai.usage.output_tokens"] != 8 {
+		t.Errorf("expected pipeline token totals, got %v", root.attrs)
+	}
+}
+
+func TestExecute_TracingError(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, tracedPipelineSource))
+	tracer := &recordingTracer{}
+	provider := NewMockProvider(WithMockResponses(MockResponse{Error: errors.New("boom")}))
+	rt := New(ws, WithProvider("mock", provider), WithTracerProvider(tracer))
+
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "report"); err == nil {
+		t.Fatal("expected execution error")
+	}
+	for _, name := range []string{"chat mock-model", "step draft", "pipeline report"} {
+		if s := tracer.span(name); s == nil || s.err == nil {
+			t.Errorf("expected error recorded on %q", name)
+		}
+	}
+}
+
+func TestOTLPTracerProvider(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, tracedPipelineSource))
+	tp := NewOTLPTracerProvider(server.URL, WithOTLPServiceName("reports"))
+	rt := New(ws, WithProvider("mock", NewMockProvider()), WithTracerProvider(tp))
+
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "report"); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 export, got %d", len(bodies))
+	}
+	resourceSpans := bodies[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resourceAttr := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if resourceAttr["key"] != "service.name" || resourceAttr["value"].(map[string]interface{})["stringValue"] != "reports" {
+		t.Errorf("unexpected resource attribute %v", resourceAttr)
+	}
+
+	scope := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	spans := scope["spans"].([]interface{})
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans, got %d", len(spans))
+	}
+
+	byID := make(map[string]map[string]interface{})
+	for _, s := range spans {
+		span := s.(map[string]interface{})
+		byID[span["spanId"].(string)] = span
+	}
+	var traceID string
+	for _, span := range byID {
+		if traceID == "" {
+			traceID = span["traceId"].(string)
+		}
+		if span["traceId"] != traceID || len(traceID) != 32 {
+			t.Errorf("expected all spans in one trace, got %v", span["traceId"])
+		}
+		parentID, hasParent := span["parentSpanId"].(string)
+		if span["name"] == "pipeline report" {
+			if hasParent {
+				t.Error("expected root span without parent")
+			}
+			continue
+		}
+		if _, ok := byID[parentID]; !ok {
+			t.Errorf("span %v has unknown parent %q", span["name"], parentID)
+		}
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := Traceparent(ContextWithTraceparent(context.Background(), header)); got != header {
+		t.Errorf("Traceparent = %q, want %q", got, header)
+	}
+	if got := Traceparent(context.Background()); got != "" {
+		t.Errorf("expected no traceparent without a span, got %q", got)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if got := Traceparent(ContextWithTraceparent(context.Background(), invalid)); got != "" {
+			t.Errorf("expected %q to be ignored, got %q", invalid, got)
+		}
+	}
+
+	// Later versions may add fields
+	if got := Traceparent(ContextWithTraceparent(context.Background(), "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00" {
+		t.Errorf("expected a later version to be read as version 00, got %q", got)
+	}
+}
+
+func TestOTelTracerProvider(t *testing.T) {
+	const remoteTraceID, remoteSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+
+	// The provider request carries the trace of its span
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 10, "completion_tokens": 4}}`))
+	}))
+	defer server.Close()
+
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "gpt-4o"
+}
+
+intent "draft" {
+	use: agent("writer")
+	input: "topic"
+}
+`))
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	provider := NewOpenAIProvider(WithOpenAIAPIKey("test-key"), WithOpenAIBaseURL(server.URL))
+	rt := New(ws, WithProvider("openai", provider), WithTracerProvider(OTelTracerProvider(tp)))
+
+	ctx := ContextWithTraceparent(context.Background(), "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+	if _, err := rt.ExecuteByName(ctx, "intent", "draft"); err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans (intent, call), got %d", len(spans))
+	}
+	var root, call sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.SpanContext().TraceID().String() != remoteTraceID {
+			t.Errorf("expected %q to join the remote trace, got %s", s.Name(), s.SpanContext().TraceID())
+		}
+		switch s.Name() {
+		case "intent draft":
+			root = s
+		case "chat gpt-4o":
+			call = s
+		}
+	}
+	if root == nil || call == nil {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	if root.Parent().SpanID().String() != remoteSpanID || !root.Parent().IsRemote() {
+		t.Errorf("expected the intent span under the remote parent, got %v", root.Parent())
+	}
+	if call.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("expected the provider span under the intent span")
+	}
+
+	attrs := make(map[string]interface{})
+	for _, kv := range call.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attrs["gen_ai.request.model"] != "gpt-4o" || attrs["gen_ai.usage.input_tokens"] != int64(10) {
+		t.Errorf("unexpected provider span attributes %v", attrs)
+	}
+
+	if want := "00-" + remoteTraceID + "-" + call.SpanContext().SpanID().String() + "-01"; traceparent != want {
+		t.Errorf("expected traceparent %q on the provider request, got %q", want, traceparent)
+	}
+}
+
+func TestOTelTracerProvider_Error(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, tracedPipelineSource))
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Error: errors.New("boom")}))
+	rt := New(ws, WithProvider("mock", provider), WithTracerProvider(OTelTracerProvider(tp)))
+
+	if _, err := rt.ExecuteByName(context.Background(), "pipeline", "report"); err == nil {
+		t.Fatal("expected execution error")
+	}
+	for _, s := range recorder.Ended() {
+		if s.Status().Code != codes.Error || len(s.Events()) == 0 {
+			t.Errorf("expected error recorded on %q, got %v", s.Name(), s.Status())
+		}
+	}
+}
@@ -3,29 +3,104 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/workspace"
 )
 
+// MissedRunPolicy controls what happens to scheduled runs that were missed
+// because the engine was not checking at the time (e.g. the host was asleep
+// or overloaded). It is set with a trigger's `missed` property.
+type MissedRunPolicy string
+
+const (
+	// MissedRunSkip drops missed runs and waits for the next scheduled time.
+	MissedRunSkip MissedRunPolicy = "skip"
+
+	// MissedRunOnce runs once to catch up, however many runs were missed.
+	MissedRunOnce MissedRunPolicy = "run_once"
+
+	// MissedRunAll runs once for every missed time, up to maxMissedRuns.
+	MissedRunAll MissedRunPolicy = "run_all"
+)
+
+// maxMissedRuns caps the catch-up runs made under MissedRunAll.
+const maxMissedRuns = 100
+
+// missedRunGrace is how late a run may start and still count as on time.
+const missedRunGrace = time.Minute
+
+// maxTriggerSleep bounds how long the engine sleeps between checks, so
+// triggers added to the workspace are picked up.
+const maxTriggerSleep = time.Minute
+
+// scheduledTrigger is the parsed schedule of a trigger.
+type scheduledTrigger struct {
+	spec     string        // schedule, timezone, and policy as declared
+	schedule *CronSchedule // nil if the spec is invalid
+	location *time.Location
+	policy   MissedRunPolicy
+	next     time.Time
+}
+
 // TriggerEngine manages and executes triggers.
+//
+// Scheduled triggers use a cron expression in either form:
+//
+//	trigger "nightly" {
+//	    schedule: "0 2 * * *"
+//	    timezone: "Europe/Stockholm"
+//	    missed: "run_once"
+//	    run: pipeline("report")
+//	}
+//
+//	trigger "nightly" {
+//	    event: schedule("0 2 * * *")
+//	    use: pipeline("report")
+//	}
+//
+// Triggers without a timezone use the runtime's default timezone (see
+// Runtime.Timezone), falling back to the server's local time.
 type TriggerEngine struct {
-	runtime *Runtime
-	ctx     context.Context
-	cancel  context.CancelFunc
-	mu      sync.RWMutex
-	active  bool
+	runtime   *Runtime
+	rollout   *Rollout
+	ctx       context.Context
+	cancel    context.CancelFunc
+	runCtx    context.Context
+	runCancel context.CancelFunc
+	done      chan struct{}
+	wake      chan struct{}
+	running   sync.WaitGroup
+	schedules map[string]*scheduledTrigger
+	now       func() time.Time
+	mu        sync.RWMutex
+	active    bool
 }
 
 // NewTriggerEngine creates a new trigger engine.
 func NewTriggerEngine(r *Runtime) *TriggerEngine {
 	return &TriggerEngine{
-		runtime: r,
+		runtime:   r,
+		schedules: make(map[string]*scheduledTrigger),
+		now:       time.Now,
 	}
 }
 
-// Start starts the trigger engine.
+// WithRollout routes trigger executions through a rollout, so a share of
+// firings can run on a canary workspace version.
+func (e *TriggerEngine) WithRollout(rollout *Rollout) *TriggerEngine {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rollout = rollout
+	return e
+}
+
+// Start starts the trigger engine. Scheduling stops when ctx is done;
+// executions already running are left to finish (see Shutdown).
 func (e *TriggerEngine) Start(ctx context.Context) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -35,81 +110,439 @@ func (e *TriggerEngine) Start(ctx context.Context) error {
 	}
 
 	e.ctx, e.cancel = context.WithCancel(ctx)
+	e.runCtx, e.runCancel = context.WithCancel(context.WithoutCancel(ctx))
+	e.done = make(chan struct{})
+	e.wake = make(chan struct{}, 1)
 	e.active = true
 
+	// Schedules start from now; runs before Start are not considered missed
+	e.schedules = make(map[string]*scheduledTrigger)
+	e.syncSchedules(e.now())
+
 	go e.run()
 
 	return nil
 }
 
-// Stop stops the trigger engine.
+// Stop stops scheduling new runs and waits for running executions to finish.
 func (e *TriggerEngine) Stop() error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	return e.Shutdown(context.Background())
+}
 
+// Shutdown stops scheduling new runs and waits for running executions to
+// finish. If ctx is done first, running executions are cancelled and
+// ctx.Err() is returned.
+func (e *TriggerEngine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
 	if !e.active {
+		e.mu.Unlock()
 		return nil
 	}
-
 	e.cancel()
 	e.active = false
+	done, runCancel := e.done, e.runCancel
+	e.mu.Unlock()
 
-	return nil
+	<-done
+
+	finished := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		runCancel()
+		return nil
+	case <-ctx.Done():
+		runCancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// NextRuns returns the next scheduled time of each scheduled trigger.
+func (e *TriggerEngine) NextRuns() map[string]time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	runs := make(map[string]time.Time, len(e.schedules))
+	for name, s := range e.schedules {
+		if s.schedule != nil {
+			runs[name] = s.next
+		}
+	}
+	return runs
 }
 
 // run is the main loop for the trigger engine.
 func (e *TriggerEngine) run() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	defer close(e.done)
 
 	for {
+		timer := time.NewTimer(e.untilNextRun())
 		select {
 		case <-e.ctx.Done():
+			timer.Stop()
 			return
-		case <-ticker.C:
-			e.checkTriggers()
+		case <-timer.C:
+			e.checkTriggers(e.now())
+		case <-e.wake:
+			timer.Stop()
+			e.checkTriggers(e.now())
 		}
 	}
 }
 
-// checkTriggers checks all triggers in the workspace and executes those that match.
-func (e *TriggerEngine) checkTriggers() {
-	triggers := e.runtime.workspace.GetEntitiesByType("trigger")
-	
-	for _, t := range triggers {
-		if schedule, ok := t.GetProperty("schedule"); ok {
-			if e.shouldRunSchedule(toString(schedule)) {
-				go e.executeTrigger(t)
+// Reload picks up triggers added, changed, or removed in the workspace
+// immediately, e.g. after the rollout's stable version was replaced, rather
+// than at the next check.
+func (e *TriggerEngine) Reload() {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.active {
+		return
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// untilNextRun returns how long to sleep before the next check.
+func (e *TriggerEngine) untilNextRun() time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := e.now()
+	wait := maxTriggerSleep
+	for _, s := range e.schedules {
+		if s.schedule == nil || s.next.IsZero() {
+			continue
+		}
+		if d := s.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// source returns the runtime whose workspace defines the triggers.
+// Must be called with lock held.
+func (e *TriggerEngine) source() *Runtime {
+	if e.rollout != nil {
+		return e.rollout.Stable()
+	}
+	return e.runtime
+}
+
+// checkTriggers runs the scheduled triggers that are due at now.
+func (e *TriggerEngine) checkTriggers(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range e.syncSchedules(now) {
+		s := e.schedules[t.Name()]
+		for _, at := range s.due(now) {
+			e.running.Add(1)
+			go func(trigger ast.Entity, at time.Time) {
+				defer e.running.Done()
+				e.executeTrigger(trigger, at, nil)
+			}(t, at)
+		}
+		if !s.next.After(now) {
+			s.next = s.schedule.Next(now.In(s.location))
+		}
+	}
+}
+
+// syncSchedules parses the schedules of new and changed triggers, drops
+// removed ones, and returns the scheduled triggers. Must be called with lock
+// held.
+func (e *TriggerEngine) syncSchedules(now time.Time) []ast.Entity {
+	var scheduled []ast.Entity
+	seen := make(map[string]bool)
+
+	for _, t := range e.source().workspace.GetEntitiesByType("trigger") {
+		expr, ok := triggerSchedule(t)
+		if !ok {
+			continue
+		}
+		tz := propertyString(t, "timezone")
+		if tz == "" {
+			tz = e.source().Timezone()
+		}
+		policy := MissedRunPolicy(propertyString(t, "missed"))
+		spec := expr + "|" + tz + "|" + string(policy)
+		seen[t.Name()] = true
+
+		if s, ok := e.schedules[t.Name()]; ok && s.spec == spec {
+			if s.schedule != nil {
+				scheduled = append(scheduled, t)
 			}
+			continue
+		}
+
+		s, err := newScheduledTrigger(expr, tz, policy)
+		if err != nil {
+			// Remember the invalid spec so the error is reported once
+			logTrigger(e.runCtx, e.source(), t.Name(), slog.LevelWarn, "trigger not scheduled", "error", err)
+			e.schedules[t.Name()] = &scheduledTrigger{spec: spec}
+			continue
 		}
+		s.spec = spec
+		s.next = s.schedule.Next(now.In(s.location))
+		e.schedules[t.Name()] = s
+		scheduled = append(scheduled, t)
 	}
+
+	for name := range e.schedules {
+		if !seen[name] {
+			delete(e.schedules, name)
+		}
+	}
+	return scheduled
 }
 
-// shouldRunSchedule checks if a cron-like schedule should run now.
-func (e *TriggerEngine) shouldRunSchedule(schedule string) bool {
-	// Simple implementation: if schedule is "* * * * *", it runs every minute.
-	// In production, use a proper cron parser.
-	return schedule == "* * * * *"
+func newScheduledTrigger(expr, tz string, policy MissedRunPolicy) (*scheduledTrigger, error) {
+	schedule, err := ParseCronSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := loadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case "":
+		policy = MissedRunSkip
+	case MissedRunSkip, MissedRunOnce, MissedRunAll:
+	default:
+		return nil, fmt.Errorf("invalid missed run policy %q (use skip, run_once, or run_all)", policy)
+	}
+
+	return &scheduledTrigger{schedule: schedule, location: location, policy: policy}, nil
+}
+
+// due returns the scheduled times to run at now, applying the missed run
+// policy to times that passed more than missedRunGrace ago.
+func (s *scheduledTrigger) due(now time.Time) []time.Time {
+	var onTime *time.Time
+	var missed []time.Time
+	for at := s.next; !at.IsZero() && !at.After(now); at = s.schedule.Next(at) {
+		if now.Sub(at) < missedRunGrace {
+			at := at
+			onTime = &at
+			break
+		}
+		if len(missed) < maxMissedRuns {
+			missed = append(missed, at)
+		}
+	}
+
+	var runs []time.Time
+	switch s.policy {
+	case MissedRunAll:
+		runs = missed
+	case MissedRunOnce:
+		if len(missed) > 0 && onTime == nil {
+			runs = missed[len(missed)-1:]
+		}
+	}
+	if onTime != nil {
+		runs = append(runs, *onTime)
+	}
+	return runs
+}
+
+// triggerSchedule returns the cron expression of a scheduled trigger, from
+// `schedule: "..."` or `event: schedule("...")`.
+func triggerSchedule(trigger ast.Entity) (string, bool) {
+	if prop, ok := trigger.GetProperty("schedule"); ok {
+		if sv, ok := prop.(ast.StringValue); ok {
+			return sv.Value, true
+		}
+	}
+	if prop, ok := trigger.GetProperty("event"); ok {
+		if fc, ok := prop.(ast.FunctionCallValue); ok && fc.Function == "schedule" && len(fc.Arguments) == 1 {
+			if sv, ok := fc.Arguments[0].(ast.StringValue); ok {
+				return sv.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func propertyString(entity ast.Entity, key string) string {
+	if prop, ok := entity.GetProperty(key); ok {
+		if sv, ok := prop.(ast.StringValue); ok {
+			return sv.Value
+		}
+	}
+	return ""
+}
+
+// triggerTarget returns the intent or pipeline a trigger runs, from its `run`
+// or `use` property, with the version it is pinned to, and the input given in
+// an inline body, if any.
+func triggerTarget(trigger ast.Entity) (target ast.ReferenceValue, input ast.Value, ok bool) {
+	for _, key := range []string{"run", "use"} {
+		prop, found := trigger.GetProperty(key)
+		if !found {
+			continue
+		}
+		switch v := prop.(type) {
+		case ast.ReferenceValue:
+			return v, nil, true
+		case ast.MethodCallValue:
+			// pipeline("name") { input: ... }
+			if sv, ok := v.Object.(ast.StringValue); ok && v.InlineBody != nil {
+				input, _ := v.InlineBody.GetProperty("input")
+				return ast.ReferenceValue{Type: sv.Value, Name: v.Method, Version: v.Version}, input, true
+			}
+		}
+	}
+	return ast.ReferenceValue{}, nil, false
+}
+
+// Fire runs a trigger now, e.g. for a webhook, with input in place of the
+// trigger's own if input is not nil. The run happens in the background, like
+// a scheduled one.
+func (e *TriggerEngine) Fire(name string, input interface{}) error {
+	return e.fire(name, input, nil, false)
+}
+
+// FireAs is Fire on behalf of a caller acting as principals, such as an API
+// client, who must own the trigger and the intent or pipeline it runs (see
+// workspace.CheckExecute).
+func (e *TriggerEngine) FireAs(name string, input interface{}, principals []string) error {
+	return e.fire(name, input, principals, true)
+}
+
+func (e *TriggerEngine) fire(name string, input interface{}, principals []string, checkOwners bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.active {
+		return fmt.Errorf("trigger engine not active")
+	}
+	ws := e.source().workspace
+	trigger, ok := ws.GetEntityByName("trigger", name)
+	if !ok {
+		return i18n.New(i18n.EntityNotFound, "trigger", name)
+	}
+	target, _, ok := triggerTarget(trigger)
+	if !ok {
+		return fmt.Errorf("trigger %q has no pipeline or intent to run", name)
+	}
+	if checkOwners {
+		if err := workspace.CheckExecute(trigger, principals); err != nil {
+			return err
+		}
+		if entity, ok := ws.GetEntityByName(target.Type, target.Name); ok {
+			if err := workspace.CheckExecute(entity, principals); err != nil {
+				return err
+			}
+		}
+	}
+	if _, _, err := entityPriority(trigger); err != nil {
+		return err
+	}
+
+	at := e.now()
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		e.executeTrigger(trigger, at, input)
+	}()
+	return nil
 }
 
-// executeTrigger executes the action associated with a trigger.
-func (e *TriggerEngine) executeTrigger(trigger ast.Entity) {
-	// Get the action to execute (intent or pipeline)
-	actionProp, ok := trigger.GetProperty("use")
+// executeTrigger executes the action associated with a trigger. input, if
+// not nil, replaces the trigger's own input.
+func (e *TriggerEngine) executeTrigger(trigger ast.Entity, scheduledAt time.Time, input interface{}) {
+	target, inputValue, ok := triggerTarget(trigger)
 	if !ok {
 		return
 	}
+	if inputValue == nil {
+		inputValue, _ = trigger.GetProperty("input")
+	}
 
-	var entityType, entityName string
-	if ref, ok := actionProp.(ast.ReferenceValue); ok {
-		entityType = ref.Type
-		entityName = ref.Name
-	} else {
+	e.mu.RLock()
+	rollout, rt, ctx := e.rollout, e.source(), e.runCtx
+	e.mu.RUnlock()
+
+	var err error
+	defer func() { rt.metrics.countTriggerFiring(trigger.Name(), err) }()
+
+	opts := []ExecuteOption{
+		WithMetadata("trigger", trigger.Name()),
+		WithMetadata("scheduled_at", scheduledAt.Format(time.RFC3339)),
+	}
+	if target.Version != "" {
+		opts = append(opts, WithVersion(target.Version))
+	}
+	// A trigger's priority overrides that of what it runs
+	priority, ok, err := entityPriority(trigger)
+	if err != nil {
+		logTrigger(ctx, rt, trigger.Name(), slog.LevelError, "trigger failed", "error", err)
 		return
 	}
+	if ok {
+		opts = append(opts, WithPriority(priority))
+	}
+	if input != nil {
+		opts = append(opts, WithInput(input))
+	} else if inputValue != nil {
+		resolver := NewResolver(&ExecutionContext{
+			Context:   ctx,
+			Runtime:   rt,
+			Workspace: rt.workspace,
+			Variables: make(map[string]interface{}),
+		})
+		var input interface{}
+		if input, err = resolver.Resolve(inputValue); err != nil {
+			logTrigger(ctx, rt, trigger.Name(), slog.LevelError, "trigger input failed", "error", err)
+			return
+		}
+		opts = append(opts, WithInput(input))
+	}
+	if rt.config.HeartbeatInterval > 0 {
+		// Heartbeats tell slow runs apart from hung ones in the server log
+		opts = append(opts, WithStreamHandler(&CallbackStreamHandler{ProgressFunc: func(event ProgressEvent) {
+			if event.Type == ProgressTypeHeartbeat {
+				logTrigger(ctx, rt, trigger.Name(), slog.LevelInfo, event.Message, "step", event.Step)
+			}
+		}}))
+	}
 
-	_, err := e.runtime.ExecuteByName(context.Background(), entityType, entityName)
+	var result *ExecutionResult
+	if rollout != nil {
+		result, err = rollout.ExecuteByName(ctx, target.Type, target.Name, opts...)
+	} else {
+		result, err = rt.ExecuteByName(ctx, target.Type, target.Name, opts...)
+	}
 	if err != nil {
-		fmt.Printf("Trigger execution failed: %v\n", err)
+		args := []any{"error", err}
+		if result != nil {
+			args = append(args, "run_id", result.RunID)
+		}
+		logTrigger(ctx, rt, trigger.Name(), slog.LevelError, "trigger execution failed", args...)
+	}
+}
+
+// logTrigger logs an entry about a trigger with the runtime's logger, outside
+// the trigger's execution.
+func logTrigger(ctx context.Context, rt *Runtime, trigger string, level slog.Level, msg string, args ...any) {
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	ctx = withLogAttrs(withLogger(ctx, rt.logger), slog.String("trigger", trigger))
+	logAt(ctx, level, msg, args...)
 }
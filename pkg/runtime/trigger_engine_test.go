@@ -0,0 +1,324 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func newTriggerEngine(t *testing.T, trigger string) (*TriggerEngine, *MockProvider) {
+	t.Helper()
+	source := `
+agent "helper" {
+	model: "mock-model"
+}
+
+intent "ask" {
+	use: agent("helper")
+}
+` + trigger
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "ok", FinishReason: FinishReasonStop}))
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, source))
+
+	e := NewTriggerEngine(New(ws, WithProvider("mock", provider)))
+	e.runCtx = context.Background()
+	return e, provider
+}
+
+func TestTriggerEngine_Schedule(t *testing.T) {
+	e, provider := newTriggerEngine(t, `
+trigger "nightly" {
+	schedule: "0 2 * * *"
+	timezone: "UTC"
+	run: intent("ask") {
+		input: "report"
+	}
+}
+`)
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	e.syncSchedules(start)
+
+	want := time.Date(2025, time.January, 16, 2, 0, 0, 0, time.UTC)
+	if next := e.NextRuns()["nightly"]; !next.Equal(want) {
+		t.Fatalf("next run = %v, want %v", next, want)
+	}
+
+	e.checkTriggers(want.Add(-time.Minute))
+	e.running.Wait()
+	if n := len(provider.GetRequests()); n != 0 {
+		t.Fatalf("expected no runs before the scheduled time, got %d", n)
+	}
+
+	e.checkTriggers(want.Add(10 * time.Second))
+	e.running.Wait()
+	requests := provider.GetRequests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(requests))
+	}
+	if msg := requests[0].Messages[len(requests[0].Messages)-1].Content; !strings.Contains(msg, "report") {
+		t.Errorf("expected trigger input in request, got %q", msg)
+	}
+	if next := e.NextRuns()["nightly"]; !next.Equal(want.Add(24 * time.Hour)) {
+		t.Errorf("next run = %v, want %v", next, want.Add(24*time.Hour))
+	}
+}
+
+func TestTriggerEngine_MissedRuns(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 0, 30, 0, 0, time.UTC)
+	// Woken at 03:45: the 01:00, 02:00, and 03:00 runs were missed
+	late := time.Date(2025, time.January, 15, 3, 45, 0, 0, time.UTC)
+
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{"skip", 0},
+		{"run_once", 1},
+		{"run_all", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			e, provider := newTriggerEngine(t, `
+trigger "hourly" {
+	event: schedule("@hourly")
+	timezone: "UTC"
+	missed: "`+tt.policy+`"
+	use: intent("ask")
+}
+`)
+			e.syncSchedules(start)
+			e.checkTriggers(late)
+			e.running.Wait()
+
+			if n := len(provider.GetRequests()); n != tt.want {
+				t.Errorf("expected %d runs, got %d", tt.want, n)
+			}
+			if next := e.NextRuns()["hourly"]; !next.Equal(late.Add(15 * time.Minute)) {
+				t.Errorf("unexpected next run %v", next)
+			}
+		})
+	}
+}
+
+func TestTriggerEngine_DefaultTimezone(t *testing.T) {
+	e, _ := newTriggerEngine(t, `
+config {
+	timezone: "Europe/Stockholm"
+}
+
+trigger "digest" {
+	schedule: "0 8 * * *"
+	run: intent("ask")
+}
+`)
+	e.syncSchedules(time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC))
+
+	// 08:00 in Stockholm is 07:00 UTC in winter
+	want := time.Date(2025, time.January, 16, 7, 0, 0, 0, time.UTC)
+	if next := e.NextRuns()["digest"]; !next.Equal(want) {
+		t.Errorf("next run = %v, want %v", next, want)
+	}
+}
+
+func TestTriggerEngine_InvalidSchedule(t *testing.T) {
+	e, _ := newTriggerEngine(t, `
+trigger "broken" {
+	schedule: "not a schedule"
+	run: intent("ask")
+}
+
+trigger "bad_policy" {
+	schedule: "@daily"
+	missed: "sometimes"
+	run: intent("ask")
+}
+
+trigger "bad_timezone" {
+	schedule: "@daily"
+	timezone: "Mars/Olympus"
+	run: intent("ask")
+}
+`)
+	var buf bytes.Buffer
+	e.source().logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	e.syncSchedules(time.Now())
+	if runs := e.NextRuns(); len(runs) != 0 {
+		t.Errorf("expected invalid triggers to be unscheduled, got %v", runs)
+	}
+
+	// Each is reported through the runtime's logger
+	logged := make(map[string]bool)
+	for _, entry := range logEntries(t, &buf) {
+		if entry["level"] == "WARN" && entry["msg"] == "trigger not scheduled" {
+			logged[entry["trigger"].(string)] = true
+		}
+	}
+	if !logged["broken"] || !logged["bad_policy"] || !logged["bad_timezone"] {
+		t.Errorf("expected a warning for each trigger, got %q", buf.String())
+	}
+}
+
+func TestTriggerEngine_Shutdown(t *testing.T) {
+	e, _ := newTriggerEngine(t, `
+trigger "minutely" {
+	schedule: "* * * * *"
+	run: intent("ask")
+}
+`)
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if err := e.Start(context.Background()); err == nil {
+		t.Error("expected error starting an active engine")
+	}
+
+	// A slow execution is cancelled when the shutdown deadline passes
+	release := make(chan struct{})
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		select {
+		case <-e.runCtx.Done():
+		case <-release:
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	close(release)
+
+	if err := e.Stop(); err != nil {
+		t.Errorf("Stop after Shutdown: %v", err)
+	}
+}
+
+func TestTriggerEngine_Fire(t *testing.T) {
+	e, provider := newTriggerEngine(t, `
+trigger "webhook" {
+	event: "deploy"
+	priority: "high"
+	run: intent("ask") {
+		input: "default"
+	}
+}
+`)
+	if err := e.Fire("webhook", nil); err == nil {
+		t.Error("expected error firing on an inactive engine")
+	}
+	e.active = true
+
+	if err := e.Fire("missing", nil); err == nil {
+		t.Error("expected error for an unknown trigger")
+	}
+	if err := e.Fire("webhook", "from the request"); err != nil {
+		t.Fatalf("Fire error: %v", err)
+	}
+	e.running.Wait()
+	requests := provider.GetRequests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(requests))
+	}
+	if msg := requests[0].Messages[len(requests[0].Messages)-1].Content; !strings.Contains(msg, "from the request") {
+		t.Errorf("expected the fired input in request, got %q", msg)
+	}
+}
+
+func TestTriggerEngine_FireAs(t *testing.T) {
+	e, provider := newTriggerEngine(t, `
+intent "refund" {
+	use: agent("helper")
+	owners: ["team-payments"]
+}
+
+trigger "webhook" {
+	event: "deploy"
+	run: intent("ask")
+}
+
+trigger "refund-requested" {
+	event: "refund"
+	run: intent("refund")
+}
+
+trigger "payments-only" {
+	event: "deploy"
+	owners: ["team-payments"]
+	run: intent("ask")
+}
+`)
+	e.active = true
+
+	for _, name := range []string{"refund-requested", "payments-only"} {
+		if err := e.FireAs(name, nil, []string{"alice"}); !errors.Is(err, workspace.ErrForbidden) {
+			t.Errorf("FireAs(%s) error = %v, want ErrForbidden", name, err)
+		}
+	}
+	if err := e.FireAs("webhook", nil, nil); err != nil {
+		t.Errorf("expected anyone to fire an unowned trigger, got %v", err)
+	}
+	if err := e.FireAs("refund-requested", nil, []string{"alice", "team-payments"}); err != nil {
+		t.Errorf("expected an owner to fire the trigger, got %v", err)
+	}
+	e.running.Wait()
+	if n := len(provider.GetRequests()); n != 2 {
+		t.Errorf("expected 2 runs, got %d", n)
+	}
+}
+
+func TestTriggerEngine_PinnedVersion(t *testing.T) {
+	e, provider := newTriggerEngine(t, `
+agent "pinned" {
+	model: "pinned-model"
+}
+
+trigger "review" {
+	event: "push"
+	run: intent("ask")@v1 {
+		input: "diff"
+	}
+}
+
+trigger "unpublished" {
+	event: "push"
+	run: intent("ask")@v2
+}
+`)
+	published := parseSource(t, `
+intent "ask" {
+	use: agent("pinned")
+}
+`)
+	ws := e.source().workspace
+	if err := ws.PublishVersion("v1", published[0]); err != nil {
+		t.Fatal(err)
+	}
+	e.active = true
+
+	if err := e.Fire("review", nil); err != nil {
+		t.Fatalf("Fire error: %v", err)
+	}
+	e.running.Wait()
+	requests := provider.GetRequests()
+	if len(requests) != 1 || requests[0].Model != "pinned-model" {
+		t.Fatalf("expected the published version to run, got %+v", requests)
+	}
+
+	if err := e.Fire("unpublished", nil); err != nil {
+		t.Fatalf("Fire error: %v", err)
+	}
+	e.running.Wait()
+	if n := len(provider.GetRequests()); n != 1 {
+		t.Errorf("expected an unpublished version not to run, got %d requests", n)
+	}
+}
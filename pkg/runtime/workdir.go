@@ -0,0 +1,90 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// WorkDirRetention controls whether the working directory of a run is kept
+// after the run finishes.
+type WorkDirRetention string
+
+const (
+	// RetainNever removes the working directory when the run finishes.
+	RetainNever WorkDirRetention = ""
+
+	// RetainOnFailure keeps the working directory of failed runs, so the
+	// files they left behind can be inspected.
+	RetainOnFailure WorkDirRetention = "on_failure"
+
+	// RetainAlways keeps every working directory.
+	RetainAlways WorkDirRetention = "always"
+)
+
+// ParseWorkDirRetention parses "never", "on_failure", or "always".
+func ParseWorkDirRetention(s string) (WorkDirRetention, error) {
+	switch s {
+	case "", "never":
+		return RetainNever, nil
+	case string(RetainOnFailure), string(RetainAlways):
+		return WorkDirRetention(s), nil
+	default:
+		return "", fmt.Errorf("unknown workdir retention %q (want never, on_failure or always)", s)
+	}
+}
+
+type workDirKey struct{}
+
+// WorkDirFromContext returns the working directory of the run a tool handler
+// was called for.
+func WorkDirFromContext(ctx context.Context) (string, bool) {
+	dir, ok := ctx.Value(workDirKey{}).(string)
+	return dir, ok
+}
+
+// createWorkDir creates the working directory of a run under the configured
+// root, or the system temp directory.
+func (r *Runtime) createWorkDir() (string, error) {
+	root := r.config.WorkDirRoot
+	if root != "" {
+		if err := os.MkdirAll(root, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create workdir root: %w", err)
+		}
+	}
+	dir, err := os.MkdirTemp(root, "ls_run_")
+	if err != nil {
+		return "", fmt.Errorf("failed to create workdir: %w", err)
+	}
+	return dir, nil
+}
+
+// releaseWorkDir removes the working directory of a finished run unless the
+// retention policy keeps it.
+func (r *Runtime) releaseWorkDir(ctx context.Context, dir string, failed bool) {
+	switch r.config.RetainWorkDir {
+	case RetainAlways:
+		return
+	case RetainOnFailure:
+		if failed {
+			logAt(ctx, slog.LevelInfo, "keeping workdir of failed run", "dir", dir)
+			return
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logAt(ctx, slog.LevelWarn, "failed to remove workdir", "dir", dir, "error", err)
+	}
+}
+
+// resolvePath returns path relative to the run's working directory, if it
+// is relative and the run has one. Forward slashes in path are converted to
+// the platform's separator.
+func (ec *ExecutionContext) resolvePath(path string) string {
+	path = filepath.FromSlash(path)
+	if ec.WorkDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ec.WorkDir, path)
+}
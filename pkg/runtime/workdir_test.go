@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+func newWorkDirScript(code string) ast.Entity {
+	script := ast.NewScriptEntity("workdir")
+	script.SetProperty("language", ast.StringValue{Value: "sh"})
+	script.SetProperty("code", ast.StringValue{Value: code})
+	return script
+}
+
+func TestExecute_WorkDir(t *testing.T) {
+	root := t.TempDir()
+	rt := New(workspace.New(), WithConfig(&Config{WorkDirRoot: root}))
+
+	res, err := rt.Execute(context.Background(), newWorkDirScript("echo hi > out.txt && pwd"))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	dir := strings.TrimSpace(toString(res.Output))
+	if filepath.Dir(dir) != root || !strings.HasPrefix(filepath.Base(dir), "ls_run_") {
+		t.Errorf("expected the script to run in a workdir under %s, got %s", root, dir)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the workdir to be removed, got %v", err)
+	}
+}
+
+func TestExecute_WorkDirRetention(t *testing.T) {
+	tests := []struct {
+		retain WorkDirRetention
+		code   string
+		kept   bool
+	}{
+		{RetainNever, "echo x > out.txt; exit 1", false},
+		{RetainOnFailure, "echo x > out.txt", false},
+		{RetainOnFailure, "echo x > out.txt; exit 1", true},
+		{RetainAlways, "echo x > out.txt", true},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		rt := New(workspace.New(), WithConfig(&Config{WorkDirRoot: root, RetainWorkDir: tt.retain}))
+		_, _ = rt.Execute(context.Background(), newWorkDirScript(tt.code))
+
+		kept, _ := filepath.Glob(filepath.Join(root, "ls_run_*", "out.txt"))
+		if got := len(kept) == 1; got != tt.kept {
+			t.Errorf("retain %q, script %q: kept = %v, want %v", tt.retain, tt.code, got, tt.kept)
+		}
+	}
+}
+
+func TestExecute_WorkDirVariable(t *testing.T) {
+	ws := workspace.New()
+	addEntities(t, ws, parseSource(t, `
+agent "writer" {
+	model: "mock-model"
+}
+
+intent "save" {
+	use: agent("writer")
+	input: "Save to {{workdir}}"
+}
+`))
+	provider := NewMockProvider(WithMockResponses(MockResponse{Content: "ok"}))
+	rt := New(ws, WithProvider("mock", provider), WithConfig(&Config{RetainWorkDir: RetainAlways}))
+	intent, _ := ws.GetEntityByName("intent", "save")
+
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		if _, err := rt.Execute(context.Background(), intent); err != nil {
+			t.Fatalf("execute error: %v", err)
+		}
+		prompt := provider.GetRequests()[i].Messages[0].Content
+		dir := prompt[strings.Index(prompt, "Save to ")+len("Save to "):]
+		dir = strings.Fields(dir)[0]
+		t.Cleanup(func() { _ = os.RemoveAll(dir) })
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("expected $workdir to be a directory, got %v", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	if dirs[0] == dirs[1] {
+		t.Errorf("expected each run to get its own workdir, got %s twice", dirs[0])
+	}
+}
+
+func TestResolver_WriteFileWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	resolver := NewResolver(&ExecutionContext{
+		Workspace: workspace.New(),
+		Variables: make(map[string]interface{}),
+		WorkDir:   dir,
+	})
+	entities := parseSource(t, "step \"s\" {\n\tvalue: write_file(\"notes.txt\", \"hello\")\n}")
+	v, _ := entities[0].GetProperty("value")
+	if _, err := resolver.Resolve(v); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("expected notes.txt in the workdir, got %q, %v", data, err)
+	}
+}
+
+func TestExecuteFunction_FileToolsWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	rt := New(workspace.New())
+	ctx := &ExecutionContext{Context: context.Background(), Runtime: rt, Variables: make(map[string]interface{}), WorkDir: dir}
+
+	content := "it's a \"quoted\" $HOME %PATH%\n"
+	if err := os.Mkdir(filepath.Join(dir, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.executeFunction(ctx, "write_file", map[string]interface{}{"path": "out/notes.txt", "content": content}); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	got, err := rt.executeFunction(ctx, "read_file", map[string]interface{}{"path": "out/notes.txt"})
+	if err != nil || got != content {
+		t.Errorf("expected the content back unchanged, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,580 @@
+package grpc
+
+// The messages of langspace.proto. Go programs run LangSpace through the
+// runtime package, so they are unexported and only the server and tests
+// encode and decode them.
+
+type executeRequest struct {
+	name       string
+	inputJSON  string
+	paramsJSON string
+	metadata   map[string]string
+	timeoutMS  int64
+}
+
+func (m *executeRequest) marshal() []byte {
+	var e encoder
+	e.string(1, m.name)
+	e.string(2, m.inputJSON)
+	e.string(3, m.paramsJSON)
+	e.stringMap(4, m.metadata)
+	e.int(5, m.timeoutMS)
+	return e.buf
+}
+
+func (m *executeRequest) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.name, err = d.string()
+		case 2:
+			m.inputJSON, err = d.string()
+		case 3:
+			m.paramsJSON, err = d.string()
+		case 4:
+			err = d.stringMapEntry(&m.metadata)
+		case 5:
+			m.timeoutMS, err = d.int()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type executeResponse struct {
+	success    bool
+	output     string
+	error      string
+	durationMS int64
+	tokensUsed *tokenUsage
+	metadata   map[string]string
+	runID      string
+	steps      []*stepResult
+}
+
+func (m *executeResponse) marshal() []byte {
+	var e encoder
+	e.bool(1, m.success)
+	e.string(2, m.output)
+	e.string(3, m.error)
+	e.int(4, m.durationMS)
+	if m.tokensUsed != nil {
+		e.message(5, m.tokensUsed)
+	}
+	e.stringMap(6, m.metadata)
+	e.string(7, m.runID)
+	for _, s := range m.steps {
+		e.message(8, s)
+	}
+	return e.buf
+}
+
+func (m *executeResponse) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.success, err = d.bool()
+		case 2:
+			m.output, err = d.string()
+		case 3:
+			m.error, err = d.string()
+		case 4:
+			m.durationMS, err = d.int()
+		case 5:
+			m.tokensUsed = &tokenUsage{}
+			err = unmarshalField(&d, m.tokensUsed)
+		case 6:
+			err = d.stringMapEntry(&m.metadata)
+		case 7:
+			m.runID, err = d.string()
+		case 8:
+			step := &stepResult{}
+			err = unmarshalField(&d, step)
+			m.steps = append(m.steps, step)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type stepResult struct {
+	name       string
+	status     string
+	output     string
+	error      string
+	durationMS int64
+	model      string
+	tokensUsed *tokenUsage
+}
+
+func (m *stepResult) marshal() []byte {
+	var e encoder
+	e.string(1, m.name)
+	e.string(2, m.status)
+	e.string(3, m.output)
+	e.string(4, m.error)
+	e.int(5, m.durationMS)
+	e.string(6, m.model)
+	if m.tokensUsed != nil {
+		e.message(7, m.tokensUsed)
+	}
+	return e.buf
+}
+
+func (m *stepResult) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.name, err = d.string()
+		case 2:
+			m.status, err = d.string()
+		case 3:
+			m.output, err = d.string()
+		case 4:
+			m.error, err = d.string()
+		case 5:
+			m.durationMS, err = d.int()
+		case 6:
+			m.model, err = d.string()
+		case 7:
+			m.tokensUsed = &tokenUsage{}
+			err = unmarshalField(&d, m.tokensUsed)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type tokenUsage struct {
+	inputTokens  int64
+	outputTokens int64
+	totalTokens  int64
+}
+
+func (m *tokenUsage) marshal() []byte {
+	var e encoder
+	e.int(1, m.inputTokens)
+	e.int(2, m.outputTokens)
+	e.int(3, m.totalTokens)
+	return e.buf
+}
+
+func (m *tokenUsage) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.inputTokens, err = d.int()
+		case 2:
+			m.outputTokens, err = d.int()
+		case 3:
+			m.totalTokens, err = d.int()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// executeEvent is one of its fields, which are a oneof.
+type executeEvent struct {
+	chunk    *chunk
+	progress *progress
+	result   *executeResponse
+}
+
+func (m *executeEvent) marshal() []byte {
+	var e encoder
+	switch {
+	case m.chunk != nil:
+		e.message(1, m.chunk)
+	case m.progress != nil:
+		e.message(2, m.progress)
+	case m.result != nil:
+		e.message(3, m.result)
+	}
+	return e.buf
+}
+
+func (m *executeEvent) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		*m = executeEvent{}
+		switch field {
+		case 1:
+			m.chunk = &chunk{}
+			err = unmarshalField(&d, m.chunk)
+		case 2:
+			m.progress = &progress{}
+			err = unmarshalField(&d, m.progress)
+		case 3:
+			m.result = &executeResponse{}
+			err = unmarshalField(&d, m.result)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type chunk struct {
+	content string
+	typ     string
+	index   int64
+}
+
+func (m *chunk) marshal() []byte {
+	var e encoder
+	e.string(1, m.content)
+	e.string(2, m.typ)
+	e.int(3, m.index)
+	return e.buf
+}
+
+func (m *chunk) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.content, err = d.string()
+		case 2:
+			m.typ, err = d.string()
+		case 3:
+			m.index, err = d.int()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type progress struct {
+	typ      string
+	message  string
+	step     string
+	progress int64
+	metadata map[string]string
+}
+
+func (m *progress) marshal() []byte {
+	var e encoder
+	e.string(1, m.typ)
+	e.string(2, m.message)
+	e.string(3, m.step)
+	e.int(4, m.progress)
+	e.stringMap(5, m.metadata)
+	return e.buf
+}
+
+func (m *progress) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.typ, err = d.string()
+		case 2:
+			m.message, err = d.string()
+		case 3:
+			m.step, err = d.string()
+		case 4:
+			m.progress, err = d.int()
+		case 5:
+			err = d.stringMapEntry(&m.metadata)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type validateRequest struct {
+	source string
+	locale string
+}
+
+func (m *validateRequest) marshal() []byte {
+	var e encoder
+	e.string(1, m.source)
+	e.string(2, m.locale)
+	return e.buf
+}
+
+func (m *validateRequest) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.source, err = d.string()
+		case 2:
+			m.locale, err = d.string()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type validateResponse struct {
+	valid       bool
+	diagnostics []*diagnostic
+}
+
+func (m *validateResponse) marshal() []byte {
+	var e encoder
+	e.bool(1, m.valid)
+	for _, diag := range m.diagnostics {
+		e.message(2, diag)
+	}
+	return e.buf
+}
+
+func (m *validateResponse) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.valid, err = d.bool()
+		case 2:
+			diag := &diagnostic{}
+			err = unmarshalField(&d, diag)
+			m.diagnostics = append(m.diagnostics, diag)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type diagnostic struct {
+	line     int64
+	column   int64
+	severity string
+	code     string
+	message  string
+}
+
+func (m *diagnostic) marshal() []byte {
+	var e encoder
+	e.int(1, m.line)
+	e.int(2, m.column)
+	e.string(3, m.severity)
+	e.string(4, m.code)
+	e.string(5, m.message)
+	return e.buf
+}
+
+func (m *diagnostic) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.line, err = d.int()
+		case 2:
+			m.column, err = d.int()
+		case 3:
+			m.severity, err = d.string()
+		case 4:
+			m.code, err = d.string()
+		case 5:
+			m.message, err = d.string()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type listEntitiesRequest struct {
+	typ string
+}
+
+func (m *listEntitiesRequest) marshal() []byte {
+	var e encoder
+	e.string(1, m.typ)
+	return e.buf
+}
+
+func (m *listEntitiesRequest) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.typ, err = d.string()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type listEntitiesResponse struct {
+	entities []*entity
+}
+
+func (m *listEntitiesResponse) marshal() []byte {
+	var e encoder
+	for _, ent := range m.entities {
+		e.message(1, ent)
+	}
+	return e.buf
+}
+
+func (m *listEntitiesResponse) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			ent := &entity{}
+			err = unmarshalField(&d, ent)
+			m.entities = append(m.entities, ent)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type entity struct {
+	typ        string
+	name       string
+	line       int64
+	column     int64
+	owners     []string
+	visibility string
+}
+
+func (m *entity) marshal() []byte {
+	var e encoder
+	e.string(1, m.typ)
+	e.string(2, m.name)
+	e.int(3, m.line)
+	e.int(4, m.column)
+	for _, owner := range m.owners {
+		e.string(5, owner)
+	}
+	e.string(6, m.visibility)
+	return e.buf
+}
+
+func (m *entity) unmarshal(data []byte) error {
+	d := decoder{buf: data}
+	for {
+		field, err := d.next()
+		if err != nil || field == 0 {
+			return err
+		}
+		switch field {
+		case 1:
+			m.typ, err = d.string()
+		case 2:
+			m.name, err = d.string()
+		case 3:
+			m.line, err = d.int()
+		case 4:
+			m.column, err = d.int()
+		case 5:
+			var owner string
+			owner, err = d.string()
+			m.owners = append(m.owners, owner)
+		case 6:
+			m.visibility, err = d.string()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unmarshaler is a message that can be decoded.
+type unmarshaler interface {
+	unmarshal(data []byte) error
+}
+
+// unmarshalField decodes the message field last read by d into m.
+func unmarshalField(d *decoder, m unmarshaler) error {
+	data, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	return m.unmarshal(data)
+}
@@ -0,0 +1,503 @@
+// Package grpc serves the LangSpace gRPC API, so services in any language
+// can run intents and pipelines, validate LangSpace source, and list
+// entities remotely. The service is defined in langspace.proto:
+//
+//	srv := grpc.NewHTTPServer(":9090", grpc.NewServer(runtime.NewRollout(rt)))
+//	err := srv.ListenAndServe()
+//
+// The server speaks the gRPC protocol over unencrypted HTTP/2 with the
+// standard library, without the grpc-go module. It supports the protobuf
+// encoding without compression, and deadlines set with grpc-timeout.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// servicePath is the path prefix of the service's methods.
+const servicePath = "/langspace.v1.LangSpace/"
+
+// maxMessageSize is the largest request message accepted, gRPC's default.
+const maxMessageSize = 4 << 20
+
+// Server serves the LangSpace gRPC API as an http.Handler. Executions run on
+// the stable or canary runtime of a rollout, like trigger firings, and the
+// other methods look at the stable one. Executions join the trace of a W3C
+// traceparent header sent with the call.
+//
+// Callers may only execute entities they own and list the private ones they
+// own (see workspace.CheckExecute and workspace.CanView); who they are comes
+// from the server's Authenticator.
+type Server struct {
+	rollout      *runtime.Rollout
+	authenticate Authenticator
+}
+
+// Authenticator returns the principals, the users and teams, a call acts
+// as, or an error if its credentials are invalid. Calls without credentials
+// act as no one, so they can use only entities without owners.
+type Authenticator func(r *http.Request) ([]string, error)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAuthenticator sets who calls act as. By default they act as no one.
+func WithAuthenticator(fn Authenticator) Option {
+	return func(s *Server) {
+		s.authenticate = fn
+	}
+}
+
+// NewServer creates a server for the runtimes of rollout.
+func NewServer(rollout *runtime.Rollout, opts ...Option) *Server {
+	s := &Server{
+		rollout:      rollout,
+		authenticate: func(*http.Request) ([]string, error) { return nil, nil },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewHTTPServer returns an http.Server that serves s on addr over
+// unencrypted HTTP/2, as gRPC clients without TLS expect.
+func NewHTTPServer(addr string, s *Server) *http.Server {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// ServeHTTP handles a gRPC call.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "expected content type application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	// Executions join the caller's trace
+	ctx := runtime.ContextWithTraceparent(r.Context(), r.Header.Get("traceparent"))
+	if v := r.Header.Get("Grpc-Timeout"); v != "" {
+		timeout, err := parseTimeout(v)
+		if err != nil {
+			writeStatus(w, statusErrorf(codeInvalidArgument, "invalid grpc-timeout %q", v))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	principals, err := s.authenticate(r)
+	if err != nil {
+		writeStatus(w, statusErrorf(codeUnauthenticated, "%v", err))
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, servicePath) {
+	case "ExecuteIntent":
+		err = s.executeIntent(ctx, r.Body, w, principals)
+	case "ExecutePipeline":
+		err = s.executePipeline(ctx, r.Body, w, principals)
+	case "ValidateWorkspace":
+		err = s.validateWorkspace(r.Body, w)
+	case "ListEntities":
+		err = s.listEntities(r.Body, w, principals)
+	default:
+		err = statusErrorf(codeUnimplemented, "unknown method %s", r.URL.Path)
+	}
+	writeStatus(w, err)
+}
+
+func (s *Server) executeIntent(ctx context.Context, body io.Reader, w io.Writer, principals []string) error {
+	var req executeRequest
+	if err := readMessage(body, &req); err != nil {
+		return err
+	}
+	opts, err := executeOptions(&req)
+	if err != nil {
+		return err
+	}
+	if err := s.checkExecute("intent", req.name, principals); err != nil {
+		return err
+	}
+	resp, err := newExecuteResponse(s.rollout.ExecuteByName(ctx, "intent", req.name, opts...))
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, resp)
+}
+
+func (s *Server) executePipeline(ctx context.Context, body io.Reader, w http.ResponseWriter, principals []string) error {
+	var req executeRequest
+	if err := readMessage(body, &req); err != nil {
+		return err
+	}
+	opts, err := executeOptions(&req)
+	if err != nil {
+		return err
+	}
+	if err := s.checkExecute("pipeline", req.name, principals); err != nil {
+		return err
+	}
+
+	stream := &eventStream{w: w}
+	opts = append(opts, runtime.WithStreamHandler(stream))
+	resp, err := newExecuteResponse(s.rollout.ExecuteByName(ctx, "pipeline", req.name, opts...))
+	if err != nil {
+		return err
+	}
+	return stream.send(&executeEvent{result: resp})
+}
+
+// checkExecute returns an error unless principals may execute an entity of
+// the stable version. Entities that do not exist are left for the execution
+// to report.
+func (s *Server) checkExecute(entityType, name string, principals []string) error {
+	entity, ok := s.rollout.Stable().Workspace().GetEntityByName(entityType, name)
+	if !ok {
+		return nil
+	}
+	if !workspace.CanView(entity, principals) {
+		return i18n.New(i18n.EntityNotFound, entityType, name)
+	}
+	return workspace.CheckExecute(entity, principals)
+}
+
+func (s *Server) validateWorkspace(body io.Reader, w io.Writer) error {
+	var req validateRequest
+	if err := readMessage(body, &req); err != nil {
+		return err
+	}
+
+	var diags []*diagnostic
+	ws := s.rollout.Stable().Workspace()
+	if req.source != "" {
+		ws, diags = parseSource(req.source, req.locale)
+	}
+	for _, warn := range ws.ValidateToolUsage() {
+		diags = append(diags, &diagnostic{
+			line:     int64(warn.Line),
+			column:   int64(warn.Column),
+			severity: "warning",
+			code:     string(warn.Code),
+			message:  fmt.Sprintf("%s %q: %s", warn.EntityType, warn.EntityName, warn.LocalizeMessage(req.locale)),
+		})
+	}
+	for _, e := range ws.ValidateSemantics() {
+		diags = append(diags, &diagnostic{
+			line:     int64(e.Line),
+			column:   int64(e.Column),
+			severity: "error",
+			code:     string(e.Code),
+			message:  fmt.Sprintf("%s %q: %s", e.EntityType, e.EntityName, e.LocalizeMessage(req.locale)),
+		})
+	}
+
+	// Ignore comments in submitted source silence its diagnostics
+	if req.source != "" {
+		suppressions := parser.ParseSuppressions(req.source)
+		n := 0
+		for _, d := range diags {
+			if !suppressions.Suppressed(int(d.line), i18n.Code(d.code)) {
+				diags[n] = d
+				n++
+			}
+		}
+		diags = diags[:n]
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].line != diags[j].line {
+			return diags[i].line < diags[j].line
+		}
+		return diags[i].column < diags[j].column
+	})
+
+	resp := &validateResponse{valid: true, diagnostics: diags}
+	for _, d := range diags {
+		if d.severity == "error" {
+			resp.valid = false
+		}
+	}
+	return writeMessage(w, resp)
+}
+
+// parseSource parses source on its own into a workspace, returning its
+// parse errors and the entities it could not add.
+func parseSource(source, locale string) (*workspace.Workspace, []*diagnostic) {
+	var diags []*diagnostic
+	result := parser.New(source).ParseWithRecovery()
+	for _, e := range result.Errors {
+		diags = append(diags, &diagnostic{
+			line:     int64(e.Line),
+			column:   int64(e.Column),
+			severity: "error",
+			code:     string(e.Code),
+			message:  e.LocalizeMessage(locale),
+		})
+	}
+
+	ws := workspace.New()
+	for _, e := range result.Entities {
+		if err := ws.AddEntity(e); err != nil {
+			diags = append(diags, &diagnostic{
+				line:     int64(e.Line()),
+				column:   int64(e.Column()),
+				severity: "error",
+				code:     string(i18n.CodeOf(err)),
+				message:  i18n.Localize(err, locale),
+			})
+		}
+	}
+	return ws, diags
+}
+
+func (s *Server) listEntities(body io.Reader, w io.Writer, principals []string) error {
+	var req listEntitiesRequest
+	if err := readMessage(body, &req); err != nil {
+		return err
+	}
+
+	ws := s.rollout.Stable().Workspace()
+	var entities []ast.Entity
+	if req.typ != "" {
+		entities = ws.GetEntitiesByType(req.typ)
+	} else {
+		entities = ws.GetEntities()
+	}
+	resp := &listEntitiesResponse{}
+	for _, e := range entities {
+		if !workspace.CanView(e, principals) {
+			continue
+		}
+		resp.entities = append(resp.entities, &entity{
+			typ:        e.Type(),
+			name:       e.Name(),
+			line:       int64(e.Line()),
+			column:     int64(e.Column()),
+			owners:     ast.Owners(e),
+			visibility: ast.Visibility(e),
+		})
+	}
+	return writeMessage(w, resp)
+}
+
+// executeOptions returns the options of an execution request.
+func executeOptions(req *executeRequest) ([]runtime.ExecuteOption, error) {
+	if req.name == "" {
+		return nil, statusErrorf(codeInvalidArgument, "name is required")
+	}
+
+	var opts []runtime.ExecuteOption
+	if req.inputJSON != "" {
+		var input interface{}
+		if err := json.Unmarshal([]byte(req.inputJSON), &input); err != nil {
+			return nil, statusErrorf(codeInvalidArgument, "input_json: %v", err)
+		}
+		opts = append(opts, runtime.WithInput(input))
+	}
+	if req.paramsJSON != "" {
+		var params map[string]interface{}
+		if err := json.Unmarshal([]byte(req.paramsJSON), &params); err != nil {
+			return nil, statusErrorf(codeInvalidArgument, "params_json must be a JSON object: %v", err)
+		}
+		opts = append(opts, runtime.WithParams(params))
+	}
+	for k, v := range req.metadata {
+		opts = append(opts, runtime.WithMetadata(k, v))
+	}
+	if req.timeoutMS > 0 {
+		opts = append(opts, runtime.WithTimeout(time.Duration(req.timeoutMS)*time.Millisecond))
+	}
+	return opts, nil
+}
+
+// newExecuteResponse converts the outcome of an execution. An execution
+// that ran and failed is a response with its error; one that could not
+// start, such as for an unknown entity, is an error status.
+func newExecuteResponse(result *runtime.ExecutionResult, err error) (*executeResponse, error) {
+	if result == nil {
+		if err == nil {
+			err = errors.New("execution returned no result")
+		}
+		return nil, errorStatus(err)
+	}
+
+	resp := &executeResponse{
+		success:    result.Success && err == nil,
+		output:     outputString(result.Output),
+		durationMS: result.Duration.Milliseconds(),
+		tokensUsed: newTokenUsage(result.TokensUsed),
+		metadata:   result.Metadata,
+		runID:      result.RunID,
+	}
+	if err == nil {
+		err = result.Error
+	}
+	if err != nil {
+		resp.error = err.Error()
+	}
+
+	steps := make([]*runtime.StepResult, 0, len(result.StepResults))
+	for _, step := range result.StepResults {
+		steps = append(steps, step)
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		if !steps[i].StartTime.Equal(steps[j].StartTime) {
+			return steps[i].StartTime.Before(steps[j].StartTime)
+		}
+		return steps[i].Name < steps[j].Name
+	})
+	for _, step := range steps {
+		sr := &stepResult{
+			name:       step.Name,
+			status:     string(step.Status),
+			output:     outputString(step.Output),
+			durationMS: step.Duration.Milliseconds(),
+			model:      step.Model,
+			tokensUsed: newTokenUsage(step.TokensUsed),
+		}
+		if step.Error != nil {
+			sr.error = step.Error.Error()
+		}
+		resp.steps = append(resp.steps, sr)
+	}
+	return resp, nil
+}
+
+func newTokenUsage(t runtime.TokenUsage) *tokenUsage {
+	return &tokenUsage{inputTokens: int64(t.InputTokens), outputTokens: int64(t.OutputTokens), totalTokens: int64(t.TotalTokens)}
+}
+
+// outputString returns text output as is and other output as JSON.
+func outputString(output interface{}) string {
+	switch v := output.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Sprint(output)
+	}
+	return string(data)
+}
+
+// eventStream is a stream handler that sends the chunks and progress of a
+// pipeline as ExecuteEvents. Parallel steps call it concurrently.
+type eventStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (s *eventStream) send(event *executeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeMessage(s.w, event); err != nil {
+		return err
+	}
+	return http.NewResponseController(s.w).Flush()
+}
+
+func (s *eventStream) OnChunk(c runtime.StreamChunk) {
+	_ = s.send(&executeEvent{chunk: &chunk{content: c.Content, typ: string(c.Type), index: int64(c.Index)}})
+}
+
+func (s *eventStream) OnProgress(event runtime.ProgressEvent) {
+	_ = s.send(&executeEvent{progress: &progress{
+		typ:      string(event.Type),
+		message:  event.Message,
+		step:     event.Step,
+		progress: int64(event.Progress),
+		metadata: event.Metadata,
+	}})
+}
+
+// OnComplete and OnError are per model response; the result event reports
+// the outcome of the pipeline.
+func (s *eventStream) OnComplete(*runtime.CompletionResponse) {}
+func (s *eventStream) OnError(error)                          {}
+
+// readMessage reads the single length-prefixed message of a unary request
+// into m.
+func readMessage(r io.Reader, m unmarshaler) error {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return statusErrorf(codeInvalidArgument, "reading request: %v", err)
+	}
+	if header[0] != 0 {
+		return statusErrorf(codeUnimplemented, "compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return statusErrorf(codeResourceExhausted, "request of %d bytes exceeds the limit of %d", size, maxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return statusErrorf(codeInvalidArgument, "reading request: %v", err)
+	}
+	if err := m.unmarshal(data); err != nil {
+		return statusErrorf(codeInvalidArgument, "decoding request: %v", err)
+	}
+	return nil
+}
+
+// writeMessage writes m as a length-prefixed message.
+func writeMessage(w io.Writer, m message) error {
+	data := m.marshal()
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// parseTimeout parses a grpc-timeout header, such as "10S" or "500m".
+func parseTimeout(v string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("invalid timeout %q", v)
+	}
+	unit, ok := units[v[len(v)-1]]
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", v)
+	}
+	return time.Duration(n) * unit, nil
+}
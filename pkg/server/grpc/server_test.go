@@ -0,0 +1,335 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+const testSource = `
+agent "writer" {
+	model: "mock-model"
+}
+
+intent "greet" {
+	use: agent("writer")
+	input: "Say hello"
+}
+
+pipeline "draft" {
+	step "outline" {
+		use: agent("writer")
+		input: "Outline"
+	}
+	step "write" {
+		use: agent("writer")
+		input: step("outline").output
+	}
+}
+`
+
+// newTestServer serves the API for testSource, answered by provider, over
+// unencrypted HTTP/2.
+func newTestServer(t *testing.T, provider runtime.LLMProvider) (*httptest.Server, *http.Client) {
+	t.Helper()
+	return newSourceServer(t, testSource, provider)
+}
+
+// newSourceServer is newTestServer for any source and server options.
+func newSourceServer(t *testing.T, source string, provider runtime.LLMProvider, opts ...Option) (*httptest.Server, *http.Client) {
+	t.Helper()
+	result := parser.New(source).ParseWithRecovery()
+	if result.HasErrors() {
+		t.Fatalf("parse error: %s", result.ErrorString())
+	}
+	ws := workspace.New()
+	for _, e := range result.Entities {
+		if err := ws.AddEntity(e); err != nil {
+			t.Fatalf("add entity error: %v", err)
+		}
+	}
+	rt := runtime.New(ws, runtime.WithProvider("mock", provider))
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := httptest.NewUnstartedServer(NewServer(runtime.NewRollout(rt), opts...))
+	server.Config.Protocols = &protocols
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+// call makes a call of method and returns the messages and trailers of its
+// response.
+func call(t *testing.T, server *httptest.Server, client *http.Client, method string, req message) ([][]byte, http.Header) {
+	t.Helper()
+	return callAs(t, server, client, "", method, req)
+}
+
+// callAs is call with an Authorization header, if not empty.
+func callAs(t *testing.T, server *httptest.Server, client *http.Client, authorization, method string, req message) ([][]byte, http.Header) {
+	t.Helper()
+	var body bytes.Buffer
+	if err := writeMessage(&body, req); err != nil {
+		t.Fatal(err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, server.URL+servicePath+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	if authorization != "" {
+		httpReq.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+
+	var messages [][]byte
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(resp.Body, header[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(resp.Body, data); err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		messages = append(messages, data)
+	}
+	return messages, resp.Trailer
+}
+
+func TestServer_ExecuteIntent(t *testing.T) {
+	provider := runtime.NewMockProvider(runtime.WithMockResponses(runtime.MockResponse{Content: "Hello!"}))
+	server, client := newTestServer(t, provider)
+
+	messages, trailer := call(t, server, client, "ExecuteIntent", &executeRequest{name: "greet", metadata: map[string]string{"caller": "billing"}})
+	if trailer.Get("Grpc-Status") != "0" || len(messages) != 1 {
+		t.Fatalf("expected one message and status OK, got %d and %v", len(messages), trailer)
+	}
+	var resp executeResponse
+	if err := resp.unmarshal(messages[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.success || resp.output != "Hello!" {
+		t.Errorf("expected a successful execution with output %q, got %+v", "Hello!", resp)
+	}
+	if resp.metadata["caller"] != "billing" || resp.metadata["rollout_version"] != "stable" {
+		t.Errorf("expected the request's metadata and the rollout version, got %v", resp.metadata)
+	}
+}
+
+func TestServer_ExecutePipelineStreams(t *testing.T) {
+	provider := runtime.NewMockProvider(runtime.WithMockResponses(
+		runtime.MockResponse{Content: "1. Greeting"},
+		runtime.MockResponse{Content: "Hello, world"},
+	))
+	server, client := newTestServer(t, provider)
+
+	messages, trailer := call(t, server, client, "ExecutePipeline", &executeRequest{name: "draft"})
+	if trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("expected status OK, got %v", trailer)
+	}
+
+	var content strings.Builder
+	var progressEvents int
+	var result *executeResponse
+	for i, data := range messages {
+		var event executeEvent
+		if err := event.unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case event.chunk != nil:
+			content.WriteString(event.chunk.content)
+		case event.progress != nil:
+			progressEvents++
+		case event.result != nil:
+			if i != len(messages)-1 {
+				t.Errorf("expected the result to be the last event")
+			}
+			result = event.result
+		}
+	}
+	if content.String() != "1. GreetingHello, world" {
+		t.Errorf("expected both steps' chunks, got %q", content.String())
+	}
+	if progressEvents == 0 {
+		t.Error("expected progress events")
+	}
+	if result == nil || !result.success || result.output != "Hello, world" {
+		t.Fatalf("expected a successful result, got %+v", result)
+	}
+	if len(result.steps) != 2 || result.steps[0].name != "outline" || result.steps[1].status != "succeeded" {
+		t.Errorf("expected the steps in order, got %+v", result.steps)
+	}
+}
+
+func TestServer_ExecuteErrors(t *testing.T) {
+	server, client := newTestServer(t, runtime.NewMockProvider())
+
+	tests := []struct {
+		name     string
+		method   string
+		req      *executeRequest
+		wantCode string
+	}{
+		{name: "unknown intent", method: "ExecuteIntent", req: &executeRequest{name: "missing"}, wantCode: "5"},
+		{name: "pipeline as intent", method: "ExecuteIntent", req: &executeRequest{name: "draft"}, wantCode: "5"},
+		{name: "no name", method: "ExecutePipeline", req: &executeRequest{}, wantCode: "3"},
+		{name: "invalid input", method: "ExecutePipeline", req: &executeRequest{name: "draft", inputJSON: "{"}, wantCode: "3"},
+		{name: "unknown method", method: "Explain", req: &executeRequest{name: "draft"}, wantCode: "12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, trailer := call(t, server, client, tt.method, tt.req)
+			if got := trailer.Get("Grpc-Status"); got != tt.wantCode {
+				t.Errorf("expected status %s, got %s (%s)", tt.wantCode, got, trailer.Get("Grpc-Message"))
+			}
+			if len(messages) != 0 {
+				t.Errorf("expected no messages, got %d", len(messages))
+			}
+		})
+	}
+}
+
+func TestServer_ValidateWorkspace(t *testing.T) {
+	server, client := newTestServer(t, runtime.NewMockProvider())
+
+	messages, _ := call(t, server, client, "ValidateWorkspace", &validateRequest{})
+	var resp validateResponse
+	if len(messages) != 1 || resp.unmarshal(messages[0]) != nil {
+		t.Fatalf("expected one response, got %d", len(messages))
+	}
+	if !resp.valid || len(resp.diagnostics) != 0 {
+		t.Errorf("expected the served workspace to be valid, got %+v", resp.diagnostics)
+	}
+
+	source := `pipeline "review" {
+  step "check" {
+    use: agent("reviewer")
+  }
+}
+`
+	messages, _ = call(t, server, client, "ValidateWorkspace", &validateRequest{source: source, locale: "de"})
+	resp = validateResponse{}
+	if len(messages) != 1 || resp.unmarshal(messages[0]) != nil {
+		t.Fatalf("expected one response, got %d", len(messages))
+	}
+	if resp.valid || len(resp.diagnostics) != 1 {
+		t.Fatalf("expected one error, got %+v", resp.diagnostics)
+	}
+	if d := resp.diagnostics[0]; d.code != "LS2004" || d.line != 2 || d.severity != "error" || !strings.Contains(d.message, "nicht definierte") {
+		t.Errorf("expected a German LS2004 error at line 2, got %+v", d)
+	}
+}
+
+func TestServer_ListEntities(t *testing.T) {
+	server, client := newTestServer(t, runtime.NewMockProvider())
+
+	tests := []struct {
+		typ  string
+		want []string
+	}{
+		{typ: "", want: []string{"agent writer", "intent greet", "pipeline draft"}},
+		{typ: "pipeline", want: []string{"pipeline draft"}},
+	}
+	for _, tt := range tests {
+		messages, _ := call(t, server, client, "ListEntities", &listEntitiesRequest{typ: tt.typ})
+		var resp listEntitiesResponse
+		if len(messages) != 1 || resp.unmarshal(messages[0]) != nil {
+			t.Fatalf("expected one response, got %d", len(messages))
+		}
+		var got []string
+		for _, e := range resp.entities {
+			got = append(got, e.typ+" "+e.name)
+			if e.line == 0 {
+				t.Errorf("expected %s %q to have a line", e.typ, e.name)
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("ListEntities(%q) = %v, want %v", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestServer_Owners(t *testing.T) {
+	source := testSource + `
+intent "refund" {
+	use: agent("writer")
+	owners: ["team-payments"]
+}
+
+intent "payroll" {
+	use: agent("writer")
+	owners: ["team-hr"]
+	visibility: "private"
+}
+`
+	server, client := newSourceServer(t, source, runtime.NewMockProvider(), WithAuthenticator(func(r *http.Request) ([]string, error) {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return nil, nil
+		case "Bearer payments":
+			return []string{"alice", "team-payments"}, nil
+		}
+		return nil, errors.New("invalid token")
+	}))
+	tests := []struct {
+		name     string
+		token    string
+		intent   string
+		wantCode string
+	}{
+		{name: "owner", token: "Bearer payments", intent: "refund", wantCode: "0"},
+		{name: "not an owner", intent: "refund", wantCode: "7"},
+		{name: "no owners", intent: "greet", wantCode: "0"},
+		{name: "private", token: "Bearer payments", intent: "payroll", wantCode: "5"},
+		{name: "invalid token", token: "Bearer guess", intent: "greet", wantCode: "16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, trailer := callAs(t, server, client, tt.token, "ExecuteIntent", &executeRequest{name: tt.intent})
+			if got := trailer.Get("Grpc-Status"); got != tt.wantCode {
+				t.Errorf("expected status %s, got %s (%s)", tt.wantCode, got, trailer.Get("Grpc-Message"))
+			}
+		})
+	}
+
+	messages, _ := callAs(t, server, client, "Bearer payments", "ListEntities", &listEntitiesRequest{typ: "intent"})
+	var resp listEntitiesResponse
+	if len(messages) != 1 || resp.unmarshal(messages[0]) != nil {
+		t.Fatalf("expected one response, got %d", len(messages))
+	}
+	if len(resp.entities) != 2 {
+		t.Fatalf("expected the private intent to be left out, got %d intents", len(resp.entities))
+	}
+	if refund := resp.entities[1]; refund.name != "refund" || strings.Join(refund.owners, ",") != "team-payments" || refund.visibility != "public" {
+		t.Errorf("expected refund with its owners, got %+v", refund)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	for v, ok := range map[string]bool{"10S": true, "500m": true, "1H": true, "S": false, "10x": false, "-1S": false} {
+		if _, err := parseTimeout(v); (err == nil) != ok {
+			t.Errorf("parseTimeout(%q) error = %v", v, err)
+		}
+	}
+}
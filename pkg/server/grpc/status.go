@@ -0,0 +1,92 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/runtime"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// gRPC status codes.
+const (
+	codeOK                = 0
+	codeCanceled          = 1
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codeNotFound          = 5
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnauthenticated   = 16
+)
+
+// statusError is an error with a gRPC status code.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.code, e.message)
+}
+
+func statusErrorf(code int, format string, args ...interface{}) error {
+	return &statusError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus returns err as a statusError, with the code that fits it.
+func errorStatus(err error) *statusError {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se
+	}
+	var paramErr *runtime.ParamError
+	code := codeUnknown
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codeCanceled
+	case i18n.CodeOf(err) == i18n.EntityNotFound:
+		code = codeNotFound
+	case errors.Is(err, workspace.ErrForbidden):
+		code = codePermissionDenied
+	case errors.As(err, &paramErr):
+		code = codeInvalidArgument
+	}
+	return &statusError{code: code, message: err.Error()}
+}
+
+// writeStatus ends a call with the status of err, or OK if it is nil.
+func writeStatus(w http.ResponseWriter, err error) {
+	code, message := codeOK, ""
+	if err != nil {
+		se := errorStatus(err)
+		code, message = se.code, se.message
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(message))
+	}
+}
+
+// encodeMessage percent-encodes a status message, as grpc-message requires.
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,215 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Protocol buffer wire types used by langspace.proto.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends fields in the protocol buffer wire format. Like proto3,
+// it leaves out fields with zero values.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *encoder) int(field int, v int64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendUvarint(e.buf, uint64(v))
+	}
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.int(field, 1)
+	}
+}
+
+func (e *encoder) string(field int, v string) {
+	if v != "" {
+		e.tag(field, wireBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	}
+}
+
+// message appends m, even if it is empty.
+func (e *encoder) message(field int, m message) {
+	data := m.marshal()
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+// stringMap appends a map<string, string>, ordered by key so the encoding
+// is stable.
+func (e *encoder) stringMap(field int, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.message(field, mapEntry{k, m[k]})
+	}
+}
+
+// mapEntry is an entry of a map<string, string>.
+type mapEntry struct {
+	key, value string
+}
+
+func (m mapEntry) marshal() []byte {
+	var e encoder
+	e.string(1, m.key)
+	e.string(2, m.value)
+	return e.buf
+}
+
+// message is a protocol buffer message.
+type message interface {
+	marshal() []byte
+}
+
+// errTruncated is the error for a message that ends in the middle of a
+// field.
+var errTruncated = errors.New("truncated message")
+
+// decoder reads the fields of a message in the protocol buffer wire format.
+type decoder struct {
+	buf []byte
+
+	// wire is the wire type of the field last read
+	wire int
+}
+
+// next returns the number of the next field, or 0 at the end of the
+// message.
+func (d *decoder) next() (int, error) {
+	if len(d.buf) == 0 {
+		return 0, nil
+	}
+	tag, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	field := int(tag >> 3)
+	if field == 0 {
+		return 0, fmt.Errorf("invalid field number 0")
+	}
+	d.wire = int(tag & 7)
+	return field, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *decoder) int() (int64, error) {
+	if d.wire != wireVarint {
+		return 0, fmt.Errorf("expected a varint, got wire type %d", d.wire)
+	}
+	v, err := d.uvarint()
+	return int64(v), err
+}
+
+func (d *decoder) bool() (bool, error) {
+	v, err := d.int()
+	return v != 0, err
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	if d.wire != wireBytes {
+		return nil, fmt.Errorf("expected a length-delimited field, got wire type %d", d.wire)
+	}
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, errTruncated
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *decoder) string() (string, error) {
+	v, err := d.bytes()
+	return string(v), err
+}
+
+// stringMapEntry reads an entry of a map<string, string> into m.
+func (d *decoder) stringMapEntry(m *map[string]string) error {
+	data, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	var key, value string
+	entry := decoder{buf: data}
+	for {
+		field, err := entry.next()
+		if err != nil || field == 0 {
+			if err == nil {
+				if *m == nil {
+					*m = make(map[string]string)
+				}
+				(*m)[key] = value
+			}
+			return err
+		}
+		switch field {
+		case 1:
+			key, err = entry.string()
+		case 2:
+			value, err = entry.string()
+		default:
+			err = entry.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skip skips the field last read, for fields the message does not know.
+func (d *decoder) skip() error {
+	var n int
+	switch d.wire {
+	case wireVarint:
+		_, err := d.uvarint()
+		return err
+	case wireBytes:
+		_, err := d.bytes()
+		return err
+	case wireFixed64:
+		n = 8
+	case wireFixed32:
+		n = 4
+	default:
+		return fmt.Errorf("unsupported wire type %d", d.wire)
+	}
+	if len(d.buf) < n {
+		return errTruncated
+	}
+	d.buf = d.buf[n:]
+	return nil
+}
@@ -3,6 +3,7 @@
 package tokenizer
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -60,6 +61,28 @@ const (
 	TokenTypeNumber
 	// TokenTypeBoolean represents a boolean literal (true/false)
 	TokenTypeBoolean
+	// TokenTypeQuestionDot represents optional chaining (?.)
+	TokenTypeQuestionDot
+	// TokenTypeDoubleQuestion represents the default operator (??)
+	TokenTypeDoubleQuestion
+	// TokenTypePlus represents the addition operator (+)
+	TokenTypePlus
+	// TokenTypeMinus represents the subtraction operator (-)
+	TokenTypeMinus
+	// TokenTypeStar represents the multiplication operator (*)
+	TokenTypeStar
+	// TokenTypeSlash represents the division operator (/)
+	TokenTypeSlash
+	// TokenTypePercent represents the remainder operator (%)
+	TokenTypePercent
+	// TokenTypeAnd represents the logical and operator (&&)
+	TokenTypeAnd
+	// TokenTypeOr represents the logical or operator (||)
+	TokenTypeOr
+	// TokenTypeNot represents the logical not operator (!)
+	TokenTypeNot
+	// TokenTypeAt represents the version pin of a reference (@)
+	TokenTypeAt
 )
 
 // Token represents a lexical token
@@ -68,6 +91,7 @@ type Token struct {
 	Value  string
 	Line   int
 	Column int
+	Offset int // Byte offset of the token's first character
 }
 
 // Tokenizer represents a LangSpace tokenizer
@@ -82,6 +106,21 @@ func New() *Tokenizer {
 	return &Tokenizer{}
 }
 
+// afterOperand reports whether the last token, ignoring comments, ends an
+// operand, so that a following - subtracts rather than negates.
+func afterOperand(tokens []Token) bool {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		switch tokens[i].Type {
+		case TokenTypeComment:
+			continue
+		case TokenTypeNumber, TokenTypeIdentifier, TokenTypeString, TokenTypeRightParen, TokenTypeRightBracket:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
 // Tokenize breaks the input string into tokens
 func (t *Tokenizer) Tokenize(input string) []Token {
 	var tokens []Token
@@ -90,6 +129,7 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 	i := 0
 
 	for i < len(input) {
+		offset, n := i, len(tokens)
 		switch {
 		case input[i] == '#':
 			// Handle single-line comments
@@ -101,7 +141,7 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			}
 			tokens = append(tokens, Token{
 				Type:   TokenTypeComment,
-				Value:  input[start:i],
+				Value:  strings.TrimSuffix(input[start:i], "\r"),
 				Line:   line,
 				Column: startCol,
 			})
@@ -206,6 +246,36 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			i++
 			column++
 
+		case input[i] == '?' && i+1 < len(input) && input[i+1] == '.':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeQuestionDot,
+				Value:  "?.",
+				Line:   line,
+				Column: column,
+			})
+			i += 2
+			column += 2
+
+		case input[i] == '?' && i+1 < len(input) && input[i+1] == '?':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeDoubleQuestion,
+				Value:  "??",
+				Line:   line,
+				Column: column,
+			})
+			i += 2
+			column += 2
+
+		case input[i] == '@':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeAt,
+				Value:  "@",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
 		case input[i] == '$':
 			tokens = append(tokens, Token{
 				Type:   TokenTypeDollar,
@@ -246,6 +316,16 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			i += 2
 			column += 2
 
+		case input[i] == '!':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeNot,
+				Value:  "!",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
 		case input[i] == '<' && i+1 < len(input) && input[i+1] == '=':
 			tokens = append(tokens, Token{
 				Type:   TokenTypeLessEquals,
@@ -296,7 +376,67 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			i++
 			column++
 
-		case unicode.IsDigit(rune(input[i])) || (input[i] == '-' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1]))):
+		case input[i] == '+':
+			tokens = append(tokens, Token{
+				Type:   TokenTypePlus,
+				Value:  "+",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
+		case input[i] == '*':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeStar,
+				Value:  "*",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
+		case input[i] == '/':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeSlash,
+				Value:  "/",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
+		case input[i] == '%':
+			tokens = append(tokens, Token{
+				Type:   TokenTypePercent,
+				Value:  "%",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
+		case input[i] == '&' && i+1 < len(input) && input[i+1] == '&':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeAnd,
+				Value:  "&&",
+				Line:   line,
+				Column: column,
+			})
+			i += 2
+			column += 2
+
+		case input[i] == '|' && i+1 < len(input) && input[i+1] == '|':
+			tokens = append(tokens, Token{
+				Type:   TokenTypeOr,
+				Value:  "||",
+				Line:   line,
+				Column: column,
+			})
+			i += 2
+			column += 2
+
+		case unicode.IsDigit(rune(input[i])) || (input[i] == '-' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1])) && !afterOperand(tokens)):
 			start := i
 			startCol := column
 			if input[i] == '-' {
@@ -314,6 +454,18 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 				Column: startCol,
 			})
 
+		case input[i] == '-':
+			// A minus directly before a digit starts a negative number
+			// unless it follows an operand, as in 5-3 or $n -1
+			tokens = append(tokens, Token{
+				Type:   TokenTypeMinus,
+				Value:  "-",
+				Line:   line,
+				Column: column,
+			})
+			i++
+			column++
+
 		case unicode.IsLetter(rune(input[i])) || input[i] == '_':
 			start := i
 			startCol := column
@@ -361,9 +513,11 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			}
 
 			if i+2 < len(input) {
+				// Files saved with Windows line endings give the
+				// same string as ones saved with Unix line endings
 				tokens = append(tokens, Token{
 					Type:   TokenTypeMultilineString,
-					Value:  input[start:i],
+					Value:  strings.ReplaceAll(input[start:i], "\r\n", "\n"),
 					Line:   startLine,
 					Column: startCol,
 				})
@@ -378,9 +532,14 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			start := i
 			for i < len(input) && input[i] != '"' {
 				if input[i] == '\\' && i+1 < len(input) {
-					// Skip escaped character
+					// Skip escaped character, which may be a newline
+					if input[i+1] == '\n' {
+						line++
+						column = 1
+					} else {
+						column += 2
+					}
 					i += 2
-					column += 2
 					continue
 				}
 				if input[i] == '\n' {
@@ -417,6 +576,9 @@ func (t *Tokenizer) Tokenize(input string) []Token {
 			i++
 			column++
 		}
+		if len(tokens) > n {
+			tokens[n].Offset = offset
+		}
 	}
 
 	return tokens
@@ -474,6 +636,28 @@ func (t TokenType) String() string {
 		return "NUMBER"
 	case TokenTypeBoolean:
 		return "BOOLEAN"
+	case TokenTypeQuestionDot:
+		return "QUESTION_DOT"
+	case TokenTypeDoubleQuestion:
+		return "DOUBLE_QUESTION"
+	case TokenTypePlus:
+		return "PLUS"
+	case TokenTypeMinus:
+		return "MINUS"
+	case TokenTypeStar:
+		return "STAR"
+	case TokenTypeSlash:
+		return "SLASH"
+	case TokenTypePercent:
+		return "PERCENT"
+	case TokenTypeAnd:
+		return "AND"
+	case TokenTypeOr:
+		return "OR"
+	case TokenTypeNot:
+		return "NOT"
+	case TokenTypeAt:
+		return "AT"
 	default:
 		return "UNKNOWN"
 	}
@@ -1,6 +1,7 @@
 package tokenizer
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -125,6 +126,77 @@ func TestTokenizer_Tokenize(t *testing.T) {
 				{Type: TokenTypeString, Value: "fix", Line: 1, Column: 15},
 			},
 		},
+		{
+			name:  "optional_chaining",
+			input: `step("x")?.output ?? null`,
+			expected: []Token{
+				{Type: TokenTypeIdentifier, Value: "step", Line: 1, Column: 1},
+				{Type: TokenTypeLeftParen, Value: "(", Line: 1, Column: 5},
+				{Type: TokenTypeString, Value: "x", Line: 1, Column: 6},
+				{Type: TokenTypeRightParen, Value: ")", Line: 1, Column: 9},
+				{Type: TokenTypeQuestionDot, Value: "?.", Line: 1, Column: 10},
+				{Type: TokenTypeIdentifier, Value: "output", Line: 1, Column: 12},
+				{Type: TokenTypeDoubleQuestion, Value: "??", Line: 1, Column: 19},
+				{Type: TokenTypeIdentifier, Value: "null", Line: 1, Column: 22},
+			},
+		},
+		{
+			name:  "arithmetic_and_logical_operators",
+			input: `!(a + 1 - -2) * b / c % d && e || f`,
+			expected: []Token{
+				{Type: TokenTypeNot, Value: "!", Line: 1, Column: 1},
+				{Type: TokenTypeLeftParen, Value: "(", Line: 1, Column: 2},
+				{Type: TokenTypeIdentifier, Value: "a", Line: 1, Column: 3},
+				{Type: TokenTypePlus, Value: "+", Line: 1, Column: 5},
+				{Type: TokenTypeNumber, Value: "1", Line: 1, Column: 7},
+				{Type: TokenTypeMinus, Value: "-", Line: 1, Column: 9},
+				{Type: TokenTypeNumber, Value: "-2", Line: 1, Column: 11},
+				{Type: TokenTypeRightParen, Value: ")", Line: 1, Column: 13},
+				{Type: TokenTypeStar, Value: "*", Line: 1, Column: 15},
+				{Type: TokenTypeIdentifier, Value: "b", Line: 1, Column: 17},
+				{Type: TokenTypeSlash, Value: "/", Line: 1, Column: 19},
+				{Type: TokenTypeIdentifier, Value: "c", Line: 1, Column: 21},
+				{Type: TokenTypePercent, Value: "%", Line: 1, Column: 23},
+				{Type: TokenTypeIdentifier, Value: "d", Line: 1, Column: 25},
+				{Type: TokenTypeAnd, Value: "&&", Line: 1, Column: 27},
+				{Type: TokenTypeIdentifier, Value: "e", Line: 1, Column: 30},
+				{Type: TokenTypeOr, Value: "||", Line: 1, Column: 32},
+				{Type: TokenTypeIdentifier, Value: "f", Line: 1, Column: 35},
+			},
+		},
+		{
+			name:  "minus_after_operand",
+			input: `5-3 $n -1 (a)-1 [-1]`,
+			expected: []Token{
+				{Type: TokenTypeNumber, Value: "5", Line: 1, Column: 1},
+				{Type: TokenTypeMinus, Value: "-", Line: 1, Column: 2},
+				{Type: TokenTypeNumber, Value: "3", Line: 1, Column: 3},
+				{Type: TokenTypeDollar, Value: "$", Line: 1, Column: 5},
+				{Type: TokenTypeIdentifier, Value: "n", Line: 1, Column: 6},
+				{Type: TokenTypeMinus, Value: "-", Line: 1, Column: 8},
+				{Type: TokenTypeNumber, Value: "1", Line: 1, Column: 9},
+				{Type: TokenTypeLeftParen, Value: "(", Line: 1, Column: 11},
+				{Type: TokenTypeIdentifier, Value: "a", Line: 1, Column: 12},
+				{Type: TokenTypeRightParen, Value: ")", Line: 1, Column: 13},
+				{Type: TokenTypeMinus, Value: "-", Line: 1, Column: 14},
+				{Type: TokenTypeNumber, Value: "1", Line: 1, Column: 15},
+				{Type: TokenTypeLeftBracket, Value: "[", Line: 1, Column: 17},
+				{Type: TokenTypeNumber, Value: "-1", Line: 1, Column: 18},
+				{Type: TokenTypeRightBracket, Value: "]", Line: 1, Column: 20},
+			},
+		},
+		{
+			name:  "version_pin",
+			input: `pipeline("review")@v3`,
+			expected: []Token{
+				{Type: TokenTypeIdentifier, Value: "pipeline", Line: 1, Column: 1},
+				{Type: TokenTypeLeftParen, Value: "(", Line: 1, Column: 9},
+				{Type: TokenTypeString, Value: "review", Line: 1, Column: 10},
+				{Type: TokenTypeRightParen, Value: ")", Line: 1, Column: 18},
+				{Type: TokenTypeAt, Value: "@", Line: 1, Column: 19},
+				{Type: TokenTypeIdentifier, Value: "v3", Line: 1, Column: 20},
+			},
+		},
 		{
 			name:  "with_whitespace",
 			input: `file   "test.txt"    path;    agent "gpt-4" model;`,
@@ -219,6 +291,11 @@ func TestTokenType_String(t *testing.T) {
 		{TokenTypeDot, "DOT"},
 		{TokenTypeNumber, "NUMBER"},
 		{TokenTypeBoolean, "BOOLEAN"},
+		{TokenTypeQuestionDot, "QUESTION_DOT"},
+		{TokenTypeDoubleQuestion, "DOUBLE_QUESTION"},
+		{TokenTypePlus, "PLUS"},
+		{TokenTypeNot, "NOT"},
+		{TokenTypeAt, "AT"},
 		{TokenType(999), "UNKNOWN"},
 	}
 
@@ -335,6 +412,17 @@ func TestTokenizer_Comments(t *testing.T) {
 				{Type: TokenTypeComment, Value: "# inline comment", Line: 1, Column: 23},
 			},
 		},
+		{
+			name:  "comment_with_crlf",
+			input: "# Comment\r\nfile \"test.txt\" path;",
+			expected: []Token{
+				{Type: TokenTypeComment, Value: "# Comment", Line: 1, Column: 1},
+				{Type: TokenTypeIdentifier, Value: "file", Line: 2, Column: 1},
+				{Type: TokenTypeString, Value: "test.txt", Line: 2, Column: 6},
+				{Type: TokenTypeIdentifier, Value: "path", Line: 2, Column: 17},
+				{Type: TokenTypeSemicolon, Value: ";", Line: 2, Column: 21},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -361,3 +449,43 @@ func TestTokenizer_Comments(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizer_MultilineCRLF(t *testing.T) {
+	unix := New().Tokenize("prompt: ```\nline one\nline two\n```")
+	windows := New().Tokenize("prompt: ```\r\nline one\r\nline two\r\n```")
+
+	if len(windows) != len(unix) {
+		t.Fatalf("got %d tokens, want %d", len(windows), len(unix))
+	}
+	for i := range unix {
+		if windows[i] != unix[i] {
+			t.Errorf("Token[%d] = %+v, want %+v", i, windows[i], unix[i])
+		}
+	}
+}
+
+func TestTokenizer_Offset(t *testing.T) {
+	input := "# note\nagent \"a b\" {\n  x: ```\nmulti\n```\n}"
+	for _, token := range New().Tokenize(input) {
+		rest := input[token.Offset:]
+		var prefix string
+		switch token.Type {
+		case TokenTypeString:
+			prefix = `"` + token.Value + `"`
+		case TokenTypeMultilineString:
+			prefix = "```" + token.Value + "```"
+		default:
+			prefix = token.Value
+		}
+		if !strings.HasPrefix(rest, prefix) {
+			t.Errorf("%v %q at offset %d, found %q", token.Type, token.Value, token.Offset, rest)
+		}
+	}
+}
+
+func TestTokenizer_EscapedNewline(t *testing.T) {
+	tokens := New().Tokenize("x: \"a\\\nb\"\ny")
+	if last := tokens[len(tokens)-1]; last.Value != "y" || last.Line != 3 || last.Column != 1 {
+		t.Errorf("expected y at 3:1, got %+v", last)
+	}
+}
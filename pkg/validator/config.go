@@ -0,0 +1,182 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// ConfigValueKind is the expected type of a config entity property.
+type ConfigValueKind string
+
+const (
+	ConfigString   ConfigValueKind = "string"
+	ConfigNumber   ConfigValueKind = "number"
+	ConfigBool     ConfigValueKind = "bool"
+	ConfigObject   ConfigValueKind = "object"
+	ConfigArray    ConfigValueKind = "array"
+	ConfigDuration ConfigValueKind = "duration" // "30s" or a number of seconds
+)
+
+// ConfigKeys lists the config entity properties LangSpace recognizes and
+// the type of each. Other keys are allowed for project-specific settings,
+// but keys that look like a misspelling of a recognized key are errors.
+var ConfigKeys = map[string]ConfigValueKind{
+	"default_model":       ConfigString,
+	"default_temperature": ConfigNumber,
+	"timeout":             ConfigDuration,
+	"environment":         ConfigObject,
+	"providers":           ConfigObject,
+	"provider":            ConfigString,
+	"base_url":            ConfigString,
+	"api_key":             ConfigString,
+	"models":              ConfigArray,
+	"locale":              ConfigString,
+	"timezone":            ConfigString,
+	"translation":         ConfigObject,
+}
+
+// validateConfigKeys checks recognized config properties against their
+// types and reports likely typos of recognized keys.
+func validateConfigKeys(entity ast.Entity) error {
+	props := entity.Properties()
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		kind, ok := ConfigKeys[key]
+		if !ok {
+			if suggestion := suggestConfigKey(key); suggestion != "" {
+				errs = append(errs, i18n.New(i18n.UnknownConfigKey, key, suggestion))
+			}
+			continue
+		}
+		if err := checkConfigValue(props[key], kind); err != nil {
+			errs = append(errs, i18n.New(i18n.InvalidConfigValue, key, err))
+			continue
+		}
+		if err := checkConfigEntries(key, props[key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkConfigValue reports whether value is of the given kind. Values
+// computed at runtime, such as env("KEY"), are accepted for any kind.
+func checkConfigValue(value ast.Value, kind ConfigValueKind) error {
+	var ok bool
+	switch v := value.(type) {
+	case ast.StringValue:
+		switch kind {
+		case ConfigString:
+			ok = true
+		case ConfigDuration:
+			if _, err := time.ParseDuration(v.Value); err != nil {
+				return fmt.Errorf("must be a duration like \"30s\", got %q", v.Value)
+			}
+			ok = true
+		}
+	case ast.NumberValue:
+		ok = kind == ConfigNumber || kind == ConfigDuration
+	case ast.BoolValue:
+		ok = kind == ConfigBool
+	case ast.ObjectValue:
+		ok = kind == ConfigObject
+	case ast.ArrayValue:
+		ok = kind == ConfigArray
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("must be %s %s", article(kind), kind)
+	}
+	return nil
+}
+
+// checkConfigEntries validates the entries of object-valued keys.
+func checkConfigEntries(key string, value ast.Value) error {
+	obj, ok := value.(ast.ObjectValue)
+	if !ok {
+		return nil
+	}
+	var want ConfigValueKind
+	switch key {
+	case "providers":
+		want = ConfigObject
+	case "environment":
+		want = ConfigString
+	default:
+		return nil
+	}
+
+	names := make([]string, 0, len(obj.Properties))
+	for name := range obj.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := checkConfigValue(obj.Properties[name], want); err != nil {
+			errs = append(errs, i18n.New(i18n.InvalidConfigValue, key+"."+name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func article(kind ConfigValueKind) string {
+	if kind == ConfigObject || kind == ConfigArray {
+		return "an"
+	}
+	return "a"
+}
+
+// suggestConfigKey returns the recognized key that key is likely a
+// misspelling of, or "" if there is none. Keys are also compared without
+// their "default_" prefix, so "tempratura" suggests "default_temperature".
+func suggestConfigKey(key string) string {
+	best, bestDist := "", -1
+	for known := range ConfigKeys {
+		for _, candidate := range []string{known, strings.TrimPrefix(known, "default_")} {
+			dist := editDistance(key, candidate)
+			if dist > 2 || dist*3 >= len(key) {
+				continue
+			}
+			if bestDist < 0 || dist < bestDist || (dist == bestDist && known < best) {
+				best, bestDist = known, dist
+			}
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,109 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func TestValidator_ConfigKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    map[string]ast.Value
+		errorMsg string
+	}{
+		{
+			name: "recognized keys",
+			props: map[string]ast.Value{
+				"default_model": ast.StringValue{Value: "gpt-4o"},
+				"timeout":       ast.StringValue{Value: "30s"},
+				"environment":   ast.ObjectValue{Properties: map[string]ast.Value{"REGION": ast.StringValue{Value: "eu"}}},
+				"providers": ast.ObjectValue{Properties: map[string]ast.Value{
+					"openai": ast.ObjectValue{Properties: map[string]ast.Value{"api_key": ast.ReferenceValue{Type: "env", Name: "OPENAI_API_KEY"}}},
+				}},
+			},
+		},
+		{
+			name: "project-specific keys",
+			props: map[string]ast.Value{
+				"organization": ast.ObjectValue{},
+				"compliance":   ast.ObjectValue{},
+				"sla":          ast.ObjectValue{},
+				"project_root": ast.StringValue{Value: "."},
+				"logging":      ast.ObjectValue{},
+				"cache":        ast.ObjectValue{},
+			},
+		},
+		{
+			name:     "typo of a recognized key",
+			props:    map[string]ast.Value{"tempratura": ast.NumberValue{Value: 0.2}},
+			errorMsg: `unknown config key "tempratura" (did you mean "default_temperature"?)`,
+		},
+		{
+			name:     "typo of a short key",
+			props:    map[string]ast.Value{"timout": ast.StringValue{Value: "30s"}},
+			errorMsg: `unknown config key "timout" (did you mean "timeout"?)`,
+		},
+		{
+			name:     "wrong type",
+			props:    map[string]ast.Value{"default_model": ast.NumberValue{Value: 4}},
+			errorMsg: "config 'default_model' must be a string",
+		},
+		{
+			name:     "invalid duration",
+			props:    map[string]ast.Value{"timeout": ast.StringValue{Value: "soon"}},
+			errorMsg: `config 'timeout' must be a duration like "30s", got "soon"`,
+		},
+		{
+			name: "provider settings not an object",
+			props: map[string]ast.Value{"providers": ast.ObjectValue{Properties: map[string]ast.Value{
+				"openai": ast.StringValue{Value: "sk-test"},
+			}}},
+			errorMsg: "config 'providers.openai' must be an object",
+		},
+		{
+			name: "dynamic values",
+			props: map[string]ast.Value{
+				"default_model": ast.ReferenceValue{Type: "env", Name: "MODEL"},
+				"timeout":       ast.NumberValue{Value: 30},
+			},
+		},
+	}
+
+	v := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity := ast.NewConfigEntity()
+			for key, value := range tt.props {
+				entity.SetProperty(key, value)
+			}
+			err := v.ValidateEntity(entity)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestValidator_ConfigKeysReportsAll(t *testing.T) {
+	entity := ast.NewConfigEntity()
+	entity.SetProperty("defualt_model", ast.StringValue{Value: "gpt-4o"})
+	entity.SetProperty("locale", ast.BoolValue{Value: true})
+
+	err := New().ValidateEntity(entity)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{`did you mean "default_model"`, "config 'locale' must be a string"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
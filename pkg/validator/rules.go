@@ -0,0 +1,225 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// Rule is a check of an organization's own policy, such as "agents must
+// have owners". Programs embedding LangSpace register rules in named rule
+// sets with RegisterRuleSet, and `langspace validate -rules <set>` runs
+// them.
+type Rule struct {
+	// Code identifies the rule's problems in output and in ignore
+	// directives. It is capital letters followed by digits, e.g. ACME001;
+	// the LS prefix is LangSpace's own.
+	Code i18n.Code
+
+	// Name is a short name for the rule, e.g. "agent-owners"
+	Name string
+
+	// Description says what the rule requires, and DocsURL links to its
+	// documentation, shown with each problem it finds
+	Description string
+	DocsURL     string
+
+	// Types are the entity types the rule checks, or every type if empty.
+	// Pipeline steps, parallel blocks, and eval cases are checked too.
+	Types []string
+
+	// Check returns an error describing how an entity breaks the rule, or
+	// nil. An i18n.Message is localized like LangSpace's own diagnostics.
+	Check func(entity ast.Entity) error
+}
+
+// appliesTo reports whether the rule checks entities of a type.
+func (r Rule) appliesTo(entityType string) bool {
+	if len(r.Types) == 0 {
+		return true
+	}
+	for _, t := range r.Types {
+		if t == entityType {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ruleSetsMu sync.RWMutex
+	ruleSets   = make(map[string][]Rule)
+)
+
+// RegisterRuleSet registers rules under a name, adding to any already
+// registered under it. It is meant to be called from init functions, and
+// panics on a rule without a Check or with a malformed code.
+//
+// Example:
+//
+//	validator.RegisterRuleSet("company-policy", validator.Rule{
+//	    Code:    "ACME001",
+//	    Name:    "agent-owners",
+//	    DocsURL: "https://wiki.example.com/langspace/ACME001",
+//	    Types:   []string{"agent"},
+//	    Check: func(e ast.Entity) error {
+//	        if len(ast.Owners(e)) == 0 {
+//	            return errors.New("agents must declare an owner")
+//	        }
+//	        return nil
+//	    },
+//	})
+func RegisterRuleSet(name string, rules ...Rule) {
+	for _, r := range rules {
+		if r.Check == nil {
+			panic(fmt.Sprintf("validator: rule %s in rule set %q has no Check", r.Code, name))
+		}
+		if !i18n.IsCode(string(r.Code)) {
+			panic(fmt.Sprintf("validator: rule code %q in rule set %q is not capital letters followed by digits", r.Code, name))
+		}
+	}
+	ruleSetsMu.Lock()
+	defer ruleSetsMu.Unlock()
+	ruleSets[name] = append(ruleSets[name], rules...)
+}
+
+// RuleSet returns the rules registered under a name.
+func RuleSet(name string) ([]Rule, bool) {
+	ruleSetsMu.RLock()
+	defer ruleSetsMu.RUnlock()
+	rules, ok := ruleSets[name]
+	return rules, ok
+}
+
+// RuleSets returns the names of the registered rule sets, sorted.
+func RuleSets() []string {
+	ruleSetsMu.RLock()
+	defer ruleSetsMu.RUnlock()
+	names := make([]string, 0, len(ruleSets))
+	for name := range ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuleError is a problem found by a registered rule. Its Code is the
+// rule's, so ignore directives can silence it like any other diagnostic.
+type RuleError struct {
+	SemanticError
+	RuleSet string
+	Rule    string
+	DocsURL string
+
+	cause error
+}
+
+func (e RuleError) Error() string {
+	return e.SemanticError.Error() + e.suffix()
+}
+
+// Localize returns the error with its message in the language of tag.
+func (e RuleError) Localize(tag string) string {
+	return fmt.Sprintf("%d:%d: %s %q: %s%s", e.Line, e.Column, e.EntityType, e.EntityName, e.LocalizeMessage(tag), e.suffix())
+}
+
+// LocalizeMessage returns the message alone, in the language of tag if the
+// rule reported an i18n.Message.
+func (e RuleError) LocalizeMessage(tag string) string {
+	return i18n.Localize(e.cause, tag)
+}
+
+// Unwrap returns the error the rule's Check returned.
+func (e RuleError) Unwrap() error {
+	return e.cause
+}
+
+// suffix names the code of the error and where it is documented.
+func (e RuleError) suffix() string {
+	if e.DocsURL != "" {
+		return fmt.Sprintf(" [%s, see %s]", e.Code, e.DocsURL)
+	}
+	return fmt.Sprintf(" [%s]", e.Code)
+}
+
+// CheckRules checks entities, and the steps and blocks nested in them,
+// against the rules of the named rule sets. It returns an error, before
+// checking anything, if a set is not registered.
+func (v *Validator) CheckRules(entities []ast.Entity, sets ...string) ([]RuleError, error) {
+	type namedRule struct {
+		set string
+		Rule
+	}
+	var rules []namedRule
+	for _, name := range sets {
+		set, ok := RuleSet(name)
+		if !ok {
+			registered := "none are registered"
+			if names := RuleSets(); len(names) > 0 {
+				registered = "registered: " + strings.Join(names, ", ")
+			}
+			return nil, fmt.Errorf("unknown rule set %q (%s)", name, registered)
+		}
+		for _, r := range set {
+			rules = append(rules, namedRule{name, r})
+		}
+	}
+
+	var errs []RuleError
+	check := func(e ast.Entity) {
+		for _, r := range rules {
+			if !r.appliesTo(e.Type()) {
+				continue
+			}
+			if err := r.Check(e); err != nil {
+				errs = append(errs, RuleError{
+					SemanticError: SemanticError{
+						EntityType: e.Type(),
+						EntityName: e.Name(),
+						Line:       e.Line(),
+						Column:     e.Column(),
+						Message:    err.Error(),
+						Code:       r.Code,
+					},
+					RuleSet: r.set,
+					Rule:    r.Name,
+					DocsURL: r.DocsURL,
+					cause:   err,
+				})
+			}
+		}
+	}
+	for _, e := range entities {
+		eachNestedEntity(e, check)
+	}
+	return errs, nil
+}
+
+// eachNestedEntity calls fn for e and every entity nested in it: pipeline
+// and parallel steps, eval cases, and blocks in property values.
+func eachNestedEntity(e ast.Entity, fn func(ast.Entity)) {
+	fn(e)
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		for _, step := range ent.Steps {
+			eachNestedEntity(step, fn)
+		}
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			eachNestedEntity(step, fn)
+		}
+	case *ast.EvalEntity:
+		for _, tc := range ent.Cases {
+			eachNestedEntity(tc, fn)
+		}
+	}
+	for _, key := range sortedKeys(e.Properties()) {
+		walkValue(e.Properties()[key], func(ast.Value) {}, func(nested ast.Entity) {
+			eachNestedEntity(nested, fn)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// requireProperty returns a rule check that an entity sets a property.
+func requireProperty(key string) func(ast.Entity) error {
+	return func(e ast.Entity) error {
+		if _, ok := e.GetProperty(key); !ok {
+			return errors.New("missing " + key)
+		}
+		return nil
+	}
+}
+
+func TestValidator_CheckRules(t *testing.T) {
+	RegisterRuleSet("test-rules", Rule{
+		Code:    "TEST001",
+		Name:    "agent-temperature",
+		DocsURL: "https://example.com/rules/TEST001",
+		Types:   []string{"agent"},
+		Check:   requireProperty("temperature"),
+	})
+	RegisterRuleSet("test-rules", Rule{
+		Code:  "TEST002",
+		Name:  "step-description",
+		Types: []string{"step"},
+		Check: requireProperty("description"),
+	})
+
+	entities := parseEntities(t, `agent "writer" {
+	model: "gpt-4o"
+}
+
+agent "editor" {
+	model: "gpt-4o"
+	temperature: 0.2
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+	}
+	parallel {
+		step "polish" {
+			use: agent("editor")
+			description: "Polish the draft"
+		}
+		step "check" {
+			use: agent("editor")
+		}
+	}
+}`)
+
+	errs, err := New().CheckRules(entities, "test-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`1:1: agent "writer": missing temperature [TEST001, see https://example.com/rules/TEST001]`,
+		`11:2: step "draft": missing description [TEST002]`,
+		`19:3: step "check": missing description [TEST002]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CheckRules() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if e := errs[0]; e.Code != "TEST001" || e.RuleSet != "test-rules" || e.Rule != "agent-temperature" {
+		t.Errorf("expected the rule's metadata on the error, got %+v", e)
+	}
+
+	if _, err := New().CheckRules(entities, "test-rules", "missing"); err == nil || !strings.Contains(err.Error(), `unknown rule set "missing"`) || !strings.Contains(err.Error(), "test-rules") {
+		t.Errorf("expected an unknown rule set error listing the registered sets, got %v", err)
+	}
+}
+
+func TestRuleError_Localize(t *testing.T) {
+	RegisterRuleSet("test-localized", Rule{
+		Code:  "TEST100",
+		Types: []string{"tool"},
+		Check: func(e ast.Entity) error { return i18n.New(i18n.UnknownEntityType, "widget") },
+	})
+	errs, err := New().CheckRules(parseEntities(t, `tool "search" { command: "grep" }`), "test-localized")
+	if err != nil || len(errs) != 1 {
+		t.Fatalf("CheckRules() = %v, %v; want one error", errs, err)
+	}
+	if got := errs[0].LocalizeMessage("de"); got != i18n.Translate("de", i18n.UnknownEntityType, "widget") {
+		t.Errorf("LocalizeMessage(de) = %q, want the cataloged translation", got)
+	}
+	var msg i18n.Message
+	if !errors.As(errs[0], &msg) || msg.Code != i18n.UnknownEntityType {
+		t.Error("expected the error to wrap what the rule returned")
+	}
+}
+
+func TestRegisterRuleSet_Invalid(t *testing.T) {
+	for _, r := range []Rule{
+		{Code: "TEST200"},
+		{Code: "acme1", Check: requireProperty("x")},
+		{Code: "ACME", Check: requireProperty("x")},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterRuleSet(%+v) should panic", r)
+				}
+			}()
+			RegisterRuleSet("test-invalid", r)
+		}()
+	}
+	if _, ok := RuleSet("test-invalid"); ok {
+		t.Error("expected no rules registered")
+	}
+}
@@ -0,0 +1,451 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/jsonpath"
+)
+
+// SemanticError is a problem found by the workspace-level pass, located at
+// the entity (or pipeline step) where it occurs.
+type SemanticError struct {
+	EntityType string
+	EntityName string
+	Line       int
+	Column     int
+	Message    string // in English
+
+	// Code and Args identify the message in the i18n catalog, if it is
+	// cataloged
+	Code i18n.Code
+	Args []interface{}
+}
+
+func (e SemanticError) Error() string {
+	return fmt.Sprintf("%d:%d: %s %q: %s", e.Line, e.Column, e.EntityType, e.EntityName, e.Message)
+}
+
+// Localize returns the error with its message in the language of tag.
+func (e SemanticError) Localize(tag string) string {
+	return fmt.Sprintf("%d:%d: %s %q: %s", e.Line, e.Column, e.EntityType, e.EntityName, e.LocalizeMessage(tag))
+}
+
+// LocalizeMessage returns the message alone, without the position and
+// entity, in the language of tag.
+func (e SemanticError) LocalizeMessage(tag string) string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return i18n.Translate(tag, e.Code, e.Args...)
+}
+
+// MessageCode returns the catalog code of the error, or "" if its message
+// is not cataloged.
+func (e SemanticError) MessageCode() i18n.Code {
+	return e.Code
+}
+
+// checkedReferences maps reference types to the entity types that satisfy
+// them. Other references (file, env, config) do not name entities.
+var checkedReferences = map[string][]string{
+	"agent":      {"agent"},
+	"tool":       {"tool", "mcp"},
+	"pipeline":   {"pipeline"},
+	"intent":     {"intent"},
+	"script":     {"script"},
+	"mcp":        {"mcp"},
+	"mcp_server": {"mcp"},
+	"prompt":     {"prompt"},
+}
+
+// stepTemplate matches step outputs referenced in templates: {{step.name.output}}.
+var stepTemplate = regexp.MustCompile(`\{\{\s*step\??\.([^.?\s}]+)`)
+
+// includeTemplate matches prompts included in templates: {{include "name"}}.
+var includeTemplate = regexp.MustCompile(`\{\{\s*include\s+["']([^"']*)["']`)
+
+// regexFunctions are the built-in functions whose second argument is a
+// regular expression.
+var regexFunctions = map[string]bool{
+	"regex_match":   true,
+	"regex_extract": true,
+	"regex_replace": true,
+}
+
+// CheckSemantics validates the entities as a whole, reporting every problem
+// found rather than stopping at the first:
+//   - references such as agent("x") name declared entities
+//   - pipeline steps only reference steps that run before them
+//   - pipelines do not reference each other in a cycle
+//   - prompts included with {{include "x"}} are declared and do not
+//     include each other in a cycle
+//   - tools listed by agents are declared as tools or MCP servers, or are
+//     among externalTools (such as Go handlers registered with a runtime)
+//   - literal patterns passed to regex_match, regex_extract, and
+//     regex_replace are valid RE2 regular expressions
+//   - literal paths passed to query are valid JSONPath expressions
+//
+// Errors are ordered by source position.
+func (v *Validator) CheckSemantics(entities []ast.Entity, externalTools []string) []SemanticError {
+	c := &semanticChecker{
+		declared:  map[string]map[string]bool{"tool": make(map[string]bool)},
+		pipelines: make(map[string][]string),
+		prompts:   make(map[string][]string),
+	}
+	for _, name := range externalTools {
+		c.declared["tool"][name] = true
+	}
+	for _, e := range entities {
+		if c.declared[e.Type()] == nil {
+			c.declared[e.Type()] = make(map[string]bool)
+		}
+		c.declared[e.Type()][e.Name()] = true
+	}
+
+	for _, e := range entities {
+		if p, ok := e.(*ast.PipelineEntity); ok {
+			c.checkPipeline(p)
+			continue
+		}
+		c.checkEntity(e, e, nil)
+	}
+	c.checkCycles(entities, "pipeline", c.pipelines, i18n.PipelineCycle)
+	c.checkCycles(entities, "prompt", c.prompts, i18n.PromptCycle)
+
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		if c.errs[i].Line != c.errs[j].Line {
+			return c.errs[i].Line < c.errs[j].Line
+		}
+		return c.errs[i].Column < c.errs[j].Column
+	})
+	return c.errs
+}
+
+type semanticChecker struct {
+	declared  map[string]map[string]bool // entity type -> names
+	pipelines map[string][]string        // pipeline -> pipelines it references
+	prompts   map[string][]string        // prompt -> prompts it includes
+	current   string                     // pipeline being checked
+	errs      []SemanticError
+}
+
+// stepScope is the set of steps a pipeline step may reference.
+type stepScope struct {
+	all      map[string]bool // every step in the pipeline
+	earlier  map[string]bool // steps that have run when this one runs
+	parallel bool            // the step runs in a parallel block
+}
+
+func (c *semanticChecker) report(at ast.Entity, code i18n.Code, args ...interface{}) {
+	c.errs = append(c.errs, SemanticError{
+		EntityType: at.Type(),
+		EntityName: at.Name(),
+		Line:       at.Line(),
+		Column:     at.Column(),
+		Message:    i18n.Translate(i18n.English, code, args...),
+		Code:       code,
+		Args:       args,
+	})
+}
+
+func (c *semanticChecker) isDeclared(refType, name string) bool {
+	for _, entityType := range checkedReferences[refType] {
+		if c.declared[entityType][name] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPipeline checks a pipeline's steps in execution order: sequential
+// steps first, then parallel blocks, which may reference any sequential step.
+// Steps in branch and loop blocks may reference any step.
+func (c *semanticChecker) checkPipeline(p *ast.PipelineEntity) {
+	c.current = p.Name()
+	defer func() { c.current = "" }()
+
+	all := make(map[string]bool)
+	for _, step := range p.Steps {
+		all[step.Name()] = true
+	}
+	sequential := make(map[string]bool, len(all))
+	for name := range all {
+		sequential[name] = true
+	}
+	for _, key := range sortedKeys(p.Properties()) {
+		walkValue(p.Properties()[key], func(ast.Value) {}, func(e ast.Entity) {
+			collectSteps(e, all)
+		})
+	}
+
+	earlier := make(map[string]bool)
+	for _, step := range p.Steps {
+		scope := &stepScope{all: all, earlier: make(map[string]bool, len(earlier))}
+		for name := range earlier {
+			scope.earlier[name] = true
+		}
+		c.checkEntity(step, step, scope)
+		earlier[step.Name()] = true
+	}
+
+	blockScope := &stepScope{all: all, earlier: all}
+	for _, key := range sortedKeys(p.Properties()) {
+		value := p.Properties()[key]
+		if nested, ok := value.(ast.NestedEntityValue); ok {
+			if parallel, ok := nested.Entity.(*ast.ParallelEntity); ok {
+				for _, step := range parallel.Steps {
+					c.checkEntity(step, step, &stepScope{all: all, earlier: sequential, parallel: true})
+				}
+				continue
+			}
+		}
+		c.checkValue(p, key, value, blockScope)
+	}
+}
+
+// collectSteps adds the names of steps in a nested block to names.
+func collectSteps(e ast.Entity, names map[string]bool) {
+	switch ent := e.(type) {
+	case *ast.StepEntity:
+		names[ent.Name()] = true
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			names[step.Name()] = true
+		}
+	}
+	for _, v := range e.Properties() {
+		walkValue(v, func(ast.Value) {}, func(nested ast.Entity) {
+			collectSteps(nested, names)
+		})
+	}
+}
+
+// checkEntity checks the references in an entity's properties. Errors are
+// reported at the entity at; scope is nil outside pipelines.
+func (c *semanticChecker) checkEntity(e, at ast.Entity, scope *stepScope) {
+	if e.Type() == "agent" {
+		for _, name := range AgentToolNames(e) {
+			if !c.isDeclared("tool", name) {
+				c.report(at, i18n.UndeclaredTool, name)
+			}
+		}
+	}
+	if parallel, ok := e.(*ast.ParallelEntity); ok {
+		for _, step := range parallel.Steps {
+			c.checkEntity(step, step, scope)
+		}
+	}
+	if eval, ok := e.(*ast.EvalEntity); ok {
+		for _, tc := range eval.Cases {
+			c.checkEntity(tc, tc, scope)
+		}
+	}
+	for _, key := range sortedKeys(e.Properties()) {
+		if e.Type() == "agent" && key == "tools" {
+			continue
+		}
+		c.checkValue(at, key, e.Properties()[key], scope)
+	}
+}
+
+func (c *semanticChecker) checkValue(at ast.Entity, key string, v ast.Value, scope *stepScope) {
+	walkValue(v, func(val ast.Value) {
+		switch ref := val.(type) {
+		case ast.ReferenceValue:
+			c.checkReference(at, ref.Type, ref.Name, scope)
+		case ast.MethodCallValue:
+			// intent("name") { ... } parses as a call with an inline body
+			if obj, ok := ref.Object.(ast.StringValue); ok && ref.InlineBody != nil {
+				c.checkReference(at, obj.Value, ref.Method, scope)
+			}
+		case ast.StringValue:
+			for _, m := range stepTemplate.FindAllStringSubmatch(ref.Value, -1) {
+				c.checkReference(at, "step", m[1], scope)
+			}
+			for _, m := range includeTemplate.FindAllStringSubmatch(ref.Value, -1) {
+				c.checkReference(at, "prompt", m[1], scope)
+			}
+		case ast.FunctionCallValue:
+			if len(ref.Arguments) < 2 {
+				break
+			}
+			// Patterns with interpolations are only known at run time
+			pattern, ok := ref.Arguments[1].(ast.StringValue)
+			if !ok || strings.Contains(pattern.Value, "{{") {
+				break
+			}
+			switch {
+			case regexFunctions[ref.Function]:
+				if _, err := regexp.Compile(pattern.Value); err != nil {
+					c.report(at, i18n.InvalidPattern, ref.Function, err)
+				}
+			case ref.Function == "query":
+				if _, err := jsonpath.Compile(pattern.Value); err != nil {
+					c.report(at, i18n.InvalidQueryPath, err)
+				}
+			}
+		}
+	}, func(nested ast.Entity) {
+		// Steps inside branch and loop blocks report at their own position
+		target := at
+		if _, ok := nested.(*ast.StepEntity); ok {
+			target = nested
+		}
+		c.checkEntity(nested, target, scope)
+	})
+}
+
+func (c *semanticChecker) checkReference(at ast.Entity, refType, name string, scope *stepScope) {
+	if refType == "step" {
+		c.checkStepReference(at, name, scope)
+		return
+	}
+	if _, checked := checkedReferences[refType]; !checked {
+		return
+	}
+	if !c.isDeclared(refType, name) {
+		c.report(at, i18n.UndefinedReference, refType, name)
+		return
+	}
+	if refType == "pipeline" && c.current != "" {
+		c.pipelines[c.current] = append(c.pipelines[c.current], name)
+	}
+	if refType == "prompt" && at.Type() == "prompt" {
+		c.prompts[at.Name()] = append(c.prompts[at.Name()], name)
+	}
+}
+
+func (c *semanticChecker) checkStepReference(at ast.Entity, name string, scope *stepScope) {
+	switch {
+	case scope == nil:
+		// Step outputs outside pipelines come from the caller
+	case !scope.all[name]:
+		c.report(at, i18n.UnknownStep, name)
+	case !scope.earlier[name] && name == at.Name() && at.Type() == "step":
+		c.report(at, i18n.SelfReference)
+	case scope.parallel && !scope.earlier[name]:
+		c.report(at, i18n.ParallelStepReference, name)
+	case !scope.earlier[name]:
+		c.report(at, i18n.LaterStepReference, name)
+	}
+}
+
+// checkCycles reports entities of entityType that reference themselves,
+// directly or through others, following edges. Each cycle is reported once,
+// with code.
+func (c *semanticChecker) checkCycles(entities []ast.Entity, entityType string, edges map[string][]string, code i18n.Code) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	byName := make(map[string]ast.Entity)
+	for _, e := range entities {
+		if e.Type() == entityType {
+			byName[e.Name()] = e
+		}
+	}
+
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range edges[name] {
+			switch state[next] {
+			case visiting:
+				start := 0
+				for i, p := range path {
+					if p == next {
+						start = i
+					}
+				}
+				cycle := append(append([]string(nil), path[start:]...), next)
+				c.report(byName[next], code, strings.Join(cycle, " -> "))
+			case unvisited:
+				visit(next)
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+	}
+
+	for _, e := range entities {
+		if e.Type() == entityType && state[e.Name()] == unvisited {
+			visit(e.Name())
+		}
+	}
+}
+
+// walkValue calls fn for every value in a value tree. Nested entities and
+// inline bodies are handed to visit instead.
+func walkValue(v ast.Value, fn func(ast.Value), visit func(ast.Entity)) {
+	switch val := v.(type) {
+	case nil:
+		return
+	case ast.ArrayValue:
+		for _, elem := range val.Elements {
+			walkValue(elem, fn, visit)
+		}
+	case ast.ObjectValue:
+		for _, key := range sortedKeys(val.Properties) {
+			walkValue(val.Properties[key], fn, visit)
+		}
+	case ast.NestedEntityValue:
+		if val.Entity != nil {
+			visit(val.Entity)
+		}
+	case ast.MethodCallValue:
+		walkValue(val.Object, fn, visit)
+		for _, arg := range val.Arguments {
+			walkValue(arg, fn, visit)
+		}
+		if val.InlineBody != nil {
+			visit(val.InlineBody)
+		}
+	case ast.FunctionCallValue:
+		for _, arg := range val.Arguments {
+			walkValue(arg, fn, visit)
+		}
+	case ast.ComparisonValue:
+		walkValue(val.Left, fn, visit)
+		walkValue(val.Right, fn, visit)
+	case ast.CoalesceValue:
+		walkValue(val.Left, fn, visit)
+		walkValue(val.Right, fn, visit)
+	case ast.ArithmeticValue:
+		walkValue(val.Left, fn, visit)
+		walkValue(val.Right, fn, visit)
+	case ast.LogicalValue:
+		walkValue(val.Left, fn, visit)
+		walkValue(val.Right, fn, visit)
+	case ast.NotValue:
+		walkValue(val.Operand, fn, visit)
+	case ast.BranchValue:
+		walkValue(val.Condition, fn, visit)
+		for _, key := range sortedKeys(val.Cases) {
+			walkValue(val.Cases[key], fn, visit)
+		}
+	case ast.LoopValue:
+		for _, b := range val.Body {
+			walkValue(b, fn, visit)
+		}
+		walkValue(val.BreakCondition, fn, visit)
+	}
+	fn(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,235 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/parser"
+)
+
+func parseEntities(t *testing.T, src string) []ast.Entity {
+	t.Helper()
+	entities, _, err := parser.New(src).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	return entities
+}
+
+func TestValidator_CheckSemantics(t *testing.T) {
+	src := `tool "search" {
+	command: "grep -r {{query}} ."
+}
+
+agent "writer" {
+	model: "gpt-4o"
+	tools: [tool("search"), "lint"]
+}
+
+intent "draft" {
+	use: agent("editor")
+}
+
+pipeline "report" {
+	step "outline" {
+		use: agent("writer")
+		input: step("draft").output
+	}
+
+	step "draft" {
+		use: agent("writer")
+		input: "{{step.outline.output}}"
+	}
+
+	parallel {
+		step "review" {
+			use: agent("writer")
+			input: step("draft").output
+		}
+
+		step "fact_check" {
+			use: agent("writer")
+			input: step("review").output
+		}
+	}
+
+	output: step("summary").output
+}
+`
+	errs := New().CheckSemantics(parseEntities(t, src), nil)
+
+	want := []string{
+		`5:1: agent "writer": uses undeclared tool "lint"`,
+		`10:1: intent "draft": references undefined agent "editor"`,
+		`14:1: pipeline "report": references unknown step "summary"`,
+		`15:2: step "outline": references step "draft", which runs after it`,
+		`31:3: step "fact_check": references step "review", which runs in the same parallel block`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, e.Error(), want[i])
+		}
+	}
+
+	if errs[1].Code != i18n.UndefinedReference {
+		t.Errorf("expected code %s, got %q", i18n.UndefinedReference, errs[1].Code)
+	}
+	if got := errs[1].Localize("es"); got != `10:1: intent "draft": hace referencia a agent "editor", que no está definido` {
+		t.Errorf("unexpected localized error %q", got)
+	}
+}
+
+func TestValidator_CheckSemanticsValid(t *testing.T) {
+	src := `mcp "fs" {
+	command: "npx"
+}
+
+agent "writer" {
+	model: "gpt-4o"
+	tools: [mcp("fs"), "handler_tool"]
+}
+
+pipeline "report" {
+	step "draft" {
+		use: agent("writer")
+		input: $input
+	}
+
+	step "polish" {
+		use: agent("writer")
+		input: step("draft").output
+		context: step("draft")?.output?.notes ?? null
+		instruction: "Keep {{step.draft?.output ?? \"the draft\"}} short"
+	}
+}
+
+trigger "nightly" {
+	schedule: "@daily"
+	run: pipeline("report") {
+		input: "today"
+	}
+}
+`
+	if errs := New().CheckSemantics(parseEntities(t, src), []string{"handler_tool"}); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestValidator_CheckSemanticsPipelineCycle(t *testing.T) {
+	src := `pipeline "a" {
+	on_success: pipeline("b")
+}
+
+pipeline "b" {
+	on_success: pipeline("c")
+}
+
+pipeline "c" {
+	on_failure: pipeline("a")
+}
+
+pipeline "d" {
+	on_success: pipeline("a")
+}
+`
+	errs := New().CheckSemantics(parseEntities(t, src), nil)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 cycle error, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Message, "circular pipeline reference: a -> b -> c -> a") {
+		t.Errorf("unexpected error %v", errs[0])
+	}
+}
+
+func TestValidator_CheckSemanticsPromptIncludes(t *testing.T) {
+	src := `prompt "style-guide" {
+	text: "Be brief. {{include 'tone'}}"
+}
+
+prompt "a" {
+	text: "{{include 'b'}}"
+}
+
+prompt "b" {
+	text: "{{include 'a'}}"
+}
+
+agent "writer" {
+	instruction: "{{include 'style-guide'}} {{ include 'glossary' }}"
+}
+`
+	errs := New().CheckSemantics(parseEntities(t, src), nil)
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.EntityName+": "+err.Message)
+	}
+	want := []string{
+		`style-guide: references undefined prompt "tone"`,
+		"a: circular prompt include: a -> b -> a",
+		`writer: references undefined prompt "glossary"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidator_CheckSemanticsRegexPatterns(t *testing.T) {
+	src := `pipeline "triage" {
+	step "classify" {
+		use: agent("writer")
+		input: $input
+	}
+
+	step "route" {
+		use: agent("writer")
+		input: regex_extract(step("classify").output, "SEVERITY: (?P<level>\w+)")?.level ?? "low"
+		context: regex_replace(step("classify").output, "(?<!x)y", "")
+		instruction: regex_match(step("classify").output, "{{step.classify.output}}")
+	}
+}
+
+agent "writer" {
+	model: "gpt-4o"
+}
+`
+	errs := New().CheckSemantics(parseEntities(t, src), nil)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	if want := `7:2: step "route": invalid pattern in regex_replace(): error parsing regexp`; !strings.Contains(errs[0].Error(), want) {
+		t.Errorf("error = %q, want it to contain %q", errs[0], want)
+	}
+}
+
+func TestValidator_CheckSemanticsQueryPaths(t *testing.T) {
+	src := `pipeline "triage" {
+	step "review" {
+		use: agent("writer")
+		input: $input
+	}
+
+	step "report" {
+		use: agent("writer")
+		input: query(step("review").output, "$.items[?(@.severity=='high')].title")
+		context: query(step("review").output, "$.items[?(@.severity=='high'].title")
+		instruction: query(step("review").output, "{{step.review.output}}")
+	}
+}
+
+agent "writer" {
+	model: "gpt-4o"
+}
+`
+	errs := New().CheckSemantics(parseEntities(t, src), nil)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	if want := `7:2: step "report": invalid JSONPath`; !strings.Contains(errs[0].Error(), want) {
+		t.Errorf("error = %q, want it to contain %q", errs[0], want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 )
 
 // Package validator provides entity validation functionality for LangSpace.
@@ -99,16 +100,110 @@ func (v *Validator) ValidateEntity(entity ast.Entity) error {
 		return v.validateMCPEntity(entity)
 	case "script":
 		return v.validateScriptEntity(entity)
+	case "provider":
+		return v.validateProviderEntity(entity)
+	case "profile":
+		return v.validateProfileEntity(entity)
+	case "prompt":
+		return v.validatePromptEntity(entity)
+	case "eval":
+		return v.validateEvalEntity(entity)
 	default:
-		return fmt.Errorf("unknown entity type: %s", entity.Type())
+		return i18n.New(i18n.UnknownEntityType, entity.Type())
 	}
 }
 
+// Warning describes a non-fatal issue found during validation.
+type Warning struct {
+	EntityType string
+	EntityName string
+	Line       int
+	Column     int
+	Message    string // in English
+	Code       i18n.Code
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s %q: %s", w.EntityType, w.EntityName, w.Message)
+}
+
+// LocalizeMessage returns the message alone, without the entity, in the
+// language of tag.
+func (w Warning) LocalizeMessage(tag string) string {
+	if w.Code == "" {
+		return w.Message
+	}
+	return i18n.Translate(tag, w.Code)
+}
+
+// CheckUnusedTools reports tool entities that no agent can use. A tool is used
+// when an agent lists it in its `tools:` property or when it appears in
+// assigned, which maps agent names to tools linked by other means (such as
+// workspace relationships).
+func (v *Validator) CheckUnusedTools(entities []ast.Entity, assigned map[string][]string) []Warning {
+	used := make(map[string]bool)
+	for _, tools := range assigned {
+		for _, name := range tools {
+			used[name] = true
+		}
+	}
+	for _, entity := range entities {
+		if entity.Type() != "agent" {
+			continue
+		}
+		for _, name := range AgentToolNames(entity) {
+			used[name] = true
+		}
+	}
+
+	var warnings []Warning
+	for _, entity := range entities {
+		if entity.Type() == "tool" && !used[entity.Name()] {
+			warnings = append(warnings, Warning{
+				EntityType: "tool",
+				EntityName: entity.Name(),
+				Line:       entity.Line(),
+				Column:     entity.Column(),
+				Message:    i18n.Translate(i18n.English, i18n.UnusedTool),
+				Code:       i18n.UnusedTool,
+			})
+		}
+	}
+	return warnings
+}
+
+// AgentToolNames returns the tool and MCP server names listed in an agent's
+// `tools:` property. Entries may be bare identifiers, strings, or tool("x")
+// and mcp("x") references.
+func AgentToolNames(agent ast.Entity) []string {
+	toolsProp, ok := agent.GetProperty("tools")
+	if !ok {
+		return nil
+	}
+	arr, ok := toolsProp.(ast.ArrayValue)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, elem := range arr.Elements {
+		switch v := elem.(type) {
+		case ast.StringValue:
+			names = append(names, v.Value)
+		case ast.ReferenceValue:
+			if v.Type == "tool" || v.Type == "mcp" {
+				names = append(names, v.Name)
+			}
+		}
+	}
+	return names
+}
+
 // validateFileEntity performs file-specific validation rules.
 func (v *Validator) validateFileEntity(entity ast.Entity) error {
 	// File entities should have a name
 	if entity.Name() == "" {
-		return fmt.Errorf("file entity must have a name")
+		return i18n.New(i18n.MissingName, "file")
 	}
 
 	// Check for either path or contents property
@@ -116,7 +211,7 @@ func (v *Validator) validateFileEntity(entity ast.Entity) error {
 	_, hasContents := entity.GetProperty("contents")
 
 	if !hasPath && !hasContents {
-		return fmt.Errorf("file entity must have either 'path' or 'contents' property")
+		return i18n.New(i18n.MissingFileSource)
 	}
 
 	return nil
@@ -126,13 +221,13 @@ func (v *Validator) validateFileEntity(entity ast.Entity) error {
 func (v *Validator) validateAgentEntity(entity ast.Entity) error {
 	// Agent entities should have a name
 	if entity.Name() == "" {
-		return fmt.Errorf("agent entity must have a name")
+		return i18n.New(i18n.MissingName, "agent")
 	}
 
 	// Check for required model property
 	_, hasModel := entity.GetProperty("model")
 	if !hasModel {
-		return fmt.Errorf("agent entity must have 'model' property")
+		return i18n.New(i18n.MissingProperty, "agent", "model")
 	}
 
 	return nil
@@ -141,15 +236,16 @@ func (v *Validator) validateAgentEntity(entity ast.Entity) error {
 // validateToolEntity validates a tool entity
 func (v *Validator) validateToolEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("tool entity must have a name")
+		return i18n.New(i18n.MissingName, "tool")
 	}
 
-	// Tool should have either command or function property
+	// Tool should have a command, function or handler property
 	_, hasCommand := entity.GetProperty("command")
 	_, hasFunction := entity.GetProperty("function")
+	_, hasHandler := entity.GetProperty("handler")
 
-	if !hasCommand && !hasFunction {
-		return fmt.Errorf("tool entity must have either 'command' or 'function' property")
+	if !hasCommand && !hasFunction && !hasHandler {
+		return i18n.New(i18n.MissingToolHandler)
 	}
 
 	return nil
@@ -158,13 +254,13 @@ func (v *Validator) validateToolEntity(entity ast.Entity) error {
 // validateIntentEntity validates an intent entity
 func (v *Validator) validateIntentEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("intent entity must have a name")
+		return i18n.New(i18n.MissingName, "intent")
 	}
 
 	// Intent must have a 'use' property referencing an agent
 	_, hasUse := entity.GetProperty("use")
 	if !hasUse {
-		return fmt.Errorf("intent entity must have 'use' property referencing an agent")
+		return i18n.New(i18n.MissingIntentAgent)
 	}
 
 	return nil
@@ -173,7 +269,7 @@ func (v *Validator) validateIntentEntity(entity ast.Entity) error {
 // validatePipelineEntity validates a pipeline entity
 func (v *Validator) validatePipelineEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("pipeline entity must have a name")
+		return i18n.New(i18n.MissingName, "pipeline")
 	}
 
 	return nil
@@ -182,13 +278,13 @@ func (v *Validator) validatePipelineEntity(entity ast.Entity) error {
 // validateStepEntity validates a step entity
 func (v *Validator) validateStepEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("step entity must have a name")
+		return i18n.New(i18n.MissingName, "step")
 	}
 
 	// Step must have a 'use' property
 	_, hasUse := entity.GetProperty("use")
 	if !hasUse {
-		return fmt.Errorf("step entity must have 'use' property")
+		return i18n.New(i18n.MissingProperty, "step", "use")
 	}
 
 	return nil
@@ -197,7 +293,7 @@ func (v *Validator) validateStepEntity(entity ast.Entity) error {
 // validateTriggerEntity validates a trigger entity
 func (v *Validator) validateTriggerEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("trigger entity must have a name")
+		return i18n.New(i18n.MissingName, "trigger")
 	}
 
 	// Trigger should have event or schedule property
@@ -205,7 +301,7 @@ func (v *Validator) validateTriggerEntity(entity ast.Entity) error {
 	_, hasSchedule := entity.GetProperty("schedule")
 
 	if !hasEvent && !hasSchedule {
-		return fmt.Errorf("trigger entity must have 'event' or 'schedule' property")
+		return i18n.New(i18n.MissingTriggerSource)
 	}
 
 	return nil
@@ -216,22 +312,103 @@ func (v *Validator) validateConfigEntity(entity ast.Entity) error {
 	// Config entities don't require a name
 	// They should have at least one property
 	if len(entity.Properties()) == 0 {
-		return fmt.Errorf("config entity must have at least one property")
+		return i18n.New(i18n.EmptyConfig)
 	}
 
-	return nil
+	return validateConfigKeys(entity)
 }
 
 // validateMCPEntity validates an MCP entity
 func (v *Validator) validateMCPEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("mcp entity must have a name")
+		return i18n.New(i18n.MissingName, "mcp")
 	}
 
 	// MCP entities should have command property
 	_, hasCommand := entity.GetProperty("command")
 	if !hasCommand {
-		return fmt.Errorf("mcp entity must have 'command' property")
+		return i18n.New(i18n.MissingProperty, "mcp", "command")
+	}
+
+	return nil
+}
+
+// validateProviderEntity validates a provider entity
+func (v *Validator) validateProviderEntity(entity ast.Entity) error {
+	if entity.Name() == "" {
+		return i18n.New(i18n.MissingName, "provider")
+	}
+
+	// Provider entities must say which kind of provider to construct
+	_, hasType := entity.GetProperty("type")
+	if !hasType {
+		return i18n.New(i18n.MissingProperty, "provider", "type")
+	}
+
+	return nil
+}
+
+// validatePromptEntity validates a prompt entity
+func (v *Validator) validatePromptEntity(entity ast.Entity) error {
+	if entity.Name() == "" {
+		return i18n.New(i18n.MissingName, "prompt")
+	}
+
+	// Prompt entities hold the text they include
+	_, hasText := entity.GetProperty("text")
+	if !hasText {
+		return i18n.New(i18n.MissingProperty, "prompt", "text")
+	}
+
+	return nil
+}
+
+// validateEvalEntity validates an eval entity
+func (v *Validator) validateEvalEntity(entity ast.Entity) error {
+	if entity.Name() == "" {
+		return i18n.New(i18n.MissingName, "eval")
+	}
+
+	// Evals run their cases against an intent or pipeline
+	_, hasTarget := entity.GetProperty("target")
+	if !hasTarget {
+		return i18n.New(i18n.MissingProperty, "eval", "target")
+	}
+
+	eval, ok := entity.(*ast.EvalEntity)
+	if !ok {
+		return nil
+	}
+	if len(eval.Cases) == 0 {
+		return i18n.New(i18n.MissingEvalCases)
+	}
+	for _, c := range eval.Cases {
+		if c.Name() == "" {
+			return i18n.New(i18n.MissingName, "case")
+		}
+		if _, hasExpect := c.GetProperty("expect"); !hasExpect {
+			return i18n.New(i18n.MissingProperty, "case", "expect")
+		}
+	}
+
+	return nil
+}
+
+// validateProfileEntity validates a profile entity
+func (v *Validator) validateProfileEntity(entity ast.Entity) error {
+	if entity.Name() == "" {
+		return i18n.New(i18n.MissingName, "profile")
+	}
+
+	// Every overlay but config names the entity it applies to
+	profile, ok := entity.(*ast.ProfileEntity)
+	if !ok {
+		return nil
+	}
+	for _, overlay := range profile.Overlays {
+		if overlay.Type() != "config" && overlay.Name() == "" {
+			return i18n.New(i18n.MissingName, overlay.Type())
+		}
 	}
 
 	return nil
@@ -240,20 +417,20 @@ func (v *Validator) validateMCPEntity(entity ast.Entity) error {
 // validateScriptEntity validates a script entity
 func (v *Validator) validateScriptEntity(entity ast.Entity) error {
 	if entity.Name() == "" {
-		return fmt.Errorf("script entity must have a name")
+		return i18n.New(i18n.MissingName, "script")
 	}
 
 	// Script entities must have a language property
 	_, hasLanguage := entity.GetProperty("language")
 	if !hasLanguage {
-		return fmt.Errorf("script entity must have 'language' property")
+		return i18n.New(i18n.MissingProperty, "script", "language")
 	}
 
 	// Script entities should have either code or a file reference
 	_, hasCode := entity.GetProperty("code")
 	_, hasPath := entity.GetProperty("path")
 	if !hasCode && !hasPath {
-		return fmt.Errorf("script entity must have 'code' or 'path' property")
+		return i18n.New(i18n.MissingScriptSource)
 	}
 
 	return nil
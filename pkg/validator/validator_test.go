@@ -45,6 +45,15 @@ func createTriggerEntity(name string) ast.Entity {
 	return entity
 }
 
+func createEvalEntity(name string) *ast.EvalEntity {
+	entity := ast.NewEvalEntity(name)
+	entity.SetProperty("target", ast.ReferenceValue{Type: "intent", Name: "reply"})
+	c := ast.NewCaseEntity("refund")
+	c.SetProperty("expect", ast.ObjectValue{Properties: map[string]ast.Value{"contains": ast.StringValue{Value: "refund"}}})
+	entity.Cases = append(entity.Cases, c)
+	return entity
+}
+
 func createConfigEntity() ast.Entity {
 	entity := ast.NewConfigEntity()
 	entity.SetProperty("default_model", ast.StringValue{Value: "gpt-4"})
@@ -135,12 +144,12 @@ func TestValidator_ValidateEntity(t *testing.T) {
 			errorMsg:  "tool entity must have a name",
 		},
 		{
-			name: "tool entity without command or function",
+			name: "tool entity without command, function or handler",
 			entity: func() ast.Entity {
 				return ast.NewToolEntity("test")
 			}(),
 			wantError: true,
-			errorMsg:  "tool entity must have either 'command' or 'function' property",
+			errorMsg:  "tool entity must have a 'command', 'function' or 'handler' property",
 		},
 		{
 			name:      "valid intent entity",
@@ -191,6 +200,41 @@ func TestValidator_ValidateEntity(t *testing.T) {
 			wantError: true,
 			errorMsg:  "trigger entity must have 'event' or 'schedule' property",
 		},
+		{
+			name:      "valid eval entity",
+			entity:    createEvalEntity("refunds"),
+			wantError: false,
+		},
+		{
+			name: "eval entity without target",
+			entity: func() ast.Entity {
+				entity := ast.NewEvalEntity("refunds")
+				entity.Cases = createEvalEntity("refunds").Cases
+				return entity
+			}(),
+			wantError: true,
+			errorMsg:  "eval entity must have 'target' property",
+		},
+		{
+			name: "eval entity without cases",
+			entity: func() ast.Entity {
+				entity := createEvalEntity("refunds")
+				entity.Cases = nil
+				return entity
+			}(),
+			wantError: true,
+			errorMsg:  "eval entity must have at least one 'case' block",
+		},
+		{
+			name: "eval case without expect",
+			entity: func() ast.Entity {
+				entity := createEvalEntity("refunds")
+				entity.Cases = append(entity.Cases, ast.NewCaseEntity("empty"))
+				return entity
+			}(),
+			wantError: true,
+			errorMsg:  "case entity must have 'expect' property",
+		},
 		{
 			name:      "valid config entity",
 			entity:    createConfigEntity(),
@@ -452,3 +496,29 @@ func TestValidator_CustomValidatorOverridesBuiltin(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestValidator_CheckUnusedTools(t *testing.T) {
+	agent := ast.NewAgentEntity("reviewer")
+	agent.SetProperty("tools", ast.ArrayValue{Elements: []ast.Value{
+		ast.StringValue{Value: "linter"},
+		ast.ReferenceValue{Type: "tool", Name: "search"},
+	}})
+
+	var entities []ast.Entity
+	entities = append(entities, agent)
+	for _, name := range []string{"linter", "search", "formatter", "deployer"} {
+		entities = append(entities, ast.NewToolEntity(name))
+	}
+
+	v := New()
+	warnings := v.CheckUnusedTools(entities, map[string][]string{"reviewer": {"deployer"}})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+	if warnings[0].EntityName != "formatter" {
+		t.Errorf("expected warning for formatter, got %s", warnings[0])
+	}
+	if !strings.Contains(warnings[0].String(), "not used by any agent") {
+		t.Errorf("unexpected warning message: %s", warnings[0])
+	}
+}
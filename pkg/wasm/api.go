@@ -0,0 +1,164 @@
+// Command wasm builds the LangSpace parser, validator, and formatter for
+// WebAssembly, for editors and playgrounds that run in the browser without
+// the language server:
+//
+//	GOOS=js GOARCH=wasm go build -o langspace.wasm ./pkg/wasm
+//
+// Loaded with Go's wasm_exec.js, it defines a global langspace object:
+//
+//	langspace.parse(source, locale)    // {entities, diagnostics}
+//	langspace.validate(source, locale) // {diagnostics}
+//	langspace.format(source, locale)   // {output, diagnostics}
+//
+// locale is optional and selects the language of diagnostic messages
+// (e.g. "de"; English by default). See README.md.
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/shellkjell/langspace/pkg/format"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// Diagnostic is a problem found in the source, at a 1-based line and
+// column.
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"` // "error" or "warning"
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Entity is a top-level entity of the source.
+type Entity struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// ParseResult is the result of langspace.parse.
+type ParseResult struct {
+	Entities    []Entity     `json:"entities"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// ValidateResult is the result of langspace.validate.
+type ValidateResult struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// FormatResult is the result of langspace.format.
+type FormatResult struct {
+	Output      string       `json:"output"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Parse parses source, recovering from errors to report them all.
+func Parse(source, locale string) ParseResult {
+	result := parser.New(source).ParseWithRecovery()
+	out := ParseResult{Entities: []Entity{}, Diagnostics: ignore(parseDiagnostics(result, locale), source)}
+	for _, e := range result.Entities {
+		out.Entities = append(out.Entities, Entity{Type: e.Type(), Name: e.Name(), Line: e.Line(), Column: e.Column()})
+	}
+	return out
+}
+
+// Validate reports what langspace validate does, for a single file
+// without its imports: parse errors, duplicate entities, unused tools, and
+// semantic errors such as undefined references.
+func Validate(source, locale string) ValidateResult {
+	result := parser.New(source).ParseWithRecovery()
+	diags := parseDiagnostics(result, locale)
+
+	ws := workspace.New()
+	for _, e := range result.Entities {
+		if err := ws.AddEntity(e); err != nil {
+			diags = append(diags, newDiagnostic(e.Line(), e.Column(), err, locale))
+		}
+	}
+
+	for _, w := range ws.ValidateToolUsage() {
+		diags = append(diags, Diagnostic{
+			Line:     w.Line,
+			Column:   w.Column,
+			Severity: "warning",
+			Code:     string(w.Code),
+			Message:  fmt.Sprintf("%s %q: %s", w.EntityType, w.EntityName, w.LocalizeMessage(locale)),
+		})
+	}
+	for _, e := range ws.ValidateSemantics() {
+		diags = append(diags, Diagnostic{
+			Line:     e.Line,
+			Column:   e.Column,
+			Severity: "error",
+			Code:     string(e.Code),
+			Message:  fmt.Sprintf("%s %q: %s", e.EntityType, e.EntityName, e.LocalizeMessage(locale)),
+		})
+	}
+
+	diags = ignore(diags, source)
+	sortDiagnostics(diags)
+	return ValidateResult{Diagnostics: diags}
+}
+
+// Format formats source. Source that does not parse is returned unchanged,
+// with its parse errors.
+func Format(source, locale string) FormatResult {
+	output, err := format.Source(source)
+	if err != nil {
+		diags := parseDiagnostics(parser.New(source).ParseWithRecovery(), locale)
+		return FormatResult{Output: source, Diagnostics: ignore(diags, source)}
+	}
+	return FormatResult{Output: output, Diagnostics: []Diagnostic{}}
+}
+
+// parseDiagnostics converts parse errors to diagnostics.
+func parseDiagnostics(result parser.ParseResult, locale string) []Diagnostic {
+	diags := []Diagnostic{}
+	for _, e := range result.Errors {
+		diags = append(diags, Diagnostic{
+			Line:     e.Line,
+			Column:   e.Column,
+			Severity: "error",
+			Code:     string(e.Code),
+			Message:  e.LocalizeMessage(locale),
+		})
+	}
+	return diags
+}
+
+// newDiagnostic converts an error, which may carry an i18n code.
+func newDiagnostic(line, column int, err error, locale string) Diagnostic {
+	return Diagnostic{
+		Line:     line,
+		Column:   column,
+		Severity: "error",
+		Code:     string(i18n.CodeOf(err)),
+		Message:  i18n.Localize(err, locale),
+	}
+}
+
+// ignore drops the diagnostics that ignore comments in source silence.
+func ignore(diags []Diagnostic, source string) []Diagnostic {
+	s := parser.ParseSuppressions(source)
+	return slices.DeleteFunc(diags, func(d Diagnostic) bool {
+		return s.Suppressed(d.Line, i18n.Code(d.Code))
+	})
+}
+
+// sortDiagnostics orders diagnostics by position.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	result := Parse("agent \"writer\" {\n  model: \"gpt-4o\"\n}\n\nagent \"broken\" {\n  model:\n", "")
+	if len(result.Entities) != 1 || result.Entities[0] != (Entity{Type: "agent", Name: "writer", Line: 1, Column: 1}) {
+		t.Errorf("entities = %+v, want agent writer at 1:1", result.Entities)
+	}
+	if len(result.Diagnostics) == 0 || result.Diagnostics[0].Severity != "error" || result.Diagnostics[0].Code == "" {
+		t.Errorf("expected a coded parse error, got %+v", result.Diagnostics)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	source := `tool "search" {
+  command: "grep -r {{query}} ."
+}
+
+pipeline "review" {
+  step "check" {
+    use: agent("reviewer")
+  }
+}
+`
+	result := Validate(source, "de")
+	if len(result.Diagnostics) != 2 {
+		t.Fatalf("expected two diagnostics, got %+v", result.Diagnostics)
+	}
+	unused, undefined := result.Diagnostics[0], result.Diagnostics[1]
+	if unused.Severity != "warning" || unused.Line != 1 || !strings.Contains(unused.Message, "search") {
+		t.Errorf("expected a warning for the unused tool at line 1, got %+v", unused)
+	}
+	if undefined.Code != "LS2004" || undefined.Line != 6 || !strings.Contains(undefined.Message, "nicht definierte") {
+		t.Errorf("expected a German LS2004 error at line 6, got %+v", undefined)
+	}
+
+	if unused.Code != "LS2202" || unused.Message != `tool "search": Werkzeug ist deklariert, wird aber von keinem Agenten verwendet` {
+		t.Errorf("expected a German LS2202 warning, got %+v", unused)
+	}
+
+	ignored := "# langspace:ignore LS2202\n" + strings.Replace(source, `"check" {`, `"check" { # langspace:ignore`, 1)
+	if result := Validate(ignored, ""); len(result.Diagnostics) != 0 {
+		t.Errorf("expected ignore comments to silence every diagnostic, got %+v", result.Diagnostics)
+	}
+
+	if result := Validate("agent \"a\" {\n  model: \"m\"\n}\n", ""); len(result.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics for a valid file, got %+v", result.Diagnostics)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	result := Format("agent \"a\" {\nmodel: \"m\"\n}", "")
+	if result.Output != "agent \"a\" {\n  model: \"m\"\n}\n" || len(result.Diagnostics) != 0 {
+		t.Errorf("Format = %+v", result)
+	}
+
+	broken := "agent \"a\" {\nmodel: \"m\"\n"
+	result = Format(broken, "")
+	if result.Output != broken || len(result.Diagnostics) == 0 {
+		t.Errorf("expected broken source back unchanged with diagnostics, got %+v", result)
+	}
+
+	// Empty lists are arrays in JSON, not null
+	data, _ := json.Marshal(Format("", ""))
+	if !strings.Contains(string(data), `"diagnostics":[]`) {
+		t.Errorf("expected an empty diagnostics array, got %s", data)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("langspace", js.ValueOf(map[string]interface{}{
+		"parse": export(func(source, locale string) interface{} {
+			return Parse(source, locale)
+		}),
+		"validate": export(func(source, locale string) interface{} {
+			return Validate(source, locale)
+		}),
+		"format": export(func(source, locale string) interface{} {
+			return Format(source, locale)
+		}),
+	}))
+
+	// Keep the functions callable
+	select {}
+}
+
+// export wraps fn as a JS function of (source, locale) returning a plain
+// object. A missing locale is English.
+func export(fn func(source, locale string) interface{}) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var source, locale string
+		if len(args) > 0 && args[0].Type() == js.TypeString {
+			source = args[0].String()
+		}
+		if len(args) > 1 && args[1].Type() == js.TypeString {
+			locale = args[1].String()
+		}
+		data, err := json.Marshal(fn(source, locale))
+		if err != nil {
+			return js.Global().Get("Error").New(err.Error())
+		}
+		return js.Global().Get("JSON").Call("parse", string(data))
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "build for WebAssembly: GOOS=js GOARCH=wasm go build -o langspace.wasm ./pkg/wasm")
+	os.Exit(2)
+}
@@ -0,0 +1,148 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ErrForbidden is the error of an action on an entity by a caller that is
+// not one of its owners.
+var ErrForbidden = errors.New("forbidden")
+
+// IsOwner reports whether any of principals, the users and teams a caller
+// acts as, owns an entity. An entity without owners is everyone's.
+func IsOwner(entity ast.Entity, principals []string) bool {
+	owners := ast.Owners(entity)
+	if len(owners) == 0 {
+		return true
+	}
+	for _, owner := range owners {
+		for _, p := range principals {
+			if p == owner {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanView reports whether principals may see an entity: any public entity,
+// and private ones they own.
+func CanView(entity ast.Entity, principals []string) bool {
+	return ast.Visibility(entity) != ast.VisibilityPrivate || IsOwner(entity, principals)
+}
+
+// CheckExecute returns an error wrapping ErrForbidden unless principals may
+// execute an entity, i.e. own it.
+func CheckExecute(entity ast.Entity, principals []string) error {
+	if !IsOwner(entity, principals) {
+		return fmt.Errorf("%w: only the owners of %s %q can execute it", ErrForbidden, entity.Type(), entity.Name())
+	}
+	return nil
+}
+
+// CheckChanges returns an error wrapping ErrForbidden unless principals may
+// make every change from one workspace to another, such as to replace the
+// served version with a new one: changing or removing an owned entity,
+// including its owners, takes one of its owners. Adding entities and
+// changing those without owners is not restricted.
+func CheckChanges(from, to *Workspace, principals []string) error {
+	for _, old := range from.GetEntities() {
+		if IsOwner(old, principals) {
+			continue
+		}
+		updated, ok := to.GetEntityByName(old.Type(), old.Name())
+		if !ok {
+			return fmt.Errorf("%w: only the owners of %s %q can remove it", ErrForbidden, old.Type(), old.Name())
+		}
+		if entityChanged(old, updated) {
+			return fmt.Errorf("%w: only the owners of %s %q can modify it", ErrForbidden, old.Type(), old.Name())
+		}
+	}
+	return nil
+}
+
+// entityChanged reports whether two versions of an entity differ in their
+// properties, metadata, or pipeline steps, ignoring where they are declared.
+func entityChanged(a, b ast.Entity) bool {
+	if a.Type() != b.Type() || a.Name() != b.Name() {
+		return true
+	}
+	if !valuesEqual(reflect.ValueOf(a.Properties()), reflect.ValueOf(b.Properties())) || !reflect.DeepEqual(a.AllMetadata(), b.AllMetadata()) {
+		return true
+	}
+	pa, ok := a.(*ast.PipelineEntity)
+	if !ok {
+		return false
+	}
+	pb := b.(*ast.PipelineEntity)
+	if len(pa.Steps) != len(pb.Steps) {
+		return true
+	}
+	for i := range pa.Steps {
+		if entityChanged(pa.Steps[i], pb.Steps[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// valuesEqual reports whether two property values are deeply equal,
+// comparing the entities nested in them, such as the steps of a branch,
+// with entityChanged so that where they are declared is ignored.
+func valuesEqual(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.CanInterface() && b.CanInterface() {
+			ea, okA := a.Interface().(ast.Entity)
+			eb, okB := b.Interface().(ast.Entity)
+			if okA && okB {
+				return !entityChanged(ea, eb)
+			}
+		}
+		return valuesEqual(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !valuesEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !valuesEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			if !valuesEqual(iter.Value(), b.MapIndex(iter.Key())) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func, reflect.Chan:
+		return a.IsNil() && b.IsNil()
+	}
+	return a.Equal(b)
+}
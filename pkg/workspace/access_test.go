@@ -0,0 +1,147 @@
+package workspace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const accessSource = `agent "writer" {
+	model: "gpt-4o"
+}
+
+intent "refund" {
+	use: agent("writer")
+	owners: ["team-payments"]
+}
+
+intent "payroll" {
+	use: agent("writer")
+	owners: ["team-hr", "carol"]
+	visibility: "private"
+}
+`
+
+func TestAccess(t *testing.T) {
+	w := workspaceFrom(t, accessSource)
+
+	tests := []struct {
+		name       string
+		principals []string
+		wantView   []string
+		wantExec   []string
+	}{
+		{
+			name:     "anonymous",
+			wantView: []string{"writer", "refund"},
+			wantExec: []string{"writer"},
+		},
+		{
+			name:       "team",
+			principals: []string{"alice", "team-payments"},
+			wantView:   []string{"writer", "refund"},
+			wantExec:   []string{"writer", "refund"},
+		},
+		{
+			name:       "user",
+			principals: []string{"carol"},
+			wantView:   []string{"writer", "refund", "payroll"},
+			wantExec:   []string{"writer", "payroll"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var view, exec []string
+			for _, e := range w.GetEntities() {
+				if CanView(e, tt.principals) {
+					view = append(view, e.Name())
+				}
+				err := CheckExecute(e, tt.principals)
+				if err == nil {
+					exec = append(exec, e.Name())
+				} else if !errors.Is(err, ErrForbidden) {
+					t.Errorf("CheckExecute(%s) error = %v, want ErrForbidden", e.Name(), err)
+				}
+			}
+			if strings.Join(view, ",") != strings.Join(tt.wantView, ",") {
+				t.Errorf("visible entities = %v, want %v", view, tt.wantView)
+			}
+			if strings.Join(exec, ",") != strings.Join(tt.wantExec, ",") {
+				t.Errorf("executable entities = %v, want %v", exec, tt.wantExec)
+			}
+		})
+	}
+}
+
+const branchSource = `
+pipeline "triage" {
+	owners: ["team-support"]
+
+	branch $input.kind {
+		"bug" => step "fix" {
+			use: agent("writer")
+			input: $input
+		}
+	}
+}
+`
+
+func TestCheckChanges(t *testing.T) {
+	from := workspaceFrom(t, accessSource+branchSource)
+
+	tests := []struct {
+		name       string
+		source     string
+		principals []string
+		wantErr    bool
+	}{
+		{
+			name:   "unchanged",
+			source: accessSource + branchSource,
+		},
+		{
+			name:   "owned entities moved",
+			source: branchSource + "\n\n" + accessSource,
+		},
+		{
+			name:    "owned nested entity changed",
+			source:  accessSource + strings.Replace(branchSource, `"fix"`, `"patch"`, 1),
+			wantErr: true,
+		},
+		{
+			name:   "unowned entity changed",
+			source: strings.Replace(accessSource, `"gpt-4o"`, `"gpt-4o-mini"`, 1) + branchSource,
+		},
+		{
+			name:   "entity added",
+			source: accessSource + branchSource + `agent "reviewer" { model: "gpt-4o" }`,
+		},
+		{
+			name:    "owned entity changed",
+			source:  strings.Replace(accessSource, `"team-payments"`, `"team-payments", "mallory"`, 1) + branchSource,
+			wantErr: true,
+		},
+		{
+			name:       "owned entity changed by an owner",
+			source:     strings.Replace(accessSource, `"team-payments"`, `"team-payments", "mallory"`, 1) + branchSource,
+			principals: []string{"team-payments"},
+		},
+		{
+			name:       "owned entity removed",
+			source:     accessSource[:strings.Index(accessSource, `intent "payroll"`)] + branchSource,
+			principals: []string{"team-payments"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckChanges(from, workspaceFrom(t, tt.source), tt.principals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Format is a format in which a workspace is saved.
+type Format string
+
+const (
+	// FormatJSON is the indented JSON of a SerializedWorkspace.
+	FormatJSON Format = "json"
+
+	// FormatBinary is a versioned header followed by the workspace in gob
+	// encoding. It is faster to read and write than JSON for big
+	// workspaces and keeps every value's type, including objects, nulls,
+	// and optional references, which JSON cannot hold.
+	FormatBinary Format = "binary"
+)
+
+// BinaryExtension is the file extension SaveToFile writes in the binary
+// format.
+const BinaryExtension = ".lsb"
+
+// binaryFormatVersion is the version of the binary layout written after the
+// header. It changes only when the layout does; schema changes are tracked
+// by the schema version, as in JSON.
+const binaryFormatVersion = 1
+
+// binaryMagic starts every workspace saved in the binary format.
+var binaryMagic = []byte("LSWB")
+
+// FormatForPath returns the format SaveToFile writes to path: binary for
+// BinaryExtension and ".gob" files, JSON otherwise.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case BinaryExtension, ".gob":
+		return FormatBinary
+	}
+	return FormatJSON
+}
+
+// SaveOption configures how a workspace is saved.
+type SaveOption func(*saveOptions)
+
+type saveOptions struct {
+	format Format
+}
+
+// WithFormat saves a workspace in the given format.
+func WithFormat(format Format) SaveOption {
+	return func(o *saveOptions) {
+		o.format = format
+	}
+}
+
+// binaryHeader precedes the gob-encoded workspace.
+type binaryHeader struct {
+	Magic         [4]byte
+	FormatVersion uint16
+	SchemaVersion uint32
+}
+
+// binaryWorkspace is the gob-encoded body of a binary workspace.
+type binaryWorkspace struct {
+	Entities      []binaryEntity
+	Relationships []SerializedRelationship
+}
+
+type binaryEntity struct {
+	Type       string
+	Name       string
+	Properties map[string]binaryValue
+	Metadata   map[string]string
+	Line       int
+	Column     int
+}
+
+// binaryValue holds any saved ast.Value; Kind says which fields are set.
+type binaryValue struct {
+	Kind     string
+	String   string
+	Number   float64
+	Bool     bool
+	Elements []binaryValue
+	Fields   map[string]binaryValue
+	Ref      *binaryReference
+
+	// OpaqueKind and Data hold an ast.OpaqueValue
+	OpaqueKind string
+	Data       []byte
+}
+
+type binaryReference struct {
+	Type     string
+	Name     string
+	Path     []string
+	Optional []bool
+	Version  string
+}
+
+// isBinary reports whether r starts with the binary format's header.
+func isBinary(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(binaryMagic))
+	return err == nil && bytes.Equal(magic, binaryMagic)
+}
+
+// saveBinary writes the workspace in the binary format.
+func (w *Workspace) saveBinary(writer io.Writer) error {
+	w.mu.RLock()
+	bw := binaryWorkspace{
+		Entities:      make([]binaryEntity, 0, w.entities.len()),
+		Relationships: make([]SerializedRelationship, 0, len(w.relationships)),
+	}
+	for _, entity := range w.entities.all() {
+		be := binaryEntity{
+			Type:       entity.Type(),
+			Name:       entity.Name(),
+			Properties: make(map[string]binaryValue),
+			Metadata:   entity.AllMetadata(),
+			Line:       entity.Line(),
+			Column:     entity.Column(),
+		}
+		for key, val := range entity.Properties() {
+			bv, err := encodeBinaryValue(val)
+			if err != nil {
+				w.mu.RUnlock()
+				return fmt.Errorf("failed to serialize property %s: %w", key, err)
+			}
+			be.Properties[key] = bv
+		}
+		bw.Entities = append(bw.Entities, be)
+	}
+	for _, rel := range w.relationships {
+		bw.Relationships = append(bw.Relationships, SerializedRelationship(rel))
+	}
+	w.mu.RUnlock()
+
+	header := binaryHeader{FormatVersion: binaryFormatVersion, SchemaVersion: CurrentSchemaVersion}
+	copy(header.Magic[:], binaryMagic)
+	if err := binary.Write(writer, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("failed to write workspace header: %w", err)
+	}
+	if err := gob.NewEncoder(writer).Encode(bw); err != nil {
+		return fmt.Errorf("failed to encode workspace: %w", err)
+	}
+	return nil
+}
+
+// loadBinary loads a workspace saved in the binary format. Like JSON, a
+// workspace of a newer schema version loads best-effort unless the
+// migration mode is strict. One of an older version is migrated through
+// its JSON document, so the workspace's migrations apply to both formats.
+func (w *Workspace) loadBinary(r io.Reader) error {
+	var header binaryHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("failed to read workspace header: %w", err)
+	}
+	if header.FormatVersion == 0 || header.FormatVersion > binaryFormatVersion {
+		return fmt.Errorf("unsupported binary workspace format version %d", header.FormatVersion)
+	}
+
+	var bw binaryWorkspace
+	if err := gob.NewDecoder(r).Decode(&bw); err != nil {
+		return fmt.Errorf("failed to decode workspace: %w", err)
+	}
+
+	preserveUnknown := w.preserveUnknown()
+	entities := make([]ast.Entity, 0, len(bw.Entities))
+	for _, be := range bw.Entities {
+		entity, err := newLoadedEntity(be.Type, be.Name, preserveUnknown)
+		if err != nil {
+			return err
+		}
+		for key, bv := range be.Properties {
+			val, err := decodeBinaryValue(bv)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize property %s: %w", key, err)
+			}
+			entity.SetProperty(key, val)
+		}
+		for key, value := range be.Metadata {
+			entity.SetMetadata(key, value)
+		}
+		entity.SetLocation(be.Line, be.Column)
+		entities = append(entities, entity)
+	}
+	relationships := make([]Relationship, 0, len(bw.Relationships))
+	for _, sr := range bw.Relationships {
+		relationships = append(relationships, Relationship(sr))
+	}
+
+	migrator, mode := w.migration()
+	version := int(header.SchemaVersion)
+	switch {
+	case version > migrator.target:
+		if mode == MigrationStrict {
+			return fmt.Errorf("failed to migrate workspace: schema version %d is newer than supported version %d", version, migrator.target)
+		}
+	case version < migrator.target:
+		sw, err := serializeEntities(version, entities, relationships)
+		if err != nil {
+			return fmt.Errorf("failed to migrate workspace: %w", err)
+		}
+		data, err := json.Marshal(sw)
+		if err != nil {
+			return fmt.Errorf("failed to migrate workspace: %w", err)
+		}
+		var doc map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to migrate workspace: %w", err)
+		}
+		return w.loadDocument(doc)
+	}
+
+	w.load(entities, relationships)
+	return nil
+}
+
+// encodeBinaryValue converts an ast.Value to a binaryValue.
+func encodeBinaryValue(v ast.Value) (binaryValue, error) {
+	switch val := v.(type) {
+	case ast.StringValue:
+		return binaryValue{Kind: "string", String: val.Value}, nil
+	case ast.NumberValue:
+		return binaryValue{Kind: "number", Number: val.Value}, nil
+	case ast.BoolValue:
+		return binaryValue{Kind: "bool", Bool: val.Value}, nil
+	case ast.NullValue:
+		return binaryValue{Kind: "null"}, nil
+	case ast.ArrayValue:
+		bv := binaryValue{Kind: "array", Elements: make([]binaryValue, len(val.Elements))}
+		for i, elem := range val.Elements {
+			e, err := encodeBinaryValue(elem)
+			if err != nil {
+				return bv, err
+			}
+			bv.Elements[i] = e
+		}
+		return bv, nil
+	case ast.ObjectValue:
+		bv := binaryValue{Kind: "object", Fields: make(map[string]binaryValue, len(val.Properties))}
+		for key, prop := range val.Properties {
+			f, err := encodeBinaryValue(prop)
+			if err != nil {
+				return bv, err
+			}
+			bv.Fields[key] = f
+		}
+		return bv, nil
+	case ast.ReferenceValue:
+		return binaryValue{Kind: "reference", Ref: &binaryReference{
+			Type:     val.Type,
+			Name:     val.Name,
+			Path:     val.Path,
+			Optional: val.Optional,
+			Version:  val.Version,
+		}}, nil
+	case ast.VariableValue:
+		return binaryValue{Kind: "variable", String: val.Name}, nil
+	case ast.OpaqueValue:
+		return binaryValue{Kind: "opaque", OpaqueKind: val.Kind, Data: val.Data}, nil
+	}
+	return binaryValue{}, fmt.Errorf("unsupported value type: %T", v)
+}
+
+// decodeBinaryValue converts a binaryValue back to an ast.Value.
+func decodeBinaryValue(bv binaryValue) (ast.Value, error) {
+	switch bv.Kind {
+	case "string":
+		return ast.StringValue{Value: bv.String}, nil
+	case "number":
+		return ast.NumberValue{Value: bv.Number}, nil
+	case "bool":
+		return ast.BoolValue{Value: bv.Bool}, nil
+	case "null":
+		return ast.NullValue{}, nil
+	case "array":
+		values := make([]ast.Value, len(bv.Elements))
+		for i, elem := range bv.Elements {
+			v, err := decodeBinaryValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return ast.ArrayValue{Elements: values}, nil
+	case "object":
+		props := make(map[string]ast.Value, len(bv.Fields))
+		for key, field := range bv.Fields {
+			v, err := decodeBinaryValue(field)
+			if err != nil {
+				return nil, err
+			}
+			props[key] = v
+		}
+		return ast.ObjectValue{Properties: props}, nil
+	case "reference":
+		if bv.Ref == nil {
+			return nil, fmt.Errorf("reference value without a reference")
+		}
+		return ast.ReferenceValue{
+			Type:     bv.Ref.Type,
+			Name:     bv.Ref.Name,
+			Path:     bv.Ref.Path,
+			Optional: bv.Ref.Optional,
+			Version:  bv.Ref.Version,
+		}, nil
+	case "variable":
+		return ast.VariableValue{Name: bv.String}, nil
+	case "opaque":
+		return ast.OpaqueValue{Kind: bv.OpaqueKind, Data: bv.Data}, nil
+	}
+	return nil, fmt.Errorf("unsupported value type: %s", bv.Kind)
+}
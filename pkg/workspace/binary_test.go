@@ -0,0 +1,145 @@
+package workspace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func TestSaveTo_BinaryRoundTrip(t *testing.T) {
+	w := New()
+	agent := ast.NewAgentEntity("bot")
+	agent.SetProperty("model", ast.StringValue{Value: "gpt-4o"})
+	agent.SetProperty("temperature", ast.NumberValue{Value: 0.1})
+	agent.SetProperty("stream", ast.BoolValue{Value: true})
+	agent.SetProperty("fallback", ast.NullValue{})
+	agent.SetProperty("config", ast.ObjectValue{Properties: map[string]ast.Value{
+		"tags": ast.ArrayValue{Elements: []ast.Value{ast.StringValue{Value: "a"}, ast.VariableValue{Name: "input"}}},
+	}})
+	agent.SetProperty("context", ast.ReferenceValue{Type: "step", Name: "x", Path: []string{"output"}, Optional: []bool{true}, Version: "v2"})
+	agent.SetProperty("budget", ast.OpaqueValue{Kind: "duration", Data: []byte(`"5m"`)})
+	agent.SetMetadata("owner", "team")
+	agent.SetLocation(3, 1)
+	if err := w.AddEntity(agent); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddEntity(ast.NewToolEntity("search")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRelationship("agent", "bot", "tool", "search", RelationTypeDepends); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := w.SaveTo(&buf, WithFormat(FormatBinary)); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), binaryMagic) {
+		t.Fatalf("expected the binary header, got %q", buf.Bytes()[:8])
+	}
+
+	w2 := New()
+	if err := w2.LoadFrom(&buf); err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+	loaded, ok := w2.GetEntityByName("agent", "bot")
+	if !ok {
+		t.Fatal("expected agent 'bot' to be loaded")
+	}
+	if !reflect.DeepEqual(loaded.Properties(), agent.Properties()) {
+		t.Errorf("properties = %#v, want %#v", loaded.Properties(), agent.Properties())
+	}
+	if owner, _ := loaded.GetMetadata("owner"); owner != "team" || loaded.Line() != 3 || loaded.Column() != 1 {
+		t.Errorf("expected metadata and location to be kept, got %q at %d:%d", owner, loaded.Line(), loaded.Column())
+	}
+	if rels := w2.GetRelationships(); len(rels) != 1 || rels[0].TargetName != "search" {
+		t.Errorf("expected the relationship to be kept, got %v", rels)
+	}
+}
+
+func TestSaveToFile_FormatByExtension(t *testing.T) {
+	dir := t.TempDir()
+	w := New()
+	agent := ast.NewAgentEntity("bot")
+	agent.SetProperty("model", ast.StringValue{Value: "gpt-4o"})
+	if err := w.AddEntity(agent); err != nil {
+		t.Fatal(err)
+	}
+
+	// A JSON workspace is converted by loading it and saving it as binary
+	jsonPath := filepath.Join(dir, "workspace.json")
+	binaryPath := filepath.Join(dir, "workspace"+BinaryExtension)
+	if err := w.SaveToFile(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	converted := New()
+	if err := converted.LoadFromFile(jsonPath); err != nil {
+		t.Fatalf("LoadFromFile(json) error = %v", err)
+	}
+	if err := converted.SaveToFile(binaryPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, binaryFile := range map[string]bool{jsonPath: false, binaryPath: true} {
+		w2 := New()
+		if err := w2.LoadFromFile(path); err != nil {
+			t.Fatalf("LoadFromFile(%s) error = %v", path, err)
+		}
+		if _, ok := w2.GetEntityByName("agent", "bot"); !ok {
+			t.Errorf("expected agent 'bot' to be loaded from %s", path)
+		}
+		if FormatForPath(path) == FormatBinary != binaryFile {
+			t.Errorf("FormatForPath(%s) = %s", path, FormatForPath(path))
+		}
+	}
+
+	// WithFormat overrides the extension
+	overridden := filepath.Join(dir, "workspace.dat")
+	if err := w.SaveToFile(overridden, WithFormat(FormatBinary)); err != nil {
+		t.Fatal(err)
+	}
+	if err := New().LoadFromFile(overridden); err != nil {
+		t.Errorf("LoadFromFile() error = %v", err)
+	}
+}
+
+func TestLoadFrom_BinaryVersions(t *testing.T) {
+	var saved bytes.Buffer
+	if err := New().SaveTo(&saved, WithFormat(FormatBinary)); err != nil {
+		t.Fatal(err)
+	}
+	withHeader := func(formatVersion uint16, schemaVersion uint32) *bytes.Reader {
+		data := append([]byte(nil), saved.Bytes()...)
+		binary.BigEndian.PutUint16(data[4:], formatVersion)
+		binary.BigEndian.PutUint32(data[6:], schemaVersion)
+		return bytes.NewReader(data)
+	}
+
+	if err := New().LoadFrom(withHeader(binaryFormatVersion+1, CurrentSchemaVersion)); err == nil || !strings.Contains(err.Error(), "format version") {
+		t.Errorf("expected an error for a newer format version, got %v", err)
+	}
+
+	newer := withHeader(binaryFormatVersion, CurrentSchemaVersion+1)
+	if err := New().LoadFrom(newer); err != nil {
+		t.Errorf("expected a newer schema version to load leniently, got %v", err)
+	}
+	strict := New().WithConfig(&Config{MigrationMode: MigrationStrict})
+	if err := strict.LoadFrom(withHeader(binaryFormatVersion, CurrentSchemaVersion+1)); err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("expected strict mode to reject a newer schema version, got %v", err)
+	}
+
+	// An older binary workspace goes through the JSON migrations
+	var applied bool
+	m := NewMigrator(CurrentSchemaVersion+1).Register(CurrentSchemaVersion, func(doc map[string]interface{}) error {
+		applied = true
+		return nil
+	})
+	if err := New().WithMigrator(m).LoadFrom(withHeader(binaryFormatVersion, CurrentSchemaVersion)); err != nil || !applied {
+		t.Errorf("expected the migration to apply, got applied=%v, err=%v", applied, err)
+	}
+}
@@ -0,0 +1,542 @@
+package workspace
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/slices"
+)
+
+// BundleExtension is the file extension of bundles written by Package.
+// Loader.Load reads files with it as bundles.
+const BundleExtension = ".lsbundle"
+
+// bundleFormat is the version of the bundle layout. Loading a bundle of
+// another format fails.
+const bundleFormat = 1
+
+// A bundle is a zip archive of:
+//
+//	manifest.json                      the BundleManifest
+//	src/<file>                         the packaged file and its imports
+//	versions/<type>/<name>/<version>.ls published versions pinned with @version
+const (
+	bundleManifest = "manifest.json"
+	bundleSources  = "src"
+	bundleVersions = "versions"
+)
+
+// BundleManifest describes a bundle: what it contains and what it needs
+// from the environment it runs in.
+type BundleManifest struct {
+	Format int `json:"format"`
+
+	// Entry is the file the bundle was packaged from, and Files it and
+	// everything it imports, as slash-separated paths relative to the
+	// directory that contains them all.
+	Entry string   `json:"entry"`
+	Files []string `json:"files"`
+
+	// Entities are the top-level entities, with the published versions the
+	// bundle vendors for each, sorted by type and name.
+	Entities []BundleEntity `json:"entities"`
+
+	// Models are the models agents name, and Providers the provider types
+	// that serve them or that provider entities declare.
+	Models    []string `json:"models,omitempty"`
+	Providers []string `json:"providers,omitempty"`
+
+	// Secrets are the environment variables and secrets read with env()
+	// and secret().
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Requires is what the bundle needs of the langspace that loads it.
+	// Loading fails with an *IncompatibleError if this build lacks it.
+	Requires *Requirements `json:"requires,omitempty"`
+}
+
+// BundleEntity is an entity listed in a BundleManifest.
+type BundleEntity struct {
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// IsBundle reports whether a path names a bundle by its extension.
+func IsBundle(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), BundleExtension)
+}
+
+// BundleOption configures Package.
+type BundleOption func(*bundleConfig)
+
+type bundleConfig struct {
+	versions     *VersionStore
+	defaultModel string
+	providerOf   func(model string) string
+}
+
+// WithBundleVersions vendors the published versions that pinned references,
+// e.g. pipeline("review")@v3, name from store. Without it, packaging a file
+// with pinned references fails.
+func WithBundleVersions(store *VersionStore) BundleOption {
+	return func(c *bundleConfig) {
+		c.versions = store
+	}
+}
+
+// WithModelProviders lists the provider types that serve the models agents
+// name in the manifest, as providerOf reports them ("" for unknown models).
+// Agents that name no model use the `default_model` of a config entity, or
+// defaultModel.
+func WithModelProviders(defaultModel string, providerOf func(model string) string) BundleOption {
+	return func(c *bundleConfig) {
+		c.defaultModel = defaultModel
+		c.providerOf = providerOf
+	}
+}
+
+// Package writes a bundle of a LangSpace file to w: the file, everything it
+// imports, the published versions its pinned references name, and a
+// manifest. Loading the bundle with Loader.Load gives the workspace loading
+// the file would, with the vendored versions published, so the bundle can
+// be deployed on its own. Imports must be relative paths; imported bundles
+// are included whole.
+func Package(w io.Writer, filePath string, opts ...BundleOption) (*BundleManifest, error) {
+	var cfg bundleConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ws := New()
+	l := NewLoader(ws)
+	if err := l.Load(filePath); err != nil {
+		return nil, err
+	}
+	files := l.Files()
+	root := commonDir(files)
+
+	m := &BundleManifest{Format: bundleFormat}
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return nil, fmt.Errorf("packaging %s: %w", file, err)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", file, err)
+		}
+		// Imported bundles are vendored whole
+		if !IsBundle(file) {
+			if err := checkRelativeImports(file, content); err != nil {
+				return nil, err
+			}
+		}
+		name := filepath.ToSlash(rel)
+		if err := writeZipFile(zw, bundleSources+"/"+name, content); err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, name)
+	}
+	m.Entry = m.Files[0]
+
+	vendored, versions, err := vendorVersions(zw, ws, cfg.versions)
+	if err != nil {
+		return nil, err
+	}
+	m.Requires = RequiredFeatures(append(append(ws.GetEntities(), versions...), ws.publishedEntities()...))
+	m.Entities = bundleEntities(ws, vendored)
+	m.Models, m.Providers = requiredProviders(ws, cfg)
+	m.Secrets = referencedSecrets(ws)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(zw, bundleManifest, append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReadBundleManifest returns the manifest of a bundle.
+func ReadBundleManifest(bundlePath string) (*BundleManifest, error) {
+	zr, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle %s: %w", bundlePath, err)
+	}
+	defer func() { _ = zr.Close() }()
+	return readManifest(zr, bundlePath)
+}
+
+func readManifest(fsys fs.FS, bundlePath string) (*BundleManifest, error) {
+	data, err := fs.ReadFile(fsys, bundleManifest)
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s has no manifest: %w", bundlePath, err)
+	}
+	var m BundleManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest of bundle %s: %w", bundlePath, err)
+	}
+	if m.Format > bundleFormat {
+		return nil, fmt.Errorf("bundle %s has format %d; this is langspace %s, which reads format %d. Upgrade langspace to load it", bundlePath, m.Format, Version, bundleFormat)
+	}
+	if m.Format != bundleFormat {
+		return nil, fmt.Errorf("bundle %s has format %d; this version of langspace reads format %d", bundlePath, m.Format, bundleFormat)
+	}
+	return &m, nil
+}
+
+// loadBundle loads the file a bundle was packaged from out of the bundle,
+// placing its entities under the given namespace prefix, and publishes the
+// versions it vendors. A bundle imported by a bundled file is read from the
+// bundle that imports it.
+func (l *Loader) loadBundle(bundlePath, prefix string) error {
+	absPath, err := l.abs(bundlePath)
+	if err != nil {
+		return err
+	}
+	key := prefix + l.bundle + absPath
+	if l.loaded[key] {
+		return nil
+	}
+	l.loaded[key] = true
+	// Changes to the sources are changes to the bundle
+	if l.fsys == nil && !slices.Contains(l.files, func(f string) bool { return f == absPath }) {
+		l.files = append(l.files, absPath)
+	}
+
+	zr, closeBundle, err := l.openBundle(absPath)
+	if err != nil {
+		return err
+	}
+	defer closeBundle()
+
+	m, err := readManifest(zr, absPath)
+	if err != nil {
+		return err
+	}
+	// Check before parsing, which would fail on syntax this build lacks
+	if err := checkRequirements(absPath, m.Requires); err != nil {
+		return err
+	}
+	src, err := fs.Sub(zr, bundleSources)
+	if err != nil {
+		return err
+	}
+	fsys, bundle := l.fsys, l.bundle
+	l.fsys, l.bundle = src, l.bundle+absPath+"!"
+	err = l.load(m.Entry, prefix)
+	l.fsys, l.bundle = fsys, bundle
+	if err != nil {
+		return fmt.Errorf("in bundle %s: %w", absPath, err)
+	}
+
+	paths, err := fs.Glob(zr, bundleVersions+"/*/*/*.ls")
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		content, err := fs.ReadFile(zr, p)
+		if err != nil {
+			return err
+		}
+		version, entity, err := parseVersionFile(p, content)
+		if err == nil && prefix != "" {
+			err = l.applyNamespaces([]ast.Entity{entity}, prefix, nil)
+		}
+		if err == nil {
+			err = l.workspace.PublishVersion(version, entity)
+		}
+		if err != nil {
+			return fmt.Errorf("in bundle %s: %w", absPath, err)
+		}
+	}
+	return nil
+}
+
+// openBundle opens a bundle on disk, or in the bundle being loaded.
+func (l *Loader) openBundle(absPath string) (*zip.Reader, func(), error) {
+	if l.fsys != nil {
+		data, err := fs.ReadFile(l.fsys, absPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read file %s: %w", absPath, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening bundle %s: %w", absPath, err)
+		}
+		return zr, func() {}, nil
+	}
+	zr, err := zip.OpenReader(absPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening bundle %s: %w", absPath, err)
+	}
+	return &zr.Reader, func() { _ = zr.Close() }, nil
+}
+
+// checkRelativeImports returns an error if a file imports another by an
+// absolute path, which would not resolve once bundled.
+func checkRelativeImports(file string, content []byte) error {
+	_, imports, err := parser.New(string(content)).Parse()
+	if err != nil {
+		return fmt.Errorf("parse error in %s: %w", file, err)
+	}
+	for _, imp := range imports {
+		if path.IsAbs(imp.Path) || filepath.IsAbs(filepath.FromSlash(imp.Path)) {
+			return fmt.Errorf("%s imports %q by an absolute path; bundled imports must be relative", file, imp.Path)
+		}
+	}
+	return nil
+}
+
+// pinnedVersion is a published version a reference pins.
+type pinnedVersion struct {
+	entityType, name, version string
+}
+
+// vendorVersions writes the published versions that pinned references in
+// ws name, and those their definitions pin in turn, to a bundle. It returns
+// the versions written by entity key, and their definitions.
+func vendorVersions(zw *zip.Writer, ws *Workspace, store *VersionStore) (map[string][]string, []ast.Entity, error) {
+	queue := pinnedVersions(ws.GetEntities())
+	seen := make(map[pinnedVersion]bool)
+	vendored := make(map[string][]string)
+	var definitions []ast.Entity
+	for len(queue) > 0 {
+		pin := queue[0]
+		queue = queue[1:]
+		if seen[pin] {
+			continue
+		}
+		seen[pin] = true
+		// Imported bundles vendor the versions they pin
+		if _, ok := ws.GetPublishedVersion(pin.entityType, pin.name, pin.version); ok {
+			continue
+		}
+
+		if store == nil {
+			return nil, nil, fmt.Errorf("%s %q is pinned to version %s, but no published versions were given to vendor", pin.entityType, pin.name, pin.version)
+		}
+		file := store.path(pin.entityType, pin.name, pin.version)
+		content, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%s %q version %s is not published", pin.entityType, pin.name, pin.version)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		entities, _, err := parser.New(string(content)).Parse()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse error in %s: %w", file, err)
+		}
+		queue = append(queue, pinnedVersions(entities)...)
+		definitions = append(definitions, entities...)
+
+		name := path.Join(bundleVersions, pin.entityType, pin.name, pin.version+".ls")
+		if err := writeZipFile(zw, name, content); err != nil {
+			return nil, nil, err
+		}
+		key := entityKey(pin.entityType, pin.name)
+		vendored[key] = append(vendored[key], pin.version)
+	}
+	return vendored, definitions, nil
+}
+
+// pinnedVersions returns the published versions references in entities pin,
+// in the order they appear.
+func pinnedVersions(entities []ast.Entity) []pinnedVersion {
+	var pins []pinnedVersion
+	collect := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if val.Version != "" {
+				pins = append(pins, pinnedVersion{val.Type, val.Name, val.Version})
+			}
+		case ast.MethodCallValue:
+			// pipeline("review")@v3 { ... }
+			if sv, ok := val.Object.(ast.StringValue); ok && val.Version != "" {
+				pins = append(pins, pinnedVersion{sv.Value, val.Method, val.Version})
+			}
+		}
+		return v
+	}
+	for _, e := range entities {
+		walkValues(e, collect)
+	}
+	return pins
+}
+
+// bundleEntities lists the top-level entities of ws and the versions
+// vendored for each, sorted by type and name. Entities only vendored
+// versions exist of are included.
+func bundleEntities(ws *Workspace, vendored map[string][]string) []BundleEntity {
+	var entities []BundleEntity
+	listed := make(map[string]bool)
+	for _, e := range ws.GetEntities() {
+		key := entityKey(e.Type(), e.Name())
+		listed[key] = true
+		entities = append(entities, BundleEntity{Type: e.Type(), Name: e.Name(), Versions: vendored[key]})
+	}
+	for key, versions := range vendored {
+		if !listed[key] {
+			entityType, name, _ := strings.Cut(key, ":")
+			entities = append(entities, BundleEntity{Type: entityType, Name: name, Versions: versions})
+		}
+	}
+	for i := range entities {
+		sort.Strings(entities[i].Versions)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].Type != entities[j].Type {
+			return entities[i].Type < entities[j].Type
+		}
+		return entities[i].Name < entities[j].Name
+	})
+	return entities
+}
+
+// requiredProviders returns the models agents in ws name and the provider
+// types that serve them or that provider entities declare, sorted.
+func requiredProviders(ws *Workspace, cfg bundleConfig) (models, providers []string) {
+	defaultModel := cfg.defaultModel
+	for _, config := range ws.GetEntitiesByType("config") {
+		if v, ok := config.GetProperty("default_model"); ok {
+			if sv, ok := v.(ast.StringValue); ok {
+				defaultModel = sv.Value
+			}
+		}
+	}
+
+	modelSet := make(map[string]bool)
+	for _, agent := range ws.GetEntitiesByType("agent") {
+		v, ok := agent.GetProperty("model")
+		if !ok {
+			if defaultModel != "" {
+				modelSet[defaultModel] = true
+			}
+			continue
+		}
+		switch val := v.(type) {
+		case ast.StringValue:
+			modelSet[val.Value] = true
+		case ast.ArrayValue:
+			// Fallback models
+			for _, elem := range val.Elements {
+				if sv, ok := elem.(ast.StringValue); ok {
+					modelSet[sv.Value] = true
+				}
+			}
+		}
+	}
+
+	providerSet := make(map[string]bool)
+	for model := range modelSet {
+		models = append(models, model)
+		if cfg.providerOf != nil {
+			if t := cfg.providerOf(model); t != "" {
+				providerSet[t] = true
+			}
+		}
+	}
+	for _, provider := range ws.GetEntitiesByType("provider") {
+		if v, ok := provider.GetProperty("type"); ok {
+			if sv, ok := v.(ast.StringValue); ok && sv.Value != "" {
+				providerSet[sv.Value] = true
+			}
+		}
+	}
+	for t := range providerSet {
+		providers = append(providers, t)
+	}
+	sort.Strings(models)
+	sort.Strings(providers)
+	return models, providers
+}
+
+// referencedSecrets returns the names passed to env() and secret(), or
+// referenced as env("NAME") and secret("NAME"), in ws, sorted.
+func referencedSecrets(ws *Workspace) []string {
+	seen := make(map[string]bool)
+	collect := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if (val.Type == "env" || val.Type == "secret") && val.Name != "" {
+				seen[val.Name] = true
+			}
+		case ast.FunctionCallValue:
+			if (val.Function == "env" || val.Function == "secret") && len(val.Arguments) > 0 {
+				if sv, ok := val.Arguments[0].(ast.StringValue); ok && sv.Value != "" {
+					seen[sv.Value] = true
+				}
+			}
+		}
+		return v
+	}
+	for _, e := range ws.GetEntities() {
+		walkValues(e, collect)
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// walkValues calls fn for every value in the properties of an entity and
+// the entities nested in it.
+func walkValues(e ast.Entity, fn func(ast.Value) ast.Value) {
+	eachEntity(e, func(n ast.Entity) {
+		for _, v := range n.Properties() {
+			mapValue(v, fn, func(ast.Entity) {})
+		}
+	})
+}
+
+// commonDir returns the deepest directory that contains every file.
+func commonDir(files []string) string {
+	dir := filepath.Dir(files[0])
+	for _, file := range files[1:] {
+		for {
+			rel, err := filepath.Rel(dir, file)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// writeZipFile adds a compressed file to a zip archive. Entries carry no
+// modification time, so packaging the same files gives the same bundle.
+func writeZipFile(zw *zip.Writer, name string, content []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
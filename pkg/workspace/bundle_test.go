@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackage(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "lib/agents.ls", `
+agent "reviewer" {
+	model: ["gpt-4o", "claude-sonnet-4-20250514"]
+	instruction: env("REVIEW_STYLE")
+}
+`)
+	main := writeTestFile(t, dir, "flows/main.ls", `
+import "../lib/agents.ls" as agents
+
+agent "summarizer" {}
+
+trigger "nightly" {
+	event: "schedule"
+	run: pipeline("review")@v1 {
+		input: secret("GITHUB_TOKEN")
+	}
+}
+
+pipeline "review" {
+	step "read" {
+		use: agents.reviewer
+	}
+}
+`)
+	store := NewVersionStore(filepath.Join(dir, "versions"))
+	if err := store.Publish(publishSource, "pipeline", "review", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	m, err := Package(&buf, main, WithBundleVersions(store), WithModelProviders("claude-3-5-haiku", func(model string) string {
+		if strings.HasPrefix(model, "gpt") {
+			return "openai"
+		}
+		return "anthropic"
+	}))
+	if err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	if m.Entry != "flows/main.ls" || !reflect.DeepEqual(m.Files, []string{"flows/main.ls", "lib/agents.ls"}) {
+		t.Errorf("unexpected files: entry %q, files %v", m.Entry, m.Files)
+	}
+	if want := []string{"claude-3-5-haiku", "claude-sonnet-4-20250514", "gpt-4o"}; !reflect.DeepEqual(m.Models, want) {
+		t.Errorf("Models = %v, want %v", m.Models, want)
+	}
+	if want := []string{"anthropic", "openai"}; !reflect.DeepEqual(m.Providers, want) {
+		t.Errorf("Providers = %v, want %v", m.Providers, want)
+	}
+	if want := []string{"GITHUB_TOKEN", "REVIEW_STYLE"}; !reflect.DeepEqual(m.Secrets, want) {
+		t.Errorf("Secrets = %v, want %v", m.Secrets, want)
+	}
+	want := []BundleEntity{
+		{Type: "agent", Name: "agents.reviewer"},
+		{Type: "agent", Name: "summarizer"},
+		{Type: "pipeline", Name: "review", Versions: []string{"v1"}},
+		{Type: "trigger", Name: "nightly"},
+	}
+	if !reflect.DeepEqual(m.Entities, want) {
+		t.Errorf("Entities = %+v, want %+v", m.Entities, want)
+	}
+	requires := &Requirements{Version: "0.1.0", Features: []string{
+		"entity:agent", "entity:pipeline", "entity:step", "entity:trigger",
+		"function:secret", "syntax:version_pin",
+	}}
+	if !reflect.DeepEqual(m.Requires, requires) {
+		t.Errorf("Requires = %+v, want %+v", m.Requires, requires)
+	}
+
+	// The bundle loads without the files it was packaged from
+	bundle := filepath.Join(t.TempDir(), "main"+BundleExtension)
+	if err := os.WriteFile(bundle, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := New()
+	l := NewLoader(ws)
+	if err := l.Load(bundle); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok := ws.GetEntityByName("agent", "agents.reviewer"); !ok {
+		t.Error("expected the imported agent in its namespace")
+	}
+	if _, ok := ws.GetPublishedVersion("pipeline", "review", "v1"); !ok {
+		t.Error("expected the vendored version to be published")
+	}
+	if files := l.Files(); len(files) != 1 || files[0] != bundle {
+		t.Errorf("Files() = %v, want the bundle", files)
+	}
+
+	read, err := ReadBundleManifest(bundle)
+	if err != nil {
+		t.Fatalf("ReadBundleManifest() error = %v", err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("ReadBundleManifest() = %+v, want %+v", read, m)
+	}
+}
+
+func TestPackage_Errors(t *testing.T) {
+	dir := t.TempDir()
+	pinned := writeTestFile(t, dir, "pinned.ls", `
+trigger "nightly" {
+	run: pipeline("review")@v2
+}
+`)
+	lib := writeTestFile(t, dir, "lib.ls", `agent "reviewer" {}`)
+	absolute := writeTestFile(t, dir, "absolute.ls", `import "`+filepath.ToSlash(lib)+`"`)
+
+	tests := []struct {
+		name string
+		file string
+		opts []BundleOption
+		want string
+	}{
+		{name: "no versions", file: pinned, want: "no published versions"},
+		{name: "unpublished", file: pinned, opts: []BundleOption{WithBundleVersions(NewVersionStore(dir))}, want: "version v2 is not published"},
+		{name: "absolute import", file: absolute, want: "bundled imports must be relative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Package(&bytes.Buffer{}, tt.file, tt.opts...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Package() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
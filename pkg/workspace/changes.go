@@ -0,0 +1,124 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrChangesTruncated is returned when the requested changes are older than
+// the oldest event kept in the change feed. Callers should resync from a full
+// Serialize and continue from the current Sequence.
+var ErrChangesTruncated = errors.New("changes since requested sequence are no longer available")
+
+// changeLog is the bounded change feed of a workspace. Its fields are guarded
+// by the workspace mutex.
+type changeLog struct {
+	seq    uint64
+	events []Event
+	notify chan struct{} // closed and replaced whenever an event is recorded
+}
+
+// recordChange assigns the next sequence number to an event and appends it to
+// the change feed. Must be called with lock held.
+func (w *Workspace) recordChange(event Event) Event {
+	w.changes.seq++
+	event.Seq = w.changes.seq
+	event.Timestamp = time.Now().Unix()
+
+	w.changes.events = append(w.changes.events, event)
+	if w.config != nil && w.config.MaxChanges > 0 && len(w.changes.events) > w.config.MaxChanges {
+		w.changes.events = w.changes.events[len(w.changes.events)-w.config.MaxChanges:]
+	}
+
+	if w.changes.notify != nil {
+		close(w.changes.notify)
+		w.changes.notify = nil
+	}
+	return event
+}
+
+// Sequence returns the sequence number of the latest mutation (0 if none).
+func (w *Workspace) Sequence() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.changes.seq
+}
+
+// ChangesSince returns all events with a sequence number greater than since,
+// oldest first, along with the current sequence number.
+// It returns ErrChangesTruncated if some of those events have been dropped.
+func (w *Workspace) ChangesSince(since uint64) ([]Event, uint64, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.changesSince(since)
+}
+
+// changesSince must be called with lock held.
+func (w *Workspace) changesSince(since uint64) ([]Event, uint64, error) {
+	current := w.changes.seq
+	if since >= current {
+		return nil, current, nil
+	}
+
+	events := w.changes.events
+	if len(events) == 0 || events[0].Seq > since+1 {
+		return nil, current, ErrChangesTruncated
+	}
+
+	// Sequence numbers in the log are contiguous
+	start := int(since + 1 - events[0].Seq)
+	result := make([]Event, len(events)-start)
+	copy(result, events[start:])
+	return result, current, nil
+}
+
+// WaitForChanges is a long-poll variant of ChangesSince: it blocks until there
+// is at least one event after since, or until ctx is done.
+func (w *Workspace) WaitForChanges(ctx context.Context, since uint64) ([]Event, uint64, error) {
+	for {
+		w.mu.Lock()
+		events, current, err := w.changesSince(since)
+		if err != nil || len(events) > 0 {
+			w.mu.Unlock()
+			return events, current, err
+		}
+		if w.changes.notify == nil {
+			w.changes.notify = make(chan struct{})
+		}
+		notify := w.changes.notify
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, current, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// Subscribe streams events after since on the returned channel until ctx is
+// done, at which point the channel is closed. If the subscriber falls behind
+// the change feed, the channel is closed early; use ChangesSince to detect
+// truncation and resync.
+func (w *Workspace) Subscribe(ctx context.Context, since uint64) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for {
+			events, current, err := w.WaitForChanges(ctx, since)
+			if err != nil {
+				return
+			}
+			for _, event := range events {
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			since = current
+		}
+	}()
+	return ch
+}
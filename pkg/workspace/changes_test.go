@@ -0,0 +1,121 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkspace_ChangesSince(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(createFileEntity("a.txt"))
+	_ = w.AddEntity(createFileEntity("b.txt"))
+	_ = w.RemoveEntity("file", "a.txt")
+
+	if got := w.Sequence(); got != 3 {
+		t.Fatalf("Sequence() = %d, want 3", got)
+	}
+
+	events, current, err := w.ChangesSince(1)
+	if err != nil {
+		t.Fatalf("ChangesSince() error = %v", err)
+	}
+	if current != 3 || len(events) != 2 {
+		t.Fatalf("expected 2 events up to seq 3, got %d up to %d", len(events), current)
+	}
+	if events[0].Seq != 2 || events[0].Type != EventEntityAdded || events[0].Entity.Name() != "b.txt" {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Seq != 3 || events[1].Type != EventEntityRemoved {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+
+	if events, _, _ := w.ChangesSince(3); len(events) != 0 {
+		t.Errorf("expected no changes since latest sequence, got %d", len(events))
+	}
+}
+
+func TestWorkspace_ChangesSinceTruncated(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxChanges = 2
+	w := New().WithConfig(cfg)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_ = w.AddEntity(createFileEntity(name))
+	}
+
+	if _, _, err := w.ChangesSince(1); !errors.Is(err, ErrChangesTruncated) {
+		t.Errorf("expected ErrChangesTruncated, got %v", err)
+	}
+	events, _, err := w.ChangesSince(2)
+	if err != nil || len(events) != 2 {
+		t.Errorf("expected the 2 retained changes, got %d (err %v)", len(events), err)
+	}
+}
+
+func TestWorkspace_WaitForChanges(t *testing.T) {
+	w := New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := w.WaitForChanges(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error with no changes, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		_ = w.AddEntity(createFileEntity("late.txt"))
+	}()
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	events, current, err := w.WaitForChanges(ctx2, 0)
+	if err != nil {
+		t.Fatalf("WaitForChanges() error = %v", err)
+	}
+	if current != 1 || len(events) != 1 || events[0].Entity.Name() != "late.txt" {
+		t.Errorf("unexpected changes: %+v (seq %d)", events, current)
+	}
+}
+
+func TestWorkspace_Subscribe(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(createFileEntity("a.txt"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := w.Subscribe(ctx, 0)
+
+	_ = w.AddEntity(createFileEntity("b.txt"))
+	_ = w.AddRelationship("file", "a.txt", "file", "b.txt", RelationTypeDepends)
+
+	var seqs []uint64
+	for len(seqs) < 3 {
+		select {
+		case event := <-ch:
+			seqs = append(seqs, event.Seq)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", seqs)
+		}
+	}
+	if seqs[0] != 1 || seqs[1] != 2 || seqs[2] != 3 {
+		t.Errorf("expected sequences [1 2 3], got %v", seqs)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWorkspace_LoadEmitsChange(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(createFileEntity("a.txt"))
+	snapshot, _ := w.CreateSnapshot("s1")
+	if err := w.RestoreSnapshot(snapshot); err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+
+	events, _, _ := w.ChangesSince(1)
+	if len(events) != 1 || events[0].Type != EventWorkspaceLoaded {
+		t.Errorf("expected a workspace_loaded change, got %+v", events)
+	}
+}
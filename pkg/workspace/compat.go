@@ -0,0 +1,207 @@
+package workspace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Version is the version of the LangSpace language and runtime this build
+// implements.
+const Version = "0.2.0"
+
+// Requirements are what a bundle needs of the langspace that loads it: the
+// least version, and the language features it uses, named
+// "entity:<type>", "function:<name>", or "syntax:<construct>".
+type Requirements struct {
+	Version  string   `json:"version"`
+	Features []string `json:"features,omitempty"`
+}
+
+// firstBundleVersion is the first version that wrote bundles, which every
+// bundle requires.
+const firstBundleVersion = "0.1.0"
+
+// featureSince maps features added after firstBundleVersion to the version
+// that added them. Add new features here.
+var featureSince = map[string]string{
+	"syntax:arithmetic": "0.2.0",
+	"syntax:for_each":   "0.2.0",
+	"syntax:logical":    "0.2.0",
+}
+
+// functions are the built-in functions the runtime resolves.
+var functions = []string{
+	"concat", "date", "env", "file", "filter", "format_date", "format_number",
+	"join", "len", "map", "print", "query", "read_file", "regex_extract",
+	"regex_match", "regex_replace", "secret", "step", "translate", "write_file",
+}
+
+// syntax are the expressions and blocks older versions may not parse.
+var syntax = []string{
+	"arithmetic", "branch", "coalesce", "fallback", "for_each", "logical",
+	"loop", "matrix", "optional_chaining", "retry", "version_pin",
+}
+
+// Features returns the language features this build supports, sorted.
+func Features() []string {
+	var features []string
+	for _, t := range ast.RegisteredEntityTypes() {
+		features = append(features, "entity:"+t)
+	}
+	for _, f := range functions {
+		features = append(features, "function:"+f)
+	}
+	for _, s := range syntax {
+		features = append(features, "syntax:"+s)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// RequiredFeatures returns the requirements of entities: the features they
+// use and the least version that supports them all.
+func RequiredFeatures(entities []ast.Entity) *Requirements {
+	used := make(map[string]bool)
+	collect := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.FunctionCallValue:
+			used["function:"+val.Function] = true
+		case ast.ReferenceValue:
+			if val.Version != "" {
+				used["syntax:version_pin"] = true
+			}
+			if len(val.Optional) > 0 {
+				used["syntax:optional_chaining"] = true
+			}
+		case ast.MethodCallValue:
+			if val.Version != "" {
+				used["syntax:version_pin"] = true
+			}
+			if val.Optional {
+				used["syntax:optional_chaining"] = true
+			}
+		case ast.PropertyAccessValue:
+			if len(val.Optional) > 0 {
+				used["syntax:optional_chaining"] = true
+			}
+		case ast.CoalesceValue:
+			used["syntax:coalesce"] = true
+		case ast.BranchValue:
+			used["syntax:branch"] = true
+		case ast.LoopValue:
+			used["syntax:loop"] = true
+		case ast.RetryValue:
+			used["syntax:retry"] = true
+		case ast.FallbackValue:
+			used["syntax:fallback"] = true
+		case ast.MatrixValue:
+			used["syntax:matrix"] = true
+		case ast.ArithmeticValue:
+			used["syntax:arithmetic"] = true
+		case ast.LogicalValue, ast.NotValue:
+			used["syntax:logical"] = true
+		}
+		return v
+	}
+	for _, e := range entities {
+		eachEntity(e, func(n ast.Entity) {
+			used["entity:"+n.Type()] = true
+			if _, ok := n.GetProperty("for_each"); ok && n.Type() == "step" {
+				used["syntax:for_each"] = true
+			}
+		})
+		walkValues(e, collect)
+	}
+
+	r := &Requirements{Version: firstBundleVersion}
+	for f := range used {
+		r.Features = append(r.Features, f)
+		if since, ok := featureSince[f]; ok && compareVersions(since, r.Version) > 0 {
+			r.Version = since
+		}
+	}
+	sort.Strings(r.Features)
+	return r
+}
+
+// IncompatibleError is returned for a bundle that needs a newer langspace
+// than this one.
+type IncompatibleError struct {
+	Bundle   string
+	Requires *Requirements
+
+	// Missing are the features the bundle uses that this build lacks.
+	Missing []string
+}
+
+func (e *IncompatibleError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "bundle %s needs langspace >= %s", e.Bundle, e.Requires.Version)
+	if len(e.Missing) > 0 {
+		described := make([]string, len(e.Missing))
+		for i, f := range e.Missing {
+			described[i] = describeFeature(f)
+		}
+		fmt.Fprintf(&b, " for %s", strings.Join(described, ", "))
+	}
+	fmt.Fprintf(&b, "; this is langspace %s. Upgrade langspace to >= %s to load it", Version, e.Requires.Version)
+	return b.String()
+}
+
+// checkRequirements returns an *IncompatibleError if this build cannot run
+// a bundle with the given requirements. Bundles without requirements
+// predate them and are assumed compatible.
+func checkRequirements(bundlePath string, r *Requirements) error {
+	if r == nil {
+		return nil
+	}
+	supported := make(map[string]bool)
+	for _, f := range Features() {
+		supported[f] = true
+	}
+	var missing []string
+	for _, f := range r.Features {
+		if !supported[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) == 0 && compareVersions(r.Version, Version) <= 0 {
+		return nil
+	}
+	return &IncompatibleError{Bundle: bundlePath, Requires: r, Missing: missing}
+}
+
+// describeFeature names a feature for an error message, e.g. "eval
+// entities" for "entity:eval".
+func describeFeature(f string) string {
+	kind, name, _ := strings.Cut(f, ":")
+	switch kind {
+	case "entity":
+		return name + " entities"
+	case "function":
+		return name + "()"
+	case "syntax":
+		return strings.ReplaceAll(name, "_", " ")
+	}
+	return f
+}
+
+// compareVersions compares two versions by semver precedence. A version
+// that does not parse orders after every one that does, so an unreadable
+// requirement is never satisfied.
+func compareVersions(a, b string) int {
+	va, errA := parseSemver(a)
+	vb, errB := parseSemver(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return 1
+	case errB != nil:
+		return -1
+	}
+	return va.compare(vb)
+}
@@ -0,0 +1,133 @@
+package workspace
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRequiredFeatures(t *testing.T) {
+	ws := New()
+	if err := NewLoader(ws).Load(writeTestFile(t, t.TempDir(), "main.ls", `
+intent "triage" {
+	input: regex_extract(ticket?.body, "\d+") ?? "none"
+	use: agent("classifier")@v2
+}
+`)); err != nil {
+		t.Fatal(err)
+	}
+	r := RequiredFeatures(ws.GetEntities())
+	want := []string{"entity:intent", "function:regex_extract", "syntax:coalesce", "syntax:optional_chaining", "syntax:version_pin"}
+	if r.Version != firstBundleVersion || !slices.Equal(r.Features, want) {
+		t.Errorf("RequiredFeatures() = %+v, want version %s and features %v", r, firstBundleVersion, want)
+	}
+	for _, f := range r.Features {
+		if !slices.Contains(Features(), f) {
+			t.Errorf("Features() is missing %s", f)
+		}
+	}
+}
+
+func TestRequiredFeatures_Since(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		feature string
+		version string
+	}{
+		{"arithmetic", `intent "count" { input: $n * 2 + 1 }`, "syntax:arithmetic", "0.2.0"},
+		{"logical", `intent "check" { input: $a && $b }`, "syntax:logical", "0.2.0"},
+		{"not", `intent "check" { input: !$a }`, "syntax:logical", "0.2.0"},
+		{"for_each", `pipeline "review" { step "file" { for_each: ["a.go", "b.go"] } }`, "syntax:for_each", "0.2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := New()
+			if err := NewLoader(ws).Load(writeTestFile(t, t.TempDir(), "main.ls", tt.source)); err != nil {
+				t.Fatal(err)
+			}
+			r := RequiredFeatures(ws.GetEntities())
+			if r.Version != tt.version || !slices.Contains(r.Features, tt.feature) {
+				t.Errorf("RequiredFeatures() = %+v, want version %s and feature %s", r, tt.version, tt.feature)
+			}
+			if !slices.Contains(Features(), tt.feature) {
+				t.Errorf("Features() is missing %s", tt.feature)
+			}
+		})
+	}
+}
+
+// incompatibleBundle writes a bundle whose manifest requires r.
+func incompatibleBundle(t *testing.T, r *Requirements) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	manifest := `{"format": 1, "entry": "main.ls", "files": ["main.ls"], "requires": {"version": "` + r.Version + `", "features": ["` + strings.Join(r.Features, `", "`) + `"]}}`
+	if err := writeZipFile(zw, bundleManifest, []byte(manifest)); err != nil {
+		t.Fatal(err)
+	}
+	// Source this build cannot parse, which the check must catch first
+	if err := writeZipFile(zw, "main.ls", []byte(`workflow "next" { steps: [...] }`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoad_IncompatibleBundle(t *testing.T) {
+	tests := []struct {
+		name     string
+		requires *Requirements
+		want     string
+	}{
+		{
+			name:     "newer version",
+			requires: &Requirements{Version: "9.0.0", Features: []string{"entity:agent"}},
+			want:     "needs langspace >= 9.0.0; this is langspace " + Version + ". Upgrade langspace to >= 9.0.0 to load it",
+		},
+		{
+			name:     "unknown features",
+			requires: &Requirements{Version: "9.1.0", Features: []string{"entity:agent", "entity:workflow", "function:summarize", "syntax:spread"}},
+			want:     "needs langspace >= 9.1.0 for workflow entities, summarize(), spread; this is langspace " + Version,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := filepath.Join(t.TempDir(), "next"+BundleExtension)
+			if err := os.WriteFile(bundle, incompatibleBundle(t, tt.requires), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := NewLoader(New()).Load(bundle)
+			var incompatible *IncompatibleError
+			if !errors.As(err, &incompatible) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want an IncompatibleError containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryClient_InstallIncompatible(t *testing.T) {
+	_, server := newTestRegistry(t)
+	client := NewRegistryClient(server.URL)
+	ctx := context.Background()
+
+	if _, err := client.Publish(ctx, "acme/next", "1.0.0", incompatibleBundle(t, &Requirements{Version: "9.0.0"})); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var incompatible *IncompatibleError
+	if _, err := client.Install(ctx, dir, "acme/next"); !errors.As(err, &incompatible) {
+		t.Errorf("Install() error = %v, want an IncompatibleError", err)
+	}
+	if _, err := os.Stat(PackagePath(dir, "acme/next")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing installed, got %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// DefaultDuplicateThreshold is the similarity above which two agents are
+// reported as likely duplicates.
+const DefaultDuplicateThreshold = 0.85
+
+// instructionWeight is the share of the duplicate score that comes from
+// instruction similarity; the rest comes from property overlap.
+const instructionWeight = 0.7
+
+// DuplicateGroup is a cluster of agents that are likely duplicates.
+type DuplicateGroup struct {
+	// Agents in the group, with the suggested agent to keep first
+	Agents []string `json:"agents"`
+
+	// Similarity is the lowest similarity between linked agents in the group
+	Similarity float64 `json:"similarity"`
+
+	// Keep is the agent suggested to keep (the most referenced one)
+	Keep string `json:"keep"`
+
+	// Differences lists properties whose values differ across the group
+	Differences []string `json:"differences,omitempty"`
+}
+
+// Suggestion returns a human-readable merge suggestion for the group.
+func (g DuplicateGroup) Suggestion() string {
+	var others []string
+	for _, name := range g.Agents {
+		if name != g.Keep {
+			others = append(others, fmt.Sprintf("%q", name))
+		}
+	}
+	msg := fmt.Sprintf("merge %s into %q", strings.Join(others, ", "), g.Keep)
+	if len(g.Differences) > 0 {
+		msg += fmt.Sprintf(" (reconcile %s)", strings.Join(g.Differences, ", "))
+	}
+	return msg
+}
+
+// FindDuplicateAgents clusters agents by instruction similarity and property
+// overlap and returns groups whose similarity is at least threshold
+// (DefaultDuplicateThreshold if <= 0).
+//
+// Instructions are compared with embeddings when an embedder is set with
+// WithEmbedder, and by word overlap otherwise.
+func (w *Workspace) FindDuplicateAgents(ctx context.Context, threshold float64) ([]DuplicateGroup, error) {
+	if threshold <= 0 {
+		threshold = DefaultDuplicateThreshold
+	}
+
+	agents := w.GetEntitiesByType("agent")
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name() < agents[j].Name() })
+	if len(agents) < 2 {
+		return nil, nil
+	}
+
+	vectors, err := w.instructionVectors(ctx, agents)
+	if err != nil {
+		return nil, err
+	}
+
+	// Link every pair above the threshold (single-linkage clustering)
+	parent := make([]int, len(agents))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	minScore := make(map[int]float64)
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			score := instructionWeight*CosineSimilarity(vectors[i], vectors[j]) +
+				(1-instructionWeight)*propertyOverlap(agents[i], agents[j])
+			if score < threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			m := score
+			for _, root := range []int{ri, rj} {
+				if s, ok := minScore[root]; ok && s < m {
+					m = s
+				}
+			}
+			delete(minScore, rj)
+			parent[rj] = ri
+			minScore[ri] = m
+		}
+	}
+
+	members := make(map[int][]ast.Entity)
+	for i, agent := range agents {
+		root := find(i)
+		members[root] = append(members[root], agent)
+	}
+
+	refs := w.agentReferenceCounts()
+	var groups []DuplicateGroup
+	for root, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return refs[group[i].Name()] > refs[group[j].Name()]
+		})
+		g := DuplicateGroup{
+			Similarity:  minScore[root],
+			Keep:        group[0].Name(),
+			Differences: differingProperties(group),
+		}
+		for _, agent := range group {
+			g.Agents = append(g.Agents, agent.Name())
+		}
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Similarity != groups[j].Similarity {
+			return groups[i].Similarity > groups[j].Similarity
+		}
+		return groups[i].Keep < groups[j].Keep
+	})
+	return groups, nil
+}
+
+// instructionVectors returns one vector per agent for its instruction text,
+// from the embedder if set, or as word counts otherwise.
+func (w *Workspace) instructionVectors(ctx context.Context, agents []ast.Entity) ([][]float64, error) {
+	texts := make([]string, len(agents))
+	for i, agent := range agents {
+		texts[i] = semanticBody(agent)
+	}
+
+	w.mu.RLock()
+	idx := w.semanticIndex
+	w.mu.RUnlock()
+
+	if idx != nil {
+		// Agents without instruction text keep a nil vector (similarity 0)
+		var nonEmpty []string
+		var positions []int
+		for i, text := range texts {
+			if text != "" {
+				nonEmpty = append(nonEmpty, text)
+				positions = append(positions, i)
+			}
+		}
+		vectors := make([][]float64, len(texts))
+		if len(nonEmpty) == 0 {
+			return vectors, nil
+		}
+		embedded, err := idx.embedder.Embed(ctx, nonEmpty)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed agent instructions: %w", err)
+		}
+		if len(embedded) != len(nonEmpty) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(nonEmpty))
+		}
+		for i, pos := range positions {
+			vectors[pos] = embedded[i]
+		}
+		return vectors, nil
+	}
+
+	vocab := make(map[string]int)
+	for _, text := range texts {
+		for _, term := range tokenize(text) {
+			if _, ok := vocab[term]; !ok {
+				vocab[term] = len(vocab)
+			}
+		}
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, len(vocab))
+		for _, term := range tokenize(text) {
+			v[vocab[term]]++
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// propertyOverlap returns the Jaccard similarity of two agents' non-text
+// properties (model, tools, temperature, ...). Agents with no such properties
+// overlap fully.
+func propertyOverlap(a, b ast.Entity) float64 {
+	pa, pb := propertySignature(a), propertySignature(b)
+	if len(pa) == 0 && len(pb) == 0 {
+		return 1
+	}
+	shared := 0
+	for key, val := range pa {
+		if pb[key] == val {
+			shared++
+		}
+	}
+	union := len(pa) + len(pb) - shared
+	return float64(shared) / float64(union)
+}
+
+// propertySignature renders an agent's non-text properties for comparison.
+func propertySignature(e ast.Entity) map[string]string {
+	sig := make(map[string]string)
+	for key, val := range e.Properties() {
+		if isSemanticProperty(key) {
+			continue
+		}
+		sig[key] = fmt.Sprintf("%v", val)
+	}
+	return sig
+}
+
+func isSemanticProperty(key string) bool {
+	for _, k := range semanticProperties {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// differingProperties lists non-text properties that differ within a group.
+func differingProperties(group []ast.Entity) []string {
+	keys := make(map[string]bool)
+	sigs := make([]map[string]string, len(group))
+	for i, e := range group {
+		sigs[i] = propertySignature(e)
+		for key := range sigs[i] {
+			keys[key] = true
+		}
+	}
+
+	var diffs []string
+	for key := range keys {
+		first, ok := sigs[0][key]
+		for _, sig := range sigs[1:] {
+			if v, vok := sig[key]; vok != ok || v != first {
+				diffs = append(diffs, key)
+				break
+			}
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// agentReferenceCounts counts how often each agent is used by other entities,
+// through references, `use` properties, and relationships.
+func (w *Workspace) agentReferenceCounts() map[string]int {
+	counts := make(map[string]int)
+
+	var countValue func(key string, v ast.Value)
+	var countEntity func(e ast.Entity)
+	countValue = func(key string, v ast.Value) {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if val.Type == "agent" {
+				counts[val.Name]++
+			}
+		case ast.StringValue:
+			if key == "use" {
+				counts[val.Value]++
+			}
+		case ast.ArrayValue:
+			for _, elem := range val.Elements {
+				countValue(key, elem)
+			}
+		case ast.ObjectValue:
+			for k, elem := range val.Properties {
+				countValue(k, elem)
+			}
+		case ast.NestedEntityValue:
+			if val.Entity != nil {
+				countEntity(val.Entity)
+			}
+		}
+	}
+	countEntity = func(e ast.Entity) {
+		for key, v := range e.Properties() {
+			countValue(key, v)
+		}
+		switch ent := e.(type) {
+		case *ast.PipelineEntity:
+			for _, step := range ent.Steps {
+				countEntity(step)
+			}
+		case *ast.ParallelEntity:
+			for _, step := range ent.Steps {
+				countEntity(step)
+			}
+		}
+	}
+
+	for _, e := range w.GetEntities() {
+		countEntity(e)
+	}
+	for _, rel := range w.GetRelationships() {
+		if rel.TargetType == "agent" {
+			counts[rel.TargetName]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,74 @@
+package workspace
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func TestWorkspace_FindDuplicateAgents(t *testing.T) {
+	w := New()
+	reviewer := newSearchAgent("reviewer", "", "Review the code for bugs and security issues")
+	reviewer.SetProperty("model", ast.StringValue{Value: "gpt-4o"})
+	reviewer2 := newSearchAgent("reviewer-v2", "", "Review the code for bugs and security issues")
+	reviewer2.SetProperty("model", ast.StringValue{Value: "gpt-4o"})
+	reviewer3 := newSearchAgent("code-reviewer", "", "Review the code for bugs and security issues")
+	reviewer3.SetProperty("model", ast.StringValue{Value: "claude"})
+	translator := newSearchAgent("translator", "", "Translate text into French")
+
+	for _, e := range []ast.Entity{reviewer, reviewer2, reviewer3, translator} {
+		_ = w.AddEntity(e)
+	}
+	intent := ast.NewIntentEntity("review-pr")
+	intent.SetProperty("use", ast.ReferenceValue{Type: "agent", Name: "reviewer-v2"})
+	_ = w.AddEntity(intent)
+
+	groups, err := w.FindDuplicateAgents(context.Background(), 0.6)
+	if err != nil {
+		t.Fatalf("FindDuplicateAgents() error = %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 duplicate group, got %+v", groups)
+	}
+
+	g := groups[0]
+	if !reflect.DeepEqual(g.Agents, []string{"reviewer-v2", "code-reviewer", "reviewer"}) {
+		t.Errorf("expected referenced agent first, got %v", g.Agents)
+	}
+	if g.Keep != "reviewer-v2" {
+		t.Errorf("expected to keep the referenced agent, got %q", g.Keep)
+	}
+	if !reflect.DeepEqual(g.Differences, []string{"model"}) {
+		t.Errorf("expected differing property [model], got %v", g.Differences)
+	}
+	if g.Similarity < 0.6 || g.Similarity > 1 {
+		t.Errorf("unexpected similarity %f", g.Similarity)
+	}
+	if s := g.Suggestion(); !strings.Contains(s, `into "reviewer-v2"`) || !strings.Contains(s, "reconcile model") {
+		t.Errorf("unexpected suggestion %q", s)
+	}
+
+	// A strict threshold excludes the agent with a different model
+	groups, _ = w.FindDuplicateAgents(context.Background(), 0.99)
+	if len(groups) != 1 || len(groups[0].Agents) != 2 {
+		t.Errorf("expected only the identical pair at threshold 0.99, got %+v", groups)
+	}
+}
+
+func TestWorkspace_FindDuplicateAgentsWithEmbedder(t *testing.T) {
+	w := New().WithEmbedder(&conceptEmbedder{})
+	_ = w.AddEntity(newSearchAgent("invoicer", "", "Send an invoice"))
+	_ = w.AddEntity(newSearchAgent("biller", "", "Handle billing"))
+	_ = w.AddEntity(newSearchAgent("linter", "", "Lint the code"))
+
+	groups, err := w.FindDuplicateAgents(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("FindDuplicateAgents() error = %v", err)
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Agents, []string{"biller", "invoicer"}) {
+		t.Errorf("expected embedding-similar agents grouped, got %+v", groups)
+	}
+}
@@ -0,0 +1,358 @@
+package workspace
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
+)
+
+// Edge kinds used by Graph, in addition to the workspace's relationship
+// types.
+const (
+	EdgeNext       = "next"       // a step runs after another
+	EdgeOutput     = "output"     // a step reads another step's output
+	EdgeUses       = "uses"       // a step or intent runs an agent or pipeline
+	EdgeTool       = "tool"       // an agent can call a tool or MCP server
+	EdgeReferences = "references" // any other reference between entities
+)
+
+// GraphNode is an entity, or a pipeline step, in a workspace graph.
+type GraphNode struct {
+	ID     string // identifier that is safe to use in DOT and Mermaid
+	Type   string
+	Name   string
+	Parent string   // ID of the pipeline a step belongs to
+	Owners []string // users and teams that own the entity
+}
+
+// GraphEdge connects two nodes of a workspace graph.
+type GraphEdge struct {
+	From string
+	To   string
+	Kind string // one of the Edge* kinds or a RelationType
+}
+
+// Graph is a diagram of a workspace: its entities, the steps of its
+// pipelines, and how they depend on each other.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// stepInterpolation matches step outputs referenced in templates: {{step.name.output}}.
+var stepInterpolation = regexp.MustCompile(`\{\{\s*step\??\.([^.?\s}]+)`)
+
+// Graph returns a diagram of the workspace. Pipelines contain their steps,
+// which are linked in execution order and to the steps whose output they
+// read; parallel steps follow the last sequential step. Steps in branch and
+// loop blocks are included without an order. Agents are linked to their
+// tools, references between entities become edges, and so do the
+// workspace's relationships. References to undeclared entities are left
+// out.
+func (w *Workspace) Graph() *Graph {
+	entities := w.GetEntities()
+	b := &graphBuilder{ids: make(map[string]string), edges: make(map[GraphEdge]bool)}
+
+	for _, e := range entities {
+		b.addNode(entityKey(e.Type(), e.Name()), GraphNode{Type: e.Type(), Name: e.Name(), Owners: ast.Owners(e)})
+	}
+	for _, e := range entities {
+		if p, ok := e.(*ast.PipelineEntity); ok {
+			b.addPipeline(p)
+			continue
+		}
+		from := b.ids[entityKey(e.Type(), e.Name())]
+		if e.Type() == "agent" {
+			for _, name := range validator.AgentToolNames(e) {
+				b.addEdge(from, b.entity(name, "tool", "mcp"), EdgeTool)
+			}
+		}
+		b.addReferences(from, e, nil)
+	}
+
+	for _, rel := range w.GetRelationships() {
+		from := b.ids[entityKey(rel.SourceType, rel.SourceName)]
+		to := b.ids[entityKey(rel.TargetType, rel.TargetName)]
+		b.addEdge(from, to, string(rel.Type))
+	}
+
+	// Branch cases and objects are maps, so order edges by node
+	index := make(map[string]int, len(b.graph.Nodes))
+	for i, n := range b.graph.Nodes {
+		index[n.ID] = i
+	}
+	sort.SliceStable(b.graph.Edges, func(i, j int) bool {
+		ei, ej := b.graph.Edges[i], b.graph.Edges[j]
+		if ei.From != ej.From {
+			return index[ei.From] < index[ej.From]
+		}
+		if ei.To != ej.To {
+			return index[ei.To] < index[ej.To]
+		}
+		return ei.Kind < ej.Kind
+	})
+	return &b.graph
+}
+
+type graphBuilder struct {
+	graph Graph
+	ids   map[string]string // entity key or pipeline/step key -> node ID
+	edges map[GraphEdge]bool
+}
+
+func (b *graphBuilder) addNode(key string, node GraphNode) string {
+	if id, ok := b.ids[key]; ok {
+		return id
+	}
+	node.ID = fmt.Sprintf("n%d", len(b.graph.Nodes))
+	b.ids[key] = node.ID
+	b.graph.Nodes = append(b.graph.Nodes, node)
+	return node.ID
+}
+
+// addEdge adds an edge once, ignoring edges to or from unknown nodes.
+func (b *graphBuilder) addEdge(from, to, kind string) {
+	edge := GraphEdge{From: from, To: to, Kind: kind}
+	if from == "" || to == "" || from == to || b.edges[edge] {
+		return
+	}
+	b.edges[edge] = true
+	b.graph.Edges = append(b.graph.Edges, edge)
+}
+
+// entity returns the node ID of the first declared entity with the given
+// name among the types, or "" if there is none.
+func (b *graphBuilder) entity(name string, types ...string) string {
+	for _, t := range types {
+		if id, ok := b.ids[entityKey(t, name)]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+func (b *graphBuilder) addPipeline(p *ast.PipelineEntity) {
+	pipelineID := b.ids[entityKey(p.Type(), p.Name())]
+	steps := make(map[string]string)
+	stepNode := func(s ast.Entity) string {
+		id := b.addNode(entityKey(p.Type(), p.Name())+"/"+s.Name(), GraphNode{Type: "step", Name: s.Name(), Parent: pipelineID})
+		steps[s.Name()] = id
+		return id
+	}
+
+	// Sequential steps run in order, followed by parallel blocks
+	var ordered []ast.Entity
+	last := ""
+	for _, s := range p.Steps {
+		id := stepNode(s)
+		b.addEdge(last, id, EdgeNext)
+		last = id
+		ordered = append(ordered, s)
+	}
+	for _, key := range sortedKeys(p.Properties()) {
+		nested, ok := p.Properties()[key].(ast.NestedEntityValue)
+		if !ok {
+			continue
+		}
+		parallel, ok := nested.Entity.(*ast.ParallelEntity)
+		if !ok {
+			continue
+		}
+		for _, s := range parallel.Steps {
+			b.addEdge(last, stepNode(s), EdgeNext)
+			ordered = append(ordered, s)
+		}
+	}
+	// Steps in branches and loops
+	nested := make(map[string]bool)
+	for _, key := range sortedKeys(p.Properties()) {
+		mapValue(p.Properties()[key], func(v ast.Value) ast.Value { return v }, func(e ast.Entity) {
+			for name := range stepNames(e) {
+				nested[name] = true
+			}
+		})
+	}
+	for _, name := range sortedKeys(nested) {
+		if _, ok := steps[name]; !ok {
+			stepNode(ast.NewStepEntity(name))
+		}
+	}
+
+	for _, s := range ordered {
+		b.addReferences(steps[s.Name()], s, steps)
+	}
+	b.addReferences(pipelineID, p, steps)
+}
+
+// addReferences adds edges from the node from to the entities, and steps,
+// that an entity's properties refer to.
+func (b *graphBuilder) addReferences(from string, e ast.Entity, steps map[string]string) {
+	isStep := e.Type() == "step"
+	for _, key := range sortedKeys(e.Properties()) {
+		v := e.Properties()[key]
+		if sv, ok := v.(ast.StringValue); ok && key == "use" {
+			b.addEdge(from, b.entity(sv.Value, "agent"), EdgeUses)
+			continue
+		}
+		if e.Type() == "agent" && key == "tools" {
+			continue
+		}
+		mapValue(v, func(v ast.Value) ast.Value {
+			switch val := v.(type) {
+			case ast.ReferenceValue:
+				switch {
+				case val.Type == "step":
+					b.addEdge(steps[val.Name], from, EdgeOutput)
+				case key == "use" || (isStep && (val.Type == "agent" || val.Type == "pipeline")):
+					b.addEdge(from, b.entity(val.Name, val.Type), EdgeUses)
+				default:
+					b.addEdge(from, b.entity(val.Name, checkedTypes(val.Type)...), EdgeReferences)
+				}
+			case ast.StringValue:
+				for _, m := range stepInterpolation.FindAllStringSubmatch(val.Value, -1) {
+					b.addEdge(steps[m[1]], from, EdgeOutput)
+				}
+			}
+			return v
+		}, func(nested ast.Entity) {
+			if nested.Type() == "step" {
+				b.addReferences(steps[nested.Name()], nested, steps)
+				return
+			}
+			b.addReferences(from, nested, steps)
+		})
+	}
+}
+
+// checkedTypes returns the entity types a reference of the given type may
+// name: tool("x") can name an MCP server as well as a tool.
+func checkedTypes(refType string) []string {
+	switch refType {
+	case "tool":
+		return []string{"tool", "mcp"}
+	case "mcp_server":
+		return []string{"mcp"}
+	}
+	return []string{refType}
+}
+
+// graphLabel returns a node's display label, such as `agent "writer"`,
+// with the owners of owned entities on a second line.
+func graphLabel(n GraphNode) string {
+	label := n.Type
+	if n.Name != "" {
+		label = fmt.Sprintf("%s %q", n.Type, n.Name)
+	}
+	if len(n.Owners) > 0 {
+		label += "\nowners: " + strings.Join(n.Owners, ", ")
+	}
+	return label
+}
+
+// DOT renders the graph in the Graphviz DOT language. Pipelines are drawn
+// as clusters around their steps, and edges other than execution order and
+// data flow are dashed.
+func (g *Graph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph langspace {\n")
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString("\tnode [shape=box];\n")
+
+	children := g.children()
+	for _, n := range g.Nodes {
+		switch {
+		case n.Parent != "":
+			continue
+		case n.Type == "pipeline":
+			fmt.Fprintf(&sb, "\tsubgraph cluster_%s {\n", n.ID)
+			fmt.Fprintf(&sb, "\t\tlabel=%s;\n", dotQuote(graphLabel(n)))
+			fmt.Fprintf(&sb, "\t\t%s [label=\"\", shape=point];\n", n.ID)
+			for _, c := range children[n.ID] {
+				fmt.Fprintf(&sb, "\t\t%s [label=%s, shape=ellipse];\n", c.ID, dotQuote(c.Name))
+			}
+			sb.WriteString("\t}\n")
+		default:
+			fmt.Fprintf(&sb, "\t%s [label=%s];\n", n.ID, dotQuote(graphLabel(n)))
+		}
+	}
+
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=%s", dotQuote(e.Kind))
+		if e.Kind != EdgeNext && e.Kind != EdgeOutput {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "\t%s -> %s [%s];\n", e.From, e.To, attrs)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Pipelines are drawn as
+// subgraphs around their steps, and edges other than execution order and
+// data flow are dotted.
+func (g *Graph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+
+	children := g.children()
+	for _, n := range g.Nodes {
+		switch {
+		case n.Parent != "":
+			continue
+		case n.Type == "pipeline":
+			fmt.Fprintf(&sb, "    subgraph %s [%s]\n", n.ID, mermaidQuote(graphLabel(n)))
+			for _, c := range children[n.ID] {
+				fmt.Fprintf(&sb, "        %s([%s])\n", c.ID, mermaidQuote(c.Name))
+			}
+			sb.WriteString("    end\n")
+		default:
+			fmt.Fprintf(&sb, "    %s[%s]\n", n.ID, mermaidQuote(graphLabel(n)))
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind != EdgeNext && e.Kind != EdgeOutput {
+			arrow = "-.->"
+		}
+		if e.Kind == EdgeNext {
+			fmt.Fprintf(&sb, "    %s %s %s\n", e.From, arrow, e.To)
+			continue
+		}
+		fmt.Fprintf(&sb, "    %s %s|%s| %s\n", e.From, arrow, mermaidQuote(e.Kind), e.To)
+	}
+	return sb.String()
+}
+
+// children groups step nodes by the pipeline they belong to.
+func (g *Graph) children() map[string][]GraphNode {
+	children := make(map[string][]GraphNode)
+	for _, n := range g.Nodes {
+		if n.Parent != "" {
+			children[n.Parent] = append(children[n.Parent], n)
+		}
+	}
+	return children
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// mermaidQuote quotes a label, using Mermaid's entity code for quotes.
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s) + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+)
+
+const graphSource = `tool "search" {
+	command: "rg"
+}
+
+agent "researcher" {
+	model: "gpt-4o"
+	tools: [search, "undeclared"]
+}
+
+agent "writer" {
+	model: "gpt-4o"
+	owners: ["team-docs"]
+}
+
+pipeline "report" {
+	step "gather" {
+		use: researcher
+		input: $input
+	}
+
+	step "draft" {
+		use: agent("writer")
+		input: step("gather").output
+	}
+
+	parallel {
+		step "review" {
+			use: agent("writer")
+			input: "Check {{step.draft.output}}"
+		}
+	}
+}
+
+intent "weekly" {
+	use: pipeline("report")
+}
+`
+
+// edgeSet returns a graph's edges as "from -kind-> to" using node labels.
+func edgeSet(g *Graph) map[string]bool {
+	labels := make(map[string]string)
+	for _, n := range g.Nodes {
+		labels[n.ID] = n.Type + ":" + n.Name
+	}
+	edges := make(map[string]bool)
+	for _, e := range g.Edges {
+		edges[labels[e.From]+" -"+e.Kind+"-> "+labels[e.To]] = true
+	}
+	return edges
+}
+
+func TestWorkspace_Graph(t *testing.T) {
+	w := workspaceFrom(t, graphSource)
+	if err := w.AddRelationship("agent", "writer", "agent", "researcher", RelationTypeDepends); err != nil {
+		t.Fatal(err)
+	}
+	g := w.Graph()
+
+	if len(g.Nodes) != 8 {
+		t.Errorf("expected 5 entities and 3 steps, got %+v", g.Nodes)
+	}
+	for _, n := range g.Nodes {
+		if n.Type == "step" && n.Parent == "" {
+			t.Errorf("expected step %q to belong to its pipeline", n.Name)
+		}
+	}
+	if writer := g.Nodes[2]; writer.Name != "writer" || len(writer.Owners) != 1 || writer.Owners[0] != "team-docs" {
+		t.Errorf("expected the writer node to have its owners, got %+v", writer)
+	}
+
+	edges := edgeSet(g)
+	for _, want := range []string{
+		"agent:researcher -tool-> tool:search",
+		"step:gather -next-> step:draft",
+		"step:draft -next-> step:review",
+		"step:gather -output-> step:draft",
+		"step:draft -output-> step:review",
+		"step:gather -uses-> agent:researcher",
+		"step:draft -uses-> agent:writer",
+		"step:review -uses-> agent:writer",
+		"intent:weekly -uses-> pipeline:report",
+		"agent:writer -depends-> agent:researcher",
+	} {
+		if !edges[want] {
+			t.Errorf("missing edge %s in %v", want, edges)
+		}
+	}
+	if len(edges) != 10 {
+		t.Errorf("expected 10 edges, got %v", edges)
+	}
+}
+
+func TestGraph_DOT(t *testing.T) {
+	dot := workspaceFrom(t, graphSource).Graph().DOT()
+
+	for _, want := range []string{
+		"digraph langspace {",
+		`n1 [label="agent \"researcher\""];`,
+		`n2 [label="agent \"writer\"\nowners: team-docs"];`,
+		"subgraph cluster_n3 {",
+		`label="pipeline \"report\"";`,
+		`n5 [label="gather", shape=ellipse];`,
+		`n5 -> n6 [label="next"];`,
+		`n1 -> n0 [label="tool", style=dashed];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("expected %s in:\n%s", want, dot)
+		}
+	}
+	if dot != workspaceFrom(t, graphSource).Graph().DOT() {
+		t.Error("expected the same output on every run")
+	}
+}
+
+func TestGraph_Mermaid(t *testing.T) {
+	mermaid := workspaceFrom(t, graphSource).Graph().Mermaid()
+
+	for _, want := range []string{
+		"flowchart LR\n",
+		`    n1["agent #quot;researcher#quot;"]`,
+		`    n2["agent #quot;writer#quot; owners: team-docs"]`,
+		`    subgraph n3 ["pipeline #quot;report#quot;"]`,
+		`        n5(["gather"])`,
+		"    n5 --> n6\n",
+		`    n5 -->|"output"| n6`,
+		`    n4 -.->|"uses"| n3`,
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("expected %s in:\n%s", want, mermaid)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// ErrEntityLimit is returned when adding an entity to a workspace that holds
+// Config.MaxEntities entities.
+var ErrEntityLimit = errors.New("maximum entity limit reached")
+
+// EntityIterator is a stream of entities for ImportEntitiesStream. Next
+// returns io.EOF when the stream is exhausted.
+type EntityIterator interface {
+	Next() (ast.Entity, error)
+}
+
+// EntityIteratorFunc adapts a function to an EntityIterator.
+type EntityIteratorFunc func() (ast.Entity, error)
+
+// Next calls f.
+func (f EntityIteratorFunc) Next() (ast.Entity, error) {
+	return f()
+}
+
+// SliceIterator returns an iterator over entities.
+func SliceIterator(entities []ast.Entity) EntityIterator {
+	i := 0
+	return EntityIteratorFunc(func() (ast.Entity, error) {
+		if i >= len(entities) {
+			return nil, io.EOF
+		}
+		i++
+		return entities[i-1], nil
+	})
+}
+
+// ImportOptions configures ImportEntitiesStream.
+type ImportOptions struct {
+	// BatchSize is the number of entities read and stored at a time (default 100)
+	BatchSize int
+	// MaxConcurrency limits concurrent stores within a batch (0 = unlimited)
+	MaxConcurrency int
+	// Upsert replaces existing entities instead of rejecting them as duplicates
+	Upsert bool
+	// OnProgress is called after each batch is stored
+	OnProgress func(ImportProgress)
+
+	// QuotaBackoff is the first wait for room when the workspace holds
+	// Config.MaxEntities entities (default 100ms). Waits double up to
+	// MaxQuotaBackoff (default 5s).
+	QuotaBackoff    time.Duration
+	MaxQuotaBackoff time.Duration
+	// QuotaWait is how long to wait for room before rejecting the rest of a
+	// batch with ErrEntityLimit (default 1m)
+	QuotaWait time.Duration
+}
+
+// ImportProgress reports a stored batch.
+type ImportProgress struct {
+	Batch    int           // 1-based number of the batch
+	Imported int           // entities stored so far
+	Failed   int           // entities rejected so far
+	Errors   []ImportError // the batch's rejected entities
+}
+
+// ImportError is an entity ImportEntitiesStream rejected, e.g. because it
+// failed validation.
+type ImportError struct {
+	Index  int // 0-based position in the stream
+	Entity ast.Entity
+	Err    error
+}
+
+func (e ImportError) Error() string {
+	return fmt.Sprintf("entity %d (%s %q): %v", e.Index, e.Entity.Type(), e.Entity.Name(), e.Err)
+}
+
+func (e ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	Batches  int
+	Imported int
+	Failed   int
+	Errors   []ImportError
+}
+
+// ImportEntitiesStream stores the entities of a stream, such as a dataset
+// being loaded into a workspace, in batches. Entities that fail validation
+// or hooks are reported per batch and skipped; the rest of the stream is
+// still imported.
+//
+// When the workspace holds Config.MaxEntities entities, the import backs off
+// and waits for room, e.g. for a consumer to remove processed entities,
+// storing only as many entities as fit. Entities that still do not fit
+// after QuotaWait are rejected with ErrEntityLimit.
+//
+// The returned error is the iterator's, after the entities read before it
+// are stored.
+func (w *Workspace) ImportEntitiesStream(it EntityIterator, opts ImportOptions) (ImportResult, error) {
+	return w.ImportEntitiesStreamCtx(context.Background(), it, opts)
+}
+
+// ImportEntitiesStreamCtx is ImportEntitiesStream that stops once ctx is
+// done, returning ctx's error and the result so far.
+func (w *Workspace) ImportEntitiesStreamCtx(ctx context.Context, it EntityIterator, opts ImportOptions) (ImportResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.QuotaBackoff <= 0 {
+		opts.QuotaBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxQuotaBackoff <= 0 {
+		opts.MaxQuotaBackoff = 5 * time.Second
+	}
+	if opts.QuotaWait <= 0 {
+		opts.QuotaWait = time.Minute
+	}
+
+	var result ImportResult
+	read := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		batch := make([]ast.Entity, 0, opts.BatchSize)
+		var readErr error
+		for len(batch) < opts.BatchSize {
+			entity, err := it.Next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			batch = append(batch, entity)
+		}
+
+		if len(batch) > 0 {
+			imported, errs, err := w.importBatch(ctx, batch, read, opts)
+			read += len(batch)
+			result.Batches++
+			result.Imported += imported
+			result.Failed += len(errs)
+			result.Errors = append(result.Errors, errs...)
+			if opts.OnProgress != nil {
+				opts.OnProgress(ImportProgress{Batch: result.Batches, Imported: result.Imported, Failed: result.Failed, Errors: errs})
+			}
+			if err != nil {
+				return result, err
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return result, nil
+		}
+		if readErr != nil {
+			return result, fmt.Errorf("reading entity %d: %w", read, readErr)
+		}
+	}
+}
+
+// importBatch stores a batch whose first entity is at offset in the stream,
+// waiting for room under MaxEntities. It returns the number of entities
+// stored and the rejected ones.
+func (w *Workspace) importBatch(ctx context.Context, batch []ast.Entity, offset int, opts ImportOptions) (int, []ImportError, error) {
+	store := w.AddEntityCtx
+	if opts.Upsert {
+		store = w.UpsertEntityCtx
+	}
+
+	// indexes of the entities still to store
+	pending := make([]int, len(batch))
+	for i := range pending {
+		pending[i] = i
+	}
+	imported := 0
+	var errs []ImportError
+	backoff := opts.QuotaBackoff
+	var waited time.Duration
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if room := w.entityRoom(); room >= 0 && room < n && !opts.Upsert {
+			// Upserts of existing entities need no room, so only adds
+			// are held back
+			n = room
+		}
+
+		var retry []int
+		if n > 0 {
+			entities := make([]ast.Entity, n)
+			for j, i := range pending[:n] {
+				entities[j] = batch[i]
+			}
+			results := w.storeBatch(ctx, entities, store, opts.MaxConcurrency)
+
+			// Entities that lost a race for the last free slots are retried
+			for j, r := range results {
+				i := pending[j]
+				switch {
+				case r.Error == nil:
+					imported++
+					backoff, waited = opts.QuotaBackoff, 0
+				case errors.Is(r.Error, ErrEntityLimit):
+					retry = append(retry, i)
+				case ctx.Err() != nil && errors.Is(r.Error, ctx.Err()):
+					return imported, errs, ctx.Err()
+				default:
+					errs = append(errs, ImportError{Index: offset + i, Entity: batch[i], Err: r.Error})
+				}
+			}
+			pending = append(retry, pending[n:]...)
+		}
+		if len(pending) == 0 || (n > 0 && len(retry) < n) {
+			continue
+		}
+
+		// The workspace is full: wait for room
+		if waited >= opts.QuotaWait {
+			for _, i := range pending {
+				errs = append(errs, ImportError{Index: offset + i, Entity: batch[i], Err: ErrEntityLimit})
+			}
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return imported, errs, ctx.Err()
+		case <-timer.C:
+		}
+		waited += backoff
+		backoff = min(backoff*2, opts.MaxQuotaBackoff)
+	}
+	return imported, errs, nil
+}
+
+// entityRoom returns how many more entities fit under MaxEntities, or -1 if
+// there is no limit.
+func (w *Workspace) entityRoom() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.config == nil || w.config.MaxEntities <= 0 {
+		return -1
+	}
+	return max(w.config.MaxEntities-w.entities.len(), 0)
+}
@@ -0,0 +1,172 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func importEntities(n int) []ast.Entity {
+	entities := make([]ast.Entity, n)
+	for i := range entities {
+		entities[i] = createFileEntity(fmt.Sprintf("file%d.txt", i))
+	}
+	return entities
+}
+
+func TestImportEntitiesStream(t *testing.T) {
+	ws := New()
+	var progress []ImportProgress
+	result, err := ws.ImportEntitiesStream(SliceIterator(importEntities(25)), ImportOptions{
+		BatchSize:  10,
+		OnProgress: func(p ImportProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("ImportEntitiesStream failed: %v", err)
+	}
+	if result.Batches != 3 || result.Imported != 25 || result.Failed != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if got := len(ws.GetEntities()); got != 25 {
+		t.Errorf("expected 25 entities, got %d", got)
+	}
+	if len(progress) != 3 || progress[0].Imported != 10 || progress[2].Imported != 25 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+}
+
+func TestImportEntitiesStream_BatchErrors(t *testing.T) {
+	ws := New()
+	if err := ws.AddEntity(createFileEntity("file3.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	var batchErrors [][]ImportError
+	result, err := ws.ImportEntitiesStream(SliceIterator(importEntities(6)), ImportOptions{
+		BatchSize:  4,
+		OnProgress: func(p ImportProgress) { batchErrors = append(batchErrors, p.Errors) },
+	})
+	if err != nil {
+		t.Fatalf("ImportEntitiesStream failed: %v", err)
+	}
+	if result.Imported != 5 || result.Failed != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Index != 3 {
+		t.Fatalf("expected the duplicate at index 3 to be rejected, got %v", result.Errors)
+	}
+	if len(batchErrors) != 2 || len(batchErrors[0]) != 1 || len(batchErrors[1]) != 0 {
+		t.Errorf("expected the error in the first batch only, got %v", batchErrors)
+	}
+
+	// Upserts replace the existing entity
+	result, err = New().ImportEntitiesStream(SliceIterator(append(importEntities(2), importEntities(2)...)), ImportOptions{Upsert: true})
+	if err != nil || result.Imported != 4 || result.Failed != 0 {
+		t.Errorf("unexpected upsert result: %+v, %v", result, err)
+	}
+}
+
+func TestImportEntitiesStream_IteratorError(t *testing.T) {
+	ws := New()
+	entities := importEntities(3)
+	readErr := errors.New("connection reset")
+	i := 0
+	it := EntityIteratorFunc(func() (ast.Entity, error) {
+		if i == len(entities) {
+			return nil, readErr
+		}
+		i++
+		return entities[i-1], nil
+	})
+
+	result, err := ws.ImportEntitiesStream(it, ImportOptions{BatchSize: 2})
+	if !errors.Is(err, readErr) {
+		t.Fatalf("expected the iterator's error, got %v", err)
+	}
+	if result.Imported != 3 || len(ws.GetEntities()) != 3 {
+		t.Errorf("expected entities read before the error to be imported, got %+v", result)
+	}
+}
+
+func TestImportEntitiesStream_Quota(t *testing.T) {
+	t.Run("waits_for_room", func(t *testing.T) {
+		ws := New().WithConfig(&Config{MaxEntities: 5})
+
+		// A consumer removes imported entities
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				for _, e := range ws.GetEntities() {
+					ws.RemoveEntity(e.Type(), e.Name())
+				}
+			}
+		}()
+
+		result, err := ws.ImportEntitiesStream(SliceIterator(importEntities(20)), ImportOptions{
+			BatchSize:    8,
+			QuotaBackoff: time.Millisecond,
+			QuotaWait:    5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("ImportEntitiesStream failed: %v", err)
+		}
+		if result.Imported != 20 || result.Failed != 0 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("gives_up", func(t *testing.T) {
+		ws := New().WithConfig(&Config{MaxEntities: 3})
+		result, err := ws.ImportEntitiesStream(SliceIterator(importEntities(5)), ImportOptions{
+			QuotaBackoff: time.Millisecond,
+			QuotaWait:    10 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("ImportEntitiesStream failed: %v", err)
+		}
+		if result.Imported != 3 || result.Failed != 2 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		for _, e := range result.Errors {
+			if !errors.Is(e, ErrEntityLimit) {
+				t.Errorf("expected ErrEntityLimit, got %v", e)
+			}
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ws := New().WithConfig(&Config{MaxEntities: 1})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		result, err := ws.ImportEntitiesStreamCtx(ctx, SliceIterator(importEntities(3)), ImportOptions{
+			QuotaBackoff: time.Millisecond,
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the context's error, got %v", err)
+		}
+		if result.Imported != 1 || len(ws.GetEntities()) != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+}
+
+func TestSliceIterator(t *testing.T) {
+	it := SliceIterator(importEntities(1))
+	if _, err := it.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -2,17 +2,46 @@ package workspace
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/slices"
 )
 
 // Loader handles loading LangSpace files and their dependencies into a workspace.
+//
+// Imports may be namespaced with `import "lib/agents.ls" as agents`. Entities
+// from a namespaced file are added as "agents.<name>" and can be referenced from
+// the importing file as agents.<name> or agent("agents.<name>"). References
+// inside the imported file keep working without the prefix.
+//
+// A file may also import a bundle (see Package), such as a package
+// installed from a registry, which loads like the file it was packaged
+// from: `import ".langspace/packages/acme/review.lsbundle" as review`.
 type Loader struct {
 	workspace *Workspace
 	loaded    map[string]bool
-	baseDir   string
+	files     []string
+	profile   string
+	ignored   map[declaration]parser.Suppressions
+
+	// fsys holds the sources while a bundle loads, at slash-separated
+	// paths; nil reads from disk. bundle identifies the bundle, and those
+	// it was imported by, in the keys of loaded.
+	fsys   fs.FS
+	bundle string
+}
+
+// declaration identifies an entity by where it is declared.
+type declaration struct {
+	entityType, name string
+	line, column     int
 }
 
 // NewLoader creates a new Loader instance for the given workspace.
@@ -20,35 +49,116 @@ func NewLoader(ws *Workspace) *Loader {
 	return &Loader{
 		workspace: ws,
 		loaded:    make(map[string]bool),
+		ignored:   make(map[declaration]parser.Suppressions),
 	}
 }
 
-// Load loads a LangSpace file and all its imported dependencies.
+// WithProfile makes Load apply the named profile once the file and its
+// imports are loaded (see Workspace.ApplyProfile). An empty name applies none.
+func (l *Loader) WithProfile(name string) *Loader {
+	l.profile = name
+	return l
+}
+
+// Load loads a LangSpace file and all its imported dependencies, or the
+// file a bundle written by Package was packaged from (see IsBundle).
 func (l *Loader) Load(filePath string) error {
-	absPath, err := filepath.Abs(filePath)
+	load := func() error { return l.load(filePath, "") }
+	if IsBundle(filePath) {
+		load = func() error { return l.loadBundle(filePath, "") }
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	if l.profile == "" {
+		return nil
+	}
+	return l.workspace.ApplyProfile(l.profile)
+}
+
+// Files returns the absolute paths of the files loaded so far: the loaded
+// files and everything they import, in the order they were read. A bundle
+// is a single file.
+func (l *Loader) Files() []string {
+	return append([]string(nil), l.files...)
+}
+
+// Ignored reports whether an ignore comment in the file that declares an
+// entity silences a diagnostic with code about it, reported at the line and
+// column the entity is declared at (see parser.ParseSuppressions).
+func (l *Loader) Ignored(entityType, name string, line, column int, code i18n.Code) bool {
+	s, ok := l.ignored[declaration{entityType, name, line, column}]
+	return ok && s.Suppressed(line, code)
+}
+
+// load loads a file, placing its entities under the given namespace prefix
+// (empty, or ending in ".").
+func (l *Loader) load(filePath, prefix string) error {
+	absPath, err := l.abs(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for %s: %w", filePath, err)
+		return err
 	}
 
-	if l.loaded[absPath] {
+	key := prefix + l.bundle + absPath
+	if l.loaded[key] {
 		return nil
 	}
 
-	l.loaded[absPath] = true
+	l.loaded[key] = true
+	if l.fsys == nil && !slices.Contains(l.files, func(f string) bool { return f == absPath }) {
+		l.files = append(l.files, absPath)
+	}
 
-	content, err := os.ReadFile(absPath)
+	var content []byte
+	if l.fsys != nil {
+		content, err = fs.ReadFile(l.fsys, absPath)
+	} else {
+		content, err = os.ReadFile(absPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read file %s: %w", absPath, err)
 	}
 
-	l.baseDir = filepath.Dir(absPath)
-
 	p := parser.New(string(content))
 	entities, imports, err := p.Parse()
 	if err != nil {
 		return fmt.Errorf("parse error in %s: %w", absPath, err)
 	}
 
+	// Load imports first so namespaced references can be resolved
+	aliases := make(map[string]string)
+	for _, imp := range imports {
+		impPath := l.resolve(absPath, imp.Path)
+
+		impPrefix := prefix
+		if imp.Alias != "" {
+			impPrefix = prefix + imp.Alias + "."
+			aliases[imp.Alias] = impPrefix
+		}
+
+		load := l.load
+		if IsBundle(impPath) {
+			load = l.loadBundle
+		}
+		if err := load(impPath, impPrefix); err != nil {
+			return err
+		}
+	}
+
+	if prefix != "" || len(aliases) > 0 {
+		if err := l.applyNamespaces(entities, prefix, aliases); err != nil {
+			return fmt.Errorf("in %s: %w", absPath, err)
+		}
+	}
+
+	if s := parser.ParseSuppressions(string(content)); len(s) > 0 {
+		for _, entity := range entities {
+			eachEntity(entity, func(e ast.Entity) {
+				l.ignored[declaration{e.Type(), e.Name(), e.Line(), e.Column()}] = s
+			})
+		}
+	}
+
 	// Add entities to workspace
 	for _, entity := range entities {
 		if err := l.workspace.AddEntity(entity); err != nil {
@@ -56,17 +166,257 @@ func (l *Loader) Load(filePath string) error {
 		}
 	}
 
-	// Recursively load imports
-	for _, imp := range imports {
-		impPath := imp.Path
-		if !filepath.IsAbs(impPath) {
-			impPath = filepath.Join(l.baseDir, impPath)
+	return nil
+}
+
+// abs returns the absolute path of a file, which is a clean slash-separated
+// path while a bundle loads.
+func (l *Loader) abs(filePath string) (string, error) {
+	if l.fsys != nil {
+		return path.Clean(filePath), nil
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for %s: %w", filePath, err)
+	}
+	return absPath, nil
+}
+
+// resolve returns the path of a file imported by the file at absPath.
+func (l *Loader) resolve(absPath, importPath string) string {
+	if l.fsys != nil {
+		return path.Join(path.Dir(absPath), importPath)
+	}
+	// Import paths use forward slashes on every platform
+	impPath := filepath.FromSlash(importPath)
+	if !filepath.IsAbs(impPath) {
+		impPath = filepath.Join(filepath.Dir(absPath), impPath)
+	}
+	return impPath
+}
+
+// renamer is implemented by entities that can be renamed (see ast.BaseEntity).
+type renamer interface {
+	SetName(name string)
+}
+
+// applyNamespaces prefixes entity names and rewrites references so that:
+//   - references to entities in the same namespace get the prefix, and
+//   - alias.name property accesses become references to the namespaced entity.
+func (l *Loader) applyNamespaces(entities []ast.Entity, prefix string, aliases map[string]string) error {
+	local := make(map[string]string) // name -> type, for entities defined in this file
+	for _, e := range entities {
+		if e.Name() != "" {
+			local[e.Name()] = e.Type()
 		}
+	}
 
-		if err := l.Load(impPath); err != nil {
-			return err
+	inNamespace := func(entityType, name string) bool {
+		if prefix == "" {
+			return false
+		}
+		if t, ok := local[name]; ok && (entityType == "" || t == entityType) {
+			return true
 		}
+		if entityType == "" {
+			return l.findEntity(prefix+name) != nil
+		}
+		_, found := l.workspace.GetEntityByName(entityType, prefix+name)
+		return found
+	}
+
+	var rewriteErr error
+	rewrite := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if inNamespace(val.Type, val.Name) {
+				val.Name = prefix + val.Name
+			}
+			return val
+		case ast.PropertyAccessValue:
+			ns, ok := aliases[val.Base]
+			if !ok {
+				return val
+			}
+			for i := len(val.Path); i > 0; i-- {
+				name := ns + strings.Join(val.Path[:i], ".")
+				if entity := l.findEntity(name); entity != nil {
+					return ast.ReferenceValue{Type: entity.Type(), Name: name, Path: val.Path[i:]}
+				}
+			}
+			if rewriteErr == nil {
+				rewriteErr = fmt.Errorf("unknown entity %q in namespace %q", strings.Join(val.Path, "."), val.Base)
+			}
+			return val
+		}
+		return v
+	}
+
+	var visit func(e ast.Entity)
+	visit = func(e ast.Entity) {
+		rewriteEntity(e, func(key string, v ast.Value) ast.Value {
+			// Entity names given as plain strings
+			switch key {
+			case "use":
+				if sv, ok := v.(ast.StringValue); ok && inNamespace("agent", sv.Value) {
+					return ast.StringValue{Value: prefix + sv.Value}
+				}
+			case "tools":
+				if arr, ok := v.(ast.ArrayValue); ok {
+					elems := make([]ast.Value, len(arr.Elements))
+					for i, elem := range arr.Elements {
+						elems[i] = elem
+						if sv, ok := elem.(ast.StringValue); ok && inNamespace("", sv.Value) {
+							elems[i] = ast.StringValue{Value: prefix + sv.Value}
+						}
+					}
+					v = ast.ArrayValue{Elements: elems}
+				}
+			}
+			return mapValue(v, rewrite, visit)
+		})
 	}
 
+	for _, e := range entities {
+		visit(e)
+
+		if prefix != "" && e.Name() != "" {
+			if r, ok := e.(renamer); ok {
+				r.SetName(prefix + e.Name())
+				e.SetMetadata("namespace", strings.TrimSuffix(prefix, "."))
+			}
+		}
+	}
+
+	return rewriteErr
+}
+
+// findEntity returns the first workspace entity with the given name, of any type.
+func (l *Loader) findEntity(name string) ast.Entity {
+	for _, e := range l.workspace.GetEntities() {
+		if e.Name() == name {
+			return e
+		}
+	}
 	return nil
 }
+
+// rewriteEntity replaces each property value of an entity, including nested
+// pipeline and parallel steps and eval cases, with the result of fn.
+func rewriteEntity(e ast.Entity, fn func(key string, v ast.Value) ast.Value) {
+	for key, v := range e.Properties() {
+		e.SetProperty(key, fn(key, v))
+	}
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		for _, step := range ent.Steps {
+			rewriteEntity(step, fn)
+		}
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			rewriteEntity(step, fn)
+		}
+	case *ast.EvalEntity:
+		for _, c := range ent.Cases {
+			rewriteEntity(c, fn)
+		}
+	}
+}
+
+// eachEntity calls fn for an entity and every entity nested in it.
+func eachEntity(e ast.Entity, fn func(ast.Entity)) {
+	fn(e)
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		for _, step := range ent.Steps {
+			eachEntity(step, fn)
+		}
+	case *ast.ParallelEntity:
+		for _, step := range ent.Steps {
+			eachEntity(step, fn)
+		}
+	case *ast.EvalEntity:
+		for _, c := range ent.Cases {
+			eachEntity(c, fn)
+		}
+	}
+	for _, v := range e.Properties() {
+		mapValue(v, func(v ast.Value) ast.Value { return v }, func(n ast.Entity) { eachEntity(n, fn) })
+	}
+}
+
+// mapValue applies fn to every value in a value tree, children first.
+// Nested entities are handed to visit instead.
+func mapValue(v ast.Value, fn func(ast.Value) ast.Value, visit func(ast.Entity)) ast.Value {
+	switch val := v.(type) {
+	case ast.ArrayValue:
+		elems := make([]ast.Value, len(val.Elements))
+		for i, elem := range val.Elements {
+			elems[i] = mapValue(elem, fn, visit)
+		}
+		return fn(ast.ArrayValue{Elements: elems})
+	case ast.ObjectValue:
+		props := make(map[string]ast.Value, len(val.Properties))
+		for k, elem := range val.Properties {
+			props[k] = mapValue(elem, fn, visit)
+		}
+		return fn(ast.ObjectValue{Properties: props})
+	case ast.NestedEntityValue:
+		if val.Entity != nil {
+			visit(val.Entity)
+		}
+		return fn(val)
+	case ast.MethodCallValue:
+		val.Object = mapValue(val.Object, fn, visit)
+		args := make([]ast.Value, len(val.Arguments))
+		for i, arg := range val.Arguments {
+			args[i] = mapValue(arg, fn, visit)
+		}
+		val.Arguments = args
+		if val.InlineBody != nil {
+			visit(val.InlineBody)
+		}
+		return fn(val)
+	case ast.FunctionCallValue:
+		args := make([]ast.Value, len(val.Arguments))
+		for i, arg := range val.Arguments {
+			args[i] = mapValue(arg, fn, visit)
+		}
+		val.Arguments = args
+		return fn(val)
+	case ast.ComparisonValue:
+		val.Left = mapValue(val.Left, fn, visit)
+		val.Right = mapValue(val.Right, fn, visit)
+		return fn(val)
+	case ast.CoalesceValue:
+		val.Left = mapValue(val.Left, fn, visit)
+		val.Right = mapValue(val.Right, fn, visit)
+		return fn(val)
+	case ast.ArithmeticValue:
+		val.Left = mapValue(val.Left, fn, visit)
+		val.Right = mapValue(val.Right, fn, visit)
+		return fn(val)
+	case ast.LogicalValue:
+		val.Left = mapValue(val.Left, fn, visit)
+		val.Right = mapValue(val.Right, fn, visit)
+		return fn(val)
+	case ast.NotValue:
+		val.Operand = mapValue(val.Operand, fn, visit)
+		return fn(val)
+	case ast.BranchValue:
+		val.Condition = mapValue(val.Condition, fn, visit)
+		for _, c := range val.Cases {
+			mapValue(c, fn, visit)
+		}
+		return fn(val)
+	case ast.LoopValue:
+		for _, b := range val.Body {
+			mapValue(b, fn, visit)
+		}
+		val.BreakCondition = mapValue(val.BreakCondition, fn, visit)
+		return fn(val)
+	case nil:
+		return nil
+	}
+	return fn(v)
+}
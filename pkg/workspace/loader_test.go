@@ -0,0 +1,166 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	return path
+}
+
+func TestLoader_NamespacedImport(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "lib/agents.ls", `
+agent "reviewer" {
+	model: "gpt-4o"
+	tools: [linter]
+}
+
+tool "linter" {
+	command: "golint"
+}
+
+intent "review" {
+	use: agent("reviewer")
+}
+`)
+	main := writeTestFile(t, dir, "main.ls", `
+import "lib/agents.ls" as agents
+
+agent "reviewer" {
+	model: "gpt-4o"
+}
+
+pipeline "check" {
+	step "lint" {
+		use: agents.reviewer
+	}
+}
+`)
+
+	ws := New()
+	if err := NewLoader(ws).Load(main); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Both reviewers coexist without colliding
+	if _, ok := ws.GetEntityByName("agent", "reviewer"); !ok {
+		t.Error("expected local agent 'reviewer'")
+	}
+	lib, ok := ws.GetEntityByName("agent", "agents.reviewer")
+	if !ok {
+		t.Fatal("expected namespaced agent 'agents.reviewer'")
+	}
+	if ns, _ := lib.GetMetadata("namespace"); ns != "agents" {
+		t.Errorf("namespace metadata = %q, want agents", ns)
+	}
+
+	// References inside the imported file are rewritten to the namespace
+	tools, _ := lib.GetProperty("tools")
+	if sv := tools.(ast.ArrayValue).Elements[0].(ast.StringValue); sv.Value != "agents.linter" {
+		t.Errorf("tools[0] = %q, want agents.linter", sv.Value)
+	}
+	intent, _ := ws.GetEntityByName("intent", "agents.review")
+	use, _ := intent.GetProperty("use")
+	if ref := use.(ast.ReferenceValue); ref.Name != "agents.reviewer" {
+		t.Errorf("intent use = %q, want agents.reviewer", ref.Name)
+	}
+
+	// alias.name in the importing file becomes a reference
+	pipeline, _ := ws.GetEntityByName("pipeline", "check")
+	stepUse, _ := pipeline.(*ast.PipelineEntity).Steps[0].GetProperty("use")
+	ref, ok := stepUse.(ast.ReferenceValue)
+	if !ok || ref.Type != "agent" || ref.Name != "agents.reviewer" {
+		t.Errorf("step use = %#v, want agent reference to agents.reviewer", stepUse)
+	}
+}
+
+func TestLoader_UnknownNamespacedEntity(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "lib.ls", `agent "a" { model: "gpt-4o" }`)
+	main := writeTestFile(t, dir, "main.ls", `
+import "lib.ls" as lib
+
+intent "x" {
+	use: lib.missing
+}
+`)
+
+	if err := NewLoader(New()).Load(main); err == nil {
+		t.Error("expected error for unknown namespaced entity")
+	}
+}
+
+func TestLoader_Files(t *testing.T) {
+	dir := t.TempDir()
+	lib := writeTestFile(t, dir, "lib/agents.ls", `agent "reviewer" { model: "gpt-4o" }`)
+	other := writeTestFile(t, dir, "lib/tools.ls", `tool "linter" { command: "golint" }`)
+	main := writeTestFile(t, dir, "main.ls", `
+import "lib/agents.ls"
+import "lib/agents.ls" as agents
+import "lib/tools.ls"
+`)
+
+	l := NewLoader(New())
+	if err := l.Load(main); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Each file is listed once, even when imported under two namespaces
+	files := l.Files()
+	want := []string{main, lib, other}
+	if len(files) != len(want) {
+		t.Fatalf("Files() = %v, want %v", files, want)
+	}
+	for _, path := range want {
+		found := false
+		for _, f := range files {
+			found = found || f == path
+		}
+		if !found {
+			t.Errorf("Files() = %v, missing %s", files, path)
+		}
+	}
+}
+
+func TestLoader_Ignored(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "lib/tools.ls", `tool "search" { command: "grep" } # langspace:ignore LS2202`)
+	main := writeTestFile(t, dir, "main.ls", `import "lib/tools.ls" as tools
+
+pipeline "report" {
+  # langspace:ignore LS2004 the editor comes from a plugin
+  step "draft" { use: agent("editor") }
+}
+`)
+
+	ws := New()
+	l := NewLoader(ws)
+	if err := l.Load(main); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !l.Ignored("tool", "tools.search", 1, 1, i18n.UnusedTool) {
+		t.Error("expected the unused tool warning in the imported file to be ignored")
+	}
+	errs := ws.ValidateSemantics()
+	if len(errs) != 1 || !l.Ignored(errs[0].EntityType, errs[0].EntityName, errs[0].Line, errs[0].Column, errs[0].Code) {
+		t.Errorf("expected the undefined agent error to be ignored, got %v", errs)
+	}
+	if l.Ignored("step", "draft", 5, 3, i18n.LaterStepReference) {
+		t.Error("expected other codes not to be ignored")
+	}
+}
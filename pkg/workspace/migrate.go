@@ -0,0 +1,131 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CurrentSchemaVersion is the serialization format version written by Serialize.
+const CurrentSchemaVersion = 1
+
+// MigrationMode controls how LoadFrom treats saved state that does not match
+// the current schema exactly.
+type MigrationMode string
+
+const (
+	// MigrationLenient assumes version 1 when the version is missing, loads
+	// newer versions on a best-effort basis, and ignores unknown fields.
+	MigrationLenient MigrationMode = "lenient"
+
+	// MigrationStrict rejects missing or newer versions and unknown fields.
+	MigrationStrict MigrationMode = "strict"
+)
+
+// MigrationFunc upgrades a decoded serialized workspace by one version, in place.
+// The document is the raw JSON object; numbers are json.Number values.
+type MigrationFunc func(doc map[string]interface{}) error
+
+// Migrator upgrades serialized workspaces to a target schema version by applying
+// registered single-step migrations (v1->v2, v2->v3, ...) in order.
+type Migrator struct {
+	target     int
+	migrations map[int]MigrationFunc
+	mu         sync.RWMutex
+}
+
+// NewMigrator creates a Migrator that upgrades documents to the target version.
+func NewMigrator(target int) *Migrator {
+	return &Migrator{
+		target:     target,
+		migrations: make(map[int]MigrationFunc),
+	}
+}
+
+var defaultMigrator = NewMigrator(CurrentSchemaVersion)
+
+// DefaultMigrator returns the migrator used by workspaces that don't set one.
+func DefaultMigrator() *Migrator {
+	return defaultMigrator
+}
+
+// RegisterMigration registers a migration from the given version to the next
+// on the default migrator.
+func RegisterMigration(from int, fn MigrationFunc) {
+	defaultMigrator.Register(from, fn)
+}
+
+// Register adds the migration that upgrades documents from version `from` to
+// `from+1`. Registering the same version twice replaces the earlier migration.
+func (m *Migrator) Register(from int, fn MigrationFunc) *Migrator {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.migrations[from] = fn
+	return m
+}
+
+// Target returns the schema version documents are migrated to.
+func (m *Migrator) Target() int {
+	return m.target
+}
+
+// Migrate upgrades doc to the target version and returns the version it started at.
+func (m *Migrator) Migrate(doc map[string]interface{}, mode MigrationMode) (int, error) {
+	version, ok, err := schemaVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || version <= 0 {
+		if mode == MigrationStrict {
+			return 0, fmt.Errorf("missing schema version")
+		}
+		version = 1
+	}
+	from := version
+
+	if version > m.target {
+		if mode == MigrationStrict {
+			return from, fmt.Errorf("schema version %d is newer than supported version %d", version, m.target)
+		}
+		return from, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for version < m.target {
+		fn, ok := m.migrations[version]
+		if !ok {
+			return from, fmt.Errorf("no migration registered from schema version %d to %d", version, version+1)
+		}
+		if err := fn(doc); err != nil {
+			return from, fmt.Errorf("migration from schema version %d to %d failed: %w", version, version+1, err)
+		}
+		version++
+		doc["version"] = version
+	}
+
+	return from, nil
+}
+
+// schemaVersion reads the "version" field of a decoded workspace document.
+func schemaVersion(doc map[string]interface{}) (int, bool, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, false, nil
+	}
+
+	switch v := raw.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid schema version %q", v)
+		}
+		return int(n), true, nil
+	case float64:
+		return int(v), true, nil
+	case int:
+		return v, true, nil
+	}
+	return 0, false, fmt.Errorf("invalid schema version %v", raw)
+}
@@ -0,0 +1,130 @@
+package workspace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// v1 document with a single agent
+const v1Workspace = `{
+  "version": 1,
+  "entities": [
+    {"type": "agent", "name": "bot", "properties": {"model": {"type": "string", "value": "gpt-4o"}}}
+  ],
+  "relationships": []
+}`
+
+func TestLoadFrom_MigrationChain(t *testing.T) {
+	var applied []int
+	m := NewMigrator(3).
+		Register(1, func(doc map[string]interface{}) error {
+			applied = append(applied, 1)
+			// v2 renamed entity "name" to "id"
+			for _, e := range doc["entities"].([]interface{}) {
+				ent := e.(map[string]interface{})
+				ent["id"] = ent["name"]
+				delete(ent, "name")
+			}
+			return nil
+		}).
+		Register(2, func(doc map[string]interface{}) error {
+			applied = append(applied, 2)
+			// v3 renamed it back
+			for _, e := range doc["entities"].([]interface{}) {
+				ent := e.(map[string]interface{})
+				ent["name"] = ent["id"]
+				delete(ent, "id")
+			}
+			return nil
+		})
+
+	w := New().WithMigrator(m)
+	if err := w.LoadFrom(strings.NewReader(v1Workspace)); err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+	if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Errorf("expected migrations [1 2], got %v", applied)
+	}
+	if _, ok := w.GetEntityByName("agent", "bot"); !ok {
+		t.Error("expected migrated agent 'bot' to be loaded")
+	}
+}
+
+func TestLoadFrom_MigrationErrors(t *testing.T) {
+	failing := errors.New("boom")
+
+	tests := []struct {
+		name     string
+		migrator *Migrator
+		mode     MigrationMode
+		input    string
+		wantErr  string
+	}{
+		{
+			name:     "missing migration",
+			migrator: NewMigrator(3).Register(1, func(map[string]interface{}) error { return nil }),
+			mode:     MigrationLenient,
+			input:    v1Workspace,
+			wantErr:  "no migration registered from schema version 2 to 3",
+		},
+		{
+			name:     "failing migration",
+			migrator: NewMigrator(2).Register(1, func(map[string]interface{}) error { return failing }),
+			mode:     MigrationLenient,
+			input:    v1Workspace,
+			wantErr:  "boom",
+		},
+		{
+			name:     "strict newer version",
+			migrator: NewMigrator(1),
+			mode:     MigrationStrict,
+			input:    `{"version": 5, "entities": [], "relationships": []}`,
+			wantErr:  "newer than supported",
+		},
+		{
+			name:     "strict missing version",
+			migrator: NewMigrator(1),
+			mode:     MigrationStrict,
+			input:    `{"entities": [], "relationships": []}`,
+			wantErr:  "missing schema version",
+		},
+		{
+			name:     "strict unknown field",
+			migrator: NewMigrator(1),
+			mode:     MigrationStrict,
+			input:    `{"version": 1, "entities": [], "relationships": [], "extra": true}`,
+			wantErr:  "unknown field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New().WithConfig(&Config{MigrationMode: tt.mode}).WithMigrator(tt.migrator)
+			err := w.LoadFrom(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFrom() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFrom_MigrationLenient(t *testing.T) {
+	inputs := map[string]string{
+		"missing version": `{"entities": [{"type": "agent", "name": "bot", "properties": {}}], "relationships": []}`,
+		"newer version":   `{"version": 9, "entities": [{"type": "agent", "name": "bot", "properties": {}}], "relationships": []}`,
+		"unknown field":   `{"version": 1, "entities": [{"type": "agent", "name": "bot", "properties": {}, "tags": []}], "relationships": []}`,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			w := New().WithMigrator(NewMigrator(1))
+			if err := w.LoadFrom(strings.NewReader(input)); err != nil {
+				t.Fatalf("LoadFrom() error = %v", err)
+			}
+			if _, ok := w.GetEntityByName("agent", "bot"); !ok {
+				t.Error("expected agent 'bot' to be loaded")
+			}
+		})
+	}
+}
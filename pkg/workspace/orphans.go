@@ -0,0 +1,186 @@
+package workspace
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/validator"
+)
+
+// DefaultOrphanRoots are the entity types FindOrphans keeps by default:
+// what runs (pipelines, intents, triggers, and evals), and entities that
+// apply to the whole workspace without being referenced.
+var DefaultOrphanRoots = []string{"pipeline", "intent", "trigger", "eval", "config", "provider", "profile", "env"}
+
+// OrphanOption configures FindOrphans and PruneOrphans.
+type OrphanOption func(*orphanOptions)
+
+type orphanOptions struct {
+	roots []string
+}
+
+// WithOrphanRoots keeps the entities of the given types, and what they
+// reference, instead of those of DefaultOrphanRoots.
+func WithOrphanRoots(types ...string) OrphanOption {
+	return func(o *orphanOptions) {
+		o.roots = types
+	}
+}
+
+// promptInclude matches prompts included in templates: {{include "name"}}.
+var promptInclude = regexp.MustCompile(`\{\{\s*include\s+["']([^"']*)["']`)
+
+// FindOrphans returns the entities that nothing kept refers to, sorted by
+// type and name. Entities of the root types are kept, and so is every
+// entity a kept entity refers to, directly or through others: by reference
+// such as agent("x"), by name in `use`, `tools`, `scripts`, or `provider`,
+// by {{include "x"}}, or as the target of a relationship. Entities that only
+// orphans refer to are orphans too.
+func (w *Workspace) FindOrphans(opts ...OrphanOption) []ast.Entity {
+	o := orphanOptions{roots: DefaultOrphanRoots}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	roots := make(map[string]bool, len(o.roots))
+	for _, t := range o.roots {
+		roots[t] = true
+	}
+
+	w.mu.RLock()
+	entities := w.entities.all()
+	relationships := append([]Relationship(nil), w.relationships...)
+	w.mu.RUnlock()
+
+	byKey := make(map[string]ast.Entity, len(entities))
+	for _, e := range entities {
+		byKey[entityKey(e.Type(), e.Name())] = e
+	}
+	related := make(map[string][]string)
+	for _, rel := range relationships {
+		from := entityKey(rel.SourceType, rel.SourceName)
+		related[from] = append(related[from], entityKey(rel.TargetType, rel.TargetName))
+	}
+
+	kept := make(map[string]bool)
+	var queue []string
+	keep := func(key string) {
+		if _, ok := byKey[key]; ok && !kept[key] {
+			kept[key] = true
+			queue = append(queue, key)
+		}
+	}
+	for _, e := range entities {
+		if roots[e.Type()] {
+			keep(entityKey(e.Type(), e.Name()))
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, ref := range entityReferences(byKey[key]) {
+			for _, t := range ref.types {
+				keep(entityKey(t, ref.name))
+			}
+		}
+		for _, target := range related[key] {
+			keep(target)
+		}
+	}
+
+	var orphans []ast.Entity
+	for _, e := range entities {
+		if !kept[entityKey(e.Type(), e.Name())] {
+			orphans = append(orphans, e)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Type() != orphans[j].Type() {
+			return orphans[i].Type() < orphans[j].Type()
+		}
+		return orphans[i].Name() < orphans[j].Name()
+	})
+	return orphans
+}
+
+// PruneOrphans removes the entities FindOrphans returns, along with their
+// relationships, and returns them. Removal runs hooks and emits events as
+// RemoveEntity does; it stops at the first hook that fails.
+func (w *Workspace) PruneOrphans(opts ...OrphanOption) ([]ast.Entity, error) {
+	orphans := w.FindOrphans(opts...)
+	for i, e := range orphans {
+		if err := w.RemoveEntity(e.Type(), e.Name()); err != nil {
+			return orphans[:i], err
+		}
+	}
+	return orphans, nil
+}
+
+// entityRef names an entity that may be of any of several types.
+type entityRef struct {
+	types []string
+	name  string
+}
+
+// entityReferences returns the entities an entity, and the entities nested
+// in it, refer to.
+func entityReferences(e ast.Entity) []entityRef {
+	var refs []entityRef
+	add := func(name string, types ...string) {
+		refs = append(refs, entityRef{types: types, name: name})
+	}
+	collect := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if val.Type != "step" {
+				add(val.Name, checkedTypes(val.Type)...)
+			}
+		case ast.MethodCallValue:
+			// intent("name") { ... } parses as a call with an inline body
+			if obj, ok := val.Object.(ast.StringValue); ok && val.InlineBody != nil {
+				add(val.Method, checkedTypes(obj.Value)...)
+			}
+		case ast.StringValue:
+			for _, m := range promptInclude.FindAllStringSubmatch(val.Value, -1) {
+				add(m[1], "prompt")
+			}
+		}
+		return v
+	}
+
+	var visit func(e ast.Entity)
+	visit = func(e ast.Entity) {
+		// Entity names given as plain strings
+		if sv, ok := e.Properties()["use"].(ast.StringValue); ok {
+			add(sv.Value, "agent")
+		}
+		if e.Type() == "agent" {
+			for _, name := range validator.AgentToolNames(e) {
+				add(name, "tool", "mcp")
+			}
+			if arr, ok := e.Properties()["scripts"].(ast.ArrayValue); ok {
+				for _, elem := range arr.Elements {
+					if sv, ok := elem.(ast.StringValue); ok {
+						add(sv.Value, "script")
+					}
+				}
+			}
+			if sv, ok := e.Properties()["provider"].(ast.StringValue); ok {
+				add(sv.Value, "provider")
+			}
+		}
+		for _, v := range e.Properties() {
+			mapValue(v, collect, visit)
+		}
+		for _, step := range childSteps(e) {
+			visit(step)
+		}
+		if eval, ok := e.(*ast.EvalEntity); ok {
+			for _, c := range eval.Cases {
+				visit(c)
+			}
+		}
+	}
+	visit(e)
+	return refs
+}
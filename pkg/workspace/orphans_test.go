@@ -0,0 +1,117 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+const orphanSource = `tool "search" {
+	command: "rg"
+}
+
+tool "lint" {
+	command: "golangci-lint"
+}
+
+prompt "style" {
+	content: "Be brief."
+}
+
+agent "researcher" {
+	model: "gpt-4o"
+	tools: [search]
+	instruction: "{{include 'style'}}"
+}
+
+agent "linter" {
+	model: "gpt-4o"
+	tools: [lint]
+}
+
+agent "summarizer" {
+	model: "gpt-4o"
+}
+
+agent "critic" {
+	model: "gpt-4o"
+}
+
+file "notes" {
+	path: "notes.md"
+}
+
+pipeline "report" {
+	step "gather" {
+		use: "researcher"
+		input: $input
+	}
+}
+
+trigger "nightly" {
+	event: "nightly"
+	run: intent("digest") {
+		use: agent("summarizer")
+	}
+}
+`
+
+// typedNames returns entities as "type:name".
+func typedNames(entities []ast.Entity) []string {
+	names := make([]string, len(entities))
+	for i, e := range entities {
+		names[i] = e.Type() + ":" + e.Name()
+	}
+	return names
+}
+
+func TestWorkspace_FindOrphans(t *testing.T) {
+	w := workspaceFrom(t, orphanSource)
+	if err := w.AddRelationship("agent", "summarizer", "agent", "critic", RelationTypeDepends); err != nil {
+		t.Fatal(err)
+	}
+
+	got := typedNames(w.FindOrphans())
+	want := []string{"agent:linter", "file:notes", "tool:lint"}
+	if len(got) != len(want) {
+		t.Fatalf("FindOrphans() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("FindOrphans() = %v, want %v", got, want)
+			break
+		}
+	}
+
+	got = typedNames(w.FindOrphans(WithOrphanRoots("agent", "file")))
+	want = []string{"pipeline:report", "trigger:nightly"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("FindOrphans(WithOrphanRoots(agent, file)) = %v, want %v", got, want)
+	}
+}
+
+func TestWorkspace_PruneOrphans(t *testing.T) {
+	w := workspaceFrom(t, orphanSource)
+	if err := w.AddRelationship("agent", "linter", "file", "notes", RelationTypeConsumes); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := w.PruneOrphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 4 {
+		t.Errorf("pruned %v, want the linter, its tool and file, and the critic", typedNames(pruned))
+	}
+	for _, name := range []string{"linter", "critic"} {
+		if _, ok := w.GetEntityByName("agent", name); ok {
+			t.Errorf("expected agent %q to be removed", name)
+		}
+	}
+	if len(w.GetRelationships()) != 0 {
+		t.Errorf("expected the pruned entities' relationships to be removed, got %v", w.GetRelationships())
+	}
+	if orphans := w.FindOrphans(); len(orphans) != 0 {
+		t.Errorf("expected no orphans after pruning, got %v", typedNames(orphans))
+	}
+}
@@ -0,0 +1,131 @@
+package workspace
+
+import (
+	"fmt"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+// ApplyProfile overlays a profile's values on the workspace, so one file can
+// serve several environments:
+//
+//	profile "prod" {
+//		config {
+//			timeout: "10m"
+//		}
+//		agent "reviewer" {
+//			model: "gpt-4o"
+//		}
+//	}
+//
+// Each overlay property replaces the entity's property of the same name;
+// objects are merged key by key, so overriding providers.openai.base_url
+// keeps the other provider settings. Steps of a pipeline overlay apply to the
+// pipeline's steps of the same name. A config overlay becomes the config if
+// the workspace has none. Overlaying an entity the workspace does not define
+// fails with i18n.EntityNotFound, as does applying an unknown profile.
+//
+// Entities are changed in place, so apply the profile when loading the
+// workspace (see Loader.WithProfile), before anything runs.
+func (w *Workspace) ApplyProfile(name string) error {
+	entity, ok := w.GetEntityByName("profile", name)
+	if !ok {
+		return i18n.New(i18n.EntityNotFound, "profile", name)
+	}
+	profile, ok := entity.(*ast.ProfileEntity)
+	if !ok {
+		return fmt.Errorf("profile %q has no overlays", name)
+	}
+
+	for _, overlay := range profile.Overlays {
+		if overlay.Type() == "config" {
+			configs := w.GetEntitiesByType("config")
+			if len(configs) == 0 {
+				if err := w.AddEntity(overlay); err != nil {
+					return fmt.Errorf("profile %q: %w", name, err)
+				}
+				continue
+			}
+			overlayProperties(configs[0], overlay)
+			continue
+		}
+
+		target, ok := w.GetEntityByName(overlay.Type(), overlay.Name())
+		if !ok {
+			return fmt.Errorf("profile %q: %w", name, i18n.New(i18n.EntityNotFound, overlay.Type(), overlay.Name()))
+		}
+		overlayProperties(target, overlay)
+		if err := overlaySteps(target, overlay); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Profiles returns the names of the workspace's profiles.
+func (w *Workspace) Profiles() []string {
+	var names []string
+	for _, e := range w.GetEntitiesByType("profile") {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// overlayProperties sets the overlay's properties on target.
+func overlayProperties(target, overlay ast.Entity) {
+	for key, value := range overlay.Properties() {
+		if base, ok := target.GetProperty(key); ok {
+			value = mergeOverlay(base, value)
+		}
+		target.SetProperty(key, value)
+	}
+}
+
+// mergeOverlay returns overlay, merged key by key into base if both are
+// objects.
+func mergeOverlay(base, overlay ast.Value) ast.Value {
+	baseObj, ok := base.(ast.ObjectValue)
+	if !ok {
+		return overlay
+	}
+	overlayObj, ok := overlay.(ast.ObjectValue)
+	if !ok {
+		return overlay
+	}
+	merged := make(map[string]ast.Value, len(baseObj.Properties)+len(overlayObj.Properties))
+	for k, v := range baseObj.Properties {
+		merged[k] = v
+	}
+	for k, v := range overlayObj.Properties {
+		if b, ok := merged[k]; ok {
+			v = mergeOverlay(b, v)
+		}
+		merged[k] = v
+	}
+	return ast.ObjectValue{Properties: merged}
+}
+
+// overlaySteps applies a pipeline overlay's steps to the target's steps of
+// the same name.
+func overlaySteps(target, overlay ast.Entity) error {
+	overlayPipeline, ok := overlay.(*ast.PipelineEntity)
+	if !ok || len(overlayPipeline.Steps) == 0 {
+		return nil
+	}
+	steps := childSteps(target)
+	for _, o := range overlayPipeline.Steps {
+		var step *ast.StepEntity
+		for _, s := range steps {
+			if s.Name() == o.Name() {
+				step = s
+				break
+			}
+		}
+		if step == nil {
+			return fmt.Errorf("%s %q: %w", target.Type(), target.Name(), i18n.New(i18n.UnknownStep, o.Name()))
+		}
+		overlayProperties(step, o)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+const profileSource = `config {
+	timeout: "5m"
+	providers: {
+		openai: {
+			api_key: env("OPENAI_API_KEY")
+			base_url: "http://localhost:8000/v1"
+		}
+	}
+}
+
+agent "reviewer" {
+	model: "gpt-4o-mini"
+	temperature: 0.2
+}
+
+pipeline "review" {
+	step "check" {
+		use: agent("reviewer")
+	}
+}
+
+profile "prod" {
+	config {
+		timeout: "10m"
+		providers: {
+			openai: {
+				base_url: "https://api.openai.com/v1"
+			}
+		}
+	}
+	agent "reviewer" {
+		model: "gpt-4o"
+	}
+	pipeline "review" {
+		step "check" {
+			timeout: "1m"
+		}
+	}
+}
+
+profile "broken" {
+	agent "writer" {
+		model: "gpt-4o"
+	}
+}
+`
+
+func TestWorkspace_ApplyProfile(t *testing.T) {
+	ws := workspaceFrom(t, profileSource)
+	if err := ws.ApplyProfile("prod"); err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+
+	agent, _ := ws.GetEntityByName("agent", "reviewer")
+	if model, _ := agent.GetProperty("model"); model != (ast.StringValue{Value: "gpt-4o"}) {
+		t.Errorf("model = %v, want the profile's", model)
+	}
+	if temp, _ := agent.GetProperty("temperature"); temp != (ast.NumberValue{Value: 0.2}) {
+		t.Errorf("temperature = %v, want it kept", temp)
+	}
+
+	config := ws.GetEntitiesByType("config")[0]
+	if timeout, _ := config.GetProperty("timeout"); timeout != (ast.StringValue{Value: "10m"}) {
+		t.Errorf("timeout = %v, want 10m", timeout)
+	}
+	providers, _ := config.GetProperty("providers")
+	openai := providers.(ast.ObjectValue).Properties["openai"].(ast.ObjectValue)
+	if url := openai.Properties["base_url"]; url != (ast.StringValue{Value: "https://api.openai.com/v1"}) {
+		t.Errorf("base_url = %v, want the profile's", url)
+	}
+	if _, ok := openai.Properties["api_key"]; !ok {
+		t.Error("expected objects to be merged, keeping api_key")
+	}
+
+	pipeline, _ := ws.GetEntityByName("pipeline", "review")
+	step := pipeline.(*ast.PipelineEntity).Steps[0]
+	if timeout, _ := step.GetProperty("timeout"); timeout != (ast.StringValue{Value: "1m"}) {
+		t.Errorf("step timeout = %v, want 1m", timeout)
+	}
+	if _, ok := step.GetProperty("use"); !ok {
+		t.Error("expected the step's other properties to be kept")
+	}
+}
+
+func TestWorkspace_ApplyProfileErrors(t *testing.T) {
+	ws := workspaceFrom(t, profileSource)
+	if err := ws.ApplyProfile("staging"); i18n.CodeOf(err) != i18n.EntityNotFound {
+		t.Errorf("expected EntityNotFound for an unknown profile, got %v", err)
+	}
+	if err := ws.ApplyProfile("broken"); i18n.CodeOf(err) != i18n.EntityNotFound {
+		t.Errorf("expected EntityNotFound overlaying an undefined agent, got %v", err)
+	}
+}
+
+func TestLoader_WithProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.ls")
+	if err := os.WriteFile(path, []byte(profileSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := New()
+	if err := NewLoader(ws).WithProfile("prod").Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	agent, _ := ws.GetEntityByName("agent", "reviewer")
+	if model, _ := agent.GetProperty("model"); model != (ast.StringValue{Value: "gpt-4o"}) {
+		t.Errorf("model = %v, want the profile applied on load", model)
+	}
+}
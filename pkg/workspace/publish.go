@@ -0,0 +1,264 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
+)
+
+// versionPattern is what a published version may be named: letters, digits,
+// and . _ - after the first character, so a version is also a file name.
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// publishedVersion is a named version of an entity.
+type publishedVersion struct {
+	version string
+	entity  ast.Entity
+}
+
+// PublishVersion records entity as a named version of its type and name,
+// for references pinned with @version, e.g. pipeline("review")@v3. Published
+// versions are immutable: entity must not be changed afterwards, and
+// publishing a version that exists fails.
+func (w *Workspace) PublishVersion(version string, entity ast.Entity) error {
+	if !versionPattern.MatchString(version) {
+		return fmt.Errorf("invalid version %q: use letters, digits, '.', '_' and '-'", version)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.published == nil {
+		w.published = make(map[string][]publishedVersion)
+	}
+	key := entityKey(entity.Type(), entity.Name())
+	for _, pv := range w.published[key] {
+		if pv.version == version {
+			return fmt.Errorf("%s %q version %s is already published", entity.Type(), entity.Name(), version)
+		}
+	}
+	w.published[key] = append(w.published[key], publishedVersion{version: version, entity: entity})
+	return nil
+}
+
+// GetPublishedVersion returns a published version of an entity.
+func (w *Workspace) GetPublishedVersion(entityType, entityName, version string) (ast.Entity, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, pv := range w.published[entityKey(entityType, entityName)] {
+		if pv.version == version {
+			return pv.entity, true
+		}
+	}
+	return nil, false
+}
+
+// PublishedVersions returns the published versions of an entity in the
+// order they were published.
+func (w *Workspace) PublishedVersions(entityType, entityName string) []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var versions []string
+	for _, pv := range w.published[entityKey(entityType, entityName)] {
+		versions = append(versions, pv.version)
+	}
+	return versions
+}
+
+// publishedEntities returns the definitions of every published version.
+func (w *Workspace) publishedEntities() []ast.Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var entities []ast.Entity
+	for _, versions := range w.published {
+		for _, pv := range versions {
+			entities = append(entities, pv.entity)
+		}
+	}
+	return entities
+}
+
+// VersionStore keeps published versions on disk as LangSpace source, one
+// file per version at <dir>/<type>/<name>/<version>.ls, so they outlive
+// edits to the file an entity was published from.
+//
+// Example:
+//
+//	store := workspace.NewVersionStore(".langspace/versions")
+//	store.Publish(source, "pipeline", "review", "v3")
+//	store.LoadInto(ws) // pipeline("review")@v3 now resolves
+type VersionStore struct {
+	dir string
+}
+
+// NewVersionStore returns a store of published versions under dir.
+func NewVersionStore(dir string) *VersionStore {
+	return &VersionStore{dir: dir}
+}
+
+// Publish saves the current definition of an entity in source, the
+// contents of a LangSpace file, as a named version. Publishing a version
+// that exists fails, as does publishing an entity source does not define
+// (with i18n.EntityNotFound).
+func (s *VersionStore) Publish(source, entityType, entityName, version string) error {
+	if !versionPattern.MatchString(version) {
+		return fmt.Errorf("invalid version %q: use letters, digits, '.', '_' and '-'", version)
+	}
+	entities, _, err := parser.New(source).Parse()
+	if err != nil {
+		return err
+	}
+	var entity ast.Entity
+	for _, e := range entities {
+		if e.Type() == entityType && e.Name() == entityName {
+			entity = e
+			break
+		}
+	}
+	if entity == nil {
+		return i18n.New(i18n.EntityNotFound, entityType, entityName)
+	}
+	text, err := EntitySource(source, entity)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(entityType, entityName, version)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s %q version %s is already published", entityType, entityName, version)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadInto publishes every version in the store to ws. A store whose
+// directory does not exist is empty.
+func (s *VersionStore) LoadInto(ws *Workspace) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*", "*", "*.ls"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := publishFile(ws, filepath.ToSlash(path), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishFile publishes the version in the contents of a file at
+// .../<type>/<name>/<version>.ls, a slash-separated path, to ws.
+func publishFile(ws *Workspace, file string, content []byte) error {
+	version, entity, err := parseVersionFile(file, content)
+	if err != nil {
+		return err
+	}
+	return ws.PublishVersion(version, entity)
+}
+
+// parseVersionFile returns the version a file of a version store is named
+// for and the entity it defines.
+func parseVersionFile(file string, content []byte) (string, ast.Entity, error) {
+	dir, base := path.Split(file)
+	dir, name := path.Split(strings.TrimSuffix(dir, "/"))
+	entityType := path.Base(dir)
+	version := strings.TrimSuffix(base, ".ls")
+
+	entities, _, err := parser.New(string(content)).Parse()
+	if err != nil {
+		return "", nil, fmt.Errorf("parse error in %s: %w", file, err)
+	}
+	if len(entities) != 1 || entities[0].Type() != entityType || entities[0].Name() != name {
+		return "", nil, fmt.Errorf("%s must define exactly %s %q", file, entityType, name)
+	}
+	return version, entities[0], nil
+}
+
+// Versions returns the versions published for an entity, sorted by name.
+func (s *VersionStore) Versions(entityType, entityName string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, entityType, entityName, "*.ls"))
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, len(paths))
+	for i, path := range paths {
+		versions[i] = strings.TrimSuffix(filepath.Base(path), ".ls")
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+func (s *VersionStore) path(entityType, entityName, version string) string {
+	return filepath.Join(s.dir, entityType, entityName, version+".ls")
+}
+
+// EntitySource returns the text of a top-level entity parsed from source,
+// from its type keyword to its closing brace.
+func EntitySource(source string, entity ast.Entity) (string, error) {
+	tokens := tokenizer.New().Tokenize(source)
+
+	start := -1
+	for i, tok := range tokens {
+		if tok.Line == entity.Line() && tok.Column == entity.Column() {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return "", fmt.Errorf("%s %q: no source at line %d, col %d", entity.Type(), entity.Name(), entity.Line(), entity.Column())
+	}
+
+	depth := 0
+	for _, tok := range tokens[start:] {
+		switch tok.Type {
+		case tokenizer.TokenTypeLeftBrace:
+			depth++
+		case tokenizer.TokenTypeRightBrace:
+			depth--
+			if depth == 0 {
+				from := offset(source, tokens[start].Line, tokens[start].Column)
+				to := offset(source, tok.Line, tok.Column) + 1
+				return source[from:to], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s %q: unclosed block", entity.Type(), entity.Name())
+}
+
+// offset converts a 1-based line and column to a byte offset in source.
+func offset(source string, line, column int) int {
+	pos := 0
+	for l := 1; l < line; l++ {
+		next := strings.IndexByte(source[pos:], '\n')
+		if next < 0 {
+			return len(source)
+		}
+		pos += next + 1
+	}
+	return pos + column - 1
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
+)
+
+const publishSource = `agent "writer" {
+	model: "gpt-4o"
+}
+
+# Reviews a change
+pipeline "review" {
+	step "read" {
+		use: agent("writer")
+		input: "Check {braces} in strings"
+	}
+}
+`
+
+func TestWorkspace_PublishVersion(t *testing.T) {
+	ws := New()
+	v1 := ast.NewPipelineEntity("review")
+	if err := ws.PublishVersion("v1", v1); err != nil {
+		t.Fatalf("PublishVersion failed: %v", err)
+	}
+	if err := ws.PublishVersion("v2", ast.NewPipelineEntity("review")); err != nil {
+		t.Fatalf("PublishVersion failed: %v", err)
+	}
+
+	if got, ok := ws.GetPublishedVersion("pipeline", "review", "v1"); !ok || got != v1 {
+		t.Errorf("GetPublishedVersion(v1) = %v, %v", got, ok)
+	}
+	if _, ok := ws.GetPublishedVersion("pipeline", "review", "v3"); ok {
+		t.Error("expected no unpublished version")
+	}
+	if got := ws.PublishedVersions("pipeline", "review"); strings.Join(got, ",") != "v1,v2" {
+		t.Errorf("PublishedVersions = %v, want [v1 v2]", got)
+	}
+
+	if err := ws.PublishVersion("v1", ast.NewPipelineEntity("review")); err == nil {
+		t.Error("expected published versions to be immutable")
+	}
+	if err := ws.PublishVersion("../v4", ast.NewPipelineEntity("review")); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestVersionStore(t *testing.T) {
+	store := NewVersionStore(t.TempDir())
+	if err := store.Publish(publishSource, "pipeline", "review", "v1"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := store.Publish(publishSource, "pipeline", "review", "v1"); err == nil || !strings.Contains(err.Error(), "already published") {
+		t.Errorf("expected an error publishing v1 again, got %v", err)
+	}
+	if err := store.Publish(publishSource, "pipeline", "missing", "v1"); i18n.CodeOf(err) != i18n.EntityNotFound {
+		t.Errorf("expected EntityNotFound, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(store.dir, "pipeline", "review", "v1.ls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `pipeline "review" {`) || !strings.HasSuffix(string(data), "\t}\n}\n") || strings.Contains(string(data), "agent \"writer\" {") {
+		t.Errorf("expected only the pipeline's source, got:\n%s", data)
+	}
+
+	ws := New()
+	if err := store.LoadInto(ws); err != nil {
+		t.Fatalf("LoadInto failed: %v", err)
+	}
+	published, ok := ws.GetPublishedVersion("pipeline", "review", "v1")
+	if !ok {
+		t.Fatal("expected v1 to be published")
+	}
+	if p := published.(*ast.PipelineEntity); len(p.Steps) != 1 || p.Steps[0].Name() != "read" {
+		t.Errorf("expected the published steps, got %+v", p.Steps)
+	}
+	if versions, _ := store.Versions("pipeline", "review"); len(versions) != 1 || versions[0] != "v1" {
+		t.Errorf("Versions = %v, want [v1]", versions)
+	}
+	if err := NewVersionStore(filepath.Join(t.TempDir(), "none")).LoadInto(New()); err != nil {
+		t.Errorf("expected a missing store to be empty, got %v", err)
+	}
+}
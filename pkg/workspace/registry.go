@@ -0,0 +1,405 @@
+package workspace
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrPackageNotFound is returned for a package a registry has no index for.
+var ErrPackageNotFound = errors.New("package not found")
+
+// maxRegistryResponse is the most a registry response may hold, which
+// bounds what a misbehaving registry can make a client read into memory.
+const maxRegistryResponse = 64 << 20
+
+// packageNamePattern is what a registry package may be named: an
+// organization and a name, e.g. "acme/review".
+var packageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*/[a-z0-9][a-z0-9._-]*$`)
+
+// PackageIndex lists the published versions of a registry package.
+type PackageIndex struct {
+	Name     string           `json:"name"`
+	Versions []PackageVersion `json:"versions"`
+}
+
+// PackageVersion is a published version of a registry package: a bundle
+// written by Package, addressed by the SHA-256 digest of its content.
+type PackageVersion struct {
+	Version   string    `json:"version"`
+	Digest    string    `json:"digest"` // "sha256:<hex>"
+	Size      int64     `json:"size"`
+	Published time.Time `json:"published"`
+}
+
+// RegistryClient publishes bundles to and installs them from a package
+// registry, so teams can share agents, tools, and workflows like libraries.
+// A registry is an HTTP server that serves, and for publishing accepts PUT
+// requests for:
+//
+//	<url>/<org>/<name>/index.json  the PackageIndex of a package
+//	<url>/blobs/sha256/<hex>       bundles, by the digest of their content
+//
+// so a static file server works as a read-only registry.
+type RegistryClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// RegistryOption is a functional option for configuring RegistryClient.
+type RegistryOption func(*RegistryClient)
+
+// WithRegistryToken sends token as a bearer token with every request.
+func WithRegistryToken(token string) RegistryOption {
+	return func(c *RegistryClient) {
+		c.token = token
+	}
+}
+
+// WithRegistryHTTPClient sets a custom HTTP client.
+func WithRegistryHTTPClient(client *http.Client) RegistryOption {
+	return func(c *RegistryClient) {
+		c.httpClient = client
+	}
+}
+
+// NewRegistryClient creates a client of the registry at url.
+func NewRegistryClient(url string, opts ...RegistryOption) *RegistryClient {
+	c := &RegistryClient{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: time.Minute},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ParsePackageRef splits a package reference, "acme/review@^1.2.0", into
+// the package name and the version constraint, which is empty without an
+// @. Constraints are exact versions, 1 or 1.2 for any release starting
+// with them, ^1.2.0 for compatible releases, ~1.2.0 for patch releases, and
+// latest.
+func ParsePackageRef(ref string) (name, constraint string, err error) {
+	name, constraint, _ = strings.Cut(ref, "@")
+	if !packageNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid package %q: expected org/name in lowercase, e.g. acme/review", name)
+	}
+	if _, err := parseVersionConstraint(constraint); err != nil {
+		return "", "", err
+	}
+	return name, constraint, nil
+}
+
+// Index returns the index of a package, or an error wrapping
+// ErrPackageNotFound if it has none.
+func (c *RegistryClient) Index(ctx context.Context, name string) (*PackageIndex, error) {
+	if !packageNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid package %q: expected org/name in lowercase, e.g. acme/review", name)
+	}
+	data, err := c.do(ctx, http.MethodGet, name+"/index.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	var index PackageIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parsing index of %s: %w", name, err)
+	}
+	return &index, nil
+}
+
+// Publish uploads a bundle as a version of a package, which must be a
+// semantic version such as 1.2.0 that is not yet published.
+func (c *RegistryClient) Publish(ctx context.Context, name, version string, bundle []byte) (PackageVersion, error) {
+	if _, err := parseSemver(version); err != nil {
+		return PackageVersion{}, err
+	}
+	if _, err := readBundleBytes(name+"@"+version, bundle); err != nil {
+		return PackageVersion{}, err
+	}
+	index, err := c.Index(ctx, name)
+	if errors.Is(err, ErrPackageNotFound) {
+		index, err = &PackageIndex{Name: name}, nil
+	}
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	for _, v := range index.Versions {
+		if v.Version == version {
+			return PackageVersion{}, fmt.Errorf("%s@%s is already published", name, version)
+		}
+	}
+
+	sum := sha256.Sum256(bundle)
+	pv := PackageVersion{
+		Version:   version,
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Size:      int64(len(bundle)),
+		Published: time.Now().UTC(),
+	}
+	if _, err := c.do(ctx, http.MethodPut, blobPath(pv.Digest), bundle); err != nil {
+		return PackageVersion{}, err
+	}
+
+	// The blob is in place before the index names it
+	index.Versions = append(index.Versions, pv)
+	sortPackageVersions(index.Versions)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	if _, err := c.do(ctx, http.MethodPut, name+"/index.json", append(data, '\n')); err != nil {
+		return PackageVersion{}, err
+	}
+	return pv, nil
+}
+
+// Resolve returns the highest published version of a package that
+// satisfies constraint (see ParsePackageRef).
+func (c *RegistryClient) Resolve(ctx context.Context, name, constraint string) (PackageVersion, error) {
+	vc, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	index, err := c.Index(ctx, name)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	var best PackageVersion
+	var bestVersion semver
+	for _, pv := range index.Versions {
+		v, err := parseSemver(pv.Version)
+		if err != nil || !vc.matches(v) {
+			continue
+		}
+		if best.Version == "" || v.compare(bestVersion) > 0 {
+			best, bestVersion = pv, v
+		}
+	}
+	if best.Version == "" {
+		if constraint == "" {
+			constraint = "latest"
+		}
+		return PackageVersion{}, fmt.Errorf("no published version of %s matches %s", name, constraint)
+	}
+	return best, nil
+}
+
+// Download returns the bundle of a published version, checking that its
+// content has the size and digest the index lists.
+func (c *RegistryClient) Download(ctx context.Context, name string, pv PackageVersion) ([]byte, error) {
+	if !strings.HasPrefix(pv.Digest, "sha256:") {
+		return nil, fmt.Errorf("%s@%s has unsupported digest %q", name, pv.Version, pv.Digest)
+	}
+	data, err := c.do(ctx, http.MethodGet, blobPath(pv.Digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if digest := "sha256:" + hex.EncodeToString(sum[:]); digest != pv.Digest || int64(len(data)) != pv.Size {
+		return nil, fmt.Errorf("integrity check failed for %s@%s: got %d bytes with digest %s, want %d bytes with digest %s", name, pv.Version, len(data), digest, pv.Size, pv.Digest)
+	}
+	return data, nil
+}
+
+// Install resolves a package reference (see ParsePackageRef), downloads the
+// bundle, checks that this build can load it, and saves it to
+// <dir>/<org>/<name>.lsbundle, where files import it, e.g.
+// `import ".langspace/packages/acme/review.lsbundle" as review`.
+// The version and digest are recorded in the lock file in dir; installing
+// a locked version again fails if the registry's copy has a different
+// digest.
+func (c *RegistryClient) Install(ctx context.Context, dir, ref string) (PackageVersion, error) {
+	name, constraint, err := ParsePackageRef(ref)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	pv, err := c.Resolve(ctx, name, constraint)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	lock, err := ReadPackageLock(dir)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	if locked, ok := lock.Packages[name]; ok && locked.Version == pv.Version && locked.Digest != pv.Digest {
+		return PackageVersion{}, fmt.Errorf("integrity check failed for %s@%s: locked with digest %s, but the registry has %s", name, pv.Version, locked.Digest, pv.Digest)
+	}
+
+	data, err := c.Download(ctx, name, pv)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	m, err := readBundleBytes(name+"@"+pv.Version, data)
+	if err != nil {
+		return PackageVersion{}, err
+	}
+	if err := checkRequirements(name+"@"+pv.Version, m.Requires); err != nil {
+		return PackageVersion{}, err
+	}
+	if err := writeFileAtomic(PackagePath(dir, name), data); err != nil {
+		return PackageVersion{}, err
+	}
+
+	lock.Packages[name] = LockedPackage{Version: pv.Version, Digest: pv.Digest}
+	return pv, lock.write(dir)
+}
+
+// do sends a request to the registry and returns the response body.
+func (c *RegistryClient) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if strings.HasSuffix(path, ".json") {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRegistryResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading registry response: %w", err)
+	}
+	if len(data) > maxRegistryResponse {
+		return nil, fmt.Errorf("registry %s %s: response exceeds %d bytes", method, path, maxRegistryResponse)
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet && strings.HasSuffix(path, "/index.json") {
+		return nil, fmt.Errorf("%s: %w", strings.TrimSuffix(path, "/index.json"), ErrPackageNotFound)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("registry %s %s: %s", method, path, resp.Status)
+	}
+	return data, nil
+}
+
+func blobPath(digest string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:")
+}
+
+// sortPackageVersions sorts versions by semantic version precedence.
+func sortPackageVersions(versions []PackageVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, errA := parseSemver(versions[i].Version)
+		b, errB := parseSemver(versions[j].Version)
+		if errA != nil || errB != nil {
+			return errA == nil
+		}
+		return a.compare(b) < 0
+	})
+}
+
+// readBundleBytes returns the manifest of the content of a bundle, or an
+// error if it is not a bundle.
+func readBundleBytes(name string, data []byte) (*BundleManifest, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a bundle: %w", name, err)
+	}
+	return readManifest(zr, name)
+}
+
+// packageLockFile is the name of the lock file in a packages directory.
+const packageLockFile = "lock.json"
+
+// PackageLock records the packages installed in a directory.
+type PackageLock struct {
+	Packages map[string]LockedPackage `json:"packages"`
+}
+
+// LockedPackage is the version of an installed package and the digest of
+// its bundle.
+type LockedPackage struct {
+	Version string `json:"version"`
+	Digest  string `json:"digest"`
+}
+
+// PackagePath returns where Install saves a package in dir.
+func PackagePath(dir, name string) string {
+	return filepath.Join(dir, filepath.FromSlash(name)+BundleExtension)
+}
+
+// ReadPackageLock returns the lock file of a packages directory, which is
+// empty if it does not exist.
+func ReadPackageLock(dir string) (*PackageLock, error) {
+	lock := &PackageLock{Packages: make(map[string]LockedPackage)}
+	data, err := os.ReadFile(filepath.Join(dir, packageLockFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Join(dir, packageLockFile), err)
+	}
+	if lock.Packages == nil {
+		lock.Packages = make(map[string]LockedPackage)
+	}
+	return lock, nil
+}
+
+func (l *PackageLock) write(dir string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, packageLockFile), append(data, '\n'))
+}
+
+// writeFileAtomic writes a file by renaming a temporary file over it, so
+// readers never see it half written.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// testRegistry is an in-memory registry that serves and accepts PUT
+// requests for any path.
+type testRegistry struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	auth  string
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, *httptest.Server) {
+	reg := &testRegistry{files: make(map[string][]byte)}
+	server := httptest.NewServer(reg)
+	t.Cleanup(server.Close)
+	return reg, server
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := reg.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodPut:
+		reg.auth = r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		reg.files[r.URL.Path] = data
+	}
+}
+
+func testBundle(t *testing.T, source string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Package(&buf, writeTestFile(t, t.TempDir(), "main.ls", source)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRegistryClient_PublishInstall(t *testing.T) {
+	reg, server := newTestRegistry(t)
+	client := NewRegistryClient(server.URL+"/", WithRegistryToken("secret"))
+	ctx := context.Background()
+
+	for _, version := range []string{"1.2.0", "1.10.1", "2.0.0-rc.1", "1.2.3"} {
+		bundle := testBundle(t, `agent "reviewer" { instruction: "v`+version+`" }`)
+		if _, err := client.Publish(ctx, "acme/review", version, bundle); err != nil {
+			t.Fatalf("Publish(%s) error = %v", version, err)
+		}
+	}
+	if reg.auth != "Bearer secret" {
+		t.Errorf("expected the token to be sent, got %q", reg.auth)
+	}
+	if _, err := client.Publish(ctx, "acme/review", "1.2.0", testBundle(t, `agent "a" {}`)); err == nil || !strings.Contains(err.Error(), "already published") {
+		t.Errorf("expected republishing to fail, got %v", err)
+	}
+
+	index, err := client.Index(ctx, "acme/review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, v := range index.Versions {
+		versions = append(versions, v.Version)
+	}
+	if got := strings.Join(versions, " "); got != "1.2.0 1.2.3 1.10.1 2.0.0-rc.1" {
+		t.Errorf("index versions = %s, want them in semver order", got)
+	}
+
+	dir := t.TempDir()
+	pv, err := client.Install(ctx, dir, "acme/review@~1.2.0")
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if pv.Version != "1.2.3" {
+		t.Errorf("installed %s, want 1.2.3", pv.Version)
+	}
+	lock, err := ReadPackageLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked := lock.Packages["acme/review"]; locked.Version != "1.2.3" || locked.Digest != pv.Digest {
+		t.Errorf("lock = %+v, want 1.2.3 with digest %s", locked, pv.Digest)
+	}
+
+	// Installed packages are imported like files
+	main := writeTestFile(t, dir, "main.ls", `import "acme/review.lsbundle" as review
+
+intent "check" {
+	use: review.reviewer
+}`)
+	ws := New()
+	if err := NewLoader(ws).Load(main); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	agent, ok := ws.GetEntityByName("agent", "review.reviewer")
+	if !ok {
+		t.Fatal("expected the package's agent in its namespace")
+	}
+	if v, _ := agent.GetProperty("instruction"); v != (ast.StringValue{Value: "v1.2.3"}) {
+		t.Errorf("expected the installed version's agent, got instruction %v", v)
+	}
+
+	// A registry copy that no longer matches the lock is rejected
+	for path, data := range reg.files {
+		if strings.HasPrefix(path, "/acme/review/index.json") {
+			reg.files[path] = bytes.Replace(data, []byte(strings.TrimPrefix(pv.Digest, "sha256:")), []byte(strings.Repeat("0", 64)), 1)
+		}
+	}
+	if _, err := client.Install(ctx, dir, "acme/review@1.2.3"); err == nil || !strings.Contains(err.Error(), "locked with digest") {
+		t.Errorf("expected a lock mismatch, got %v", err)
+	}
+}
+
+func TestRegistryClient_Download(t *testing.T) {
+	reg, server := newTestRegistry(t)
+	client := NewRegistryClient(server.URL)
+	ctx := context.Background()
+
+	pv, err := client.Publish(ctx, "acme/review", "1.0.0", testBundle(t, `agent "reviewer" {}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := "/blobs/sha256/" + strings.TrimPrefix(pv.Digest, "sha256:")
+	reg.files[blob] = append(reg.files[blob], 0)
+	if _, err := client.Download(ctx, "acme/review", pv); err == nil || !strings.Contains(err.Error(), "integrity check failed") {
+		t.Errorf("expected a tampered blob to be rejected, got %v", err)
+	}
+
+	if _, err := client.Index(ctx, "acme/missing"); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("Index() error = %v, want ErrPackageNotFound", err)
+	}
+	if _, err := client.Publish(ctx, "acme/review", "1.1.0", []byte("not a zip")); err == nil || !strings.Contains(err.Error(), "not a bundle") {
+		t.Errorf("expected a non-bundle to be rejected, got %v", err)
+	}
+
+	// A registry that sends more than a client will read is cut off
+	endless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.CopyN(w, zeros{}, maxRegistryResponse+1)
+	}))
+	t.Cleanup(endless.Close)
+	if _, err := NewRegistryClient(endless.URL).Download(ctx, "acme/review", pv); err == nil || !strings.Contains(err.Error(), "response exceeds") {
+		t.Errorf("expected an oversized response to be rejected, got %v", err)
+	}
+}
+
+// zeros reads as an endless run of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestRegistryClient_Resolve(t *testing.T) {
+	reg, server := newTestRegistry(t)
+	reg.files["/acme/review/index.json"] = []byte(`{"name": "acme/review", "versions": [
+		{"version": "0.2.1"}, {"version": "0.3.0"}, {"version": "1.2.0"}, {"version": "1.2.5"},
+		{"version": "1.9.0"}, {"version": "2.0.0"}, {"version": "3.0.0-beta.2"}, {"version": "3.0.0-beta.10"}
+	]}`)
+	client := NewRegistryClient(server.URL)
+
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"", "2.0.0"},
+		{"latest", "2.0.0"},
+		{"1.2.0", "1.2.0"},
+		{"1", "1.9.0"},
+		{"1.2", "1.2.5"},
+		{"^1.2.0", "1.9.0"},
+		{"~1.2.0", "1.2.5"},
+		{"^0.2.0", "0.2.1"},
+		{"3.0.0-beta.2", "3.0.0-beta.2"},
+		{"^2.1.0", ""},
+	}
+	for _, tt := range tests {
+		pv, err := client.Resolve(context.Background(), "acme/review", tt.constraint)
+		if tt.want == "" {
+			if err == nil || !strings.Contains(err.Error(), "no published version") {
+				t.Errorf("Resolve(%q) = %s, %v; want no match", tt.constraint, pv.Version, err)
+			}
+			continue
+		}
+		if err != nil || pv.Version != tt.want {
+			t.Errorf("Resolve(%q) = %s, %v; want %s", tt.constraint, pv.Version, err, tt.want)
+		}
+	}
+
+	for _, ref := range []string{"review", "Acme/review", "acme/review@v1.2.0", "acme/review@1.02.0", "acme/review@^1"} {
+		if _, _, err := ParsePackageRef(ref); err == nil {
+			t.Errorf("ParsePackageRef(%q) should fail", ref)
+		}
+	}
+}
+
+func TestPackage_ImportedBundle(t *testing.T) {
+	dir := t.TempDir()
+	store := NewVersionStore(filepath.Join(dir, "versions"))
+	if err := store.Publish(publishSource, "pipeline", "review", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := Package(&buf, writeTestFile(t, dir, "lib/main.ls", publishSource+`
+trigger "nightly" {
+	run: pipeline("review")@v1
+}`), WithBundleVersions(store)); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "deps/review"+BundleExtension, buf.String())
+
+	// The app packages the bundle it imports, without a version store
+	app := writeTestFile(t, dir, "app.ls", `import "deps/review.lsbundle" as review
+
+intent "check" {
+	use: review.writer
+}`)
+	buf.Reset()
+	m, err := Package(&buf, app)
+	if err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+	if len(m.Files) != 2 || m.Files[1] != "deps/review.lsbundle" {
+		t.Errorf("Files = %v, want the app and the imported bundle", m.Files)
+	}
+
+	bundle := filepath.Join(t.TempDir(), "app"+BundleExtension)
+	if err := os.WriteFile(bundle, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws := New()
+	if err := NewLoader(ws).Load(bundle); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok := ws.GetEntityByName("trigger", "review.nightly"); !ok {
+		t.Error("expected the nested bundle's trigger in its namespace")
+	}
+	if _, ok := ws.GetPublishedVersion("pipeline", "review.review", "v1"); !ok {
+		t.Error("expected the nested bundle's version published in its namespace")
+	}
+}
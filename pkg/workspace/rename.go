@@ -0,0 +1,430 @@
+package workspace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/tokenizer"
+)
+
+// RenameEntity renames an entity and rewrites everything that refers to it:
+// relationships, references such as agent("old") or step("old").output,
+// names given as plain strings (an agent in `use`, a tool or MCP server in
+// `tools`), and {{step.old...}} interpolations.
+//
+// Steps are not workspace entities; renaming a "step" renames it in every
+// pipeline that has a step by that name, along with that pipeline's
+// references to it.
+//
+// The renamed entity is reported as removed under its old name and added
+// under its new one; every other entity that changed is reported as updated.
+func (w *Workspace) RenameEntity(entityType, oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("new name must not be empty")
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if entityType == "step" {
+		return w.renameStep(oldName, newName)
+	}
+
+	slot := w.entities.lookup(entityType, oldName)
+	if slot == nil {
+		return fmt.Errorf("entity not found: %s %q", entityType, oldName)
+	}
+	entity := slot.entity
+	if _, exists := w.entities.get(entityType, newName); exists && !w.config.AllowDuplicateNames {
+		return fmt.Errorf("entity %s/%s already exists", entityType, newName)
+	}
+	r, ok := entity.(renamer)
+	if !ok {
+		return fmt.Errorf("entity %s %q cannot be renamed", entityType, oldName)
+	}
+
+	// Rewrite references everywhere, including in the entity itself
+	var updated []ast.Entity
+	for _, e := range w.entities.all() {
+		if renameReferences(e, entityType, oldName, newName) && e != entity {
+			updated = append(updated, e)
+		}
+	}
+
+	r.SetName(newName)
+	w.entities.renamed(slot, oldName)
+	for i, rel := range w.relationships {
+		if rel.SourceType == entityType && rel.SourceName == oldName {
+			w.relationships[i].SourceName = newName
+		}
+		if rel.TargetType == entityType && rel.TargetName == oldName {
+			w.relationships[i].TargetName = newName
+		}
+	}
+
+	// Carry the version history over to the new name
+	if w.versioningEnabled {
+		oldKey, newKey := entityKey(entityType, oldName), entityKey(entityType, newName)
+		w.entityVersions[newKey] = append(w.entityVersions[oldKey], w.entityVersions[newKey]...)
+		delete(w.entityVersions, oldKey)
+	}
+	w.recordVersion(entity)
+
+	w.emit(Event{Type: EventEntityRemoved, Entity: placeholderEntity(entityType, oldName)})
+	w.emit(Event{Type: EventEntityAdded, Entity: entity})
+	for _, e := range updated {
+		w.recordVersion(e)
+		w.emit(Event{Type: EventEntityUpdated, Entity: e})
+	}
+	return nil
+}
+
+// renameStep renames the steps called oldName in every pipeline. Must be
+// called with lock held.
+func (w *Workspace) renameStep(oldName, newName string) error {
+	var pipelines []ast.Entity
+	for _, e := range w.entities.all() {
+		names := stepNames(e)
+		if names[newName] && names[oldName] {
+			return fmt.Errorf("%s %q already has a step %q", e.Type(), e.Name(), newName)
+		}
+		if names[oldName] {
+			pipelines = append(pipelines, e)
+		}
+	}
+	if len(pipelines) == 0 {
+		return fmt.Errorf("entity not found: step %q", oldName)
+	}
+
+	for _, e := range pipelines {
+		renameReferences(e, "step", oldName, newName)
+		w.recordVersion(e)
+		w.emit(Event{Type: EventEntityUpdated, Entity: e})
+	}
+	return nil
+}
+
+// placeholderEntity returns an empty entity standing in for one that no
+// longer exists under the given name.
+func placeholderEntity(entityType, name string) ast.Entity {
+	if e, err := ast.NewEntity(entityType, name); err == nil {
+		return e
+	}
+	return ast.NewOpaqueEntity(entityType, name)
+}
+
+// stepNames returns the names of all steps in an entity, including steps in
+// parallel blocks and branches.
+func stepNames(e ast.Entity) map[string]bool {
+	names := make(map[string]bool)
+	var visit func(e ast.Entity)
+	visit = func(e ast.Entity) {
+		if e.Type() == "step" {
+			names[e.Name()] = true
+		}
+		for _, v := range e.Properties() {
+			mapValue(v, func(v ast.Value) ast.Value { return v }, visit)
+		}
+		for _, step := range childSteps(e) {
+			visit(step)
+		}
+	}
+	visit(e)
+	return names
+}
+
+// renameReferences rewrites the references in an entity, and the entities
+// nested in it, to the entity of the given type called oldName. For steps,
+// the steps themselves are renamed too. It reports whether anything changed.
+func renameReferences(e ast.Entity, entityType, oldName, newName string) bool {
+	changed := false
+	rename := func(v ast.Value) ast.Value {
+		switch val := v.(type) {
+		case ast.ReferenceValue:
+			if val.Type == entityType && val.Name == oldName {
+				val.Name = newName
+				changed = true
+			}
+			return val
+		case ast.StringValue:
+			if entityType == "step" {
+				if s := renameInterpolations(val.Value, oldName, newName); s != val.Value {
+					changed = true
+					return ast.StringValue{Value: s}
+				}
+			}
+		}
+		return v
+	}
+
+	var visit func(e ast.Entity)
+	visit = func(e ast.Entity) {
+		if entityType == "step" && e.Type() == "step" && e.Name() == oldName {
+			if r, ok := e.(renamer); ok {
+				r.SetName(newName)
+				changed = true
+			}
+		}
+		for key, v := range e.Properties() {
+			// Entity names given as plain strings
+			switch {
+			case key == "use" && entityType == "agent":
+				if sv, ok := v.(ast.StringValue); ok && sv.Value == oldName {
+					changed = true
+					v = ast.StringValue{Value: newName}
+				}
+			case key == "tools" && (entityType == "tool" || entityType == "mcp"):
+				if arr, ok := v.(ast.ArrayValue); ok {
+					elems := make([]ast.Value, len(arr.Elements))
+					for i, elem := range arr.Elements {
+						elems[i] = elem
+						if sv, ok := elem.(ast.StringValue); ok && sv.Value == oldName {
+							elems[i] = ast.StringValue{Value: newName}
+							changed = true
+						}
+					}
+					v = ast.ArrayValue{Elements: elems}
+				}
+			}
+			e.SetProperty(key, mapValue(v, rename, visit))
+		}
+		for _, step := range childSteps(e) {
+			visit(step)
+		}
+	}
+	visit(e)
+	return changed
+}
+
+// childSteps returns the steps of a pipeline or parallel block.
+func childSteps(e ast.Entity) []*ast.StepEntity {
+	switch ent := e.(type) {
+	case *ast.PipelineEntity:
+		return ent.Steps
+	case *ast.ParallelEntity:
+		return ent.Steps
+	}
+	return nil
+}
+
+// renameInterpolations renames step.oldName in the {{...}} interpolations of
+// a string.
+func renameInterpolations(s, oldName, newName string) string {
+	offsets := interpolationOffsets(s, oldName)
+	for i := len(offsets) - 1; i >= 0; i-- {
+		s = s[:offsets[i]] + newName + s[offsets[i]+len(oldName):]
+	}
+	return s
+}
+
+// interpolationOffsets returns the offsets of the step name in each
+// step.name reference inside the {{...}} interpolations of s.
+func interpolationOffsets(s, name string) []int {
+	var offsets []int
+	ref := "step." + name
+	for pos := 0; ; {
+		start := strings.Index(s[pos:], "{{")
+		if start == -1 {
+			break
+		}
+		start += pos
+		end := strings.Index(s[start:], "}}")
+		if end == -1 {
+			break
+		}
+		end += start
+
+		for i := start; ; {
+			j := strings.Index(s[i:end], ref)
+			if j == -1 {
+				break
+			}
+			j += i
+			before, after := j+len(ref), j
+			if (after == 0 || !isNameChar(s[after-1])) && (before == len(s) || !isNameChar(s[before])) {
+				offsets = append(offsets, j+len("step."))
+			}
+			i = j + len(ref)
+		}
+		pos = end + 2
+	}
+	return offsets
+}
+
+// isNameChar reports whether c can be part of an identifier.
+func isNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+// TextEdit replaces the text at a position in a source file.
+type TextEdit struct {
+	// Line and Column are 1-based; Column counts bytes
+	Line   int
+	Column int
+
+	// Offset is the byte offset of the replaced text
+	Offset int
+
+	OldText string
+	NewText string
+
+	// InComment is true for a mention of the name in a doc comment rather
+	// than a use of the entity
+	InComment bool
+}
+
+// RenameEdits returns the edits that rename an entity in LangSpace source,
+// matching RenameEntity: its declaration, references such as
+// agent("old"), names given as plain strings, and, for steps,
+// {{step.old...}} interpolations. Mentions of the name in the doc comments
+// of its declarations are renamed too, so they do not go stale; other
+// comments and formatting are left as they are. Edits are sorted by offset.
+func RenameEdits(source, entityType, oldName, newName string) []TextEdit {
+	tokens := tokenizer.New().Tokenize(source)
+	lineStarts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	// offset returns the byte offset of a token's first character
+	offset := func(tok tokenizer.Token) int {
+		line := tok.Line
+		if tok.Type == tokenizer.TokenTypeString {
+			// Strings report the line they end on
+			line -= strings.Count(tok.Value, "\n")
+		}
+		if line < 1 || line > len(lineStarts) {
+			return -1
+		}
+		return lineStarts[line-1] + tok.Column - 1
+	}
+
+	var edits []TextEdit
+	inComment := false
+	add := func(off int) {
+		if off < 0 || off+len(oldName) > len(source) || source[off:off+len(oldName)] != oldName {
+			return
+		}
+		line := sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > off })
+		edits = append(edits, TextEdit{
+			Line:      line,
+			Column:    off - lineStarts[line-1] + 1,
+			Offset:    off,
+			OldText:   oldName,
+			NewText:   newName,
+			InComment: inComment,
+		})
+	}
+	// name adds an edit for a token naming the entity
+	name := func(tok tokenizer.Token) {
+		switch {
+		case tok.Type == tokenizer.TokenTypeString && tok.Value == oldName:
+			add(offset(tok) + 1)
+		case tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == oldName:
+			add(offset(tok))
+		}
+	}
+
+	var code []tokenizer.Token
+	for _, tok := range tokens {
+		if tok.Type != tokenizer.TokenTypeComment {
+			code = append(code, tok)
+		}
+	}
+	at := func(i int, t tokenizer.TokenType) bool {
+		return i < len(code) && code[i].Type == t
+	}
+
+	for i, tok := range code {
+		switch {
+		// Declarations (agent "old" { ... }) and references (agent("old"))
+		case tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == entityType:
+			if at(i+1, tokenizer.TokenTypeString) {
+				name(code[i+1])
+			} else if at(i+1, tokenizer.TokenTypeLeftParen) && at(i+2, tokenizer.TokenTypeString) {
+				name(code[i+2])
+			}
+
+		// Agents named in `use`
+		case entityType == "agent" && tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "use" && at(i+1, tokenizer.TokenTypeColon):
+			if i+2 < len(code) {
+				name(code[i+2])
+			}
+
+		// Tools and MCP servers named in `tools`
+		case (entityType == "tool" || entityType == "mcp") && tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "tools" &&
+			at(i+1, tokenizer.TokenTypeColon) && at(i+2, tokenizer.TokenTypeLeftBracket):
+			for j := i + 3; j < len(code) && code[j].Type != tokenizer.TokenTypeRightBracket; j++ {
+				if j+1 < len(code) && code[j+1].Type == tokenizer.TokenTypeLeftParen {
+					continue // a reference, handled above
+				}
+				name(code[j])
+			}
+
+		// Interpolations of step output
+		case entityType == "step" && (tok.Type == tokenizer.TokenTypeString || tok.Type == tokenizer.TokenTypeMultilineString):
+			start := offset(tok) + 1
+			if tok.Type == tokenizer.TokenTypeMultilineString {
+				start = offset(tok) + 3
+			}
+			for _, off := range interpolationOffsets(tok.Value, oldName) {
+				add(start + off)
+			}
+		}
+	}
+
+	// Mentions in the doc comments of its declarations, as whole words
+	inComment = true
+	var visit func(e ast.Entity)
+	visit = func(e ast.Entity) {
+		if src := ast.SourceOf(e); src != nil && e.Type() == entityType && e.Name() == oldName {
+			for _, c := range src.Comments.Leading {
+				if len(parser.ParseDirectives(c.Text)) > 0 {
+					continue
+				}
+				for i := 0; ; {
+					j := strings.Index(c.Text[i:], oldName)
+					if j == -1 {
+						break
+					}
+					j += i
+					if end := j + len(oldName); (j == 0 || !isNameChar(c.Text[j-1])) && (end == len(c.Text) || !isNameChar(c.Text[end])) {
+						add(c.Range.Start + j)
+					}
+					i = j + len(oldName)
+				}
+			}
+		}
+		for _, step := range childSteps(e) {
+			visit(step)
+		}
+		for _, v := range e.Properties() {
+			mapValue(v, func(v ast.Value) ast.Value { return v }, visit)
+		}
+	}
+	for _, e := range parser.New(source, parser.WithSourceFidelity()).ParseWithRecovery().Entities {
+		visit(e)
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Offset < edits[j].Offset })
+	return edits
+}
+
+// ApplyEdits applies non-overlapping edits, as returned by RenameEdits, to
+// source.
+func ApplyEdits(source string, edits []TextEdit) string {
+	sorted := append([]TextEdit(nil), edits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Offset > sorted[j].Offset })
+	for _, e := range sorted {
+		source = source[:e.Offset] + e.NewText + source[e.Offset+len(e.OldText):]
+	}
+	return source
+}
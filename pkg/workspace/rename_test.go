@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+const renameSource = `tool "search" {
+	command: "rg"
+}
+
+agent "researcher" {
+	model: "gpt-4o"
+	tools: [search, "fetch"]
+}
+
+agent "writer" {
+	model: "gpt-4o"
+}
+
+pipeline "report" {
+	step "gather" {
+		use: researcher
+		input: "topic"
+	}
+
+	step "draft" {
+		use: agent("writer")
+		input: step("gather").output
+		instruction: "Summarize {{step.gather.output}} but not {{step.gathering}}"
+	}
+}
+`
+
+func TestWorkspace_RenameEntity(t *testing.T) {
+	w := workspaceFrom(t, renameSource)
+	if err := w.AddRelationship("agent", "writer", "agent", "researcher", RelationTypeDepends); err != nil {
+		t.Fatal(err)
+	}
+	seq := w.Sequence()
+
+	if err := w.RenameEntity("agent", "writer", "author"); err != nil {
+		t.Fatalf("RenameEntity() error = %v", err)
+	}
+
+	if _, ok := w.GetEntityByName("agent", "author"); !ok {
+		t.Error("expected renamed agent")
+	}
+	if _, ok := w.GetEntityByName("agent", "writer"); ok {
+		t.Error("expected old name to be gone")
+	}
+	rels := w.GetRelationshipsForEntity("agent", "author")
+	if len(rels) != 1 || rels[0].SourceName != "author" {
+		t.Errorf("expected relationship to follow the rename, got %+v", rels)
+	}
+
+	pipeline, _ := w.GetEntityByName("pipeline", "report")
+	draft := pipeline.(*ast.PipelineEntity).Steps[1]
+	if ref, _ := draft.Properties()["use"].(ast.ReferenceValue); ref.Name != "author" {
+		t.Errorf("expected agent(\"author\"), got %#v", draft.Properties()["use"])
+	}
+
+	events, _, _ := w.ChangesSince(seq)
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if len(types) != 3 || types[0] != EventEntityRemoved || types[1] != EventEntityAdded || types[2] != EventEntityUpdated {
+		t.Errorf("expected removed, added and updated events, got %v", types)
+	}
+}
+
+func TestWorkspace_RenameEntityPlainNames(t *testing.T) {
+	w := workspaceFrom(t, renameSource)
+	if err := w.RenameEntity("agent", "researcher", "scout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenameEntity("tool", "search", "grep"); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, _ := w.GetEntityByName("pipeline", "report")
+	gather := pipeline.(*ast.PipelineEntity).Steps[0]
+	if use, _ := gather.Properties()["use"].(ast.StringValue); use.Value != "scout" {
+		t.Errorf("expected use: scout, got %#v", gather.Properties()["use"])
+	}
+
+	agent, _ := w.GetEntityByName("agent", "scout")
+	tools := agent.Properties()["tools"].(ast.ArrayValue).Elements
+	if tools[0].(ast.StringValue).Value != "grep" || tools[1].(ast.StringValue).Value != "fetch" {
+		t.Errorf("expected tools [grep fetch], got %v", tools)
+	}
+}
+
+func TestWorkspace_RenameStep(t *testing.T) {
+	w := workspaceFrom(t, renameSource)
+	if err := w.RenameEntity("step", "gather", "collect"); err != nil {
+		t.Fatalf("RenameEntity() error = %v", err)
+	}
+
+	pipeline, _ := w.GetEntityByName("pipeline", "report")
+	steps := pipeline.(*ast.PipelineEntity).Steps
+	if steps[0].Name() != "collect" {
+		t.Errorf("expected step collect, got %q", steps[0].Name())
+	}
+	if ref := steps[1].Properties()["input"].(ast.ReferenceValue); ref.Name != "collect" {
+		t.Errorf("expected step(\"collect\"), got %#v", ref)
+	}
+	want := "Summarize {{step.collect.output}} but not {{step.gathering}}"
+	if got := steps[1].Properties()["instruction"].(ast.StringValue).Value; got != want {
+		t.Errorf("instruction = %q, want %q", got, want)
+	}
+
+	if err := w.RenameEntity("step", "collect", "draft"); err == nil {
+		t.Error("expected an error renaming to an existing step")
+	}
+}
+
+func TestWorkspace_RenameEntityErrors(t *testing.T) {
+	w := workspaceFrom(t, renameSource)
+	if err := w.RenameEntity("agent", "missing", "x"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if err := w.RenameEntity("agent", "writer", "researcher"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+	if err := w.RenameEntity("agent", "writer", ""); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
+
+func TestRenameEdits(t *testing.T) {
+	got := ApplyEdits(renameSource, RenameEdits(renameSource, "agent", "researcher", "scout"))
+	if strings.Contains(got, "researcher") {
+		t.Errorf("expected every researcher to be renamed:\n%s", got)
+	}
+	if !strings.Contains(got, `agent "scout" {`) || !strings.Contains(got, "use: scout") {
+		t.Errorf("expected declaration and use to be renamed:\n%s", got)
+	}
+
+	got = ApplyEdits(renameSource, RenameEdits(renameSource, "step", "gather", "collect"))
+	for _, want := range []string{`step "collect" {`, `step("collect").output`, "{{step.collect.output}}", "{{step.gathering}}"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in:\n%s", want, got)
+		}
+	}
+
+	got = ApplyEdits(renameSource, RenameEdits(renameSource, "tool", "search", "grep"))
+	if !strings.Contains(got, `tool "grep" {`) || !strings.Contains(got, `tools: [grep, "fetch"]`) {
+		t.Errorf("expected tool to be renamed:\n%s", got)
+	}
+
+	edits := RenameEdits(renameSource, "agent", "writer", "author")
+	if len(edits) != 2 || edits[0].Line != 10 || edits[0].Column != 8 {
+		t.Errorf("expected edits at the declaration (10:8) and reference, got %+v", edits)
+	}
+}
+
+func TestRenameEdits_DocComments(t *testing.T) {
+	source := `# The writer drafts reports; writers-guild reviews them.
+# langspace:deprecated use writer instead of draft-writer
+agent "writer" {
+	model: "gpt-4o"
+}
+
+# Not about the writer itself.
+
+pipeline "report" {
+	# Asks the writer for a draft.
+	step "draft" {
+		use: agent("writer")
+	}
+}
+`
+	edits := RenameEdits(source, "agent", "writer", "author")
+	got := ApplyEdits(source, edits)
+	for _, want := range []string{
+		"# The author drafts reports; writers-guild reviews them.",
+		"# langspace:deprecated use writer instead of draft-writer",
+		`agent "author" {`,
+		"# Not about the writer itself.",
+		"# Asks the writer for a draft.",
+		`use: agent("author")`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if len(edits) != 3 || !edits[0].InComment || edits[1].InComment {
+		t.Errorf("expected the doc comment edit to be marked, got %+v", edits)
+	}
+
+	got = ApplyEdits(source, RenameEdits(source, "step", "draft", "outline"))
+	if !strings.Contains(got, `step "outline" {`) || !strings.Contains(got, "draft-writer") {
+		t.Errorf("expected only the step to be renamed:\n%s", got)
+	}
+}
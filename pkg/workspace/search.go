@@ -0,0 +1,241 @@
+package workspace
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Field weights used when ranking search results.
+const (
+	searchWeightName        = 3.0
+	searchWeightDescription = 2.0
+	searchWeightInstruction = 1.5
+	searchWeightProperty    = 1.0
+)
+
+// SearchResult is a single ranked match returned by Search.
+type SearchResult struct {
+	Entity ast.Entity
+	Score  float64
+}
+
+// SearchIndex is an in-memory inverted index over workspace entities. It
+// matches names, descriptions, instructions, and property values, and keeps
+// itself up to date by replaying the workspace change feed before each query.
+type SearchIndex struct {
+	workspace *Workspace
+	seq       uint64
+	docs      map[string]ast.Entity          // entity key -> entity
+	terms     map[string]map[string]float64  // entity key -> term -> weight
+	postings  map[string]map[string]struct{} // term -> entity keys
+	mu        sync.Mutex
+}
+
+// NewSearchIndex creates an index over the given workspace.
+func NewSearchIndex(ws *Workspace) *SearchIndex {
+	idx := &SearchIndex{workspace: ws}
+	idx.rebuild()
+	return idx
+}
+
+// Search returns entities matching the query, best match first. It uses the
+// workspace's own index, which is created on first use.
+func (w *Workspace) Search(query string) []SearchResult {
+	w.searchOnce.Do(func() {
+		w.searchIndex = NewSearchIndex(w)
+	})
+	return w.searchIndex.Search(query)
+}
+
+// Search returns entities matching any of the query terms, ranked by how
+// many terms match, in which fields, and how rare the terms are.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.sync()
+
+	queryTerms = dedupe(queryTerms)
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+	total := float64(len(idx.docs))
+	for _, term := range queryTerms {
+		keys := idx.postings[term]
+		if len(keys) == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(keys)))
+		for key := range keys {
+			scores[key] += idx.terms[key][term] * idf
+			matched[key]++
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for key, score := range scores {
+		// Prefer entities that match more of the query
+		coverage := float64(matched[key]) / float64(len(queryTerms))
+		results = append(results, SearchResult{Entity: idx.docs[key], Score: score * coverage})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Entity.Type() != results[j].Entity.Type() {
+			return results[i].Entity.Type() < results[j].Entity.Type()
+		}
+		return results[i].Entity.Name() < results[j].Entity.Name()
+	})
+	return results
+}
+
+// sync applies workspace changes made since the last query.
+// Must be called with idx.mu held.
+func (idx *SearchIndex) sync() {
+	events, current, err := idx.workspace.ChangesSince(idx.seq)
+	if errors.Is(err, ErrChangesTruncated) {
+		idx.rebuild()
+		return
+	}
+
+	for _, event := range events {
+		switch event.Type {
+		case EventEntityAdded, EventEntityUpdated:
+			idx.add(event.Entity)
+		case EventEntityRemoved:
+			idx.remove(entityKey(event.Entity.Type(), event.Entity.Name()))
+		case EventWorkspaceCleared, EventWorkspaceLoaded:
+			idx.rebuild()
+			return
+		}
+	}
+	idx.seq = current
+}
+
+// rebuild re-indexes every entity in the workspace.
+func (idx *SearchIndex) rebuild() {
+	idx.docs = make(map[string]ast.Entity)
+	idx.terms = make(map[string]map[string]float64)
+	idx.postings = make(map[string]map[string]struct{})
+
+	// Read the sequence first so changes racing with the rebuild are replayed
+	idx.seq = idx.workspace.Sequence()
+	for _, entity := range idx.workspace.GetEntities() {
+		idx.add(entity)
+	}
+}
+
+func (idx *SearchIndex) add(entity ast.Entity) {
+	key := entityKey(entity.Type(), entity.Name())
+	idx.remove(key)
+
+	terms := make(map[string]float64)
+	addTerms(terms, entity.Name(), searchWeightName)
+	collectEntityTerms(terms, entity)
+
+	idx.docs[key] = entity
+	idx.terms[key] = terms
+	for term := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]struct{})
+		}
+		idx.postings[term][key] = struct{}{}
+	}
+}
+
+func (idx *SearchIndex) remove(key string) {
+	for term := range idx.terms[key] {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, key)
+	delete(idx.docs, key)
+}
+
+// collectEntityTerms adds the terms of an entity's properties and nested steps.
+func collectEntityTerms(terms map[string]float64, entity ast.Entity) {
+	for key, val := range entity.Properties() {
+		weight := searchWeightProperty
+		switch key {
+		case "description":
+			weight = searchWeightDescription
+		case "instruction", "instructions":
+			weight = searchWeightInstruction
+		}
+		collectValueTerms(terms, val, weight)
+	}
+
+	var steps []*ast.StepEntity
+	switch e := entity.(type) {
+	case *ast.PipelineEntity:
+		steps = e.Steps
+	case *ast.ParallelEntity:
+		steps = e.Steps
+	}
+	for _, step := range steps {
+		addTerms(terms, step.Name(), searchWeightProperty)
+		collectEntityTerms(terms, step)
+	}
+}
+
+func collectValueTerms(terms map[string]float64, v ast.Value, weight float64) {
+	switch val := v.(type) {
+	case ast.StringValue:
+		addTerms(terms, val.Value, weight)
+	case ast.ArrayValue:
+		for _, elem := range val.Elements {
+			collectValueTerms(terms, elem, weight)
+		}
+	case ast.ObjectValue:
+		for key, elem := range val.Properties {
+			addTerms(terms, key, weight)
+			collectValueTerms(terms, elem, weight)
+		}
+	case ast.ReferenceValue:
+		addTerms(terms, val.Name, weight)
+	case ast.TypedParameterValue:
+		addTerms(terms, val.Description, weight)
+	case ast.NestedEntityValue:
+		if val.Entity != nil {
+			addTerms(terms, val.Entity.Name(), weight)
+			collectEntityTerms(terms, val.Entity)
+		}
+	}
+}
+
+func addTerms(terms map[string]float64, text string, weight float64) {
+	for _, term := range tokenize(text) {
+		terms[term] += weight
+	}
+}
+
+// tokenize lowercases text and splits it into terms of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func dedupe(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	result := terms[:0:0]
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+	return result
+}
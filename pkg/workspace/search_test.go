@@ -0,0 +1,99 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func newSearchAgent(name, description, instruction string) ast.Entity {
+	agent := ast.NewAgentEntity(name)
+	if description != "" {
+		agent.SetProperty("description", ast.StringValue{Value: description})
+	}
+	if instruction != "" {
+		agent.SetProperty("instruction", ast.StringValue{Value: instruction})
+	}
+	return agent
+}
+
+func searchNames(results []SearchResult) []string {
+	names := make([]string, len(results))
+	for i, r := range results {
+		names[i] = r.Entity.Name()
+	}
+	return names
+}
+
+func TestWorkspace_Search(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(newSearchAgent("payment-webhook", "Handles Stripe payment events", ""))
+	_ = w.AddEntity(newSearchAgent("billing", "", "Reconcile payment records nightly"))
+	_ = w.AddEntity(newSearchAgent("reviewer", "Reviews code", ""))
+
+	tool := ast.NewToolEntity("notify")
+	tool.SetProperty("handler", ast.ObjectValue{Properties: map[string]ast.Value{
+		"url": ast.StringValue{Value: "https://example.com/webhook"},
+	}})
+	_ = w.AddEntity(tool)
+
+	results := w.Search("payment webhook")
+	names := searchNames(results)
+	if len(names) != 3 || names[0] != "payment-webhook" {
+		t.Fatalf("expected payment-webhook ranked first of 3 results, got %v", names)
+	}
+	for _, r := range results {
+		if r.Entity.Name() == "reviewer" {
+			t.Error("unrelated entity should not match")
+		}
+	}
+
+	if got := w.Search("  "); got != nil {
+		t.Errorf("expected no results for empty query, got %v", searchNames(got))
+	}
+	if got := w.Search("REVIEWS"); len(got) != 1 || got[0].Entity.Name() != "reviewer" {
+		t.Errorf("expected case-insensitive match on description, got %v", searchNames(got))
+	}
+}
+
+func TestWorkspace_SearchFollowsChanges(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(newSearchAgent("alpha", "first agent", ""))
+
+	if got := w.Search("second"); len(got) != 0 {
+		t.Fatalf("expected no matches yet, got %v", searchNames(got))
+	}
+
+	_ = w.AddEntity(newSearchAgent("beta", "second agent", ""))
+	if got := searchNames(w.Search("second")); len(got) != 1 || got[0] != "beta" {
+		t.Errorf("expected added entity to be searchable, got %v", got)
+	}
+
+	_ = w.UpdateEntity(newSearchAgent("beta", "renamed purpose", ""))
+	if got := w.Search("second"); len(got) != 0 {
+		t.Errorf("expected updated entity to drop old terms, got %v", searchNames(got))
+	}
+
+	_ = w.RemoveEntity("agent", "alpha")
+	if got := w.Search("first"); len(got) != 0 {
+		t.Errorf("expected removed entity to disappear, got %v", searchNames(got))
+	}
+
+	w.Clear()
+	if got := w.Search("renamed"); len(got) != 0 {
+		t.Errorf("expected no results after Clear, got %v", searchNames(got))
+	}
+}
+
+func TestWorkspace_SearchPipelineSteps(t *testing.T) {
+	w := New()
+	pipeline := ast.NewPipelineEntity("release")
+	step := ast.NewStepEntity("changelog")
+	step.SetProperty("use", ast.ReferenceValue{Type: "agent", Name: "writer"})
+	pipeline.AddStep(step)
+	_ = w.AddEntity(pipeline)
+
+	if got := searchNames(w.Search("changelog writer")); len(got) != 1 || got[0] != "release" {
+		t.Errorf("expected pipeline to match on step contents, got %v", got)
+	}
+}
@@ -0,0 +1,230 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+// Embedder turns texts into embedding vectors. It matches the runtime's
+// EmbeddingProvider, so any provider with an Embed API can be used.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// semanticProperties are the properties whose text is embedded for an entity.
+var semanticProperties = []string{"description", "instruction", "instructions", "prompt", "system_prompt"}
+
+// semanticDoc is an embedded entity.
+type semanticDoc struct {
+	entity ast.Entity
+	text   string
+	vector []float64
+}
+
+// SemanticIndex is an embedding index over the instructions, prompts, and
+// descriptions of workspace entities. Like SearchIndex, it follows the change
+// feed; only entities whose text changed are re-embedded.
+type SemanticIndex struct {
+	workspace *Workspace
+	embedder  Embedder
+	seq       uint64
+	synced    bool
+	docs      map[string]*semanticDoc // entity key -> embedded entity
+	mu        sync.Mutex
+}
+
+// NewSemanticIndex creates an embedding index over the given workspace.
+// Nothing is embedded until the first search.
+func NewSemanticIndex(ws *Workspace, embedder Embedder) *SemanticIndex {
+	return &SemanticIndex{
+		workspace: ws,
+		embedder:  embedder,
+		docs:      make(map[string]*semanticDoc),
+	}
+}
+
+// WithEmbedder enables SemanticSearch using the given embedder.
+func (w *Workspace) WithEmbedder(embedder Embedder) *Workspace {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.semanticIndex = NewSemanticIndex(w, embedder)
+	return w
+}
+
+// SemanticSearch returns entities whose instructions, prompts, or descriptions
+// are conceptually related to the query, most similar first. It requires an
+// embedder to be set with WithEmbedder.
+func (w *Workspace) SemanticSearch(ctx context.Context, query string) ([]SearchResult, error) {
+	w.mu.RLock()
+	idx := w.semanticIndex
+	w.mu.RUnlock()
+	if idx == nil {
+		return nil, fmt.Errorf("semantic search requires an embedder (see WithEmbedder)")
+	}
+	return idx.Search(ctx, query)
+}
+
+// Search embeds the query and ranks indexed entities by cosine similarity.
+// Entities with no similarity to the query are omitted.
+func (idx *SemanticIndex) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.sync(ctx); err != nil {
+		return nil, err
+	}
+
+	vectors, err := idx.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 query", len(vectors))
+	}
+
+	var results []SearchResult
+	for _, doc := range idx.docs {
+		if score := CosineSimilarity(vectors[0], doc.vector); score > 0 {
+			results = append(results, SearchResult{Entity: doc.entity, Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Entity.Type() != results[j].Entity.Type() {
+			return results[i].Entity.Type() < results[j].Entity.Type()
+		}
+		return results[i].Entity.Name() < results[j].Entity.Name()
+	})
+	return results, nil
+}
+
+// sync brings the index up to date with the workspace, embedding new and
+// changed texts in a single batch. If embedding fails the index is left as it
+// was, so the next search retries. Must be called with idx.mu held.
+func (idx *SemanticIndex) sync(ctx context.Context) error {
+	changed := make(map[string]ast.Entity) // nil entity means removed
+	rebuild := !idx.synced
+
+	seq := idx.seq
+	if !rebuild {
+		events, current, err := idx.workspace.ChangesSince(idx.seq)
+		if errors.Is(err, ErrChangesTruncated) {
+			rebuild = true
+		}
+		for _, event := range events {
+			switch event.Type {
+			case EventEntityAdded, EventEntityUpdated:
+				changed[entityKey(event.Entity.Type(), event.Entity.Name())] = event.Entity
+			case EventEntityRemoved:
+				changed[entityKey(event.Entity.Type(), event.Entity.Name())] = nil
+			case EventWorkspaceCleared, EventWorkspaceLoaded:
+				rebuild = true
+			}
+		}
+		seq = current
+	}
+
+	next := make(map[string]*semanticDoc, len(idx.docs))
+	if rebuild {
+		// Read the sequence first so changes racing with the rebuild are replayed
+		seq = idx.workspace.Sequence()
+		changed = make(map[string]ast.Entity)
+		for _, entity := range idx.workspace.GetEntities() {
+			changed[entityKey(entity.Type(), entity.Name())] = entity
+		}
+	} else {
+		for key, doc := range idx.docs {
+			next[key] = doc
+		}
+	}
+
+	// Collect texts that need embedding, reusing vectors for unchanged text
+	var keys, texts []string
+	for key, entity := range changed {
+		text := ""
+		if entity != nil {
+			text = semanticText(entity)
+		}
+		if text == "" {
+			delete(next, key)
+			continue
+		}
+		if prev, ok := idx.docs[key]; ok && prev.text == text {
+			next[key] = &semanticDoc{entity: entity, text: text, vector: prev.vector}
+			continue
+		}
+		keys = append(keys, key)
+		texts = append(texts, text)
+	}
+
+	if len(texts) > 0 {
+		vectors, err := idx.embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed entities: %w", err)
+		}
+		if len(vectors) != len(texts) {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+		}
+		for i, key := range keys {
+			next[key] = &semanticDoc{entity: changed[key], text: texts[i], vector: vectors[i]}
+		}
+	}
+
+	idx.docs = next
+	idx.seq = seq
+	idx.synced = true
+	return nil
+}
+
+// semanticText returns the text embedded for an entity, or "" if it has none.
+func semanticText(entity ast.Entity) string {
+	body := semanticBody(entity)
+	if body == "" {
+		return ""
+	}
+	return entity.Name() + "\n" + body
+}
+
+// semanticBody joins an entity's instruction, prompt, and description text.
+func semanticBody(entity ast.Entity) string {
+	var parts []string
+	for _, key := range semanticProperties {
+		if v, ok := entity.GetProperty(key); ok {
+			if sv, ok := v.(ast.StringValue); ok && strings.TrimSpace(sv.Value) != "" {
+				parts = append(parts, strings.TrimSpace(sv.Value))
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, or 0 if
+// they differ in length or either is zero.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,119 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// conceptEmbedder maps words to concept dimensions, so synonyms embed alike.
+type conceptEmbedder struct {
+	calls int
+	texts int
+	err   error
+}
+
+var concepts = map[string]int{
+	"payment": 0, "billing": 0, "invoice": 0, "charge": 0,
+	"code": 1, "review": 1, "lint": 1,
+	"translate": 2, "language": 2,
+}
+
+func (e *conceptEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.calls++
+	e.texts += len(texts)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, 3)
+		for _, word := range tokenize(text) {
+			if dim, ok := concepts[word]; ok {
+				v[dim]++
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func TestWorkspace_SemanticSearch(t *testing.T) {
+	embedder := &conceptEmbedder{}
+	w := New().WithEmbedder(embedder)
+	_ = w.AddEntity(newSearchAgent("invoicer", "", "Send an invoice for each order"))
+	_ = w.AddEntity(newSearchAgent("reviewer", "", "Review code for bugs"))
+	_ = w.AddEntity(newSearchAgent("no-text", "", ""))
+
+	results, err := w.SemanticSearch(context.Background(), "billing")
+	if err != nil {
+		t.Fatalf("SemanticSearch() error = %v", err)
+	}
+	if names := searchNames(results); len(names) != 1 || names[0] != "invoicer" {
+		t.Errorf("expected conceptually related agent invoicer, got %v", names)
+	}
+
+	// Only new or changed entities are embedded again
+	embedded := embedder.texts
+	_ = w.AddEntity(newSearchAgent("charger", "Charge customer cards", ""))
+	results, err = w.SemanticSearch(context.Background(), "payment")
+	if err != nil {
+		t.Fatalf("SemanticSearch() error = %v", err)
+	}
+	if got := embedder.texts - embedded; got != 2 {
+		t.Errorf("expected 1 new entity and the query to be embedded, got %d texts", got)
+	}
+	if names := searchNames(results); len(names) != 2 {
+		t.Errorf("expected 2 payment-related agents, got %v", names)
+	}
+
+	_ = w.RemoveEntity("agent", "invoicer")
+	results, _ = w.SemanticSearch(context.Background(), "payment")
+	if names := searchNames(results); len(names) != 1 || names[0] != "charger" {
+		t.Errorf("expected removed agent to be dropped, got %v", names)
+	}
+}
+
+func TestWorkspace_SemanticSearchErrors(t *testing.T) {
+	if _, err := New().SemanticSearch(context.Background(), "x"); err == nil || !strings.Contains(err.Error(), "embedder") {
+		t.Errorf("expected missing embedder error, got %v", err)
+	}
+
+	embedder := &conceptEmbedder{err: errors.New("provider down")}
+	w := New().WithEmbedder(embedder)
+	_ = w.AddEntity(newSearchAgent("invoicer", "", "Send an invoice"))
+	if _, err := w.SemanticSearch(context.Background(), "billing"); err == nil || !strings.Contains(err.Error(), "provider down") {
+		t.Errorf("expected embed error, got %v", err)
+	}
+
+	// Recovers once the embedder works again
+	embedder.err = nil
+	results, err := w.SemanticSearch(context.Background(), "billing")
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected recovery after embed failure, got %v (err %v)", searchNames(results), err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"same direction", []float64{1, 2}, []float64{2, 4}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"zero vector", []float64{0, 0}, []float64{1, 0}, 0},
+		{"mismatched lengths", []float64{1, 0}, []float64{1, 0, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
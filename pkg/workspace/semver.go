@@ -0,0 +1,168 @@
+package workspace
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a semantic version, MAJOR.MINOR.PATCH with an optional
+// -prerelease. Build metadata is not supported.
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseSemver parses a version such as "1.2.0" or "2.0.0-rc.1". A leading
+// "v" is not allowed, so every version has one spelling.
+func parseSemver(s string) (semver, error) {
+	core, pre, hasPre := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH, e.g. 1.2.0", s)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := parseVersionNumber(p)
+		if err != nil {
+			return semver{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		nums[i] = n
+	}
+	v := semver{major: nums[0], minor: nums[1], patch: nums[2]}
+	if hasPre {
+		v.prerelease = strings.Split(pre, ".")
+		for _, id := range v.prerelease {
+			if id == "" || strings.Trim(id, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-") != "" {
+				return semver{}, fmt.Errorf("invalid version %q: bad prerelease %q", s, pre)
+			}
+		}
+	}
+	return v, nil
+}
+
+// parseVersionNumber parses a numeric version part, which has no leading
+// zeros.
+func parseVersionNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || strconv.Itoa(n) != s {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if len(v.prerelease) > 0 {
+		s += "-" + strings.Join(v.prerelease, ".")
+	}
+	return s
+}
+
+// compare returns -1, 0, or 1 as v orders before, equal to, or after o,
+// by semver precedence: a prerelease orders before its release.
+func (v semver) compare(o semver) int {
+	for _, d := range [][2]int{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if d[0] != d[1] {
+			return cmp.Compare(d[0], d[1])
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		a, b := v.prerelease[i], o.prerelease[i]
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return cmp.Compare(an, bn)
+			}
+		case aErr == nil:
+			return -1 // numeric identifiers order first
+		case bErr == nil:
+			return 1
+		case a != b:
+			return strings.Compare(a, b)
+		}
+	}
+	return cmp.Compare(len(v.prerelease), len(o.prerelease))
+}
+
+// versionConstraint selects the versions of a package to install:
+//
+//	""       or "latest", the highest release
+//	1.2.0    exactly 1.2.0
+//	1.2      or 1, any release starting with it
+//	^1.2.0   compatible releases: >=1.2.0 and <2.0.0 (<0.3.0 for ^0.2.0)
+//	~1.2.0   patch releases: >=1.2.0 and <1.3.0
+//
+// Prereleases match only exactly.
+type versionConstraint struct {
+	op    string // "", "=", "^", "~", or "prefix"
+	base  semver
+	parts int // of a prefix
+}
+
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	if s == "" || s == "latest" {
+		return versionConstraint{}, nil
+	}
+	if op := s[:1]; op == "^" || op == "~" {
+		v, err := parseSemver(s[1:])
+		if err != nil {
+			return versionConstraint{}, err
+		}
+		return versionConstraint{op: op, base: v}, nil
+	}
+	if parts := strings.Split(s, "."); len(parts) < 3 {
+		var nums [2]int
+		for i, p := range parts {
+			n, err := parseVersionNumber(p)
+			if err != nil {
+				return versionConstraint{}, fmt.Errorf("invalid version %q: %w", s, err)
+			}
+			nums[i] = n
+		}
+		return versionConstraint{op: "prefix", base: semver{major: nums[0], minor: nums[1]}, parts: len(parts)}, nil
+	}
+	v, err := parseSemver(s)
+	if err != nil {
+		return versionConstraint{}, err
+	}
+	return versionConstraint{op: "=", base: v}, nil
+}
+
+func (c versionConstraint) matches(v semver) bool {
+	if c.op == "=" {
+		return v.compare(c.base) == 0
+	}
+	if len(v.prerelease) > 0 {
+		return false
+	}
+	switch c.op {
+	case "^":
+		if v.compare(c.base) < 0 {
+			return false
+		}
+		if c.base.major > 0 {
+			return v.major == c.base.major
+		}
+		if c.base.minor > 0 {
+			return v.major == 0 && v.minor == c.base.minor
+		}
+		return v.major == 0 && v.minor == 0 && v.patch == c.base.patch
+	case "~":
+		return v.compare(c.base) >= 0 && v.major == c.base.major && v.minor == c.base.minor
+	case "prefix":
+		return v.major == c.base.major && (c.parts < 2 || v.minor == c.base.minor)
+	}
+	return true
+}
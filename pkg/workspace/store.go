@@ -0,0 +1,147 @@
+package workspace
+
+import "github.com/shellkjell/langspace/pkg/ast"
+
+// entityStore holds the workspace's entities in the order they were added,
+// indexed by type and by type and name, so lookups do not scan every entity.
+// It is guarded by the workspace's lock.
+//
+// Removed entities are marked and skipped, keeping removal cheap; they are
+// dropped once they make up most of the store.
+type entityStore struct {
+	order   []*storedEntity
+	byType  map[string][]*storedEntity
+	byName  map[storeKey][]*storedEntity // several only with AllowDuplicateNames
+	removed int                          // removed entities still in order and byType
+}
+
+// storeKey identifies entities by type and name.
+type storeKey struct {
+	entityType string
+	name       string
+}
+
+// storedEntity is an entity's slot in the store. Replacing the entity keeps
+// its position.
+type storedEntity struct {
+	entity  ast.Entity
+	removed bool
+}
+
+// minCompact is the least number of removed entities worth compacting.
+const minCompact = 64
+
+func newEntityStore(capacity int) *entityStore {
+	return &entityStore{
+		order:  make([]*storedEntity, 0, capacity),
+		byType: make(map[string][]*storedEntity),
+		byName: make(map[storeKey][]*storedEntity, capacity),
+	}
+}
+
+// len returns the number of entities.
+func (s *entityStore) len() int {
+	return len(s.order) - s.removed
+}
+
+// add appends an entity.
+func (s *entityStore) add(entity ast.Entity) {
+	se := &storedEntity{entity: entity}
+	s.order = append(s.order, se)
+	s.byType[entity.Type()] = append(s.byType[entity.Type()], se)
+	key := storeKey{entity.Type(), entity.Name()}
+	s.byName[key] = append(s.byName[key], se)
+}
+
+// lookup returns the slot of the first entity added with the given type and
+// name, or nil.
+func (s *entityStore) lookup(entityType, name string) *storedEntity {
+	if entries := s.byName[storeKey{entityType, name}]; len(entries) > 0 {
+		return entries[0]
+	}
+	return nil
+}
+
+// get returns the first entity added with the given type and name.
+func (s *entityStore) get(entityType, name string) (ast.Entity, bool) {
+	if se := s.lookup(entityType, name); se != nil {
+		return se.entity, true
+	}
+	return nil, false
+}
+
+// replace puts entity in se's slot. The entity has the same type and name.
+func (s *entityStore) replace(se *storedEntity, entity ast.Entity) {
+	se.entity = entity
+}
+
+// remove removes the entity in se's slot.
+func (s *entityStore) remove(se *storedEntity) {
+	s.unindexName(se, se.entity.Name())
+	se.removed = true
+	s.removed++
+	if s.removed >= minCompact && s.removed > len(s.order)/2 {
+		s.compact()
+	}
+}
+
+// renamed reindexes se after its entity was renamed from oldName.
+func (s *entityStore) renamed(se *storedEntity, oldName string) {
+	s.unindexName(se, oldName)
+	key := storeKey{se.entity.Type(), se.entity.Name()}
+	s.byName[key] = append(s.byName[key], se)
+}
+
+// unindexName removes se from the name index under name.
+func (s *entityStore) unindexName(se *storedEntity, name string) {
+	key := storeKey{se.entity.Type(), name}
+	entries := s.byName[key]
+	for i, e := range entries {
+		if e == se {
+			entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(s.byName, key)
+	} else {
+		s.byName[key] = entries
+	}
+}
+
+// compact drops removed entities from order and byType.
+func (s *entityStore) compact() {
+	order := make([]*storedEntity, 0, s.len())
+	for _, se := range s.order {
+		if !se.removed {
+			order = append(order, se)
+		}
+	}
+	s.order = order
+	s.byType = make(map[string][]*storedEntity)
+	for _, se := range order {
+		s.byType[se.entity.Type()] = append(s.byType[se.entity.Type()], se)
+	}
+	s.removed = 0
+}
+
+// all returns the entities in the order they were added.
+func (s *entityStore) all() []ast.Entity {
+	return appendLive(make([]ast.Entity, 0, s.len()), s.order)
+}
+
+// ofType returns the entities of a type in the order they were added, or
+// nil if there are none.
+func (s *entityStore) ofType(entityType string) []ast.Entity {
+	return appendLive(nil, s.byType[entityType])
+}
+
+// appendLive appends the entities of the slots that have not been removed.
+func appendLive(result []ast.Entity, entries []*storedEntity) []ast.Entity {
+	for _, se := range entries {
+		if !se.removed {
+			result = append(result, se.entity)
+		}
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package workspace
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+)
+
+func entityNames(entities []ast.Entity) []string {
+	names := make([]string, len(entities))
+	for i, e := range entities {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestEntityStore_Order(t *testing.T) {
+	w := New()
+	for i := 0; i < 200; i++ {
+		if err := w.AddEntity(createFileEntity(fmt.Sprintf("f%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Remove enough entities to compact the store
+	for i := 0; i < 150; i++ {
+		if err := w.RemoveEntity("file", fmt.Sprintf("f%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddEntity(createAgentEntity("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UpdateEntity(createFileEntity("f160")); err != nil {
+		t.Fatal(err)
+	}
+
+	names := entityNames(w.GetEntities())
+	if len(names) != 51 || names[0] != "f150" || names[10] != "f160" || names[50] != "a" {
+		t.Errorf("expected entities in insertion order, got %v", names)
+	}
+	if files := w.GetEntitiesByType("file"); len(files) != 50 || files[0].Name() != "f150" {
+		t.Errorf("expected 50 files in insertion order, got %v", entityNames(files))
+	}
+	if _, found := w.GetEntityByName("file", "f10"); found {
+		t.Error("expected a removed entity not to be found")
+	}
+	if e, found := w.GetEntityByName("file", "f199"); !found || e.Name() != "f199" {
+		t.Error("expected f199 to be found")
+	}
+	if w.GetEntitiesByType("tool") != nil {
+		t.Error("expected no entities of a type that has none")
+	}
+}
+
+func TestEntityStore_Duplicates(t *testing.T) {
+	w := New().WithConfig(&Config{AllowDuplicateNames: true})
+	first, second := createFileEntity("f"), createFileEntity("f")
+	first.SetProperty("path", ast.StringValue{Value: "first"})
+	_ = w.AddEntity(first)
+	_ = w.AddEntity(second)
+
+	if e, _ := w.GetEntityByName("file", "f"); e != first {
+		t.Error("expected the first entity added to be found")
+	}
+	_ = w.RemoveEntity("file", "f")
+	if e, _ := w.GetEntityByName("file", "f"); e != second {
+		t.Error("expected the second entity after removing the first")
+	}
+}
+
+func TestEntityStore_Rename(t *testing.T) {
+	w := New()
+	_ = w.AddEntity(createAgentEntity("writer"))
+	if err := w.RenameEntity("agent", "writer", "author"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := w.GetEntityByName("agent", "writer"); found {
+		t.Error("expected the old name not to be found")
+	}
+	if _, found := w.GetEntityByName("agent", "author"); !found {
+		t.Error("expected the new name to be found")
+	}
+	if err := w.RemoveEntity("agent", "author"); err != nil {
+		t.Errorf("expected the renamed entity to be removable: %v", err)
+	}
+}
+
+// benchmarkWorkspace returns a workspace of n file entities.
+func benchmarkWorkspace(b *testing.B, n int) *Workspace {
+	b.Helper()
+	w := New()
+	for i := 0; i < n; i++ {
+		if err := w.AddEntity(createFileEntity(fmt.Sprintf("f%d", i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return w
+}
+
+func BenchmarkWorkspace_GetEntityByName(b *testing.B) {
+	for _, n := range []int{100, 10000, 50000} {
+		w := benchmarkWorkspace(b, n)
+		name := fmt.Sprintf("f%d", n-1)
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w.GetEntityByName("file", name)
+			}
+		})
+		// The lookup GetEntityByName did before the index
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			entities := w.GetEntities()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, e := range entities {
+					if e.Type() == "file" && e.Name() == name {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWorkspace_AddEntities(b *testing.B) {
+	// Each add checks for a duplicate name
+	entities := make([]ast.Entity, 50000)
+	for i := range entities {
+		entities[i] = createFileEntity(fmt.Sprintf("f%d", i))
+	}
+	for i := 0; i < b.N; i++ {
+		w := New()
+		for _, e := range entities {
+			_ = w.AddEntity(e)
+		}
+	}
+}
+
+func BenchmarkWorkspace_RemoveEntity(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		w := benchmarkWorkspace(b, 10000)
+		b.StartTimer()
+		for j := 0; j < 10000; j++ {
+			_ = w.RemoveEntity("file", fmt.Sprintf("f%d", j))
+		}
+	}
+}
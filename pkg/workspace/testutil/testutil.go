@@ -0,0 +1,319 @@
+// Package testutil builds workspaces for Go tests: entity builders, a
+// workspace parsed from LangSpace source, and assertions on workspace state.
+//
+// Example:
+//
+//	ws := testutil.WorkspaceFrom(t, `
+//	agent "reviewer" {
+//		model: "gpt-4o"
+//	}
+//	`)
+//	ws = testutil.Workspace(t, testutil.Agent("reviewer").Model("gpt-4o").Build())
+//	testutil.AssertEntityExists(t, ws, "agent", "reviewer")
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// Value converts a Go value to a LangSpace value: strings, numbers, bools,
+// nil, slices of those, and maps with string keys. ast.Value is used as is.
+// Other types panic, as they are a mistake in the test.
+func Value(v interface{}) ast.Value {
+	switch v := v.(type) {
+	case ast.Value:
+		return v
+	case nil:
+		return ast.NullValue{}
+	case string:
+		return ast.StringValue{Value: v}
+	case bool:
+		return ast.BoolValue{Value: v}
+	case int:
+		return ast.NumberValue{Value: float64(v)}
+	case float64:
+		return ast.NumberValue{Value: v}
+	case []string:
+		elements := make([]ast.Value, len(v))
+		for i, s := range v {
+			elements[i] = ast.StringValue{Value: s}
+		}
+		return ast.ArrayValue{Elements: elements}
+	case []interface{}:
+		elements := make([]ast.Value, len(v))
+		for i, e := range v {
+			elements[i] = Value(e)
+		}
+		return ast.ArrayValue{Elements: elements}
+	case map[string]interface{}:
+		properties := make(map[string]ast.Value, len(v))
+		for k, e := range v {
+			properties[k] = Value(e)
+		}
+		return ast.ObjectValue{Properties: properties}
+	default:
+		panic(fmt.Sprintf("testutil: cannot convert %T to a LangSpace value", v))
+	}
+}
+
+// EntityBuilder builds an entity of any type.
+type EntityBuilder struct {
+	entity ast.Entity
+}
+
+// Entity starts building an entity of the given type. Unknown types panic.
+func Entity(entityType, name string) *EntityBuilder {
+	entity, err := ast.NewEntity(entityType, name)
+	if err != nil {
+		panic(fmt.Sprintf("testutil: %v", err))
+	}
+	return &EntityBuilder{entity: entity}
+}
+
+// Set sets a property to value, converted with Value.
+func (b *EntityBuilder) Set(key string, value interface{}) *EntityBuilder {
+	b.entity.SetProperty(key, Value(value))
+	return b
+}
+
+// Build returns the entity.
+func (b *EntityBuilder) Build() ast.Entity {
+	return b.entity
+}
+
+// AgentBuilder builds an agent.
+type AgentBuilder struct {
+	EntityBuilder
+}
+
+// Agent starts building an agent.
+func Agent(name string) *AgentBuilder {
+	return &AgentBuilder{EntityBuilder{entity: ast.NewAgentEntity(name)}}
+}
+
+// Model sets the agent's model.
+func (b *AgentBuilder) Model(model string) *AgentBuilder {
+	b.Set("model", model)
+	return b
+}
+
+// Instruction sets the agent's instruction.
+func (b *AgentBuilder) Instruction(instruction string) *AgentBuilder {
+	b.Set("instruction", instruction)
+	return b
+}
+
+// Temperature sets the agent's temperature.
+func (b *AgentBuilder) Temperature(temperature float64) *AgentBuilder {
+	b.Set("temperature", temperature)
+	return b
+}
+
+// Tools sets the tools the agent can call.
+func (b *AgentBuilder) Tools(names ...string) *AgentBuilder {
+	elements := make([]ast.Value, len(names))
+	for i, name := range names {
+		elements[i] = ast.ReferenceValue{Type: "tool", Name: name, Path: []string{}}
+	}
+	b.Set("tools", ast.ArrayValue{Elements: elements})
+	return b
+}
+
+// With sets any other property of the agent.
+func (b *AgentBuilder) With(key string, value interface{}) *AgentBuilder {
+	b.Set(key, value)
+	return b
+}
+
+// ToolBuilder builds a tool.
+type ToolBuilder struct {
+	EntityBuilder
+}
+
+// Tool starts building a tool.
+func Tool(name string) *ToolBuilder {
+	return &ToolBuilder{EntityBuilder{entity: ast.NewToolEntity(name)}}
+}
+
+// Description sets the tool's description.
+func (b *ToolBuilder) Description(description string) *ToolBuilder {
+	b.Set("description", description)
+	return b
+}
+
+// Command sets the shell command the tool runs.
+func (b *ToolBuilder) Command(command string) *ToolBuilder {
+	b.Set("command", command)
+	return b
+}
+
+// With sets any other property of the tool.
+func (b *ToolBuilder) With(key string, value interface{}) *ToolBuilder {
+	b.Set(key, value)
+	return b
+}
+
+// IntentBuilder builds an intent.
+type IntentBuilder struct {
+	EntityBuilder
+}
+
+// Intent starts building an intent.
+func Intent(name string) *IntentBuilder {
+	return &IntentBuilder{EntityBuilder{entity: ast.NewIntentEntity(name)}}
+}
+
+// Use sets the agent the intent runs.
+func (b *IntentBuilder) Use(agent string) *IntentBuilder {
+	b.Set("use", ast.ReferenceValue{Type: "agent", Name: agent, Path: []string{}})
+	return b
+}
+
+// Input sets the intent's input.
+func (b *IntentBuilder) Input(input interface{}) *IntentBuilder {
+	b.Set("input", input)
+	return b
+}
+
+// With sets any other property of the intent.
+func (b *IntentBuilder) With(key string, value interface{}) *IntentBuilder {
+	b.Set(key, value)
+	return b
+}
+
+// StepBuilder builds a pipeline step.
+type StepBuilder struct {
+	step *ast.StepEntity
+}
+
+// Step starts building a pipeline step.
+func Step(name string) *StepBuilder {
+	return &StepBuilder{step: ast.NewStepEntity(name)}
+}
+
+// Use sets the agent the step runs.
+func (b *StepBuilder) Use(agent string) *StepBuilder {
+	b.step.SetProperty("use", ast.ReferenceValue{Type: "agent", Name: agent, Path: []string{}})
+	return b
+}
+
+// Input sets the step's input.
+func (b *StepBuilder) Input(input interface{}) *StepBuilder {
+	b.step.SetProperty("input", Value(input))
+	return b
+}
+
+// With sets any other property of the step.
+func (b *StepBuilder) With(key string, value interface{}) *StepBuilder {
+	b.step.SetProperty(key, Value(value))
+	return b
+}
+
+// Build returns the step.
+func (b *StepBuilder) Build() *ast.StepEntity {
+	return b.step
+}
+
+// PipelineBuilder builds a pipeline.
+type PipelineBuilder struct {
+	pipeline *ast.PipelineEntity
+}
+
+// Pipeline starts building a pipeline.
+func Pipeline(name string) *PipelineBuilder {
+	return &PipelineBuilder{pipeline: ast.NewPipelineEntity(name)}
+}
+
+// Step adds steps, run in the order added.
+func (b *PipelineBuilder) Step(steps ...*StepBuilder) *PipelineBuilder {
+	for _, s := range steps {
+		b.pipeline.AddStep(s.Build())
+	}
+	return b
+}
+
+// With sets any other property of the pipeline.
+func (b *PipelineBuilder) With(key string, value interface{}) *PipelineBuilder {
+	b.pipeline.SetProperty(key, Value(value))
+	return b
+}
+
+// Build returns the pipeline.
+func (b *PipelineBuilder) Build() ast.Entity {
+	return b.pipeline
+}
+
+// Workspace returns a workspace holding entities, failing the test if one
+// cannot be added.
+func Workspace(tb testing.TB, entities ...ast.Entity) *workspace.Workspace {
+	tb.Helper()
+	ws := workspace.New()
+	for _, e := range entities {
+		if err := ws.AddEntity(e); err != nil {
+			tb.Fatalf("adding %s %q: %v", e.Type(), e.Name(), err)
+		}
+	}
+	return ws
+}
+
+// WorkspaceFrom returns a workspace holding the entities defined in source,
+// failing the test if it does not parse. Imports are not loaded.
+func WorkspaceFrom(tb testing.TB, source string) *workspace.Workspace {
+	tb.Helper()
+	entities, _, err := parser.New(source).Parse()
+	if err != nil {
+		tb.Fatalf("parsing workspace: %v", err)
+	}
+	return Workspace(tb, entities...)
+}
+
+// AssertEntityExists fails the test unless ws has the entity, and returns
+// it.
+func AssertEntityExists(tb testing.TB, ws *workspace.Workspace, entityType, name string) ast.Entity {
+	tb.Helper()
+	entity, ok := ws.GetEntityByName(entityType, name)
+	if !ok {
+		tb.Fatalf("expected %s %q in the workspace", entityType, name)
+	}
+	return entity
+}
+
+// AssertEntityMissing fails the test if ws has the entity.
+func AssertEntityMissing(tb testing.TB, ws *workspace.Workspace, entityType, name string) {
+	tb.Helper()
+	if _, ok := ws.GetEntityByName(entityType, name); ok {
+		tb.Errorf("expected no %s %q in the workspace", entityType, name)
+	}
+}
+
+// AssertProperty fails the test unless the entity's property equals want,
+// converted with Value.
+func AssertProperty(tb testing.TB, entity ast.Entity, key string, want interface{}) {
+	tb.Helper()
+	got, ok := entity.GetProperty(key)
+	if !ok {
+		tb.Errorf("expected %s %q to have property %s", entity.Type(), entity.Name(), key)
+		return
+	}
+	if w := Value(want); !reflect.DeepEqual(got, w) {
+		tb.Errorf("%s %q property %s = %#v, want %#v", entity.Type(), entity.Name(), key, got, w)
+	}
+}
+
+// AssertRelated fails the test unless ws has the relationship.
+func AssertRelated(tb testing.TB, ws *workspace.Workspace, sourceType, sourceName, targetType, targetName string, relType workspace.RelationType) {
+	tb.Helper()
+	for _, rel := range ws.GetRelationshipsForEntity(sourceType, sourceName) {
+		if rel.SourceType == sourceType && rel.SourceName == sourceName &&
+			rel.TargetType == targetType && rel.TargetName == targetName && rel.Type == relType {
+			return
+		}
+	}
+	tb.Errorf("expected %s %q to be related (%s) to %s %q", sourceType, sourceName, relType, targetType, targetName)
+}
@@ -0,0 +1,109 @@
+package testutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/workspace"
+)
+
+// recorder is a testing.TB that records failures instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestBuilders_MatchParsedSource(t *testing.T) {
+	built := Workspace(t,
+		Agent("reviewer").Model("gpt-4o").Temperature(0.2).Tools("search").Build(),
+		Tool("search").Command("grep -r {{query}} .").Build(),
+		Pipeline("review").Step(
+			Step("check").Use("reviewer").Input("Review the diff"),
+		).Build(),
+	)
+	parsed := WorkspaceFrom(t, `
+agent "reviewer" {
+	model: "gpt-4o"
+	temperature: 0.2
+	tools: [tool("search")]
+}
+
+tool "search" {
+	command: "grep -r {{query}} ."
+}
+
+pipeline "review" {
+	step "check" {
+		use: agent("reviewer")
+		input: "Review the diff"
+	}
+}
+`)
+
+	for _, ws := range []*workspace.Workspace{built, parsed} {
+		agent := AssertEntityExists(t, ws, "agent", "reviewer")
+		AssertProperty(t, agent, "model", "gpt-4o")
+		AssertProperty(t, agent, "temperature", 0.2)
+		AssertProperty(t, agent, "tools", ast.ArrayValue{Elements: []ast.Value{
+			ast.ReferenceValue{Type: "tool", Name: "search", Path: []string{}},
+		}})
+		AssertEntityExists(t, ws, "tool", "search")
+		AssertEntityMissing(t, ws, "agent", "writer")
+
+		pipeline := AssertEntityExists(t, ws, "pipeline", "review").(*ast.PipelineEntity)
+		if len(pipeline.Steps) != 1 {
+			t.Fatalf("expected one step, got %d", len(pipeline.Steps))
+		}
+		AssertProperty(t, pipeline.Steps[0], "use", ast.ReferenceValue{Type: "agent", Name: "reviewer", Path: []string{}})
+	}
+}
+
+func TestAssertions_ReportFailures(t *testing.T) {
+	ws := Workspace(t, Agent("reviewer").Model("gpt-4o").Build(), Tool("search").Build())
+
+	r := &recorder{TB: t}
+	AssertEntityExists(r, ws, "agent", "writer")
+	if !r.fatal {
+		t.Error("expected a missing entity to fail the test")
+	}
+
+	r = &recorder{TB: t}
+	agent := AssertEntityExists(r, ws, "agent", "reviewer")
+	AssertProperty(r, agent, "model", "claude")
+	AssertProperty(r, agent, "instruction", "Review code")
+	AssertRelated(r, ws, "agent", "reviewer", "tool", "search", workspace.RelationTypeDepends)
+	if len(r.errors) != 3 || r.fatal {
+		t.Errorf("expected three failures, got %q", r.errors)
+	}
+
+	if err := ws.AddRelationship("agent", "reviewer", "tool", "search", workspace.RelationTypeDepends); err != nil {
+		t.Fatal(err)
+	}
+	r = &recorder{TB: t}
+	AssertRelated(r, ws, "agent", "reviewer", "tool", "search", workspace.RelationTypeDepends)
+	AssertRelated(r, ws, "agent", "reviewer", "tool", "search", workspace.RelationTypeConsumes)
+	if len(r.errors) != 1 {
+		t.Errorf("expected only the missing relationship to fail, got %q", r.errors)
+	}
+}
+
+func TestWorkspaceFrom_ParseError(t *testing.T) {
+	r := &recorder{TB: t}
+	WorkspaceFrom(r, `agent "reviewer" {`)
+	if !r.fatal {
+		t.Error("expected invalid source to fail the test")
+	}
+}
@@ -3,15 +3,20 @@
 package workspace
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/i18n"
 	"github.com/shellkjell/langspace/pkg/slices"
 	"github.com/shellkjell/langspace/pkg/validator"
 )
@@ -77,13 +82,17 @@ const (
 	EventRelationshipRemoved EventType = "relationship_removed"
 	// EventWorkspaceCleared is emitted when the workspace is cleared
 	EventWorkspaceCleared EventType = "workspace_cleared"
+	// EventWorkspaceLoaded is emitted when the workspace is replaced by loaded or restored state
+	EventWorkspaceLoaded EventType = "workspace_loaded"
 )
 
 // Event represents a workspace event
 type Event struct {
+	Seq          uint64        // Monotonically increasing sequence number of the mutation
 	Type         EventType     // The type of event
 	Entity       ast.Entity    // The entity involved (for entity events)
 	Relationship *Relationship // The relationship involved (for relationship events)
+	Timestamp    int64         // Unix timestamp when the mutation happened
 }
 
 // EventHandler is a function that handles workspace events
@@ -117,6 +126,16 @@ type Config struct {
 	EnableVersioning bool `json:"enable_versioning,omitempty"`
 	// AllowedEntityTypes restricts which entity types can be added (empty = all allowed)
 	AllowedEntityTypes []string `json:"allowed_entity_types,omitempty"`
+	// PreserveUnknown keeps unknown entity types and value kinds as opaque blobs
+	// when loading, so they survive a Serialize/LoadFrom round trip
+	PreserveUnknown bool `json:"preserve_unknown,omitempty"`
+	// MaxChanges limits the number of events kept in the change feed (0 = unlimited)
+	MaxChanges int `json:"max_changes,omitempty"`
+	// MigrationMode controls how LoadFrom handles older or newer saved state (default lenient)
+	MigrationMode MigrationMode `json:"migration_mode,omitempty"`
+	// OrderedBatches makes AddEntitiesBatch and UpsertEntitiesBatch store
+	// entities, and emit their events, in input order rather than completion order
+	OrderedBatches bool `json:"ordered_batches,omitempty"`
 }
 
 // DefaultConfig returns a Config with sensible defaults.
@@ -129,6 +148,8 @@ func DefaultConfig() *Config {
 		StrictValidation:    true,  // require validation
 		EnableVersioning:    false, // disabled by default
 		AllowedEntityTypes:  nil,   // all types allowed
+		MaxChanges:          1000,  // keep last 1000 changes
+		MigrationMode:       MigrationLenient,
 	}
 }
 
@@ -138,14 +159,20 @@ type EntityValidatorFunc func(entity ast.Entity) error
 
 // Workspace represents a virtual workspace containing entities
 type Workspace struct {
-	entities          []ast.Entity
+	entities          *entityStore
 	relationships     []Relationship
 	hooks             map[HookType][]EntityHook
 	eventHandlers     []EventHandler
 	entityVersions    map[string][]EntityVersion // Maps entity key to version history
 	versioningEnabled bool
+	published         map[string][]publishedVersion // Maps entity key to published versions
 	config            *Config
 	customValidators  map[string][]EntityValidatorFunc // Maps entity type to validators
+	migrator          *Migrator
+	changes           changeLog
+	searchIndex       *SearchIndex
+	searchOnce        sync.Once
+	semanticIndex     *SemanticIndex
 	mu                sync.RWMutex
 	validator         validator.EntityValidator
 }
@@ -153,7 +180,7 @@ type Workspace struct {
 // New creates a new Workspace instance
 func New() *Workspace {
 	return &Workspace{
-		entities:          make([]ast.Entity, 0),
+		entities:          newEntityStore(0),
 		relationships:     make([]Relationship, 0),
 		hooks:             make(map[HookType][]EntityHook),
 		eventHandlers:     make([]EventHandler, 0),
@@ -189,14 +216,14 @@ func (w *Workspace) Stat() WorkspaceStats {
 	}
 
 	stats := WorkspaceStats{
-		TotalEntities:      len(w.entities),
+		TotalEntities:      w.entities.len(),
 		TotalRelationships: len(w.relationships),
 		TotalHooks:         totalHooks,
 		HasValidator:       w.validator != nil,
 	}
 
 	// Count entities by type
-	for _, entity := range w.entities {
+	for _, entity := range w.entities.all() {
 		switch entity.Type() {
 		case "file":
 			stats.FileEntities++
@@ -308,6 +335,15 @@ func (w *Workspace) GetConfig() Config {
 	return cfg
 }
 
+// WithMigrator sets the migrator used by LoadFrom to upgrade saved state.
+// By default the package-level DefaultMigrator is used.
+func (w *Workspace) WithMigrator(m *Migrator) *Workspace {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.migrator = m
+	return w
+}
+
 // WithVersioning enables entity version tracking.
 // When enabled, the workspace maintains a history of all entity versions,
 // allowing you to retrieve previous states of entities.
@@ -409,6 +445,7 @@ func (w *Workspace) OnEvent(handler EventHandler) *Workspace {
 // emit sends an event to all registered event handlers.
 // This is called after operations complete successfully.
 func (w *Workspace) emit(event Event) {
+	event = w.recordChange(event)
 	for _, handler := range w.eventHandlers {
 		handler(event)
 	}
@@ -427,6 +464,12 @@ func (w *Workspace) runHooks(hookType HookType, entity ast.Entity) error {
 
 // AddEntity adds an entity to the workspace
 func (w *Workspace) AddEntity(entity ast.Entity) error {
+	return w.AddEntityCtx(context.Background(), entity)
+}
+
+// AddEntityCtx is AddEntity that fails with ctx's error, leaving the
+// workspace unchanged, if ctx is done before the entity is added.
+func (w *Workspace) AddEntityCtx(ctx context.Context, entity ast.Entity) error {
 	if entity == nil {
 		return fmt.Errorf("cannot add nil entity")
 	}
@@ -434,6 +477,10 @@ func (w *Workspace) AddEntity(entity ast.Entity) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Check configuration constraints
 	if err := w.checkAddConstraints(entity); err != nil {
 		return err
@@ -455,7 +502,7 @@ func (w *Workspace) AddEntity(entity ast.Entity) error {
 		return fmt.Errorf("custom validation failed: %w", err)
 	}
 
-	w.entities = append(w.entities, entity)
+	w.entities.add(entity)
 
 	// Record version if versioning is enabled
 	w.recordVersion(entity)
@@ -477,8 +524,8 @@ func (w *Workspace) checkAddConstraints(entity ast.Entity) error {
 	}
 
 	// Check max entities limit
-	if w.config.MaxEntities > 0 && len(w.entities) >= w.config.MaxEntities {
-		return fmt.Errorf("maximum entity limit reached (%d)", w.config.MaxEntities)
+	if w.config.MaxEntities > 0 && w.entities.len() >= w.config.MaxEntities {
+		return fmt.Errorf("%w (%d)", ErrEntityLimit, w.config.MaxEntities)
 	}
 
 	// Check allowed entity types
@@ -497,10 +544,8 @@ func (w *Workspace) checkAddConstraints(entity ast.Entity) error {
 
 	// Check for duplicate names (unless explicitly allowed)
 	if !w.config.AllowDuplicateNames {
-		for _, e := range w.entities {
-			if e.Type() == entity.Type() && e.Name() == entity.Name() {
-				return fmt.Errorf("entity %s/%s already exists", entity.Type(), entity.Name())
-			}
+		if _, exists := w.entities.get(entity.Type(), entity.Name()); exists {
+			return i18n.New(i18n.DuplicateEntity, entity.Type(), entity.Name())
 		}
 	}
 
@@ -513,9 +558,7 @@ func (w *Workspace) GetEntities() []ast.Entity {
 	defer w.mu.RUnlock()
 
 	// Return a copy to prevent external modifications
-	result := make([]ast.Entity, len(w.entities))
-	copy(result, w.entities)
-	return result
+	return w.entities.all()
 }
 
 // GetEntitiesByType returns all entities of a specific type
@@ -523,9 +566,7 @@ func (w *Workspace) GetEntitiesByType(entityType string) []ast.Entity {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	return slices.Filter(w.entities, func(e ast.Entity) bool {
-		return e.Type() == entityType
-	})
+	return w.entities.ofType(entityType)
 }
 
 // GetEntityByName returns an entity by type and name
@@ -533,46 +574,94 @@ func (w *Workspace) GetEntityByName(entityType, entityName string) (ast.Entity,
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	return slices.Find(w.entities, func(e ast.Entity) bool {
-		return e.Type() == entityType && e.Name() == entityName
-	})
+	return w.entities.get(entityType, entityName)
+}
+
+// GetEntitiesByTag returns all entities tagged with tag (see ast.Tags), of
+// any type, in the order they were added
+func (w *Workspace) GetEntitiesByTag(tag string) []ast.Entity {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var tagged []ast.Entity
+	for _, entity := range w.entities.all() {
+		if ast.HasTag(entity, tag) {
+			tagged = append(tagged, entity)
+		}
+	}
+	return tagged
+}
+
+// GetTags returns every tag used by an entity in the workspace, sorted
+func (w *Workspace) GetTags() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, entity := range w.entities.all() {
+		for _, tag := range ast.Tags(entity) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
 }
 
 // RemoveEntity removes an entity from the workspace by type and name
 func (w *Workspace) RemoveEntity(entityType, entityName string) error {
+	return w.RemoveEntityCtx(context.Background(), entityType, entityName)
+}
+
+// RemoveEntityCtx is RemoveEntity that fails with ctx's error, leaving the
+// workspace unchanged, if ctx is done before the entity is removed.
+func (w *Workspace) RemoveEntityCtx(ctx context.Context, entityType, entityName string) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	for i, entity := range w.entities {
-		if entity.Type() == entityType && entity.Name() == entityName {
-			// Run before-remove hooks
-			if err := w.runHooks(HookBeforeRemove, entity); err != nil {
-				return err
-			}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	se := w.entities.lookup(entityType, entityName)
+	if se == nil {
+		return fmt.Errorf("entity not found: %s %q", entityType, entityName)
+	}
+	entity := se.entity
 
-			// Remove the entity
-			w.entities = append(w.entities[:i], w.entities[i+1:]...)
+	// Run before-remove hooks
+	if err := w.runHooks(HookBeforeRemove, entity); err != nil {
+		return err
+	}
 
-			// Remove any relationships involving this entity
-			w.removeRelationshipsForEntity(entityType, entityName)
+	// Remove the entity
+	w.entities.remove(se)
 
-			// Run after-remove hooks
-			_ = w.runHooks(HookAfterRemove, entity)
+	// Remove any relationships involving this entity
+	w.removeRelationshipsForEntity(entityType, entityName)
 
-			// Emit entity removed event
-			w.emit(Event{Type: EventEntityRemoved, Entity: entity})
+	// Run after-remove hooks
+	_ = w.runHooks(HookAfterRemove, entity)
 
-			return nil
-		}
-	}
+	// Emit entity removed event
+	w.emit(Event{Type: EventEntityRemoved, Entity: entity})
 
-	return fmt.Errorf("entity not found: %s %q", entityType, entityName)
+	return nil
 }
 
 // UpdateEntity replaces an existing entity with a new version.
 // The entity must already exist in the workspace.
 // Hooks are called before and after the update.
 func (w *Workspace) UpdateEntity(entity ast.Entity) error {
+	return w.UpdateEntityCtx(context.Background(), entity)
+}
+
+// UpdateEntityCtx is UpdateEntity that fails with ctx's error, leaving the
+// workspace unchanged, if ctx is done before the entity is replaced.
+func (w *Workspace) UpdateEntityCtx(ctx context.Context, entity ast.Entity) error {
 	if entity == nil {
 		return fmt.Errorf("cannot update with nil entity")
 	}
@@ -580,11 +669,13 @@ func (w *Workspace) UpdateEntity(entity ast.Entity) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Find the existing entity
-	idx := slices.FindIndex(w.entities, func(e ast.Entity) bool {
-		return e.Type() == entity.Type() && e.Name() == entity.Name()
-	})
-	if idx == -1 {
+	existing := w.entities.lookup(entity.Type(), entity.Name())
+	if existing == nil {
 		return fmt.Errorf("entity not found: %s %q", entity.Type(), entity.Name())
 	}
 
@@ -606,7 +697,7 @@ func (w *Workspace) UpdateEntity(entity ast.Entity) error {
 	}
 
 	// Replace the entity
-	w.entities[idx] = entity
+	w.entities.replace(existing, entity)
 
 	// Record version if versioning is enabled
 	w.recordVersion(entity)
@@ -623,6 +714,12 @@ func (w *Workspace) UpdateEntity(entity ast.Entity) error {
 // UpsertEntity adds an entity if it doesn't exist, or updates it if it does.
 // This is a convenience method combining AddEntity and UpdateEntity behavior.
 func (w *Workspace) UpsertEntity(entity ast.Entity) error {
+	return w.UpsertEntityCtx(context.Background(), entity)
+}
+
+// UpsertEntityCtx is UpsertEntity that fails with ctx's error, leaving the
+// workspace unchanged, if ctx is done before the entity is stored.
+func (w *Workspace) UpsertEntityCtx(ctx context.Context, entity ast.Entity) error {
 	if entity == nil {
 		return fmt.Errorf("cannot upsert nil entity")
 	}
@@ -630,12 +727,14 @@ func (w *Workspace) UpsertEntity(entity ast.Entity) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Check if entity already exists
-	idx := slices.FindIndex(w.entities, func(e ast.Entity) bool {
-		return e.Type() == entity.Type() && e.Name() == entity.Name()
-	})
+	existing := w.entities.lookup(entity.Type(), entity.Name())
 
-	if idx >= 0 {
+	if existing != nil {
 		// Update existing entity
 		if err := w.runHooks(HookBeforeUpdate, entity); err != nil {
 			return err
@@ -652,7 +751,7 @@ func (w *Workspace) UpsertEntity(entity ast.Entity) error {
 			return fmt.Errorf("custom validation failed: %w", err)
 		}
 
-		w.entities[idx] = entity
+		w.entities.replace(existing, entity)
 		w.recordVersion(entity)
 		_ = w.runHooks(HookAfterUpdate, entity)
 		w.emit(Event{Type: EventEntityUpdated, Entity: entity})
@@ -673,7 +772,7 @@ func (w *Workspace) UpsertEntity(entity ast.Entity) error {
 			return fmt.Errorf("custom validation failed: %w", err)
 		}
 
-		w.entities = append(w.entities, entity)
+		w.entities.add(entity)
 		w.recordVersion(entity)
 		_ = w.runHooks(HookAfterAdd, entity)
 		w.emit(Event{Type: EventEntityAdded, Entity: entity})
@@ -691,6 +790,10 @@ type ProcessResult struct {
 // EntityProcessor is a function that processes an entity and returns a result.
 type EntityProcessor func(entity ast.Entity) error
 
+// EntityProcessorCtx is an EntityProcessor that receives the context of the
+// batch, for cancellation and tracing.
+type EntityProcessorCtx func(ctx context.Context, entity ast.Entity) error
+
 // EntityTransformer is a function that transforms an entity into a new entity.
 type EntityTransformer func(entity ast.Entity) (ast.Entity, error)
 
@@ -794,7 +897,7 @@ func (p *Pipeline) ExecuteAll(entities []ast.Entity) []PipelineResult {
 func (w *Workspace) ExecutePipeline(pipeline *Pipeline, predicate EntityPredicate) []PipelineResult {
 	w.mu.RLock()
 	var entities []ast.Entity
-	for _, e := range w.entities {
+	for _, e := range w.entities.all() {
 		if predicate == nil || predicate(e) {
 			entities = append(entities, e)
 		}
@@ -833,6 +936,23 @@ func (w *Workspace) ExecutePipelineAndUpdate(pipeline *Pipeline, predicate Entit
 // It returns a slice of results for each entity processed.
 // The maxConcurrency parameter limits the number of concurrent operations (0 = no limit).
 func (w *Workspace) ProcessEntitiesConcurrently(entities []ast.Entity, processor EntityProcessor, maxConcurrency int) []ProcessResult {
+	return w.ProcessEntitiesConcurrentlyCtx(context.Background(), entities, func(_ context.Context, e ast.Entity) error {
+		return processor(e)
+	}, maxConcurrency)
+}
+
+// ProcessEntitiesConcurrentlyCtx is ProcessEntitiesConcurrently that stops
+// starting entities once ctx is done: their results carry ctx's error, while
+// entities already being processed finish. processor receives ctx.
+func (w *Workspace) ProcessEntitiesConcurrentlyCtx(ctx context.Context, entities []ast.Entity, processor EntityProcessorCtx, maxConcurrency int) []ProcessResult {
+	return processConcurrently(ctx, entities, func(ctx context.Context, _ int, e ast.Entity) error {
+		return processor(ctx, e)
+	}, maxConcurrency)
+}
+
+// processConcurrently implements ProcessEntitiesConcurrentlyCtx for a
+// processor that also receives the entity's index.
+func processConcurrently(ctx context.Context, entities []ast.Entity, processor func(ctx context.Context, idx int, e ast.Entity) error, maxConcurrency int) []ProcessResult {
 	if len(entities) == 0 {
 		return nil
 	}
@@ -848,13 +968,24 @@ func (w *Workspace) ProcessEntitiesConcurrently(entities []ast.Entity, processor
 	var wg sync.WaitGroup
 
 	for i, entity := range entities {
+		// Acquire semaphore, unless cancelled while waiting for it
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = ProcessResult{Entity: entity, Error: ctx.Err()}
+			continue
+		}
+
 		wg.Add(1)
 		go func(idx int, e ast.Entity) {
 			defer wg.Done()
-			sem <- struct{}{}        // Acquire semaphore
 			defer func() { <-sem }() // Release semaphore
 
-			err := processor(e)
+			if err := ctx.Err(); err != nil {
+				results[idx] = ProcessResult{Entity: e, Error: err}
+				return
+			}
+			err := processor(ctx, idx, e)
 			results[idx] = ProcessResult{Entity: e, Error: err}
 		}(i, entity)
 	}
@@ -866,25 +997,70 @@ func (w *Workspace) ProcessEntitiesConcurrently(entities []ast.Entity, processor
 // AddEntitiesBatch adds multiple entities concurrently.
 // Returns a slice of results indicating success or failure for each entity.
 // The maxConcurrency parameter limits the number of concurrent add operations.
+// Entities are stored in the order they finish unless Config.OrderedBatches
+// is set.
 func (w *Workspace) AddEntitiesBatch(entities []ast.Entity, maxConcurrency int) []ProcessResult {
-	return w.ProcessEntitiesConcurrently(entities, func(entity ast.Entity) error {
-		return w.AddEntity(entity)
-	}, maxConcurrency)
+	return w.AddEntitiesBatchCtx(context.Background(), entities, maxConcurrency)
+}
+
+// AddEntitiesBatchCtx is AddEntitiesBatch that stops adding entities once
+// ctx is done; the results of those not added carry ctx's error.
+func (w *Workspace) AddEntitiesBatchCtx(ctx context.Context, entities []ast.Entity, maxConcurrency int) []ProcessResult {
+	return w.storeBatch(ctx, entities, w.AddEntityCtx, maxConcurrency)
 }
 
 // UpdateEntitiesBatch updates multiple entities concurrently.
 // Returns a slice of results indicating success or failure for each entity.
 func (w *Workspace) UpdateEntitiesBatch(entities []ast.Entity, maxConcurrency int) []ProcessResult {
-	return w.ProcessEntitiesConcurrently(entities, func(entity ast.Entity) error {
-		return w.UpdateEntity(entity)
-	}, maxConcurrency)
+	return w.UpdateEntitiesBatchCtx(context.Background(), entities, maxConcurrency)
+}
+
+// UpdateEntitiesBatchCtx is UpdateEntitiesBatch that stops updating entities
+// once ctx is done; the results of those not updated carry ctx's error.
+func (w *Workspace) UpdateEntitiesBatchCtx(ctx context.Context, entities []ast.Entity, maxConcurrency int) []ProcessResult {
+	return w.ProcessEntitiesConcurrentlyCtx(ctx, entities, w.UpdateEntityCtx, maxConcurrency)
 }
 
 // UpsertEntitiesBatch upserts multiple entities concurrently.
 // Returns a slice of results indicating success or failure for each entity.
+// New entities are stored in the order they finish unless
+// Config.OrderedBatches is set.
 func (w *Workspace) UpsertEntitiesBatch(entities []ast.Entity, maxConcurrency int) []ProcessResult {
-	return w.ProcessEntitiesConcurrently(entities, func(entity ast.Entity) error {
-		return w.UpsertEntity(entity)
+	return w.UpsertEntitiesBatchCtx(context.Background(), entities, maxConcurrency)
+}
+
+// UpsertEntitiesBatchCtx is UpsertEntitiesBatch that stops upserting
+// entities once ctx is done; the results of those not stored carry ctx's
+// error.
+func (w *Workspace) UpsertEntitiesBatchCtx(ctx context.Context, entities []ast.Entity, maxConcurrency int) []ProcessResult {
+	return w.storeBatch(ctx, entities, w.UpsertEntityCtx, maxConcurrency)
+}
+
+// storeBatch stores entities concurrently with store. With
+// Config.OrderedBatches, each store waits for the previous entity's to
+// finish, so entities are stored in input order.
+func (w *Workspace) storeBatch(ctx context.Context, entities []ast.Entity, store EntityProcessorCtx, maxConcurrency int) []ProcessResult {
+	if !w.GetConfig().OrderedBatches {
+		return w.ProcessEntitiesConcurrentlyCtx(ctx, entities, store, maxConcurrency)
+	}
+
+	// Entities take their semaphore slots in input order, so the previous
+	// entity is always running or done and waiting for it cannot deadlock
+	turns := make([]chan struct{}, len(entities))
+	for i := range turns {
+		turns[i] = make(chan struct{})
+	}
+	return processConcurrently(ctx, entities, func(ctx context.Context, idx int, e ast.Entity) error {
+		defer close(turns[idx])
+		if idx > 0 {
+			select {
+			case <-turns[idx-1]:
+			case <-ctx.Done():
+				// The previous entity may never run once cancelled
+				return ctx.Err()
+			}
+		}
+		return store(ctx, e)
 	}, maxConcurrency)
 }
 
@@ -895,7 +1071,7 @@ func (w *Workspace) TransformEntities(predicate EntityPredicate, transformer Ent
 	w.mu.RLock()
 	// Find entities matching predicate
 	var toTransform []ast.Entity
-	for _, entity := range w.entities {
+	for _, entity := range w.entities.all() {
 		if predicate(entity) {
 			toTransform = append(toTransform, entity)
 		}
@@ -950,8 +1126,7 @@ func (w *Workspace) TransformEntities(predicate EntityPredicate, transformer Ent
 // This is useful when the predicate is expensive to compute.
 func (w *Workspace) FilterEntitiesConcurrently(predicate EntityPredicate, maxConcurrency int) []ast.Entity {
 	w.mu.RLock()
-	entities := make([]ast.Entity, len(w.entities))
-	copy(entities, w.entities)
+	entities := w.entities.all()
 	w.mu.RUnlock()
 
 	if len(entities) == 0 {
@@ -992,8 +1167,7 @@ func (w *Workspace) FilterEntitiesConcurrently(predicate EntityPredicate, maxCon
 // Unlike ProcessEntitiesConcurrently, this operates on the workspace's own entities.
 func (w *Workspace) ForEachEntity(fn EntityProcessor, maxConcurrency int) []ProcessResult {
 	w.mu.RLock()
-	entities := make([]ast.Entity, len(w.entities))
-	copy(entities, w.entities)
+	entities := w.entities.all()
 	w.mu.RUnlock()
 
 	return w.ProcessEntitiesConcurrently(entities, fn, maxConcurrency)
@@ -1002,12 +1176,7 @@ func (w *Workspace) ForEachEntity(fn EntityProcessor, maxConcurrency int) []Proc
 // ForEachEntityOfType executes a function for each entity of a specific type concurrently.
 func (w *Workspace) ForEachEntityOfType(entityType string, fn EntityProcessor, maxConcurrency int) []ProcessResult {
 	w.mu.RLock()
-	var entities []ast.Entity
-	for _, e := range w.entities {
-		if e.Type() == entityType {
-			entities = append(entities, e)
-		}
-	}
+	entities := w.entities.ofType(entityType)
 	w.mu.RUnlock()
 
 	return w.ProcessEntitiesConcurrently(entities, fn, maxConcurrency)
@@ -1027,7 +1196,7 @@ func (w *Workspace) Clear() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	w.entities = make([]ast.Entity, 0)
+	w.entities = newEntityStore(0)
 	w.relationships = make([]Relationship, 0)
 
 	// Emit workspace cleared event
@@ -1045,18 +1214,12 @@ func (w *Workspace) AddRelationship(sourceType, sourceName, targetType, targetNa
 	}
 
 	// Validate that source entity exists
-	sourceExists := slices.Any(w.entities, func(e ast.Entity) bool {
-		return e.Type() == sourceType && e.Name() == sourceName
-	})
-	if !sourceExists {
+	if _, sourceExists := w.entities.get(sourceType, sourceName); !sourceExists {
 		return fmt.Errorf("source entity not found: %s %q", sourceType, sourceName)
 	}
 
 	// Validate that target entity exists
-	targetExists := slices.Any(w.entities, func(e ast.Entity) bool {
-		return e.Type() == targetType && e.Name() == targetName
-	})
-	if !targetExists {
+	if _, targetExists := w.entities.get(targetType, targetName); !targetExists {
 		return fmt.Errorf("target entity not found: %s %q", targetType, targetName)
 	}
 
@@ -1132,9 +1295,7 @@ func (w *Workspace) GetRelatedEntities(entityType, entityName string, relType Re
 			targetName = rel.SourceName
 		}
 
-		if entity, found := slices.Find(w.entities, func(e ast.Entity) bool {
-			return e.Type() == targetType && e.Name() == targetName
-		}); found {
+		if entity, found := w.entities.get(targetType, targetName); found {
 			result = append(result, entity)
 		}
 	}
@@ -1142,6 +1303,57 @@ func (w *Workspace) GetRelatedEntities(entityType, entityName string, relType Re
 	return result
 }
 
+// GetAssignedTools returns the names of tool and mcp entities linked to an agent
+// through an "assigned" relationship (agent -assigned-> tool).
+func (w *Workspace) GetAssignedTools(agentName string) []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var names []string
+	for _, rel := range w.relationships {
+		if rel.Type != RelationTypeAssigned || rel.SourceType != "agent" || rel.SourceName != agentName {
+			continue
+		}
+		if rel.TargetType == "tool" || rel.TargetType == "mcp" {
+			names = append(names, rel.TargetName)
+		}
+	}
+	return names
+}
+
+// ValidateToolUsage reports tools that are declared in the workspace but not
+// available to any agent, either through its `tools:` property or an
+// "assigned" relationship.
+func (w *Workspace) ValidateToolUsage() []validator.Warning {
+	entities := w.GetEntities()
+
+	assigned := make(map[string][]string)
+	for _, e := range entities {
+		if e.Type() == "agent" {
+			if tools := w.GetAssignedTools(e.Name()); len(tools) > 0 {
+				assigned[e.Name()] = tools
+			}
+		}
+	}
+
+	return validator.New().CheckUnusedTools(entities, assigned)
+}
+
+// ValidateSemantics checks the workspace as a whole: that references name
+// declared entities, pipeline steps only use the outputs of earlier steps,
+// pipelines do not reference each other in a cycle, and agents' tools are
+// declared. externalTools names tools provided outside the workspace, such as
+// Go handlers registered with a runtime. See validator.CheckSemantics.
+func (w *Workspace) ValidateSemantics(externalTools ...string) []validator.SemanticError {
+	return validator.New().CheckSemantics(w.GetEntities(), externalTools)
+}
+
+// ValidateRules checks the workspace against registered rule sets, such as
+// an organization's policies. See validator.RegisterRuleSet.
+func (w *Workspace) ValidateRules(sets ...string) ([]validator.RuleError, error) {
+	return validator.New().CheckRules(w.GetEntities(), sets...)
+}
+
 // RemoveRelationship removes a specific relationship
 func (w *Workspace) RemoveRelationship(sourceType, sourceName, targetType, targetName string, relType RelationType) error {
 	w.mu.Lock()
@@ -1227,24 +1439,32 @@ func serializeValue(v ast.Value) (SerializedProperty, error) {
 		prop.Value = data
 	case ast.ReferenceValue:
 		prop.Type = "reference"
-		data, _ := json.Marshal(map[string]interface{}{
+		ref := map[string]interface{}{
 			"type": val.Type,
 			"name": val.Name,
 			"path": val.Path,
-		})
+		}
+		if val.Version != "" {
+			ref["version"] = val.Version
+		}
+		data, _ := json.Marshal(ref)
 		prop.Value = data
 	case ast.VariableValue:
 		prop.Type = "variable"
 		data, _ := json.Marshal(val.Name)
 		prop.Value = data
+	case ast.OpaqueValue:
+		prop.Type = val.Kind
+		prop.Value = json.RawMessage(val.Data)
 	default:
 		return prop, fmt.Errorf("unsupported value type: %T", v)
 	}
 	return prop, nil
 }
 
-// deserializeValue converts a SerializedProperty back to an ast.Value
-func deserializeValue(prop SerializedProperty) (ast.Value, error) {
+// deserializeValue converts a SerializedProperty back to an ast.Value.
+// Unknown kinds become ast.OpaqueValue when preserveUnknown is set.
+func deserializeValue(prop SerializedProperty, preserveUnknown bool) (ast.Value, error) {
 	switch prop.Type {
 	case "string":
 		var s string
@@ -1271,7 +1491,7 @@ func deserializeValue(prop SerializedProperty) (ast.Value, error) {
 		}
 		values := make([]ast.Value, len(elements))
 		for i, elem := range elements {
-			v, err := deserializeValue(elem)
+			v, err := deserializeValue(elem, preserveUnknown)
 			if err != nil {
 				return nil, err
 			}
@@ -1280,14 +1500,15 @@ func deserializeValue(prop SerializedProperty) (ast.Value, error) {
 		return ast.ArrayValue{Elements: values}, nil
 	case "reference":
 		var ref struct {
-			Type string   `json:"type"`
-			Name string   `json:"name"`
-			Path []string `json:"path"`
+			Type    string   `json:"type"`
+			Name    string   `json:"name"`
+			Path    []string `json:"path"`
+			Version string   `json:"version"`
 		}
 		if err := json.Unmarshal(prop.Value, &ref); err != nil {
 			return nil, err
 		}
-		return ast.ReferenceValue{Type: ref.Type, Name: ref.Name, Path: ref.Path}, nil
+		return ast.ReferenceValue{Type: ref.Type, Name: ref.Name, Path: ref.Path, Version: ref.Version}, nil
 	case "variable":
 		var name string
 		if err := json.Unmarshal(prop.Value, &name); err != nil {
@@ -1295,6 +1516,9 @@ func deserializeValue(prop SerializedProperty) (ast.Value, error) {
 		}
 		return ast.VariableValue{Name: name}, nil
 	default:
+		if preserveUnknown {
+			return ast.OpaqueValue{Kind: prop.Type, Data: append([]byte(nil), prop.Value...)}, nil
+		}
 		return nil, fmt.Errorf("unsupported value type: %s", prop.Type)
 	}
 }
@@ -1304,13 +1528,19 @@ func (w *Workspace) Serialize() (*SerializedWorkspace, error) {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
+	return serializeEntities(CurrentSchemaVersion, w.entities.all(), w.relationships)
+}
+
+// serializeEntities converts entities and relationships to a
+// SerializedWorkspace of the given schema version.
+func serializeEntities(version int, entities []ast.Entity, relationships []Relationship) (*SerializedWorkspace, error) {
 	sw := &SerializedWorkspace{
-		Version:       1,
-		Entities:      make([]SerializedEntity, 0, len(w.entities)),
-		Relationships: make([]SerializedRelationship, 0, len(w.relationships)),
+		Version:       version,
+		Entities:      make([]SerializedEntity, 0, len(entities)),
+		Relationships: make([]SerializedRelationship, 0, len(relationships)),
 	}
 
-	for _, entity := range w.entities {
+	for _, entity := range entities {
 		se := SerializedEntity{
 			Type:       entity.Type(),
 			Name:       entity.Name(),
@@ -1331,15 +1561,24 @@ func (w *Workspace) Serialize() (*SerializedWorkspace, error) {
 		sw.Entities = append(sw.Entities, se)
 	}
 
-	for _, rel := range w.relationships {
+	for _, rel := range relationships {
 		sw.Relationships = append(sw.Relationships, SerializedRelationship(rel))
 	}
 
 	return sw, nil
 }
 
-// SaveTo writes the workspace to an io.Writer in JSON format.
-func (w *Workspace) SaveTo(writer io.Writer) error {
+// SaveTo writes the workspace to an io.Writer, in JSON format unless
+// WithFormat says otherwise.
+func (w *Workspace) SaveTo(writer io.Writer, opts ...SaveOption) error {
+	o := saveOptions{format: FormatJSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.format == FormatBinary {
+		return w.saveBinary(writer)
+	}
+
 	sw, err := w.Serialize()
 	if err != nil {
 		return err
@@ -1350,8 +1589,9 @@ func (w *Workspace) SaveTo(writer io.Writer) error {
 	return encoder.Encode(sw)
 }
 
-// SaveToFile writes the workspace to a file in JSON format.
-func (w *Workspace) SaveToFile(path string) error {
+// SaveToFile writes the workspace to a file, in the format its extension
+// names (see FormatForPath) unless WithFormat says otherwise.
+func (w *Workspace) SaveToFile(path string, opts ...SaveOption) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
@@ -1362,15 +1602,49 @@ func (w *Workspace) SaveToFile(path string) error {
 		}
 	}()
 
-	return w.SaveTo(file)
+	return w.SaveTo(file, append([]SaveOption{WithFormat(FormatForPath(path))}, opts...)...)
 }
 
-// LoadFrom loads entities and relationships from an io.Reader containing JSON.
+// LoadFrom loads entities and relationships from an io.Reader containing
+// JSON or the binary format, which it tells apart by the binary header.
 // This clears the existing workspace and replaces it with the loaded data.
 // Hooks and event handlers are NOT loaded - they must be re-registered.
+//
+// Saved state from older schema versions is upgraded with the workspace's
+// Migrator before loading; Config.MigrationMode decides how strictly
+// mismatches are treated.
 func (w *Workspace) LoadFrom(reader io.Reader) error {
+	br := bufio.NewReader(reader)
+	if isBinary(br) {
+		return w.loadBinary(br)
+	}
+
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(br)
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode workspace: %w", err)
+	}
+	return w.loadDocument(doc)
+}
+
+// loadDocument migrates a decoded JSON workspace and loads it.
+func (w *Workspace) loadDocument(doc map[string]interface{}) error {
+	migrator, mode := w.migration()
+	if _, err := migrator.Migrate(doc, mode); err != nil {
+		return fmt.Errorf("failed to migrate workspace: %w", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode migrated workspace: %w", err)
+	}
+
 	var sw SerializedWorkspace
-	decoder := json.NewDecoder(reader)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if mode == MigrationStrict {
+		decoder.DisallowUnknownFields()
+	}
 	if err := decoder.Decode(&sw); err != nil {
 		return fmt.Errorf("failed to decode workspace: %w", err)
 	}
@@ -1378,7 +1652,20 @@ func (w *Workspace) LoadFrom(reader io.Reader) error {
 	return w.loadFromSerialized(&sw)
 }
 
-// LoadFromFile loads entities and relationships from a JSON file.
+// migration returns the migrator and mode LoadFrom uses.
+func (w *Workspace) migration() (*Migrator, MigrationMode) {
+	w.mu.RLock()
+	migrator := w.migrator
+	mode := w.config.MigrationMode
+	w.mu.RUnlock()
+	if migrator == nil {
+		migrator = DefaultMigrator()
+	}
+	return migrator, mode
+}
+
+// LoadFromFile loads entities and relationships from a file in JSON or the
+// binary format, whatever its extension.
 func (w *Workspace) LoadFromFile(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -1395,24 +1682,18 @@ func (w *Workspace) LoadFromFile(path string) error {
 
 // loadFromSerialized populates the workspace from a SerializedWorkspace.
 func (w *Workspace) loadFromSerialized(sw *SerializedWorkspace) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	// Clear existing data (but keep hooks and event handlers)
-	w.entities = make([]ast.Entity, 0, len(sw.Entities))
-	w.relationships = make([]Relationship, 0, len(sw.Relationships))
-	w.entityVersions = make(map[string][]EntityVersion)
+	preserveUnknown := w.preserveUnknown()
 
-	// Load entities
+	entities := make([]ast.Entity, 0, len(sw.Entities))
 	for _, se := range sw.Entities {
-		entity, err := ast.NewEntity(se.Type, se.Name)
+		entity, err := newLoadedEntity(se.Type, se.Name, preserveUnknown)
 		if err != nil {
-			return fmt.Errorf("failed to create entity %s/%s: %w", se.Type, se.Name, err)
+			return err
 		}
 
 		// Set properties
 		for key, prop := range se.Properties {
-			val, err := deserializeValue(prop)
+			val, err := deserializeValue(prop, preserveUnknown)
 			if err != nil {
 				return fmt.Errorf("failed to deserialize property %s: %w", key, err)
 			}
@@ -1427,7 +1708,49 @@ func (w *Workspace) loadFromSerialized(sw *SerializedWorkspace) error {
 		// Set location
 		entity.SetLocation(se.Line, se.Column)
 
-		w.entities = append(w.entities, entity)
+		entities = append(entities, entity)
+	}
+
+	relationships := make([]Relationship, 0, len(sw.Relationships))
+	for _, sr := range sw.Relationships {
+		relationships = append(relationships, Relationship(sr))
+	}
+
+	w.load(entities, relationships)
+	return nil
+}
+
+func (w *Workspace) preserveUnknown() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config != nil && w.config.PreserveUnknown
+}
+
+// newLoadedEntity creates an empty entity of a saved type, or an opaque
+// one if the type is unknown and preserveUnknown is set.
+func newLoadedEntity(entityType, name string, preserveUnknown bool) (ast.Entity, error) {
+	entity, err := ast.NewEntity(entityType, name)
+	if err != nil {
+		if !preserveUnknown {
+			return nil, fmt.Errorf("failed to create entity %s/%s: %w", entityType, name, err)
+		}
+		entity = ast.NewOpaqueEntity(entityType, name)
+	}
+	return entity, nil
+}
+
+// load replaces the workspace's entities and relationships with loaded ones.
+func (w *Workspace) load(entities []ast.Entity, relationships []Relationship) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Clear existing data (but keep hooks and event handlers)
+	w.entities = newEntityStore(len(entities))
+	w.relationships = relationships
+	w.entityVersions = make(map[string][]EntityVersion)
+
+	for _, entity := range entities {
+		w.entities.add(entity)
 
 		// Record version if versioning is enabled
 		if w.versioningEnabled {
@@ -1440,12 +1763,7 @@ func (w *Workspace) loadFromSerialized(sw *SerializedWorkspace) error {
 		}
 	}
 
-	// Load relationships
-	for _, sr := range sw.Relationships {
-		w.relationships = append(w.relationships, Relationship(sr))
-	}
-
-	return nil
+	w.emit(Event{Type: EventWorkspaceLoaded})
 }
 
 // Snapshot represents a point-in-time snapshot of the workspace state.
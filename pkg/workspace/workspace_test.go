@@ -1,6 +1,7 @@
 package workspace
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -10,9 +11,27 @@ import (
 	"testing"
 
 	"github.com/shellkjell/langspace/pkg/ast"
+	"github.com/shellkjell/langspace/pkg/parser"
 	"github.com/shellkjell/langspace/pkg/validator"
 )
 
+// workspaceFrom returns a workspace of the entities parsed from source. Tests
+// outside this package use testutil.WorkspaceFrom, which imports it.
+func workspaceFrom(t *testing.T, source string) *Workspace {
+	t.Helper()
+	entities, _, err := parser.New(source).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	w := New()
+	for _, e := range entities {
+		if err := w.AddEntity(e); err != nil {
+			t.Fatalf("add entity: %v", err)
+		}
+	}
+	return w
+}
+
 func createFileEntity(name string) ast.Entity {
 	entity, _ := ast.NewEntity("file", name)
 	entity.SetProperty("path", ast.StringValue{Value: "/path/to/" + name})
@@ -116,6 +135,28 @@ func TestWorkspace_GetEntitiesByType(t *testing.T) {
 	}
 }
 
+func TestWorkspace_GetEntitiesByTag(t *testing.T) {
+	w := New()
+	agent := createAgentEntity("reviewer")
+	ast.SetTags(agent, "code", "review")
+	tool := createToolEntity("linter")
+	ast.SetTags(tool, "code")
+	_ = w.AddEntity(agent)
+	_ = w.AddEntity(tool)
+	_ = w.AddEntity(createFileEntity("test.txt"))
+
+	tagged := w.GetEntitiesByTag("code")
+	if len(tagged) != 2 || tagged[0].Name() != "reviewer" || tagged[1].Name() != "linter" {
+		t.Errorf("Workspace.GetEntitiesByTag(code) = %v, want reviewer and linter", tagged)
+	}
+	if tagged := w.GetEntitiesByTag("missing"); len(tagged) != 0 {
+		t.Errorf("Workspace.GetEntitiesByTag(missing) returned %d entities, want 0", len(tagged))
+	}
+	if tags := w.GetTags(); strings.Join(tags, ",") != "code,review" {
+		t.Errorf("Workspace.GetTags() = %v, want [code review]", tags)
+	}
+}
+
 func TestWorkspace_GetEntityByName(t *testing.T) {
 	w := New()
 	_ = w.AddEntity(createFileEntity("test.txt"))
@@ -409,6 +450,29 @@ func TestWorkspace_GetRelatedEntities(t *testing.T) {
 	}
 }
 
+func TestWorkspace_GetAssignedTools(t *testing.T) {
+	w := New()
+
+	_ = w.AddEntity(createAgentEntity("reviewer"))
+	_ = w.AddEntity(createToolEntity("linter"))
+	_ = w.AddEntity(createToolEntity("formatter"))
+	_ = w.AddEntity(createFileEntity("config.json"))
+
+	_ = w.AddRelationship("agent", "reviewer", "tool", "linter", RelationTypeAssigned)
+	_ = w.AddRelationship("agent", "reviewer", "tool", "formatter", RelationTypeConsumes)
+	_ = w.AddRelationship("agent", "reviewer", "file", "config.json", RelationTypeAssigned)
+
+	tools := w.GetAssignedTools("reviewer")
+	if len(tools) != 1 || tools[0] != "linter" {
+		t.Errorf("GetAssignedTools() = %v, want [linter]", tools)
+	}
+
+	warnings := w.ValidateToolUsage()
+	if len(warnings) != 1 || warnings[0].EntityName != "formatter" {
+		t.Errorf("ValidateToolUsage() = %v, want one warning for formatter", warnings)
+	}
+}
+
 func TestWorkspace_RemoveRelationship(t *testing.T) {
 	w := New()
 
@@ -1548,6 +1612,62 @@ func TestWorkspace_Persistence(t *testing.T) {
 			t.Error("LoadFrom should fail on unknown entity type")
 		}
 	})
+
+	t.Run("preserve_unknown_round_trip", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PreserveUnknown = true
+		w := New().WithConfig(cfg)
+		input := `{"version":1,"entities":[
+			{"type":"widget","name":"w1","properties":{"size":{"type":"number","value":3}},"metadata":{"origin":"ext"}},
+			{"type":"agent","name":"a1","properties":{
+				"timeout":{"type":"duration","value":{"seconds":30}},
+				"tags":{"type":"array","value":[{"type":"string","value":"x"},{"type":"symbol","value":"y"}]}
+			}}
+		],"relationships":[]}`
+		if err := w.LoadFrom(strings.NewReader(input)); err != nil {
+			t.Fatalf("LoadFrom() error = %v", err)
+		}
+
+		widget, ok := w.GetEntityByName("widget", "w1")
+		if !ok {
+			t.Fatal("unknown entity type should be loaded as opaque entity")
+		}
+		if _, ok := widget.(*ast.OpaqueEntity); !ok {
+			t.Errorf("expected *ast.OpaqueEntity, got %T", widget)
+		}
+		agent, _ := w.GetEntityByName("agent", "a1")
+		timeout, _ := agent.GetProperty("timeout")
+		if ov, ok := timeout.(ast.OpaqueValue); !ok || ov.Kind != "duration" {
+			t.Errorf("expected opaque duration value, got %#v", timeout)
+		}
+
+		var buf strings.Builder
+		if err := w.SaveTo(&buf); err != nil {
+			t.Fatalf("SaveTo() error = %v", err)
+		}
+
+		w2 := New().WithConfig(cfg)
+		if err := w2.LoadFrom(strings.NewReader(buf.String())); err != nil {
+			t.Fatalf("reloading saved workspace failed: %v", err)
+		}
+		agent2, _ := w2.GetEntityByName("agent", "a1")
+		tags, _ := agent2.GetProperty("tags")
+		elems := tags.(ast.ArrayValue).Elements
+		if ov, ok := elems[1].(ast.OpaqueValue); !ok || ov.Kind != "symbol" || string(ov.Data) != `"y"` {
+			t.Errorf("nested opaque value not preserved, got %#v", elems[1])
+		}
+		timeout2, _ := agent2.GetProperty("timeout")
+		if ov := timeout2.(ast.OpaqueValue); !strings.Contains(string(ov.Data), `"seconds": 30`) && !strings.Contains(string(ov.Data), `"seconds":30`) {
+			t.Errorf("opaque value data not preserved, got %s", ov.Data)
+		}
+		widget2, ok := w2.GetEntityByName("widget", "w1")
+		if !ok {
+			t.Fatal("opaque entity not preserved")
+		}
+		if origin, _ := widget2.GetMetadata("origin"); origin != "ext" {
+			t.Errorf("opaque entity metadata not preserved, got %q", origin)
+		}
+	})
 }
 
 func TestWorkspace_Snapshots(t *testing.T) {
@@ -2320,6 +2440,118 @@ func TestConcurrentProcessing(t *testing.T) {
 		}
 	})
 
+	t.Run("process_cancelled", func(t *testing.T) {
+		w := New()
+
+		var entities []ast.Entity
+		for i := 0; i < 5; i++ {
+			e, _ := ast.NewEntity("file", fmt.Sprintf("file%d.txt", i))
+			entities = append(entities, e)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var processed int32
+		results := w.ProcessEntitiesConcurrentlyCtx(ctx, entities, func(ctx context.Context, e ast.Entity) error {
+			// Cancel while the first entity is being processed
+			atomic.AddInt32(&processed, 1)
+			cancel()
+			return nil
+		}, 1)
+
+		if n := atomic.LoadInt32(&processed); n != 1 {
+			t.Errorf("Expected processing to stop after cancellation, processed %d", n)
+		}
+		for _, r := range results[1:] {
+			if !errors.Is(r.Error, context.Canceled) || r.Entity == nil {
+				t.Errorf("Expected unprocessed entities to report cancellation, got %+v", r)
+			}
+		}
+	})
+
+	t.Run("mutations_cancelled", func(t *testing.T) {
+		w := New()
+		existing := createFileEntity("kept.txt")
+		_ = w.AddEntity(existing)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := w.AddEntityCtx(ctx, createFileEntity("new.txt")); !errors.Is(err, context.Canceled) {
+			t.Errorf("AddEntityCtx: expected context.Canceled, got %v", err)
+		}
+		if err := w.UpdateEntityCtx(ctx, createFileEntity("kept.txt")); !errors.Is(err, context.Canceled) {
+			t.Errorf("UpdateEntityCtx: expected context.Canceled, got %v", err)
+		}
+		if err := w.UpsertEntityCtx(ctx, createFileEntity("new.txt")); !errors.Is(err, context.Canceled) {
+			t.Errorf("UpsertEntityCtx: expected context.Canceled, got %v", err)
+		}
+		if err := w.RemoveEntityCtx(ctx, "file", "kept.txt"); !errors.Is(err, context.Canceled) {
+			t.Errorf("RemoveEntityCtx: expected context.Canceled, got %v", err)
+		}
+		results := w.AddEntitiesBatchCtx(ctx, []ast.Entity{createFileEntity("a.txt"), createFileEntity("b.txt")}, 0)
+		for _, r := range results {
+			if !errors.Is(r.Error, context.Canceled) {
+				t.Errorf("AddEntitiesBatchCtx: expected context.Canceled, got %v", r.Error)
+			}
+		}
+
+		if entities := w.GetEntities(); len(entities) != 1 || entities[0] != existing {
+			t.Errorf("Expected cancelled mutations to leave the workspace unchanged, got %v", entities)
+		}
+	})
+
+	t.Run("ordered_batches", func(t *testing.T) {
+		for run := 0; run < 10; run++ {
+			w := New().WithConfig(&Config{OrderedBatches: true})
+
+			var entities []ast.Entity
+			for i := 0; i < 20; i++ {
+				entities = append(entities, createFileEntity(fmt.Sprintf("file%02d.txt", i)))
+			}
+			var events []string
+			w.OnEvent(func(e Event) {
+				events = append(events, e.Entity.Name())
+			})
+
+			results := w.UpsertEntitiesBatch(entities[10:], 4)
+			results = append(results, w.AddEntitiesBatch(entities[:10], 4)...)
+			for _, r := range results {
+				if r.Error != nil {
+					t.Fatalf("Unexpected error: %v", r.Error)
+				}
+			}
+
+			got := w.GetEntities()
+			want := append(append([]ast.Entity{}, entities[10:]...), entities[:10]...)
+			for i := range want {
+				if got[i] != want[i] || events[i] != want[i].Name() {
+					t.Fatalf("Expected input order, got entity %s and event %s at %d", got[i].Name(), events[i], i)
+				}
+			}
+		}
+	})
+
+	t.Run("ordered_batches_cancelled", func(t *testing.T) {
+		w := New().WithConfig(&Config{OrderedBatches: true})
+		ctx, cancel := context.WithCancel(context.Background())
+		w.OnEntityEvent(HookAfterAdd, func(e ast.Entity) error {
+			cancel()
+			return nil
+		})
+
+		results := w.AddEntitiesBatchCtx(ctx, []ast.Entity{
+			createFileEntity("a.txt"), createFileEntity("b.txt"), createFileEntity("c.txt"),
+		}, 2)
+		if results[0].Error != nil {
+			t.Errorf("Expected the first entity to be added, got %v", results[0].Error)
+		}
+		for _, r := range results[1:] {
+			if !errors.Is(r.Error, context.Canceled) {
+				t.Errorf("Expected later entities to be cancelled, got %v", r.Error)
+			}
+		}
+	})
+
 	t.Run("transform_entities", func(t *testing.T) {
 		w := New()
 
@@ -1,5 +1,13 @@
 import * as path from 'path';
-import { workspace, ExtensionContext } from 'vscode';
+import {
+    workspace,
+    debug,
+    ExtensionContext,
+    DebugAdapterDescriptor,
+    DebugAdapterDescriptorFactory,
+    DebugAdapterExecutable,
+    ProviderResult
+} from 'vscode';
 import {
     LanguageClient,
     LanguageClientOptions,
@@ -9,6 +17,14 @@ import {
 
 let client: LanguageClient;
 
+// Debug sessions run 'langspace dap', which talks the Debug Adapter
+// Protocol over stdin and stdout
+class LangSpaceDebugAdapterFactory implements DebugAdapterDescriptorFactory {
+    createDebugAdapterDescriptor(): ProviderResult<DebugAdapterDescriptor> {
+        return new DebugAdapterExecutable('langspace', ['dap']);
+    }
+}
+
 export function activate(context: ExtensionContext) {
     // The server is implemented in Go and distributed with the CLI
     // We run 'langspace lsp' to start the server
@@ -38,6 +54,10 @@ export function activate(context: ExtensionContext) {
 
     // Start the client. This will also launch the server
     client.start();
+
+    context.subscriptions.push(
+        debug.registerDebugAdapterDescriptorFactory('langspace', new LangSpaceDebugAdapterFactory())
+    );
 }
 
 export function deactivate(): Thenable<void> | undefined {